@@ -0,0 +1,82 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ezodude/orra/cli/internal/api"
+	"github.com/ezodude/orra/cli/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newFollowCmd(opts *CliOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "follow [orchestration-id]",
+		Short:   "Follow an orchestration's status changes and task results live, until it finishes",
+		Example: `  orra follow o_abc123`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			proj, _, err := config.GetProject(opts.Config, opts.ProjectID)
+			if err != nil {
+				return err
+			}
+
+			client := opts.ApiClient.
+				SetBaseUrl(proj.ServerAddr).
+				SetApiKey(proj.CliAuth)
+
+			err = client.FollowOrchestration(cmd.Context(), args[0], printOrchestrationEvent)
+			if err != nil {
+				return fmt.Errorf("failed to follow orchestration - %w", err)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func printOrchestrationEvent(event api.OrchestrationEvent) error {
+	switch event.Type {
+	case "status":
+		var change api.OrchestrationStatusChange
+		if err := json.Unmarshal(event.Data, &change); err != nil {
+			return err
+		}
+		printFollowLine(change.Timestamp, "orchestration", change.Status, "")
+		for _, result := range change.Results {
+			printFollowLine(change.Timestamp, "orchestration", "result", string(result))
+		}
+		if len(change.Error) > 0 {
+			printFollowLine(change.Timestamp, "orchestration", "error", string(change.Error))
+		}
+	case "task_status":
+		var change api.TaskStatusChange
+		if err := json.Unmarshal(event.Data, &change); err != nil {
+			return err
+		}
+		detail := change.ServiceID
+		if change.Error != "" {
+			detail = change.Error
+		}
+		printFollowLine(change.Timestamp, change.TaskID, change.Status, detail)
+	case "task_result":
+		var result api.TaskResult
+		if err := json.Unmarshal(event.Data, &result); err != nil {
+			return err
+		}
+		printFollowLine(result.Timestamp, result.TaskID, "result", string(result.Output))
+	}
+	return nil
+}
+
+func printFollowLine(at time.Time, subject, status, detail string) {
+	fmt.Printf("%s  %-14s %-12s %s\n", at.Local().Format(time.TimeOnly), subject, status, detail)
+}
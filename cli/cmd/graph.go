@@ -0,0 +1,55 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ezodude/orra/cli/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newGraphCmd(opts *CliOpts) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "graph [orchestration-id]",
+		Short: "Print an orchestration's task graph as Mermaid or Graphviz DOT",
+		Example: `  orra graph o_abc123 > plan.mmd
+  orra graph o_abc123 --format dot | dot -Tsvg > plan.svg`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "mermaid" && format != "dot" {
+				return fmt.Errorf("--format must be mermaid or dot")
+			}
+
+			proj, _, err := config.GetProject(opts.Config, opts.ProjectID)
+			if err != nil {
+				return err
+			}
+
+			client := opts.ApiClient.
+				SetBaseUrl(proj.ServerAddr).
+				SetApiKey(proj.CliAuth)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), client.GetTimeout())
+			defer cancel()
+
+			graph, err := client.GetOrchestrationGraph(ctx, args[0], format)
+			if err != nil {
+				return fmt.Errorf("failed to get orchestration graph - %w", err)
+			}
+
+			fmt.Print(graph)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "mermaid", "Graph format, mermaid or dot")
+	return cmd
+}
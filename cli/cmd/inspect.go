@@ -23,6 +23,7 @@ func newInspectCmd(opts *CliOpts) *cobra.Command {
 	var detailed bool
 	var shortUpdates bool
 	var longUpdates bool
+	var showTimeline bool
 
 	cmd := &cobra.Command{
 		Use:   "inspect [orchestration-id]",
@@ -56,6 +57,34 @@ func newInspectCmd(opts *CliOpts) *cobra.Command {
 			fmt.Printf("│ Status:  %s\n", formatStatus(inspection.Status.String()))
 			fmt.Printf("│ Action:  %s\n", inspection.Action)
 			fmt.Printf("│ Created: %s ago\n", formatDuration(inspection.Duration))
+			if inspection.ParentID != "" {
+				fmt.Printf("│ Parent:  %s\n", inspection.ParentID)
+			}
+			if inspection.RetryOf != "" {
+				fmt.Printf("│ Retries: %s\n", inspection.RetryOf)
+			}
+			if inspection.CloneOf != "" {
+				fmt.Printf("│ Clones:  %s\n", inspection.CloneOf)
+			}
+			if inspection.Chain != nil {
+				fmt.Printf("│ Chain:   %s\n", formatChain(inspection.Chain))
+			}
+			if inspection.SLA != nil {
+				sla := inspection.SLA.Deadline.Local().Format(time.RFC3339)
+				if inspection.SLA.Breached {
+					sla += " (breached)"
+				}
+				fmt.Printf("│ SLA:     %s\n", sla)
+			}
+			if inspection.Usage != nil {
+				fmt.Printf("│ Usage:   %s\n", formatUsage(inspection.Usage, inspection.Budget))
+				if planning := inspection.Usage.Planning; planning != nil {
+					fmt.Printf("│ Planning: %d tokens, $%.4f over %d LLM call(s)\n", planning.Tokens, planning.CostUSD, planning.Calls)
+				}
+			}
+			for _, child := range inspection.Children {
+				fmt.Printf("│ Child:   %s (%s)\n", child.ID, child.TaskID)
+			}
 			if inspection.Error != nil {
 				fmt.Printf("│ Error:   %s\n", string(inspection.Error))
 			}
@@ -97,6 +126,12 @@ func newInspectCmd(opts *CliOpts) *cobra.Command {
 							timestamp,
 							formatStatus(status.Status.String()),
 						)
+						if status.CacheHit {
+							statusLine += " (cached result)"
+						}
+						if status.Slow != nil {
+							statusLine += fmt.Sprintf(" (slow, usually %s)", formatDuration(status.Slow.Mean))
+						}
 						if status.Error != "" {
 							statusLine += fmt.Sprintf(" - %s", status.Error)
 						}
@@ -188,6 +223,14 @@ func newInspectCmd(opts *CliOpts) *cobra.Command {
 				}
 			}
 
+			if showTimeline {
+				timeline, err := client.GetOrchestrationTimeline(ctx, orchestrationID)
+				if err != nil {
+					return fmt.Errorf("failed to get orchestration timeline - %w", err)
+				}
+				printTimeline(timeline)
+			}
+
 			return nil
 		},
 	}
@@ -195,6 +238,7 @@ func newInspectCmd(opts *CliOpts) *cobra.Command {
 	cmd.Flags().BoolVarP(&detailed, "detailed", "d", false, "Show detailed task history with I/O")
 	cmd.Flags().BoolVarP(&shortUpdates, "updates", "u", false, "Show summarized progress updates (first and last only)")
 	cmd.Flags().BoolVar(&longUpdates, "long-updates", false, "Show all progress updates with complete details")
+	cmd.Flags().BoolVarP(&showTimeline, "timeline", "t", false, "Show the orchestration's execution timeline")
 
 	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if shortUpdates && longUpdates {
@@ -206,10 +250,58 @@ func newInspectCmd(opts *CliOpts) *cobra.Command {
 	return cmd
 }
 
+func printTimeline(timeline *api.OrchestrationTimeline) {
+	fmt.Printf("\n┌─ Timeline (%s)\n", formatDuration(timeline.Duration))
+	fmt.Printf("│ %-9s %-24s %-10s %s\n", "ELAPSED", "EVENT", "DURATION", "DETAILS")
+	fmt.Printf("│ %s\n", strings.Repeat("─", 80))
+	for _, event := range timeline.Events {
+		duration := "-"
+		if event.Duration > 0 {
+			duration = formatDuration(event.Duration)
+		}
+		fmt.Printf("│ %-9s %-24s %-10s %s\n", formatDuration(event.Elapsed), event.Type, duration, formatTimelineDetails(event))
+	}
+	fmt.Printf("└─────\n")
+}
+
+func formatTimelineDetails(event api.TimelineEvent) string {
+	var details []string
+	if event.TaskID != "" {
+		details = append(details, event.TaskID)
+	}
+	if event.Attempt > 0 {
+		details = append(details, fmt.Sprintf("attempt %d", event.Attempt))
+	}
+	if event.Instance != "" {
+		details = append(details, "instance "+event.Instance)
+	}
+	if event.CacheHit {
+		details = append(details, "cached result")
+	}
+	if event.Slow != nil {
+		details = append(details, fmt.Sprintf("slow, usually %s", formatDuration(event.Slow.Mean)))
+	}
+	if event.Event != "" {
+		details = append(details, event.Event)
+	}
+	if event.Webhook != "" {
+		details = append(details, event.Webhook)
+	}
+	if event.StatusCode != 0 {
+		details = append(details, fmt.Sprintf("HTTP %d", event.StatusCode))
+	}
+	if event.Error != "" {
+		details = append(details, formatInspectionError(event.Error))
+	}
+	return strings.Join(details, " · ")
+}
+
 func getStatusSuffix(status api.Status) string {
 	switch strings.ToLower(status.String()) {
 	case "failed":
 		return "[FAILED]"
+	case "timed out":
+		return "[TIMED OUT]"
 	case "not_actionable":
 		return "[NOT ACTIONABLE]"
 	default:
@@ -247,6 +339,32 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%.1fh", d.Hours())
 }
 
+func formatUsage(usage *api.OrchestrationUsage, budget *api.Budget) string {
+	tokens := fmt.Sprintf("%d tokens", usage.Tokens)
+	cost := fmt.Sprintf("$%.4f", usage.CostUSD)
+	if budget != nil && budget.MaxTokens > 0 {
+		tokens += fmt.Sprintf(" of %d", budget.MaxTokens)
+	}
+	if budget != nil && budget.MaxCostUSD > 0 {
+		cost += fmt.Sprintf(" of $%.4f", budget.MaxCostUSD)
+	}
+	if usage.BudgetExceeded {
+		return fmt.Sprintf("%s, %s (budget exceeded)", tokens, cost)
+	}
+	return fmt.Sprintf("%s, %s", tokens, cost)
+}
+
+func formatChain(chain *api.ContinuationChain) string {
+	parts := []string{fmt.Sprintf("iteration %d", chain.Iteration)}
+	if chain.Previous != "" {
+		parts = append(parts, "continues "+chain.Previous)
+	}
+	if chain.Next != "" {
+		parts = append(parts, "continued as "+chain.Next)
+	}
+	return strings.Join(parts, ", ")
+}
+
 func formatInspectionError(err string) string {
 	if err == "" {
 		return "─"
@@ -25,6 +25,7 @@ func newProjectsCmd(opts *CliOpts) *cobra.Command {
 	cmd.AddCommand(newProjectCreateCmd(opts))
 	cmd.AddCommand(newProjectListCmd(opts))
 	cmd.AddCommand(newProjectUseCmd(opts))
+	cmd.AddCommand(newProjectRemoveCmd(opts))
 
 	return cmd
 }
@@ -122,3 +123,42 @@ func newProjectUseCmd(opts *CliOpts) *cobra.Command {
 		},
 	}
 }
+
+func newProjectRemoveCmd(opts *CliOpts) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm [name]",
+		Short: "Remove a project",
+		Long:  `Remove a project from the Plan Engine for good, cancelling its running orchestrations and disconnecting its services.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			projectName := args[0]
+
+			proj, exists := opts.Config.Projects[projectName]
+			if !exists {
+				return fmt.Errorf("project %s not found", projectName)
+			}
+
+			client := opts.ApiClient.
+				SetBaseUrl(proj.ServerAddr).
+				SetApiKey(proj.CliAuth)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), client.GetTimeout())
+			defer cancel()
+
+			if err := client.DeleteProject(ctx); err != nil {
+				return fmt.Errorf("failed to remove project - %w", err)
+			}
+
+			delete(opts.Config.Projects, projectName)
+			if opts.Config.CurrentProject == projectName {
+				opts.Config.CurrentProject = ""
+			}
+			if err := config.SaveConfig(opts.ConfigPath, opts.Config); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+
+			fmt.Printf("Project %s removed\n", projectName)
+			return nil
+		},
+	}
+}
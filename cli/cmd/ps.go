@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -25,10 +26,15 @@ const (
 	symbolFailed        = "✕ " // Cross for failed
 	symbolNotActionable = "⊘ " // Prohibited circle for not actionable
 	symbolPaused        = "⏸ " // Pause icon for paused
+	symbolTimedOut      = "⧗ " // Hourglass for timed out
+	symbolScheduled     = "◷ " // Clock for scheduled
+	symbolQueued        = "⋯ " // Ellipsis for queued
+	symbolSkipped       = "↷ " // Arrow for tasks skipped by a branch
 )
 
 func newPsCmd(opts *CliOpts) *cobra.Command {
 	var wide bool
+	var labels, statuses []string
 
 	cmd := &cobra.Command{
 		Use:   "ps",
@@ -46,7 +52,7 @@ func newPsCmd(opts *CliOpts) *cobra.Command {
 			ctx, cancel := context.WithTimeout(cmd.Context(), client.GetTimeout())
 			defer cancel()
 
-			orchestrations, err := client.ListOrchestrations(ctx)
+			orchestrations, err := client.ListOrchestrations(ctx, labels, statuses)
 			if err != nil {
 				return fmt.Errorf("failed to list orchestrated actions - %w", err)
 			}
@@ -73,15 +79,22 @@ func newPsCmd(opts *CliOpts) *cobra.Command {
 					"ERROR",
 					func(o api.OrchestrationView) string { return truncateString(formatListError(o.Error), 35) },
 					37,
+				}, psColumn{
+					"LABELS",
+					func(o api.OrchestrationView) string { return truncateString(formatLabels(o.Labels), 35) },
+					37,
 				})
 			}
 
-			// Prepare all orchestrations in order: Processing, Pending, Completed, Failed, NotActionable
+			// Prepare all orchestrations in order: Processing, Pending, Queued, Scheduled, Completed, Failed, TimedOut, NotActionable
 			var allOrchestrations []api.OrchestrationView
 			allOrchestrations = append(allOrchestrations, orchestrations.Processing...)
 			allOrchestrations = append(allOrchestrations, orchestrations.Pending...)
+			allOrchestrations = append(allOrchestrations, orchestrations.Queued...)
+			allOrchestrations = append(allOrchestrations, orchestrations.Scheduled...)
 			allOrchestrations = append(allOrchestrations, orchestrations.Completed...)
 			allOrchestrations = append(allOrchestrations, orchestrations.Failed...)
+			allOrchestrations = append(allOrchestrations, orchestrations.TimedOut...)
 			allOrchestrations = append(allOrchestrations, orchestrations.NotActionable...)
 
 			if len(allOrchestrations) == 0 {
@@ -112,6 +125,8 @@ func newPsCmd(opts *CliOpts) *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&wide, "wide", "w", false, "Show more details including errors")
+	cmd.Flags().StringArrayVarP(&labels, "label", "l", nil, "Only list orchestrations with this label, as key:value or key (repeatable)")
+	cmd.Flags().StringSliceVar(&statuses, "status", nil, "Only list orchestrations with one of these statuses, e.g. failed,timed_out")
 	return cmd
 }
 
@@ -167,20 +182,40 @@ func formatListError(err json.RawMessage) string {
 	return string(err)
 }
 
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "─"
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+":"+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 func formatStatus(status string) string {
 	switch strings.ToLower(status) {
 	case "pending":
 		return symbolPending + status
 	case "processing":
 		return symbolProcessing + status
+	case "queued":
+		return symbolQueued + status
+	case "scheduled":
+		return symbolScheduled + status
 	case "paused":
 		return symbolPaused + status
 	case "completed":
 		return symbolCompleted + status
 	case "failed":
 		return symbolFailed + status
+	case "timed out":
+		return symbolTimedOut + status
 	case "not actionable":
 		return symbolNotActionable + status
+	case "skipped":
+		return symbolSkipped + status
 	default:
 		return "  " + status // Double space to align with other symbols
 	}
@@ -68,6 +68,8 @@ func NewOrraCommand(opts *CliOpts) *cobra.Command {
 	cmd.AddCommand(newAPIKeysCmd(opts))
 	cmd.AddCommand(newPsCmd(opts))
 	cmd.AddCommand(newInspectCmd(opts))
+	cmd.AddCommand(newGraphCmd(opts))
+	cmd.AddCommand(newFollowCmd(opts))
 	cmd.AddCommand(newGroundingCmd(opts))
 	//cmd.AddCommand(newLogsCmd(opts))
 	cmd.AddCommand(newVerifyCmd(opts))
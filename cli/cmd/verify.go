@@ -45,6 +45,7 @@ func newVerifyRunCmd(opts *CliOpts) *cobra.Command {
 		webhookUrl             string
 		timeout                string
 		healthCheckGracePeriod string
+		priority               string
 		quiet                  bool
 	)
 
@@ -90,6 +91,7 @@ execute the required project services`,
 				Webhook:                webhookUrl,
 				Timeout:                timeout,
 				HealthCheckGracePeriod: healthCheckGracePeriod,
+				Priority:               priority,
 			})
 			if err != nil {
 				return fmt.Errorf("failed to create orchestration - %w", err)
@@ -128,6 +130,8 @@ execute the required project services`,
 (defaults to 30s)`)
 	cmd.Flags().StringVarP(&healthCheckGracePeriod, "health-check-grace-period", "g", "", `Set grace period for an unhealthy service or agent before terminating an orchestration
 (defaults to 30m)`)
+	cmd.Flags().StringVar(&priority, "priority", "", `Set the orchestration's priority when queued behind others, one of high, normal or low
+(defaults to normal)`)
 	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, `Suppress extra explanation
 (defaults to false)`)
 
@@ -10,7 +10,9 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
 
+	"github.com/ezodude/orra/cli/internal/api"
 	"github.com/ezodude/orra/cli/internal/config"
 	"github.com/spf13/cobra"
 )
@@ -26,15 +28,21 @@ func newWebhooksCmd(opts *CliOpts) *cobra.Command {
 
 	cmd.AddCommand(newWebhookAddCmd(opts))
 	cmd.AddCommand(newWebhookListCmd(opts))
+	cmd.AddCommand(newWebhookTestCmd(opts))
 
 	return cmd
 }
 
 func newWebhookAddCmd(opts *CliOpts) *cobra.Command {
-	return &cobra.Command{
+	var events []string
+	var format string
+	var headers map[string]string
+	var timeout string
+
+	cmd := &cobra.Command{
 		Use:   "add [webhook url]",
 		Short: "Add a webhook to the project",
-		Long:  "Add a webhook to the project so you can receive orchestration results.",
+		Long:  "Add a webhook to the project so you can receive orchestration results and project events.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			projectName, err := getProjectName(opts)
@@ -60,7 +68,13 @@ func newWebhookAddCmd(opts *CliOpts) *cobra.Command {
 			ctx, cancel := context.WithTimeout(cmd.Context(), client.GetTimeout())
 			defer cancel()
 
-			webhook, err := client.AddWebhook(ctx, webhookUrl)
+			webhook, err := client.AddWebhook(ctx, api.NewWebhook{
+				Url:     webhookUrl,
+				Events:  events,
+				Format:  format,
+				Headers: headers,
+				Timeout: timeout,
+			})
 			if err != nil {
 				return fmt.Errorf("failed to add webhook - %w", err)
 			}
@@ -74,10 +88,32 @@ func newWebhookAddCmd(opts *CliOpts) *cobra.Command {
 
 			fmt.Printf("New webhook added to project %s:\n", projectName)
 			fmt.Printf("Webhook: %s\n", webhook.Url)
+			if len(webhook.Events) > 0 {
+				fmt.Printf("Events: %s\n", strings.Join(webhook.Events, ", "))
+			}
+			if webhook.Format != "" {
+				fmt.Printf("Format: %s\n", webhook.Format)
+			}
+			if len(webhook.Headers) > 0 {
+				fmt.Printf("Headers: %s\n", strings.Join(webhook.Headers, ", "))
+			}
+			if webhook.Timeout != "" {
+				fmt.Printf("Timeout: %s\n", webhook.Timeout)
+			}
+			if webhook.Secret != "" {
+				fmt.Printf("Signing secret: %s\n", webhook.Secret)
+				fmt.Println("Keep it safe, it won't be shown again. Deliveries are signed with it in the X-Orra-Signature header.")
+			}
 
 			return nil
 		},
 	}
+
+	cmd.Flags().StringSliceVar(&events, "events", nil, "Only send these project events to the webhook, e.g. orchestration.failed,task.failed")
+	cmd.Flags().StringVar(&format, "format", "", "Payload format of the webhook's deliveries, native (default) or cloudevents")
+	cmd.Flags().StringToStringVar(&headers, "header", nil, "Static header sent with every delivery, e.g. Authorization='Bearer token' (repeatable)")
+	cmd.Flags().StringVar(&timeout, "timeout", "", "Delivery timeout, e.g. 30s (defaults to 10s)")
+	return cmd
 }
 
 func newWebhookListCmd(opts *CliOpts) *cobra.Command {
@@ -109,3 +145,48 @@ func newWebhookListCmd(opts *CliOpts) *cobra.Command {
 		},
 	}
 }
+
+func newWebhookTestCmd(opts *CliOpts) *cobra.Command {
+	return &cobra.Command{
+		Use:   "test [webhook url]",
+		Short: "Send a test event to a webhook",
+		Long:  "Send a synthetic event to one of the project's webhooks to check it's reachable before running orchestrations.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			projectName, err := getProjectName(opts)
+			if err != nil {
+				return err
+			}
+
+			proj, exists := opts.Config.Projects[projectName]
+			if !exists {
+				return fmt.Errorf("project %s not found", projectName)
+			}
+
+			webhookUrl := args[0]
+			if !contains(proj.Webhooks, webhookUrl) {
+				return fmt.Errorf("webhook not found for project %s", projectName)
+			}
+
+			client := opts.ApiClient.SetBaseUrl(proj.ServerAddr).SetApiKey(proj.CliAuth)
+			ctx, cancel := context.WithTimeout(cmd.Context(), client.GetTimeout())
+			defer cancel()
+
+			delivery, err := client.TestWebhook(ctx, webhookUrl)
+			if err != nil {
+				return fmt.Errorf("failed to test webhook - %w", err)
+			}
+
+			if delivery.Succeeded {
+				fmt.Printf("Webhook %s accepted the test event\n", webhookUrl)
+			} else {
+				fmt.Printf("Webhook %s failed to accept the test event: %s\n", webhookUrl, delivery.Error)
+			}
+			if delivery.StatusCode != 0 {
+				fmt.Printf("Response code: %d\n", delivery.StatusCode)
+			}
+			fmt.Printf("Latency: %dms\n", delivery.LatencyMs)
+			return nil
+		},
+	}
+}
@@ -7,7 +7,10 @@
 package api
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -27,7 +30,36 @@ type AdditionalAPIKey struct {
 }
 
 type Webhook struct {
-	Url string `json:"url"`
+	Url     string   `json:"url"`
+	Events  []string `json:"events,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Headers []string `json:"headers,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+	Secret  string   `json:"secret,omitempty"`
+}
+
+// NewWebhook is a webhook to add to a project, with the static headers sent with its deliveries
+type NewWebhook struct {
+	Url     string            `json:"url"`
+	Events  []string          `json:"events,omitempty"`
+	Format  string            `json:"format,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+}
+
+// WebhookDelivery is the outcome of delivering an event to a webhook
+type WebhookDelivery struct {
+	ID         string `json:"id"`
+	Succeeded  bool   `json:"succeeded"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WebhookID returns the plan engine's ID for a webhook, it's derived from the webhook's URL
+func WebhookID(webhookUrl string) string {
+	sum := sha256.Sum256([]byte(webhookUrl))
+	return "wh_" + hex.EncodeToString(sum[:8])
 }
 
 // Client manages communication with the plan engine API
@@ -55,6 +87,7 @@ type OrchestrationRequest struct {
 	Webhook                string                   `json:"webhook"`
 	Timeout                string                   `json:"timeout,omitempty"`
 	HealthCheckGracePeriod string                   `json:"healthCheckGracePeriod,omitempty"`
+	Priority               string                   `json:"priority,omitempty"`
 }
 
 type Status string
@@ -74,6 +107,7 @@ type OrchestrationView struct {
 	Status       Status               `json:"status"`
 	Error        json.RawMessage      `json:"error,omitempty"`
 	Timestamp    time.Time            `json:"timestamp"`
+	Labels       map[string]string    `json:"labels,omitempty"`
 	Compensation *CompensationSummary `json:"compensation,omitempty"`
 }
 
@@ -107,25 +141,115 @@ func (cs *CompensationSummary) String() string {
 }
 
 type OrchestrationListView struct {
+	Scheduled     []OrchestrationView `json:"scheduled,omitempty"`
+	Queued        []OrchestrationView `json:"queued,omitempty"`
 	Pending       []OrchestrationView `json:"pending,omitempty"`
 	Processing    []OrchestrationView `json:"processing,omitempty"`
 	Completed     []OrchestrationView `json:"completed,omitempty"`
 	Failed        []OrchestrationView `json:"failed,omitempty"`
+	TimedOut      []OrchestrationView `json:"timedOut,omitempty"`
 	NotActionable []OrchestrationView `json:"notActionable,omitempty"`
 }
 
 // OrchestrationInspectResponse represents the detailed inspection view of an orchestration
 type OrchestrationInspectResponse struct {
 	ID        string                `json:"id"`
+	ParentID  string                `json:"parentId,omitempty"`
+	RetryOf   string                `json:"retryOf,omitempty"`
+	CloneOf   string                `json:"cloneOf,omitempty"`
+	Chain     *ContinuationChain    `json:"chain,omitempty"`
+	Children  []OrchestrationLink   `json:"children,omitempty"`
 	Status    Status                `json:"status"`
 	Action    string                `json:"action"`
 	Timestamp time.Time             `json:"timestamp"`
 	Error     json.RawMessage       `json:"error,omitempty"`
+	Budget    *Budget               `json:"budget,omitempty"`
+	Usage     *OrchestrationUsage   `json:"usage,omitempty"`
+	SLA       *SLAStatus            `json:"sla,omitempty"`
 	Tasks     []TaskInspectResponse `json:"tasks,omitempty"`
 	Results   []json.RawMessage     `json:"results,omitempty"`
 	Duration  time.Duration         `json:"duration"`
 }
 
+// OrchestrationTimeline lists an orchestration's events in the order they happened
+type OrchestrationTimeline struct {
+	OrchestrationID string          `json:"orchestrationId"`
+	Status          Status          `json:"status"`
+	Duration        time.Duration   `json:"duration"`
+	Events          []TimelineEvent `json:"events"`
+}
+
+// TimelineEvent is a step in an orchestration's execution, Elapsed is the time since the orchestration was accepted
+type TimelineEvent struct {
+	Type       string        `json:"type"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	TaskID     string        `json:"taskId,omitempty"`
+	ServiceID  string        `json:"serviceId,omitempty"`
+	Attempt    int           `json:"attempt,omitempty"`
+	CacheHit   bool          `json:"cacheHit,omitempty"`
+	Instance   string        `json:"instance,omitempty"`
+	Webhook    string        `json:"webhook,omitempty"`
+	Event      string        `json:"event,omitempty"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Slow marks a task that completed far outside its service's usual durations
+	Slow *TaskDurationAnomaly `json:"slow,omitempty"`
+}
+
+// TaskDurationAnomaly describes how far a slow task's duration was from its service's usual durations
+type TaskDurationAnomaly struct {
+	Duration   time.Duration `json:"duration"`
+	Mean       time.Duration `json:"mean"`
+	StdDev     time.Duration `json:"stdDev"`
+	Deviations float64       `json:"deviations"`
+	Samples    int           `json:"samples"`
+}
+
+// Budget caps the tokens and cost an orchestration may consume
+type Budget struct {
+	MaxCostUSD float64 `json:"maxCostUSD,omitempty"`
+	MaxTokens  int     `json:"maxTokens,omitempty"`
+	OnExceeded string  `json:"onExceeded,omitempty"`
+}
+
+// ContinuationChain links an orchestration to the ones before and after it in a chain of continuations
+type ContinuationChain struct {
+	Iteration int    `json:"iteration"`
+	Previous  string `json:"previous,omitempty"`
+	Next      string `json:"next,omitempty"`
+}
+
+// SLAStatus is an orchestration's SLA deadline and whether it was breached
+type SLAStatus struct {
+	Deadline time.Time `json:"deadline"`
+	Breached bool      `json:"breached"`
+}
+
+// OrchestrationUsage totals the usage reported by an orchestration's tasks
+type OrchestrationUsage struct {
+	Tokens         int     `json:"tokens"`
+	CostUSD        float64 `json:"costUSD"`
+	BudgetExceeded bool    `json:"budgetExceeded,omitempty"`
+	// Planning is the LLM usage of planning the orchestration
+	Planning *PlanningUsage `json:"planning,omitempty"`
+}
+
+// PlanningUsage is the tokens and cost of the LLM calls made to plan an orchestration
+type PlanningUsage struct {
+	Tokens  int     `json:"tokens"`
+	CostUSD float64 `json:"costUSD"`
+	Calls   int     `json:"calls"`
+	Model   string  `json:"model,omitempty"`
+}
+
+// OrchestrationLink ties a child orchestration to the parent task that launched it
+type OrchestrationLink struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskId"`
+}
+
 // TaskInspectResponse represents the detailed view of a task within an orchestration
 type TaskInspectResponse struct {
 	ID                  string                    `json:"id"`
@@ -217,6 +341,9 @@ type TaskStatusEvent struct {
 	Timestamp       time.Time `json:"timestamp"`
 	ServiceID       string    `json:"serviceId,omitempty"`
 	Error           string    `json:"error,omitempty"`
+	CacheHit        bool      `json:"cacheHit,omitempty"`
+	// Slow marks a task that completed far outside its service's usual durations
+	Slow *TaskDurationAnomaly `json:"slow,omitempty"`
 }
 
 type GroundingUseCase struct {
@@ -291,6 +418,25 @@ func (c *Client) AddProject(ctx context.Context, name string) (*Project, error)
 	return &project, nil
 }
 
+func (c *Client) DeleteProject(ctx context.Context) error {
+	var apiErr ErrorResponse
+
+	err := requests.
+		URL(c.baseURL).
+		Path("/projects").
+		Method(http.MethodDelete).
+		Client(c.httpClient).
+		Header("Authorization", "Bearer "+c.apiKey).
+		ErrorJSON(&apiErr).
+		Fetch(ctx)
+
+	if err != nil {
+		return FormatAPIError(apiErr, "project")
+	}
+
+	return nil
+}
+
 func (c *Client) GenerateAdditionalApiKey(ctx context.Context) (*AdditionalAPIKey, error) {
 	var response AdditionalAPIKey
 	var apiErr ErrorResponse
@@ -312,7 +458,7 @@ func (c *Client) GenerateAdditionalApiKey(ctx context.Context) (*AdditionalAPIKe
 	return &response, nil
 }
 
-func (c *Client) AddWebhook(ctx context.Context, webhookUrl string) (*Webhook, error) {
+func (c *Client) AddWebhook(ctx context.Context, webhook NewWebhook) (*Webhook, error) {
 	var response Webhook
 	var apiErr ErrorResponse
 
@@ -321,7 +467,7 @@ func (c *Client) AddWebhook(ctx context.Context, webhookUrl string) (*Webhook, e
 		Path("/webhooks").
 		Method(http.MethodPost).
 		Client(c.httpClient).
-		BodyJSON(Webhook{Url: webhookUrl}).
+		BodyJSON(webhook).
 		Header("Authorization", "Bearer "+c.apiKey).
 		ToJSON(&response).
 		ErrorJSON(&apiErr).
@@ -334,14 +480,16 @@ func (c *Client) AddWebhook(ctx context.Context, webhookUrl string) (*Webhook, e
 	return &response, nil
 }
 
-// ListOrchestrations retrieves all orchestrations for a project
-func (c *Client) ListOrchestrations(ctx context.Context) (*OrchestrationListView, error) {
+// ListOrchestrations retrieves a project's orchestrations, optionally filtered by labels (key:value) and statuses
+func (c *Client) ListOrchestrations(ctx context.Context, labels, statuses []string) (*OrchestrationListView, error) {
 	var response OrchestrationListView
 	var apiErr ErrorResponse
 
 	err := requests.
 		URL(c.baseURL).
 		Path("/orchestrations").
+		ParamOptional("label", labels...).
+		ParamOptional("status", statuses...).
 		Method(http.MethodGet).
 		Client(c.httpClient).
 		Header("Authorization", "Bearer "+c.apiKey).
@@ -377,6 +525,128 @@ func (c *Client) GetOrchestrationInspection(ctx context.Context, id string) (*Or
 	return &inspection, err
 }
 
+func (c *Client) GetOrchestrationTimeline(ctx context.Context, id string) (*OrchestrationTimeline, error) {
+	var timeline OrchestrationTimeline
+	var apiErr ErrorResponse
+
+	err := requests.
+		URL(c.baseURL).
+		Pathf("/orchestrations/%s/timeline", id).
+		Method(http.MethodGet).
+		Client(c.httpClient).
+		Header("Authorization", "Bearer "+c.apiKey).
+		ToJSON(&timeline).
+		ErrorJSON(&apiErr).
+		Fetch(ctx)
+
+	if err != nil {
+		return nil, FormatAPIError(apiErr, "orchestration timeline")
+	}
+
+	return &timeline, nil
+}
+
+// GetOrchestrationGraph returns an orchestration's planned task graph rendered in the format, mermaid or dot
+func (c *Client) GetOrchestrationGraph(ctx context.Context, id, format string) (string, error) {
+	var graph string
+	var apiErr ErrorResponse
+
+	err := requests.
+		URL(c.baseURL).
+		Pathf("/orchestrations/%s/graph", id).
+		Param("format", format).
+		Method(http.MethodGet).
+		Client(c.httpClient).
+		Header("Authorization", "Bearer "+c.apiKey).
+		ToString(&graph).
+		ErrorJSON(&apiErr).
+		Fetch(ctx)
+
+	if err != nil {
+		return "", FormatAPIError(apiErr, "orchestration graph")
+	}
+
+	return graph, nil
+}
+
+// OrchestrationEvent is an event streamed while following an orchestration, its data depends on its type
+type OrchestrationEvent struct {
+	Type string
+	Data json.RawMessage
+}
+
+// OrchestrationStatusChange is streamed as an orchestration's status changes, with its results or error once it finishes
+type OrchestrationStatusChange struct {
+	Status    string            `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+	Results   []json.RawMessage `json:"results,omitempty"`
+	Error     json.RawMessage   `json:"error,omitempty"`
+}
+
+// TaskStatusChange is streamed as one of an orchestration's tasks changes status
+type TaskStatusChange struct {
+	TaskID    string    `json:"taskId"`
+	Status    string    `json:"status"`
+	ServiceID string    `json:"serviceId,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TaskResult is streamed as one of an orchestration's tasks produces its output
+type TaskResult struct {
+	TaskID    string          `json:"taskId"`
+	ServiceID string          `json:"serviceId,omitempty"`
+	Output    json.RawMessage `json:"output"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// FollowOrchestration streams an orchestration's events to handle until it finishes. Streams aren't bound by the
+// client's timeout, cancel the context to stop following.
+func (c *Client) FollowOrchestration(ctx context.Context, id string, handle func(OrchestrationEvent) error) error {
+	var apiErr ErrorResponse
+	streamClient := *c.httpClient
+	streamClient.Timeout = 0
+
+	err := requests.
+		URL(c.baseURL).
+		Pathf("/orchestrations/%s/events", id).
+		Method(http.MethodGet).
+		Client(&streamClient).
+		Header("Authorization", "Bearer "+c.apiKey).
+		Accept("text/event-stream").
+		ErrorJSON(&apiErr).
+		Handle(func(res *http.Response) error {
+			defer res.Body.Close()
+			scanner := bufio.NewScanner(res.Body)
+			scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+			var event OrchestrationEvent
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case line == "":
+					if event.Type != "" {
+						if err := handle(event); err != nil {
+							return err
+						}
+					}
+					event = OrchestrationEvent{}
+				case strings.HasPrefix(line, "event: "):
+					event.Type = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					event.Data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+				}
+			}
+			return scanner.Err()
+		}).
+		Fetch(ctx)
+
+	if err != nil && apiErr.Error.Message != "" {
+		return FormatAPIError(apiErr, "orchestration events")
+	}
+	return err
+}
+
 func (c *Client) CreateOrchestration(ctx context.Context, or OrchestrationRequest) (*Orchestration, error) {
 	var response *Orchestration
 	var apiErr ErrorResponse
@@ -481,9 +751,33 @@ func (c *Client) RemoveGroundingSpec(ctx context.Context, specName string) error
 }
 
 func (v OrchestrationListView) Empty() bool {
-	return len(v.Pending) == 0 &&
+	return len(v.Scheduled) == 0 &&
+		len(v.Queued) == 0 &&
+		len(v.Pending) == 0 &&
 		len(v.Processing) == 0 &&
 		len(v.Completed) == 0 &&
 		len(v.Failed) == 0 &&
+		len(v.TimedOut) == 0 &&
 		len(v.NotActionable) == 0
 }
+
+func (c *Client) TestWebhook(ctx context.Context, webhookUrl string) (*WebhookDelivery, error) {
+	var response WebhookDelivery
+	var apiErr ErrorResponse
+
+	err := requests.
+		URL(c.baseURL).
+		Pathf("/webhooks/%s/test", WebhookID(webhookUrl)).
+		Method(http.MethodPost).
+		Client(c.httpClient).
+		Header("Authorization", "Bearer "+c.apiKey).
+		ToJSON(&response).
+		ErrorJSON(&apiErr).
+		Fetch(ctx)
+
+	if err != nil {
+		return nil, FormatAPIError(apiErr, "webhook")
+	}
+
+	return &response, nil
+}
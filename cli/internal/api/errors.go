@@ -16,6 +16,8 @@ type Error struct {
 	Kind    string `json:"kind"`
 	Param   string `json:"param"`
 	Message string `json:"message"`
+	// RequestID identifies the failed request in the plan engine's logs
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // ErrorResponse wraps the error response from the API
@@ -60,7 +62,12 @@ func FormatAPIError(errRes ErrorResponse, resource string) error {
 		}
 	}
 
-	// Fallback to original message if no specific handling
+	// Fallback to original message if no specific handling, with the request's ID to report it
+	if errRes.Error.RequestID != "" {
+		return &FriendlyError{
+			UserMsg: fmt.Sprintf("%s (request ID: %s)", errRes.Error.Message, errRes.Error.RequestID),
+		}
+	}
 	return &FriendlyError{
 		UserMsg: errRes.Error.Message,
 	}
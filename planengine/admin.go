@@ -0,0 +1,293 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+const (
+	AdminKeyFile   = "admin.key"
+	AdminKeyPrefix = "sk-orra-admin-"
+	adminActor     = "admin"
+)
+
+var (
+	ErrAdminDisabled   = errors.New("the admin API is not enabled")
+	ErrInvalidAdminKey = errors.New("invalid admin credential")
+)
+
+// AdminCredential authorises operator only operations across every project.
+// Only a digest of the key is held in memory.
+type AdminCredential struct {
+	digest [sha256.Size]byte
+}
+
+func NewAdminCredential(key string) *AdminCredential {
+	return &AdminCredential{digest: sha256.Sum256([]byte(key))}
+}
+
+// Matches compares a presented key with the admin key in constant time
+func (c *AdminCredential) Matches(key string) bool {
+	digest := sha256.Sum256([]byte(key))
+	return subtle.ConstantTimeCompare(c.digest[:], digest[:]) == 1
+}
+
+// LoadAdminCredential uses the configured admin key or, failing that, the bootstrap key file.
+// A bootstrap key is generated on first start when the file doesn't exist.
+func LoadAdminCredential(cfg Admin, storagePath string, logger zerolog.Logger) (*AdminCredential, error) {
+	if cfg.APIKey != "" {
+		return NewAdminCredential(cfg.APIKey), nil
+	}
+
+	path := cfg.KeyFile
+	if path == "" {
+		path = filepath.Join(filepath.Dir(storagePath), AdminKeyFile)
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return nil, fmt.Errorf("admin key file %s is empty", path)
+		}
+		return NewAdminCredential(key), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read admin key file: %w", err)
+	}
+
+	key, err := generateAdminKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create admin key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write admin key file: %w", err)
+	}
+	logger.Info().Str("Path", path).Msg("Generated bootstrap admin key")
+
+	return NewAdminCredential(key), nil
+}
+
+func generateAdminKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate admin key: %w", err)
+	}
+	return AdminKeyPrefix + hex.EncodeToString(secret), nil
+}
+
+// AdminMiddleware only lets requests bearing the admin credential through, project API keys are never accepted
+func (app *App) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Admin == nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, ErrAdminDisabled))
+			return
+		}
+
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !app.Admin.Matches(key) {
+			logger := app.requestLogger(r)
+			logger.Warn().Str("Path", r.URL.Path).Str("RemoteAddr", r.RemoteAddr).Msg("Rejected admin request")
+			httpErrorResponse(w, logger, errs.E(errs.Unauthenticated, ErrInvalidAdminKey))
+			return
+		}
+
+		principal := &Principal{Actor: adminActor}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal)))
+	}
+}
+
+// AdminProjectSummary is a project as operators see it, key hashes, webhook secrets and webhook headers are
+// left out. Notification channel URLs are bearer secrets, only their hosts are shown.
+type AdminProjectSummary struct {
+	*Project
+	APIKeyHashes    []HashedAPIKey            `json:"apiKeyHashes,omitempty"`
+	WebhookSecrets  map[string]WebhookSecret  `json:"webhookSecrets,omitempty"`
+	WebhookRequests map[string]WebhookRequest `json:"webhookRequests,omitempty"`
+	Notifications   ProjectNotifications      `json:"notifications"`
+	APIKeys         int                       `json:"apiKeys"`
+	ProjectActivity
+}
+
+// ProjectActivity counts what a project holds, and when it was last active
+type ProjectActivity struct {
+	Services           int `json:"services"`
+	ConnectedServices  int `json:"connectedServices"`
+	Orchestrations     int `json:"orchestrations"`
+	LiveOrchestrations int `json:"liveOrchestrations"`
+	// LastActivity is when the project was last changed, or one of its orchestrations last progressed
+	LastActivity time.Time `json:"lastActivity"`
+}
+
+// AdminProjectDetail is a project with an overview of its last day of orchestrations and its services
+type AdminProjectDetail struct {
+	AdminProjectSummary
+	Overview ProjectOverview `json:"overview"`
+}
+
+// ProjectActivity counts the project's services and orchestrations, and finds its last activity
+func (p *PlanEngine) ProjectActivity(project *Project) ProjectActivity {
+	activity := ProjectActivity{LastActivity: project.UpdatedAt}
+
+	services, _ := p.discoverProjectServices(project.ID)
+	activity.Services = len(services)
+	for _, service := range services {
+		if p.WebSocketManager != nil && p.WebSocketManager.IsServiceHealthy(service.ID) {
+			activity.ConnectedServices++
+		}
+	}
+
+	orchestrations := p.getProjectOrchestrations(project.ID)
+	activity.Orchestrations = len(orchestrations)
+
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+	for _, o := range orchestrations {
+		if slices.Contains(liveStatuses, o.Status) {
+			activity.LiveOrchestrations++
+		}
+		last := o.Timestamp
+		if len(o.Lifecycle) > 0 {
+			last = o.Lifecycle[len(o.Lifecycle)-1].Timestamp
+		}
+		if last.After(activity.LastActivity) {
+			activity.LastActivity = last
+		}
+	}
+	return activity
+}
+
+func (p *PlanEngine) adminProjectSummary(project *Project) AdminProjectSummary {
+	return AdminProjectSummary{
+		Project:         project,
+		Notifications:   maskedNotifications(project.Notifications),
+		APIKeys:         len(project.APIKeyHashes),
+		ProjectActivity: p.ProjectActivity(project),
+	}
+}
+
+// maskedNotifications copies notification channels with everything after their URLs' hosts redacted
+func maskedNotifications(notifications ProjectNotifications) ProjectNotifications {
+	masked := ProjectNotifications{Channels: make([]NotificationChannel, 0, len(notifications.Channels))}
+	for _, channel := range notifications.Channels {
+		if u, err := url.Parse(channel.Url); err == nil && u.Host != "" {
+			channel.Url = fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, redactedWebhookValue)
+		} else {
+			channel.Url = redactedWebhookValue
+		}
+		masked.Channels = append(masked.Channels, channel)
+	}
+	return masked
+}
+
+// AdminListProjects lists every project known to the plan engine, with what each holds and when it was last active
+func (app *App) AdminListProjects(w http.ResponseWriter, _ *http.Request) {
+	projects, err := app.Engine.ListProjects()
+	if err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	summaries := make([]AdminProjectSummary, 0, len(projects))
+	for _, project := range projects {
+		summaries = append(summaries, app.Engine.adminProjectSummary(project))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(summaries); err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// AdminInspectProject shows any project, with an overview of its orchestrations and services
+func (app *App) AdminInspectProject(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+	project, err := app.Engine.GetProjectByID(projectID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownProjectErrCode), "unknown project: "+projectID))
+		return
+	}
+
+	detail := AdminProjectDetail{
+		AdminProjectSummary: app.Engine.adminProjectSummary(project),
+		Overview:            app.Engine.ProjectOverview(project.ID, defaultOverviewWindow),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// adminFailRequest is the optional body of a forced failure
+type adminFailRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminFailOrchestration forces an unfinished orchestration in any project to fail
+func (app *App) AdminFailOrchestration(w http.ResponseWriter, r *http.Request) {
+	orchestrationID := mux.Vars(r)["id"]
+
+	var request adminFailRequest
+	if err := decodeOptionalRequest(w, r, &request, adminFailFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if request.Reason == "" {
+		request.Reason = "failed by an administrator"
+	}
+
+	orchestration, err := app.Engine.ForceFailOrchestration(orchestrationID, request.Reason)
+	if errors.Is(err, ErrOrchestrationNotFound) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), err))
+		return
+	} else if errors.Is(err, ErrOrchestrationFinished) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Invalid, err))
+		return
+	} else if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+	setAuditProjectID(r, orchestration.ProjectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":        orchestration.ID,
+		"projectId": orchestration.ProjectID,
+		"status":    orchestration.Status,
+	}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAdminCredential(t *testing.T) {
+	logger := zerolog.Nop()
+
+	t.Run("configured key is used as is", func(t *testing.T) {
+		credential, err := LoadAdminCredential(Admin{APIKey: "sk-orra-admin-configured"}, t.TempDir(), logger)
+		require.NoError(t, err)
+		assert.True(t, credential.Matches("sk-orra-admin-configured"))
+		assert.False(t, credential.Matches("sk-orra-admin-other"))
+	})
+
+	t.Run("bootstrap key is generated once and reused", func(t *testing.T) {
+		storagePath := filepath.Join(t.TempDir(), DBStoreDir)
+		keyFile := filepath.Join(filepath.Dir(storagePath), AdminKeyFile)
+
+		first, err := LoadAdminCredential(Admin{}, storagePath, logger)
+		require.NoError(t, err)
+
+		info, err := os.Stat(keyFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		data, err := os.ReadFile(keyFile)
+		require.NoError(t, err)
+		key := strings.TrimSpace(string(data))
+		assert.True(t, strings.HasPrefix(key, AdminKeyPrefix))
+		assert.True(t, first.Matches(key))
+
+		second, err := LoadAdminCredential(Admin{}, storagePath, logger)
+		require.NoError(t, err)
+		assert.True(t, second.Matches(key))
+	})
+}
+
+func TestAdminRoutes(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	const adminKey = "sk-orra-admin-test"
+	app.Admin = NewAdminCredential(adminKey)
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	require.NoError(t, app.Engine.AddProject(&Project{
+		ID:            "p_other",
+		Name:          "other",
+		APIKey:        app.Engine.GenerateAPIKey(),
+		Notifications: ProjectNotifications{Channels: []NotificationChannel{{Type: NotificationChannelSlack, Url: "https://hooks.slack.com/services/T000/B000/XXXX"}}},
+	}))
+
+	var webhookCalls []map[string]any
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		webhookCalls = append(webhookCalls, payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	orchestration := &Orchestration{ID: "o_running", ProjectID: project.ID, Status: Processing, Webhook: webhook.URL}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+
+	send := func(method, path, credential string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+credential)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("project API keys are rejected", func(t *testing.T) {
+		w := send(http.MethodGet, "/admin/projects", project.APIKey, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = send(http.MethodPost, "/admin/orchestrations/o_running/fail", project.APIKey, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, Processing, orchestration.Status)
+	})
+
+	t.Run("admin key is not a project key", func(t *testing.T) {
+		w := send(http.MethodGet, "/orchestrations", adminKey, nil)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("lists every project without key hashes", func(t *testing.T) {
+		w := send(http.MethodGet, "/admin/projects", adminKey, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// Projects are listed in ID order, the test app's own project comes after p_other
+		var projects []map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&projects))
+		require.Len(t, projects, 2)
+		assert.Equal(t, "p_other", projects[0]["id"])
+		assert.EqualValues(t, 1, projects[0]["apiKeys"])
+		assert.NotContains(t, projects[0], "apiKeyHashes")
+		assert.NotContains(t, projects[0], "apiKey")
+		channels := projects[0]["notifications"].(map[string]any)["channels"].([]any)
+		require.Len(t, channels, 1)
+		assert.Equal(t, "https://hooks.slack.com/"+redactedWebhookValue, channels[0].(map[string]any)["url"], "channel urls are bearer secrets")
+	})
+
+	t.Run("summarises what projects hold and their last activity", func(t *testing.T) {
+		progressed := time.Now().UTC().Add(time.Minute).Truncate(time.Second)
+		app.Engine.orchestrationStore["o_other"] = &Orchestration{
+			ID:        "o_other",
+			ProjectID: "p_other",
+			Status:    Completed,
+			Timestamp: progressed.Add(-time.Minute),
+			Lifecycle: []LifecycleEvent{{Type: "completed", Timestamp: progressed}},
+		}
+		app.Engine.orchestrationStore["o_other_live"] = &Orchestration{ID: "o_other_live", ProjectID: "p_other", Status: Pending, Timestamp: progressed.Add(-time.Hour)}
+		app.Engine.services["p_other"] = map[string]*ServiceInfo{"s_other": {ID: "s_other", Name: "other", ProjectID: "p_other"}}
+		defer func() {
+			delete(app.Engine.orchestrationStore, "o_other")
+			delete(app.Engine.orchestrationStore, "o_other_live")
+			delete(app.Engine.services, "p_other")
+		}()
+
+		w := send(http.MethodGet, "/admin/projects", adminKey, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var projects []AdminProjectSummary
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&projects))
+		require.Len(t, projects, 2)
+		require.Equal(t, "p_other", projects[0].ID)
+		assert.Equal(t, 1, projects[0].Services)
+		assert.Equal(t, 2, projects[0].Orchestrations)
+		assert.Equal(t, 1, projects[0].LiveOrchestrations)
+		assert.True(t, progressed.Equal(projects[0].LastActivity))
+
+		w = send(http.MethodGet, "/admin/projects/p_other", adminKey, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var detail AdminProjectDetail
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&detail))
+		assert.Equal(t, "p_other", detail.ID)
+		assert.Equal(t, 2, detail.Orchestrations)
+		assert.Len(t, detail.Overview.Live, 1)
+		require.Len(t, detail.Overview.Services, 1)
+		assert.Equal(t, "s_other", detail.Overview.Services[0].ID)
+
+		w = send(http.MethodGet, "/admin/projects/p_missing", adminKey, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = send(http.MethodGet, "/admin/projects/p_other", project.APIKey, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("force fails an orchestration in any project", func(t *testing.T) {
+		w := send(http.MethodPost, "/admin/orchestrations/o_running/fail", adminKey, []byte(`{"reason":"stuck","notify":false}`))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), UnknownRequestFieldErrCode)
+		assert.Equal(t, Processing, orchestration.Status)
+
+		w = send(http.MethodPost, "/admin/orchestrations/o_running/fail", adminKey, []byte(`{"reason":"stuck"}`))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, Failed, orchestration.Status)
+		assert.Contains(t, string(orchestration.Error), "stuck")
+		require.Len(t, webhookCalls, 1)
+		assert.Equal(t, "failed", webhookCalls[0]["status"])
+	})
+
+	t.Run("finished orchestrations cannot be failed again", func(t *testing.T) {
+		w := send(http.MethodPost, "/admin/orchestrations/o_running/fail", adminKey, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("unknown orchestration", func(t *testing.T) {
+		w := send(http.MethodPost, "/admin/orchestrations/o_missing/fail", adminKey, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), UnknownOrchestrationErrCode, "the body is optional")
+	})
+}
@@ -0,0 +1,410 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	// AlertMetricFailureRate triggers when the share of orchestrations failing over the rule's window is above its threshold
+	AlertMetricFailureRate = "failure_rate"
+	// AlertMetricServiceDisconnected triggers when a service has been disconnected for longer than the rule's window
+	AlertMetricServiceDisconnected = "service_disconnected"
+	MaxAlertRules                  = 50
+	MaxAlertWindow                 = 24 * time.Hour
+)
+
+// AlertRule describes a condition the plan engine watches a project for, it's announced through the project's
+// webhooks and notification channels when it triggers and again once it resolves
+type AlertRule struct {
+	Name   string `json:"name"`
+	Metric string `json:"metric"`
+	// Threshold is the failure rate, between 0 and 1, a failure_rate rule triggers above
+	Threshold float64 `json:"threshold,omitempty"`
+	// Window is how far back a failure_rate rule looks, or how long a service must be disconnected for
+	Window string `json:"window"`
+	// MinOrchestrations is how many orchestrations must have finished in the window before a failure_rate rule
+	// can trigger, so a single failure doesn't
+	MinOrchestrations int `json:"minOrchestrations,omitempty"`
+	// Service is the ID or name of the service a service_disconnected rule watches, all of them when it's empty
+	Service string `json:"service,omitempty"`
+}
+
+// ProjectAlerts holds the rules a project is alerted on
+type ProjectAlerts struct {
+	Rules []AlertRule `json:"rules"`
+}
+
+// Alert is a rule that has triggered, it's the data of alert.triggered and alert.resolved events
+type Alert struct {
+	Rule        string    `json:"rule"`
+	Metric      string    `json:"metric"`
+	Threshold   float64   `json:"threshold,omitempty"`
+	Window      string    `json:"window"`
+	Value       float64   `json:"value,omitempty"`
+	ServiceID   string    `json:"serviceId,omitempty"`
+	ServiceName string    `json:"serviceName,omitempty"`
+	Since       time.Time `json:"since"`
+}
+
+// ProjectAlertsView is a project's alert rules along with those currently triggered
+type ProjectAlertsView struct {
+	Rules  []AlertRule `json:"rules"`
+	Firing []Alert     `json:"firing"`
+}
+
+// alertState tracks a rule's condition between evaluations, per service for service_disconnected rules
+type alertState struct {
+	projectID string
+	// pendingSince is when the condition was first seen holding
+	pendingSince time.Time
+	firing       bool
+	alert        Alert
+}
+
+// alertStates is the evaluator's in-memory view of every rule's condition, keyed by alertKey
+type alertStates struct {
+	mu     sync.Mutex
+	states map[string]*alertState
+}
+
+// Validate ensures every rule is named uniquely, watches a supported metric and has a usable window
+func (a ProjectAlerts) Validate() error {
+	if len(a.Rules) > MaxAlertRules {
+		return fmt.Errorf("at most %d rules are allowed", MaxAlertRules)
+	}
+
+	names := map[string]bool{}
+	for i, rule := range a.Rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			return fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %d: duplicate name %q", i, rule.Name)
+		}
+		names[rule.Name] = true
+
+		window, err := time.ParseDuration(rule.Window)
+		if err != nil {
+			return fmt.Errorf("rule %q: invalid window: %w", rule.Name, err)
+		}
+		if window < time.Minute || window > MaxAlertWindow {
+			return fmt.Errorf("rule %q: window must be between 1m and %s", rule.Name, MaxAlertWindow)
+		}
+
+		switch rule.Metric {
+		case AlertMetricFailureRate:
+			if rule.Threshold < 0 || rule.Threshold >= 1 {
+				return fmt.Errorf("rule %q: threshold must be at least 0 and below 1", rule.Name)
+			}
+			if rule.MinOrchestrations < 0 {
+				return fmt.Errorf("rule %q: minOrchestrations cannot be negative", rule.Name)
+			}
+			if rule.Service != "" {
+				return fmt.Errorf("rule %q: service only applies to %s rules", rule.Name, AlertMetricServiceDisconnected)
+			}
+		case AlertMetricServiceDisconnected:
+			if rule.Threshold != 0 || rule.MinOrchestrations != 0 {
+				return fmt.Errorf("rule %q: threshold and minOrchestrations only apply to %s rules", rule.Name, AlertMetricFailureRate)
+			}
+		default:
+			return fmt.Errorf("rule %q: metric must be %q or %q", rule.Name, AlertMetricFailureRate, AlertMetricServiceDisconnected)
+		}
+	}
+	return nil
+}
+
+func (r AlertRule) window() time.Duration {
+	window, _ := time.ParseDuration(r.Window)
+	return window
+}
+
+func alertKey(projectID, rule, serviceID string) string {
+	return projectID + "/" + rule + "/" + serviceID
+}
+
+// alertObservation is a rule's condition as of one evaluation
+type alertObservation struct {
+	key   string
+	holds bool
+	// triggers is whether a holding condition has held long enough to fire
+	triggers func(pendingSince time.Time) bool
+	alert    Alert
+}
+
+// EvaluateAlerts periodically checks every project's alert rules, announcing those that trigger or resolve
+func (p *PlanEngine) EvaluateAlerts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.evaluateAlerts(time.Now().UTC())
+		}
+	}
+}
+
+// alertChange is an alert to announce once the evaluation is done with the alert states
+type alertChange struct {
+	project *Project
+	event   string
+	alert   Alert
+}
+
+func (p *PlanEngine) evaluateAlerts(now time.Time) {
+	p.alerts.mu.Lock()
+	if p.alerts.states == nil {
+		p.alerts.states = map[string]*alertState{}
+	}
+
+	var changes []alertChange
+	observed := map[string]bool{}
+	for _, project := range p.cachedProjects() {
+		for _, rule := range project.Alerts.Rules {
+			for _, observation := range p.observeAlertRule(project.ID, rule, now) {
+				observed[observation.key] = true
+				if event, alert, changed := p.applyAlertObservation(project.ID, observation, now); changed {
+					changes = append(changes, alertChange{project: project, event: event, alert: alert})
+				}
+			}
+		}
+	}
+
+	// Rules that were removed, or services that went away, stop being tracked without being announced
+	for key := range p.alerts.states {
+		if !observed[key] {
+			delete(p.alerts.states, key)
+		}
+	}
+	p.alerts.mu.Unlock()
+
+	for _, change := range changes {
+		p.notifyAlert(change.project, change.event, change.alert)
+	}
+}
+
+func (p *PlanEngine) observeAlertRule(projectID string, rule AlertRule, now time.Time) []alertObservation {
+	window := rule.window()
+	base := Alert{Rule: rule.Name, Metric: rule.Metric, Threshold: rule.Threshold, Window: rule.Window}
+
+	switch rule.Metric {
+	case AlertMetricFailureRate:
+		rate, finished := p.recentFailureRate(projectID, now.Add(-window))
+		alert := base
+		alert.Value = rate
+		holds := finished > 0 && finished >= rule.MinOrchestrations && rate > rule.Threshold
+		return []alertObservation{{
+			key:      alertKey(projectID, rule.Name, ""),
+			holds:    holds,
+			triggers: func(time.Time) bool { return true },
+			alert:    alert,
+		}}
+
+	case AlertMetricServiceDisconnected:
+		services, _ := p.discoverProjectServices(projectID)
+		var observations []alertObservation
+		for _, service := range services {
+			if rule.Service != "" && rule.Service != service.ID && rule.Service != service.Name {
+				continue
+			}
+			alert := base
+			alert.ServiceID, alert.ServiceName = service.ID, service.Name
+			observations = append(observations, alertObservation{
+				key:   alertKey(projectID, rule.Name, service.ID),
+				holds: p.WebSocketManager != nil && !p.WebSocketManager.IsServiceHealthy(service.ID),
+				triggers: func(pendingSince time.Time) bool {
+					return now.Sub(pendingSince) >= window
+				},
+				alert: alert,
+			})
+		}
+		return observations
+	}
+	return nil
+}
+
+// applyAlertObservation updates a rule's state with its latest observation, it returns the event to announce when
+// the rule triggered or resolved
+func (p *PlanEngine) applyAlertObservation(projectID string, observation alertObservation, now time.Time) (string, Alert, bool) {
+	state, tracked := p.alerts.states[observation.key]
+
+	if !observation.holds {
+		delete(p.alerts.states, observation.key)
+		if tracked && state.firing {
+			resolved := state.alert
+			resolved.Value = observation.alert.Value
+			return ProjectEventAlertResolved, resolved, true
+		}
+		return "", Alert{}, false
+	}
+
+	if !tracked {
+		state = &alertState{projectID: projectID, pendingSince: now}
+		p.alerts.states[observation.key] = state
+	}
+	if state.firing || !observation.triggers(state.pendingSince) {
+		return "", Alert{}, false
+	}
+
+	state.firing = true
+	state.alert = observation.alert
+	state.alert.Since = state.pendingSince
+	return ProjectEventAlertTriggered, state.alert, true
+}
+
+// recentFailureRate is the share of the project's orchestrations finished since then that failed, along with how
+// many finished
+func (p *PlanEngine) recentFailureRate(projectID string, since time.Time) (float64, int) {
+	var failed, finished int
+	for _, o := range p.getProjectOrchestrations(projectID) {
+		p.orchestrationStoreMu.RLock()
+		status, timestamp := o.Status, o.Timestamp
+		p.orchestrationStoreMu.RUnlock()
+
+		if timestamp.Before(since) {
+			continue
+		}
+		switch status {
+		case Completed, Cancelled, NotActionable:
+			finished++
+		case Failed, TimedOut:
+			finished++
+			failed++
+		}
+	}
+	return failureRate(failed, finished), finished
+}
+
+// notifyAlert announces an alert through the project's webhooks and notification channels
+func (p *PlanEngine) notifyAlert(project *Project, event string, alert Alert) {
+	p.Logger.Info().
+		Str("ProjectID", project.ID).
+		Str("Rule", alert.Rule).
+		Str("ServiceID", alert.ServiceID).
+		Str("Event", event).
+		Msg("Project alert changed")
+
+	p.NotifyProjectWebhooks(project, event, alert)
+
+	for _, channel := range project.Notifications.Channels {
+		if !channel.subscribed(event) {
+			continue
+		}
+		err := p.postNotification(channel.Url, channel.alertMessage(project, event, alert))
+		p.Metrics.ObserveNotificationPost(channel.Type, err == nil)
+		if err != nil {
+			p.Logger.Warn().
+				Err(err).
+				Str("ProjectID", project.ID).
+				Str("Rule", alert.Rule).
+				Str("Channel", channel.Type).
+				Msg("Failed to post alert notification")
+		}
+	}
+}
+
+// FiringAlerts returns the project's currently triggered alerts, oldest first
+func (p *PlanEngine) FiringAlerts(projectID string) []Alert {
+	p.alerts.mu.Lock()
+	defer p.alerts.mu.Unlock()
+
+	firing := make([]Alert, 0)
+	for _, state := range p.alerts.states {
+		if state.projectID == projectID && state.firing {
+			firing = append(firing, state.alert)
+		}
+	}
+	sort.Slice(firing, func(i, j int) bool {
+		return firing[i].Since.Before(firing[j].Since)
+	})
+	return firing
+}
+
+// UpdateProjectAlerts replaces a project's alert rules
+func (p *PlanEngine) UpdateProjectAlerts(projectID string, alerts ProjectAlerts) error {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Alerts = alerts
+	return p.updateProject(updated)
+}
+
+// ProjectAlertsHandler lists the caller's project alert rules and those currently triggered
+func (app *App) ProjectAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProjectFor(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	view := ProjectAlertsView{Rules: project.Alerts.Rules, Firing: app.Engine.FiringAlerts(project.ID)}
+	if view.Rules == nil {
+		view.Rules = make([]AlertRule, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// UpdateProjectAlertsHandler replaces the caller's project alert rules
+func (app *App) UpdateProjectAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProjectFor(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	var alerts ProjectAlerts
+	if err := decodeRequest(w, r, &alerts, projectAlertsFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if err := alerts.Validate(); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("rules"), err))
+		return
+	}
+
+	if alerts.Rules == nil {
+		alerts.Rules = make([]AlertRule, 0)
+	}
+
+	if err := app.Engine.UpdateProjectAlerts(project.ID, alerts); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(AlertsUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(alerts); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectAlerts(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+	app.Engine.WebSocketManager = NewWebSocketManager(app.Logger)
+
+	received := make(chan string, 8)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		received <- message["text"]
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+	require.NoError(t, app.Engine.UpdateProjectNotifications(project.ID, ProjectNotifications{
+		Channels: []NotificationChannel{{Type: NotificationChannelSlack, Url: receiver.URL}},
+	}))
+
+	request := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/projects/"+project.ID+"/alerts", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	messages := func() []string {
+		t.Helper()
+		var sent []string
+		for {
+			select {
+			case message := <-received:
+				sent = append(sent, message)
+			case <-time.After(200 * time.Millisecond):
+				return sent
+			}
+		}
+	}
+	firing := func() []Alert {
+		t.Helper()
+		w := request(http.MethodGet, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var view ProjectAlertsView
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&view))
+		return view.Firing
+	}
+
+	w := request(http.MethodPatch, `{"rules":[
+		{"name":"failures","metric":"failure_rate","threshold":0.2,"window":"10m","minOrchestrations":2},
+		{"name":"payments down","metric":"service_disconnected","window":"5m","service":"payments"}
+	]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, app.Engine.projects[project.ID].Alerts.Rules, 2)
+
+	payments := &ServiceInfo{ID: "s_payments", Name: "payments", ProjectID: project.ID}
+	shipping := &ServiceInfo{ID: "s_shipping", Name: "shipping", ProjectID: project.ID}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{payments.ID: payments, shipping.ID: shipping}
+	app.Engine.WebSocketManager.UpdateServiceHealth(payments.ID, true)
+
+	now := time.Now().UTC()
+	app.Engine.orchestrationStore["o_failed"] = &Orchestration{ID: "o_failed", ProjectID: project.ID, Status: Failed, Timestamp: now.Add(-time.Minute)}
+	app.Engine.orchestrationStore["o_done"] = &Orchestration{ID: "o_done", ProjectID: project.ID, Status: Completed, Timestamp: now.Add(-2 * time.Minute)}
+	app.Engine.orchestrationStore["o_old"] = &Orchestration{ID: "o_old", ProjectID: project.ID, Status: Failed, Timestamp: now.Add(-time.Hour)}
+
+	t.Run("failure rate", func(t *testing.T) {
+		app.Engine.evaluateAlerts(now)
+		sent := messages()
+		require.Len(t, sent, 1)
+		assert.Contains(t, sent[0], "*Alert triggered* in project")
+		assert.Contains(t, sent[0], "Failure rate: 50% over 10m")
+		require.Len(t, firing(), 1)
+		assert.Equal(t, "failures", firing()[0].Rule)
+
+		app.Engine.evaluateAlerts(now.Add(time.Second))
+		assert.Empty(t, messages(), "a triggered rule is only announced once")
+
+		app.Engine.orchestrationStore["o_failed"].Status = Completed
+		app.Engine.evaluateAlerts(now.Add(2 * time.Second))
+		sent = messages()
+		require.Len(t, sent, 1)
+		assert.Contains(t, sent[0], "*Alert resolved*")
+		assert.Empty(t, firing())
+	})
+
+	t.Run("service disconnected", func(t *testing.T) {
+		app.Engine.WebSocketManager.UpdateServiceHealth(payments.ID, false)
+		app.Engine.evaluateAlerts(now)
+		assert.Empty(t, messages(), "the service hasn't been disconnected for the rule's window yet")
+
+		app.Engine.evaluateAlerts(now.Add(6 * time.Minute))
+		sent := messages()
+		require.Len(t, sent, 1, "only the watched service is alerted on")
+		assert.Contains(t, sent[0], "Service payments (s_payments) disconnected for over 5m")
+		alerts := firing()
+		require.Len(t, alerts, 1)
+		assert.Equal(t, now, alerts[0].Since)
+
+		app.Engine.WebSocketManager.UpdateServiceHealth(payments.ID, true)
+		app.Engine.evaluateAlerts(now.Add(7 * time.Minute))
+		sent = messages()
+		require.Len(t, sent, 1)
+		assert.Contains(t, sent[0], "*Alert resolved*")
+	})
+
+	t.Run("removed rules stop being tracked", func(t *testing.T) {
+		app.Engine.WebSocketManager.UpdateServiceHealth(payments.ID, false)
+		app.Engine.evaluateAlerts(now)
+		app.Engine.evaluateAlerts(now.Add(6 * time.Minute))
+		require.Len(t, messages(), 1)
+
+		require.Equal(t, http.StatusOK, request(http.MethodPatch, `{"rules":[]}`).Code)
+		app.Engine.evaluateAlerts(now.Add(7 * time.Minute))
+		assert.Empty(t, messages())
+		assert.Empty(t, firing())
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		for _, body := range []string{
+			`{"rules":[{"name":"","metric":"failure_rate","window":"10m"}]}`,
+			`{"rules":[{"name":"a","metric":"latency","window":"10m"}]}`,
+			`{"rules":[{"name":"a","metric":"failure_rate","window":"10s"}]}`,
+			`{"rules":[{"name":"a","metric":"failure_rate","window":"10m","threshold":1.5}]}`,
+			`{"rules":[{"name":"a","metric":"service_disconnected","window":"5m","threshold":0.5}]}`,
+			`{"rules":[{"name":"a","metric":"failure_rate","window":"10m"},{"name":"a","metric":"failure_rate","window":"1h"}]}`,
+		} {
+			assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, body).Code, body)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+const (
+	apiKeySaltBytes = 16
+	apiKeyIDPrefix  = "key_"
+)
+
+// HashedAPIKey is the persisted form of a project API key.
+// Only a salted digest is kept, the plaintext key is handed out once on creation.
+type HashedAPIKey struct {
+	// ID is random, it identifies the key in logs, audit events and notifications without revealing anything about it
+	ID string `json:"id"`
+	// LookupID indexes the key in storage, see apiKeyLookupID
+	LookupID  string    `json:"lookupId"`
+	Salt      string    `json:"salt"`
+	Hash      string    `json:"hash"`
+	Primary   bool      `json:"primary"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is optional, keys without it never expire
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	ExpiryNotified bool       `json:"expiryNotified,omitempty"`
+}
+
+// NewHashedAPIKey salts and hashes a plaintext API key for storage, indexing it under the storage's lookup key
+func NewHashedAPIKey(lookupKey []byte, apiKey string, primary bool) (HashedAPIKey, error) {
+	salt := make([]byte, apiKeySaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return HashedAPIKey{}, fmt.Errorf("failed to generate api key salt: %w", err)
+	}
+
+	encodedSalt := hex.EncodeToString(salt)
+	return HashedAPIKey{
+		ID:        newAPIKeyID(),
+		LookupID:  apiKeyLookupID(lookupKey, apiKey),
+		Salt:      encodedSalt,
+		Hash:      saltedAPIKeyHash(encodedSalt, apiKey),
+		Primary:   primary,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Matches reports whether the plaintext API key hashes to this key using a constant-time comparison
+func (k HashedAPIKey) Matches(apiKey string) bool {
+	expected := []byte(k.Hash)
+	actual := []byte(saltedAPIKeyHash(k.Salt, apiKey))
+	return subtle.ConstantTimeCompare(expected, actual) == 1
+}
+
+// Expired reports whether the key can no longer be used
+func (k HashedAPIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// DisplayID is a non-secret identifier for the key suitable for logs and notifications
+func (k HashedAPIKey) DisplayID() string {
+	return k.ID
+}
+
+func newAPIKeyID() string {
+	return apiKeyIDPrefix + short.New()
+}
+
+// apiKeyLookupID derives the storage index for an API key. It's an HMAC under a random key stored in the same
+// database as the indices (meta:api-key-lookup-key), so indices copied out on their own can't be used to check
+// guessed API keys. Anyone holding the whole database holds the lookup key as well.
+func apiKeyLookupID(lookupKey []byte, apiKey string) string {
+	mac := hmac.New(sha256.New, lookupKey)
+	mac.Write([]byte(apiKey))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func saltedAPIKeyHash(salt, apiKey string) string {
+	h := sha256.New()
+	h.Write([]byte(salt))
+	h.Write([]byte(apiKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MatchingAPIKey returns the stored, unexpired key matching the plaintext API key, if any
+func (p *Project) MatchingAPIKey(apiKey string) (HashedAPIKey, bool) {
+	now := time.Now().UTC()
+	for _, key := range p.APIKeyHashes {
+		if !key.Expired(now) && key.Matches(apiKey) {
+			return key, true
+		}
+	}
+	return HashedAPIKey{}, false
+}
+
+// HasAPIKey reports whether the plaintext API key belongs to the project
+func (p *Project) HasAPIKey(apiKey string) bool {
+	_, ok := p.MatchingAPIKey(apiKey)
+	return ok
+}
+
+// hasPlaintextAPIKeys reports whether the project still carries API keys from before hashing was introduced
+func (p *Project) hasPlaintextAPIKeys() bool {
+	return p.APIKey != "" || len(p.AdditionalAPIKeys) > 0
+}
+
+// hashPlaintextAPIKeys moves any plaintext API keys on the project to their hashed form
+func (p *Project) hashPlaintextAPIKeys(lookupKey []byte) error {
+	if p.APIKey != "" && !p.HasAPIKey(p.APIKey) {
+		hashed, err := NewHashedAPIKey(lookupKey, p.APIKey, true)
+		if err != nil {
+			return err
+		}
+		p.APIKeyHashes = append(p.APIKeyHashes, hashed)
+	}
+
+	for _, key := range p.AdditionalAPIKeys {
+		if p.HasAPIKey(key) {
+			continue
+		}
+		hashed, err := NewHashedAPIKey(lookupKey, key, false)
+		if err != nil {
+			return err
+		}
+		p.APIKeyHashes = append(p.APIKeyHashes, hashed)
+	}
+
+	return nil
+}
+
+// withoutPlaintextAPIKeys returns a copy of the project that's safe to persist or keep in memory
+func (p *Project) withoutPlaintextAPIKeys() *Project {
+	out := *p
+	out.APIKey = ""
+	out.AdditionalAPIKeys = nil
+	out.APIKeyHashes = append([]HashedAPIKey(nil), p.APIKeyHashes...)
+	return &out
+}
+
+// markExpiringAPIKeys records the project's keys expiring within the notice window as notified, returning the
+// updated project and the keys to give notice of
+func (p *PlanEngine) markExpiringAPIKeys(projectID string, now time.Time, noticeWindow time.Duration) (*Project, []HashedAPIKey, error) {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	// The project may have changed since it was listed
+	project, exists := p.cachedProject(projectID)
+	if !exists {
+		return nil, nil, nil
+	}
+
+	var expiring []HashedAPIKey
+	for _, key := range project.APIKeyHashes {
+		if key.ExpiresAt == nil || key.ExpiryNotified || key.Expired(now) {
+			continue
+		}
+		if key.ExpiresAt.Sub(now) <= noticeWindow {
+			expiring = append(expiring, key)
+		}
+	}
+	if len(expiring) == 0 {
+		return project, nil, nil
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	for i, key := range updated.APIKeyHashes {
+		for _, e := range expiring {
+			if key.ID == e.ID && key.Hash == e.Hash {
+				updated.APIKeyHashes[i].ExpiryNotified = true
+			}
+		}
+	}
+	if err := p.updateProject(updated); err != nil {
+		return nil, nil, err
+	}
+	return updated, expiring, nil
+}
+
+// SweepExpiringAPIKeys periodically warns projects, through their webhooks, about API keys close to expiry
+func (p *PlanEngine) SweepExpiringAPIKeys(ctx context.Context, interval, noticeWindow time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.notifyExpiringAPIKeys(time.Now().UTC(), noticeWindow)
+		}
+	}
+}
+
+func (p *PlanEngine) notifyExpiringAPIKeys(now time.Time, noticeWindow time.Duration) {
+	for _, project := range p.cachedProjects() {
+		// Mark keys first so a failing webhook doesn't result in repeated notices
+		updated, expiring, err := p.markExpiringAPIKeys(project.ID, now, noticeWindow)
+		if err != nil {
+			p.Logger.Error().Err(err).Str("ProjectID", project.ID).Msg("Failed to record API key expiry notices")
+			continue
+		}
+
+		for _, key := range expiring {
+			p.NotifyProjectWebhooks(updated, ProjectEventAPIKeyExpiring, map[string]any{
+				"keyId":     key.DisplayID(),
+				"primary":   key.Primary,
+				"expiresAt": key.ExpiresAt,
+			})
+		}
+	}
+}
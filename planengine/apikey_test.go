@@ -0,0 +1,205 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashedAPIKey_Matches(t *testing.T) {
+	lookupKey := []byte("lookup-key")
+	hashed, err := NewHashedAPIKey(lookupKey, "sk-orra-v1-abc", true)
+	require.NoError(t, err)
+
+	assert.True(t, hashed.Matches("sk-orra-v1-abc"))
+	assert.False(t, hashed.Matches("sk-orra-v1-abd"))
+	assert.NotContains(t, hashed.Hash, "sk-orra-v1-abc")
+
+	other, err := NewHashedAPIKey(lookupKey, "sk-orra-v1-abc", true)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashed.Hash, other.Hash, "each key should be hashed with its own salt")
+	assert.Equal(t, hashed.LookupID, other.LookupID)
+	assert.NotEqual(t, hashed.ID, other.ID, "key IDs are random")
+
+	digest := sha256.Sum256([]byte("sk-orra-v1-abc"))
+	assert.NotEqual(t, hex.EncodeToString(digest[:]), hashed.LookupID, "lookup IDs are keyed")
+	assert.NotContains(t, hashed.LookupID, strings.TrimPrefix(hashed.DisplayID(), apiKeyIDPrefix))
+
+	rekeyed, err := NewHashedAPIKey([]byte("other-lookup-key"), "sk-orra-v1-abc", true)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashed.LookupID, rekeyed.LookupID)
+}
+
+func TestBadgerProjectStorage_HashedAPIKeys(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	lookupKey, err := storage.APIKeyLookupKey()
+	require.NoError(t, err)
+	project := &Project{ID: "p_hashed", Name: "hashed", APIKey: "sk-orra-v1-primary"}
+	require.NoError(t, project.hashPlaintextAPIKeys(lookupKey))
+	require.NoError(t, storage.StoreProject(project))
+
+	t.Run("plaintext key is never persisted", func(t *testing.T) {
+		err := storage.db.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				assert.False(t, strings.Contains(string(item.Key()), "sk-orra-v1-primary"))
+				err := item.Value(func(val []byte) error {
+					assert.False(t, strings.Contains(string(val), "sk-orra-v1-primary"))
+					return nil
+				})
+				require.NoError(t, err)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("load by primary and additional keys", func(t *testing.T) {
+		loaded, err := storage.LoadProjectByAPIKey("sk-orra-v1-primary")
+		require.NoError(t, err)
+		assert.Equal(t, project.ID, loaded.ID)
+		assert.Empty(t, loaded.APIKey)
+
+		additional, err := NewHashedAPIKey(lookupKey, "sk-orra-v1-additional", false)
+		require.NoError(t, err)
+		require.NoError(t, storage.AddProjectAPIKey(project.ID, additional))
+
+		loaded, err = storage.LoadProjectByAPIKey("sk-orra-v1-additional")
+		require.NoError(t, err)
+		assert.Equal(t, project.ID, loaded.ID)
+	})
+
+	t.Run("unknown key is rejected", func(t *testing.T) {
+		_, err := storage.LoadProjectByAPIKey("sk-orra-v1-unknown")
+		assert.ErrorIs(t, err, ErrProjectAPIKeyNotFound)
+	})
+}
+
+func TestPlanEngine_MigratesPlaintextAPIKeys(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	// Simulate a project persisted before API keys were hashed
+	legacy := map[string]any{
+		"id":                "p_legacy",
+		"name":              "legacy",
+		"apiKey":            "sk-orra-v1-legacy",
+		"additionalAPIKeys": []string{"sk-orra-v1-legacy-extra"},
+	}
+	data, err := json.Marshal(legacy)
+	require.NoError(t, err)
+	require.NoError(t, storage.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte("project:p_legacy"), data); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte("apikey:sk-orra-v1-legacy"), []byte("p_legacy")); err != nil {
+			return err
+		}
+		return txn.Set([]byte("apikey:sk-orra-v1-legacy-extra"), []byte("p_legacy"))
+	}))
+
+	plane := NewPlanEngine()
+	plane.Initialise(context.Background(), storage, storage, storage, storage, nil, nil, nil, &fakePddlValidator{}, nil, storage.logger)
+
+	for _, key := range []string{"sk-orra-v1-legacy", "sk-orra-v1-legacy-extra"} {
+		project, err := plane.GetProjectByApiKey(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, "p_legacy", project.ID)
+
+		err = storage.db.View(func(txn *badger.Txn) error {
+			_, err := txn.Get([]byte(fmt.Sprintf("apikey:%s", key)))
+			return err
+		})
+		assert.ErrorIs(t, err, badger.ErrKeyNotFound, "plaintext index should be removed")
+	}
+
+	stored, err := storage.LoadProject("p_legacy")
+	require.NoError(t, err)
+	assert.Empty(t, stored.APIKey)
+	assert.Empty(t, stored.AdditionalAPIKeys)
+	assert.Len(t, stored.APIKeyHashes, 2)
+}
+
+func TestProject_ExpiredAPIKeysAreRejected(t *testing.T) {
+	lookupKey := []byte("lookup-key")
+	project := &Project{ID: "p_expiry", APIKey: "sk-orra-v1-primary"}
+	require.NoError(t, project.hashPlaintextAPIKeys(lookupKey))
+
+	expired, err := NewHashedAPIKey(lookupKey, "sk-orra-v1-expired", false)
+	require.NoError(t, err)
+	past := time.Now().UTC().Add(-time.Minute)
+	expired.ExpiresAt = &past
+	project.APIKeyHashes = append(project.APIKeyHashes, expired)
+
+	assert.True(t, project.HasAPIKey("sk-orra-v1-primary"))
+	assert.False(t, project.HasAPIKey("sk-orra-v1-expired"))
+}
+
+func TestPlanEngine_NotifiesExpiringAPIKeys(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	var events []ProjectEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	plane := NewPlanEngine()
+	plane.ConfigureWebhookAddresses(WebhookAddresses{AllowPrivate: true})
+	plane.Initialise(context.Background(), storage, storage, storage, storage, nil, nil, nil, &fakePddlValidator{}, nil, storage.logger)
+
+	project := &Project{ID: "p_expiring", APIKey: "sk-orra-v1-primary", Webhooks: []string{server.URL}}
+	require.NoError(t, plane.AddProject(project))
+
+	soon := time.Now().UTC().Add(time.Hour)
+	later := time.Now().UTC().Add(30 * 24 * time.Hour)
+	require.NoError(t, plane.AddProjectAPIKey(project.ID, "sk-orra-v1-soon", &soon))
+	require.NoError(t, plane.AddProjectAPIKey(project.ID, "sk-orra-v1-later", &later))
+
+	plane.notifyExpiringAPIKeys(time.Now().UTC(), 24*time.Hour)
+	plane.notifyExpiringAPIKeys(time.Now().UTC(), 24*time.Hour)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 1, "each key is only notified once")
+	assert.Equal(t, ProjectEventAPIKeyExpiring, events[0].Event)
+	assert.Equal(t, project.ID, events[0].ProjectID)
+
+	stored, err := storage.LoadProject(project.ID)
+	require.NoError(t, err)
+	notified := 0
+	for _, key := range stored.APIKeyHashes {
+		if key.ExpiryNotified {
+			notified++
+		}
+	}
+	assert.Equal(t, 1, notified)
+}
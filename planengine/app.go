@@ -11,10 +11,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,16 +25,27 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/olahol/melody"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 )
 
 type App struct {
-	Engine     *PlanEngine
-	Router     *mux.Router
-	Db         *BadgerDB
-	Cfg        Config
-	RootCtx    context.Context
-	RootCancel context.CancelFunc
-	Logger     zerolog.Logger
+	Engine             *PlanEngine
+	Router             *mux.Router
+	Db                 *BadgerDB
+	Cfg                Config
+	Limiter            *RateLimiter
+	Audit              *AuditLog
+	CA                 *CertificateAuthority
+	OIDC               *OIDCVerifier
+	Admin              *AdminCredential
+	RegistrationTokens *RegistrationTokens
+	Submissions        *Submissions
+	Scheduler          *Scheduler
+	Templates          TemplateStorage
+	LLM                Pinger
+	RootCtx            context.Context
+	RootCancel         context.CancelFunc
+	Logger             zerolog.Logger
 }
 
 func NewApp(cfg Config, args []string) (*App, error) {
@@ -41,42 +55,154 @@ func NewApp(cfg Config, args []string) (*App, error) {
 	}
 
 	return &App{
-		Logger: lgr,
-		Cfg:    cfg,
+		Logger:  lgr,
+		Cfg:     cfg,
+		Limiter: NewRateLimiter(cfg.RateLimit),
 	}, nil
 }
 
 func (app *App) configureRoutes() *App {
+	// Compression wraps everything else, so request IDs are added to error bodies before they're compressed
+	app.Router.Use(app.CompressionMiddleware)
+	app.Router.Use(app.RequestIDMiddleware)
 	app.Router.Use(app.VersionHeaderMiddleware)
+	app.Router.Use(app.MetricsMiddleware)
 
 	app.Router.HandleFunc("/health", app.healthHandler).Methods(http.MethodGet)
-	app.Router.HandleFunc("/register/project", app.RegisterProject).Methods(http.MethodPost)
-	app.Router.HandleFunc("/apikeys", app.APIKeyMiddleware(app.CreateAdditionalApiKey)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/webhooks", app.APIKeyMiddleware(app.AddWebhook)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/register/service", app.APIKeyMiddleware(app.RegisterService)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/orchestrations", app.APIKeyMiddleware(app.OrchestrationsHandler)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/orchestrations", app.APIKeyMiddleware(app.ListOrchestrationsHandler)).Methods(http.MethodGet)
-	app.Router.HandleFunc("/orchestrations/inspections/{id}", app.APIKeyMiddleware(app.OrchestrationInspectionHandler)).Methods(http.MethodGet)
-	app.Router.HandleFunc("/register/agent", app.APIKeyMiddleware(app.RegisterAgent)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/ws", app.HandleWebSocket)
-	app.Router.HandleFunc("/groundings", app.APIKeyMiddleware(app.ApplyGrounding)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/groundings", app.APIKeyMiddleware(app.ListGrounding)).Methods(http.MethodGet)
-	app.Router.HandleFunc("/groundings/{name}", app.APIKeyMiddleware(app.RemoveGrounding)).Methods(http.MethodDelete)
-	app.Router.HandleFunc("/groundings", app.APIKeyMiddleware(app.RemoveAllGrounding)).Methods(http.MethodDelete)
+	app.Router.HandleFunc("/healthz", app.LivenessHandler).Methods(http.MethodGet)
+	app.Router.HandleFunc("/readyz", app.ReadinessHandler).Methods(http.MethodGet)
+	app.Router.HandleFunc("/metrics", app.MetricsHandler).Methods(http.MethodGet)
+	app.Router.HandleFunc(openAPIPath, app.OpenAPIHandler).Methods(http.MethodGet)
+	app.Router.HandleFunc(openAPIDocsPath, app.OpenAPIDocsHandler).Methods(http.MethodGet)
+	if app.Cfg.Docs.SwaggerUIDir != "" {
+		app.Router.PathPrefix(swaggerUIPath).Handler(app.SwaggerUIHandler()).Methods(http.MethodGet)
+	}
+	if !app.Cfg.Dashboard.Disabled {
+		app.Router.Handle("/dashboard", http.RedirectHandler(dashboardPath, http.StatusMovedPermanently)).Methods(http.MethodGet)
+		app.Router.PathPrefix(dashboardPath).Handler(app.DashboardHandler()).Methods(http.MethodGet)
+	}
 
+	versioned := app.Router.PathPrefix(APIVersionPrefix).Subrouter()
+	versioned.Use(app.APIVersionMiddleware(false))
+	app.configureAPIRoutes(versioned)
+
+	// Legacy paths stay as aliases of the current version, so SDKs predating versioning keep working
+	legacy := app.Router.NewRoute().Subrouter()
+	legacy.Use(app.APIVersionMiddleware(true))
+	app.configureAPIRoutes(legacy)
 	return app
 }
 
+// configureAPIRoutes registers the versioned API on the router
+func (app *App) configureAPIRoutes(r *mux.Router) {
+	r.HandleFunc("/register/project", app.AuditMiddleware(AuditActionProjectRegister, app.RegisterProject)).Methods(http.MethodPost)
+	r.HandleFunc("/apikeys", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionAPIKeyCreate, app.CreateAdditionalApiKey))).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionWebhookAdd, app.AddWebhook))).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks", app.withRole(RoleViewer, app.ListWebhooks)).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/dead-letters", app.withRole(RoleViewer, app.ListWebhookDeadLetters)).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/dead-letters/{id}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionWebhookDeadLetterPurge, app.PurgeWebhookDeadLetter))).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks/dead-letters/{id}/redrive", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionWebhookRedrive, app.RedriveWebhookDeadLetter))).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/{id}", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionWebhookUpdate, app.UpdateWebhook))).Methods(http.MethodPatch)
+	r.HandleFunc("/webhooks/{id}", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionWebhookRemove, app.DeleteWebhook))).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks/{id}/deliveries", app.withRole(RoleViewer, app.ListWebhookDeliveries)).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/redeliver", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionWebhookRedeliver, app.RedeliverWebhookDelivery))).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/{id}/test", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionWebhookTest, app.TestWebhook))).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/{id}/rotate-secret", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionWebhookSecretRotate, app.RotateWebhookSecret))).Methods(http.MethodPost)
+	r.HandleFunc("/register/service", app.withRegistrationAccess(RoleDeveloper, app.AuditMiddleware(AuditActionServiceRegister, app.RegisterService))).Methods(http.MethodPost, http.MethodPut)
+	r.HandleFunc("/orchestrations", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationRun, app.OrchestrationRateLimitMiddleware(app.OrchestrationsHandler)))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations", app.withRole(RoleViewer, app.ListOrchestrationsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/batch", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationBatch, app.BatchOrchestrationsHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/status", app.withRole(RoleViewer, app.OrchestrationStatusHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/search", app.withRole(RoleViewer, app.SearchOrchestrationsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/export", app.withRole(RoleViewer, app.ExportOrchestrationsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/{id}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationDelete, app.DeleteOrchestrationHandler))).Methods(http.MethodDelete)
+	r.HandleFunc("/orchestrations/{id}/cancel", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationCancel, app.CancelOrchestrationHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/{id}/pause", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationPause, app.PauseOrchestrationHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/{id}/resume", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationResume, app.ResumeOrchestrationHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/{id}/retry", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationRetry, app.RetryOrchestrationHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/{id}/clone", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionOrchestrationClone, app.CloneOrchestrationHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/orchestrations/{id}/approvals/{stepId}", app.AuditMiddleware(AuditActionOrchestrationApprove, app.ApproveOrchestrationStepHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/dead-letters", app.withRole(RoleViewer, app.ListDeadLetters)).Methods(http.MethodGet)
+	r.HandleFunc("/dead-letters", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionDeadLetterPurgeAll, app.PurgeDeadLetters))).Methods(http.MethodDelete)
+	r.HandleFunc("/dead-letters/{id}", app.withRole(RoleViewer, app.InspectDeadLetter)).Methods(http.MethodGet)
+	r.HandleFunc("/dead-letters/{id}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionDeadLetterPurge, app.PurgeDeadLetter))).Methods(http.MethodDelete)
+	r.HandleFunc("/dead-letters/{id}/redrive", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionDeadLetterRedrive, app.RedriveDeadLetter))).Methods(http.MethodPost)
+	r.HandleFunc("/templates", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionTemplateCreate, app.CreateTemplate))).Methods(http.MethodPost)
+	r.HandleFunc("/templates", app.withRole(RoleViewer, app.ListTemplates)).Methods(http.MethodGet)
+	r.HandleFunc("/templates/{name}", app.withRole(RoleViewer, app.GetTemplate)).Methods(http.MethodGet)
+	r.HandleFunc("/templates/{name}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionTemplateUpdate, app.UpdateTemplate))).Methods(http.MethodPut)
+	r.HandleFunc("/templates/{name}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionTemplateDelete, app.DeleteTemplate))).Methods(http.MethodDelete)
+	r.HandleFunc("/schedules", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionScheduleCreate, app.CreateSchedule))).Methods(http.MethodPost)
+	r.HandleFunc("/schedules", app.withRole(RoleViewer, app.ListSchedules)).Methods(http.MethodGet)
+	r.HandleFunc("/schedules/{id}/pause", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionSchedulePause, app.PauseSchedule))).Methods(http.MethodPost)
+	r.HandleFunc("/schedules/{id}/resume", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionScheduleResume, app.ResumeSchedule))).Methods(http.MethodPost)
+	r.HandleFunc("/schedules/{id}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionScheduleDelete, app.DeleteSchedule))).Methods(http.MethodDelete)
+	r.HandleFunc("/orchestrations/inspections/{id}", app.withRole(RoleViewer, app.OrchestrationInspectionHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/{id}/timeline", app.withRole(RoleViewer, app.OrchestrationTimelineHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/{id}/logs", app.withRole(RoleViewer, app.OrchestrationLogsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/{id}/graph", app.withRole(RoleViewer, app.OrchestrationGraphHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/orchestrations/{id}/events", app.withRole(RoleViewer, app.OrchestrationEventsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/register/agent", app.withRegistrationAccess(RoleDeveloper, app.AuditMiddleware(AuditActionAgentRegister, app.RegisterAgent))).Methods(http.MethodPost, http.MethodPut)
+	r.HandleFunc("/ws", app.HandleWebSocket)
+	r.HandleFunc("/services", app.withRole(RoleViewer, app.ListServicesHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/health", app.withRole(RoleViewer, app.ServiceHealthHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/discover", app.withRole(RoleViewer, app.DiscoverServicesHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id}", app.withRole(RoleViewer, app.GetServiceHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionServiceDeregister, app.DeregisterServiceHandler))).Methods(http.MethodDelete)
+	r.HandleFunc("/services/{id}/versions", app.withRole(RoleViewer, app.ListServiceVersionsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id}/versions/{version}", app.withRole(RoleViewer, app.GetServiceVersionHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id}/callback", app.HandleServiceCallback).Methods(http.MethodPost)
+	r.HandleFunc("/services/{id}/tasks", app.PollServiceTasks).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id}/results", app.PostServiceResults).Methods(http.MethodPost)
+	r.HandleFunc("/services/{id}/queues", app.withRole(RoleViewer, app.ServiceQueuesHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id}/drain", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionServiceDrain, app.DrainServiceHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/auth/ws-token", app.withRole(RoleDeveloper, app.IssueWebSocketToken)).Methods(http.MethodPost)
+	r.HandleFunc("/certificates", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionCertificateIssue, app.IssueClientCertificate))).Methods(http.MethodPost)
+	r.HandleFunc("/groundings", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionGroundingApply, app.ApplyGrounding))).Methods(http.MethodPost)
+	r.HandleFunc("/groundings", app.withRole(RoleViewer, app.ListGrounding)).Methods(http.MethodGet)
+	r.HandleFunc("/groundings/{name}", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionGroundingRemove, app.RemoveGrounding))).Methods(http.MethodDelete)
+	r.HandleFunc("/groundings", app.withRole(RoleDeveloper, app.AuditMiddleware(AuditActionGroundingPurge, app.RemoveAllGrounding))).Methods(http.MethodDelete)
+	r.HandleFunc("/audit", app.withRole(RoleViewer, app.ListAuditEvents)).Methods(http.MethodGet)
+	r.HandleFunc("/projects", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionProjectUpdate, app.UpdateProjectHandler))).Methods(http.MethodPatch)
+	r.HandleFunc("/projects", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionProjectDelete, app.DeleteProjectHandler))).Methods(http.MethodDelete)
+	r.HandleFunc("/projects/members", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionMemberAdd, app.AddProjectMember))).Methods(http.MethodPost)
+	r.HandleFunc("/projects/members", app.withRole(RoleViewer, app.ListProjectMembers)).Methods(http.MethodGet)
+	r.HandleFunc("/projects/members/{member}", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionMemberRemove, app.RemoveProjectMember))).Methods(http.MethodDelete)
+	r.HandleFunc("/projects/{id}/security", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionSecurityUpdate, app.UpdateProjectSecurity))).Methods(http.MethodPatch)
+	r.HandleFunc("/projects/{id}/limits", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionLimitsUpdate, app.UpdateProjectLimits))).Methods(http.MethodPatch)
+	r.HandleFunc("/projects/{id}/notifications", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionNotificationsUpdate, app.UpdateProjectNotifications))).Methods(http.MethodPatch)
+	r.HandleFunc("/projects/{id}/alerts", app.withRole(RoleViewer, app.ProjectAlertsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/projects/{id}/alerts", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionAlertsUpdate, app.UpdateProjectAlertsHandler))).Methods(http.MethodPatch)
+	r.HandleFunc("/projects/{id}/usage", app.withRole(RoleViewer, app.ProjectUsageHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/registration-tokens", app.withRole(RoleOwner, app.AuditMiddleware(AuditActionRegistrationTokenCreate, app.CreateRegistrationToken))).Methods(http.MethodPost)
+	r.HandleFunc("/users/me", app.APIKeyMiddleware(app.CurrentUser)).Methods(http.MethodGet)
+	r.HandleFunc("/overview", app.withRole(RoleViewer, app.ProjectOverviewHandler)).Methods(http.MethodGet)
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/projects", app.AdminMiddleware(app.AdminListProjects)).Methods(http.MethodGet)
+	admin.HandleFunc("/projects/{id}", app.AdminMiddleware(app.AdminInspectProject)).Methods(http.MethodGet)
+	admin.HandleFunc("/orchestrations/{id}/fail", app.AdminMiddleware(app.AuditMiddleware(AuditActionOrchestrationForceFail, app.AdminFailOrchestration))).Methods(http.MethodPost)
+	admin.HandleFunc("/debug/stats", app.AdminMiddleware(app.AdminStatsHandler)).Methods(http.MethodGet)
+	admin.HandleFunc("/debug/goroutines", app.AdminMiddleware(app.AdminGoroutinesHandler)).Methods(http.MethodGet)
+}
+
 func (app *App) configureWebSocket() {
+	app.Engine.WebSocketManager.onStaleConnection = app.Engine.releaseServiceExecutions
+	app.Engine.WebSocketManager.onReroute = app.Engine.recordTaskRerouted
+	app.Engine.WebSocketManager.onLease = app.Engine.recordTaskLease
+	app.Engine.WebSocketManager.onDisconnect = app.Engine.notifyServiceDisconnected
+	app.Engine.WebSocketManager.onTaskLogs = app.Engine.recordTaskLogs
+	app.Engine.Metrics.websocketConnected = app.Engine.WebSocketManager.connectionCount
+
 	app.Engine.WebSocketManager.melody.HandleConnect(func(s *melody.Session) {
-		apiKey := s.Request.URL.Query().Get("apiKey")
-		project, err := app.Engine.GetProjectByApiKey(apiKey)
-		if err != nil {
-			app.Logger.Error().Err(err).Msg("Invalid API key for WebSocket connection")
+		// Credentials were verified during the upgrade in HandleWebSocket
+		projectID, ok := s.Get("projectID")
+		if !ok {
+			app.Logger.Error().Msg("projectID missing from connected session")
 			return
 		}
 		svcID := s.Request.URL.Query().Get("serviceId")
-		svcName, err := app.Engine.GetServiceName(project.ID, svcID)
+		svcName, err := app.Engine.GetServiceName(projectID.(string), svcID)
 		if err != nil {
 			app.Logger.Error().Err(err).Msg("Unknown service for WebSocket connection")
 			return
@@ -90,7 +216,7 @@ func (app *App) configureWebSocket() {
 			app.Logger.Error().Msg("serviceID missing from disconnected session")
 			return
 		}
-		app.Engine.WebSocketManager.HandleDisconnection(serviceID.(string))
+		app.Engine.WebSocketManager.HandleDisconnection(serviceID.(string), s)
 	})
 
 	app.Engine.WebSocketManager.melody.HandleMessage(func(s *melody.Session, msg []byte) {
@@ -98,6 +224,10 @@ func (app *App) configureWebSocket() {
 			return app.Engine.GetServiceByID(serviceID)
 		})
 	})
+
+	app.Engine.WebSocketManager.melody.HandleMessageBinary(func(s *melody.Session, msg []byte) {
+		app.Engine.WebSocketManager.HandleBinaryMessage(s, msg, app.Engine.GetServiceByID)
+	})
 }
 
 func (app *App) Run() {
@@ -114,10 +244,60 @@ func (app *App) Run() {
 		Handler:      app.Router,
 	}
 
+	tlsEnabled := app.Cfg.TLS.CertFile != ""
+	if tlsEnabled {
+		tlsConfig, err := NewServerTLSConfig(app.Cfg.TLS, app.CA)
+		if err != nil {
+			app.Logger.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	// Services may also connect over gRPC, on its own port when one is configured
+	var grpcSrv *grpc.Server
+	if app.Cfg.GRPCPort != 0 {
+		grpcAddr := fmt.Sprintf(":%d", app.Cfg.GRPCPort)
+		listener, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			app.Logger.Fatal().Err(err).Msgf("Cannot listen for gRPC connections on %s", grpcAddr)
+		}
+		grpcSrv = app.NewGRPCServer(srv.TLSConfig)
+		go func() {
+			app.Logger.Info().Bool("TLS", tlsEnabled).Msgf("Starting plan engine gRPC transport on %s", grpcAddr)
+			if err := grpcSrv.Serve(listener); err != nil {
+				app.Logger.Info().Msg(err.Error())
+			}
+		}()
+	}
+
+	// Runtime profiles are served on their own listener, localhost only unless configured otherwise
+	var profilingSrv *http.Server
+	if !app.Cfg.Profiling.Disabled {
+		profilingSrv = &http.Server{
+			Addr:         app.Cfg.Profiling.Addr,
+			WriteTimeout: time.Second * 180,
+			ReadTimeout:  time.Second * 180,
+			IdleTimeout:  time.Second * 180,
+			Handler:      app.ProfilingRouter(),
+		}
+		go func() {
+			app.Logger.Info().Msgf("Starting plan engine profiling on %s", profilingSrv.Addr)
+			if err := profilingSrv.ListenAndServe(); err != nil {
+				app.Logger.Info().Msg(err.Error())
+			}
+		}()
+	}
+
 	// Set up our server in s goroutine so that it doesn't block.
 	go func() {
-		app.Logger.Info().Msgf("Starting plan engine on %s", addr)
-		if err := srv.ListenAndServe(); err != nil {
+		app.Logger.Info().Bool("TLS", tlsEnabled).Msgf("Starting plan engine on %s", addr)
+		var err error
+		if tlsEnabled {
+			err = srv.ListenAndServeTLS(app.Cfg.TLS.CertFile, app.Cfg.TLS.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			app.Logger.Info().Msg(err.Error())
 		}
 	}()
@@ -137,6 +317,14 @@ func (app *App) Run() {
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
 
+	if grpcSrv != nil {
+		grpcSrv.Stop()
+	}
+	if profilingSrv != nil {
+		if err := profilingSrv.Shutdown(ctx); err != nil {
+			app.Logger.Error().Err(err).Msg("Error shutting down profiling server")
+		}
+	}
 	app.gracefulShutdown(srv, ctx)
 }
 
@@ -148,6 +336,9 @@ func (app *App) gracefulShutdown(srv *http.Server, ctx context.Context) {
 	}
 	app.Logger.Info().Msg("Plan Engine shutting down")
 
+	// Notifications still being sent, and webhook retries cut short, are finished before the DB closes
+	app.Engine.notifying.Wait()
+
 	if err := app.Db.Close(); err != nil {
 		app.Logger.Error().Err(err).Msg("DB shutdown error")
 	}
@@ -161,56 +352,120 @@ func (app *App) gracefulShutdown(srv *http.Server, ctx context.Context) {
 
 func (app *App) RegisterProject(w http.ResponseWriter, r *http.Request) {
 	var project Project
-	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
+	if err := decodeRequest(w, r, &project, projectRegistrationFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if err := validateProjectRegistration(&project); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
 		return
 	}
 
 	project.ID = app.Engine.GenerateProjectKey()
 	project.APIKey = app.Engine.GenerateAPIKey()
+	project.AdditionalAPIKeys = nil
+	project.APIKeyHashes = nil
+	project.Members = nil
+	project.CreatedAt = time.Now().UTC()
+
+	// Users signed in with OIDC become the project's first owner
+	if user := app.optionalUser(r); user != nil {
+		project.Members = []ProjectMember{{
+			Subject: user.Subject,
+			Email:   user.Email,
+			Role:    RoleOwner,
+			AddedAt: project.CreatedAt,
+		}}
+	}
 
 	if err := app.Engine.AddProject(&project); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(ProjectRegistrationFailedErrCode), err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectRegistrationFailedErrCode), err))
 		return
 	}
+	setAuditProjectID(r, project.ID)
 
+	// The plaintext API key is only ever returned here
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(project); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":        project.ID,
+		"name":      project.Name,
+		"apiKey":    project.APIKey,
+		"webhooks":  project.Webhooks,
+		"createdAt": project.CreatedAt,
+	}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 }
 
+// ServiceRegistrationResponse is a registered service's stable ID and current version. Created tells first
+// registrations apart from re-registrations updating the service.
+type ServiceRegistrationResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Status     Status `json:"status"`
+	Revertible bool   `json:"revertible"`
+	Version    int64  `json:"version"`
+	Created    bool   `json:"created"`
+	// EndpointSecret signs the callbacks posted to a service registered with an endpoint
+	EndpointSecret string `json:"endpointSecret,omitempty"`
+}
+
 func (app *App) RegisterServiceOrAgent(w http.ResponseWriter, r *http.Request, serviceType ServiceType) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
 	var service ServiceInfo
-	if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
+	if err := decodeRequest(w, r, &service, serviceRegistrationFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if err := validateServiceRegistration(&service); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	redeem, err := app.authoriseRegistration(r, project, service.Name)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
 		return
 	}
 
 	service.ProjectID = project.ID
 	service.Type = serviceType
+	service.Capabilities = normalizeCapabilities(service.Capabilities)
 
-	if err := app.Engine.RegisterOrUpdateService(&service); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+	created, err := app.Engine.RegisterOrUpdateService(&service)
+	if redeemErr := redeem(err == nil); redeemErr != nil && err == nil {
+		httpErrorResponse(w, app.requestLogger(r), redeemErr)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, ErrServiceNameTaken) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Exist, errs.Code(ServiceNameTakenErrCode), errs.Parameter("name"), err))
+			return
+		}
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(map[string]any{
-		"id":         service.ID,
-		"name":       service.Name,
-		"status":     Registered,
-		"revertible": service.Revertible,
-		"version":    service.Version,
+	// PUT registrations say whether they created the service in their status, as well as in the body
+	w.Header().Set("Content-Type", "application/json")
+	if created && r.Method == http.MethodPut {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(ServiceRegistrationResponse{
+		ID:             service.ID,
+		Name:           service.Name,
+		Status:         Registered,
+		Revertible:     service.Revertible,
+		Version:        service.Version,
+		Created:        created,
+		EndpointSecret: service.EndpointSecret,
 	}); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 }
@@ -224,20 +479,71 @@ func (app *App) RegisterAgent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *App) OrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	orchestration, err := app.decodeOrchestrationSubmission(w, r, project.ID)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if err := validateOrchestrationRequest(orchestration); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
 		return
 	}
 
-	var orchestration Orchestration
-	if err := json.NewDecoder(r.Body).Decode(&orchestration); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
+	if orchestration.DryRun {
+		app.dryRunOrchestration(w, project.ID, orchestration)
 		return
 	}
 
-	if err := app.Engine.PrepareOrchestration(app.RootCtx, project.ID, &orchestration, app.Engine.GetGroundingSpecs(project.ID)); err != nil {
+	// Resubmitted requests get the orchestration created the first time round
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	fingerprint, replayed, ok := app.claimSubmission(w, r, project.ID, idempotencyKey, orchestration)
+	if !ok {
+		return
+	}
+	if replayed != nil {
+		w.Header().Set(IdempotentReplayHeader, "true")
+		app.writeAcceptedOrchestration(w, replayed)
+		return
+	}
+	if fingerprint != "" {
+		defer app.Submissions.Release(project.ID, idempotencyKey)
+	}
+
+	if err := app.submitOrchestration(project.ID, orchestration); err != nil {
+		var backpressure *BackpressureError
+		if errors.As(err, &backpressure) {
+			tooManyRequestsResponse(w, backpressure.RetryAfter, ExecutionBacklogFullErrCode, backpressure.Error())
+			return
+		}
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	app.completeSubmission(r, project.ID, idempotencyKey, fingerprint, orchestration)
+	app.writeAcceptedOrchestration(w, orchestration)
+}
+
+// submitOrchestration defers a validated orchestration request until its runAt time,
+// or prepares and dispatches it straight away. Work the plan engine is too backed up to schedule is turned
+// away with a BackpressureError.
+func (app *App) submitOrchestration(projectID string, orchestration *Orchestration) error {
+	if orchestration.RunAt != nil && orchestration.RunAt.After(time.Now()) {
+		if err := app.Engine.DeferOrchestration(app.RootCtx, projectID, orchestration); err != nil {
+			return errs.E(errs.InvalidRequest, errs.Code(ActionCannotExecuteErrCode), err)
+		}
+		return nil
+	}
+
+	if err := app.checkQueueBackpressure(); err != nil {
+		return err
+	}
+	if err := app.Engine.PrepareOrchestration(app.RootCtx, projectID, orchestration, app.Engine.GetGroundingSpecs(projectID)); err != nil {
 		app.Logger.
 			Error().
 			Err(err).
@@ -247,27 +553,34 @@ func (app *App) OrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
 			Msgf("Action cannot be executed")
 
 		if orchestration.Status == NotActionable {
-			errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(ActionNotActionableErrCode), err))
-		} else {
-			errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(ActionCannotExecuteErrCode), err))
+			return errs.E(errs.InvalidRequest, errs.Code(ActionNotActionableErrCode), err)
 		}
-		return
+		return errs.E(errs.Unanticipated, errs.Code(ActionCannotExecuteErrCode), err)
+	}
+
+	if err := app.checkServiceBackpressure(orchestration); err != nil {
+		app.Engine.prepForError(orchestration, err, Failed)
+		return err
 	}
 
 	app.Logger.Debug().Msgf("About to execute orchestration %s", orchestration.ID)
-	go app.Engine.ExecuteOrchestration(app.RootCtx, &orchestration)
+	app.Engine.DispatchOrchestration(app.RootCtx, orchestration)
+	return nil
+}
+
+func (app *App) writeAcceptedOrchestration(w http.ResponseWriter, orchestration *Orchestration) {
 	w.WriteHeader(http.StatusAccepted)
 
 	data, err := json.Marshal(orchestration)
 	if err != nil {
 		app.Logger.Error().Err(err).Interface("orchestration", orchestration).Msg("")
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(data); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
 		return
 	}
 }
@@ -275,136 +588,321 @@ func (app *App) OrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
 func (app *App) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	serviceID := r.URL.Query().Get("serviceId")
 
-	// Perform API key authentication
-	apiKey := r.URL.Query().Get("apiKey")
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.authorizeServiceConnection(r, serviceID)
 	if err != nil {
-		app.Logger.Error().Err(err).Msg("Invalid API key for WebSocket connection")
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unauthorized, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+		return
+	}
+
+	if err := validateEncoding(r.URL.Query().Get(WSEncodingQueryParam)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter(WSEncodingQueryParam), err))
+		return
+	}
+	if err := validateMaxMessageBytes(r.URL.Query().Get(WSMaxMessageQueryParam)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter(WSMaxMessageQueryParam), err))
+		return
+	}
+	if err := validateProtocolVersion(r.URL.Query().Get(WSProtocolVersionQueryParam)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter(WSProtocolVersionQueryParam), err))
+		return
+	}
+
+	keys := map[string]any{"projectID": project.ID}
+	if err := app.Engine.WebSocketManager.melody.HandleRequestWithKeys(w, r, keys); err != nil {
+		logger := app.requestLogger(r)
+		logger.Error().Str("serviceID", serviceID).Msg("Failed to handle request using the WebSocket")
+		httpErrorResponse(w, logger, errs.E(errs.Unanticipated, err))
 		return
 	}
+}
+
+// authorizeServiceConnection checks a service's credentials, network access and client certificate
+// before it connects, over either the WebSocket or gRPC.
+func (app *App) authorizeServiceConnection(r *http.Request, serviceID string) (*Project, error) {
+	logger := app.requestLogger(r)
+	project, err := app.authenticateWebSocket(r, serviceID)
+	if err != nil {
+		logger.Error().Err(err).Str("serviceID", serviceID).Msg("Invalid credentials for service connection")
+		return nil, err
+	}
 
 	if !app.Engine.ServiceBelongsToProject(serviceID, project.ID) {
-		app.Logger.Error().Str("serviceID", serviceID).Msg("Service not found for the given project")
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unauthorized, err))
+		logger.Error().Str("serviceID", serviceID).Msg("Service not found for the given project")
+		return nil, fmt.Errorf("unknown service for project")
+	}
+
+	if err := app.enforceIPAllowlist(r, project); err != nil {
+		logger.Warn().Err(err).Str("serviceID", serviceID).Str("RemoteAddr", r.RemoteAddr).Msg("Service connection rejected by IP allowlist")
+		return nil, err
+	}
+
+	if err := verifyClientCertificate(r, project.ID, serviceID); err != nil {
+		logger.Error().Err(err).Str("serviceID", serviceID).Msg("Client certificate rejected for service connection")
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// authenticateWebSocket resolves the project for a WebSocket upgrade using either a
+// short-lived token or an API key. API keys in the query string are only kept for older SDKs.
+func (app *App) authenticateWebSocket(r *http.Request, serviceID string) (*Project, error) {
+	credential, fromQuery := webSocketCredential(r)
+	if credential == "" {
+		return nil, fmt.Errorf("missing WebSocket credentials")
+	}
+
+	if !strings.HasPrefix(credential, WSTokenPrefix) {
+		if fromQuery {
+			logger := app.requestLogger(r)
+			logger.Warn().
+				Str("serviceID", serviceID).
+				Msg("WebSocket connection authenticated using apiKey query param, use a token from /auth/ws-token instead")
+		}
+		return app.Engine.GetProjectByApiKey(credential)
+	}
+
+	token, err := app.Engine.WebSocketManager.tokens.Consume(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ServiceID != serviceID {
+		return nil, fmt.Errorf("websocket token was not issued for service %s", serviceID)
+	}
+
+	return app.Engine.GetProjectByID(token.ProjectID)
+}
+
+// wsTokenRequest names the service a WebSocket token is issued for
+type wsTokenRequest struct {
+	ServiceID string `json:"serviceId"`
+}
+
+// IssueWebSocketToken exchanges a project API key for a short-lived WebSocket connection token
+func (app *App) IssueWebSocketToken(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
-	if err := app.Engine.WebSocketManager.melody.HandleRequest(w, r); err != nil {
-		app.Logger.Error().Str("serviceID", serviceID).Msg("Failed to handle request using the WebSocket")
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+	var request wsTokenRequest
+	if err := decodeRequest(w, r, &request, wsTokenFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if !app.Engine.ServiceBelongsToProject(request.ServiceID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("serviceId"), "unknown service for project"))
+		return
+	}
+
+	token, err := app.Engine.WebSocketManager.tokens.Issue(project.ID, request.ServiceID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(WSTokenIssueFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(token); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 }
 
+// apiKeyRequest is the optional body of an API key creation
+type apiKeyRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
 func (app *App) CreateAdditionalApiKey(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	// The request body is optional, it's only needed to set an expiry
+	var request apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 
+	if request.ExpiresAt != nil {
+		expiresAt := request.ExpiresAt.UTC()
+		if !expiresAt.After(time.Now().UTC()) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("expiresAt"), "expiresAt must be in the future"))
+			return
+		}
+		request.ExpiresAt = &expiresAt
+	}
+
 	newApiKey := app.Engine.GenerateAPIKey()
-	if err := app.Engine.AddProjectAPIKey(project.ID, newApiKey); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(ProjectAPIKeyAdditionFailedErrCode), err))
+	if err := app.Engine.AddProjectAPIKey(project.ID, newApiKey, request.ExpiresAt); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectAPIKeyAdditionFailedErrCode), err))
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]any{
 		"apiKey": newApiKey,
-	}); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+	}
+	if request.ExpiresAt != nil {
+		response["expiresAt"] = request.ExpiresAt
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 }
 
+// webhookRequest adds a project webhook
+type webhookRequest struct {
+	Url string `json:"url"`
+	ProjectWebhookOptions
+}
+
 func (app *App) AddWebhook(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
-	var webhook struct {
-		Url string `json:"url"`
-	}
+	var webhook webhookRequest
 	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 
-	if _, err := url.ParseRequestURI(webhook.Url); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Validation, err))
+	if err := app.Engine.validateWebhookURL(webhook.Url); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
 		return
 	}
 
-	if err := app.Engine.AddProjectWebhook(project.ID, webhook.Url); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(ProjectWebhookAdditionFailedErrCode), err))
+	if err := validateWebhookEvents(webhook.Events); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
 		return
 	}
 
-	project.Webhooks = append(project.Webhooks, webhook.Url)
+	if err := validateWebhookFormat(webhook.Format); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if err := validateWebhookHeaders(webhook.Headers); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if err := validateWebhookTimeout(webhook.Timeout); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	secret, err := app.Engine.AddProjectWebhook(project.ID, webhook.Url, webhook.ProjectWebhookOptions)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ProjectWebhookAdditionFailedErrCode), err))
+		return
+	}
 
-	// Return the new key
+	// Return the new webhook
+	if updated, err := app.Engine.GetProjectByID(project.ID); err == nil {
+		project = updated
+	}
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(webhook); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+	added := project.webhook(webhook.Url)
+	added.Secret = secret
+	if err := json.NewEncoder(w).Encode(added); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 }
 
 func (app *App) ListOrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	query, err := parseOrchestrationQuery(r.URL.Query())
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, err))
 		return
 	}
 
-	orchestrationList := app.Engine.GetOrchestrationList(project.ID)
+	orchestrationList := app.Engine.GetOrchestrationList(project.ID, query)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(orchestrationList); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Internal, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
 		return
 	}
 }
 
 func (app *App) OrchestrationInspectionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
 	orchestrationID := vars["id"]
 
 	if !app.Engine.OrchestrationBelongsToProject(orchestrationID, project.ID) {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
 		return
 	}
 
-	inspection, err := app.Engine.InspectOrchestration(orchestrationID)
+	fields, err := parseFieldset(r.URL.Query().Get("fields"), inspectionFields)
 	if err != nil {
-		app.Logger.
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("fields"), err))
+		return
+	}
+
+	// Clients poll inspections, unchanged orchestrations are answered without building them
+	if etag, modified, err := app.Engine.inspectionVersion(orchestrationID, strings.Join(fields, ",")); err == nil {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-cache")
+		if notModified(r, etag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	inspection, err := app.Engine.inspectOrchestration(orchestrationID, len(fields) == 0 || slices.Contains(fields, "tasks"))
+	if err != nil {
+		logger := app.requestLogger(r)
+		logger.
 			Error().
 			Err(err).
 			Str("OrchestrationID", orchestrationID).
 			Msg("Failed to inspect orchestration")
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 
+	// Lightweight pollers pick the fields they need with ?fields=
+	var body any = inspection
+	if len(fields) > 0 {
+		if body, err = app.Engine.sparseInspection(inspection, fields); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(inspection); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Internal, err))
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
 		return
 	}
 }
@@ -412,25 +910,25 @@ func (app *App) OrchestrationInspectionHandler(w http.ResponseWriter, r *http.Re
 func (app *App) healthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]any{}); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Internal, err))
+		httpErrorResponse(w, app.Logger, errs.E(errs.Internal, err))
 		return
 	}
 }
 
 // ApplyGrounding apply new domain grounding spec to a project
 func (app *App) ApplyGrounding(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
-	app.Logger.Info().Interface("project", project).Msg("ApplyGrounding")
+	logger := app.requestLogger(r)
+	logger.Info().Interface("project", project).Msg("ApplyGrounding")
 
 	var grounding GroundingSpec
 	if err := json.NewDecoder(r.Body).Decode(&grounding); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 
@@ -439,35 +937,34 @@ func (app *App) ApplyGrounding(w http.ResponseWriter, r *http.Request) {
 	if err := app.Engine.ApplyGroundingSpec(app.RootCtx, &grounding); err != nil {
 		var validErr ValidationError
 		if errors.As(err, &validErr) {
-			errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Parameter(validErr.Field()), validErr.Error()))
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Parameter(validErr.Field()), validErr.Error()))
 			return
 		}
 
 		var specErr SpecVersionError
 		if errors.As(err, &specErr) {
-			errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Invalid, errs.Parameter("version"), specErr.Error()))
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Invalid, errs.Parameter("version"), specErr.Error()))
 			return
 		}
 
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	app.Logger.Trace().Interface("Grounding", grounding).Msg("Successfully applied grounding spec")
+	logger.Trace().Interface("Grounding", grounding).Msg("Successfully applied grounding spec")
 
 	if err := json.NewEncoder(w).Encode(grounding); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 }
 
 // ListGrounding retrieves all domain grounding for a project
 func (app *App) ListGrounding(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
@@ -476,7 +973,7 @@ func (app *App) ListGrounding(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(groundings); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Internal, errs.Code(JSONMarshalingFailErrCode), err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, errs.Code(JSONMarshalingFailErrCode), err))
 		return
 	}
 }
@@ -486,15 +983,14 @@ func (app *App) RemoveGrounding(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
 	if err := app.Engine.RemoveGroundingSpecByName(project.ID, name); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 
@@ -503,17 +999,44 @@ func (app *App) RemoveGrounding(w http.ResponseWriter, r *http.Request) {
 
 // RemoveAllGrounding removes domain grounding for a specific project
 func (app *App) RemoveAllGrounding(w http.ResponseWriter, r *http.Request) {
-	apiKey := r.Context().Value(apiKeyContextKey).(string)
-	project, err := app.Engine.GetProjectByApiKey(apiKey)
+	project, err := app.requestProject(r)
 	if err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
 		return
 	}
 
 	if err := app.Engine.RemoveProjectGrounding(project.ID); err != nil {
-		errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ListAuditEvents returns the project's audit trail, newest first
+func (app *App) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	query, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, err))
+		return
+	}
+
+	events, err := app.Audit.List(project.ID, query)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(AuditQueryFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
@@ -40,19 +40,26 @@ func setupTestApp(t *testing.T) (*App, *Project, func()) {
 	db, err := NewBadgerDB(tmpDir, logger)
 	require.NoError(t, err)
 
+	plane := NewPlanEngine()
+	// Test webhook receivers listen on loopback addresses
+	plane.ConfigureWebhookAddresses(WebhookAddresses{AllowPrivate: true})
+	ctx, cancel := context.WithCancel(context.Background())
 	dbCleanup := func() {
+		// Webhook retries are dead-lettered before the DB closes
+		cancel()
+		plane.notifying.Wait()
 		err := db.Close()
 		assert.NoError(t, err)
 		err = os.RemoveAll(tmpDir)
 		assert.NoError(t, err)
 	}
 
-	plane := NewPlanEngine()
-	plane.Initialise(context.Background(), db, db, db, db, nil, nil, nil, &fakePddlValidator{}, nil, logger)
+	plane.Initialise(ctx, db, db, db, db, nil, nil, nil, &fakePddlValidator{}, nil, logger)
 
 	app := &App{
 		Router: mux.NewRouter(),
 		Engine: plane,
+		Db:     db,
 		Logger: logger,
 	}
 
@@ -63,6 +70,11 @@ func setupTestApp(t *testing.T) (*App, *Project, func()) {
 		ID:     "project-id",
 		APIKey: "project-api-key",
 	}
+	lookupKey, err := db.APIKeyLookupKey()
+	require.NoError(t, err)
+	require.NoError(t, project.hashPlaintextAPIKeys(lookupKey))
+	// API keys are only looked up through their storage index
+	require.NoError(t, db.StoreProject(project))
 	app.Engine.projects[project.ID] = project
 
 	return app, project, dbCleanup
@@ -314,3 +326,102 @@ func TestGroundingValidationViaApi(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIVersioning(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	send := func(path, version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		if version != "" {
+			req.Header.Set(APIVersionHeader, version)
+		}
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("serves the API under the version prefix", func(t *testing.T) {
+		w := send(APIVersionPrefix+"/groundings", CurrentAPIVersion)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, CurrentAPIVersion, w.Header().Get(APIVersionHeader))
+		assert.Empty(t, w.Header().Get("Deprecation"))
+	})
+
+	t.Run("keeps legacy paths as deprecated aliases", func(t *testing.T) {
+		w := send("/groundings", "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, CurrentAPIVersion, w.Header().Get(APIVersionHeader))
+		assert.Equal(t, "true", w.Header().Get("Deprecation"))
+		assert.Equal(t, fmt.Sprintf("<%s/groundings>; rel=\"successor-version\"", APIVersionPrefix), w.Header().Get("Link"))
+	})
+
+	t.Run("rejects unsupported versions", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send(APIVersionPrefix+"/groundings", "2").Code)
+		assert.Equal(t, http.StatusBadRequest, send("/groundings", "2").Code)
+	})
+
+	t.Run("leaves probes unversioned", func(t *testing.T) {
+		w := send("/health", "2")
+		assert.NotEqual(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, w.Header().Get(APIVersionHeader))
+	})
+}
+
+func TestServiceRegistrationByName(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	const schema = `{"input":{"type":"object","properties":{"message":{"type":"string"}}},"output":{"type":"object","properties":{"message":{"type":"string"}}}}`
+	register := func(method, kind, body string) (*httptest.ResponseRecorder, ServiceRegistrationResponse) {
+		req := httptest.NewRequest(method, "/register/"+kind, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+
+		var response ServiceRegistrationResponse
+		if w.Code < http.StatusBadRequest {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		}
+		return w, response
+	}
+
+	w, first := register(http.MethodPut, "service", `{"name":"echo","description":"echoes","schema":`+schema+`}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.True(t, first.Created)
+	assert.EqualValues(t, 1, first.Version)
+
+	t.Run("re-registering a name updates its service", func(t *testing.T) {
+		w, again := register(http.MethodPut, "service", `{"name":"echo","description":"echoes louder","schema":`+schema+`}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.False(t, again.Created)
+		assert.Equal(t, first.ID, again.ID)
+		assert.EqualValues(t, 2, again.Version)
+
+		w, posted := register(http.MethodPost, "service", `{"name":"echo","description":"echoes","schema":`+schema+`}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.False(t, posted.Created)
+		assert.Equal(t, first.ID, posted.ID)
+
+		services, err := app.Engine.discoverProjectServices("project-id")
+		require.NoError(t, err)
+		assert.Len(t, services, 1)
+		assert.Equal(t, "echoes", services[0].Description)
+	})
+
+	t.Run("names belong to one service", func(t *testing.T) {
+		w, _ := register(http.MethodPut, "agent", `{"name":"echo","description":"echoes","schema":`+schema+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ServiceNameTakenErrCode)
+
+		w, other := register(http.MethodPost, "service", `{"name":"other","description":"others","schema":`+schema+`}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, other.Created)
+
+		w, _ = register(http.MethodPut, "service", `{"id":"`+other.ID+`","name":"echo","description":"echoes","schema":`+schema+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ServiceNameTakenErrCode)
+	})
+}
@@ -0,0 +1,531 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	TaskTypeApproval   = "approval"
+	ApprovalProducerID = "approval"
+	approvalStepPrefix = "approval_"
+)
+
+var (
+	ErrApprovalNotFound     = errors.New("no approval is pending for this step")
+	ErrInvalidApprovalToken = errors.New("invalid approval token")
+)
+
+// ApprovalGate requires a person to sign off before an orchestration's tasks for a service are executed
+type ApprovalGate struct {
+	// Service is the ID or name of the service whose tasks need approving
+	Service string `json:"service"`
+	// Message is shown to approvers alongside the inputs the task will run with
+	Message string `json:"message,omitempty"`
+}
+
+// ApprovalDecision is an approver's response to an approval request
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// PendingApproval is an approval step waiting on a decision. It's stored with the orchestration, so the step is
+// asked for again when the engine recovers.
+type PendingApproval struct {
+	StepID      string    `json:"stepId"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+type pendingApproval struct {
+	token     string
+	decisions chan ApprovalDecision
+}
+
+type ApprovalWorker struct {
+	TaskID       string
+	Message      string
+	Dependencies TaskDependenciesWithKeys
+	LogManager   *LogManager
+	logState     *LogState
+}
+
+// insertApprovalSteps puts an approval step in front of every task using a gated service. The step passes
+// the task's inputs through once approved, so the task runs with exactly the values the approver saw.
+func insertApprovalSteps(plan *ExecutionPlan, gates []ApprovalGate) *ExecutionPlan {
+	if len(gates) == 0 {
+		return plan
+	}
+
+	gated := &ExecutionPlan{
+		ProjectID:        plan.ProjectID,
+		ParallelGroups:   plan.ParallelGroups,
+		GroundingHit:     plan.GroundingHit,
+		GroundingID:      plan.GroundingID,
+		GroundingVersion: plan.GroundingVersion,
+	}
+
+	for _, task := range plan.Tasks {
+		gate, ok := approvalGateFor(task, gates)
+		if !ok {
+			gated.Tasks = append(gated.Tasks, task)
+			continue
+		}
+
+		approval := &SubTask{
+			ID:          approvalStepPrefix + task.ID,
+			Type:        TaskTypeApproval,
+			ServiceName: TaskTypeApproval,
+			Message:     gate.Message,
+			Input:       make(map[string]any),
+		}
+
+		// Tasks may be shared with the plan cache, so the gated task is copied rather than rewritten
+		approved := *task
+		approved.Input = make(map[string]any, len(task.Input))
+		for key, source := range task.Input {
+			if dep, _ := extractDependencyIDAndKey(source); dep == "" {
+				approved.Input[key] = source
+				continue
+			}
+			approval.Input[key] = source
+			approved.Input[key] = fmt.Sprintf("$%s.%s", approval.ID, key)
+		}
+
+		gated.Tasks = append(gated.Tasks, approval, &approved)
+	}
+
+	return gated
+}
+
+func approvalGateFor(task *SubTask, gates []ApprovalGate) (ApprovalGate, bool) {
+	for _, gate := range gates {
+		if strings.EqualFold(gate.Service, task.Service) || strings.EqualFold(gate.Service, task.ServiceName) {
+			return gate, true
+		}
+	}
+	return ApprovalGate{}, false
+}
+
+func NewApprovalWorker(task *SubTask, logManager *LogManager) LogWorker {
+	return &ApprovalWorker{
+		TaskID:       task.ID,
+		Message:      task.Message,
+		Dependencies: task.extractDependencies(),
+		LogManager:   logManager,
+		logState: &LogState{
+			LastOffset:      0,
+			Processed:       make(map[string]bool),
+			DependencyState: make(map[string]json.RawMessage),
+		},
+	}
+}
+
+func (a *ApprovalWorker) Start(ctx context.Context, orchestrationID string) {
+	logStream := a.LogManager.GetLog(orchestrationID)
+	if logStream == nil {
+		a.LogManager.Logger.Debug().Str("orchestrationID", orchestrationID).Msg("Log stream not found for orchestration")
+		return
+	}
+
+	entriesChan := make(chan LogEntry, 100)
+	go a.PollLog(ctx, orchestrationID, logStream, entriesChan)
+
+	for {
+		select {
+		case entry := <-entriesChan:
+			done, err := a.processEntry(ctx, entry, orchestrationID)
+			if err != nil {
+				a.LogManager.Logger.
+					Error().
+					Err(err).
+					Str("orchestrationID", orchestrationID).
+					Msgf("Approval worker %s failed to process entry for orchestration", a.TaskID)
+				return
+			}
+			if done {
+				return
+			}
+		case <-ctx.Done():
+			a.LogManager.Logger.Info().Msgf("ApprovalWorker for step %s in orchestration %s is stopping", a.TaskID, orchestrationID)
+			return
+		}
+	}
+}
+
+func (a *ApprovalWorker) PollLog(ctx context.Context, _ string, logStream *Log, entriesChan chan<- LogEntry) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			entries := logStream.ReadFrom(a.logState.LastOffset)
+			for _, entry := range entries {
+				_, isDependency := a.Dependencies[entry.GetID()]
+				if entry.GetEntryType() != "task_output" || !isDependency || a.logState.Processed[entry.GetID()] {
+					continue
+				}
+
+				select {
+				case entriesChan <- entry:
+					a.logState.LastOffset = entry.GetOffset() + 1
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processEntry waits for a decision once all the step's inputs are available, it reports whether the step is done
+func (a *ApprovalWorker) processEntry(ctx context.Context, entry LogEntry, orchestrationID string) (bool, error) {
+	a.logState.DependencyState[entry.GetID()] = entry.GetValue()
+	a.logState.Processed[entry.GetID()] = true
+	if !taskDependenciesMet(a.logState.DependencyState, a.Dependencies) {
+		return false, nil
+	}
+
+	planEngine := a.LogManager.planEngine
+	if err := planEngine.awaitApprovalDispatch(ctx, orchestrationID); err != nil {
+		return true, nil
+	}
+
+	input, err := mergeValueMapsToJson(a.logState.DependencyState, a.Dependencies)
+	if err != nil {
+		return true, fmt.Errorf("failed to collect inputs for approval step %s: %w", a.TaskID, err)
+	}
+
+	requestedTs := time.Now().UTC()
+	if err := a.LogManager.AppendTaskStatusEvent(orchestrationID, a.TaskID, ApprovalProducerID, Paused, nil, requestedTs, 0); err != nil {
+		return true, err
+	}
+	if err := a.LogManager.MarkTask(orchestrationID, a.TaskID, Paused, requestedTs); err != nil {
+		return true, err
+	}
+
+	decisions, err := planEngine.requestApproval(orchestrationID, a.TaskID, a.Message, input)
+	if err != nil {
+		return true, err
+	}
+	defer planEngine.removeApproval(orchestrationID, a.TaskID)
+
+	select {
+	case decision := <-decisions:
+		return true, a.applyDecision(orchestrationID, input, decision)
+	case <-ctx.Done():
+		return true, nil
+	}
+}
+
+func (a *ApprovalWorker) applyDecision(orchestrationID string, input json.RawMessage, decision ApprovalDecision) error {
+	planEngine := a.LogManager.planEngine
+	decidedTs := time.Now().UTC()
+
+	if !decision.Approved {
+		reason := fmt.Sprintf("approval step %s was rejected", a.TaskID)
+		if decision.Comment != "" {
+			reason = fmt.Sprintf("%s: %s", reason, decision.Comment)
+		}
+
+		if err := a.LogManager.AppendTaskStatusEvent(orchestrationID, a.TaskID, ApprovalProducerID, Cancelled, errors.New(reason), decidedTs, 0); err != nil {
+			return err
+		}
+		if err := a.LogManager.MarkTask(orchestrationID, a.TaskID, Cancelled, decidedTs); err != nil {
+			return err
+		}
+		_, err := planEngine.AbortOrchestration(orchestrationID, reason)
+		return err
+	}
+
+	if err := planEngine.settleApproval(orchestrationID, a.TaskID); err != nil {
+		return err
+	}
+
+	a.LogManager.AppendToLog(orchestrationID, "task_output", a.TaskID, input, ApprovalProducerID, 0)
+	if err := a.LogManager.AppendTaskStatusEvent(orchestrationID, a.TaskID, ApprovalProducerID, Completed, nil, decidedTs, 0); err != nil {
+		return err
+	}
+	return a.LogManager.MarkTaskCompleted(orchestrationID, a.TaskID, decidedTs)
+}
+
+// requestApproval pauses the orchestration and asks the project's webhooks for a decision on an approval step
+func (p *PlanEngine) requestApproval(orchestrationID, stepID, message string, input json.RawMessage) (<-chan ApprovalDecision, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate approval token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	approval := &pendingApproval{token: token, decisions: make(chan ApprovalDecision, 1)}
+	p.approvalsMu.Lock()
+	p.approvals[approvalKey(orchestrationID, stepID)] = approval
+	p.approvalsMu.Unlock()
+
+	if err := p.holdForApproval(orchestrationID, PendingApproval{StepID: stepID, RequestedAt: time.Now().UTC()}); err != nil {
+		p.removeApproval(orchestrationID, stepID)
+		return nil, err
+	}
+
+	orchestration, err := p.getOrchestration(orchestrationID)
+	if err != nil {
+		return nil, err
+	}
+	if project, err := p.GetProjectByID(orchestration.ProjectID); err == nil {
+		p.notifyInBackground(func() {
+			p.notifyOrchestrationEvent(project, orchestrationID, ProjectEventApprovalRequested, map[string]any{
+				"orchestrationId": orchestrationID,
+				"stepId":          stepID,
+				"message":         message,
+				"input":           input,
+				"token":           token,
+				"approvalPath":    fmt.Sprintf("/orchestrations/%s/approvals/%s", orchestrationID, stepID),
+			})
+		})
+	}
+
+	return approval.decisions, nil
+}
+
+// DecideApproval delivers an approver's decision to a pending approval step
+func (p *PlanEngine) DecideApproval(orchestrationID, stepID, token string, decision ApprovalDecision) error {
+	p.approvalsMu.Lock()
+	defer p.approvalsMu.Unlock()
+
+	key := approvalKey(orchestrationID, stepID)
+	approval, exists := p.approvals[key]
+	if !exists {
+		return ErrApprovalNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(approval.token), []byte(token)) != 1 {
+		return ErrInvalidApprovalToken
+	}
+
+	delete(p.approvals, key)
+	approval.decisions <- decision
+	return nil
+}
+
+// awaitApprovalDispatch lets an approval step through while the orchestration is paused for another approval, so
+// parallel approvals are asked for together. Any other pause holds the step like a task.
+func (p *PlanEngine) awaitApprovalDispatch(ctx context.Context, orchestrationID string) error {
+	// The gate is read under the store lock, holdForApproval closes it and pauses in one step
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	heldForApproval := exists && orchestration.Status == Paused && orchestration.PausedBy == ApprovalProducerID
+	p.pauseMu.RLock()
+	gate, paused := p.pauseGates[orchestrationID]
+	p.pauseMu.RUnlock()
+	p.orchestrationStoreMu.RUnlock()
+	if heldForApproval || !paused {
+		return nil
+	}
+
+	select {
+	case <-gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// holdForApproval records a pending approval step and pauses the orchestration for it. An orchestration that's
+// already paused stays paused by whatever paused it.
+func (p *PlanEngine) holdForApproval(orchestrationID string, pending PendingApproval) error {
+	p.orchestrationStoreMu.Lock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		p.orchestrationStoreMu.Unlock()
+		return ErrOrchestrationNotFound
+	}
+
+	previous := orchestration.PendingApprovals
+	orchestration.PendingApprovals = append(slices.DeleteFunc(slices.Clone(previous), func(approval PendingApproval) bool {
+		return approval.StepID == pending.StepID
+	}), pending)
+
+	if orchestration.Status != Processing {
+		err := p.orchestrationStorage.StoreOrchestration(orchestration)
+		if err != nil {
+			orchestration.PendingApprovals = previous
+		}
+		p.orchestrationStoreMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to persist pending approval: %w", err)
+		}
+		return nil
+	}
+
+	// Close the gate before the status changes so no task slips through
+	p.pauseMu.Lock()
+	if _, exists := p.pauseGates[orchestrationID]; !exists {
+		p.pauseGates[orchestrationID] = make(chan struct{})
+	}
+	p.pauseMu.Unlock()
+
+	_, err := p.transitionOrchestrationLocked(orchestration, Processing, Paused, ApprovalProducerID, ErrOrchestrationNotPausable)
+	if err != nil {
+		orchestration.PendingApprovals = previous
+	}
+	p.orchestrationStoreMu.Unlock()
+	if err != nil {
+		p.pauseMu.Lock()
+		delete(p.pauseGates, orchestrationID)
+		p.pauseMu.Unlock()
+		return err
+	}
+
+	p.LogManager.MarkOrchestration(orchestrationID, Paused, nil)
+	return nil
+}
+
+// settleApproval clears a decided approval step. The orchestration resumes only if the approval paused it and no
+// other approval is pending, a pause made by an operator or a budget stays in place.
+func (p *PlanEngine) settleApproval(orchestrationID, stepID string) error {
+	p.orchestrationStoreMu.Lock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		p.orchestrationStoreMu.Unlock()
+		return ErrOrchestrationNotFound
+	}
+
+	previous := orchestration.PendingApprovals
+	orchestration.PendingApprovals = slices.DeleteFunc(slices.Clone(previous), func(approval PendingApproval) bool {
+		return approval.StepID == stepID
+	})
+	resume := orchestration.Status == Paused && orchestration.PausedBy == ApprovalProducerID && len(orchestration.PendingApprovals) == 0
+
+	var err error
+	if resume {
+		_, err = p.transitionOrchestrationLocked(orchestration, Paused, Processing, "", ErrOrchestrationNotResumable)
+	} else if err = p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		err = fmt.Errorf("failed to persist pending approvals: %w", err)
+	}
+	if err != nil {
+		orchestration.PendingApprovals = previous
+	}
+	p.orchestrationStoreMu.Unlock()
+	if err != nil || !resume {
+		return err
+	}
+
+	p.LogManager.MarkOrchestration(orchestrationID, Processing, nil)
+	p.releasePauseGate(orchestrationID)
+	return nil
+}
+
+// failInterruptedApprovals fails a paused orchestration whose approval steps were pending when the engine stopped.
+// Its workers stopped with the engine, so nothing would carry it on once approved. Retrying it reuses the outputs
+// of its completed tasks and asks for the approvals again.
+func (p *PlanEngine) failInterruptedApprovals(orchestrationID string) {
+	p.orchestrationStoreMu.Lock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists || orchestration.Status != Paused || len(orchestration.PendingApprovals) == 0 {
+		p.orchestrationStoreMu.Unlock()
+		return
+	}
+	steps := make([]string, 0, len(orchestration.PendingApprovals))
+	for _, pending := range orchestration.PendingApprovals {
+		steps = append(steps, pending.StepID)
+	}
+	orchestration.PendingApprovals = nil
+	p.orchestrationStoreMu.Unlock()
+
+	reason := fmt.Sprintf("plan engine restarted while approval of %s was pending, retry the orchestration to ask for it again", strings.Join(steps, ", "))
+	if err := p.failOrchestration(orchestrationID, reason); err != nil {
+		p.Logger.Error().
+			Err(err).
+			Str("OrchestrationID", orchestrationID).
+			Msg("Failed to fail orchestration interrupted waiting on approval")
+		return
+	}
+	p.releasePauseGate(orchestrationID)
+
+	p.Logger.Info().
+		Str("OrchestrationID", orchestrationID).
+		Strs("StepIDs", steps).
+		Msg("Orchestration failed, it was waiting on approval when the plan engine stopped")
+}
+
+func (p *PlanEngine) removeApproval(orchestrationID, stepID string) {
+	p.approvalsMu.Lock()
+	defer p.approvalsMu.Unlock()
+	delete(p.approvals, approvalKey(orchestrationID, stepID))
+}
+
+func approvalKey(orchestrationID, stepID string) string {
+	return orchestrationID + "/" + stepID
+}
+
+// approvalRequest records a decision on an approval step
+type approvalRequest struct {
+	Token    string `json:"token"`
+	Approved *bool  `json:"approved"`
+	Comment  string `json:"comment"`
+}
+
+// ApproveOrchestrationStepHandler records a decision on an approval step, it's authorised by the step's approval token
+func (app *App) ApproveOrchestrationStepHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID := mux.Vars(r)["id"]
+	stepID := mux.Vars(r)["stepId"]
+
+	var request approvalRequest
+	if err := decodeRequest(w, r, &request, approvalDecisionFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if request.Token == "" {
+		httpErrorResponse(w, app.requestLogger(r), missingField("token"))
+		return
+	}
+	if request.Approved == nil {
+		httpErrorResponse(w, app.requestLogger(r), missingField("approved"))
+		return
+	}
+
+	decision := ApprovalDecision{Approved: *request.Approved, Comment: request.Comment}
+	err := app.Engine.DecideApproval(orchestrationID, stepID, request.Token, decision)
+	switch {
+	case errors.Is(err, ErrApprovalNotFound), errors.Is(err, ErrInvalidApprovalToken):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownApprovalErrCode), "unknown approval: "+stepID))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	if orchestration, err := app.Engine.getOrchestration(orchestrationID); err == nil {
+		setAuditProjectID(r, orchestration.ProjectID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":       orchestrationID,
+		"stepId":   stepID,
+		"approved": decision.Approved,
+	}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
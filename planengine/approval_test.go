@@ -0,0 +1,230 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertApprovalSteps(t *testing.T) {
+	payment := &SubTask{ID: "task2", Service: "s_pay", ServiceName: "Payments", Input: map[string]any{"amount": "$task1.total", "currency": "GBP"}}
+	plan := &ExecutionPlan{
+		ProjectID: "p_test",
+		Tasks: []*SubTask{
+			{ID: "task1", Service: "s_cart", ServiceName: "Cart", Input: map[string]any{"items": "$task0.items"}},
+			payment,
+		},
+	}
+
+	gated := insertApprovalSteps(plan, []ApprovalGate{{Service: "payments", Message: "Confirm payment"}})
+
+	require.Len(t, gated.Tasks, 3)
+	assert.Equal(t, "task1", gated.Tasks[0].ID)
+
+	approval := gated.Tasks[1]
+	assert.Equal(t, "approval_task2", approval.ID)
+	assert.Equal(t, TaskTypeApproval, approval.Type)
+	assert.Equal(t, "Confirm payment", approval.Message)
+	assert.Equal(t, map[string]any{"amount": "$task1.total"}, approval.Input)
+
+	approved := gated.Tasks[2]
+	assert.Equal(t, map[string]any{"amount": "$approval_task2.amount", "currency": "GBP"}, approved.Input)
+	assert.Contains(t, approved.extractDependencies(), "approval_task2")
+	assert.Equal(t, "$task1.total", payment.Input["amount"], "planned tasks are left untouched")
+
+	assert.Same(t, plan, insertApprovalSteps(plan, nil))
+}
+
+func TestApprovalStep(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	events := make(chan ProjectEvent, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	// awaitRequest returns the token sent to approvers for an orchestration's step
+	awaitRequest := func(t *testing.T, orchestrationID, stepID string) string {
+		for {
+			select {
+			case event := <-events:
+				if event.Event != ProjectEventApprovalRequested {
+					continue
+				}
+				data := event.Data.(map[string]any)
+				if data["orchestrationId"] != orchestrationID {
+					continue
+				}
+				if data["stepId"] != stepID {
+					events <- event
+					continue
+				}
+				assert.Equal(t, "Ship it?", data["message"])
+				assert.Equal(t, map[string]any{"order": "ord_1"}, data["input"])
+				return data["token"].(string)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("approval for %s was not requested", stepID)
+			}
+		}
+	}
+	approvalStep := func(stepID string) *SubTask {
+		return &SubTask{ID: stepID, Type: TaskTypeApproval, Message: "Ship it?", Input: map[string]any{"order": "$task0.order"}}
+	}
+	// startApproval runs approval steps for a running orchestration and returns the tokens sent to approvers
+	startApproval := func(t *testing.T, stepIDs ...string) (*Orchestration, []string) {
+		if len(stepIDs) == 0 {
+			stepIDs = []string{"approval_task1"}
+		}
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		for _, stepID := range stepIDs {
+			go NewApprovalWorker(approvalStep(stepID), app.Engine.LogManager).Start(ctx, orchestration.ID)
+		}
+		app.Engine.LogManager.AppendToLog(orchestration.ID, "task_output", "task0", json.RawMessage(`{"order":"ord_1"}`), "task0", 0)
+
+		var tokens []string
+		for _, stepID := range stepIDs {
+			tokens = append(tokens, awaitRequest(t, orchestration.ID, stepID))
+		}
+		return orchestration, tokens
+	}
+
+	decide := func(orchestrationID, stepID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/"+orchestrationID+"/approvals/"+stepID, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	statusOf := func(orchestration *Orchestration) Status {
+		app.Engine.orchestrationStoreMu.RLock()
+		defer app.Engine.orchestrationStoreMu.RUnlock()
+		return orchestration.Status
+	}
+	approved := func(orchestration *Orchestration, stepID string) func() bool {
+		return func() bool {
+			for _, entry := range app.Engine.LogManager.GetLog(orchestration.ID).ReadFrom(0) {
+				if entry.GetEntryType() == "task_output" && entry.GetID() == stepID {
+					return string(entry.GetValue()) == `{"order":"ord_1"}`
+				}
+			}
+			return false
+		}
+	}
+
+	t.Run("approved steps resume the orchestration", func(t *testing.T) {
+		orchestration, tokens := startApproval(t)
+		token := tokens[0]
+		assert.Equal(t, Paused, statusOf(orchestration))
+
+		w := decide(orchestration.ID, "approval_task1", `{"token":"wrong","approved":true}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q}`, token))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "a decision is required")
+
+		w = decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q,"approve":true}`, token))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), UnknownRequestFieldErrCode)
+
+		w = decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q,"approved":true}`, token))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		require.Eventually(t, approved(orchestration, "approval_task1"), 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, Processing, statusOf(orchestration))
+
+		w = decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q,"approved":true}`, token))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "approvals can only be decided once")
+	})
+
+	t.Run("rejected steps cancel the orchestration", func(t *testing.T) {
+		orchestration, tokens := startApproval(t)
+
+		w := decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q,"approved":false,"comment":"wrong address"}`, tokens[0]))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		require.Eventually(t, func() bool { return statusOf(orchestration) == Cancelled }, 2*time.Second, 10*time.Millisecond)
+		assert.Contains(t, string(orchestration.Error), "wrong address")
+	})
+
+	t.Run("orchestrations resume once every pending approval is decided", func(t *testing.T) {
+		orchestration, tokens := startApproval(t, "approval_task1", "approval_task2")
+		assert.Equal(t, Paused, statusOf(orchestration))
+
+		w := decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q,"approved":true}`, tokens[0]))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Eventually(t, approved(orchestration, "approval_task1"), 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, Paused, statusOf(orchestration), "approval_task2 is still pending")
+
+		w = decide(orchestration.ID, "approval_task2", fmt.Sprintf(`{"token":%q,"approved":true}`, tokens[1]))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Eventually(t, approved(orchestration, "approval_task2"), 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, Processing, statusOf(orchestration))
+	})
+
+	t.Run("approvals leave an operator's pause in place", func(t *testing.T) {
+		orchestration, tokens := startApproval(t)
+		_, err := app.Engine.ResumeOrchestration(orchestration.ID)
+		require.NoError(t, err)
+		_, err = app.Engine.PauseOrchestration(orchestration.ID)
+		require.NoError(t, err)
+
+		w := decide(orchestration.ID, "approval_task1", fmt.Sprintf(`{"token":%q,"approved":true}`, tokens[0]))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Eventually(t, approved(orchestration, "approval_task1"), 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, Paused, statusOf(orchestration))
+	})
+
+	t.Run("orchestrations waiting on approval fail when the engine restarts", func(t *testing.T) {
+		orchestration, _ := startApproval(t)
+		require.NoError(t, app.Db.StoreProject(project))
+
+		stored, err := app.Engine.orchestrationStorage.LoadOrchestration(orchestration.ID)
+		require.NoError(t, err)
+		require.Len(t, stored.PendingApprovals, 1)
+		assert.Equal(t, "approval_task1", stored.PendingApprovals[0].StepID)
+		assert.Equal(t, ApprovalProducerID, stored.PausedBy)
+
+		// A fresh engine over the same DB has none of the approval's workers or tokens
+		restarted := NewPlanEngine()
+		restarted.ConfigureWebhookAddresses(WebhookAddresses{AllowPrivate: true})
+		logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, restarted)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		restarted.Initialise(ctx, app.Db, app.Db, app.Db, app.Db, logManager, nil, nil, &fakePddlValidator{}, nil, app.Logger)
+		restarted.notifying.Wait()
+
+		recovered, err := restarted.getOrchestration(orchestration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Failed, recovered.Status)
+		assert.Contains(t, string(recovered.Error), "approval of approval_task1 was pending")
+		assert.Empty(t, recovered.PendingApprovals)
+		assert.NoError(t, restarted.awaitDispatch(ctx, orchestration.ID), "nothing waits on the failed orchestration")
+
+		stored, err = app.Engine.orchestrationStorage.LoadOrchestration(orchestration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Failed, stored.Status, "the failure is persisted")
+	})
+}
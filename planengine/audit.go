@@ -0,0 +1,388 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	short "github.com/lithammer/shortuuid/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	AuditSinkDB     = "db"
+	AuditSinkFile   = "file"
+	AuditSinkSyslog = "syslog"
+
+	AuditActionProjectRegister         = "project.register"
+	AuditActionAPIKeyCreate            = "apikey.create"
+	AuditActionWebhookAdd              = "webhook.add"
+	AuditActionWebhookUpdate           = "webhook.update"
+	AuditActionWebhookRemove           = "webhook.remove"
+	AuditActionServiceRegister         = "service.register"
+	AuditActionAgentRegister           = "agent.register"
+	AuditActionOrchestrationRun        = "orchestration.submit"
+	AuditActionOrchestrationBatch      = "orchestration.submit_batch"
+	AuditActionGroundingApply          = "grounding.apply"
+	AuditActionGroundingRemove         = "grounding.remove"
+	AuditActionGroundingPurge          = "grounding.remove_all"
+	AuditActionCertificateIssue        = "certificate.issue"
+	AuditActionMemberAdd               = "member.add"
+	AuditActionMemberRemove            = "member.remove"
+	AuditActionSecurityUpdate          = "project.security.update"
+	AuditActionLimitsUpdate            = "project.limits.update"
+	AuditActionNotificationsUpdate     = "project.notifications.update"
+	AuditActionAlertsUpdate            = "project.alerts.update"
+	AuditActionProjectUpdate           = "project.update"
+	AuditActionProjectDelete           = "project.delete"
+	AuditActionOrchestrationForceFail  = "orchestration.force_fail"
+	AuditActionRegistrationTokenCreate = "registration_token.create"
+	AuditActionOrchestrationCancel     = "orchestration.cancel"
+	AuditActionOrchestrationPause      = "orchestration.pause"
+	AuditActionOrchestrationResume     = "orchestration.resume"
+	AuditActionOrchestrationRetry      = "orchestration.retry"
+	AuditActionOrchestrationClone      = "orchestration.clone"
+	AuditActionOrchestrationApprove    = "orchestration.approve"
+	AuditActionOrchestrationDelete     = "orchestration.delete"
+	AuditActionDeadLetterRedrive       = "dead_letter.redrive"
+	AuditActionDeadLetterPurge         = "dead_letter.purge"
+	AuditActionDeadLetterPurgeAll      = "dead_letter.purge_all"
+	AuditActionScheduleCreate          = "schedule.create"
+	AuditActionSchedulePause           = "schedule.pause"
+	AuditActionScheduleResume          = "schedule.resume"
+	AuditActionScheduleDelete          = "schedule.delete"
+	AuditActionTemplateCreate          = "template.create"
+	AuditActionTemplateUpdate          = "template.update"
+	AuditActionTemplateDelete          = "template.delete"
+	AuditActionServiceDrain            = "service.drain"
+	AuditActionServiceDeregister       = "service.deregister"
+	AuditActionWebhookRedrive          = "webhook.redrive"
+	AuditActionWebhookDeadLetterPurge  = "webhook.dead_letter_purge"
+	AuditActionWebhookSecretRotate     = "webhook.secret_rotate"
+	AuditActionWebhookRedeliver        = "webhook.redeliver"
+	AuditActionWebhookTest             = "webhook.test"
+	anonymousAuditActor                = "anonymous"
+	unknownAPIKeyAuditActor            = "apikey:unknown"
+	defaultAuditQueryLimit             = 100
+	maxAuditQueryLimit                 = 1000
+)
+
+type auditContextKey struct{}
+
+// AuditEvent records who performed a control plane mutation, what it was and when
+type AuditEvent struct {
+	ID            string    `json:"id"`
+	ProjectID     string    `json:"projectId"`
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	PayloadDigest string    `json:"payloadDigest,omitempty"`
+	Status        int       `json:"status"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// AuditQuery narrows the audit events returned for a project
+type AuditQuery struct {
+	Action string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (q AuditQuery) matches(event AuditEvent) bool {
+	if q.Action != "" && q.Action != event.Action {
+		return false
+	}
+	if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && event.Timestamp.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+func parseAuditQuery(values url.Values) (AuditQuery, error) {
+	query := AuditQuery{Action: values.Get("action")}
+
+	if since := values.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return AuditQuery{}, fmt.Errorf("invalid since, expected an RFC3339 timestamp: %w", err)
+		}
+		query.Since = t
+	}
+
+	if until := values.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return AuditQuery{}, fmt.Errorf("invalid until, expected an RFC3339 timestamp: %w", err)
+		}
+		query.Until = t
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return AuditQuery{}, fmt.Errorf("invalid limit, expected a positive integer")
+		}
+		query.Limit = n
+	}
+
+	return query, nil
+}
+
+// AuditSink is a destination audit events are written to
+type AuditSink interface {
+	Record(event AuditEvent) error
+}
+
+// AuditStorage persists audit events so they can be queried
+type AuditStorage interface {
+	StoreAuditEvent(event AuditEvent) error
+	ListAuditEvents(projectID string, query AuditQuery) ([]AuditEvent, error)
+}
+
+// AuditLog fans audit events out to the configured sinks
+type AuditLog struct {
+	sinks   []AuditSink
+	storage AuditStorage
+	Logger  zerolog.Logger
+}
+
+func NewAuditLog(cfg Audit, storage AuditStorage, logger zerolog.Logger) (*AuditLog, error) {
+	auditLog := &AuditLog{Logger: logger}
+
+	for _, name := range cfg.Sinks {
+		switch name {
+		case AuditSinkDB:
+			auditLog.storage = storage
+			auditLog.sinks = append(auditLog.sinks, &dbAuditSink{storage: storage})
+		case AuditSinkFile:
+			sink, err := newFileAuditSink(cfg.FilePath)
+			if err != nil {
+				return nil, err
+			}
+			auditLog.sinks = append(auditLog.sinks, sink)
+		case AuditSinkSyslog:
+			sink, err := newSyslogAuditSink(cfg.SyslogNetwork, cfg.SyslogAddress)
+			if err != nil {
+				return nil, err
+			}
+			auditLog.sinks = append(auditLog.sinks, sink)
+		default:
+			return nil, fmt.Errorf("unknown audit sink [%s], select from [%s, %s, %s]", name, AuditSinkDB, AuditSinkFile, AuditSinkSyslog)
+		}
+	}
+
+	return auditLog, nil
+}
+
+// Record writes an audit event to every sink, a failing sink doesn't stop the others
+func (a *AuditLog) Record(event AuditEvent) {
+	for _, sink := range a.sinks {
+		if err := sink.Record(event); err != nil {
+			a.Logger.Error().
+				Err(err).
+				Str("AuditEventID", event.ID).
+				Str("Action", event.Action).
+				Msg("Failed to record audit event")
+		}
+	}
+}
+
+// Queryable reports whether audit events are persisted somewhere they can be listed from
+func (a *AuditLog) Queryable() bool {
+	return a != nil && a.storage != nil
+}
+
+// List returns a project's audit events, newest first
+func (a *AuditLog) List(projectID string, query AuditQuery) ([]AuditEvent, error) {
+	if !a.Queryable() {
+		return nil, fmt.Errorf("audit events can only be queried when the %s audit sink is enabled", AuditSinkDB)
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultAuditQueryLimit
+	}
+	if query.Limit > maxAuditQueryLimit {
+		query.Limit = maxAuditQueryLimit
+	}
+	return a.storage.ListAuditEvents(projectID, query)
+}
+
+type dbAuditSink struct {
+	storage AuditStorage
+}
+
+func (s *dbAuditSink) Record(event AuditEvent) error {
+	// Events that couldn't be tied to a project can't be queried, the other sinks still receive them
+	if event.ProjectID == "" {
+		return nil
+	}
+	return s.storage.StoreAuditEvent(event)
+}
+
+type fileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileAuditSink(path string) (*fileAuditSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("an audit file path is required for the %s audit sink", AuditSinkFile)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &fileAuditSink{file: file}, nil
+}
+
+func (s *fileAuditSink) Record(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+type syslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogAuditSink(network, address string) (*syslogAuditSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_NOTICE|syslog.LOG_AUTH, "orra-plan-engine")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogAuditSink{writer: writer}, nil
+}
+
+func (s *syslogAuditSink) Record(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	return s.writer.Notice(string(data))
+}
+
+// auditActor identifies the caller by the ID of its API key, API keys matching none of the project's are unknown
+func auditActor(project *Project, apiKey string) string {
+	if apiKey == "" {
+		return anonymousAuditActor
+	}
+	if project != nil {
+		if key, ok := project.MatchingAPIKey(apiKey); ok {
+			return "apikey:" + key.ID
+		}
+	}
+	return unknownAPIKeyAuditActor
+}
+
+func payloadDigest(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// setAuditProjectID attributes the in-flight audit event to a project,
+// for mutations like project registration where the caller has no API key yet
+func setAuditProjectID(r *http.Request, projectID string) {
+	if event, ok := r.Context().Value(auditContextKey{}).(*AuditEvent); ok {
+		event.ProjectID = projectID
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController flush and extend deadlines through the recorder, streaming responses need it
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// AuditMiddleware records an audit event for the wrapped control plane mutation
+func (app *App) AuditMiddleware(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Audit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Oversized bodies are left for the handler to reject
+		payload, err := io.ReadAll(io.LimitReader(r.Body, MaxRequestBodyBytes+1))
+		if err != nil {
+			logger := app.requestLogger(r)
+			logger.Error().Err(err).Str("Action", action).Msg("Failed to read request body for audit")
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(payload), r.Body))
+
+		principal := principalFromRequest(r)
+		actor := anonymousAuditActor
+		if principal != nil {
+			actor = principal.Actor
+		}
+
+		event := &AuditEvent{
+			ID:            "aud_" + short.New(),
+			Actor:         actor,
+			Action:        action,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			PayloadDigest: payloadDigest(payload),
+			Timestamp:     time.Now().UTC(),
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, event)))
+
+		event.Status = recorder.status
+		if event.ProjectID == "" && principal != nil {
+			if project, err := app.principalProject(principal); err == nil {
+				event.ProjectID = project.ID
+			}
+		}
+
+		app.Audit.Record(*event)
+	}
+}
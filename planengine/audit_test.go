@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog_RecordsControlPlaneMutations(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewAuditLog(Audit{Sinks: []string{AuditSinkDB, AuditSinkFile}, FilePath: auditFile}, app.Db, app.Logger)
+	require.NoError(t, err)
+	app.Audit = auditLog
+
+	body, err := json.Marshal(createTestGroundingSpec(project.ID))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/groundings", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", project.APIKey))
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/register/project", bytes.NewBufferString(`{"name":"other"}`))
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("GET /audit lists the project's events", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", project.APIKey))
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var events []AuditEvent
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+		require.Len(t, events, 1, "events from other projects should not be listed")
+
+		event := events[0]
+		assert.Equal(t, AuditActionGroundingApply, event.Action)
+		assert.Equal(t, project.ID, event.ProjectID)
+		assert.Equal(t, http.StatusCreated, event.Status)
+		assert.Equal(t, payloadDigest(body), event.PayloadDigest)
+		assert.NotContains(t, event.Actor, project.APIKey)
+	})
+
+	t.Run("GET /audit filters by action", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/audit?action="+AuditActionWebhookAdd, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", project.APIKey))
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var events []AuditEvent
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+		assert.Empty(t, events)
+	})
+
+	t.Run("file sink receives every event", func(t *testing.T) {
+		f, err := os.Open(auditFile)
+		require.NoError(t, err)
+		defer f.Close()
+
+		var actions []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var event AuditEvent
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+			actions = append(actions, event.Action)
+		}
+		assert.Equal(t, []string{AuditActionGroundingApply, AuditActionProjectRegister}, actions)
+	})
+}
+
+func TestNewAuditLog_RejectsUnknownSink(t *testing.T) {
+	_, err := NewAuditLog(Audit{Sinks: []string{"kafka"}}, nil, zerolog.New(zerolog.NewTestWriter(t)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func (b *BadgerDB) StoreAuditEvent(event AuditEvent) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		// Keys sort chronologically within a project
+		key := fmt.Sprintf("audit:%s:%020d:%s", event.ProjectID, event.Timestamp.UnixNano(), event.ID)
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit event: %w", err)
+		}
+
+		if err := txn.Set([]byte(key), data); err != nil {
+			return fmt.Errorf("failed to store audit event: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (b *BadgerDB) ListAuditEvents(projectID string, query AuditQuery) ([]AuditEvent, error) {
+	events := make([]AuditEvent, 0)
+	prefix := []byte(fmt.Sprintf("audit:%s:", projectID))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.Reverse = true
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Newest first, so seek past the last key in the prefix
+		for it.Seek(append(prefix, 0xFF)); it.ValidForPrefix(prefix); it.Next() {
+			var event AuditEvent
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &event)
+			}); err != nil {
+				return fmt.Errorf("failed to unmarshal audit event: %w", err)
+			}
+
+			if !query.Since.IsZero() && event.Timestamp.Before(query.Since) {
+				break
+			}
+			if !query.matches(event) {
+				continue
+			}
+
+			events = append(events, event)
+			if query.Limit > 0 && len(events) >= query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,136 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BackpressureError turns away an orchestration the plan engine is too backed up to schedule,
+// callers should resubmit it once RetryAfter has passed.
+type BackpressureError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *BackpressureError) Error() string {
+	return e.Reason
+}
+
+// queuedOrchestrationCount returns how many orchestrations are waiting for a slot across all projects
+func (p *PlanEngine) queuedOrchestrationCount() int {
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	count := 0
+	for _, queue := range p.orchestrationQueues {
+		for _, queued := range queue {
+			// Queues are only pruned as they drain, so skip orchestrations cancelled while waiting
+			if queued.orchestration.Status == Queued {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// serviceBacklogs returns the unfinished tasks of running and queued orchestrations, keyed by service
+func (p *PlanEngine) serviceBacklogs() map[string]int {
+	p.orchestrationStoreMu.RLock()
+	plans := make(map[string]*ExecutionPlan, len(p.runningOrchestrations))
+	for orchestrationID := range p.runningOrchestrations {
+		if orchestration, exists := p.orchestrationStore[orchestrationID]; exists && orchestration.Plan != nil {
+			plans[orchestrationID] = orchestration.Plan
+		}
+	}
+	for _, queue := range p.orchestrationQueues {
+		for _, queued := range queue {
+			if queued.orchestration.Status == Queued && queued.orchestration.Plan != nil {
+				plans[queued.orchestration.ID] = queued.orchestration.Plan
+			}
+		}
+	}
+	p.orchestrationStoreMu.RUnlock()
+
+	return p.LogManager.UnfinishedServiceTasks(plans)
+}
+
+// UnfinishedServiceTasks counts the service tasks of the given plans that have yet to finish, keyed by service.
+// Plans without a log yet haven't started, so all their service tasks count.
+func (lm *LogManager) UnfinishedServiceTasks(plans map[string]*ExecutionPlan) map[string]int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for orchestrationID, plan := range plans {
+		var statuses map[string]Status
+		if state, ok := lm.orchestrations[orchestrationID]; ok {
+			statuses = state.TasksStatuses
+		}
+		for _, task := range plan.Tasks {
+			if task.Type != "" || task.Service == "" {
+				continue
+			}
+			if status := statuses[task.ID]; status == Skipped || orchestrationFinished(status) {
+				continue
+			}
+			counts[task.Service]++
+		}
+	}
+	return counts
+}
+
+// checkQueueBackpressure turns away new orchestrations while too many are already waiting for a slot
+func (app *App) checkQueueBackpressure() error {
+	limit := app.Cfg.Backpressure.MaxQueuedOrchestrations
+	if limit <= 0 {
+		return nil
+	}
+
+	if queued := app.Engine.queuedOrchestrationCount(); queued >= limit {
+		return &BackpressureError{
+			Reason:     fmt.Sprintf("execution queue is full with %d orchestrations waiting to start", queued),
+			RetryAfter: app.Cfg.Backpressure.RetryAfter,
+		}
+	}
+	return nil
+}
+
+// checkServiceBackpressure turns away a prepared orchestration if any service of its plan already has too many unfinished tasks
+func (app *App) checkServiceBackpressure(orchestration *Orchestration) error {
+	limit := app.Cfg.Backpressure.MaxServiceBacklog
+	if limit <= 0 || orchestration.Plan == nil {
+		return nil
+	}
+
+	backlogs := app.Engine.serviceBacklogs()
+	var saturated []string
+	seen := make(map[string]struct{})
+	for _, task := range orchestration.Plan.Tasks {
+		if task.Type != "" || task.Service == "" {
+			continue
+		}
+		if _, ok := seen[task.Service]; ok {
+			continue
+		}
+		seen[task.Service] = struct{}{}
+		if backlogs[task.Service] >= limit {
+			saturated = append(saturated, task.Service)
+		}
+	}
+	if len(saturated) == 0 {
+		return nil
+	}
+
+	sort.Strings(saturated)
+	return &BackpressureError{
+		Reason:     fmt.Sprintf("services %v each have %d or more unfinished tasks", saturated, limit),
+		RetryAfter: app.Cfg.Backpressure.RetryAfter,
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueBackpressure(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.RootCtx = context.Background()
+	app.Cfg.Backpressure = Backpressure{MaxQueuedOrchestrations: 1, RetryAfter: 45 * time.Second}
+	project.Webhooks = []string{"http://localhost/webhook"}
+
+	waiting := &Orchestration{ID: "o_waiting", ProjectID: project.ID, Status: Queued}
+	app.Engine.orchestrationQueues[project.ID] = []queuedOrchestration{{ctx: context.Background(), orchestration: waiting}}
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("rejects orchestrations while the queue is full", func(t *testing.T) {
+		w := submit(`{"action":{"type":"user","content":"Echo"},"webhook":"http://localhost/webhook"}`)
+		require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+		assert.Equal(t, "45", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), ExecutionBacklogFullErrCode)
+	})
+
+	t.Run("accepts orchestrations deferred until later", func(t *testing.T) {
+		runAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		w := submit(fmt.Sprintf(`{"action":{"type":"user","content":"Echo"},"webhook":"http://localhost/webhook","runAt":%q}`, runAt))
+		assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	})
+
+	t.Run("ignores orchestrations cancelled while queued", func(t *testing.T) {
+		waiting.Status = Cancelled
+		assert.NoError(t, app.checkQueueBackpressure())
+	})
+}
+
+func TestServiceBackpressure(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	app.Cfg.Backpressure = Backpressure{MaxServiceBacklog: 2, RetryAfter: time.Minute}
+
+	running := &Orchestration{
+		ID:        "o_running",
+		ProjectID: project.ID,
+		Status:    Processing,
+		Plan: &ExecutionPlan{Tasks: []*SubTask{
+			{ID: "task1", Service: "s_echo"},
+			{ID: "task2", Service: "s_echo"},
+			{ID: "approval_task3", Type: TaskTypeApproval},
+			{ID: "task3", Service: "s_audit"},
+		}},
+	}
+	app.Engine.orchestrationStore[running.ID] = running
+	app.Engine.runningOrchestrations[running.ID] = project.ID
+	logManager.PrepLogForOrchestration(project.ID, running.ID, running.Plan)
+
+	incoming := &Orchestration{
+		ProjectID: project.ID,
+		Plan:      &ExecutionPlan{Tasks: []*SubTask{{ID: "task1", Service: "s_audit"}, {ID: "task2", Service: "s_echo"}}},
+	}
+
+	err = app.checkServiceBackpressure(incoming)
+	var backpressure *BackpressureError
+	require.ErrorAs(t, err, &backpressure)
+	assert.Equal(t, time.Minute, backpressure.RetryAfter)
+	assert.Contains(t, backpressure.Reason, "s_echo")
+	assert.NotContains(t, backpressure.Reason, "s_audit")
+
+	require.NoError(t, logManager.MarkTaskCompleted(running.ID, "task1", time.Now().UTC()))
+	assert.NoError(t, app.checkServiceBackpressure(incoming))
+}
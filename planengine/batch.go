@@ -0,0 +1,156 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	MaxBatchOrchestrations = 100
+	// batchPreparationParallelism caps how many of a batch's orchestrations are planned at once
+	batchPreparationParallelism = 8
+)
+
+var batchFields = []string{"orchestrations"}
+
+// BatchOrchestrationResult reports what became of one orchestration of a batch
+type BatchOrchestrationResult struct {
+	Index         int                `json:"index"`
+	Accepted      bool               `json:"accepted"`
+	Orchestration *Orchestration     `json:"orchestration,omitempty"`
+	Error         *errs.ServiceError `json:"error,omitempty"`
+}
+
+// BatchOrchestrationResponse holds a result per submitted orchestration, in submission order
+type BatchOrchestrationResponse struct {
+	Accepted int                        `json:"accepted"`
+	Failed   int                        `json:"failed"`
+	Results  []BatchOrchestrationResult `json:"results"`
+}
+
+// batchOrchestrationRequest holds orchestrations submitted together, each defined in full or from a template
+type batchOrchestrationRequest struct {
+	Orchestrations []json.RawMessage `json:"orchestrations"`
+}
+
+// BatchOrchestrationsHandler submits several orchestrations in one request. Each is validated, rate limited
+// and submitted on its own, so one failing leaves the others accepted.
+func (app *App) BatchOrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	var request batchOrchestrationRequest
+	if err := decodeRequest(w, r, &request, batchFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	switch {
+	case len(request.Orchestrations) == 0:
+		httpErrorResponse(w, app.requestLogger(r), missingField("orchestrations"))
+		return
+	case len(request.Orchestrations) > MaxBatchOrchestrations:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("orchestrations"), fmt.Sprintf("at most %d orchestrations can be submitted in a batch", MaxBatchOrchestrations)))
+		return
+	}
+
+	results := make([]BatchOrchestrationResult, len(request.Orchestrations))
+	orchestrations := make([]*Orchestration, len(request.Orchestrations))
+	for i, body := range request.Orchestrations {
+		results[i].Index = i
+		orchestration, err := app.decodeBatchedOrchestration(r, body, project.ID)
+		if err != nil {
+			results[i].Error = batchServiceError(err)
+			continue
+		}
+		orchestrations[i] = orchestration
+	}
+
+	slots := make(chan struct{}, batchPreparationParallelism)
+	var wg sync.WaitGroup
+	for i, orchestration := range orchestrations {
+		if orchestration == nil {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, orchestration *Orchestration) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := app.submitOrchestration(project.ID, orchestration); err != nil {
+				results[i].Error = batchServiceError(err)
+				return
+			}
+			results[i].Accepted = true
+			results[i].Orchestration = orchestration
+		}(i, orchestration)
+	}
+	wg.Wait()
+
+	response := BatchOrchestrationResponse{Results: results}
+	for _, result := range results {
+		if result.Accepted {
+			response.Accepted++
+		} else {
+			response.Failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// decodeBatchedOrchestration decodes and validates one orchestration of a batch, taking its rate limit token
+func (app *App) decodeBatchedOrchestration(r *http.Request, body json.RawMessage, projectID string) (*Orchestration, error) {
+	orchestration, err := app.decodeOrchestrationBody(body, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOrchestrationRequest(orchestration); err != nil {
+		return nil, err
+	}
+	if orchestration.DryRun {
+		return nil, errs.E(errs.Validation, errs.Parameter("dryRun"), "dry runs cannot be batched")
+	}
+
+	if principal := principalFromRequest(r); app.Limiter != nil && principal != nil && principal.RateLimitKey != "" {
+		if decision := app.Limiter.AllowOrchestration(principal.RateLimitKey); !decision.Allowed {
+			return nil, errs.E(errs.Invalid, errs.Code(RateLimitExceededErrCode), fmt.Sprintf("orchestration rate limit exceeded, retry after %s", decision.RetryAfter))
+		}
+	}
+	return orchestration, nil
+}
+
+// batchServiceError describes a batched orchestration's failure like errs.HTTPErrorResponse would
+func batchServiceError(err error) *errs.ServiceError {
+	var backpressure *BackpressureError
+	if errors.As(err, &backpressure) {
+		return &errs.ServiceError{Kind: "too many requests", Code: ExecutionBacklogFullErrCode, Message: backpressure.Error()}
+	}
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		return &errs.ServiceError{Kind: errs.Unanticipated.String(), Message: err.Error()}
+	}
+	if e.Kind == errs.Internal || e.Kind == errs.Database {
+		return &errs.ServiceError{Kind: errs.Internal.String(), Message: "internal server error - please contact support"}
+	}
+	return &errs.ServiceError{Kind: e.Kind.String(), Code: string(e.Code), Param: string(e.Param), Message: e.Error()}
+}
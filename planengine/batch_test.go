@@ -0,0 +1,82 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchOrchestrations(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.RootCtx = context.Background()
+	project.Webhooks = []string{"http://localhost/webhook"}
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/batch", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	runAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w := submit(fmt.Sprintf(`{"orchestrations":[
+		{"action":{"content":"Echo one"},"webhook":"http://localhost/webhook","runAt":%[1]q},
+		{"action":{"content":"Echo two"}},
+		{"action":{"content":"Echo three"},"webhook":"http://localhost/webhook","dryRun":true},
+		{"action":{"content":"Echo four"},"webhook":"http://localhost/webhook","runAt":%[1]q}
+	]}`, runAt))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response BatchOrchestrationResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, 2, response.Accepted)
+	assert.Equal(t, 2, response.Failed)
+	require.Len(t, response.Results, 4)
+
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+	}
+	assert.True(t, response.Results[0].Accepted)
+	require.NotNil(t, response.Results[0].Orchestration)
+	assert.Equal(t, Scheduled, response.Results[0].Orchestration.Status)
+	assert.Contains(t, app.Engine.orchestrationStore, response.Results[0].Orchestration.ID)
+
+	assert.False(t, response.Results[1].Accepted)
+	require.NotNil(t, response.Results[1].Error)
+	assert.Equal(t, MissingRequiredFieldErrCode, response.Results[1].Error.Code)
+	assert.Equal(t, "webhook", response.Results[1].Error.Param)
+
+	require.NotNil(t, response.Results[2].Error)
+	assert.Equal(t, "dryRun", response.Results[2].Error.Param)
+
+	assert.True(t, response.Results[3].Accepted)
+
+	t.Run("empty batch is rejected", func(t *testing.T) {
+		w := submit(`{"orchestrations":[]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("oversized batch is rejected", func(t *testing.T) {
+		items := strings.Repeat(`{"action":{"content":"Echo"},"webhook":"http://localhost/webhook"},`, MaxBatchOrchestrations+1)
+		w := submit(`{"orchestrations":[` + strings.TrimSuffix(items, ",") + `]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
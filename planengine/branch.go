@@ -0,0 +1,243 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+const ConditionProducerID = "condition"
+
+type ConditionOperator string
+
+const (
+	OperatorEqual          ConditionOperator = "eq"
+	OperatorNotEqual       ConditionOperator = "ne"
+	OperatorLessThan       ConditionOperator = "lt"
+	OperatorLessOrEqual    ConditionOperator = "lte"
+	OperatorGreaterThan    ConditionOperator = "gt"
+	OperatorGreaterOrEqual ConditionOperator = "gte"
+)
+
+var conditionOperators = []ConditionOperator{
+	OperatorEqual,
+	OperatorNotEqual,
+	OperatorLessThan,
+	OperatorLessOrEqual,
+	OperatorGreaterThan,
+	OperatorGreaterOrEqual,
+}
+
+// Branch runs some services only when a condition on an earlier service's output holds, and others when it doesn't
+type Branch struct {
+	When Condition `json:"when"`
+	// Then lists the IDs or names of services run when the condition holds
+	Then []string `json:"then"`
+	// Else lists the IDs or names of services run when it doesn't
+	Else []string `json:"else,omitempty"`
+}
+
+// Condition compares a field of a service's output against a value
+type Condition struct {
+	Service  string            `json:"service"`
+	Field    string            `json:"field"`
+	Operator ConditionOperator `json:"operator"`
+	Value    any               `json:"value"`
+}
+
+func (b Branch) Validate() error {
+	if strings.TrimSpace(b.When.Service) == "" {
+		return errors.New("when.service is required")
+	}
+	if strings.TrimSpace(b.When.Field) == "" {
+		return errors.New("when.field is required")
+	}
+	if !slices.Contains(conditionOperators, b.When.Operator) {
+		return fmt.Errorf("unknown operator %q", b.When.Operator)
+	}
+	if len(b.Then) == 0 && len(b.Else) == 0 {
+		return errors.New("a branch needs then or else services")
+	}
+	return nil
+}
+
+// TaskCondition decides whether a planned task runs, based on the output of the task it depends on
+type TaskCondition struct {
+	Source   string            `json:"source"`
+	Field    string            `json:"field"`
+	Operator ConditionOperator `json:"operator"`
+	Value    any               `json:"value"`
+	// Negate is set for tasks on a branch's else side
+	Negate bool `json:"negate,omitempty"`
+}
+
+// addBranchConditions puts a condition on the tasks of every branch's services. Branches whose condition
+// service wasn't planned are left out. Tasks may be shared with the plan cache, so they're copied rather than changed.
+func addBranchConditions(plan *ExecutionPlan, branches []Branch) *ExecutionPlan {
+	if len(branches) == 0 {
+		return plan
+	}
+
+	conditioned := *plan
+	conditioned.Tasks = make([]*SubTask, 0, len(plan.Tasks))
+	for _, task := range plan.Tasks {
+		condition := branchConditionFor(task, plan.Tasks, branches)
+		if condition == nil {
+			conditioned.Tasks = append(conditioned.Tasks, task)
+			continue
+		}
+
+		branched := *task
+		branched.Condition = condition
+		conditioned.Tasks = append(conditioned.Tasks, &branched)
+	}
+	return &conditioned
+}
+
+func branchConditionFor(task *SubTask, tasks []*SubTask, branches []Branch) *TaskCondition {
+	for _, branch := range branches {
+		negate := false
+		switch {
+		case matchesAnyService(task, branch.Then):
+		case matchesAnyService(task, branch.Else):
+			negate = true
+		default:
+			continue
+		}
+
+		for _, source := range tasks {
+			if source.ID == task.ID || !matchesService(source, branch.When.Service) {
+				continue
+			}
+			return &TaskCondition{
+				Source:   source.ID,
+				Field:    branch.When.Field,
+				Operator: branch.When.Operator,
+				Value:    branch.When.Value,
+				Negate:   negate,
+			}
+		}
+	}
+	return nil
+}
+
+func matchesService(task *SubTask, service string) bool {
+	return strings.EqualFold(service, task.Service) || strings.EqualFold(service, task.ServiceName)
+}
+
+func matchesAnyService(task *SubTask, services []string) bool {
+	return slices.ContainsFunc(services, func(service string) bool {
+		return matchesService(task, service)
+	})
+}
+
+// Met evaluates the condition against its source task's output, a missing field never meets it
+func (c *TaskCondition) Met(output json.RawMessage) (bool, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(output, &fields); err != nil {
+		return false, fmt.Errorf("failed to unmarshal output of task %s: %w", c.Source, err)
+	}
+
+	actual, exists := fields[c.Field]
+	if !exists {
+		return c.Negate, nil
+	}
+
+	met, err := compareConditionValues(actual, c.Operator, c.Value)
+	if err != nil {
+		return false, fmt.Errorf("cannot evaluate %s.%s: %w", c.Source, c.Field, err)
+	}
+	return met != c.Negate, nil
+}
+
+func compareConditionValues(actual any, operator ConditionOperator, expected any) (bool, error) {
+	switch operator {
+	case OperatorEqual:
+		return reflect.DeepEqual(actual, expected), nil
+	case OperatorNotEqual:
+		return !reflect.DeepEqual(actual, expected), nil
+	}
+
+	var order int
+	switch a := actual.(type) {
+	case float64:
+		e, ok := expected.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare number with %T", expected)
+		}
+		order = compareOrdered(a, e)
+	case string:
+		e, ok := expected.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare string with %T", expected)
+		}
+		order = compareOrdered(a, e)
+	default:
+		return false, fmt.Errorf("cannot order values of type %T", actual)
+	}
+
+	switch operator {
+	case OperatorLessThan:
+		return order < 0, nil
+	case OperatorLessOrEqual:
+		return order <= 0, nil
+	case OperatorGreaterThan:
+		return order > 0, nil
+	case OperatorGreaterOrEqual:
+		return order >= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", operator)
+}
+
+func compareOrdered[T float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// skipUnlessConditionMet skips a conditional task whose condition doesn't hold, reporting whether it was skipped.
+// Skipped tasks log an empty output so the tasks depending on them carry on without their inputs.
+func (w *TaskWorker) skipUnlessConditionMet(orchestrationID string) (bool, error) {
+	if w.Condition == nil {
+		return false, nil
+	}
+
+	met, err := w.Condition.Met(w.logState.DependencyState[w.Condition.Source])
+	if err != nil {
+		failedTs := time.Now().UTC()
+		if err := w.LogManager.AppendTaskStatusEvent(orchestrationID, w.TaskID, w.Service.ID, Failed, err, failedTs, 0); err != nil {
+			return true, err
+		}
+		if err := w.LogManager.MarkTask(orchestrationID, w.TaskID, Failed, failedTs); err != nil {
+			return true, err
+		}
+		return true, w.LogManager.AppendTaskFailureToLog(orchestrationID, w.TaskID, w.Service.ID, err.Error(), 0, false)
+	}
+	if met {
+		return false, nil
+	}
+
+	skippedTs := time.Now().UTC()
+	if err := w.LogManager.AppendTaskStatusEvent(orchestrationID, w.TaskID, w.Service.ID, Skipped, nil, skippedTs, 0); err != nil {
+		return true, err
+	}
+	if err := w.LogManager.MarkTask(orchestrationID, w.TaskID, Skipped, skippedTs); err != nil {
+		return true, err
+	}
+	w.LogManager.AppendToLog(orchestrationID, "task_output", w.TaskID, json.RawMessage(`{}`), ConditionProducerID, 0)
+	return true, nil
+}
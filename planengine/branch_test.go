@@ -0,0 +1,77 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddBranchConditions(t *testing.T) {
+	refund := &SubTask{ID: "task2", Service: "s_refund", ServiceName: "Refund Agent", Input: map[string]any{"order": "$task0.order"}}
+	plan := &ExecutionPlan{
+		ProjectID: "p_test",
+		Tasks: []*SubTask{
+			{ID: "task1", Service: "s_fraud", ServiceName: "Fraud Checker", Input: map[string]any{"order": "$task0.order"}},
+			refund,
+			{ID: "task3", Service: "s_review", ServiceName: "Manual Review", Input: map[string]any{"order": "$task0.order"}},
+			{ID: "task4", Service: "s_notify", ServiceName: "Notifier", Input: map[string]any{"order": "$task0.order"}},
+		},
+	}
+
+	branched := addBranchConditions(plan, []Branch{{
+		When: Condition{Service: "fraud checker", Field: "score", Operator: OperatorLessThan, Value: 0.3},
+		Then: []string{"Refund Agent"},
+		Else: []string{"s_review"},
+	}})
+
+	require.Len(t, branched.Tasks, 4)
+	assert.Nil(t, branched.Tasks[0].Condition)
+	assert.Equal(t, &TaskCondition{Source: "task1", Field: "score", Operator: OperatorLessThan, Value: 0.3}, branched.Tasks[1].Condition)
+	assert.True(t, branched.Tasks[2].Condition.Negate, "else tasks run when the condition doesn't hold")
+	assert.Nil(t, branched.Tasks[3].Condition)
+	assert.Nil(t, refund.Condition, "planned tasks are left untouched")
+
+	assert.Contains(t, branched.Tasks[1].extractDependencies(), "task1", "conditional tasks wait for their condition's source")
+	assert.Same(t, plan, addBranchConditions(plan, nil))
+}
+
+func TestTaskConditionMet(t *testing.T) {
+	output := json.RawMessage(`{"score":0.2,"verdict":"clean","flags":["new_account"]}`)
+
+	tests := []struct {
+		name      string
+		condition TaskCondition
+		want      bool
+		wantErr   bool
+	}{
+		{"number less than", TaskCondition{Field: "score", Operator: OperatorLessThan, Value: 0.3}, true, false},
+		{"number greater or equal", TaskCondition{Field: "score", Operator: OperatorGreaterOrEqual, Value: 0.3}, false, false},
+		{"string equal", TaskCondition{Field: "verdict", Operator: OperatorEqual, Value: "clean"}, true, false},
+		{"string not equal", TaskCondition{Field: "verdict", Operator: OperatorNotEqual, Value: "clean"}, false, false},
+		{"else branch negates", TaskCondition{Field: "score", Operator: OperatorLessThan, Value: 0.3, Negate: true}, false, false},
+		{"missing field never holds", TaskCondition{Field: "risk", Operator: OperatorEqual, Value: "low"}, false, false},
+		{"missing field runs the else branch", TaskCondition{Field: "risk", Operator: OperatorEqual, Value: "low", Negate: true}, true, false},
+		{"mismatched types", TaskCondition{Field: "score", Operator: OperatorLessThan, Value: "high"}, false, true},
+		{"unordered values", TaskCondition{Field: "flags", Operator: OperatorGreaterThan, Value: 1.0}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			met, err := tt.condition.Met(output)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, met)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	BudgetActionAbort = "abort"
+	BudgetActionPause = "pause"
+)
+
+// Budget caps the tokens and cost an orchestration may consume, as reported by the services running its tasks
+type Budget struct {
+	MaxCostUSD float64 `json:"maxCostUSD,omitempty"`
+	MaxTokens  int     `json:"maxTokens,omitempty"`
+	// OnExceeded either aborts the orchestration (the default) or pauses it until it's resumed
+	OnExceeded string `json:"onExceeded,omitempty"`
+}
+
+func (b *Budget) Validate() error {
+	if b == nil {
+		return nil
+	}
+	switch {
+	case b.MaxCostUSD < 0 || b.MaxTokens < 0:
+		return errors.New("maxCostUSD and maxTokens cannot be negative")
+	case b.MaxCostUSD == 0 && b.MaxTokens == 0:
+		return errors.New("maxCostUSD or maxTokens is required")
+	}
+	switch b.OnExceeded {
+	case "", BudgetActionAbort, BudgetActionPause:
+		return nil
+	}
+	return fmt.Errorf("onExceeded must be %s or %s", BudgetActionAbort, BudgetActionPause)
+}
+
+// exceededBy describes how the usage goes over the budget, it's empty while the usage is within it
+func (b *Budget) exceededBy(usage OrchestrationUsage) string {
+	switch {
+	case b.MaxTokens > 0 && usage.Tokens > b.MaxTokens:
+		return fmt.Sprintf("%d tokens used of a %d token budget", usage.Tokens, b.MaxTokens)
+	case b.MaxCostUSD > 0 && usage.CostUSD > b.MaxCostUSD:
+		return fmt.Sprintf("$%.4f spent of a $%.4f budget", usage.CostUSD, b.MaxCostUSD)
+	}
+	return ""
+}
+
+// TaskUsage is what a task consumed, services report it alongside their result. Tokens defaults to the
+// sum of the prompt and completion tokens when a service only reports those.
+type TaskUsage struct {
+	Tokens           int     `json:"tokens,omitempty"`
+	CostUSD          float64 `json:"costUSD,omitempty"`
+	PromptTokens     int     `json:"promptTokens,omitempty"`
+	CompletionTokens int     `json:"completionTokens,omitempty"`
+}
+
+// OrchestrationUsage totals the usage reported by an orchestration's tasks, which its budget caps
+type OrchestrationUsage struct {
+	Tokens         int     `json:"tokens"`
+	CostUSD        float64 `json:"costUSD"`
+	BudgetExceeded bool    `json:"budgetExceeded,omitempty"`
+	// PromptTokens and CompletionTokens split Tokens, when the tasks' services report them
+	PromptTokens     int `json:"promptTokens,omitempty"`
+	CompletionTokens int `json:"completionTokens,omitempty"`
+	// Planning is the LLM usage of planning the orchestration, it isn't capped by the budget
+	Planning *PlanningUsage `json:"planning,omitempty"`
+}
+
+// recordTaskUsage adds a task's reported usage to its orchestration and enforces the orchestration's budget.
+// A budget is only enforced once, resuming an orchestration paused over its budget lets it run to the end.
+func (p *PlanEngine) recordTaskUsage(orchestrationID, taskID string, usage *TaskUsage) {
+	if usage == nil {
+		return
+	}
+	reported := taskLLMUsage(usage)
+	if reported.Tokens == 0 && reported.CostUSD == 0 {
+		return
+	}
+
+	p.orchestrationStoreMu.Lock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		p.orchestrationStoreMu.Unlock()
+		return
+	}
+	if orchestration.Usage == nil {
+		orchestration.Usage = &OrchestrationUsage{}
+	}
+	orchestration.Usage.Tokens += reported.Tokens
+	orchestration.Usage.CostUSD += reported.CostUSD
+	orchestration.Usage.PromptTokens += reported.PromptTokens
+	orchestration.Usage.CompletionTokens += reported.CompletionTokens
+	projectID := orchestration.ProjectID
+
+	var exceeded string
+	if orchestration.Budget != nil && !orchestration.Usage.BudgetExceeded {
+		exceeded = orchestration.Budget.exceededBy(*orchestration.Usage)
+		orchestration.Usage.BudgetExceeded = exceeded != ""
+	}
+	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Failed to persist orchestration usage")
+	}
+	if exceeded == "" {
+		p.orchestrationStoreMu.Unlock()
+		p.addProjectUsage(projectID, DailyUsage{Tasks: reported})
+		return
+	}
+	budget, total := *orchestration.Budget, *orchestration.Usage
+	p.orchestrationStoreMu.Unlock()
+	p.addProjectUsage(projectID, DailyUsage{Tasks: reported})
+
+	p.Logger.Warn().
+		Str("OrchestrationID", orchestrationID).
+		Str("TaskID", taskID).
+		Msgf("Orchestration exceeded its budget, %s", exceeded)
+
+	action := budget.OnExceeded
+	if action == "" {
+		action = BudgetActionAbort
+	}
+	if project, err := p.GetProjectByID(projectID); err == nil {
+		p.notifyInBackground(func() {
+			p.notifyOrchestrationEvent(project, orchestrationID, ProjectEventBudgetExceeded, map[string]any{
+				"orchestrationId": orchestrationID,
+				"taskId":          taskID,
+				"budget":          budget,
+				"usage":           total,
+				"action":          action,
+			})
+		})
+	}
+
+	if action == BudgetActionPause {
+		if _, err := p.PauseOrchestration(orchestrationID); err != nil {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Cannot pause orchestration over its budget")
+		}
+		return
+	}
+	if _, err := p.AbortOrchestration(orchestrationID, "budget exceeded: "+exceeded); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Cannot abort orchestration over its budget")
+	}
+}
+
+// orchestrationUsage copies an orchestration's usage so far, it's nil until a task reports any
+func (p *PlanEngine) orchestrationUsage(orchestrationID string) *OrchestrationUsage {
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists || orchestration.Usage == nil {
+		return nil
+	}
+	usage := *orchestration.Usage
+	if usage.Planning != nil {
+		planning := *usage.Planning
+		usage.Planning = &planning
+	}
+	return &usage
+}
@@ -0,0 +1,89 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  *Budget
+		wantErr bool
+	}{
+		{"no budget", nil, false},
+		{"token budget", &Budget{MaxTokens: 1000}, false},
+		{"cost budget that pauses", &Budget{MaxCostUSD: 2.5, OnExceeded: BudgetActionPause}, false},
+		{"no limits", &Budget{OnExceeded: BudgetActionAbort}, true},
+		{"negative limit", &Budget{MaxTokens: 100, MaxCostUSD: -1}, true},
+		{"unknown action", &Budget{MaxTokens: 100, OnExceeded: "ignore"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.budget.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRecordTaskUsage(t *testing.T) {
+	t.Run("usage is totalled within the budget", func(t *testing.T) {
+		app, project, cleanup := setupTestApp(t)
+		defer cleanup()
+
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Budget = &Budget{MaxTokens: 1000, MaxCostUSD: 1}
+
+		app.Engine.recordTaskUsage(orchestration.ID, "task1", &TaskUsage{Tokens: 300, CostUSD: 0.25})
+		app.Engine.recordTaskUsage(orchestration.ID, "task2", &TaskUsage{Tokens: 200, CostUSD: 0.25})
+		app.Engine.recordTaskUsage(orchestration.ID, "task2", nil)
+
+		assert.Equal(t, &OrchestrationUsage{Tokens: 500, CostUSD: 0.5}, app.Engine.orchestrationUsage(orchestration.ID))
+		assert.Equal(t, Processing, orchestration.Status)
+	})
+
+	t.Run("exceeding the budget aborts by default", func(t *testing.T) {
+		app, project, cleanup := setupTestApp(t)
+		defer cleanup()
+
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Budget = &Budget{MaxTokens: 1000}
+
+		app.Engine.recordTaskUsage(orchestration.ID, "task1", &TaskUsage{Tokens: 1200})
+
+		assert.Equal(t, Cancelled, orchestration.Status)
+		assert.Contains(t, string(orchestration.Error), "budget exceeded")
+		assert.True(t, orchestration.Usage.BudgetExceeded)
+	})
+
+	t.Run("exceeding the budget pauses once when asked to", func(t *testing.T) {
+		app, project, cleanup := setupTestApp(t)
+		defer cleanup()
+
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Budget = &Budget{MaxCostUSD: 1, OnExceeded: BudgetActionPause}
+
+		app.Engine.recordTaskUsage(orchestration.ID, "task1", &TaskUsage{CostUSD: 1.5})
+		require.Equal(t, Paused, orchestration.Status)
+
+		_, err := app.Engine.ResumeOrchestration(orchestration.ID)
+		require.NoError(t, err)
+
+		app.Engine.recordTaskUsage(orchestration.ID, "task2", &TaskUsage{CostUSD: 1})
+		assert.Equal(t, Processing, orchestration.Status, "resuming approves going over the budget")
+		assert.InDelta(t, 2.5, app.Engine.orchestrationUsage(orchestration.ID).CostUSD, 0.0001)
+	})
+}
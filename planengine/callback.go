@@ -0,0 +1,335 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	callbackSessionBufferSize = 256
+	callbackRequestTimeout    = 10 * time.Second
+)
+
+// Message types a callback service's endpoint receives, everything else only makes sense over a live connection
+var callbackMessageTypes = []string{"task_request", "compensation_request", "task_cancellation"}
+
+// Message types a callback service may post back to the plan engine
+var callbackReportTypes = []string{WSTaskAck, WSTaskHeartbeat, "task_status", "task_interim_result", "task_result"}
+
+// ErrPrivateEndpoint is returned when a callback would be posted to an address that isn't public
+var ErrPrivateEndpoint = errors.New("endpoint must be a public address")
+
+// ConnectCallbackService connects a service registered with an HTTPS endpoint through a callback session,
+// so it's sent tasks like any connected service without holding a connection to the plan engine.
+// The service's callback session is replaced when its endpoint or secret changes and closed when the endpoint
+// is removed.
+func (wsm *WebSocketManager) ConnectCallbackService(service *ServiceInfo) {
+	existing := wsm.callbackSession(service.ID)
+	if existing != nil && existing.endpoint == service.Endpoint && existing.secret == service.EndpointSecret {
+		return
+	}
+	if service.Endpoint != "" {
+		session := newCallbackSession(wsm, service)
+		session.Set("projectID", service.ProjectID)
+		wsm.HandleConnection(service.ID, service.Name, session)
+	}
+	if existing != nil {
+		_ = existing.Close()
+	}
+}
+
+// callbackSession returns the service's callback session, if it's registered with an endpoint
+func (wsm *WebSocketManager) callbackSession(serviceID string) *callbackSession {
+	for _, s := range wsm.instanceSessions(serviceID) {
+		if session, ok := s.(*callbackSession); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+// callbackSession adapts a service's HTTPS endpoint to a serviceSession. Tasks and cancellations are posted to the
+// endpoint in the order they're sent, the service posts its results back to its callback route.
+type callbackSession struct {
+	wsm       *WebSocketManager
+	serviceID string
+	endpoint  string
+	secret    string
+	outbound  chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	keys      map[string]any
+	keysMu    sync.RWMutex
+}
+
+func newCallbackSession(wsm *WebSocketManager, service *ServiceInfo) *callbackSession {
+	s := &callbackSession{
+		wsm:       wsm,
+		serviceID: service.ID,
+		endpoint:  service.Endpoint,
+		secret:    service.EndpointSecret,
+		outbound:  make(chan []byte, callbackSessionBufferSize),
+		done:      make(chan struct{}),
+		keys:      make(map[string]any),
+	}
+	go s.postMessages()
+	return s
+}
+
+// Write queues a message for the service's endpoint. An endpoint can't answer pings, so the session answers them
+// itself, a service is only considered unreachable once posting to it fails.
+func (s *callbackSession) Write(message []byte) error {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return fmt.Errorf("failed to read message type: %w", err)
+	}
+	if envelope.Type == WSPing {
+		s.Set("lastPong", time.Now().UTC())
+		return nil
+	}
+	if !slices.Contains(callbackMessageTypes, envelope.Type) {
+		return nil
+	}
+
+	select {
+	case <-s.done:
+		return fmt.Errorf("callback session for service %s is closed", s.serviceID)
+	default:
+	}
+	select {
+	case s.outbound <- message:
+		return nil
+	default:
+		return fmt.Errorf("callback session message buffer is full")
+	}
+}
+
+// Close stops posting to the endpoint, as there's no socket to close the WebSocketManager is told directly
+func (s *callbackSession) Close() error {
+	closed := false
+	s.closeOnce.Do(func() {
+		close(s.done)
+		closed = true
+	})
+	if closed {
+		s.wsm.HandleDisconnection(s.serviceID, s)
+	}
+	return nil
+}
+
+func (s *callbackSession) queued() int {
+	return len(s.outbound)
+}
+
+func (s *callbackSession) Get(key string) (any, bool) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+func (s *callbackSession) Set(key string, value any) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.keys[key] = value
+}
+
+func (s *callbackSession) postMessages() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case message := <-s.outbound:
+			s.post(message)
+		}
+	}
+}
+
+// post sends a message to the service's endpoint. Accepted tasks count as acknowledged, tasks the endpoint
+// fails to accept are left for the WebSocketManager to redeliver.
+func (s *callbackSession) post(message []byte) {
+	var task struct {
+		Type       string `json:"type"`
+		DeliveryID string `json:"deliveryId"`
+	}
+	_ = json.Unmarshal(message, &task)
+
+	if err := s.wsm.postCallback(s.endpoint, s.secret, message); err != nil {
+		s.wsm.logger.Warn().
+			Err(err).
+			Str("ServiceID", s.serviceID).
+			Str("Type", task.Type).
+			Msg("Failed to post message to service endpoint")
+		return
+	}
+	if task.DeliveryID != "" {
+		s.wsm.acknowledgeDelivery(s.serviceID, task.DeliveryID, "")
+	}
+}
+
+// postCallback posts a JSON message to a service endpoint, signed with the service's endpoint secret like webhook
+// deliveries are. Any non 2xx response is an error.
+func (wsm *WebSocketManager) postCallback(endpoint, secret string, message []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Orra/1.0")
+	if secret != "" {
+		req.Header.Set(WebhookSignatureHeader, signWebhookPayload([]string{secret}, time.Now().UTC(), message))
+	}
+
+	resp, err := wsm.callbackClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		_, _ = io.Copy(io.Discard, Body)
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// isPublicAddress reports whether callbacks may be posted to an IP, i.e. it isn't one of the plan engine's own
+// or its network's addresses
+func isPublicAddress(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// newCallbackClient returns the client callbacks are posted with. It refuses to connect to addresses that aren't
+// public, whatever the endpoint's host resolves to when it's posted to.
+func newCallbackClient() *http.Client {
+	client := newAddressCheckedClient(isPublicAddress)
+	client.Timeout = callbackRequestTimeout
+	return client
+}
+
+// newAddressCheckedClient returns a client that only connects to the addresses allowed. Addresses are checked when
+// they're dialled, so hosts resolving to other addresses than they did when checked are refused too.
+func newAddressCheckedClient(allowed func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !allowed(net.ParseIP(host)) {
+				return fmt.Errorf("%w, %s isn't", ErrPrivateEndpoint, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+// isPrivateHost reports whether a URL's host names one of the plan engine's own or its network's addresses
+func isPrivateHost(host string, allowed func(net.IP) bool) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && !allowed(ip)
+}
+
+// validateServiceEndpoint checks a callback service's endpoint is an absolute HTTPS URL, and not one naming a
+// private address
+func validateServiceEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return errs.E(errs.Validation, errs.Parameter("endpoint"), "endpoint must be an absolute URL")
+	}
+	if u.Scheme != "https" {
+		return errs.E(errs.Validation, errs.Parameter("endpoint"), "endpoint must use https")
+	}
+	if isPrivateHost(u.Hostname(), isPublicAddress) {
+		return errs.E(errs.Validation, errs.Parameter("endpoint"), ErrPrivateEndpoint)
+	}
+	return nil
+}
+
+// HandleServiceCallback accepts a callback service's messages, the same messages services send over the WebSocket.
+// Callback services authenticate like connecting services, i.e. with an API key and any client certificate they're issued.
+func (app *App) HandleServiceCallback(w http.ResponseWriter, r *http.Request) {
+	serviceID := mux.Vars(r)["id"]
+
+	if _, err := app.authorizeServiceConnection(r, serviceID); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+		return
+	}
+
+	wsm := app.Engine.WebSocketManager
+	session := wsm.callbackSession(serviceID)
+	if session == nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, "service is not registered with an endpoint"))
+		return
+	}
+
+	body, err := readRequestBody(w, r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	message, err := callbackMessage(body, serviceID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	wsm.HandleMessage(session, message, app.Engine.GetServiceByID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// callbackMessage validates a callback service's message, attributing it to the service it was posted for
+func callbackMessage(body []byte, serviceID string) ([]byte, error) {
+	var wrapper struct {
+		ID      string     `json:"id"`
+		Payload TaskResult `json:"payload"`
+	}
+	if err := decodeObject(body, &wrapper, []string{"id", "payload"}, ""); err != nil {
+		return nil, err
+	}
+	if wrapper.Payload.Type == "" {
+		return nil, missingField("payload.type")
+	}
+	if !slices.Contains(callbackReportTypes, wrapper.Payload.Type) {
+		return nil, errs.E(errs.Validation, errs.Parameter("payload.type"), fmt.Sprintf("unsupported message type %q", wrapper.Payload.Type))
+	}
+	if wrapper.Payload.ServiceID != "" && wrapper.Payload.ServiceID != serviceID {
+		return nil, errs.E(errs.Validation, errs.Parameter("payload.serviceId"), "payload.serviceId does not match the service")
+	}
+	wrapper.Payload.ServiceID = serviceID
+
+	return json.Marshal(wrapper)
+}
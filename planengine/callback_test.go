@@ -0,0 +1,165 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackServices(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	const secret = "whsec_callback"
+	var mu sync.Mutex
+	var posted, signatures []string
+	endpoint := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var msg struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(body, &msg)
+		signature := r.Header.Get(WebhookSignatureHeader)
+		var timestamp int64
+		_, _ = fmt.Sscanf(signature, "t=%d,", &timestamp)
+		mu.Lock()
+		posted = append(posted, msg.Type)
+		signatures = append(signatures, signature, signWebhookPayload([]string{secret}, time.Unix(timestamp, 0), body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer endpoint.Close()
+
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.callbackClient = endpoint.Client()
+	app.Engine.WebSocketManager = wsm
+
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, Endpoint: endpoint.URL, EndpointSecret: secret, IdempotencyStore: NewIdempotencyStore(0)}
+	socketService := &ServiceInfo{ID: "s_socket", Name: "Socket", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service, socketService.ID: socketService}
+
+	wsm.ConnectCallbackService(service)
+	require.True(t, wsm.IsServiceHealthy(service.ID))
+
+	postCallback := func(serviceID string, payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"id": "m_1", "payload": payload})
+		req := httptest.NewRequest(http.MethodPost, "/services/"+serviceID+"/callback", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("posts tasks to the endpoint", func(t *testing.T) {
+		_, _, err := service.IdempotencyStore.InitializeOrGetExecution("key-1", "e_1")
+		require.NoError(t, err)
+		task := &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1", Input: json.RawMessage(`{}`)}
+		require.NoError(t, wsm.SendTask(service.ID, task))
+
+		assert.Eventually(t, func() bool {
+			wsm.deliveryMu.Lock()
+			defer wsm.deliveryMu.Unlock()
+			return len(wsm.deliveries) == 0
+		}, time.Second, 10*time.Millisecond, "accepted tasks are acknowledged")
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"task_request"}, posted)
+		require.Len(t, signatures, 2)
+		assert.Equal(t, signatures[1], signatures[0], "callbacks are signed with the service's endpoint secret")
+	})
+
+	t.Run("accepts results on the callback route", func(t *testing.T) {
+		rr := postCallback(service.ID, map[string]any{
+			"type":           "task_result",
+			"taskId":         "task1",
+			"executionId":    "e_1",
+			"idempotencyKey": "key-1",
+			"result":         map[string]string{"echo": "hello"},
+		})
+		require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+		execution, _ := service.IdempotencyStore.GetExecutionWithResult("key-1")
+		assert.Equal(t, ExecutionCompleted, execution.State)
+		assert.JSONEq(t, `{"echo":"hello"}`, string(execution.Result))
+	})
+
+	t.Run("rejects invalid callbacks", func(t *testing.T) {
+		rr := postCallback(service.ID, map[string]any{"type": "pong"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = postCallback(service.ID, map[string]any{"type": "task_result", "serviceId": socketService.ID})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = postCallback(socketService.ID, map[string]any{"type": "task_result"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "services without an endpoint use their connection")
+	})
+
+	t.Run("disconnects services whose endpoint is removed", func(t *testing.T) {
+		wsm.ConnectCallbackService(&ServiceInfo{ID: service.ID, Name: service.Name, ProjectID: project.ID})
+		assert.False(t, wsm.IsServiceHealthy(service.ID))
+	})
+}
+
+func TestValidateServiceEndpoint(t *testing.T) {
+	assert.NoError(t, validateServiceEndpoint("https://example.com/orra/tasks"))
+	assert.NoError(t, validateServiceEndpoint("https://203.0.113.10/orra/tasks"))
+	assert.Error(t, validateServiceEndpoint("http://example.com/orra/tasks"))
+	assert.Error(t, validateServiceEndpoint("/orra/tasks"))
+
+	for _, private := range []string{"localhost", "127.0.0.1", "10.0.0.5", "192.168.1.20", "169.254.169.254", "[::1]", "[fe80::1]"} {
+		assert.ErrorIs(t, validateServiceEndpoint("https://"+private+"/orra/tasks"), ErrPrivateEndpoint, private)
+	}
+}
+
+func TestCallbacksAreOnlyPostedToPublicAddresses(t *testing.T) {
+	endpoint := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer endpoint.Close()
+
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	err := wsm.postCallback(endpoint.URL, "", []byte(`{}`))
+	assert.ErrorIs(t, err, ErrPrivateEndpoint, "hosts resolving to private addresses are refused when they're posted to")
+}
+
+func TestServiceEndpointSecrets(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	register := func(endpoint string) ServiceRegistrationResponse {
+		body := fmt.Sprintf(`{"name":"echo","description":"Echoes","endpoint":%q,"schema":{"input":{"type":"object","properties":{"id":{"type":"string"}}},"output":{"type":"object","properties":{"id":{"type":"string"}}}}}`, endpoint)
+		req := httptest.NewRequest(http.MethodPost, "/register/service", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var response ServiceRegistrationResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response
+	}
+
+	first := register("https://example.com/orra/tasks")
+	assert.True(t, strings.HasPrefix(first.EndpointSecret, webhookSecretPrefix))
+	assert.Equal(t, first.EndpointSecret, register("https://example.com/orra/tasks").EndpointSecret, "services keep their secret when they re-register")
+	assert.Empty(t, register("").EndpointSecret, "services without an endpoint have no secret")
+}
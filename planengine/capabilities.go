@@ -0,0 +1,137 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const MaxServiceCapabilities = 32
+
+// Capability tags may be namespaced with ':', from the broadest to the most specific, e.g. crm:salesforce
+var capabilityPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,62}(:[a-z0-9][a-z0-9._-]{0,62}){0,3}$`)
+
+// validateCapabilityTags checks the capability tags a service registered with
+func validateCapabilityTags(capabilities []string) error {
+	if len(capabilities) > MaxServiceCapabilities {
+		return fmt.Errorf("at most %d capabilities are allowed", MaxServiceCapabilities)
+	}
+	for _, capability := range capabilities {
+		if !capabilityPattern.MatchString(capability) {
+			return fmt.Errorf("capability %q must be lowercase letters, digits, '.', '_' or '-', optionally namespaced with ':'", capability)
+		}
+	}
+	return nil
+}
+
+// normalizeCapabilities sorts capability tags, dropping duplicates
+func normalizeCapabilities(capabilities []string) []string {
+	if len(capabilities) == 0 {
+		return nil
+	}
+	normalized := slices.Clone(capabilities)
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// matchesCapability reports whether a tag provides the capability, either exactly or as one of its
+// specialisations, so crm is provided by crm:salesforce
+func matchesCapability(tag, capability string) bool {
+	return tag == capability || strings.HasPrefix(tag, capability+":")
+}
+
+// DiscoveredService is a service providing every capability searched for, with the tags that provide them
+type DiscoveredService struct {
+	ServiceView
+	Matched []string `json:"matched"`
+}
+
+// ServiceDiscoveryResponse lists the services providing the capabilities searched for, by name
+type ServiceDiscoveryResponse struct {
+	Capabilities []string            `json:"capabilities"`
+	Services     []DiscoveredService `json:"services"`
+}
+
+// parseCapabilityQuery reads the capabilities searched for, given repeatedly or comma separated
+func parseCapabilityQuery(values []string) ([]string, error) {
+	var capabilities []string
+	for _, value := range values {
+		for _, capability := range strings.Split(value, ",") {
+			if capability = strings.ToLower(strings.TrimSpace(capability)); capability != "" {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+	if len(capabilities) == 0 {
+		return nil, fmt.Errorf("at least one capability is required")
+	}
+	capabilities = normalizeCapabilities(capabilities)
+	if err := validateCapabilityTags(capabilities); err != nil {
+		return nil, err
+	}
+	return capabilities, nil
+}
+
+// discoverServices finds the project's services providing every capability
+func (p *PlanEngine) discoverServices(projectID string, capabilities []string) []DiscoveredService {
+	services, _ := p.discoverProjectServices(projectID)
+	discovered := make([]DiscoveredService, 0)
+	for _, service := range services {
+		var matched []string
+		for _, capability := range capabilities {
+			i := slices.IndexFunc(service.Capabilities, func(tag string) bool { return matchesCapability(tag, capability) })
+			if i < 0 {
+				matched = nil
+				break
+			}
+			for _, tag := range service.Capabilities[i:] {
+				if matchesCapability(tag, capability) {
+					matched = append(matched, tag)
+				}
+			}
+		}
+		if matched != nil {
+			discovered = append(discovered, DiscoveredService{ServiceView: p.serviceView(service), Matched: normalizeCapabilities(matched)})
+		}
+	}
+	slices.SortStableFunc(discovered, func(a, b DiscoveredService) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return discovered
+}
+
+// DiscoverServicesHandler finds the caller's project services by the capabilities they registered
+func (app *App) DiscoverServicesHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	capabilities, err := parseCapabilityQuery(r.URL.Query()["capability"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("capability"), err))
+		return
+	}
+
+	response := ServiceDiscoveryResponse{
+		Capabilities: capabilities,
+		Services:     app.Engine.discoverServices(project.ID, capabilities),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
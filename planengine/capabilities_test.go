@@ -0,0 +1,105 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceDiscovery(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	const schema = `{"input":{"type":"object","properties":{"id":{"type":"string"}}},"output":{"type":"object","properties":{"id":{"type":"string"}}}}`
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	register := func(name, capabilities string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"name":%q,"description":"%s service","capabilities":%s,"schema":%s}`, name, name, capabilities, schema)
+		return serve(http.MethodPost, "/register/service", body)
+	}
+	discover := func(query string) ServiceDiscoveryResponse {
+		w := serve(http.MethodGet, "/services/discover?"+query, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response ServiceDiscoveryResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+	names := func(response ServiceDiscoveryResponse) []string {
+		out := make([]string, 0, len(response.Services))
+		for _, service := range response.Services {
+			out = append(out, service.Name)
+		}
+		return out
+	}
+
+	require.Equal(t, http.StatusOK, register("salesforce-sync", `["crm:salesforce","pdf-extraction","crm:salesforce"]`).Code)
+	require.Equal(t, http.StatusOK, register("hubspot-sync", `["crm:hubspot"]`).Code)
+	require.Equal(t, http.StatusOK, register("invoice-reader", `["pdf-extraction","ocr"]`).Code)
+	require.Equal(t, http.StatusOK, register("echo", `[]`).Code)
+
+	t.Run("capabilities are registered without duplicates", func(t *testing.T) {
+		service := app.Engine.projectServiceNamed(project.ID, "salesforce-sync")
+		require.NotNil(t, service)
+		assert.Equal(t, []string{"crm:salesforce", "pdf-extraction"}, service.Capabilities)
+
+		w := register("broken", `["PDF Extraction"]`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "capabilities")
+	})
+
+	t.Run("services are found by capability", func(t *testing.T) {
+		response := discover("capability=pdf-extraction")
+		assert.Equal(t, []string{"invoice-reader", "salesforce-sync"}, names(response))
+		assert.Equal(t, []string{"pdf-extraction"}, response.Services[0].Matched)
+	})
+
+	t.Run("broader capabilities find their specialisations", func(t *testing.T) {
+		response := discover("capability=CRM")
+		assert.Equal(t, []string{"crm"}, response.Capabilities)
+		assert.Equal(t, []string{"hubspot-sync", "salesforce-sync"}, names(response))
+		assert.Equal(t, []string{"crm:hubspot"}, response.Services[0].Matched)
+
+		assert.Empty(t, discover("capability=crm:sales").Services, "namespaces match whole segments")
+	})
+
+	t.Run("services must provide every capability", func(t *testing.T) {
+		response := discover("capability=crm&capability=pdf-extraction")
+		assert.Equal(t, []string{"salesforce-sync"}, names(response))
+		assert.Equal(t, []string{"crm:salesforce", "pdf-extraction"}, response.Services[0].Matched)
+
+		assert.Equal(t, names(response), names(discover("capability=crm,pdf-extraction")))
+		assert.Empty(t, discover("capability=ocr,crm").Services)
+	})
+
+	t.Run("a capability is required", func(t *testing.T) {
+		w := serve(http.MethodGet, "/services/discover", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "capability")
+	})
+
+	t.Run("the planner sees capabilities", func(t *testing.T) {
+		services, err := app.Engine.discoverProjectServices(project.ID)
+		require.NoError(t, err)
+		descriptions, err := app.Engine.serviceDescriptions(services)
+		require.NoError(t, err)
+		assert.Contains(t, descriptions, "Capabilities: crm:salesforce, pdf-extraction")
+	})
+}
@@ -0,0 +1,192 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	short "github.com/lithammer/shortuuid/v4"
+	"github.com/olahol/melody"
+)
+
+const (
+	// WSChunk frames a piece of a message too large to send as one WebSocket message
+	WSChunk = "chunk"
+	// WSMaxMessageQueryParam negotiates the largest WebSocket message a service accepts, larger messages are
+	// sent to it in chunks
+	WSMaxMessageQueryParam = "maxMessageBytes"
+	chunksKey              = "chunks"
+	// chunkFrameOverhead leaves room in a chunk frame for everything but its base64 encoded data
+	chunkFrameOverhead = 128
+	// maxChunkTransfers is how many chunked messages a service can have incomplete at once
+	maxChunkTransfers = 8
+)
+
+var (
+	// chunkPieceBytes is the data a service fits in each chunk it sends, maxChunksPerTransfer of them make
+	// the largest message that can be chunked
+	chunkPieceBytes      = (int(WSMaxMessageBytes) - chunkFrameOverhead) / 4 * 3
+	maxChunksPerTransfer = int(WSMaxChunkedBytes)/chunkPieceBytes + 1
+)
+
+// messageChunk is a piece of a chunked message. Chunks of a message share a transfer ID, once all Total chunks
+// of a transfer arrive their data is joined in Index order into the original message.
+type messageChunk struct {
+	Type       string `json:"type"`
+	TransferID string `json:"transferId"`
+	Index      int    `json:"index"`
+	Total      int    `json:"total"`
+	Data       []byte `json:"data"`
+}
+
+func validateMaxMessageBytes(value string) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < WSMinChunkBytes {
+		return fmt.Errorf("%s must be a number of bytes, at least %d", WSMaxMessageQueryParam, WSMinChunkBytes)
+	}
+	return nil
+}
+
+// sessionMaxMessageBytes returns the largest message a service negotiated to accept in one piece, if any.
+// Only JSON WebSocket connections are sent chunks, other transports and encodings have limits of their own.
+func sessionMaxMessageBytes(s serviceSession) int {
+	ws, ok := s.(*melody.Session)
+	if !ok || ws.Request == nil || sessionEncoding(s) != JSONEncoding {
+		return 0
+	}
+	n, _ := strconv.Atoi(ws.Request.URL.Query().Get(WSMaxMessageQueryParam))
+	return n
+}
+
+// chunkMessage splits a message into chunk frames of at most maxBytes each
+func chunkMessage(message []byte, maxBytes int) ([][]byte, error) {
+	pieceSize := (maxBytes - chunkFrameOverhead) / 4 * 3
+	total := (len(message) + pieceSize - 1) / pieceSize
+	transferID := fmt.Sprintf("t_%s", short.New())
+
+	frames := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*pieceSize, len(message))
+		frame, err := json.Marshal(messageChunk{
+			Type:       WSChunk,
+			TransferID: transferID,
+			Index:      i,
+			Total:      total,
+			Data:       message[i*pieceSize : end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal message chunk: %w", err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// chunkAssembler reassembles the chunked messages a service sends over its connection. A service has at most
+// maxChunkTransfers incomplete transfers, whose chunks together hold at most WSMaxChunkedBytes.
+type chunkAssembler struct {
+	mu        sync.Mutex
+	transfers map[string]*chunkTransfer
+	size      int
+}
+
+type chunkTransfer struct {
+	parts    [][]byte
+	received int
+	size     int
+}
+
+func newChunkAssembler() *chunkAssembler {
+	return &chunkAssembler{transfers: make(map[string]*chunkTransfer)}
+}
+
+// add stores a chunk, returning its transfer's message once all the transfer's chunks have arrived
+func (a *chunkAssembler) add(chunk messageChunk) ([]byte, bool, error) {
+	if chunk.TransferID == "" || chunk.Total <= 0 || chunk.Index < 0 || chunk.Index >= chunk.Total {
+		return nil, false, fmt.Errorf("invalid chunk %d of %d for transfer %q", chunk.Index, chunk.Total, chunk.TransferID)
+	}
+	if chunk.Total > maxChunksPerTransfer {
+		return nil, false, fmt.Errorf("transfer %q has %d chunks, at most %d are allowed", chunk.TransferID, chunk.Total, maxChunksPerTransfer)
+	}
+	// Only messages too large for one piece are chunked, and empty chunks would count nothing against WSMaxChunkedBytes
+	if len(chunk.Data) == 0 {
+		return nil, false, fmt.Errorf("chunk %d of transfer %q is empty", chunk.Index, chunk.TransferID)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	transfer, ok := a.transfers[chunk.TransferID]
+	if !ok {
+		if len(a.transfers) >= maxChunkTransfers {
+			return nil, false, fmt.Errorf("at most %d chunked messages can be incomplete at once", maxChunkTransfers)
+		}
+		transfer = &chunkTransfer{parts: make([][]byte, chunk.Total)}
+		a.transfers[chunk.TransferID] = transfer
+	}
+	if len(transfer.parts) != chunk.Total {
+		a.abort(chunk.TransferID)
+		return nil, false, fmt.Errorf("chunk total of transfer %q changed from %d to %d", chunk.TransferID, len(transfer.parts), chunk.Total)
+	}
+	if transfer.parts[chunk.Index] != nil {
+		return nil, false, nil
+	}
+	if int64(a.size+len(chunk.Data)) > WSMaxChunkedBytes {
+		a.abort(chunk.TransferID)
+		return nil, false, fmt.Errorf("chunked messages exceed %d bytes", WSMaxChunkedBytes)
+	}
+
+	transfer.parts[chunk.Index] = chunk.Data
+	transfer.received++
+	transfer.size += len(chunk.Data)
+	a.size += len(chunk.Data)
+	if transfer.received < chunk.Total {
+		return nil, false, nil
+	}
+
+	a.abort(chunk.TransferID)
+	return bytes.Join(transfer.parts, nil), true, nil
+}
+
+// abort forgets a transfer's chunks, callers must hold mu
+func (a *chunkAssembler) abort(transferID string) {
+	if transfer, ok := a.transfers[transferID]; ok {
+		a.size -= transfer.size
+		delete(a.transfers, transferID)
+	}
+}
+
+// handleChunk reassembles a service's chunked message, handling the message once its last chunk arrives
+func (wsm *WebSocketManager) handleChunk(s serviceSession, msg []byte, fn ServiceFinder) {
+	var chunk messageChunk
+	if err := json.Unmarshal(msg, &chunk); err != nil {
+		wsm.logger.Error().Err(err).Msg("Failed to unmarshal WebSocket message chunk")
+		return
+	}
+
+	value, _ := s.Get(chunksKey)
+	assembler, ok := value.(*chunkAssembler)
+	if !ok {
+		wsm.logger.Warn().Str("TransferID", chunk.TransferID).Msg("Dropped message chunk for a session that isn't connected")
+		return
+	}
+
+	message, complete, err := assembler.add(chunk)
+	if err != nil {
+		wsm.logger.Warn().Err(err).Str("TransferID", chunk.TransferID).Msg("Dropped chunked message")
+		return
+	}
+	if complete {
+		wsm.HandleMessage(s, message, fn)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOversizedMessagesAreChunked(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.Nop())
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleMessage(func(s *melody.Session, msg []byte) {
+		wsm.HandleMessage(s, msg, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	maxBytes := WSMinChunkBytes
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?" + WSMaxMessageQueryParam + "=" + strconv.Itoa(maxBytes)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Reads messages the way services do, reassembling chunked ones
+	assembler := newChunkAssembler()
+	read := func() map[string]any {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for {
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(msg), maxBytes)
+
+			var message map[string]any
+			require.NoError(t, json.Unmarshal(msg, &message))
+			if message["type"] != WSChunk {
+				return message
+			}
+			var chunk messageChunk
+			require.NoError(t, json.Unmarshal(msg, &chunk))
+			whole, complete, err := assembler.add(chunk)
+			require.NoError(t, err)
+			if complete {
+				require.NoError(t, json.Unmarshal(whole, &message))
+				return message
+			}
+		}
+	}
+
+	token := read()
+	require.Equal(t, WSResumeToken, token["type"])
+	assert.EqualValues(t, WSMaxMessageBytes, token["maxMessageBytes"])
+
+	document := strings.Repeat("orra", 100_000)
+	input, _ := json.Marshal(map[string]string{"document": document})
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task1", Input: input, ExecutionID: "e_1", OrchestrationID: "o_1"}))
+	task := read()
+	assert.Equal(t, "task1", task["id"])
+	assert.Equal(t, document, task["input"].(map[string]any)["document"])
+
+	t.Run("services chunk their oversized messages", func(t *testing.T) {
+		result, _ := json.Marshal(map[string]any{"id": "m_result", "payload": map[string]any{
+			"type": "task_result", "serviceId": "s_echo", "taskId": "task1", "executionId": "e_1", "result": map[string]string{"document": document},
+		}})
+		frames, err := chunkMessage(result, int(WSMaxMessageBytes))
+		require.NoError(t, err)
+		require.Greater(t, len(frames), 1)
+		for _, frame := range frames {
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, frame))
+		}
+
+		ack := read()
+		assert.Equal(t, "ACK", ack["type"])
+		assert.Equal(t, "m_result", ack["id"], "reassembled messages are acknowledged by their own ID")
+	})
+
+	t.Run("rejects chunks past the negotiated limits", func(t *testing.T) {
+		assert.Error(t, validateMaxMessageBytes("1024"))
+		assert.NoError(t, validateMaxMessageBytes(strconv.Itoa(maxBytes)))
+
+		_, _, err := newChunkAssembler().add(messageChunk{TransferID: "t_1", Index: 2, Total: 2, Data: []byte("x")})
+		assert.Error(t, err)
+
+		_, _, err = newChunkAssembler().add(messageChunk{TransferID: "t_1", Index: 0, Total: maxChunksPerTransfer + 1, Data: []byte("x")})
+		assert.Error(t, err, "transfers can't have more chunks than the largest chunked message")
+
+		_, _, err = newChunkAssembler().add(messageChunk{TransferID: "t_1", Index: 0, Total: 2})
+		assert.Error(t, err, "chunks can't be empty")
+
+		assembler := newChunkAssembler()
+		for i := range maxChunkTransfers {
+			_, _, err := assembler.add(messageChunk{TransferID: fmt.Sprintf("t_%d", i), Index: 0, Total: 2, Data: []byte("x")})
+			require.NoError(t, err)
+		}
+		_, _, err = assembler.add(messageChunk{TransferID: "t_extra", Index: 0, Total: 2, Data: []byte("x")})
+		assert.Error(t, err, "services can only have so many incomplete transfers")
+		_, complete, err := assembler.add(messageChunk{TransferID: "t_0", Index: 1, Total: 2, Data: []byte("y")})
+		require.NoError(t, err)
+		assert.True(t, complete, "open transfers can still complete")
+	})
+}
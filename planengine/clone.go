@@ -0,0 +1,166 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+var (
+	ErrOrchestrationNotClonable = errors.New("only orchestrations with an execution plan can be cloned")
+	ErrUnknownCloneParam        = errors.New("cloned orchestrations can only override params of the original")
+)
+
+// CloneOrchestration submits a new run of an orchestration's action and plan, with some of its params overridden.
+// The plan isn't decomposed again, the overrides replace the original values wherever the plan uses them.
+func (p *PlanEngine) CloneOrchestration(ctx context.Context, orchestrationID string, overrides map[string]any) (*Orchestration, error) {
+	p.orchestrationStoreMu.RLock()
+	source, exists := p.orchestrationStore[orchestrationID]
+	var clone *Orchestration
+	var err error
+	switch {
+	case !exists:
+		err = ErrOrchestrationNotFound
+	case source.Plan == nil:
+		err = ErrOrchestrationNotClonable
+	case source.ParentID != "":
+		err = fmt.Errorf("%w: sub-orchestrations are cloned with their parent", ErrOrchestrationNotClonable)
+	default:
+		clone = p.newRunOf(source)
+		clone.CloneOf = source.ID
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := overrideParams(clone, overrides); err != nil {
+		return nil, err
+	}
+
+	p.scheduleSLA(clone)
+	p.orchestrationStoreMu.Lock()
+	p.orchestrationStore[clone.ID] = clone
+	p.orchestrationStoreMu.Unlock()
+
+	if err := p.orchestrationStorage.StoreOrchestration(clone); err != nil {
+		return nil, fmt.Errorf("failed to persist orchestration: %w", err)
+	}
+
+	p.DispatchOrchestration(ctx, clone)
+	return clone, nil
+}
+
+// newRunOf copies an orchestration's request and execution plan into a new pending orchestration, without the
+// state of the original's run. The caller must hold orchestrationStoreMu.
+func (p *PlanEngine) newRunOf(source *Orchestration) *Orchestration {
+	return &Orchestration{
+		ID:                     p.GenerateOrchestrationKey(),
+		ProjectID:              source.ProjectID,
+		Action:                 source.Action,
+		Params:                 slices.Clone(source.Params),
+		Plan:                   source.Plan,
+		Status:                 Pending,
+		Timestamp:              time.Now().UTC(),
+		Priority:               source.Priority,
+		Timeout:                source.Timeout,
+		HealthCheckGracePeriod: source.HealthCheckGracePeriod,
+		OrchestrationTimeout:   source.OrchestrationTimeout,
+		TaskExecutionTimeout:   source.TaskExecutionTimeout,
+		SLA:                    source.SLA,
+		RetryPolicy:            source.RetryPolicy,
+		Budget:                 source.Budget,
+		Approvals:              source.Approvals,
+		SubOrchestrations:      source.SubOrchestrations,
+		FanOut:                 source.FanOut,
+		Branches:               source.Branches,
+		TaskGraph:              source.TaskGraph,
+		Webhook:                source.Webhook,
+		Callback:               source.Callback,
+		StreamResults:          source.StreamResults,
+		Labels:                 source.Labels,
+		ServiceVersions:        source.ServiceVersions,
+		TaskZero:               source.TaskZero,
+		GroundingHit:           source.GroundingHit,
+	}
+}
+
+// overrideParams replaces param values in the orchestration's params and its task zero, which feeds them to the plan
+func overrideParams(orchestration *Orchestration, overrides map[string]any) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	taskZero := make(map[string]any)
+	if len(orchestration.TaskZero) > 0 {
+		if err := json.Unmarshal(orchestration.TaskZero, &taskZero); err != nil {
+			return fmt.Errorf("failed to unmarshal task zero: %w", err)
+		}
+	}
+
+	for field, value := range overrides {
+		i := slices.IndexFunc(orchestration.Params, func(param ActionParam) bool { return param.Field == field })
+		if i < 0 {
+			return fmt.Errorf("%w: unknown param %q", ErrUnknownCloneParam, field)
+		}
+		orchestration.Params[i].Value = value
+		taskZero[field] = value
+	}
+
+	taskZeroInput, err := json.Marshal(taskZero)
+	if err != nil {
+		return fmt.Errorf("failed to convert task zero to raw JSON: %w", err)
+	}
+	orchestration.TaskZero = taskZeroInput
+	return nil
+}
+
+// CloneOrchestrationHandler re-runs one of the caller's orchestrations as a new orchestration, optionally with new params
+func (app *App) CloneOrchestrationHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID, ok := app.projectOrchestrationID(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional, without one the orchestration is cloned as it is
+	var request struct {
+		Params map[string]any `json:"params"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+
+	clone, err := app.Engine.CloneOrchestration(app.RootCtx, orchestrationID, request.Params)
+	switch {
+	case errors.Is(err, ErrOrchestrationNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), err))
+		return
+	case errors.Is(err, ErrOrchestrationNotClonable):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Invalid, err))
+		return
+	case errors.Is(err, ErrUnknownCloneParam):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("params"), err))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	app.writeAcceptedOrchestration(w, clone)
+}
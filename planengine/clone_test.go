@@ -0,0 +1,70 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	orchestration.Action = Action{Content: "Echo a message"}
+	orchestration.Params = ActionParams{{Field: "message", Value: "hi"}, {Field: "tone", Value: "calm"}}
+	orchestration.TaskZero = json.RawMessage(`{"message":"hi","tone":"calm","task1_prefix":">"}`)
+
+	clone := func(orchestrationID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/"+orchestrationID+"/clone", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := clone(orchestration.ID, `{"params":{"message":"bye"}}`)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var accepted Orchestration
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&accepted))
+	assert.NotEqual(t, orchestration.ID, accepted.ID)
+	assert.Equal(t, orchestration.ID, accepted.CloneOf)
+	assert.Equal(t, orchestration.Action, accepted.Action)
+	assert.Len(t, accepted.Plan.Tasks, len(orchestration.Plan.Tasks))
+	assert.Equal(t, ActionParams{{Field: "message", Value: "bye"}, {Field: "tone", Value: "calm"}}, accepted.Params)
+	assert.JSONEq(t, `{"message":"bye","tone":"calm","task1_prefix":">"}`, string(accepted.TaskZero))
+	assert.Equal(t, "hi", orchestration.Params[0].Value, "the original is left as it was")
+
+	t.Run("without a body the orchestration is cloned as it is", func(t *testing.T) {
+		w := clone(orchestration.ID, "")
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		var accepted Orchestration
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&accepted))
+		assert.Equal(t, orchestration.Params, accepted.Params)
+	})
+
+	t.Run("only params of the original can be overridden", func(t *testing.T) {
+		w := clone(orchestration.ID, `{"params":{"language":"fr"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("orchestrations without a plan cannot be cloned", func(t *testing.T) {
+		failed := setupRunningOrchestration(t, app, project.ID)
+		failed.Plan = nil
+		w := clone(failed.ID, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,227 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// compressionMinBytes is the smallest response body worth compressing, smaller ones are sent as they are
+	compressionMinBytes = 1024
+	encodingGzip        = "gzip"
+	encodingDeflate     = "deflate"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		writer, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return writer
+	}}
+	deflateWriters = sync.Pool{New: func() any {
+		writer, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return writer
+	}}
+)
+
+// compressibleTypes are the media types of responses worth compressing
+var compressibleTypes = map[string]bool{
+	"application/json": true,
+	ProblemContentType: true,
+	NDJSONContentType:  true,
+}
+
+// acceptedEncoding picks the compression a client accepts, gzip is preferred over deflate
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[coding] = true
+	}
+
+	switch {
+	case accepted[encodingGzip] || accepted["*"]:
+		return encodingGzip
+	case accepted[encodingDeflate]:
+		return encodingDeflate
+	default:
+		return ""
+	}
+}
+
+// compressionWriter compresses JSON responses once their body is large enough to be worth it. The status is held
+// back with the start of the body until the writer knows whether it compresses.
+type compressionWriter struct {
+	http.ResponseWriter
+	encoding   string
+	status     int
+	buf        []byte
+	started    bool
+	compressor interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (cw *compressionWriter) compressible() bool {
+	switch {
+	case cw.status < http.StatusOK, cw.status == http.StatusNoContent, cw.status == http.StatusNotModified:
+		return false
+	case cw.Header().Get("Content-Encoding") != "":
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(cw.Header().Get("Content-Type"))
+	return err == nil && compressibleTypes[mediaType]
+}
+
+func (cw *compressionWriter) WriteHeader(status int) {
+	if cw.started || cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if !cw.compressible() {
+		_ = cw.start(false)
+	}
+}
+
+func (cw *compressionWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.started {
+		if cw.compressor != nil {
+			return cw.compressor.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= compressionMinBytes {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start sends the status and what's buffered of the body, compressed or not
+func (cw *compressionWriter) start(compress bool) error {
+	cw.started = true
+	if compress {
+		cw.Header().Del("Content-Length")
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		if cw.encoding == encodingGzip {
+			writer := gzipWriters.Get().(*gzip.Writer)
+			writer.Reset(cw.ResponseWriter)
+			cw.compressor = writer
+		} else {
+			writer := deflateWriters.Get().(*flate.Writer)
+			writer.Reset(cw.ResponseWriter)
+			cw.compressor = writer
+		}
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if cw.compressor != nil {
+		_, err := cw.compressor.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends what's written so far, bodies flushed before they're worth compressing are sent uncompressed
+func (cw *compressionWriter) Flush() {
+	if !cw.started {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		_ = cw.start(false)
+	}
+	if cw.compressor != nil {
+		_ = cw.compressor.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController extend deadlines through the writer
+func (cw *compressionWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressionWriter) close() error {
+	if !cw.started {
+		// Handlers that wrote nothing leave the status to net/http
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return nil
+		}
+		if err := cw.start(false); err != nil {
+			return err
+		}
+	}
+	if cw.compressor == nil {
+		return nil
+	}
+
+	err := cw.compressor.Close()
+	switch writer := cw.compressor.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(writer)
+	case *flate.Writer:
+		deflateWriters.Put(writer)
+	}
+	cw.compressor = nil
+	return err
+}
+
+// CompressionMiddleware compresses JSON responses for clients accepting gzip or deflate, inspections embedding
+// LLM outputs are large and compress well. WebSocket upgrades and streamed events are left alone.
+func (app *App) CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressionWriter{ResponseWriter: w, encoding: encoding}
+		defer func() {
+			if err := writer.close(); err != nil {
+				logger := app.requestLogger(r)
+				logger.Debug().Err(err).Msg("Failed to finish compressed response")
+			}
+		}()
+		next.ServeHTTP(writer, r)
+	})
+}
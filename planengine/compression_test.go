@@ -0,0 +1,106 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"gzip":                  encodingGzip,
+		"deflate, gzip;q=0.5":   encodingGzip,
+		"deflate":               encodingDeflate,
+		"gzip;q=0, deflate":     encodingDeflate,
+		"br":                    "",
+		"*":                     encodingGzip,
+		"identity, GZIP;q=1.0":  encodingGzip,
+		"gzip;q=0, deflate;q=0": "",
+	}
+	for header, want := range tests {
+		assert.Equal(t, want, acceptedEncoding(header), header)
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	app := &App{}
+	large := map[string]string{"output": strings.Repeat("the model said hello ", 200)}
+
+	serve := func(acceptEncoding string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/inspections/o_1", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		app.CompressionMiddleware(handler).ServeHTTP(w, req)
+		return w
+	}
+	writeJSON := func(status int, body any) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(body)
+		}
+	}
+
+	t.Run("compresses large JSON responses", func(t *testing.T) {
+		w := serve("gzip", writeJSON(http.StatusCreated, large))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, encodingGzip, w.Header().Get("Content-Encoding"))
+		assert.Contains(t, w.Header().Values("Vary"), "Accept-Encoding")
+
+		reader, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(reader).Decode(&body))
+		assert.Equal(t, large, body)
+	})
+
+	t.Run("deflates for clients only accepting deflate", func(t *testing.T) {
+		w := serve("deflate", writeJSON(http.StatusOK, large))
+		assert.Equal(t, encodingDeflate, w.Header().Get("Content-Encoding"))
+
+		decoded, err := io.ReadAll(flate.NewReader(w.Body))
+		require.NoError(t, err)
+		assert.Contains(t, string(decoded), "the model said hello")
+	})
+
+	t.Run("leaves small, non-JSON and unaccepted responses alone", func(t *testing.T) {
+		w := serve("gzip", writeJSON(http.StatusOK, map[string]string{"status": "ok"}))
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+		w = serve("gzip", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte(strings.Repeat("data: {}\n\n", 200)))
+		})
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+
+		w = serve("", writeJSON(http.StatusOK, large))
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("keeps bodiless responses bodiless", func(t *testing.T) {
+		w := serve("gzip", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Zero(t, w.Body.Len())
+	})
+}
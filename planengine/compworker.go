@@ -236,6 +236,7 @@ func (w *CompensationWorker) tryExecuteCompensation(ctx context.Context, candida
 		OrchestrationID: w.OrchestrationID,
 		ProjectID:       service.ProjectID,
 		Status:          Processing,
+		RoutingKey:      service.routingKey(w.OrchestrationID),
 	}
 
 	if err := w.LogManager.AppendCompensationAttempted(
@@ -0,0 +1,286 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const maxConcurrentOrchestrationsLimit = 1000
+
+// ProjectLimits bounds how much of the plan engine a project's orchestrations may use
+type ProjectLimits struct {
+	// MaxConcurrentOrchestrations caps how many orchestrations execute at once, zero is unlimited.
+	// Orchestrations submitted beyond the cap are queued and started by priority, then in the order they arrived.
+	MaxConcurrentOrchestrations int `json:"maxConcurrentOrchestrations,omitempty"`
+}
+
+// Validate ensures the limits are within what the plan engine supports
+func (l ProjectLimits) Validate() error {
+	if l.MaxConcurrentOrchestrations < 0 || l.MaxConcurrentOrchestrations > maxConcurrentOrchestrationsLimit {
+		return fmt.Errorf("maxConcurrentOrchestrations must be between 0 and %d", maxConcurrentOrchestrationsLimit)
+	}
+	return nil
+}
+
+// Priority orders a project's queued orchestrations, higher priorities are started first. Their tasks are also
+// dispatched first to services that had to hold tasks back.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Validate ensures the priority is a known level, an unset priority is treated as normal
+func (p Priority) Validate() error {
+	switch p {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return nil
+	default:
+		return fmt.Errorf("priority must be one of %s, %s or %s", PriorityHigh, PriorityNormal, PriorityLow)
+	}
+}
+
+func (p Priority) rank() int {
+	switch p {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// serviceHolds tracks the tasks held back for services that can't take them yet, e.g. busy, draining or degraded
+// ones, so they're dispatched by their orchestration's priority once the service can
+type serviceHolds struct {
+	mu   sync.Mutex
+	held map[string]map[string]Priority // Held tasks of each service
+}
+
+// hold records a task as held back for the service
+func (h *serviceHolds) hold(serviceID, task string, priority Priority) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.held == nil {
+		h.held = make(map[string]map[string]Priority)
+	}
+	if h.held[serviceID] == nil {
+		h.held[serviceID] = make(map[string]Priority)
+	}
+	h.held[serviceID][task] = priority
+}
+
+// release forgets a task held back for the service, once it's dispatched or given up on
+func (h *serviceHolds) release(serviceID, task string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.held[serviceID], task)
+	if len(h.held[serviceID]) == 0 {
+		delete(h.held, serviceID)
+	}
+}
+
+// outranked reports whether a task of a higher priority is held back for the service, it's dispatched first
+func (h *serviceHolds) outranked(serviceID string, priority Priority) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, held := range h.held[serviceID] {
+		if held.rank() < priority.rank() {
+			return true
+		}
+	}
+	return false
+}
+
+type queuedOrchestration struct {
+	ctx           context.Context
+	orchestration *Orchestration
+}
+
+// enqueueOrchestrationLocked queues an orchestration behind those of the same or a higher priority,
+// the caller must hold orchestrationStoreMu.
+func (p *PlanEngine) enqueueOrchestrationLocked(ctx context.Context, orchestration *Orchestration) {
+	queue := p.orchestrationQueues[orchestration.ProjectID]
+	rank := orchestration.Priority.rank()
+
+	at := len(queue)
+	for at > 0 && queue[at-1].orchestration.Priority.rank() > rank {
+		at--
+	}
+
+	p.orchestrationQueues[orchestration.ProjectID] = slices.Insert(queue, at, queuedOrchestration{ctx: ctx, orchestration: orchestration})
+}
+
+// DispatchOrchestration executes a prepared orchestration once its project has a free slot,
+// until then it waits in the project's queue with a queued status, ahead of any lower priority orchestrations.
+func (p *PlanEngine) DispatchOrchestration(ctx context.Context, orchestration *Orchestration) {
+	p.orchestrationStoreMu.Lock()
+	orchestration.Status = Queued
+	p.enqueueOrchestrationLocked(ctx, orchestration)
+	p.drainOrchestrationQueueLocked(orchestration.ProjectID)
+
+	if orchestration.Status != Queued {
+		p.orchestrationStoreMu.Unlock()
+		return
+	}
+
+	orchestration.Timestamp = time.Now().UTC()
+	orchestration.recordLifecycle(orchestrationEventType(Queued))
+	snapshot := *orchestration
+	queueLength := len(p.orchestrationQueues[orchestration.ProjectID])
+	p.orchestrationStoreMu.Unlock()
+
+	// Persisted outside the store lock, Badger writes are synchronous and would stall every other orchestration
+	if err := p.orchestrationStorage.StoreOrchestration(&snapshot); err != nil {
+		p.Logger.Error().
+			Err(err).
+			Str("OrchestrationID", orchestration.ID).
+			Msg("Failed to persist queued orchestration")
+	}
+
+	p.Logger.Debug().
+		Str("OrchestrationID", orchestration.ID).
+		Str("ProjectID", orchestration.ProjectID).
+		Int("QueueLength", queueLength).
+		Msg("Orchestration queued until a slot frees up")
+}
+
+// drainOrchestrationQueueLocked starts queued orchestrations in priority then arrival order while the project has free slots,
+// the caller must hold orchestrationStoreMu.
+func (p *PlanEngine) drainOrchestrationQueueLocked(projectID string) {
+	limit := 0
+	if project, exists := p.cachedProject(projectID); exists {
+		limit = project.Limits.MaxConcurrentOrchestrations
+	}
+
+	queue := p.orchestrationQueues[projectID]
+	for len(queue) > 0 && (limit == 0 || p.runningCounts[projectID] < limit) {
+		next := queue[0]
+		queue = queue[1:]
+
+		// Queued orchestrations may have been cancelled or failed while they waited
+		if next.orchestration.Status != Queued {
+			continue
+		}
+
+		next.orchestration.Status = Pending
+		p.runningOrchestrations[next.orchestration.ID] = projectID
+		p.runningCounts[projectID]++
+		go p.ExecuteOrchestration(next.ctx, next.orchestration)
+	}
+
+	if len(queue) == 0 {
+		delete(p.orchestrationQueues, projectID)
+		return
+	}
+	p.orchestrationQueues[projectID] = queue
+}
+
+// releaseOrchestrationSlotLocked frees a finished orchestration's slot for the next queued one,
+// the caller must hold orchestrationStoreMu.
+func (p *PlanEngine) releaseOrchestrationSlotLocked(orchestrationID string) {
+	projectID, running := p.runningOrchestrations[orchestrationID]
+	if !running {
+		return
+	}
+
+	delete(p.runningOrchestrations, orchestrationID)
+	if p.runningCounts[projectID]--; p.runningCounts[projectID] <= 0 {
+		delete(p.runningCounts, projectID)
+	}
+	p.drainOrchestrationQueueLocked(projectID)
+}
+
+// requeueOrchestrations restores the queues of orchestrations that were waiting when the plan engine stopped
+func (p *PlanEngine) requeueOrchestrations(ctx context.Context, orchestrations []*Orchestration) {
+	sort.Slice(orchestrations, func(i, j int) bool {
+		return orchestrations[i].Timestamp.Before(orchestrations[j].Timestamp)
+	})
+
+	p.orchestrationStoreMu.Lock()
+	defer p.orchestrationStoreMu.Unlock()
+
+	projectIDs := make(map[string]struct{})
+	for _, orchestration := range orchestrations {
+		p.enqueueOrchestrationLocked(ctx, orchestration)
+		projectIDs[orchestration.ProjectID] = struct{}{}
+	}
+
+	for projectID := range projectIDs {
+		p.drainOrchestrationQueueLocked(projectID)
+	}
+}
+
+// UpdateProjectLimits replaces a project's limits, raising the concurrency limit starts queued orchestrations straight away
+func (p *PlanEngine) UpdateProjectLimits(projectID string, limits ProjectLimits) error {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Limits = limits
+	if err := p.updateProject(updated); err != nil {
+		return err
+	}
+
+	p.orchestrationStoreMu.Lock()
+	p.drainOrchestrationQueueLocked(projectID)
+	p.orchestrationStoreMu.Unlock()
+	return nil
+}
+
+// UpdateProjectLimits replaces a project's resource limits
+func (app *App) UpdateProjectLimits(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProjectFor(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	var limits ProjectLimits
+	if err := decodeRequest(w, r, &limits, projectLimitsFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if err := limits.Validate(); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("maxConcurrentOrchestrations"), err))
+		return
+	}
+
+	if err := app.Engine.UpdateProjectLimits(project.ID, limits); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectLimitsUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(limits); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
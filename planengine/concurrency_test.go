@@ -0,0 +1,175 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectConcurrencyLimit(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	app.Engine.WebSocketManager = NewWebSocketManager(app.Logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	project.Limits.MaxConcurrentOrchestrations = 1
+
+	newOrchestration := func() *Orchestration {
+		orchestration := &Orchestration{
+			ID:        app.Engine.GenerateOrchestrationKey(),
+			ProjectID: project.ID,
+			Plan:      &ExecutionPlan{ProjectID: project.ID, Tasks: []*SubTask{{ID: "task1", Service: "s_unknown"}}},
+			Status:    Pending,
+		}
+		app.Engine.orchestrationStoreMu.Lock()
+		app.Engine.orchestrationStore[orchestration.ID] = orchestration
+		app.Engine.orchestrationStoreMu.Unlock()
+		return orchestration
+	}
+	statusOf := func(orchestration *Orchestration) Status {
+		app.Engine.orchestrationStoreMu.RLock()
+		defer app.Engine.orchestrationStoreMu.RUnlock()
+		return orchestration.Status
+	}
+
+	first, second, third := newOrchestration(), newOrchestration(), newOrchestration()
+	app.Engine.DispatchOrchestration(ctx, first)
+	app.Engine.DispatchOrchestration(ctx, second)
+	app.Engine.DispatchOrchestration(ctx, third)
+
+	require.Eventually(t, func() bool { return statusOf(first) == Processing }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, Queued, statusOf(second))
+	assert.Equal(t, Queued, statusOf(third))
+
+	list := app.Engine.GetOrchestrationList(project.ID, OrchestrationQuery{})
+	assert.Len(t, list.Queued, 2)
+
+	// Orchestrations cancelled while queued are skipped when a slot frees up
+	_, err = app.Engine.AbortOrchestration(second.ID, "no longer needed")
+	require.NoError(t, err)
+
+	require.NoError(t, app.Engine.FinalizeOrchestration(first.ID, Completed, nil, nil, true))
+	require.Eventually(t, func() bool { return statusOf(third) == Processing }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, Cancelled, statusOf(second))
+
+	t.Run("raising the limit drains the queue", func(t *testing.T) {
+		fourth := newOrchestration()
+		app.Engine.DispatchOrchestration(ctx, fourth)
+		assert.Equal(t, Queued, statusOf(fourth))
+
+		update := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/projects/"+project.ID+"/limits", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer "+project.APIKey)
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, req)
+			return w
+		}
+
+		w := update(`{"maxConcurrentOrchestrations":-1}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = update(`{"maxConcurent":2}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "a misspelt limit isn't taken as no limit")
+		assert.Equal(t, Queued, statusOf(fourth))
+
+		w = update(`{"maxConcurrentOrchestrations":2}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Eventually(t, func() bool { return statusOf(fourth) == Processing }, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestQueuedOrchestrationPriority(t *testing.T) {
+	plane := NewPlanEngine()
+
+	enqueue := func(id string, priority Priority) {
+		plane.enqueueOrchestrationLocked(context.Background(), &Orchestration{ID: id, ProjectID: "p_test", Priority: priority, Status: Queued})
+	}
+	enqueue("low1", PriorityLow)
+	enqueue("normal1", "")
+	enqueue("high1", PriorityHigh)
+	enqueue("normal2", PriorityNormal)
+	enqueue("high2", PriorityHigh)
+	enqueue("low2", PriorityLow)
+
+	var order []string
+	for _, queued := range plane.orchestrationQueues["p_test"] {
+		order = append(order, queued.orchestration.ID)
+	}
+	assert.Equal(t, []string{"high1", "high2", "normal1", "normal2", "low1", "low2"}, order)
+}
+
+func TestSaturatedServiceTakesHigherPriorityTasksFirst(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logManager, err := NewLogManager(ctx, app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.ConfigureSendQueue(SendQueue{Size: 2, BusyThreshold: 1})
+	app.Engine.WebSocketManager = wsm
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+	// The session's endpoint is never posted to, its queue only empties as the test reads it
+	session := &callbackSession{wsm: wsm, serviceID: service.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	wsm.HandleConnection(service.ID, service.Name, session)
+	require.NoError(t, wsm.SendTask(service.ID, &Task{Type: "task_request", ID: "task0", OrchestrationID: "o_earlier"}))
+	require.True(t, wsm.IsServiceBusy(service.ID))
+
+	start := func(orchestrationID string, priority Priority, retryInterval time.Duration) {
+		retryPolicy := RetryPolicy{MaxAttempts: 3, InitialInterval: &Duration{retryInterval}, BackoffFactor: 1}
+		worker := NewTaskWorker(service, "task1", nil, time.Minute, 0, time.Minute, retryPolicy, logManager).(*TaskWorker)
+		worker.Priority = priority
+		go func() { _, _ = worker.executeTaskWithRetry(ctx, orchestrationID) }()
+	}
+	// The low priority task retries sooner, it still waits for the high priority one
+	start("o_low", PriorityLow, time.Millisecond)
+	start("o_high", PriorityHigh, 20*time.Millisecond)
+	require.Eventually(t, func() bool {
+		app.Engine.heldTasks.mu.Lock()
+		defer app.Engine.heldTasks.mu.Unlock()
+		return len(app.Engine.heldTasks.held[service.ID]) == 2
+	}, time.Second, time.Millisecond, "both tasks are held back for the busy service")
+
+	dispatched := func() string {
+		t.Helper()
+		select {
+		case message := <-session.outbound:
+			var task Task
+			require.NoError(t, json.Unmarshal(message, &task))
+			return task.OrchestrationID
+		case <-time.After(time.Second):
+			t.Fatal("no task was dispatched")
+			return ""
+		}
+	}
+
+	// The service catches up with one task at a time
+	assert.Equal(t, "o_earlier", dispatched())
+	assert.Equal(t, "o_high", dispatched())
+	assert.Equal(t, "o_low", dispatched())
+}
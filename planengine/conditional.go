@@ -0,0 +1,79 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// inspectionVersion fingerprints what an orchestration's inspection is built from, so clients polling an unchanged
+// orchestration can be answered without building its inspection. The inspection's elapsed duration isn't part of
+// the fingerprint, which makes it a weak ETag. Representations of the same inspection, e.g. different fieldsets,
+// are told apart by their variant. Last modified is when the orchestration last progressed.
+func (p *PlanEngine) inspectionVersion(orchestrationID, variant string) (string, time.Time, error) {
+	orchestration, err := p.getOrchestration(orchestrationID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	p.orchestrationStoreMu.RLock()
+	hash := fnv.New64a()
+	_, _ = fmt.Fprintf(hash, "%s|%s|%d|%d|%d|%d|%t|%s",
+		variant,
+		orchestration.Status,
+		len(orchestration.Results),
+		len(orchestration.Children),
+		len(orchestration.Lifecycle),
+		len(orchestration.Error),
+		orchestration.SLABreached,
+		orchestration.ContinuedAs,
+	)
+	// Usage and children's links are small, they're hashed in full
+	for _, part := range []any{orchestration.Usage, orchestration.Children, orchestration.Budget} {
+		encoded, _ := json.Marshal(part)
+		_, _ = hash.Write(encoded)
+	}
+	modified := orchestration.Timestamp
+	if n := len(orchestration.Lifecycle); n > 0 && orchestration.Lifecycle[n-1].Timestamp.After(modified) {
+		modified = orchestration.Lifecycle[n-1].Timestamp
+	}
+	p.orchestrationStoreMu.RUnlock()
+
+	if log := p.LogManager.GetLog(orchestrationID); log != nil {
+		offset, appendedAt := log.Head()
+		_, _ = fmt.Fprintf(hash, "|%d", offset)
+		if appendedAt.After(modified) {
+			modified = appendedAt
+		}
+	}
+
+	return fmt.Sprintf(`W/"%016x"`, hash.Sum64()), modified, nil
+}
+
+// notModified reports whether a conditional GET's client already has the current representation. If-None-Match
+// takes precedence over If-Modified-Since, as RFC 9110 has it, and ETags are compared weakly.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
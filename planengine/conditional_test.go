@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectionConditionalGet(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	orchestration.Timestamp = time.Now().UTC().Add(-time.Minute)
+	orchestration.TaskZero = json.RawMessage(`{}`)
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{
+		"s_echo":  {ID: "s_echo", Name: "echo", ProjectID: project.ID},
+		"s_audit": {ID: "s_audit", Name: "audit", ProjectID: project.ID},
+	}
+
+	inspect := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/inspections/"+orchestration.ID, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := inspect("", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	lastModified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+	require.NoError(t, err)
+
+	t.Run("unchanged orchestrations aren't sent again", func(t *testing.T) {
+		w := inspect("If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+
+		assert.Equal(t, http.StatusNotModified, inspect("If-Modified-Since", lastModified.Format(http.TimeFormat)).Code)
+		assert.Equal(t, http.StatusOK, inspect("If-None-Match", `W/"stale"`).Code)
+	})
+
+	t.Run("progress changes the ETag", func(t *testing.T) {
+		log := app.Engine.LogManager.GetLog(orchestration.ID)
+		log.Append(orchestration.ID, NewLogEntry("task_output", "task1", json.RawMessage(`{"ok":true}`), "task1", 0), false)
+
+		w := inspect("If-None-Match", etag)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2025, 3, 1, 12, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no conditions", nil, false},
+		{"matching weak etag", map[string]string{"If-None-Match": `"abc"`}, true},
+		{"one of several etags", map[string]string{"If-None-Match": `W/"xyz", W/"abc"`}, true},
+		{"any etag", map[string]string{"If-None-Match": "*"}, true},
+		{"different etag", map[string]string{"If-None-Match": `W/"xyz"`}, false},
+		{"etag takes precedence", map[string]string{"If-None-Match": `W/"xyz"`, "If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, false},
+		{"unmodified since", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"modified since", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"unparseable date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.want, notModified(req, `W/"abc"`, modified))
+		})
+	}
+}
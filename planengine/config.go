@@ -51,10 +51,55 @@ const (
 	ProjectRegistrationFailedErrCode    = "Orra:ProjectRegistrationFailed"
 	ProjectAPIKeyAdditionFailedErrCode  = "Orra:ProjectAPIKeyAdditionFailed"
 	ProjectWebhookAdditionFailedErrCode = "Orra:ProjectWebhookAdditionFailed"
+	ProjectWebhookUpdateFailedErrCode   = "Orra:ProjectWebhookUpdateFailed"
 	UnknownOrchestrationErrCode         = "Orra:UnknownOrchestration"
 	ActionNotActionableErrCode          = "Orra:ActionNotActionable"
 	ActionCannotExecuteErrCode          = "Orra:ActionCannotExecute"
 	PlanEngineShuttingDownErrCode       = "Orra:PlanEngineShuttingDown"
+	WSTokenIssueFailedErrCode           = "Orra:WSTokenIssueFailed"
+	RateLimitExceededErrCode            = "Orra:RateLimitExceeded"
+	AuditQueryFailedErrCode             = "Orra:AuditQueryFailed"
+	ClientCertificatesDisabledErrCode   = "Orra:ClientCertificatesDisabled"
+	ClientCertificateIssueFailedErrCode = "Orra:ClientCertificateIssueFailed"
+	ProjectMemberUpdateFailedErrCode    = "Orra:ProjectMemberUpdateFailed"
+	ProjectSecurityUpdateFailedErrCode  = "Orra:ProjectSecurityUpdateFailed"
+	UnknownProjectErrCode               = "Orra:UnknownProject"
+	RequestBodyTooLargeErrCode          = "Orra:RequestBodyTooLarge"
+	UnknownRequestFieldErrCode          = "Orra:UnknownRequestField"
+	MissingRequiredFieldErrCode         = "Orra:MissingRequiredField"
+	RegistrationTokenIssueFailedErrCode = "Orra:RegistrationTokenIssueFailed"
+	UnknownScheduleErrCode              = "Orra:UnknownSchedule"
+	ScheduleUpdateFailedErrCode         = "Orra:ScheduleUpdateFailed"
+	UnknownTemplateErrCode              = "Orra:UnknownTemplate"
+	TemplateExistsErrCode               = "Orra:TemplateExists"
+	TemplateUpdateFailedErrCode         = "Orra:TemplateUpdateFailed"
+	ProjectLimitsUpdateFailedErrCode    = "Orra:ProjectLimitsUpdateFailed"
+	IdempotencyKeyConflictErrCode       = "Orra:IdempotencyKeyConflict"
+	UnknownApprovalErrCode              = "Orra:UnknownApproval"
+	UnknownDeadLetterErrCode            = "Orra:UnknownDeadLetter"
+	DeadLetterUpdateFailedErrCode       = "Orra:DeadLetterUpdateFailed"
+	ExecutionBacklogFullErrCode         = "Orra:ExecutionBacklogFull"
+	UnknownServiceErrCode               = "Orra:UnknownService"
+	WebhookDeliveryFailedErrCode        = "Orra:WebhookDeliveryFailed"
+	NotificationsUpdateFailedErrCode    = "Orra:NotificationsUpdateFailed"
+	AlertsUpdateFailedErrCode           = "Orra:AlertsUpdateFailed"
+	OrchestrationDeleteFailedErrCode    = "Orra:OrchestrationDeleteFailed"
+	ProjectUpdateFailedErrCode          = "Orra:ProjectUpdateFailed"
+	ProjectDeletionFailedErrCode        = "Orra:ProjectDeletionFailed"
+	ServiceDeregistrationFailedErrCode  = "Orra:ServiceDeregistrationFailed"
+	ServiceNameTakenErrCode             = "Orra:ServiceNameTaken"
+	UnknownServiceVersionErrCode        = "Orra:UnknownServiceVersion"
+	UnsupportedAPIVersionErrCode        = "Orra:UnsupportedAPIVersion"
+	// Codes standing for an error's kind, for errors without a more specific code
+	ValidationFailedErrCode     = "Orra:ValidationFailed"
+	InvalidRequestErrCode       = "Orra:InvalidRequest"
+	InvalidOperationErrCode     = "Orra:InvalidOperation"
+	AlreadyExistsErrCode        = "Orra:AlreadyExists"
+	NotFoundErrCode             = "Orra:NotFound"
+	UnauthenticatedErrCode      = "Orra:Unauthenticated"
+	UnauthorizedErrCode         = "Orra:Unauthorized"
+	UnsupportedMediaTypeErrCode = "Orra:UnsupportedMediaType"
+	InternalErrCode             = "Orra:Internal"
 )
 
 var (
@@ -63,6 +108,40 @@ var (
 	DependencyPattern                = regexp.MustCompile(`^\$([^.]+)\.`)
 	WSWriteTimeOut                   = time.Second * 120
 	WSMaxMessageBytes          int64 = 10 * 1024 // 10K
+	WSTokenTTL                       = 60 * time.Second
+	WSPingInterval                   = 20 * time.Second
+	WSMaxMissedPings                 = 3
+	WSAckTimeout                     = 10 * time.Second
+	WSMaxRedeliveries                = 5
+	WSResumeWindow                   = 2 * time.Minute
+	WSMaxBufferedMessages            = 1000
+	WSSendQueueSize                  = 256
+	WSSendQueueBusyThreshold         = 192
+	WSProbeTimeout                   = 5 * time.Second
+	WSProbeFailureThreshold          = 3
+	WebhookMaxAttempts               = 5
+	WebhookInitialInterval           = time.Second
+	WebhookMaxInterval               = time.Minute
+	WebhookSecretGracePeriod         = 24 * time.Hour
+	SlowTaskBaselineSize             = 200
+	SlowTaskMinSamples               = 20
+	SlowTaskDeviations               = 3.0
+	SlowTaskMinDuration              = time.Second
+	WebhookSecretMaxGrace            = 7 * 24 * time.Hour
+	WebhookDeliveryRetention         = 7 * 24 * time.Hour
+	TaskLogRetention                 = 7 * 24 * time.Hour
+	UsageRetention                   = 90 * 24 * time.Hour
+	WebhookDefaultTimeout            = 10 * time.Second
+	WebhookMaxTimeout                = time.Minute
+	WSMinChunkBytes                  = 64 * 1024 // 64K
+	WSMaxChunkedBytes          int64 = 32 << 20  // 32M
+	MaxRequestBodyBytes        int64 = 1 << 20   // 1M
+	APIKeyExpirySweepInterval        = 15 * time.Minute
+	APIKeyExpiryNoticeWindow         = 72 * time.Hour
+	AlertEvaluationInterval          = 30 * time.Second
+	RegistrationTokenTTL             = 24 * time.Hour
+	RegistrationTokenMaxTTL          = 30 * 24 * time.Hour
+	SchedulerTickInterval            = 5 * time.Second
 	AcceptedReasoningProviders       = []string{LLMOpenAIProvider, LLMGroqProvider}
 	AcceptedReasoningModels          = []string{O1MiniReasoningModel, O3MiniReasoningModel, R1ReasoningModel}
 )
@@ -71,6 +150,172 @@ type Reasoning struct {
 	Provider string `envconfig:"default=openai"`
 	Model    string `envconfig:"default=o1-mini"`
 	ApiKey   string
+	// PromptCostPerMillion and CompletionCostPerMillion price the model's tokens in USD, leave them unset to
+	// only count tokens
+	PromptCostPerMillion     float64 `envconfig:"optional"`
+	CompletionCostPerMillion float64 `envconfig:"optional"`
+}
+
+// RateLimit configures per API key limits, a zero value disables the limit
+type RateLimit struct {
+	RequestsPerSecond       float64 `envconfig:"default=20"`
+	RequestsBurst           int     `envconfig:"default=40"`
+	OrchestrationsPerMinute int     `envconfig:"default=60"`
+}
+
+// Backpressure rejects orchestrations the plan engine is too backed up to schedule, a zero threshold disables the check.
+// MaxQueuedOrchestrations bounds the orchestrations waiting for a slot across all projects, MaxServiceBacklog
+// the unfinished tasks of running and queued orchestrations any one service may have.
+type Backpressure struct {
+	MaxQueuedOrchestrations int           `envconfig:"default=1000"`
+	MaxServiceBacklog       int           `envconfig:"default=500"`
+	RetryAfter              time.Duration `envconfig:"default=30s"`
+}
+
+// Heartbeat configures the keepalive pings sent to services over their WebSocket connections. Connections missing
+// MaxMissedPings pings in a row are closed as stale, so a service's liveness timeout is PingInterval times MaxMissedPings.
+type Heartbeat struct {
+	PingInterval   time.Duration `envconfig:"default=20s"`
+	MaxMissedPings int           `envconfig:"default=3"`
+}
+
+// TaskDelivery configures redelivery of tasks services haven't acknowledged within AckTimeout of receiving them.
+// Tasks still unacknowledged after MaxRedeliveries are left to the task's own timeout and retries.
+// With a LeaseTTL, acknowledged tasks are leased to their service instance, which renews the lease with heartbeats
+// or status reports. Tasks whose lease expires are redelivered. The SDKs send heartbeats every 10s, so LeaseTTL
+// should allow for a few missed ones. Leases are disabled by default.
+type TaskDelivery struct {
+	AckTimeout      time.Duration `envconfig:"default=10s"`
+	MaxRedeliveries int           `envconfig:"default=5"`
+	LeaseTTL        time.Duration `envconfig:"optional"`
+}
+
+// HealthProbe configures probing connected services every Interval, to check they're still handling messages
+// and not only keeping their connection alive. Instances failing FailureThreshold probes in a row, i.e. not answering
+// within Timeout, are degraded and a service with all its instances degraded isn't dispatched new tasks until one
+// recovers. Probes are disabled by default, as services predating them can't answer.
+type HealthProbe struct {
+	Interval         time.Duration `envconfig:"optional"`
+	Timeout          time.Duration `envconfig:"default=5s"`
+	FailureThreshold int           `envconfig:"default=3"`
+}
+
+// WebhookRetry configures retrying project events a webhook fails to accept, with exponential backoff from
+// InitialInterval up to MaxInterval. Events still undelivered after MaxAttempts are dead-lettered for re-driving.
+type WebhookRetry struct {
+	MaxAttempts     int           `envconfig:"default=5"`
+	InitialInterval time.Duration `envconfig:"default=1s"`
+	MaxInterval     time.Duration `envconfig:"default=1m"`
+}
+
+// WebhookAddresses keeps webhooks to public addresses, so they can't reach the plan engine's own network.
+// AllowPrivate lifts this for local development, where webhook receivers run alongside the plan engine.
+type WebhookAddresses struct {
+	AllowPrivate bool `envconfig:"optional"`
+}
+
+// SlowTasks flags tasks running far longer than their service usually takes. Each service's last BaselineSize task
+// durations are its baseline, once it has MinSamples of them tasks taking more than Deviations standard deviations
+// over its mean, and at least MinDuration, are marked slow in their orchestration's timeline. With Webhook set they're
+// also announced to the project's webhooks as task.slow events.
+type SlowTasks struct {
+	BaselineSize int           `envconfig:"default=200"`
+	MinSamples   int           `envconfig:"default=20"`
+	Deviations   float64       `envconfig:"default=3"`
+	MinDuration  time.Duration `envconfig:"default=1s"`
+	Webhook      bool          `envconfig:"optional"`
+}
+
+// Reconnection configures how long messages are buffered for a disconnected service, for it to resume its
+// connection within ResumeWindow and receive them. A service's outbox holds at most MaxBufferedMessages.
+type Reconnection struct {
+	ResumeWindow        time.Duration `envconfig:"default=2m"`
+	MaxBufferedMessages int           `envconfig:"default=1000"`
+}
+
+// SendQueue bounds the messages queued for each service connection, messages past Size are dropped and their
+// tasks retried. A service whose connections all have BusyThreshold messages queued is busy, so its new tasks
+// are held back until it catches up.
+type SendQueue struct {
+	Size          int `envconfig:"default=256"`
+	BusyThreshold int `envconfig:"default=192"`
+}
+
+// NATS relays tasks and results through a NATS server for services consuming tasks from subjects, disabled without a URL
+type NATS struct {
+	URL           string `envconfig:"optional"`
+	SubjectPrefix string `envconfig:"default=orra"`
+}
+
+// Audit configures where control plane audit events are recorded.
+// Sinks is a comma separated list of db, file and syslog, only the db sink can be queried through the API.
+type Audit struct {
+	Sinks         []string `envconfig:"default=db"`
+	FilePath      string   `envconfig:"optional"`
+	SyslogNetwork string   `envconfig:"optional"`
+	SyslogAddress string   `envconfig:"optional"`
+}
+
+// TLS enables HTTPS and, with a client CA, mutual TLS for the HTTP API and /ws endpoint.
+// ClientAuth is one of none, optional or require. The CA key is only needed to issue client certificates.
+type TLS struct {
+	CertFile        string        `envconfig:"optional"`
+	KeyFile         string        `envconfig:"optional"`
+	ClientCAFile    string        `envconfig:"optional"`
+	ClientCAKeyFile string        `envconfig:"optional"`
+	ClientAuth      string        `envconfig:"default=none"`
+	ClientCertTTL   time.Duration `envconfig:"default=2160h"`
+}
+
+// OIDC enables user sign in with ID tokens from an OpenID Connect provider
+type OIDC struct {
+	IssuerURL string `envconfig:"optional"`
+	ClientID  string `envconfig:"optional"`
+}
+
+// Encryption enables envelope encryption of orchestration payloads at rest.
+// Master keys are base64 encoded 32 byte AES keys, previous keys are kept to read data sealed before a rotation.
+type Encryption struct {
+	MasterKey          string   `envconfig:"optional"`
+	PreviousMasterKeys []string `envconfig:"optional"`
+}
+
+// Admin configures the credential for the /admin API, kept separate from project API keys.
+// Without an APIKey the key is read from KeyFile, defaulting to admin.key in the config directory, and generated on first start.
+type Admin struct {
+	APIKey  string `envconfig:"optional"`
+	KeyFile string `envconfig:"optional"`
+}
+
+// MetricsEndpoint configures the Prometheus /metrics endpoint, it's only protected when a bearer Token is set
+type MetricsEndpoint struct {
+	Token string `envconfig:"optional"`
+}
+
+// Tracing exports orchestration traces to an OTLP/HTTP collector, e.g. http://localhost:4318. Tracing is off
+// without an Endpoint.
+type Tracing struct {
+	Endpoint    string `envconfig:"optional"`
+	ServiceName string `envconfig:"default=orra-plan-engine"`
+}
+
+// Docs serves Swagger UI on /docs from SwaggerUIDir, a copy of the swagger-ui-dist package pinned by whoever installs
+// it, so browsing the API loads no third party scripts. Without it /docs only links to the OpenAPI specification.
+type Docs struct {
+	SwaggerUIDir string `envconfig:"optional"`
+}
+
+// Profiling serves the runtime profiles under /admin/debug/pprof/ on their own listener, bound to Addr. It defaults
+// to localhost so profiles, which expose the program's memory and command line, aren't reachable from the network.
+// Requests still need the admin key.
+type Profiling struct {
+	Addr     string `envconfig:"default=localhost:6060"`
+	Disabled bool   `envconfig:"optional"`
+}
+
+// Dashboard serves the web dashboard on /dashboard/, it's on unless Disabled
+type Dashboard struct {
+	Disabled bool `envconfig:"optional"`
 }
 
 type PlanCache struct {
@@ -79,11 +324,35 @@ type PlanCache struct {
 
 type Config struct {
 	Port                  int `envconfig:"default=8005"`
+	GRPCPort              int `envconfig:"optional"`
 	Reasoning             Reasoning
 	PlanCache             PlanCache
+	RateLimit             RateLimit
+	Backpressure          Backpressure
+	Heartbeat             Heartbeat
+	TaskDelivery          TaskDelivery
+	HealthProbe           HealthProbe
+	Reconnection          Reconnection
+	SendQueue             SendQueue
+	NATS                  NATS
+	WebhookRetry          WebhookRetry
+	WebhookAddresses      WebhookAddresses
+	SlowTasks             SlowTasks
+	Audit                 Audit
+	TLS                   TLS
+	OIDC                  OIDC
+	Encryption            Encryption
+	Admin                 Admin
+	Metrics               MetricsEndpoint
+	Tracing               Tracing
+	Dashboard             Dashboard
+	Docs                  Docs
+	Profiling             Profiling
 	PddlValidatorPath     string        `envconfig:"default=/usr/local/bin/Validate"`
 	PddlValidationTimeout time.Duration `envconfig:"default=30s"`
+	IdempotencyWindow     time.Duration `envconfig:"default=24h"`
 	StoragePath           string        `envconfig:"optional"`
+	TrustedProxies        []string      `envconfig:"optional"`
 }
 
 func Load() (Config, error) {
@@ -95,6 +364,12 @@ func Load() (Config, error) {
 	if err := validateReasoningConfig(cfg.Reasoning); err != nil {
 		return Config{}, err
 	}
+	if err := validateTLSConfig(cfg.TLS); err != nil {
+		return Config{}, err
+	}
+	if cfg.OIDC.IssuerURL != "" && cfg.OIDC.ClientID == "" {
+		return Config{}, fmt.Errorf("an OIDC client ID is required when an OIDC issuer is configured")
+	}
 	if cfg.StoragePath != "" {
 		return cfg, nil
 	}
@@ -106,6 +381,19 @@ func Load() (Config, error) {
 	return cfg, err
 }
 
+func validateTLSConfig(cfg TLS) error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("both a TLS certificate and key file are required to enable TLS")
+	}
+	if cfg.ClientAuth != ClientAuthNone && cfg.CertFile == "" {
+		return fmt.Errorf("TLS client auth [%s] requires TLS to be enabled", cfg.ClientAuth)
+	}
+	if cfg.ClientAuth != ClientAuthNone && cfg.ClientCAFile == "" {
+		return fmt.Errorf("TLS client auth [%s] requires a client CA file", cfg.ClientAuth)
+	}
+	return nil
+}
+
 func validateReasoningConfig(reasoning Reasoning) error {
 	if !slices.Contains(AcceptedReasoningProviders, reasoning.Provider) {
 		return fmt.Errorf(
@@ -122,6 +410,9 @@ func validateReasoningConfig(reasoning Reasoning) error {
 	if reasoning.ApiKey == "" {
 		return fmt.Errorf("reasoning api key is required")
 	}
+	if reasoning.PromptCostPerMillion < 0 || reasoning.CompletionCostPerMillion < 0 {
+		return fmt.Errorf("reasoning token costs cannot be negative")
+	}
 	return nil
 }
 
@@ -145,6 +436,10 @@ const (
 	NotActionable
 	Paused
 	Cancelled
+	TimedOut
+	Scheduled
+	Queued
+	Skipped
 )
 
 func (s Status) String() string {
@@ -167,6 +462,14 @@ func (s Status) String() string {
 		return "paused"
 	case Cancelled:
 		return "cancelled"
+	case TimedOut:
+		return "timed_out"
+	case Scheduled:
+		return "scheduled"
+	case Queued:
+		return "queued"
+	case Skipped:
+		return "skipped"
 	default:
 		return ""
 	}
@@ -200,6 +503,14 @@ func (s *Status) UnmarshalJSON(data []byte) error {
 		*s = Paused
 	case "cancelled":
 		*s = Cancelled
+	case "timed_out":
+		*s = TimedOut
+	case "scheduled":
+		*s = Scheduled
+	case "queued":
+		*s = Queued
+	case "skipped":
+		*s = Skipped
 	default:
 		return fmt.Errorf("invalid Status: %s", s)
 	}
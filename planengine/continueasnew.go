@@ -0,0 +1,128 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// maxContinuations bounds how many times a chain of orchestrations may continue as new
+const maxContinuations = 1000
+
+var ErrCannotContinueAsNew = errors.New("orchestration cannot continue as new")
+
+// ContinueAsNew is a task's request for its orchestration to carry on as a fresh orchestration once it completes.
+// Params checkpoint the state to carry over, replacing the values of the orchestration's own params.
+// Iterative orchestrations, e.g. agent loops, use it to keep each orchestration's history bounded.
+type ContinueAsNew struct {
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// ContinuationChain links an orchestration to the ones before and after it in a chain of continuations
+type ContinuationChain struct {
+	Iteration int    `json:"iteration"`
+	Previous  string `json:"previous,omitempty"`
+	Next      string `json:"next,omitempty"`
+}
+
+// requestContinueAsNew records a task's request to continue its orchestration as new, params requested
+// by later tasks override those requested by earlier ones.
+func (p *PlanEngine) requestContinueAsNew(orchestrationID string, request *ContinueAsNew) error {
+	p.orchestrationStoreMu.Lock()
+	defer p.orchestrationStoreMu.Unlock()
+
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	switch {
+	case !exists:
+		return ErrOrchestrationNotFound
+	case orchestration.ParentID != "":
+		return fmt.Errorf("%w: sub-orchestrations complete with their parent", ErrCannotContinueAsNew)
+	case orchestration.Continuation+1 >= maxContinuations:
+		return fmt.Errorf("%w: the chain has reached its limit of %d orchestrations", ErrCannotContinueAsNew, maxContinuations)
+	}
+	for field := range request.Params {
+		if !slices.ContainsFunc(orchestration.Params, func(param ActionParam) bool { return param.Field == field }) {
+			return fmt.Errorf("%w: unknown param %q", ErrCannotContinueAsNew, field)
+		}
+	}
+
+	if orchestration.ContinueAsNew == nil {
+		orchestration.ContinueAsNew = &ContinueAsNew{}
+	}
+	if len(request.Params) > 0 {
+		if orchestration.ContinueAsNew.Params == nil {
+			orchestration.ContinueAsNew.Params = make(map[string]any, len(request.Params))
+		}
+		maps.Copy(orchestration.ContinueAsNew.Params, request.Params)
+	}
+
+	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		return fmt.Errorf("failed to persist continue as new request: %w", err)
+	}
+	return nil
+}
+
+// continueAsNew starts the next orchestration of a completed orchestration's chain, if any of its tasks requested one.
+// The next orchestration reuses the plan with the requested params and starts with an empty log.
+func (p *PlanEngine) continueAsNew(orchestrationID string) {
+	p.orchestrationStoreMu.Lock()
+	source, exists := p.orchestrationStore[orchestrationID]
+	if !exists || source.ContinueAsNew == nil || source.ContinuedAs != "" {
+		p.orchestrationStoreMu.Unlock()
+		return
+	}
+
+	next := p.newRunOf(source)
+	next.ContinuedFrom = source.ID
+	next.Continuation = source.Continuation + 1
+	if err := overrideParams(next, source.ContinueAsNew.Params); err != nil {
+		p.orchestrationStoreMu.Unlock()
+		p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Cannot continue orchestration as new")
+		return
+	}
+	source.ContinuedAs = next.ID
+	p.orchestrationStoreMu.Unlock()
+
+	p.scheduleSLA(next)
+	p.orchestrationStoreMu.Lock()
+	p.orchestrationStore[next.ID] = next
+	p.orchestrationStoreMu.Unlock()
+
+	if err := p.orchestrationStorage.StoreOrchestration(next); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Failed to persist continued orchestration")
+		return
+	}
+
+	p.Logger.Info().
+		Str("OrchestrationID", orchestrationID).
+		Str("ContinuedAs", next.ID).
+		Int("Iteration", next.Continuation).
+		Msg("Orchestration continued as new")
+
+	// The completed orchestration's workers stop once it's finalized, so the next one can't share their context
+	p.DispatchOrchestration(context.Background(), next)
+}
+
+// orchestrationChain returns the orchestration's place in its chain of continuations, if it's part of one
+func (p *PlanEngine) orchestrationChain(orchestrationID string) *ContinuationChain {
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists || (orchestration.ContinuedFrom == "" && orchestration.ContinuedAs == "") {
+		return nil
+	}
+	return &ContinuationChain{
+		Iteration: orchestration.Continuation,
+		Previous:  orchestration.ContinuedFrom,
+		Next:      orchestration.ContinuedAs,
+	}
+}
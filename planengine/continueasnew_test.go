@@ -0,0 +1,70 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinueAsNew(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	// Keep continued orchestrations queued behind the running one
+	project.Limits.MaxConcurrentOrchestrations = 1
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	orchestration.Params = ActionParams{{Field: "cursor", Value: float64(0)}, {Field: "goal", Value: "summarise"}}
+	orchestration.TaskZero = json.RawMessage(`{"cursor":0,"goal":"summarise"}`)
+	app.Engine.runningOrchestrations[orchestration.ID] = project.ID
+	app.Engine.runningCounts[project.ID] = 1
+
+	t.Run("tasks can only checkpoint params of the orchestration", func(t *testing.T) {
+		err := app.Engine.requestContinueAsNew(orchestration.ID, &ContinueAsNew{Params: map[string]any{"page": 2}})
+		assert.ErrorIs(t, err, ErrCannotContinueAsNew)
+		assert.Nil(t, orchestration.ContinueAsNew)
+	})
+
+	require.NoError(t, app.Engine.requestContinueAsNew(orchestration.ID, &ContinueAsNew{Params: map[string]any{"cursor": float64(10)}}))
+	require.NoError(t, app.Engine.requestContinueAsNew(orchestration.ID, &ContinueAsNew{Params: map[string]any{"cursor": float64(20)}}))
+
+	app.Engine.continueAsNew(orchestration.ID)
+	app.Engine.continueAsNew(orchestration.ID)
+
+	require.NotEmpty(t, orchestration.ContinuedAs)
+	next, err := app.Engine.getOrchestration(orchestration.ContinuedAs)
+	require.NoError(t, err)
+
+	assert.Equal(t, orchestration.ID, next.ContinuedFrom)
+	assert.Equal(t, 1, next.Continuation)
+	assert.Equal(t, Queued, next.Status)
+	assert.Nil(t, next.ContinueAsNew, "the next orchestration continues only if its own tasks ask to")
+	assert.Equal(t, ActionParams{{Field: "cursor", Value: float64(20)}, {Field: "goal", Value: "summarise"}}, next.Params)
+	assert.JSONEq(t, `{"cursor":20,"goal":"summarise"}`, string(next.TaskZero))
+	assert.Len(t, app.Engine.orchestrationQueues[project.ID], 1, "an orchestration continues as new once")
+
+	assert.Equal(t, &ContinuationChain{Iteration: 0, Next: next.ID}, app.Engine.orchestrationChain(orchestration.ID))
+	assert.Equal(t, &ContinuationChain{Iteration: 1, Previous: orchestration.ID}, app.Engine.orchestrationChain(next.ID))
+
+	t.Run("sub-orchestrations cannot continue as new", func(t *testing.T) {
+		child := setupRunningOrchestration(t, app, project.ID)
+		child.ParentID = orchestration.ID
+		err := app.Engine.requestContinueAsNew(child.ID, &ContinueAsNew{})
+		assert.ErrorIs(t, err, ErrCannotContinueAsNew)
+	})
+
+	t.Run("chains are bounded", func(t *testing.T) {
+		last := setupRunningOrchestration(t, app, project.ID)
+		last.Continuation = maxContinuations - 1
+		err := app.Engine.requestContinueAsNew(last.ID, &ContinueAsNew{})
+		assert.ErrorIs(t, err, ErrCannotContinueAsNew)
+	})
+}
@@ -0,0 +1,213 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	dashboardPath         = "/dashboard/"
+	defaultOverviewWindow = 24 * time.Hour
+	maxOverviewWindow     = 30 * 24 * time.Hour
+	// dashboardCSP only lets the dashboard load its own assets and call the plan engine's API
+	dashboardCSP = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'"
+)
+
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+// liveStatuses are the statuses of orchestrations that haven't finished yet
+var liveStatuses = []Status{Preparing, Pending, Processing, Paused, Queued, Scheduled}
+
+// ServiceOverview is a service's connectivity, and how its tasks fared over the overview's window
+type ServiceOverview struct {
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	Type           ServiceType `json:"type"`
+	Connected      bool        `json:"connected"`
+	Instances      int         `json:"instances"`
+	Draining       bool        `json:"draining,omitempty"`
+	Degraded       bool        `json:"degraded,omitempty"`
+	CompletedTasks int         `json:"completedTasks"`
+	FailedTasks    int         `json:"failedTasks"`
+	FailureRate    float64     `json:"failureRate"`
+}
+
+// ProjectOverview summarises a project's orchestrations and services, orchestrations are counted from Since
+type ProjectOverview struct {
+	Since          time.Time           `json:"since"`
+	Orchestrations map[string]int      `json:"orchestrations"`
+	Finished       int                 `json:"finished"`
+	Failed         int                 `json:"failed"`
+	FailureRate    float64             `json:"failureRate"`
+	Live           []OrchestrationView `json:"live"`
+	Services       []ServiceOverview   `json:"services"`
+}
+
+// ProjectOverview counts the project's orchestrations accepted since the window started by status, and the
+// outcomes of their tasks by service. Live orchestrations are listed however long ago they were accepted.
+func (p *PlanEngine) ProjectOverview(projectID string, window time.Duration) ProjectOverview {
+	overview := ProjectOverview{
+		Since:          time.Now().UTC().Add(-window),
+		Orchestrations: map[string]int{},
+		Live:           []OrchestrationView{},
+		Services:       []ServiceOverview{},
+	}
+
+	taskOutcomes := map[string]*ServiceOverview{}
+	for _, o := range p.getProjectOrchestrations(projectID) {
+		p.orchestrationStoreMu.RLock()
+		status, timestamp := o.Status, o.Timestamp
+		view := OrchestrationView{
+			ID:        o.ID,
+			Action:    o.Action.Content,
+			Status:    o.Status,
+			Priority:  o.Priority,
+			Timestamp: o.Timestamp,
+			RunAt:     o.RunAt,
+			Labels:    o.Labels,
+		}
+		p.orchestrationStoreMu.RUnlock()
+
+		if slices.Contains(liveStatuses, status) {
+			overview.Live = append(overview.Live, view)
+		}
+		if timestamp.Before(overview.Since) {
+			continue
+		}
+
+		overview.Orchestrations[status.String()]++
+		switch status {
+		case Completed, Cancelled, NotActionable:
+			overview.Finished++
+		case Failed, TimedOut:
+			overview.Finished++
+			overview.Failed++
+		}
+		p.countTaskOutcomes(o.ID, taskOutcomes)
+	}
+	overview.FailureRate = failureRate(overview.Failed, overview.Finished)
+
+	services, _ := p.discoverProjectServices(projectID)
+	for _, service := range services {
+		summary := ServiceOverview{ID: service.ID, Name: service.Name, Type: service.Type}
+		if outcomes, ok := taskOutcomes[service.ID]; ok {
+			summary.CompletedTasks, summary.FailedTasks = outcomes.CompletedTasks, outcomes.FailedTasks
+			summary.FailureRate = failureRate(summary.FailedTasks, summary.CompletedTasks+summary.FailedTasks)
+		}
+		if wsm := p.WebSocketManager; wsm != nil {
+			summary.Connected = wsm.IsServiceHealthy(service.ID)
+			summary.Instances = len(wsm.instanceSessions(service.ID))
+			summary.Draining = wsm.IsServiceDraining(service.ID)
+			summary.Degraded = wsm.IsServiceDegraded(service.ID)
+		}
+		overview.Services = append(overview.Services, summary)
+	}
+
+	sort.Slice(overview.Services, func(i, j int) bool {
+		return overview.Services[i].Name < overview.Services[j].Name
+	})
+	return overview
+}
+
+// countTaskOutcomes adds the orchestration's completed and failed task attempts, from its log, to each
+// service's outcomes
+func (p *PlanEngine) countTaskOutcomes(orchestrationID string, outcomes map[string]*ServiceOverview) {
+	if p.LogManager == nil {
+		return
+	}
+	log := p.LogManager.GetLog(orchestrationID)
+	if log == nil {
+		return
+	}
+
+	for _, event := range taskTimelineEvents(log.ReadFrom(0)) {
+		if event.ServiceID == "" {
+			continue
+		}
+		service, ok := outcomes[event.ServiceID]
+		if !ok {
+			service = &ServiceOverview{}
+			outcomes[event.ServiceID] = service
+		}
+		switch event.Type {
+		case taskEventType(Completed):
+			service.CompletedTasks++
+		case taskEventType(Failed), taskEventType(TimedOut):
+			service.FailedTasks++
+		}
+	}
+}
+
+func failureRate(failed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+// ProjectOverviewHandler summarises the project's orchestrations and services for the dashboard. The window
+// defaults to a day, e.g. ?window=1h narrows it.
+func (app *App) ProjectOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	window := defaultOverviewWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		window, err = time.ParseDuration(value)
+		if err != nil || window <= 0 || window > maxOverviewWindow {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("window"), "window must be a duration up to 720h, e.g. 1h"))
+			return
+		}
+	}
+
+	overview := app.Engine.ProjectOverview(project.ID, window)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(overview); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
+
+// DashboardHandler serves the embedded dashboard. It's a single page app, so paths that aren't one of its
+// assets serve its index page. The dashboard asks for an API key, and only sees what the key's role allows.
+func (app *App) DashboardHandler() http.Handler {
+	assets, err := fs.Sub(dashboardAssets, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix(dashboardPath, http.FileServer(http.FS(assets)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", dashboardCSP)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		name := path.Clean(r.URL.Path[len(dashboardPath)-1:])
+		if _, err := fs.Stat(assets, name[1:]); name == "/" || err != nil {
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeFileFS(w, r, assets, "index.html")
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
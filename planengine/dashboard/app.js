@@ -0,0 +1,243 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+'use strict';
+
+const API_KEY = 'orra.dashboard.apiKey';
+const WINDOW = 'orra.dashboard.window';
+const REFRESH_INTERVAL_MS = 5000;
+
+let refreshTimer = null;
+
+// el builds an element, children are nodes or strings which are added as text, never as markup
+function el(tag, attrs = {}, ...children) {
+	const node = document.createElement(tag);
+	for (const [key, value] of Object.entries(attrs)) {
+		if (value === undefined || value === null || value === false) continue;
+		if (key === 'className') node.className = value;
+		else if (key.startsWith('on')) node.addEventListener(key.slice(2), value);
+		else node.setAttribute(key, value);
+	}
+	for (const child of children.flat()) {
+		if (child === undefined || child === null) continue;
+		node.append(child instanceof Node ? child : String(child));
+	}
+	return node;
+}
+
+class UnauthorizedError extends Error {}
+
+async function api(path) {
+	const response = await fetch(path, {
+		headers: { Authorization: `Bearer ${sessionStorage.getItem(API_KEY)}` },
+	});
+	if (response.status === 401 || response.status === 403) {
+		throw new UnauthorizedError('The API key was rejected');
+	}
+	const body = await response.json().catch(() => ({}));
+	if (!response.ok) {
+		throw new Error(body.error?.message || `${path} failed with ${response.status}`);
+	}
+	return body;
+}
+
+// formatDuration formats a Go duration, which is serialised in nanoseconds
+function formatDuration(ns, zero = '-') {
+	if (!ns) return zero;
+	const ms = ns / 1e6;
+	if (ms < 1000) return `${Math.round(ms)}ms`;
+	const s = ms / 1000;
+	if (s < 60) return `${s.toFixed(1)}s`;
+	const m = Math.floor(s / 60);
+	if (m < 60) return `${m}m${Math.round(s % 60)}s`;
+	return `${Math.floor(m / 60)}h${m % 60}m`;
+}
+
+function formatTime(timestamp) {
+	return timestamp ? new Date(timestamp).toLocaleString() : '-';
+}
+
+function percent(rate) {
+	return `${(rate * 100).toFixed(1)}%`;
+}
+
+function statusBadge(status) {
+	return el('span', { className: `badge status-${status}` }, status.replaceAll('_', ' '));
+}
+
+function orchestrationLink(id) {
+	return el('a', { href: `#/orchestrations/${encodeURIComponent(id)}` }, id);
+}
+
+function table(headings, rows, empty) {
+	if (rows.length === 0) return el('p', { className: 'empty' }, empty);
+	return el('table', {},
+		el('thead', {}, el('tr', {}, headings.map((h) => el('th', {}, h)))),
+		el('tbody', {}, rows.map((cells) => el('tr', {}, cells.map((c) => el('td', {}, c))))),
+	);
+}
+
+function card(label, value, className) {
+	return el('div', { className: `card ${className || ''}` }, el('span', { className: 'label' }, label), el('strong', {}, value));
+}
+
+async function renderOverview() {
+	const period = sessionStorage.getItem(WINDOW) || '24h';
+	const overview = await api(`/overview?window=${encodeURIComponent(period)}`);
+	const connected = overview.services.filter((s) => s.connected).length;
+
+	return el('div', {},
+		el('section', { className: 'cards' },
+			card('Live orchestrations', overview.live.length),
+			card('Finished', overview.finished),
+			card('Failed', overview.failed, overview.failed ? 'bad' : ''),
+			card('Failure rate', percent(overview.failureRate), overview.failureRate > 0.1 ? 'bad' : ''),
+			card('Services connected', `${connected}/${overview.services.length}`, connected < overview.services.length ? 'warn' : ''),
+		),
+		el('section', {},
+			el('h2', {}, 'Live orchestrations'),
+			table(['ID', 'Action', 'Status', 'Accepted'], overview.live.map((o) => [
+				orchestrationLink(o.id), o.action, statusBadge(o.status), formatTime(o.timestamp),
+			]), 'No orchestrations are running.'),
+		),
+		el('section', {},
+			el('h2', {}, 'Services'),
+			table(['Service', 'Type', 'Connectivity', 'Instances', 'Completed tasks', 'Failed tasks', 'Failure rate'],
+				overview.services.map((s) => [
+					el('span', { title: s.id }, s.name),
+					s.type,
+					connectivityBadge(s),
+					s.instances,
+					s.completedTasks,
+					s.failedTasks,
+					percent(s.failureRate),
+				]), 'No services are registered.'),
+		),
+		el('section', {},
+			el('h2', {}, 'Orchestrations by status'),
+			table(['Status', 'Count'], Object.entries(overview.orchestrations)
+				.sort(([, a], [, b]) => b - a)
+				.map(([status, count]) => [statusBadge(status), count]), 'No orchestrations in this window.'),
+		),
+	);
+}
+
+function connectivityBadge(service) {
+	if (!service.connected) return el('span', { className: 'badge bad' }, 'disconnected');
+	if (service.degraded) return el('span', { className: 'badge warn' }, 'degraded');
+	if (service.draining) return el('span', { className: 'badge warn' }, 'draining');
+	return el('span', { className: 'badge ok' }, 'connected');
+}
+
+async function renderOrchestration(id) {
+	const path = encodeURIComponent(id);
+	const [inspection, timeline, logs] = await Promise.all([
+		api(`/orchestrations/inspections/${path}`),
+		api(`/orchestrations/${path}/timeline`),
+		api(`/orchestrations/${path}/logs?limit=200`),
+	]);
+
+	return el('div', {},
+		el('a', { href: '#/', className: 'back' }, '← Overview'),
+		el('h1', {}, inspection.id, ' ', statusBadge(inspection.status)),
+		el('p', { className: 'action' }, inspection.action),
+		el('section', { className: 'cards' },
+			card('Accepted', formatTime(inspection.timestamp)),
+			card('Duration', formatDuration(timeline.duration || inspection.duration)),
+			card('Tasks', (inspection.tasks || []).length),
+			inspection.parentId ? card('Parent', orchestrationLink(inspection.parentId)) : null,
+		),
+		inspection.error ? el('pre', { className: 'error' }, JSON.stringify(inspection.error, null, 2)) : null,
+		el('section', {},
+			el('h2', {}, 'Tasks'),
+			table(['Task', 'Service', 'Status', 'Duration', 'Error'], (inspection.tasks || []).map((t) => [
+				t.childOrchestrationId ? orchestrationLink(t.childOrchestrationId) : t.id,
+				t.serviceName || t.serviceId,
+				statusBadge(t.status),
+				formatDuration(t.duration),
+				t.error || '',
+			]), 'No tasks yet.'),
+		),
+		el('section', {},
+			el('h2', {}, 'Timeline'),
+			table(['Elapsed', 'Event', 'Task', 'Took', 'Details'], (timeline.events || []).map((e) => [
+				formatDuration(e.elapsed, '0ms'),
+				e.type,
+				e.taskId || '',
+				formatDuration(e.duration),
+				[e.instance, e.webhook, e.statusCode, e.error].filter(Boolean).join(' · '),
+			]), 'No events recorded.'),
+		),
+		el('section', {},
+			el('h2', {}, 'Logs'),
+			table(['Time', 'Level', 'Task', 'Message'], logs.map((l) => [
+				formatTime(l.timestamp),
+				el('span', { className: `badge level-${l.level}` }, l.level),
+				l.taskId || '',
+				l.message,
+			]), 'No logs were streamed by its services.'),
+		),
+	);
+}
+
+// render builds the view the location's hash points to, show refreshes it every REFRESH_INTERVAL_MS
+function render() {
+	const match = location.hash.match(/^#\/orchestrations\/(.+)$/);
+	if (match) {
+		return renderOrchestration(decodeURIComponent(match[1]));
+	}
+	return renderOverview();
+}
+
+async function show() {
+	clearTimeout(refreshTimer);
+	const signedIn = Boolean(sessionStorage.getItem(API_KEY));
+	document.getElementById('sign-in').hidden = signedIn;
+	document.getElementById('sign-out').hidden = !signedIn;
+	const view = document.getElementById('view');
+	if (!signedIn) {
+		view.replaceChildren();
+		return;
+	}
+
+	try {
+		view.replaceChildren(await render());
+	} catch (error) {
+		if (error instanceof UnauthorizedError) {
+			sessionStorage.removeItem(API_KEY);
+			document.getElementById('sign-in-error').textContent = error.message;
+			return show();
+		}
+		view.replaceChildren(el('p', { className: 'error' }, error.message));
+	}
+	refreshTimer = setTimeout(show, REFRESH_INTERVAL_MS);
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+	const windowSelect = document.getElementById('window');
+	windowSelect.value = sessionStorage.getItem(WINDOW) || '24h';
+	windowSelect.addEventListener('change', () => {
+		sessionStorage.setItem(WINDOW, windowSelect.value);
+		show();
+	});
+
+	document.getElementById('sign-in-form').addEventListener('submit', (event) => {
+		event.preventDefault();
+		const input = document.getElementById('api-key');
+		sessionStorage.setItem(API_KEY, input.value.trim());
+		input.value = '';
+		document.getElementById('sign-in-error').textContent = '';
+		show();
+	});
+
+	document.getElementById('sign-out').addEventListener('click', () => {
+		sessionStorage.removeItem(API_KEY);
+		show();
+	});
+
+	window.addEventListener('hashchange', show);
+	show();
+});
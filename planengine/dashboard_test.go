@@ -0,0 +1,132 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectOverview(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	app.Engine.WebSocketManager = wsm
+
+	payments := &ServiceInfo{ID: "s_payments", Name: "Payments", Type: Service, ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	shipping := &ServiceInfo{ID: "s_shipping", Name: "Shipping", Type: Service, ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{payments.ID: payments, shipping.ID: shipping}
+	s := &callbackSession{wsm: wsm, serviceID: payments.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	s.Set(WSInstanceQueryParam, "i_1")
+	wsm.HandleConnection(payments.ID, payments.Name, s)
+
+	now := time.Now().UTC()
+	for _, o := range []*Orchestration{
+		{ID: "o_running", Status: Processing, Timestamp: now.Add(-time.Minute)},
+		{ID: "o_done", Status: Completed, Timestamp: now.Add(-time.Hour)},
+		{ID: "o_broken", Status: Failed, Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "o_old", Status: Failed, Timestamp: now.Add(-48 * time.Hour)},
+		{ID: "o_other_project", Status: Processing, Timestamp: now},
+	} {
+		o.ProjectID = project.ID
+		if o.ID == "o_other_project" {
+			o.ProjectID = "p_other"
+		}
+		o.Plan = &ExecutionPlan{Tasks: []*SubTask{{ID: "task1", Service: payments.ID}}}
+		app.Engine.orchestrationStore[o.ID] = o
+		logManager.PrepLogForOrchestration(o.ProjectID, o.ID, o.Plan)
+	}
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_done", "task1", payments.ID, Completed, nil, now, 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_broken", "task1", payments.ID, Failed, errors.New("card declined"), now, 1))
+
+	getOverview := func(query string) (int, ProjectOverview) {
+		req := httptest.NewRequest(http.MethodGet, "/overview"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+
+		var overview ProjectOverview
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&overview))
+		}
+		return rr.Code, overview
+	}
+
+	t.Run("summarises the window's orchestrations and the project's services", func(t *testing.T) {
+		code, overview := getOverview("")
+		require.Equal(t, http.StatusOK, code)
+
+		assert.Equal(t, map[string]int{"processing": 1, "completed": 1, "failed": 1}, overview.Orchestrations)
+		assert.Equal(t, 2, overview.Finished)
+		assert.Equal(t, 1, overview.Failed)
+		assert.Equal(t, 0.5, overview.FailureRate)
+		require.Len(t, overview.Live, 1)
+		assert.Equal(t, "o_running", overview.Live[0].ID)
+
+		require.Len(t, overview.Services, 2)
+		assert.Equal(t, ServiceOverview{
+			ID: payments.ID, Name: "Payments", Type: Service, Connected: true, Instances: 1,
+			CompletedTasks: 1, FailedTasks: 1, FailureRate: 0.5,
+		}, overview.Services[0])
+		assert.Equal(t, ServiceOverview{ID: shipping.ID, Name: "Shipping", Type: Service}, overview.Services[1])
+	})
+
+	t.Run("narrows to the window", func(t *testing.T) {
+		_, overview := getOverview("?window=90m")
+		assert.Equal(t, map[string]int{"processing": 1, "completed": 1}, overview.Orchestrations)
+		assert.Zero(t, overview.FailureRate)
+	})
+
+	t.Run("rejects invalid windows", func(t *testing.T) {
+		code, _ := getOverview("?window=forever")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestDashboardAssets(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/dashboard")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, dashboardPath, rr.Header().Get("Location"))
+
+	rr = get("/dashboard/")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<title>orra dashboard</title>")
+	assert.Equal(t, dashboardCSP, rr.Header().Get("Content-Security-Policy"))
+
+	rr = get("/dashboard/app.js")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "javascript")
+
+	rr = get("/dashboard/orchestrations/o_1")
+	require.Equal(t, http.StatusOK, rr.Code, "the app's own paths serve its index page")
+	assert.Contains(t, rr.Body.String(), "<title>orra dashboard</title>")
+
+	rr = get("/dashboard/../app.go")
+	assert.NotContains(t, rr.Body.String(), "package main")
+}
@@ -8,6 +8,7 @@ package main
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/rs/zerolog"
@@ -16,6 +17,11 @@ import (
 type BadgerDB struct {
 	db     *badger.DB
 	logger zerolog.Logger
+	// cipher encrypts orchestration payloads at rest when set
+	cipher *PayloadCipher
+
+	lookupKeyMu sync.Mutex
+	lookupKey   []byte
 }
 
 func NewBadgerDB(dbPath string, logger zerolog.Logger) (*BadgerDB, error) {
@@ -37,6 +43,62 @@ func NewBadgerDB(dbPath string, logger zerolog.Logger) (*BadgerDB, error) {
 	}, nil
 }
 
+// EnablePayloadEncryption encrypts orchestration payloads before they're persisted
+func (b *BadgerDB) EnablePayloadEncryption(cipher *PayloadCipher) {
+	b.cipher = cipher
+}
+
 func (b *BadgerDB) Close() error {
 	return b.db.Close()
 }
+
+// deleteMatching deletes every key starting with the prefix whose value matches
+func deleteMatching(txn *badger.Txn, prefix []byte, matches func(val []byte) (bool, error)) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+
+	it := txn.NewIterator(opts)
+	var keys [][]byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var matched bool
+		if err := it.Item().Value(func(val []byte) (err error) {
+			matched, err = matches(val)
+			return err
+		}); err != nil {
+			it.Close()
+			return fmt.Errorf("failed to load %s: %w", it.Item().Key(), err)
+		}
+		if matched {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+	}
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePrefix deletes every key starting with the prefix
+func deletePrefix(txn *badger.Txn, prefix []byte) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	var keys [][]byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
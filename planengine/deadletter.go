@@ -0,0 +1,214 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter records an orchestration that failed permanently, with the request needed to re-drive it
+type DeadLetter struct {
+	OrchestrationID string                `json:"orchestrationId"`
+	ProjectID       string                `json:"projectId"`
+	Status          Status                `json:"status"`
+	Reason          json.RawMessage       `json:"reason,omitempty"`
+	Request         OrchestrationTemplate `json:"request"`
+	DeadLetteredAt  time.Time             `json:"deadLetteredAt"`
+}
+
+type DeadLetterStorage interface {
+	StoreDeadLetter(deadLetter *DeadLetter) error
+	LoadDeadLetter(projectID, orchestrationID string) (*DeadLetter, error)
+	ListDeadLetters(projectID string) ([]*DeadLetter, error)
+	DeleteDeadLetter(projectID, orchestrationID string) error
+}
+
+// deadLetterOrchestration moves an orchestration whose tasks failed permanently onto its project's dead-letter queue.
+// Sub-orchestrations are left out, their failure fails the parent which is dead-lettered instead.
+func (p *PlanEngine) deadLetterOrchestration(orchestrationID string) {
+	if p.DeadLetters == nil {
+		return
+	}
+
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	var deadLetter *DeadLetter
+	if exists && orchestration.ParentID == "" {
+		deadLetter = &DeadLetter{
+			OrchestrationID: orchestration.ID,
+			ProjectID:       orchestration.ProjectID,
+			Status:          orchestration.Status,
+			Reason:          orchestration.Error,
+			Request:         NewOrchestrationTemplate(orchestration),
+			DeadLetteredAt:  time.Now().UTC(),
+		}
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if deadLetter == nil {
+		return
+	}
+
+	// Finalizing is retried when the webhook can't be reached, the orchestration is only dead-lettered once
+	if _, err := p.DeadLetters.LoadDeadLetter(deadLetter.ProjectID, deadLetter.OrchestrationID); err == nil {
+		return
+	}
+
+	if err := p.DeadLetters.StoreDeadLetter(deadLetter); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Failed to dead-letter orchestration")
+		return
+	}
+
+	if project, err := p.GetProjectByID(deadLetter.ProjectID); err == nil {
+		p.notifyInBackground(func() {
+			p.notifyOrchestrationEvent(project, deadLetter.OrchestrationID, ProjectEventOrchestrationDeadLettered, map[string]any{
+				"orchestrationId": deadLetter.OrchestrationID,
+				"status":          deadLetter.Status,
+				"reason":          deadLetter.Reason,
+			})
+		})
+	}
+}
+
+func (app *App) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	deadLetters, err := app.Engine.DeadLetters.ListDeadLetters(project.ID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].DeadLetteredAt.After(deadLetters[j].DeadLetteredAt)
+	})
+	if deadLetters == nil {
+		deadLetters = []*DeadLetter{}
+	}
+
+	writeDeadLetterResponse(w, app, http.StatusOK, deadLetters)
+}
+
+// InspectDeadLetter returns a dead letter with its orchestration's inspection, while the orchestration is retained
+func (app *App) InspectDeadLetter(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.requestDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	response := struct {
+		*DeadLetter
+		Inspection *OrchestrationInspectResponse `json:"inspection,omitempty"`
+	}{DeadLetter: deadLetter}
+	if inspection, err := app.Engine.InspectOrchestration(deadLetter.OrchestrationID); err == nil {
+		response.Inspection = inspection
+	}
+
+	writeDeadLetterResponse(w, app, http.StatusOK, response)
+}
+
+// RedriveDeadLetter resubmits a dead letter's orchestration request, it leaves the queue once the new orchestration is accepted
+func (app *App) RedriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.requestDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	orchestration := deadLetter.Request.Orchestration()
+	if err := app.Engine.PrepareOrchestration(app.RootCtx, deadLetter.ProjectID, orchestration, app.Engine.GetGroundingSpecs(deadLetter.ProjectID)); err != nil {
+		if orchestration.Status == NotActionable {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ActionNotActionableErrCode), err))
+		} else {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ActionCannotExecuteErrCode), err))
+		}
+		return
+	}
+
+	app.Engine.DispatchOrchestration(app.RootCtx, orchestration)
+	if err := app.Engine.DeadLetters.DeleteDeadLetter(deadLetter.ProjectID, deadLetter.OrchestrationID); err != nil {
+		logger := app.requestLogger(r)
+		logger.Error().Err(err).Str("OrchestrationID", deadLetter.OrchestrationID).Msg("Failed to remove re-driven dead letter")
+	}
+
+	app.writeAcceptedOrchestration(w, orchestration)
+}
+
+func (app *App) PurgeDeadLetter(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.requestDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Engine.DeadLetters.DeleteDeadLetter(deadLetter.ProjectID, deadLetter.OrchestrationID); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(DeadLetterUpdateFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) PurgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	deadLetters, err := app.Engine.DeadLetters.ListDeadLetters(project.ID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	for _, deadLetter := range deadLetters {
+		if err := app.Engine.DeadLetters.DeleteDeadLetter(project.ID, deadLetter.OrchestrationID); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(DeadLetterUpdateFailedErrCode), err))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) requestDeadLetter(w http.ResponseWriter, r *http.Request) (*DeadLetter, bool) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return nil, false
+	}
+
+	deadLetter, err := app.Engine.DeadLetters.LoadDeadLetter(project.ID, mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, ErrDeadLetterNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownDeadLetterErrCode), err))
+		return nil, false
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return nil, false
+	}
+	return deadLetter, true
+}
+
+func writeDeadLetterResponse(w http.ResponseWriter, app *App, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Engine.DeadLetters = app.Db
+
+	events := make(chan ProjectEvent, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	failed := &Orchestration{
+		ID:        "o_failed",
+		ProjectID: project.ID,
+		Action:    Action{Type: "action", Content: "Ship order 1"},
+		Params:    ActionParams{{Field: "orderId", Value: "1"}},
+		Webhook:   "http://localhost/webhook",
+		Status:    Failed,
+		Error:     json.RawMessage(`{"id":"task1","error":"out of stock"}`),
+	}
+	child := &Orchestration{ID: "o_child", ProjectID: project.ID, ParentID: failed.ID, Status: Failed}
+	app.Engine.orchestrationStore[failed.ID] = failed
+	app.Engine.orchestrationStore[child.ID] = child
+
+	app.Engine.deadLetterOrchestration(failed.ID)
+	app.Engine.deadLetterOrchestration(failed.ID)
+	app.Engine.deadLetterOrchestration(child.ID)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, ProjectEventOrchestrationDeadLettered, event.Event)
+		assert.Equal(t, failed.ID, event.Data.(map[string]any)["orchestrationId"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("dead-lettering was not notified")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %s", event.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("lists dead-lettered orchestrations", func(t *testing.T) {
+		w := request(http.MethodGet, "/dead-letters")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var deadLetters []DeadLetter
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&deadLetters))
+		require.Len(t, deadLetters, 1, "orchestrations are dead-lettered once and sub-orchestrations are left out")
+		assert.Equal(t, failed.ID, deadLetters[0].OrchestrationID)
+		assert.Equal(t, Failed, deadLetters[0].Status)
+		assert.Equal(t, "Ship order 1", deadLetters[0].Request.Action.Content)
+		assert.Equal(t, failed.Webhook, deadLetters[0].Request.Webhook)
+		assert.JSONEq(t, string(failed.Error), string(deadLetters[0].Reason))
+	})
+
+	t.Run("inspects a dead letter", func(t *testing.T) {
+		w := request(http.MethodGet, "/dead-letters/"+failed.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var deadLetter DeadLetter
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&deadLetter))
+		assert.Equal(t, ActionParams{{Field: "orderId", Value: "1"}}, deadLetter.Request.Params)
+
+		w = request(http.MethodGet, "/dead-letters/o_unknown")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("re-driving requires a dead letter", func(t *testing.T) {
+		w := request(http.MethodPost, "/dead-letters/o_unknown/redrive")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("purges dead letters", func(t *testing.T) {
+		w := request(http.MethodDelete, "/dead-letters/"+failed.ID)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		w = request(http.MethodGet, "/dead-letters/"+failed.ID)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		require.NoError(t, app.Db.StoreDeadLetter(&DeadLetter{OrchestrationID: "o_other", ProjectID: project.ID}))
+		w = request(http.MethodDelete, "/dead-letters")
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		w = request(http.MethodGet, "/dead-letters")
+		assert.JSONEq(t, `[]`, w.Body.String())
+	})
+}
+
+func TestTaskFailureClassification(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Engine.DeadLetters = app.Db
+
+	notifications := make(chan map[string]any, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		notifications <- payload
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	fail := func(t *testing.T, err error, terminal bool) (*Orchestration, map[string]any) {
+		t.Helper()
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Webhook = webhook.URL
+
+		require.NoError(t, app.Engine.LogManager.AppendTaskErrorToLog(orchestration.ID, "task1", "s_echo", err, 1, terminal))
+		var failure LogEntry
+		for _, entry := range app.Engine.LogManager.GetLog(orchestration.ID).ReadFrom(0) {
+			if entry.GetEntryType() == "task_failure" {
+				failure = entry
+			}
+		}
+		require.NotEmpty(t, failure.GetID())
+
+		tracker := NewFailureTracker(app.Engine.LogManager).(*FailureTracker)
+		require.NoError(t, tracker.processEntry(failure, orchestration.ID))
+		select {
+		case payload := <-notifications:
+			return orchestration, payload
+		case <-time.After(2 * time.Second):
+			t.Fatal("orchestration webhook was not notified")
+			return nil, nil
+		}
+	}
+
+	t.Run("terminal failures are not dead-lettered", func(t *testing.T) {
+		retryable := false
+		taskErr := &TaskError{Code: "INVALID_ADDRESS", Message: "postcode does not exist", Retryable: &retryable, Details: json.RawMessage(`{"field":"postcode"}`)}
+		orchestration, payload := fail(t, taskErr, !resolveRetryPolicy(nil, nil).Retryable(taskErr))
+		reason, ok := payload["error"].(map[string]any)
+		require.True(t, ok)
+		assert.Equal(t, "INVALID_ADDRESS", reason["code"])
+		assert.Equal(t, map[string]any{"field": "postcode"}, reason["details"])
+		assert.Equal(t, true, reason["terminal"])
+
+		_, err := app.Db.LoadDeadLetter(project.ID, orchestration.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("retryable failures are dead-lettered once retries run out", func(t *testing.T) {
+		taskErr := fmt.Errorf("too many consecutive failures: %w", &TaskError{Code: "UPSTREAM_DOWN", Message: "carrier API unavailable"})
+		orchestration, _ := fail(t, taskErr, !resolveRetryPolicy(nil, nil).Retryable(taskErr))
+
+		deadLetter, err := app.Db.LoadDeadLetter(project.ID, orchestration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Failed, deadLetter.Status)
+	})
+}
@@ -0,0 +1,90 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const deadLetterKeyPrefix = "deadletter:"
+
+func deadLetterKey(projectID, orchestrationID string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", deadLetterKeyPrefix, projectID, orchestrationID))
+}
+
+// StoreDeadLetter persists a dead letter, its orchestration request is encrypted like orchestration payloads
+func (b *BadgerDB) StoreDeadLetter(deadLetter *DeadLetter) error {
+	data, err := b.encodePayload(deadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(deadLetterKey(deadLetter.ProjectID, deadLetter.OrchestrationID), data)
+	})
+}
+
+func (b *BadgerDB) LoadDeadLetter(projectID, orchestrationID string) (*DeadLetter, error) {
+	var deadLetter DeadLetter
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(deadLetterKey(projectID, orchestrationID))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrDeadLetterNotFound
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return b.decodePayload(val, &deadLetter)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetter, nil
+}
+
+func (b *BadgerDB) ListDeadLetters(projectID string) ([]*DeadLetter, error) {
+	var deadLetters []*DeadLetter
+	prefix := []byte(fmt.Sprintf("%s%s:", deadLetterKeyPrefix, projectID))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var deadLetter DeadLetter
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &deadLetter)
+			}); err != nil {
+				return fmt.Errorf("failed to load dead letter %s: %w", it.Item().Key(), err)
+			}
+			deadLetters = append(deadLetters, &deadLetter)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	return deadLetters, nil
+}
+
+func (b *BadgerDB) DeleteDeadLetter(projectID, orchestrationID string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(deadLetterKey(projectID, orchestrationID))
+	})
+}
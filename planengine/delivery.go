@@ -0,0 +1,256 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+// WSTaskAck is the message type services use to acknowledge a delivered task
+const WSTaskAck = "task_ack"
+
+// pendingDelivery is a task sent to a service that it has yet to acknowledge, or with leases enabled, to finish.
+// An acknowledged task is leased to its instance from leasedAt, when the service last renewed the lease.
+type pendingDelivery struct {
+	task       Task
+	instanceID string
+	sentAt     time.Time
+	attempts   int
+	leasedAt   time.Time
+}
+
+// ConfigureDelivery replaces the default task delivery settings, unset settings keep their defaults
+func (wsm *WebSocketManager) ConfigureDelivery(cfg TaskDelivery) {
+	if cfg.AckTimeout > 0 {
+		wsm.ackTimeout = cfg.AckTimeout
+	}
+	if cfg.MaxRedeliveries > 0 {
+		wsm.maxRedeliveries = cfg.MaxRedeliveries
+	}
+	if cfg.LeaseTTL > 0 {
+		wsm.leaseTTL = cfg.LeaseTTL
+	}
+}
+
+// trackDelivery gives the task a delivery ID and holds on to it until the service acknowledges it.
+// Earlier deliveries of the same task are superseded, the service only needs to acknowledge the latest.
+func (wsm *WebSocketManager) trackDelivery(task *Task) {
+	task.DeliveryID = fmt.Sprintf("d_%s", short.New())
+
+	wsm.deliveryMu.Lock()
+	defer wsm.deliveryMu.Unlock()
+
+	for id, pending := range wsm.deliveries {
+		if pending.task.ServiceID == task.ServiceID && pending.task.IdempotencyKey == task.IdempotencyKey {
+			delete(wsm.deliveries, id)
+		}
+	}
+	wsm.deliveries[task.DeliveryID] = &pendingDelivery{task: *task}
+}
+
+// markDelivered records a delivery attempt to one of the service's instances
+func (wsm *WebSocketManager) markDelivered(deliveryID, instanceID string, now time.Time) {
+	wsm.deliveryMu.Lock()
+	defer wsm.deliveryMu.Unlock()
+
+	if pending, ok := wsm.deliveries[deliveryID]; ok {
+		pending.attempts++
+		pending.instanceID = instanceID
+		pending.sentAt = now
+	}
+}
+
+// requeueDeliveries redelivers the unacknowledged tasks of a disconnected instance on the next redelivery tick,
+// without waiting for their acknowledgements to be overdue. The instance's leases are revoked the same way.
+func (wsm *WebSocketManager) requeueDeliveries(serviceID, instanceID string) {
+	var revoked []pendingDelivery
+	now := time.Now().UTC()
+
+	wsm.deliveryMu.Lock()
+	for _, pending := range wsm.deliveries {
+		if pending.task.ServiceID == serviceID && pending.instanceID == instanceID {
+			if !pending.leasedAt.IsZero() {
+				revoked = append(revoked, *pending)
+				pending.leasedAt = time.Time{}
+			}
+			pending.sentAt = time.Time{}
+		}
+	}
+	wsm.deliveryMu.Unlock()
+
+	for _, pending := range revoked {
+		wsm.recordLease(pending, TaskLease{Event: LeaseExpired, InstanceID: pending.instanceID, Reason: "instance disconnected"}, now)
+	}
+}
+
+func (wsm *WebSocketManager) forgetDelivery(deliveryID string) {
+	wsm.deliveryMu.Lock()
+	delete(wsm.deliveries, deliveryID)
+	wsm.deliveryMu.Unlock()
+}
+
+// acknowledgeDelivery stops redelivering a task, services acknowledge it explicitly or by reporting on its execution.
+// With leases enabled the task is leased to the instance instead, acknowledging it again renews the lease.
+func (wsm *WebSocketManager) acknowledgeDelivery(serviceID, deliveryID, executionID string) {
+	var granted []pendingDelivery
+	now := time.Now().UTC()
+
+	wsm.deliveryMu.Lock()
+	for _, id := range wsm.matchingDeliveriesLocked(serviceID, deliveryID, executionID) {
+		pending := wsm.deliveries[id]
+		if wsm.leaseTTL <= 0 {
+			delete(wsm.deliveries, id)
+			continue
+		}
+		if pending.leasedAt.IsZero() {
+			granted = append(granted, *pending)
+		}
+		pending.leasedAt = now
+	}
+	wsm.deliveryMu.Unlock()
+
+	for _, pending := range granted {
+		wsm.recordLease(pending, TaskLease{Event: LeaseGranted, InstanceID: pending.instanceID}, now)
+	}
+}
+
+// completeDelivery stops tracking a task once its service has reported its result
+func (wsm *WebSocketManager) completeDelivery(serviceID, executionID string) {
+	wsm.deliveryMu.Lock()
+	defer wsm.deliveryMu.Unlock()
+
+	for _, id := range wsm.matchingDeliveriesLocked(serviceID, "", executionID) {
+		delete(wsm.deliveries, id)
+	}
+}
+
+// matchingDeliveriesLocked returns the service's deliveries with the delivery ID or, without one, the execution ID.
+// Callers must hold deliveryMu.
+func (wsm *WebSocketManager) matchingDeliveriesLocked(serviceID, deliveryID, executionID string) []string {
+	if deliveryID != "" {
+		if pending, ok := wsm.deliveries[deliveryID]; ok && pending.task.ServiceID == serviceID {
+			return []string{deliveryID}
+		}
+		return nil
+	}
+	var ids []string
+	for id, pending := range wsm.deliveries {
+		if pending.task.ServiceID == serviceID && executionID != "" && pending.task.ExecutionID == executionID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// dropDeliveries stops delivering a task the plan engine no longer needs, e.g. of a cancelled orchestration
+func (wsm *WebSocketManager) dropDeliveries(serviceID, orchestrationID, taskID string) {
+	wsm.deliveryMu.Lock()
+	defer wsm.deliveryMu.Unlock()
+
+	for id, pending := range wsm.deliveries {
+		if pending.task.ServiceID == serviceID && pending.task.OrchestrationID == orchestrationID && pending.task.ID == taskID {
+			delete(wsm.deliveries, id)
+		}
+	}
+}
+
+// RedeliverTasks sends unacknowledged tasks again once their acknowledgement is overdue, until ctx is done.
+// Tasks for disconnected services are delivered once they reconnect, and their expired outboxes dropped.
+func (wsm *WebSocketManager) RedeliverTasks(ctx context.Context) {
+	ticker := time.NewTicker(wsm.ackTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			wsm.redeliverOverdue(now)
+			wsm.expireOutboxes(now)
+		}
+	}
+}
+
+func (wsm *WebSocketManager) redeliverOverdue(now time.Time) {
+	var due []string
+	var expired []pendingDelivery
+	wsm.deliveryMu.Lock()
+	for id, pending := range wsm.deliveries {
+		switch {
+		case !pending.leasedAt.IsZero():
+			if now.Sub(pending.leasedAt) < wsm.leaseTTL {
+				continue
+			}
+			// The service stopped renewing the lease, so another instance or a later retry takes over the task
+			expired = append(expired, *pending)
+			pending.leasedAt = time.Time{}
+		case !pending.sentAt.IsZero() && now.Sub(pending.sentAt) < wsm.ackTimeout:
+			continue
+		}
+		// The task worker's own timeout sends the task afresh if it's never acknowledged
+		if pending.attempts > wsm.maxRedeliveries {
+			wsm.logger.Warn().
+				Str("ServiceID", pending.task.ServiceID).
+				Str("TaskID", pending.task.ID).
+				Str("DeliveryID", id).
+				Msg("Giving up redelivering unacknowledged task")
+			delete(wsm.deliveries, id)
+			continue
+		}
+		due = append(due, id)
+	}
+	wsm.deliveryMu.Unlock()
+
+	for _, pending := range expired {
+		wsm.recordLease(pending, TaskLease{Event: LeaseExpired, InstanceID: pending.instanceID, Reason: "lease not renewed"}, now)
+	}
+
+	for _, id := range due {
+		if err := wsm.deliver(id, now); err != nil {
+			wsm.logger.Debug().Err(err).Str("DeliveryID", id).Msg("Failed to redeliver task")
+		}
+	}
+}
+
+// deliver writes a tracked task to its service's connection. A task's first delivery is buffered while its service
+// is briefly disconnected, redeliveries wait for the service to reconnect.
+func (wsm *WebSocketManager) deliver(deliveryID string, now time.Time) error {
+	wsm.deliveryMu.Lock()
+	pending, ok := wsm.deliveries[deliveryID]
+	if !ok {
+		wsm.deliveryMu.Unlock()
+		return nil
+	}
+	task := pending.task
+	task.Redelivered = pending.attempts > 0
+	wsm.deliveryMu.Unlock()
+
+	message, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to convert message to JSON for service %s: %w", task.ServiceID, err)
+	}
+	pinned, wasPinned := wsm.pinnedInstance(task.ServiceID, task.RoutingKey)
+	instanceID, err := wsm.send(task.ServiceID, task.RoutingKey, message, !task.Redelivered)
+	if err != nil {
+		if errors.Is(err, ErrServiceNotConnected) {
+			return nil
+		}
+		return err
+	}
+	if wasPinned && instanceID != pinned && wsm.onReroute != nil {
+		wsm.onReroute(task, pinned, instanceID)
+	}
+
+	wsm.markDelivered(deliveryID, instanceID, now)
+	return nil
+}
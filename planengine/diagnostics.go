@@ -0,0 +1,236 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+// RuntimeStats describes the plan engine's process, its goroutines, memory and garbage collection
+type RuntimeStats struct {
+	GoVersion    string    `json:"goVersion"`
+	Goroutines   int       `json:"goroutines"`
+	NumCPU       int       `json:"numCpu"`
+	GOMAXPROCS   int       `json:"gomaxprocs"`
+	HeapAlloc    uint64    `json:"heapAllocBytes"`
+	HeapInuse    uint64    `json:"heapInuseBytes"`
+	HeapObjects  uint64    `json:"heapObjects"`
+	StackInuse   uint64    `json:"stackInuseBytes"`
+	Sys          uint64    `json:"sysBytes"`
+	NumGC        uint32    `json:"numGc"`
+	LastGC       time.Time `json:"lastGc,omitempty"`
+	LastGCPause  string    `json:"lastGcPause"`
+	GCPauseTotal string    `json:"gcPauseTotal"`
+	NextGC       uint64    `json:"nextGcBytes"`
+}
+
+// EngineStats sizes the plan engine's in-memory state and queues
+type EngineStats struct {
+	Projects               int            `json:"projects"`
+	Services               int            `json:"services"`
+	Groundings             int            `json:"groundings"`
+	Orchestrations         int            `json:"orchestrations"`
+	RunningOrchestrations  int            `json:"runningOrchestrations"`
+	QueuedOrchestrations   int            `json:"queuedOrchestrations"`
+	PendingApprovals       int            `json:"pendingApprovals"`
+	Logs                   int            `json:"logs"`
+	LogEntries             int            `json:"logEntries"`
+	LogWorkers             int            `json:"logWorkers"`
+	ConnectedInstances     int            `json:"connectedInstances"`
+	PendingDeliveries      int            `json:"pendingDeliveries"`
+	BufferedMessages       int            `json:"bufferedMessages"`
+	SendQueueDepth         int            `json:"sendQueueDepth"`
+	ServiceBacklogs        map[string]int `json:"serviceBacklogs"`
+	OrchestrationQueueSize map[string]int `json:"orchestrationQueues"`
+}
+
+// DiagnosticStats is what the admin stats endpoint reports
+type DiagnosticStats struct {
+	Version   string       `json:"version"`
+	Timestamp time.Time    `json:"timestamp"`
+	Runtime   RuntimeStats `json:"runtime"`
+	Engine    EngineStats  `json:"engine"`
+}
+
+func runtimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := RuntimeStats{
+		GoVersion:    runtime.Version(),
+		Goroutines:   runtime.NumGoroutine(),
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		HeapObjects:  mem.HeapObjects,
+		StackInuse:   mem.StackInuse,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		LastGCPause:  time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).String(),
+		GCPauseTotal: time.Duration(mem.PauseTotalNs).String(),
+		NextGC:       mem.NextGC,
+	}
+	if mem.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(mem.LastGC)).UTC()
+	}
+	return stats
+}
+
+// engineStats takes each of the plan engine's locks in turn, so its sizes are close to but not a consistent snapshot
+func (p *PlanEngine) engineStats() EngineStats {
+	p.projectsMu.RLock()
+	projects := len(p.projects)
+	p.projectsMu.RUnlock()
+
+	stats := EngineStats{
+		Projects:               projects,
+		ServiceBacklogs:        map[string]int{},
+		OrchestrationQueueSize: map[string]int{},
+	}
+
+	p.servicesMu.RLock()
+	for _, services := range p.services {
+		stats.Services += len(services)
+	}
+	p.servicesMu.RUnlock()
+
+	p.groundingsMu.RLock()
+	for _, groundings := range p.groundings {
+		stats.Groundings += len(groundings)
+	}
+	p.groundingsMu.RUnlock()
+
+	p.orchestrationStoreMu.RLock()
+	stats.Orchestrations = len(p.orchestrationStore)
+	stats.RunningOrchestrations = len(p.runningOrchestrations)
+	for projectID, queue := range p.orchestrationQueues {
+		stats.QueuedOrchestrations += len(queue)
+		if len(queue) > 0 {
+			stats.OrchestrationQueueSize[projectID] = len(queue)
+		}
+	}
+	p.orchestrationStoreMu.RUnlock()
+
+	p.approvalsMu.Lock()
+	stats.PendingApprovals = len(p.approvals)
+	p.approvalsMu.Unlock()
+
+	p.workerMu.RLock()
+	for _, workers := range p.logWorkers {
+		stats.LogWorkers += len(workers)
+	}
+	p.workerMu.RUnlock()
+
+	if p.LogManager != nil {
+		stats.Logs, stats.LogEntries = p.LogManager.size()
+		stats.ServiceBacklogs = p.serviceBacklogs()
+	}
+	if p.WebSocketManager != nil {
+		stats.ConnectedInstances, stats.PendingDeliveries, stats.BufferedMessages, stats.SendQueueDepth = p.WebSocketManager.size()
+	}
+	return stats
+}
+
+// size counts the logs held in memory and their entries
+func (lm *LogManager) size() (logs, entries int) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	for _, log := range lm.logs {
+		entries += len(log.Entries)
+	}
+	return len(lm.logs), entries
+}
+
+// size counts the connected service instances, the deliveries awaiting an acknowledgement, the messages buffered
+// for disconnected services and the messages queued on connections
+func (wsm *WebSocketManager) size() (instances, deliveries, buffered, queued int) {
+	wsm.connMu.RLock()
+	var sessions []serviceSession
+	for _, connected := range wsm.connMap {
+		for _, s := range connected.sessions {
+			sessions = append(sessions, s)
+		}
+	}
+	wsm.connMu.RUnlock()
+
+	for _, s := range sessions {
+		if queue := sessionSendQueue(s); queue != nil {
+			queued += queue.depth(s)
+		}
+	}
+
+	wsm.deliveryMu.Lock()
+	deliveries = len(wsm.deliveries)
+	wsm.deliveryMu.Unlock()
+
+	wsm.outboxMu.Lock()
+	for _, outbox := range wsm.outboxes {
+		buffered += len(outbox.messages)
+	}
+	wsm.outboxMu.Unlock()
+
+	return len(sessions), deliveries, buffered, queued
+}
+
+// AdminStatsHandler reports the plan engine's runtime and in-memory state, to diagnose performance issues in production
+func (app *App) AdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := DiagnosticStats{
+		Version:   Version,
+		Timestamp: time.Now().UTC(),
+		Runtime:   runtimeStats(),
+		Engine:    app.Engine.engineStats(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// AdminGoroutinesHandler dumps the stack of every goroutine as text
+func (app *App) AdminGoroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		logger := app.requestLogger(r)
+		logger.Warn().Err(err).Msg("Failed to write goroutine dump")
+	}
+}
+
+// ProfilingRouter serves the runtime profiles, kept off the main router so they're only reachable on the profiling
+// listener
+func (app *App) ProfilingRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(app.RequestIDMiddleware)
+
+	profiles := router.PathPrefix("/admin/debug/pprof").Subrouter()
+	profiles.HandleFunc("/", app.AdminMiddleware(pprof.Index)).Methods(http.MethodGet)
+	profiles.HandleFunc("/cmdline", app.AdminMiddleware(pprof.Cmdline)).Methods(http.MethodGet)
+	profiles.HandleFunc("/profile", app.AdminMiddleware(pprof.Profile)).Methods(http.MethodGet)
+	profiles.HandleFunc("/symbol", app.AdminMiddleware(pprof.Symbol)).Methods(http.MethodGet, http.MethodPost)
+	profiles.HandleFunc("/trace", app.AdminMiddleware(pprof.Trace)).Methods(http.MethodGet)
+	profiles.HandleFunc("/{profile}", app.AdminMiddleware(app.AdminProfileHandler)).Methods(http.MethodGet)
+	return router
+}
+
+// AdminProfileHandler serves one of the runtime's named profiles, e.g. heap, goroutine or mutex. CPU profiles and
+// traces, served by pprof's own handlers, must be shorter than the profiling server's write timeout.
+func (app *App) AdminProfileHandler(w http.ResponseWriter, r *http.Request) {
+	pprof.Handler(mux.Vars(r)["profile"]).ServeHTTP(w, r)
+}
@@ -0,0 +1,104 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminDiagnostics(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	const adminKey = "sk-orra-admin-test"
+	app.Admin = NewAdminCredential(adminKey)
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	app.Engine.WebSocketManager = NewWebSocketManager(app.Logger)
+
+	app.Engine.orchestrationStore["o_running"] = &Orchestration{ID: "o_running", ProjectID: project.ID, Status: Processing}
+	app.Engine.runningOrchestrations["o_running"] = project.ID
+	app.Engine.orchestrationQueues[project.ID] = []queuedOrchestration{
+		{orchestration: &Orchestration{ID: "o_queued", ProjectID: project.ID, Status: Queued}},
+	}
+	logManager.PrepLogForOrchestration(project.ID, "o_running", &ExecutionPlan{})
+
+	serve := func(handler http.Handler, path, credential string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+credential)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	send := func(path, credential string) *httptest.ResponseRecorder {
+		return serve(app.Router, path, credential)
+	}
+	profiling := app.ProfilingRouter()
+	profile := func(path, credential string) *httptest.ResponseRecorder {
+		return serve(profiling, path, credential)
+	}
+
+	t.Run("project API keys are rejected", func(t *testing.T) {
+		for _, path := range []string{"/admin/debug/stats", "/admin/debug/goroutines"} {
+			assert.Equal(t, http.StatusUnauthorized, send(path, project.APIKey).Code, path)
+		}
+		for _, path := range []string{"/admin/debug/pprof/", "/admin/debug/pprof/heap"} {
+			assert.Equal(t, http.StatusUnauthorized, profile(path, project.APIKey).Code, path)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		w := send("/admin/debug/stats", adminKey)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var stats DiagnosticStats
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+		assert.Equal(t, Version, stats.Version)
+		assert.Positive(t, stats.Runtime.Goroutines)
+		assert.Positive(t, stats.Runtime.HeapAlloc)
+		assert.Equal(t, 1, stats.Engine.Projects)
+		assert.Equal(t, 1, stats.Engine.Orchestrations)
+		assert.Equal(t, 1, stats.Engine.RunningOrchestrations)
+		assert.Equal(t, 1, stats.Engine.QueuedOrchestrations)
+		assert.Equal(t, map[string]int{project.ID: 1}, stats.Engine.OrchestrationQueueSize)
+		assert.Equal(t, 1, stats.Engine.Logs)
+	})
+
+	t.Run("goroutine dump", func(t *testing.T) {
+		w := send("/admin/debug/goroutines", adminKey)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "goroutine ")
+		assert.Contains(t, w.Body.String(), "TestAdminDiagnostics")
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		w := profile("/admin/debug/pprof/", adminKey)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "heap")
+
+		w = profile("/admin/debug/pprof/heap", adminKey)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, w.Body.Bytes())
+
+		assert.Equal(t, http.StatusNotFound, profile("/admin/debug/pprof/unknown", adminKey).Code)
+	})
+
+	t.Run("pprof is only served by the profiling listener", func(t *testing.T) {
+		for _, path := range []string{"/admin/debug/pprof/", "/admin/debug/pprof/heap", APIVersionPrefix + "/admin/debug/pprof/heap"} {
+			assert.Equal(t, http.StatusNotFound, send(path, adminKey).Code, path)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDrainTimeout = 5 * time.Minute
+	maxDrainTimeout     = time.Hour
+	drainPollInterval   = 100 * time.Millisecond
+)
+
+const (
+	ServiceDraining      = "draining"
+	ServiceDrained       = "drained"
+	ServiceDrainTimedOut = "timed_out"
+)
+
+// ServiceDrain reports on a service draining its in-flight tasks, e.g. before it's redeployed.
+// The project's webhooks are sent a service.drained event with the final report once the drain ends.
+type ServiceDrain struct {
+	ServiceID string     `json:"serviceId"`
+	Status    string     `json:"status"`
+	InFlight  int        `json:"inFlight"`
+	StartedAt time.Time  `json:"startedAt"`
+	Deadline  time.Time  `json:"deadline"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+// startDraining stops new tasks being dispatched to the service, until the service next connects
+func (wsm *WebSocketManager) startDraining(serviceID string) {
+	wsm.healthMu.Lock()
+	defer wsm.healthMu.Unlock()
+	wsm.draining[serviceID] = true
+}
+
+func (wsm *WebSocketManager) stopDraining(serviceID string) {
+	wsm.healthMu.Lock()
+	defer wsm.healthMu.Unlock()
+	delete(wsm.draining, serviceID)
+}
+
+// IsServiceDraining reports whether the service has been asked to finish its in-flight tasks without taking new ones
+func (wsm *WebSocketManager) IsServiceDraining(serviceID string) bool {
+	wsm.healthMu.RLock()
+	defer wsm.healthMu.RUnlock()
+	return wsm.draining[serviceID]
+}
+
+// DrainService stops dispatching new tasks to a service and waits in the background for its in-flight tasks
+// to finish, or for the timeout. Dispatching resumes once the service, e.g. its redeployed version, next connects.
+func (p *PlanEngine) DrainService(service *ServiceInfo, timeout time.Duration) ServiceDrain {
+	p.WebSocketManager.startDraining(service.ID)
+
+	now := time.Now().UTC()
+	drain := ServiceDrain{
+		ServiceID: service.ID,
+		Status:    ServiceDraining,
+		InFlight:  service.IdempotencyStore.InProgressExecutions(),
+		StartedAt: now,
+		Deadline:  now.Add(timeout),
+	}
+
+	p.Logger.Info().
+		Str("ProjectID", service.ProjectID).
+		Str("ServiceID", service.ID).
+		Int("InFlight", drain.InFlight).
+		Dur("Timeout", timeout).
+		Msg("Draining service")
+
+	// Tracked like notifications so shutdown waits for it, the drain ends with one
+	p.notifyInBackground(func() { p.awaitDrain(service, drain) })
+	return drain
+}
+
+// awaitDrain polls the service's in-flight tasks until the drain ends, giving up without a report on shutdown
+func (p *PlanEngine) awaitDrain(service *ServiceInfo, drain ServiceDrain) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-p.stopping:
+			return
+		}
+
+		drain.InFlight = service.IdempotencyStore.InProgressExecutions()
+		if drain.InFlight > 0 && now.Before(drain.Deadline) {
+			continue
+		}
+
+		drain.Status = ServiceDrained
+		if drain.InFlight > 0 {
+			drain.Status = ServiceDrainTimedOut
+		}
+		endedAt := now.UTC()
+		drain.EndedAt = &endedAt
+		break
+	}
+
+	p.Logger.Info().
+		Str("ProjectID", service.ProjectID).
+		Str("ServiceID", service.ID).
+		Str("Status", drain.Status).
+		Int("InFlight", drain.InFlight).
+		Msg("Service drain ended")
+
+	if project, err := p.GetProjectByID(service.ProjectID); err == nil {
+		p.notifyInBackground(func() { p.NotifyProjectWebhooks(project, ProjectEventServiceDrained, drain) })
+	}
+}
+
+// drainRequest is the optional body of a service drain
+type drainRequest struct {
+	Timeout *Duration `json:"timeout"`
+}
+
+// DrainServiceHandler drains one of the caller's services, for rolling deployments of services and agents
+func (app *App) DrainServiceHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	service, err := app.Engine.GetService(project.ID, mux.Vars(r)["id"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), err))
+		return
+	}
+
+	var request drainRequest
+	if err := decodeOptionalRequest(w, r, &request, drainFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	timeout := defaultDrainTimeout
+	if request.Timeout != nil {
+		if request.Timeout.Duration <= 0 || request.Timeout.Duration > maxDrainTimeout {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("timeout"), fmt.Sprintf("timeout must be positive and at most %s", maxDrainTimeout)))
+			return
+		}
+		timeout = request.Timeout.Duration
+	}
+
+	drain := app.Engine.DrainService(service, timeout)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(drain); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainService(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	app.Engine.WebSocketManager = NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+	app.Engine.WebSocketManager.UpdateServiceHealth(service.ID, true)
+
+	events := make(chan ProjectEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	drain := func(serviceID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/services/"+serviceID+"/drain", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	drainedEvent := func() map[string]any {
+		t.Helper()
+		select {
+		case event := <-events:
+			assert.Equal(t, ProjectEventServiceDrained, event.Event)
+			return event.Data.(map[string]any)
+		case <-time.After(2 * time.Second):
+			t.Fatal("project webhook was not notified")
+			return nil
+		}
+	}
+
+	_, _, err = service.IdempotencyStore.InitializeOrGetExecution("key-1", "e_1")
+	require.NoError(t, err)
+
+	w := drain(service.ID, `{"timeout":"1m"}`)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var started ServiceDrain
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&started))
+	assert.Equal(t, ServiceDraining, started.Status)
+	assert.Equal(t, 1, started.InFlight)
+
+	worker := &TaskWorker{Service: service, TaskID: "task2", HealthCheckGracePeriod: time.Minute, LogManager: app.Engine.LogManager}
+	assert.True(t, app.Engine.WebSocketManager.IsServiceDraining(service.ID))
+	assert.Error(t, worker.checkServiceHealth("o_1"), "draining services aren't sent new tasks")
+
+	service.IdempotencyStore.UpdateExecutionResult("key-1", json.RawMessage(`{"ok":true}`), nil)
+	data := drainedEvent()
+	assert.Equal(t, service.ID, data["serviceId"])
+	assert.Equal(t, ServiceDrained, data["status"])
+
+	t.Run("drains time out with tasks still in flight", func(t *testing.T) {
+		_, _, err := service.IdempotencyStore.InitializeOrGetExecution("key-2", "e_2")
+		require.NoError(t, err)
+
+		w := drain(service.ID, `{"timeout":"50ms"}`)
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		data := drainedEvent()
+		assert.Equal(t, ServiceDrainTimedOut, data["status"])
+		assert.EqualValues(t, 1, data["inFlight"])
+	})
+
+	t.Run("drains without a body use the default timeout", func(t *testing.T) {
+		service.IdempotencyStore.UpdateExecutionResult("key-2", json.RawMessage(`{"ok":true}`), nil)
+
+		w := drain(service.ID, "")
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		var started ServiceDrain
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&started))
+		assert.Equal(t, defaultDrainTimeout, started.Deadline.Sub(started.StartedAt))
+
+		assert.Equal(t, ServiceDrained, drainedEvent()["status"])
+	})
+
+	t.Run("shutting down stops waiting on drains", func(t *testing.T) {
+		stopping := make(chan struct{})
+		close(stopping)
+		plane := &PlanEngine{Logger: app.Engine.Logger, stopping: stopping}
+		store := NewIdempotencyStore(0)
+		_, _, err := store.InitializeOrGetExecution("key-3", "e_3")
+		require.NoError(t, err)
+
+		done := make(chan struct{})
+		go func() {
+			plane.awaitDrain(&ServiceInfo{ID: "s_busy", ProjectID: project.ID, IdempotencyStore: store}, ServiceDrain{Deadline: time.Now().Add(time.Hour)})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("drain kept waiting after shutdown")
+		}
+	})
+
+	t.Run("services stop draining once they reconnect", func(t *testing.T) {
+		app.Engine.WebSocketManager.HandleConnection(service.ID, service.Name, &callbackSession{keys: map[string]any{}, done: make(chan struct{})})
+		assert.False(t, app.Engine.WebSocketManager.IsServiceDraining(service.ID))
+	})
+
+	t.Run("rejects invalid drains", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, drain("s_unknown", "").Code)
+		assert.Equal(t, http.StatusBadRequest, drain(service.ID, `{"timeout":"2h"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, drain(service.ID, `{"timeout":"1m","force":true}`).Code)
+	})
+}
@@ -0,0 +1,112 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+// DryRunResult reports the plan an orchestration request would execute, nothing is executed or stored
+type DryRunResult struct {
+	DryRun   bool            `json:"dryRun"`
+	Action   Action          `json:"action"`
+	Plan     *ExecutionPlan  `json:"plan"`
+	Services []DryRunService `json:"services"`
+	Estimate DryRunEstimate  `json:"estimate"`
+}
+
+// DryRunService is a service the plan would invoke, with the tasks it would be invoked for
+type DryRunService struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Tasks       []string `json:"tasks"`
+	MaxAttempts int      `json:"maxAttempts"`
+}
+
+// DryRunEstimate sizes the work a plan would do. Service calls range from every task succeeding first time
+// to every task using all its attempts, fanned out tasks are counted once per element of their input.
+type DryRunEstimate struct {
+	Tasks             int `json:"tasks"`
+	MinServiceCalls   int `json:"minServiceCalls"`
+	MaxServiceCalls   int `json:"maxServiceCalls"`
+	FanOutTasks       int `json:"fanOutTasks,omitempty"`
+	ApprovalSteps     int `json:"approvalSteps,omitempty"`
+	SubOrchestrations int `json:"subOrchestrations,omitempty"`
+}
+
+// EstimateOrchestration summarises a prepared orchestration's plan for a dry run
+func (p *PlanEngine) EstimateOrchestration(orchestration *Orchestration) (*DryRunResult, error) {
+	result := &DryRunResult{
+		DryRun:   true,
+		Action:   orchestration.Action,
+		Plan:     orchestration.Plan,
+		Services: []DryRunService{},
+	}
+
+	services := make(map[string]int)
+	for _, task := range orchestration.Plan.Tasks {
+		switch task.Type {
+		case TaskTypeApproval:
+			result.Estimate.ApprovalSteps++
+			continue
+		case TaskTypeOrchestration:
+			result.Estimate.SubOrchestrations++
+			continue
+		}
+
+		service, err := p.GetServiceByID(task.Service)
+		if err != nil {
+			return nil, err
+		}
+		maxAttempts := resolveRetryPolicy(orchestration.RetryPolicy, service.RetryPolicy).MaxAttempts
+
+		result.Estimate.Tasks++
+		result.Estimate.MinServiceCalls++
+		result.Estimate.MaxServiceCalls += maxAttempts
+		if task.FanOut != nil {
+			result.Estimate.FanOutTasks++
+		}
+
+		i, seen := services[service.ID]
+		if !seen {
+			i = len(result.Services)
+			services[service.ID] = i
+			result.Services = append(result.Services, DryRunService{ID: service.ID, Name: service.Name, MaxAttempts: maxAttempts})
+		}
+		result.Services[i].Tasks = append(result.Services[i].Tasks, task.ID)
+	}
+
+	return result, nil
+}
+
+// dryRunOrchestration plans an orchestration request and reports what it would do instead of executing it
+func (app *App) dryRunOrchestration(w http.ResponseWriter, projectID string, orchestration *Orchestration) {
+	if err := app.Engine.PrepareOrchestration(app.RootCtx, projectID, orchestration, app.Engine.GetGroundingSpecs(projectID)); err != nil {
+		if orchestration.Status == NotActionable {
+			httpErrorResponse(w, app.Logger, errs.E(errs.InvalidRequest, errs.Code(ActionNotActionableErrCode), err))
+		} else {
+			httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(ActionCannotExecuteErrCode), err))
+		}
+		return
+	}
+
+	result, err := app.Engine.EstimateOrchestration(orchestration)
+	if err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(ActionCannotExecuteErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
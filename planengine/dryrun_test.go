@@ -0,0 +1,72 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{
+		"s_echo":  {ID: "s_echo", Name: "Echo", ProjectID: project.ID},
+		"s_audit": {ID: "s_audit", Name: "Audit", ProjectID: project.ID, RetryPolicy: &RetryPolicy{MaxAttempts: 2}},
+	}
+
+	orchestration := &Orchestration{
+		Action: Action{Content: "Echo then audit"},
+		Plan: &ExecutionPlan{
+			Tasks: []*SubTask{
+				{ID: "task1", Service: "s_echo"},
+				{ID: "approval_task2", Type: TaskTypeApproval},
+				{ID: "task2", Service: "s_audit", FanOut: &FanOut{Input: "items", MaxParallel: 2}},
+				{ID: "task3", Service: "s_echo"},
+				{ID: "orchestration_notify", Type: TaskTypeOrchestration},
+			},
+		},
+	}
+
+	result, err := app.Engine.EstimateOrchestration(orchestration)
+	require.NoError(t, err)
+
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []DryRunService{
+		{ID: "s_echo", Name: "Echo", Tasks: []string{"task1", "task3"}, MaxAttempts: maxRetries},
+		{ID: "s_audit", Name: "Audit", Tasks: []string{"task2"}, MaxAttempts: 2},
+	}, result.Services)
+	assert.Equal(t, DryRunEstimate{
+		Tasks:             3,
+		MinServiceCalls:   3,
+		MaxServiceCalls:   2*maxRetries + 2,
+		FanOutTasks:       1,
+		ApprovalSteps:     1,
+		SubOrchestrations: 1,
+	}, result.Estimate)
+
+	orchestration.Plan.Tasks = append(orchestration.Plan.Tasks, &SubTask{ID: "task4", Service: "s_unknown"})
+	_, err = app.Engine.EstimateOrchestration(orchestration)
+	assert.Error(t, err)
+}
+
+func TestDryRunsAreNotStored(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	orchestration := &Orchestration{Action: Action{Content: "Echo"}, Webhook: "http://localhost/unregistered", DryRun: true}
+	err := app.Engine.PrepareOrchestration(context.Background(), project.ID, orchestration, nil)
+	require.Error(t, err)
+
+	assert.NotContains(t, app.Engine.orchestrationStore, orchestration.ID)
+	_, err = app.Db.LoadOrchestration(orchestration.ID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/olahol/melody"
+	"github.com/orra-dev/orra/planengine/proto/orrav1"
+	"google.golang.org/protobuf/proto"
+)
+
+// WSEncodingQueryParam negotiates how a service's WebSocket messages are framed
+const WSEncodingQueryParam = "encoding"
+
+const (
+	// JSONEncoding frames messages as JSON text, it's the default
+	JSONEncoding = "json"
+	// ProtobufEncoding frames messages as binary EngineMessage and ServiceMessage protobufs, the same messages
+	// the gRPC transport streams. It cuts bandwidth and CPU for large task inputs and results, e.g. embeddings.
+	ProtobufEncoding = "protobuf"
+)
+
+func validateEncoding(encoding string) error {
+	switch encoding {
+	case "", JSONEncoding, ProtobufEncoding:
+		return nil
+	default:
+		return fmt.Errorf("encoding must be %q or %q", JSONEncoding, ProtobufEncoding)
+	}
+}
+
+// sessionEncoding returns the encoding a service negotiated for its WebSocket. Other transports frame
+// messages their own way, so they always get JSON.
+func sessionEncoding(s serviceSession) string {
+	if ws, ok := s.(*melody.Session); ok && ws.Request != nil {
+		if encoding := ws.Request.URL.Query().Get(WSEncodingQueryParam); encoding != "" {
+			return encoding
+		}
+	}
+	return JSONEncoding
+}
+
+// writeEncoded writes a JSON message to a session in the encoding it negotiated
+func writeEncoded(s serviceSession, message []byte) error {
+	ws, ok := s.(*melody.Session)
+	if !ok || sessionEncoding(s) != ProtobufEncoding {
+		return s.Write(message)
+	}
+
+	msg, err := engineMessage(message)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal protobuf message: %w", err)
+	}
+	return ws.WriteBinary(data)
+}
+
+// HandleBinaryMessage handles a service's protobuf message, as the JSON it would have sent otherwise
+func (wsm *WebSocketManager) HandleBinaryMessage(s serviceSession, msg []byte, fn ServiceFinder) {
+	var message orrav1.ServiceMessage
+	if err := proto.Unmarshal(msg, &message); err != nil {
+		wsm.logger.Error().Err(err).Msg("Failed to unmarshal protobuf service message")
+		return
+	}
+	data, err := serviceMessageJSON(&message)
+	if err != nil {
+		wsm.logger.Warn().Err(err).Msg("Dropped invalid protobuf service message")
+		return
+	}
+	wsm.HandleMessage(s, data, fn)
+}
@@ -0,0 +1,230 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	masterKeyBytes = 32
+	dataKeyBytes   = 32
+)
+
+// sealedPayloadMagic marks values written by PayloadCipher, anything else is treated as legacy plaintext
+var sealedPayloadMagic = []byte("orra-enc1:")
+
+var ErrUnknownMasterKey = errors.New("payload was encrypted with an unknown master key")
+
+// KeyProvider wraps and unwraps per-record data keys with a master key.
+// A KMS backed provider only has to implement this interface.
+type KeyProvider interface {
+	KeyID() string
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyProvider wraps data keys with master keys supplied through config.
+// Previous keys are only used to unwrap, so they can be rotated out once data is re-written.
+type StaticKeyProvider struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+func NewStaticKeyProvider(current []byte, previous ...[]byte) (*StaticKeyProvider, error) {
+	provider := &StaticKeyProvider{keys: make(map[string]cipher.AEAD)}
+
+	for i, key := range append([][]byte{current}, previous...) {
+		if len(key) != masterKeyBytes {
+			return nil, fmt.Errorf("master keys must be %d bytes, got %d", masterKeyBytes, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		id := masterKeyID(key)
+		provider.keys[id] = aead
+		if i == 0 {
+			provider.currentID = id
+		}
+	}
+
+	return provider, nil
+}
+
+// NewStaticKeyProviderFromConfig decodes base64 encoded master keys
+func NewStaticKeyProviderFromConfig(cfg Encryption) (*StaticKeyProvider, error) {
+	current, err := base64.StdEncoding.DecodeString(cfg.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption master key: %w", err)
+	}
+
+	var previous [][]byte
+	for _, encoded := range cfg.PreviousMasterKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous encryption master key: %w", err)
+		}
+		previous = append(previous, key)
+	}
+
+	return NewStaticKeyProvider(current, previous...)
+}
+
+func (s *StaticKeyProvider) KeyID() string {
+	return s.currentID
+}
+
+func (s *StaticKeyProvider) WrapKey(dataKey []byte) ([]byte, error) {
+	return sealAEAD(s.keys[s.currentID], dataKey)
+}
+
+func (s *StaticKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := s.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	return openAEAD(aead, wrapped)
+}
+
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// sealedPayload is the envelope persisted in place of a plaintext payload
+type sealedPayload struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wk"`
+	Ciphertext []byte `json:"ct"`
+}
+
+// PayloadCipher applies envelope encryption, each payload is sealed with a fresh data key wrapped by the master key
+type PayloadCipher struct {
+	keys KeyProvider
+}
+
+func NewPayloadCipher(keys KeyProvider) *PayloadCipher {
+	return &PayloadCipher{keys: keys}
+}
+
+func (c *PayloadCipher) Seal(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeyBytes)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := sealAEAD(aead, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := c.keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	envelope, err := json.Marshal(sealedPayload{
+		KeyID:      c.keys.KeyID(),
+		WrappedKey: wrapped,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sealed payload: %w", err)
+	}
+
+	return append(append([]byte(nil), sealedPayloadMagic...), envelope...), nil
+}
+
+// Open decrypts a sealed payload, plaintext written before encryption was enabled is returned unchanged
+func (c *PayloadCipher) Open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, sealedPayloadMagic) {
+		return data, nil
+	}
+
+	var envelope sealedPayload
+	if err := json.Unmarshal(data[len(sealedPayloadMagic):], &envelope); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sealed payload: %w", err)
+	}
+
+	dataKey, err := c.keys.UnwrapKey(envelope.KeyID, envelope.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(aead, envelope.Ciphertext)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealAEAD(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAEAD(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+// encodePayload marshals a value to JSON, encrypting it when a payload cipher is configured
+func (b *BadgerDB) encodePayload(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if b.cipher == nil {
+		return data, nil
+	}
+	return b.cipher.Seal(data)
+}
+
+// decodePayload reverses encodePayload
+func (b *BadgerDB) decodePayload(data []byte, v any) error {
+	if b.cipher != nil {
+		var err error
+		if data, err = b.cipher.Open(data); err != nil {
+			return err
+		}
+	} else if bytes.HasPrefix(data, sealedPayloadMagic) {
+		return fmt.Errorf("payload is encrypted but no encryption master key is configured")
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,106 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMasterKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, masterKeyBytes)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestPayloadCipher_SealAndOpen(t *testing.T) {
+	oldKey := newTestMasterKey(t)
+	newKey := newTestMasterKey(t)
+
+	oldProvider, err := NewStaticKeyProvider(oldKey)
+	require.NoError(t, err)
+	sealedWithOld, err := NewPayloadCipher(oldProvider).Seal([]byte(`{"email":"jane@example.com"}`))
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(sealedWithOld, []byte("jane@example.com")))
+
+	rotated, err := NewStaticKeyProvider(newKey, oldKey)
+	require.NoError(t, err)
+	cipher := NewPayloadCipher(rotated)
+
+	t.Run("opens payloads sealed with a previous master key", func(t *testing.T) {
+		plaintext, err := cipher.Open(sealedWithOld)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"email":"jane@example.com"}`, string(plaintext))
+	})
+
+	t.Run("passes through plaintext written before encryption", func(t *testing.T) {
+		plaintext, err := cipher.Open([]byte(`{"legacy":true}`))
+		require.NoError(t, err)
+		assert.Equal(t, `{"legacy":true}`, string(plaintext))
+	})
+
+	t.Run("rejects payloads sealed with an unknown master key", func(t *testing.T) {
+		other, err := NewStaticKeyProvider(newTestMasterKey(t))
+		require.NoError(t, err)
+		_, err = NewPayloadCipher(other).Open(sealedWithOld)
+		assert.ErrorIs(t, err, ErrUnknownMasterKey)
+	})
+
+	_, err = NewStaticKeyProvider([]byte("too-short"))
+	assert.Error(t, err)
+}
+
+func TestBadgerDB_EncryptsOrchestrationPayloads(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	keys, err := NewStaticKeyProvider(newTestMasterKey(t))
+	require.NoError(t, err)
+	storage.EnablePayloadEncryption(NewPayloadCipher(keys))
+
+	orchestration := &Orchestration{
+		ID:        "o_secret",
+		ProjectID: "p_secret",
+		Params:    ActionParams{{Field: "ssn", Value: "123-45-6789"}},
+	}
+	require.NoError(t, storage.StoreOrchestration(orchestration))
+
+	entry := NewLogEntry("task_output", "task1", json.RawMessage(`{"ssn":"123-45-6789"}`), "s_svc", 0)
+	require.NoError(t, storage.StoreLogEntry(orchestration.ID, entry))
+
+	err = storage.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				assert.False(t, strings.Contains(string(val), "123-45-6789"), "payload stored in plaintext under %s", it.Item().Key())
+				return nil
+			})
+			require.NoError(t, err)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	loaded, err := storage.LoadOrchestration(orchestration.ID)
+	require.NoError(t, err)
+	assert.Equal(t, orchestration.Params, loaded.Params)
+
+	entries, err := storage.LoadEntries(orchestration.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.JSONEq(t, `{"ssn":"123-45-6789"}`, string(entries[0].Value))
+}
@@ -8,7 +8,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -41,12 +44,34 @@ func (e SpecVersionError) Error() string {
 
 func NewPlanEngine() *PlanEngine {
 	plane := &PlanEngine{
-		projects:           make(map[string]*Project),
-		services:           make(map[string]map[string]*ServiceInfo),
-		orchestrationStore: make(map[string]*Orchestration),
-		logWorkers:         make(map[string]map[string]context.CancelFunc),
-		groundings:         make(map[string]map[string]*GroundingSpec),
-	}
+		projects:              make(map[string]*Project),
+		services:              make(map[string]map[string]*ServiceInfo),
+		orchestrationStore:    make(map[string]*Orchestration),
+		logWorkers:            make(map[string]map[string]context.CancelFunc),
+		pauseGates:            make(map[string]chan struct{}),
+		deadlines:             make(map[string]*time.Timer),
+		slaTimers:             make(map[string]*time.Timer),
+		runningOrchestrations: make(map[string]string),
+		runningCounts:         make(map[string]int),
+		orchestrationQueues:   make(map[string][]queuedOrchestration),
+		approvals:             make(map[string]*pendingApproval),
+		groundings:            make(map[string]map[string]*GroundingSpec),
+		ResultCache:           NewTaskResultCache(resultCacheDefaultCapacity),
+		Metrics:               NewMetrics(),
+		webhookRetry: WebhookRetry{
+			MaxAttempts:     WebhookMaxAttempts,
+			InitialInterval: WebhookInitialInterval,
+			MaxInterval:     WebhookMaxInterval,
+		},
+		slowTasks: SlowTasks{
+			BaselineSize: SlowTaskBaselineSize,
+			MinSamples:   SlowTaskMinSamples,
+			Deviations:   SlowTaskDeviations,
+			MinDuration:  SlowTaskMinDuration,
+		},
+		latencyBaselines: make(map[string]*latencyBaseline),
+	}
+	plane.webhookClient = newAddressCheckedClient(plane.webhookAddressAllowed)
 	return plane
 }
 
@@ -65,7 +90,7 @@ func (p *PlanEngine) Initialise(
 ) {
 	p.pStorage = pStorage
 	p.svcStorage = svcStorage
-	p.orchestrationStorage = orchestrationStorage
+	p.orchestrationStorage = searchIndexedStorage{OrchestrationStorage: orchestrationStorage, search: &p.search}
 	p.groundingStorage = groundingStorage
 	p.LogManager = logMgr
 	p.Logger = Logger
@@ -73,11 +98,23 @@ func (p *PlanEngine) Initialise(
 	p.VectorCache = vCache
 	p.PddlValidator = pddlValid
 	p.SimilarityMatcher = matcher
+	p.stopping = ctx.Done()
 
+	var deferred, queued, unfinished []*Orchestration
 	if projects, err := pStorage.ListProjects(); err == nil {
 		p.Logger.Trace().Interface("Projects", projects).Msg("Loaded projects from DB")
 		for _, project := range projects {
-			p.projects[project.ID] = project
+			if project.hasPlaintextAPIKeys() {
+				if err := p.migratePlaintextAPIKeys(project); err != nil {
+					p.Logger.Error().
+						Err(err).
+						Str("ProjectID", project.ID).
+						Msg("Failed to hash plaintext API keys")
+				}
+			}
+			p.projectsMu.Lock()
+			p.projects[project.ID] = project.withoutPlaintextAPIKeys()
+			p.projectsMu.Unlock()
 			orchestrations, err := orchestrationStorage.ListProjectOrchestrations(project.ID)
 			p.Logger.Trace().Interface("Orchestrations", orchestrations).Msg("Loaded orchestrations from DB")
 			if err != nil {
@@ -99,6 +136,18 @@ func (p *PlanEngine) Initialise(
 				}
 
 				p.orchestrationStore[orchestration.ID] = orchestration
+				p.search.index(orchestration)
+				if !orchestrationFinished(orchestration.Status) {
+					unfinished = append(unfinished, orchestration)
+				}
+				switch orchestration.Status {
+				case Paused:
+					p.pauseGates[orchestration.ID] = make(chan struct{})
+				case Scheduled:
+					deferred = append(deferred, orchestration)
+				case Queued:
+					queued = append(queued, orchestration)
+				}
 				p.Logger.Trace().Interface("Orchestration", orchestration).Msg("Loaded orchestration from DB")
 			}
 			p.orchestrationStoreMu.Unlock()
@@ -130,12 +179,46 @@ func (p *PlanEngine) Initialise(
 		}
 	}
 
+	// Deferred and queued orchestrations are started once everything they're prepared against has loaded
+	for _, orchestration := range unfinished {
+		p.scheduleSLA(orchestration)
+	}
+	for _, orchestration := range deferred {
+		p.scheduleOrchestrationStart(ctx, orchestration)
+	}
+	p.requeueOrchestrations(ctx, queued)
+
+	if p.WebSocketManager != nil {
+		go p.WebSocketManager.RedeliverTasks(ctx)
+		p.WebSocketManager.StartTransports(ctx, p)
+		for _, projectServices := range p.services {
+			for _, service := range projectServices {
+				if service.Endpoint != "" {
+					p.WebSocketManager.ConnectCallbackService(service)
+				}
+			}
+		}
+	}
+	// Orchestrations interrupted waiting on approval are failed once services can be reached, failing them
+	// compensates their completed tasks
+	for _, orchestration := range unfinished {
+		p.failInterruptedApprovals(orchestration.ID)
+	}
 	if p.VectorCache != nil {
 		p.VectorCache.StartCleanup(ctx)
 	}
+	if p.ResultCache != nil {
+		p.ResultCache.StartCleanup(ctx)
+	}
 }
 
-func (p *PlanEngine) RegisterOrUpdateService(service *ServiceInfo) error {
+// ErrServiceNameTaken is returned when a service is registered under a name another of the project's services
+// or agents holds
+var ErrServiceNameTaken = errors.New("service name is taken")
+
+// RegisterOrUpdateService stores a service, reporting whether it was created. Services are keyed by their
+// project and name, registering a service under the name of one already registered updates it and keeps its ID.
+func (p *PlanEngine) RegisterOrUpdateService(service *ServiceInfo) (bool, error) {
 	if errs := v.Validate(service.Validation()); len(errs) > 0 {
 		err := fmt.Errorf("service validation error: %w", errs)
 		p.Logger.Error().
@@ -144,10 +227,26 @@ func (p *PlanEngine) RegisterOrUpdateService(service *ServiceInfo) error {
 			Str("ServiceName", service.Name).
 			Msgf("validated service")
 
-		return err
+		return false, err
 	}
 
-	if len(strings.TrimSpace(service.ID)) == 0 {
+	// Concurrent registrations of a service mustn't both create it
+	p.registrationMu.Lock()
+	defer p.registrationMu.Unlock()
+
+	named := p.projectServiceNamed(service.ProjectID, service.Name)
+	switch {
+	case named != nil && named.Type != service.Type:
+		return false, fmt.Errorf("%w: %s is registered with type %s", ErrServiceNameTaken, service.Name, named.Type)
+	case named != nil && service.ID != "" && named.ID != service.ID:
+		return false, fmt.Errorf("%w: %s is registered with another ID", ErrServiceNameTaken, service.Name)
+	case named != nil:
+		service.ID = named.ID
+	}
+
+	created := len(strings.TrimSpace(service.ID)) == 0
+	var revisions []ServiceRevision
+	if created {
 		service.ID = p.GenerateServiceKey()
 		service.Version = 1
 		p.Logger.Debug().
@@ -158,9 +257,11 @@ func (p *PlanEngine) RegisterOrUpdateService(service *ServiceInfo) error {
 		// Load existing service
 		existingService, err := p.svcStorage.LoadServiceByProjectID(service.ProjectID, service.ID)
 		if err != nil {
-			return fmt.Errorf("service with key %s not found: %w", service.ID, err)
+			return false, fmt.Errorf("service with key %s not found: %w", service.ID, err)
 		}
 		service.Version = existingService.Version + 1
+		service.EndpointSecret = existingService.EndpointSecret
+		revisions = existingService.Revisions
 
 		p.Logger.Debug().
 			Str("ProjectID", service.ProjectID).
@@ -169,14 +270,25 @@ func (p *PlanEngine) RegisterOrUpdateService(service *ServiceInfo) error {
 			Int64("ServiceVersion", service.Version).
 			Msgf("Updating existing service")
 	}
+	service.recordRevision(revisions, time.Now().UTC())
+
+	// Callbacks to a service's endpoint are signed with a secret it keeps across registrations
+	switch {
+	case service.Endpoint == "":
+		service.EndpointSecret = ""
+	case service.EndpointSecret == "":
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return false, err
+		}
+		service.EndpointSecret = secret
+	}
 
 	if err := p.svcStorage.StoreService(service); err != nil {
-		return fmt.Errorf("failed to store service: %w", err)
+		return false, fmt.Errorf("failed to store service: %w", err)
 	}
 
 	p.servicesMu.Lock()
-	defer p.servicesMu.Unlock()
-
 	projectServices, exists := p.services[service.ProjectID]
 	if !exists {
 		projectServices = make(map[string]*ServiceInfo)
@@ -190,7 +302,25 @@ func (p *PlanEngine) RegisterOrUpdateService(service *ServiceInfo) error {
 	}
 
 	projectServices[service.ID] = service
+	p.servicesMu.Unlock()
+
+	if p.WebSocketManager != nil {
+		p.WebSocketManager.ConnectCallbackService(service)
+	}
 
+	return created, nil
+}
+
+// projectServiceNamed finds the project's service or agent registered under the name
+func (p *PlanEngine) projectServiceNamed(projectID, name string) *ServiceInfo {
+	p.servicesMu.RLock()
+	defer p.servicesMu.RUnlock()
+
+	for _, service := range p.services[projectID] {
+		if service.Name == name {
+			return service
+		}
+	}
 	return nil
 }
 
@@ -213,6 +343,22 @@ func (p *PlanEngine) GetServiceByID(serviceID string) (*ServiceInfo, error) {
 	return service, nil
 }
 
+// releaseServiceExecutions pauses the in-progress executions of a service that lost its connection,
+// their task workers then send the tasks again once the service is healthy.
+func (p *PlanEngine) releaseServiceExecutions(serviceID string) {
+	service, err := p.GetServiceByID(serviceID)
+	if err != nil {
+		return
+	}
+
+	if released := service.IdempotencyStore.PauseInProgressExecutions(); released > 0 {
+		p.Logger.Info().
+			Str("ServiceID", serviceID).
+			Int("Executions", released).
+			Msg("Released in-flight tasks of stale service connection for redelivery")
+	}
+}
+
 func (p *PlanEngine) GetService(projectID string, serviceID string) (*ServiceInfo, error) {
 	p.servicesMu.RLock()
 	defer p.servicesMu.RUnlock()
@@ -420,57 +566,274 @@ func (p *PlanEngine) RemoveProjectGrounding(projectID string) error {
 	return nil
 }
 
+// GetProjectByApiKey finds the project holding an API key through the key's storage index
 func (p *PlanEngine) GetProjectByApiKey(key string) (*Project, error) {
-	// Try storage first
-	if project, err := p.pStorage.LoadProjectByAPIKey(key); err == nil {
+	project, err := p.pStorage.LoadProjectByAPIKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("no project found with the given API key")
+	}
+	return project, nil
+}
+
+func (p *PlanEngine) GetProjectByID(projectID string) (*Project, error) {
+	if project, exists := p.cachedProject(projectID); exists {
 		return project, nil
 	}
 
-	// Fallback to in-memory (can be removed once storage is fully tested)
+	project, err := p.pStorage.LoadProject(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("no project found with ID %s: %w", projectID, err)
+	}
+	return project, nil
+}
+
+// cachedProject returns the in-memory project, which mustn't be changed
+func (p *PlanEngine) cachedProject(projectID string) (*Project, bool) {
+	p.projectsMu.RLock()
+	defer p.projectsMu.RUnlock()
+	project, exists := p.projects[projectID]
+	return project, exists
+}
+
+// cachedProjects lists the in-memory projects, which mustn't be changed
+func (p *PlanEngine) cachedProjects() []*Project {
+	p.projectsMu.RLock()
+	defer p.projectsMu.RUnlock()
+	projects := make([]*Project, 0, len(p.projects))
 	for _, project := range p.projects {
-		if project.APIKey == key || contains(project.AdditionalAPIKeys, key) {
-			return project, nil
-		}
+		projects = append(projects, project)
 	}
+	return projects
+}
 
-	return nil, fmt.Errorf("no project found with the given API key: %s", key)
+// ListProjects returns every stored project
+func (p *PlanEngine) ListProjects() ([]*Project, error) {
+	return p.pStorage.ListProjects()
 }
 
+// AddProject hashes the project's plaintext API key and stores the project.
+// The plaintext key is left on the given project so it can be returned once to the caller.
 func (p *PlanEngine) AddProject(project *Project) error {
+	lookupKey, err := p.pStorage.APIKeyLookupKey()
+	if err != nil {
+		return fmt.Errorf("failed to load API key lookup key: %w", err)
+	}
+	if err := project.hashPlaintextAPIKeys(lookupKey); err != nil {
+		return fmt.Errorf("failed to hash project API key: %w", err)
+	}
+
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
 	if err := p.pStorage.StoreProject(project); err != nil {
 		return fmt.Errorf("failed to store project: %w", err)
 	}
 
-	p.projects[project.ID] = project
+	p.projectsMu.Lock()
+	p.projects[project.ID] = project.withoutPlaintextAPIKeys()
+	p.projectsMu.Unlock()
 	return nil
 }
 
-func (p *PlanEngine) AddProjectAPIKey(projectID string, apiKey string) error {
-	if err := p.pStorage.AddProjectAPIKey(projectID, apiKey); err != nil {
+func (p *PlanEngine) AddProjectAPIKey(projectID string, apiKey string, expiresAt *time.Time) error {
+	lookupKey, err := p.pStorage.APIKeyLookupKey()
+	if err != nil {
+		return fmt.Errorf("failed to load API key lookup key: %w", err)
+	}
+	hashed, err := NewHashedAPIKey(lookupKey, apiKey, false)
+	if err != nil {
+		return fmt.Errorf("failed to hash API key: %w", err)
+	}
+	hashed.ExpiresAt = expiresAt
+
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	if err := p.pStorage.AddProjectAPIKey(projectID, hashed); err != nil {
 		return fmt.Errorf("failed to add API key: %w", err)
 	}
 
 	// Update in-memory state
-	if project, exists := p.projects[projectID]; exists {
-		project.AdditionalAPIKeys = append(project.AdditionalAPIKeys, apiKey)
+	if project, exists := p.cachedProject(projectID); exists {
+		updated := project.withoutPlaintextAPIKeys()
+		updated.APIKeyHashes = append(updated.APIKeyHashes, hashed)
+		p.cacheProject(updated)
+	}
+
+	return nil
+}
+
+// migratePlaintextAPIKeys replaces API keys stored in plaintext by earlier versions with their hashes
+func (p *PlanEngine) migratePlaintextAPIKeys(project *Project) error {
+	lookupKey, err := p.pStorage.APIKeyLookupKey()
+	if err != nil {
+		return fmt.Errorf("failed to load API key lookup key: %w", err)
+	}
+	if err := project.hashPlaintextAPIKeys(lookupKey); err != nil {
+		return err
+	}
+
+	if err := p.pStorage.StoreProject(project); err != nil {
+		return fmt.Errorf("failed to store project with hashed API keys: %w", err)
 	}
 
+	p.Logger.Info().
+		Str("ProjectID", project.ID).
+		Int("APIKeys", len(project.APIKeyHashes)).
+		Msg("Migrated plaintext API keys to hashes")
+
 	return nil
 }
 
-func (p *PlanEngine) AddProjectWebhook(projectID string, webhook string) error {
-	if err := p.pStorage.AddProjectWebhook(projectID, webhook); err != nil {
-		return fmt.Errorf("failed to add webhook: %w", err)
+// AddProjectWebhook adds a webhook to a project, returning the secret its deliveries are signed with
+func (p *PlanEngine) AddProjectWebhook(projectID string, webhook string, options ProjectWebhookOptions) (string, error) {
+	current, err := generateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	secret := WebhookSecret{Current: current}
+
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return "", fmt.Errorf("failed to add webhook: %w", err)
+	}
+	id := project.newWebhookID(webhook)
+	if err := p.pStorage.AddProjectWebhook(projectID, webhook, id, options, secret); err != nil {
+		return "", fmt.Errorf("failed to add webhook: %w", err)
 	}
 
 	// Update in-memory state
-	if project, exists := p.projects[projectID]; exists {
-		project.Webhooks = append(project.Webhooks, webhook)
+	if project, exists := p.cachedProject(projectID); exists {
+		updated := project.withoutPlaintextAPIKeys()
+		updated.Webhooks = append(slices.Clone(project.Webhooks), webhook)
+		updated.WebhookIDs = maps.Clone(project.WebhookIDs)
+		updated.setWebhookID(webhook, id)
+		updated.WebhookEvents = maps.Clone(project.WebhookEvents)
+		updated.setWebhookEvents(webhook, options.Events)
+		updated.WebhookFormats = maps.Clone(project.WebhookFormats)
+		updated.setWebhookFormat(webhook, options.Format)
+		updated.WebhookRequests = maps.Clone(project.WebhookRequests)
+		updated.setWebhookRequest(webhook, newWebhookRequest(options.Headers, options.Timeout))
+		updated.WebhookSecrets = maps.Clone(project.WebhookSecrets)
+		updated.setWebhookSecret(webhook, secret)
+		p.cacheProject(updated)
+	}
+
+	return secret.Current, nil
+}
+
+// AddProjectMember grants a user a role on a project, updating the role if they're already a member
+func (p *PlanEngine) AddProjectMember(projectID string, member ProjectMember) error {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Members = append([]ProjectMember(nil), project.Members...)
+
+	replaced := false
+	for i, existing := range updated.Members {
+		if (member.Subject != "" && existing.identifiedBy(member.Subject)) || (member.Email != "" && existing.identifiedBy(member.Email)) {
+			updated.Members[i] = member
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		updated.Members = append(updated.Members, member)
+	}
+	if updated.ownerCount() == 0 && project.ownerCount() > 0 {
+		return ErrProjectNeedsOwner
+	}
+
+	return p.updateProject(updated)
+}
+
+// RemoveProjectMember revokes a user's access to a project by subject or email
+func (p *PlanEngine) RemoveProjectMember(projectID, identifier string) error {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Members = nil
+	for _, member := range project.Members {
+		if !member.identifiedBy(identifier) {
+			updated.Members = append(updated.Members, member)
+		}
+	}
+
+	if len(updated.Members) == len(project.Members) {
+		return ErrProjectMemberNotFound
+	}
+	if updated.ownerCount() == 0 && project.ownerCount() > 0 {
+		return ErrProjectNeedsOwner
 	}
 
+	return p.updateProject(updated)
+}
+
+// UpdateProjectSecurity replaces a project's network access restrictions
+func (p *PlanEngine) UpdateProjectSecurity(projectID string, update ProjectSecurityUpdate) (ProjectSecurity, error) {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return ProjectSecurity{}, err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Security = update.apply(project.Security)
+	if err := p.updateProject(updated); err != nil {
+		return ProjectSecurity{}, err
+	}
+	return updated.Security, nil
+}
+
+// ProjectsForUser returns the projects a user is a member of
+func (p *PlanEngine) ProjectsForUser(claims *UserClaims) []*Project {
+	p.projectsMu.RLock()
+	defer p.projectsMu.RUnlock()
+
+	var out []*Project
+	for _, project := range p.projects {
+		if _, ok := project.MemberRole(claims); ok {
+			out = append(out, project)
+		}
+	}
+	return out
+}
+
+// updateProject stores a changed copy of a project in place of the original, callers hold projectWriteMu from
+// reading the project they changed
+func (p *PlanEngine) updateProject(project *Project) error {
+	project.UpdatedAt = time.Now().UTC()
+	if err := p.pStorage.StoreProject(project); err != nil {
+		return fmt.Errorf("failed to store project: %w", err)
+	}
+	p.cacheProject(project)
 	return nil
 }
 
+// cacheProject replaces the in-memory project
+func (p *PlanEngine) cacheProject(project *Project) {
+	p.projectsMu.Lock()
+	defer p.projectsMu.Unlock()
+	p.projects[project.ID] = project
+}
+
 func contains(entries []string, v string) bool {
 	for _, e := range entries {
 		if e == v {
@@ -550,6 +913,20 @@ func (o *Orchestration) GetTimeout() time.Duration {
 	return o.Timeout.Duration
 }
 
+func (o *Orchestration) GetOrchestrationTimeout() time.Duration {
+	if o.OrchestrationTimeout == nil {
+		return 0
+	}
+	return o.OrchestrationTimeout.Duration
+}
+
+func (o *Orchestration) GetTaskExecutionTimeout() time.Duration {
+	if o.TaskExecutionTimeout == nil {
+		return 0
+	}
+	return o.TaskExecutionTimeout.Duration
+}
+
 func (o *Orchestration) FailedBeforeDecomposition() bool {
 	return o.Status == Failed && o.Plan == nil
 }
@@ -571,14 +948,30 @@ func (s *SubTask) extractDependencies() TaskDependenciesWithKeys {
 			out[dep] = append(out[dep], TaskDependencyMapping{taskKey, key})
 		}
 	}
+	// Tasks of supplied plans may wait on others without using their output
+	for _, dep := range s.DependsOn {
+		if _, ok := out[dep]; !ok {
+			out[dep] = nil
+		}
+	}
+	// Conditional tasks wait for the output their condition is evaluated against
+	if s.Condition != nil {
+		if _, ok := out[s.Condition.Source]; !ok {
+			out[s.Condition.Source] = nil
+		}
+	}
 	return out
 }
 
 // extractDependencyIDAndKey extracts the task ID and task dependency key from a dependency reference
-// Example: "$task0.param1" returns "task0", "param1"
+// Example: "$task0.param1" returns "task0", "param1". The key may be a mapping expression selecting part
+// of the task's output, "$.task1.customer.emails[0]" returns "task1", "customer.emails[0]".
 func extractDependencyIDAndKey(input any) (depID string, depKey string) {
 	switch val := input.(type) {
 	case string:
+		if strings.HasPrefix(val, jsonPathRoot) {
+			val = "$" + strings.TrimPrefix(val, jsonPathRoot)
+		}
 		matches := DependencyPattern.FindStringSubmatch(val)
 		if len(matches) <= 1 {
 			return "", ""
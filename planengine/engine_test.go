@@ -27,6 +27,8 @@ func TestExtractDependencyID(t *testing.T) {
 		{"has complex dependency id", "$complex-task-id.field", "complex-task-id", "field"},
 		{"has no dependency", "notadependency", "", ""},
 		{"has invalid dependency", "$.invalid", "", ""},
+		{"has mapping expression", "$task1.customer.emails[0]", "task1", "customer.emails[0]"},
+		{"has json path mapping expression", "$.task1.customer.email", "task1", "customer.email"},
 		{"has dependency but no param", "$task0", "", ""},
 		{"empty input", "", "", ""},
 	}
@@ -0,0 +1,117 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	NDJSONContentType = "application/x-ndjson"
+	// exportFlushInterval is how many exported orchestrations are sent together
+	exportFlushInterval = 100
+)
+
+// ExportedOrchestration is one line of an export. Exports interrupted part way are resumed from the cursor of
+// the last line received.
+type ExportedOrchestration struct {
+	Cursor        string          `json:"cursor"`
+	Orchestration json.RawMessage `json:"orchestration"`
+}
+
+// exportQuery filters the orchestrations exported. Exports run oldest first, so orchestrations accepted while
+// an export runs, or after it ended, are picked up when it's resumed.
+func exportQuery(r *http.Request) (OrchestrationQuery, error) {
+	values := r.URL.Query()
+	if sort := values.Get("sort"); sort != "" && sort != OrchestrationSortTimestamp {
+		return OrchestrationQuery{}, fmt.Errorf("exports are sorted by %s, oldest first", OrchestrationSortTimestamp)
+	}
+	values.Set("sort", OrchestrationSortTimestamp)
+	limited := values.Get("limit") != ""
+
+	query, err := parseOrchestrationQuery(values)
+	if err != nil {
+		return OrchestrationQuery{}, err
+	}
+	if !limited {
+		query.Limit = 0
+	}
+	return query, nil
+}
+
+// exportOrchestrations lists the project's orchestrations passing the query's filters, from its cursor on
+func (p *PlanEngine) exportOrchestrations(projectID string, query OrchestrationQuery) []*Orchestration {
+	var matching []*Orchestration
+	for _, o := range p.getProjectOrchestrations(projectID) {
+		if query.Matches(o) {
+			matching = append(matching, o)
+		}
+	}
+	if !query.paginated() {
+		query.Limit = len(matching)
+	}
+	exported, _ := query.paginate(matching)
+	return exported
+}
+
+// ExportOrchestrationsHandler streams the caller's orchestrations as newline delimited JSON, filtered like
+// orchestration lists, for analytics pipelines ingesting orchestration history
+func (app *App) ExportOrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	query, err := exportQuery(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, err))
+		return
+	}
+	orchestrations := app.Engine.exportOrchestrations(project.ID, query)
+
+	// Exports of long histories outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	for i, orchestration := range orchestrations {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		// Orchestrations keep progressing as they're exported, each is copied out under the store's lock
+		app.Engine.orchestrationStoreMu.RLock()
+		data, err := json.Marshal(orchestration)
+		app.Engine.orchestrationStoreMu.RUnlock()
+		if err != nil {
+			logger := app.requestLogger(r)
+			logger.Error().Err(err).Str("OrchestrationID", orchestration.ID).Msg("Failed to export orchestration")
+			return
+		}
+
+		line := ExportedOrchestration{
+			Cursor:        newOrchestrationCursor(query.Sort, orchestration).encode(),
+			Orchestration: data,
+		}
+		if err := encoder.Encode(line); err != nil {
+			return
+		}
+		if (i+1)%exportFlushInterval == 0 {
+			_ = rc.Flush()
+		}
+	}
+}
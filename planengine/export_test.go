@@ -0,0 +1,97 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportOrchestrations(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		status := Completed
+		if i%2 == 1 {
+			status = Failed
+		}
+		id := fmt.Sprintf("o_%d", i)
+		app.Engine.orchestrationStore[id] = &Orchestration{ID: id, ProjectID: project.ID, Status: status, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+	}
+	app.Engine.orchestrationStore["o_other"] = &Orchestration{ID: "o_other", ProjectID: "another-project", Status: Completed, Timestamp: start}
+
+	export := func(rawQuery string) (*httptest.ResponseRecorder, []ExportedOrchestration) {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/export?"+rawQuery, nil)
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+
+		var lines []ExportedOrchestration
+		if w.Code != http.StatusOK {
+			return w, lines
+		}
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var line ExportedOrchestration
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		return w, lines
+	}
+	ids := func(lines []ExportedOrchestration) []string {
+		var out []string
+		for _, line := range lines {
+			var orchestration Orchestration
+			require.NoError(t, json.Unmarshal(line.Orchestration, &orchestration))
+			out = append(out, orchestration.ID)
+		}
+		return out
+	}
+
+	t.Run("streams every orchestration oldest first", func(t *testing.T) {
+		w, lines := export("")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, NDJSONContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, []string{"o_0", "o_1", "o_2", "o_3", "o_4"}, ids(lines))
+	})
+
+	t.Run("filters like orchestration lists", func(t *testing.T) {
+		_, lines := export("status=failed")
+		assert.Equal(t, []string{"o_1", "o_3"}, ids(lines))
+	})
+
+	t.Run("resumes from a line's cursor", func(t *testing.T) {
+		_, lines := export("limit=2")
+		require.Equal(t, []string{"o_0", "o_1"}, ids(lines))
+
+		app.Engine.orchestrationStoreMu.Lock()
+		app.Engine.orchestrationStore["o_5"] = &Orchestration{ID: "o_5", ProjectID: project.ID, Status: Completed, Timestamp: start.Add(time.Hour)}
+		app.Engine.orchestrationStoreMu.Unlock()
+
+		_, lines = export("cursor=" + lines[1].Cursor)
+		assert.Equal(t, []string{"o_2", "o_3", "o_4", "o_5"}, ids(lines))
+	})
+
+	t.Run("only exports oldest first", func(t *testing.T) {
+		w, _ := export("sort=-timestamp")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
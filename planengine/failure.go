@@ -99,15 +99,21 @@ func (f *FailureTracker) processEntry(entry LogEntry, orchestrationID string) er
 	}
 
 	var errorPayload = struct {
-		Id              string `json:"id"`
-		ProducerID      string `json:"producer"`
-		OrchestrationID string `json:"orchestration"`
-		Error           string `json:"error"`
+		Id              string          `json:"id"`
+		ProducerID      string          `json:"producer"`
+		OrchestrationID string          `json:"orchestration"`
+		Error           string          `json:"error"`
+		Code            string          `json:"code,omitempty"`
+		Details         json.RawMessage `json:"details,omitempty"`
+		Terminal        bool            `json:"terminal,omitempty"`
 	}{
 		Id:              entry.GetID(),
 		ProducerID:      entry.GetProducerID(),
 		OrchestrationID: orchestrationID,
 		Error:           failure.Failure,
+		Code:            failure.Code,
+		Details:         failure.Details,
+		Terminal:        failure.Terminal,
 	}
 
 	reason, err := json.Marshal(errorPayload)
@@ -115,9 +121,18 @@ func (f *FailureTracker) processEntry(entry LogEntry, orchestrationID string) er
 		return fmt.Errorf("failure tracker failed to marshal error payload: %w", err)
 	}
 
-	failed := f.LogManager.MarkOrchestrationFailed(orchestrationID, failure.Failure)
+	status := Failed
+	if failure.TimedOut {
+		status = TimedOut
+	}
+	failed := f.LogManager.MarkOrchestration(orchestrationID, status, []byte(failure.Failure))
 
-	if err := f.LogManager.FinalizeOrchestration(orchestrationID, failed, reason, nil, failure.SkipWebhook); err != nil {
+	err = f.LogManager.FinalizeOrchestration(orchestrationID, failed, reason, nil, failure.SkipWebhook)
+	// Re-driving an orchestration that failed terminally would fail the same way
+	if !failure.Terminal {
+		f.LogManager.planEngine.deadLetterOrchestration(orchestrationID)
+	}
+	if err != nil {
 		isWebHookErr := strings.Contains(err.Error(), "failed to trigger webhook")
 		return f.LogManager.AppendTaskFailureToLog(
 			orchestrationID,
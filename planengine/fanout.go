@@ -0,0 +1,341 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFanOutParallelism = 10
+	MaxFanOutParallelism     = 100
+	fanOutInputID            = "fan_out_input"
+)
+
+// FanOutSpec runs a service's tasks once per element of one of their array inputs
+type FanOutSpec struct {
+	// Service is the ID or name of the service whose tasks are fanned out
+	Service string `json:"service"`
+	// Input is the task input holding the array, each instance receives one of its elements instead
+	Input string `json:"input"`
+	// MaxParallel caps how many instances run at once, it defaults to DefaultFanOutParallelism
+	MaxParallel int `json:"maxParallel,omitempty"`
+}
+
+func (f FanOutSpec) Validate() error {
+	if f.MaxParallel < 0 || f.MaxParallel > MaxFanOutParallelism {
+		return fmt.Errorf("maxParallel must be between 1 and %d", MaxFanOutParallelism)
+	}
+	return nil
+}
+
+// FanOut marks a planned task as fanned out over one of its inputs
+type FanOut struct {
+	Input       string `json:"input"`
+	MaxParallel int    `json:"max_parallel"`
+}
+
+type FanOutWorker struct {
+	*TaskWorker
+	FanOut FanOut
+	// newInstance creates the worker running the task for a single element
+	newInstance func(taskID string) *TaskWorker
+}
+
+// markFanOutTasks flags the tasks of fanned out services. Tasks may be shared with the plan cache,
+// so flagged tasks are copied rather than changed.
+func markFanOutTasks(plan *ExecutionPlan, specs []FanOutSpec) *ExecutionPlan {
+	if len(specs) == 0 {
+		return plan
+	}
+
+	marked := *plan
+	marked.Tasks = make([]*SubTask, 0, len(plan.Tasks))
+	for _, task := range plan.Tasks {
+		spec, ok := fanOutSpecFor(task, specs)
+		if !ok {
+			marked.Tasks = append(marked.Tasks, task)
+			continue
+		}
+
+		maxParallel := spec.MaxParallel
+		if maxParallel == 0 {
+			maxParallel = DefaultFanOutParallelism
+		}
+		fanned := *task
+		fanned.FanOut = &FanOut{Input: spec.Input, MaxParallel: maxParallel}
+		marked.Tasks = append(marked.Tasks, &fanned)
+	}
+	return &marked
+}
+
+func fanOutSpecFor(task *SubTask, specs []FanOutSpec) (FanOutSpec, bool) {
+	for _, spec := range specs {
+		if !strings.EqualFold(spec.Service, task.Service) && !strings.EqualFold(spec.Service, task.ServiceName) {
+			continue
+		}
+		if _, hasInput := task.Input[spec.Input]; hasInput {
+			return spec, true
+		}
+	}
+	return FanOutSpec{}, false
+}
+
+func NewFanOutWorker(
+	service *ServiceInfo,
+	task *SubTask,
+	timeout time.Duration,
+	executionTimeout time.Duration,
+	healthCheckGracePeriod time.Duration,
+	retryPolicy RetryPolicy,
+	logManager *LogManager,
+) LogWorker {
+	newTaskWorker := func(taskID string, dependencies TaskDependenciesWithKeys) *TaskWorker {
+		return NewTaskWorker(service, taskID, dependencies, timeout, 0, healthCheckGracePeriod, retryPolicy, logManager).(*TaskWorker)
+	}
+
+	worker := newTaskWorker(task.ID, task.extractDependencies())
+	worker.ExecutionTimeout = executionTimeout
+	worker.Condition = task.Condition
+
+	return &FanOutWorker{
+		TaskWorker: worker,
+		FanOut:     *task.FanOut,
+		newInstance: func(taskID string) *TaskWorker {
+			return newTaskWorker(taskID, nil)
+		},
+	}
+}
+
+func (f *FanOutWorker) Start(ctx context.Context, orchestrationID string) {
+	logStream := f.LogManager.GetLog(orchestrationID)
+	if logStream == nil {
+		f.LogManager.Logger.Debug().Str("orchestrationID", orchestrationID).Msg("Log stream not found for orchestration")
+		return
+	}
+
+	entriesChan := make(chan LogEntry, 100)
+	go f.PollLog(ctx, orchestrationID, logStream, entriesChan)
+
+	for {
+		select {
+		case entry := <-entriesChan:
+			if err := f.processEntry(ctx, entry, orchestrationID); err != nil {
+				f.LogManager.Logger.
+					Error().
+					Err(err).
+					Str("orchestrationID", orchestrationID).
+					Msgf("Fan out worker %s failed to process entry for orchestration", f.TaskID)
+				return
+			}
+		case <-ctx.Done():
+			f.LogManager.Logger.Info().Msgf("FanOutWorker for task %s in orchestration %s is stopping", f.TaskID, orchestrationID)
+			return
+		}
+	}
+}
+
+func (f *FanOutWorker) processEntry(ctx context.Context, entry LogEntry, orchestrationID string) error {
+	f.logState.DependencyState[entry.GetID()] = entry.GetValue()
+	if !taskDependenciesMet(f.logState.DependencyState, f.Dependencies) {
+		return nil
+	}
+
+	if err := f.LogManager.planEngine.awaitDispatch(ctx, orchestrationID); err != nil {
+		f.LogManager.Logger.Info().Msgf("Task %s for orchestration %s was stopped while paused", f.TaskID, orchestrationID)
+		return nil
+	}
+
+	if skipped, err := f.skipUnlessConditionMet(orchestrationID); skipped || err != nil {
+		return err
+	}
+
+	processingTs := time.Now().UTC()
+	if err := f.LogManager.MarkTask(orchestrationID, f.TaskID, Processing, processingTs); err != nil {
+		return err
+	}
+	if err := f.LogManager.AppendTaskStatusEvent(orchestrationID, f.TaskID, f.Service.ID, Processing, nil, processingTs, 0); err != nil {
+		return err
+	}
+	if err := f.checkServiceVersion(orchestrationID); err != nil {
+		f.LogManager.Logger.Error().Err(err).Msgf("Cannot dispatch task %s for orchestration %s", f.TaskID, orchestrationID)
+		return f.failTask(orchestrationID, err)
+	}
+
+	execCtx := ctx
+	if f.ExecutionTimeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, f.ExecutionTimeout)
+		defer cancel()
+	}
+
+	output, err := f.executeInstances(execCtx, orchestrationID)
+	if errors.Is(err, context.Canceled) {
+		f.LogManager.Logger.Info().Msgf("Task %s for orchestration %s was stopped before completing", f.TaskID, orchestrationID)
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return f.timeOutTask(orchestrationID)
+	}
+	if err != nil {
+		f.LogManager.Logger.Error().Err(err).Msgf("Cannot execute task %s for orchestration %s", f.TaskID, orchestrationID)
+		failedTs := time.Now().UTC()
+		if err := f.LogManager.AppendTaskStatusEvent(orchestrationID, f.TaskID, f.Service.ID, Failed, err, failedTs, 0); err != nil {
+			return err
+		}
+		if err := f.LogManager.MarkTask(orchestrationID, f.TaskID, Failed, failedTs); err != nil {
+			return err
+		}
+		return f.LogManager.AppendTaskErrorToLog(orchestrationID, f.TaskID, f.Service.ID, err, 0, !f.RetryPolicy.Retryable(err))
+	}
+
+	f.LogManager.AppendToLog(orchestrationID, "task_output", f.TaskID, output, f.Service.ID, 0)
+	f.LogManager.planEngine.streamTaskResult(orchestrationID, f.TaskID, f.Service.ID, output)
+
+	completedTs := time.Now().UTC()
+	if err := f.LogManager.AppendTaskStatusEvent(orchestrationID, f.TaskID, f.Service.ID, Completed, nil, completedTs, 0); err != nil {
+		return err
+	}
+	return f.LogManager.MarkTaskCompleted(orchestrationID, f.TaskID, completedTs)
+}
+
+// executeInstances runs the task once per element, at most MaxParallel at a time. Each output field is
+// collected into an array ordered like the elements, so tasks depending on this one keep their references.
+func (f *FanOutWorker) executeInstances(ctx context.Context, orchestrationID string) (json.RawMessage, error) {
+	inputs, err := f.instanceInputs()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outputs := make([]map[string]any, len(inputs))
+	failures := make([]error, len(inputs))
+	slots := make(chan struct{}, f.FanOut.MaxParallel)
+	var wg sync.WaitGroup
+
+	for i, input := range inputs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, firstFanOutError(failures, ctx.Err())
+		}
+
+		wg.Add(1)
+		go func(i int, input json.RawMessage) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			outputs[i], failures[i] = f.executeInstance(ctx, orchestrationID, fmt.Sprintf("%s_%d", f.TaskID, i), input)
+			if failures[i] != nil {
+				cancel()
+			}
+		}(i, input)
+	}
+	wg.Wait()
+
+	if err := firstFanOutError(failures, nil); err != nil {
+		return nil, err
+	}
+	return collectFanOutOutputs(outputs)
+}
+
+// collectFanOutOutputs gathers every instance's value for an output field into one array
+func collectFanOutOutputs(outputs []map[string]any) (json.RawMessage, error) {
+	collected := make(map[string][]any)
+	for i, output := range outputs {
+		for key, value := range output {
+			if _, exists := collected[key]; !exists {
+				collected[key] = make([]any, len(outputs))
+			}
+			collected[key][i] = value
+		}
+	}
+	return json.Marshal(collected)
+}
+
+// instanceInputs resolves the task's input once per element of its fanned out array
+func (f *FanOutWorker) instanceInputs() ([]json.RawMessage, error) {
+	resolved, err := mergeValueMapsToJson(f.logState.DependencyState, f.Dependencies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	var input map[string]any
+	if err := json.Unmarshal(resolved, &input); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal input: %w", err)
+	}
+
+	elements, ok := input[f.FanOut.Input].([]any)
+	if !ok {
+		return nil, fmt.Errorf("task %s cannot fan out, input %s is not an array", f.TaskID, f.FanOut.Input)
+	}
+
+	inputs := make([]json.RawMessage, 0, len(elements))
+	for _, element := range elements {
+		input[f.FanOut.Input] = element
+		data, err := json.Marshal(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal input: %w", err)
+		}
+		inputs = append(inputs, data)
+	}
+	return inputs, nil
+}
+
+func (f *FanOutWorker) executeInstance(ctx context.Context, orchestrationID, instanceID string, input json.RawMessage) (map[string]any, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return nil, err
+	}
+
+	instance := f.newInstance(instanceID)
+	instance.Priority = f.Priority
+	instance.Dependencies = TaskDependenciesWithKeys{fanOutInputID: nil}
+	for key := range fields {
+		instance.Dependencies[fanOutInputID] = append(instance.Dependencies[fanOutInputID], TaskDependencyMapping{TaskKey: key, DependencyKey: key})
+	}
+	instance.logState.DependencyState[fanOutInputID] = input
+
+	result, _, err := instance.executeTaskCached(ctx, orchestrationID)
+	if err != nil {
+		return nil, fmt.Errorf("instance %s failed: %w", instanceID, err)
+	}
+	taskOutput, err := instance.processTaskResult(orchestrationID, result)
+	if err != nil {
+		return nil, err
+	}
+
+	var output map[string]any
+	if err := json.Unmarshal(taskOutput, &output); err != nil {
+		return nil, fmt.Errorf("instance %s returned an invalid output: %w", instanceID, err)
+	}
+	return output, nil
+}
+
+// firstFanOutError prefers an instance's own failure over the cancellation it caused in the others
+func firstFanOutError(failures []error, fallback error) error {
+	for _, err := range failures {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	for _, err := range failures {
+		if err != nil {
+			return err
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,58 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkFanOutTasks(t *testing.T) {
+	summarize := &SubTask{ID: "task1", Service: "s_summarize", ServiceName: "Summarizer", Input: map[string]any{"url": "$task0.urls"}}
+	plan := &ExecutionPlan{
+		ProjectID: "p_test",
+		Tasks: []*SubTask{
+			summarize,
+			{ID: "task2", Service: "s_report", ServiceName: "Reporter", Input: map[string]any{"summaries": "$task1.summary"}},
+		},
+	}
+
+	marked := markFanOutTasks(plan, []FanOutSpec{
+		{Service: "summarizer", Input: "url"},
+		{Service: "reporter", Input: "unknown", MaxParallel: 5},
+	})
+
+	require.Len(t, marked.Tasks, 2)
+	assert.Equal(t, &FanOut{Input: "url", MaxParallel: DefaultFanOutParallelism}, marked.Tasks[0].FanOut)
+	assert.Nil(t, marked.Tasks[1].FanOut, "tasks without the fanned out input run once")
+	assert.Nil(t, summarize.FanOut, "planned tasks are left untouched")
+
+	assert.Same(t, plan, markFanOutTasks(plan, nil))
+}
+
+func TestFanOutInstances(t *testing.T) {
+	task := &SubTask{ID: "task1", Service: "s_summarize", Input: map[string]any{"url": "$task0.urls", "length": "$task0.length"}, FanOut: &FanOut{Input: "url", MaxParallel: 2}}
+	worker := NewFanOutWorker(&ServiceInfo{ID: "s_summarize"}, task, 0, 0, 0, resolveRetryPolicy(nil, nil), nil).(*FanOutWorker)
+
+	worker.logState.DependencyState["task0"] = json.RawMessage(`{"urls":["https://a.example","https://b.example"],"length":100}`)
+	inputs, err := worker.instanceInputs()
+	require.NoError(t, err)
+	require.Len(t, inputs, 2)
+	assert.JSONEq(t, `{"url":"https://a.example","length":100}`, string(inputs[0]))
+	assert.JSONEq(t, `{"url":"https://b.example","length":100}`, string(inputs[1]))
+
+	worker.logState.DependencyState["task0"] = json.RawMessage(`{"urls":"https://a.example","length":100}`)
+	_, err = worker.instanceInputs()
+	assert.ErrorContains(t, err, "is not an array")
+
+	collected, err := collectFanOutOutputs([]map[string]any{{"summary": "first"}, {"summary": "second", "words": 2.0}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"summary":["first","second"],"words":[null,2]}`, string(collected))
+}
@@ -0,0 +1,87 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const inspectionTimelineField = "timeline"
+
+// inspectionFields are the fields ?fields= can pick from an inspection. The timeline isn't part of a full
+// inspection, it's only included when picked.
+var inspectionFields = append(jsonFieldNames(reflect.TypeOf(OrchestrationInspectResponse{})), inspectionTimelineField)
+
+// jsonFieldNames lists the names a struct's fields are marshalled with
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseFieldset parses a comma separated ?fields= value into the sorted fields picked, none when it's empty
+func parseFieldset(value string, allowed []string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || slices.Contains(fields, field) {
+			continue
+		}
+		if !slices.Contains(allowed, field) {
+			return nil, fmt.Errorf("unknown field %q, fields can be picked from %s", field, strings.Join(allowed, ", "))
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// sparseInspection keeps the picked fields of an inspection, and always its ID
+func (p *PlanEngine) sparseInspection(inspection *OrchestrationInspectResponse, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(inspection)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	sparse := map[string]json.RawMessage{"id": all["id"]}
+	for _, field := range fields {
+		if field == inspectionTimelineField {
+			timeline, err := p.OrchestrationTimeline(inspection.ID)
+			if err != nil {
+				return nil, err
+			}
+			if sparse[field], err = json.Marshal(timeline); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Fields left out of the inspection, e.g. an empty error, are left out here too
+		if value, ok := all[field]; ok {
+			sparse[field] = value
+		}
+	}
+	return sparse, nil
+}
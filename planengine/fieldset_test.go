@@ -0,0 +1,93 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectionFieldsets(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	orchestration.TaskZero = json.RawMessage(`{}`)
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{
+		"s_echo":  {ID: "s_echo", Name: "echo", ProjectID: project.ID},
+		"s_audit": {ID: "s_audit", Name: "audit", ProjectID: project.ID},
+	}
+
+	inspect := func(fields string) *httptest.ResponseRecorder {
+		target := "/orchestrations/inspections/" + orchestration.ID
+		if fields != "" {
+			target += "?fields=" + url.QueryEscape(fields)
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]json.RawMessage {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body map[string]json.RawMessage
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		return body
+	}
+
+	t.Run("full inspections include tasks", func(t *testing.T) {
+		body := decode(inspect(""))
+		assert.Contains(t, body, "tasks")
+		assert.NotContains(t, body, inspectionTimelineField)
+	})
+
+	t.Run("only picked fields are sent", func(t *testing.T) {
+		body := decode(inspect("status, timeline,status"))
+		assert.ElementsMatch(t, []string{"id", "status", "timeline"}, keys(body))
+		assert.JSONEq(t, `"processing"`, string(body["status"]))
+
+		var timeline OrchestrationTimeline
+		require.NoError(t, json.Unmarshal(body["timeline"], &timeline))
+	})
+
+	t.Run("tasks are built when picked", func(t *testing.T) {
+		body := decode(inspect("tasks"))
+		var tasks []json.RawMessage
+		require.NoError(t, json.Unmarshal(body["tasks"], &tasks))
+		assert.NotEmpty(t, tasks)
+	})
+
+	t.Run("fieldsets have their own ETags", func(t *testing.T) {
+		assert.NotEqual(t, inspect("").Header().Get("ETag"), inspect("status").Header().Get("ETag"))
+		assert.Equal(t, inspect("status,error").Header().Get("ETag"), inspect("error,status").Header().Get("ETag"))
+	})
+
+	t.Run("unknown fields are rejected", func(t *testing.T) {
+		w := inspect("status,secrets")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var problem Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, "fields", problem.Param)
+		assert.Contains(t, problem.Detail, `"secrets"`)
+	})
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	var result []string
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,249 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	GraphFormatMermaid = "mermaid"
+	GraphFormatDOT     = "dot"
+	GraphFormatJSON    = "json"
+)
+
+// graphStatusColors colour a task's node by its latest status, statuses without a colour use pending's
+var graphStatusColors = map[Status]string{
+	Pending:    "#e2e5eb",
+	Processing: "#bfd0f8",
+	Completed:  "#b7e4c7",
+	Failed:     "#f8b4b4",
+	TimedOut:   "#f8b4b4",
+	Paused:     "#fbe3b0",
+	Cancelled:  "#fbe3b0",
+	Skipped:    "#f1f2f4",
+}
+
+var mermaidIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// GraphNode is a task of an orchestration's plan, with its latest status
+type GraphNode struct {
+	ID          string `json:"id"`
+	Type        string `json:"type,omitempty"`
+	Service     string `json:"service,omitempty"`
+	ServiceName string `json:"serviceName,omitempty"`
+	Status      Status `json:"status"`
+}
+
+// GraphEdge is a task, To, waiting on another, From
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// OrchestrationGraph is an orchestration's planned task graph
+type OrchestrationGraph struct {
+	OrchestrationID string      `json:"orchestrationId"`
+	Status          Status      `json:"status"`
+	Nodes           []GraphNode `json:"nodes"`
+	Edges           []GraphEdge `json:"edges"`
+}
+
+// OrchestrationGraph returns the orchestration's planned tasks and their dependencies, with each task's
+// latest status from the orchestration's log. The action params, task zero, aren't part of the graph.
+func (p *PlanEngine) OrchestrationGraph(orchestrationID string) (*OrchestrationGraph, error) {
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		p.orchestrationStoreMu.RUnlock()
+		return nil, errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID)
+	}
+	status := orchestration.Status
+	var tasks []*SubTask
+	if orchestration.Plan != nil {
+		tasks = slices.Clone(orchestration.Plan.Tasks)
+	}
+	p.orchestrationStoreMu.RUnlock()
+
+	if len(tasks) == 0 {
+		return nil, errs.E(errs.InvalidRequest, fmt.Sprintf("orchestration %s has no plan, it's %s", orchestrationID, status))
+	}
+
+	latest := map[string]Status{}
+	if p.LogManager != nil {
+		if log := p.LogManager.GetLog(orchestrationID); log != nil {
+			_, statuses, _ := p.processLogEntries(log)
+			for taskID, history := range statuses {
+				if len(history) > 0 {
+					latest[taskID] = history[len(history)-1].Status
+				}
+			}
+		}
+	}
+
+	graph := &OrchestrationGraph{OrchestrationID: orchestrationID, Status: status, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, task := range tasks {
+		if task.ID == TaskZero {
+			continue
+		}
+		node := GraphNode{ID: task.ID, Type: task.Type, Service: task.Service, ServiceName: task.ServiceName, Status: Pending}
+		if taskStatus, ok := latest[task.ID]; ok {
+			node.Status = taskStatus
+		}
+		if node.ServiceName == "" && node.Service != "" {
+			if service, err := p.GetServiceByID(node.Service); err == nil {
+				node.ServiceName = service.Name
+			}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+
+		var dependencies []string
+		for dep := range task.extractDependencies() {
+			if dep != TaskZero {
+				dependencies = append(dependencies, dep)
+			}
+		}
+		sort.Strings(dependencies)
+		for _, dep := range dependencies {
+			graph.Edges = append(graph.Edges, GraphEdge{From: dep, To: task.ID})
+		}
+	}
+	return graph, nil
+}
+
+func graphNodeLabel(node GraphNode) []string {
+	label := []string{node.ID}
+	switch {
+	case node.ServiceName != "":
+		label = append(label, node.ServiceName)
+	case node.Type != "":
+		label = append(label, node.Type)
+	}
+	return append(label, node.Status.String())
+}
+
+func graphStatusColor(status Status) string {
+	if color, ok := graphStatusColors[status]; ok {
+		return color
+	}
+	return graphStatusColors[Pending]
+}
+
+func mermaidID(taskID string) string {
+	return "t_" + mermaidIDUnsafe.ReplaceAllString(taskID, "_")
+}
+
+func mermaidText(text string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(text)
+}
+
+// RenderMermaid renders the graph as a Mermaid flowchart, its nodes styled by their status
+func (g *OrchestrationGraph) RenderMermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	var classes []Status
+	for _, node := range g.Nodes {
+		label := graphNodeLabel(node)
+		for i := range label {
+			label[i] = mermaidText(label[i])
+		}
+		fmt.Fprintf(&b, "    %s[\"%s\"]:::%s\n", mermaidID(node.ID), strings.Join(label, "<br/>"), node.Status)
+		if !slices.Contains(classes, node.Status) {
+			classes = append(classes, node.Status)
+		}
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "    %s --> %s\n", mermaidID(edge.From), mermaidID(edge.To))
+	}
+	for _, status := range classes {
+		fmt.Fprintf(&b, "    classDef %s fill:%s,stroke:#6b7385\n", status, graphStatusColor(status))
+	}
+	return b.String()
+}
+
+func dotText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text)
+}
+
+// RenderDOT renders the graph in the Graphviz DOT language, its nodes filled by their status
+func (g *OrchestrationGraph) RenderDOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph \"%s\" {\n", dotText(g.OrchestrationID))
+	b.WriteString("    rankdir=TB;\n")
+	b.WriteString("    node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+
+	for _, node := range g.Nodes {
+		label := graphNodeLabel(node)
+		for i := range label {
+			label[i] = dotText(label[i])
+		}
+		fmt.Fprintf(&b, "    \"%s\" [label=\"%s\", fillcolor=\"%s\"];\n", dotText(node.ID), strings.Join(label, `\n`), graphStatusColor(node.Status))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "    \"%s\" -> \"%s\";\n", dotText(edge.From), dotText(edge.To))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// OrchestrationGraphHandler returns the planned task graph of one of the project's orchestrations, as a Mermaid
+// flowchart by default. ?format=dot returns Graphviz DOT, and ?format=json the graph's nodes and edges.
+func (app *App) OrchestrationGraphHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = GraphFormatMermaid
+	}
+	if format != GraphFormatMermaid && format != GraphFormatDOT && format != GraphFormatJSON {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("format"), "format must be one of mermaid, dot or json"))
+		return
+	}
+
+	orchestrationID := mux.Vars(r)["id"]
+	if !app.Engine.OrchestrationBelongsToProject(orchestrationID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
+		return
+	}
+
+	graph, err := app.Engine.OrchestrationGraph(orchestrationID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	switch format {
+	case GraphFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(graph); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		}
+	case GraphFormatDOT:
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(graph.RenderDOT()))
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(graph.RenderMermaid()))
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrchestrationGraph(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	orchestration := &Orchestration{
+		ID:        "o_graph",
+		ProjectID: project.ID,
+		Status:    Processing,
+		Plan: &ExecutionPlan{Tasks: []*SubTask{
+			{ID: TaskZero, Input: map[string]any{"orderId": "o-1"}},
+			{ID: "task1", Service: "s_orders", ServiceName: "Orders", Input: map[string]any{"orderId": "$task0.orderId"}},
+			{ID: "task2", Service: "s_payments", ServiceName: `Payments "EU"`, Input: map[string]any{"total": "$task1.total"}},
+			{ID: "task3", Service: "s_shipping", ServiceName: "Shipping", Input: map[string]any{"address": "$task1.address"}, DependsOn: []string{"task2"}},
+		}},
+	}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+	logManager.PrepLogForOrchestration(project.ID, orchestration.ID, orchestration.Plan)
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_orders", Completed, nil, time.Now().UTC(), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task2", "s_payments", Processing, nil, time.Now().UTC(), 0))
+
+	getGraph := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/o_graph/graph"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("returns the planned tasks with their latest status", func(t *testing.T) {
+		rr := getGraph("?format=json")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var graph OrchestrationGraph
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&graph))
+		require.Len(t, graph.Nodes, 3, "task zero isn't part of the graph")
+		assert.Equal(t, Completed, graph.Nodes[0].Status)
+		assert.Equal(t, Processing, graph.Nodes[1].Status)
+		assert.Equal(t, Pending, graph.Nodes[2].Status)
+		assert.Equal(t, []GraphEdge{
+			{From: "task1", To: "task2"},
+			{From: "task1", To: "task3"},
+			{From: "task2", To: "task3"},
+		}, graph.Edges)
+	})
+
+	t.Run("renders mermaid by default", func(t *testing.T) {
+		rr := getGraph("")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `flowchart TD
+    t_task1["task1<br/>Orders<br/>completed"]:::completed
+    t_task2["task2<br/>Payments #quot;EU#quot;<br/>processing"]:::processing
+    t_task3["task3<br/>Shipping<br/>pending"]:::pending
+    t_task1 --> t_task2
+    t_task1 --> t_task3
+    t_task2 --> t_task3
+    classDef completed fill:#b7e4c7,stroke:#6b7385
+    classDef processing fill:#bfd0f8,stroke:#6b7385
+    classDef pending fill:#e2e5eb,stroke:#6b7385
+`, rr.Body.String())
+	})
+
+	t.Run("renders graphviz", func(t *testing.T) {
+		rr := getGraph("?format=dot")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/vnd.graphviz; charset=utf-8", rr.Header().Get("Content-Type"))
+		body := rr.Body.String()
+		assert.Contains(t, body, `digraph "o_graph" {`)
+		assert.Contains(t, body, `"task2" [label="task2\nPayments \"EU\"\nprocessing", fillcolor="#bfd0f8"];`)
+		assert.Contains(t, body, `"task2" -> "task3";`)
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, getGraph("?format=svg").Code)
+	})
+
+	t.Run("orchestrations without a plan have no graph", func(t *testing.T) {
+		app.Engine.orchestrationStore["o_queued"] = &Orchestration{ID: "o_queued", ProjectID: project.ID, Status: Queued}
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/o_queued/graph", nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
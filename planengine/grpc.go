@@ -0,0 +1,321 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/orra-dev/orra/planengine/proto/orrav1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	GRPCServiceIDMetadata   = "x-orra-service-id"
+	GRPCResumeTokenMetadata = "x-orra-resume-token"
+	GRPCInstanceIDMetadata  = "x-orra-instance-id"
+	grpcSessionBufferSize   = 256
+)
+
+var ErrGRPCSessionClosed = errors.New("grpc session is closed")
+
+// GRPCTransport connects services over gRPC bidirectional streams, for services that can't use the WebSocket.
+// Streams are bridged onto the WebSocketManager, so both transports share task delivery, heartbeats and resumption.
+type GRPCTransport struct {
+	orrav1.UnimplementedServiceTransportServer
+	app *App
+}
+
+// NewGRPCServer serves the gRPC service transport, over TLS when the plan engine is configured for it
+func (app *App) NewGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	orrav1.RegisterServiceTransportServer(server, &GRPCTransport{app: app})
+	return server
+}
+
+// Connect authenticates a service's stream like a WebSocket upgrade, then relays messages until either side closes it
+func (t *GRPCTransport) Connect(stream orrav1.ServiceTransport_ConnectServer) error {
+	r, serviceID, instanceID, resumeToken := grpcConnectRequest(stream.Context())
+
+	project, err := t.app.authorizeServiceConnection(r, serviceID)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	serviceName, err := t.app.Engine.GetServiceName(project.ID, serviceID)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	wsm := t.app.Engine.WebSocketManager
+	session := newGRPCSession(stream)
+	session.Set("projectID", project.ID)
+	session.Set(WSInstanceQueryParam, instanceID)
+	session.Set(WSResumeQueryParam, resumeToken)
+
+	wsm.HandleConnection(serviceID, serviceName, session)
+	defer wsm.HandleDisconnection(serviceID, session)
+	defer session.Close()
+
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- session.sendMessages() }()
+
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			data, err := serviceMessageJSON(msg)
+			if err != nil {
+				t.app.Logger.Warn().Err(err).Str("ServiceID", serviceID).Msg("Dropped invalid gRPC service message")
+				continue
+			}
+			wsm.HandleMessage(session, data, t.app.Engine.GetServiceByID)
+		}
+	}()
+
+	select {
+	case err := <-recvErr:
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	case err := <-sendErr:
+		return err
+	case <-session.done:
+		return status.Error(codes.Unavailable, "connection closed by the plan engine")
+	}
+}
+
+// grpcConnectRequest describes a stream as the HTTP request of a WebSocket upgrade, so both transports
+// authenticate and authorize services the same way.
+func grpcConnectRequest(ctx context.Context) (r *http.Request, serviceID, instanceID, resumeToken string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r = &http.Request{Header: http.Header{}, URL: &url.URL{}}
+	for _, key := range []string{"authorization", "x-forwarded-for"} {
+		for _, value := range md.Get(key) {
+			r.Header.Add(key, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r,
+		firstMetadataValue(md, GRPCServiceIDMetadata),
+		firstMetadataValue(md, GRPCInstanceIDMetadata),
+		firstMetadataValue(md, GRPCResumeTokenMetadata)
+}
+
+func firstMetadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcSession adapts a service's stream to a serviceSession. Messages are queued and sent from one goroutine,
+// as gRPC streams don't support concurrent sends.
+type grpcSession struct {
+	stream    orrav1.ServiceTransport_ConnectServer
+	outbound  chan *orrav1.EngineMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	keys      map[string]any
+	keysMu    sync.RWMutex
+}
+
+func newGRPCSession(stream orrav1.ServiceTransport_ConnectServer) *grpcSession {
+	return &grpcSession{
+		stream:   stream,
+		outbound: make(chan *orrav1.EngineMessage, grpcSessionBufferSize),
+		done:     make(chan struct{}),
+		keys:     make(map[string]any),
+	}
+}
+
+func (s *grpcSession) Write(message []byte) error {
+	msg, err := engineMessage(message)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.done:
+		return ErrGRPCSessionClosed
+	default:
+	}
+	select {
+	case s.outbound <- msg:
+		return nil
+	default:
+		return fmt.Errorf("grpc session message buffer is full")
+	}
+}
+
+func (s *grpcSession) queued() int {
+	return len(s.outbound)
+}
+
+func (s *grpcSession) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *grpcSession) Get(key string) (any, bool) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+func (s *grpcSession) Set(key string, value any) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.keys[key] = value
+}
+
+func (s *grpcSession) sendMessages() error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case msg := <-s.outbound:
+			if err := s.stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// engineMessage converts a JSON message for a service's WebSocket to its protobuf equivalent. The protobuf
+// messages share the JSON's field names, so the JSON is decoded straight into them, dropping envelope fields
+// they don't carry.
+func engineMessage(message []byte) (*orrav1.EngineMessage, error) {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to read message type: %w", err)
+	}
+
+	msg := &orrav1.EngineMessage{}
+	var target proto.Message
+	switch envelope.Type {
+	case WSPing:
+		m := &orrav1.Ping{}
+		msg.Message, target = &orrav1.EngineMessage_Ping{Ping: m}, m
+	case WSHealthProbe:
+		m := &orrav1.HealthProbe{}
+		msg.Message, target = &orrav1.EngineMessage_HealthProbe{HealthProbe: m}, m
+	case "ACK":
+		m := &orrav1.Ack{}
+		msg.Message, target = &orrav1.EngineMessage_Ack{Ack: m}, m
+	case WSResumeToken:
+		m := &orrav1.ResumeToken{}
+		msg.Message, target = &orrav1.EngineMessage_ResumeToken{ResumeToken: m}, m
+	case "task_request", "compensation_request":
+		m := &orrav1.TaskRequest{}
+		msg.Message, target = &orrav1.EngineMessage_Task{Task: m}, m
+	case "task_cancellation":
+		m := &orrav1.TaskCancellation{}
+		msg.Message, target = &orrav1.EngineMessage_Cancellation{Cancellation: m}, m
+	default:
+		return nil, fmt.Errorf("unsupported message type %q", envelope.Type)
+	}
+
+	if err := engineMessageUnmarshaler.Unmarshal(message, target); err != nil {
+		return nil, fmt.Errorf("failed to convert %s message: %w", envelope.Type, err)
+	}
+	return msg, nil
+}
+
+var engineMessageUnmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// serviceMessageJSON converts a service's protobuf message to the JSON it would have sent over the WebSocket
+func serviceMessageJSON(msg *orrav1.ServiceMessage) ([]byte, error) {
+	id := msg.GetId()
+	var payload TaskResult
+	var report *orrav1.TaskReport
+
+	switch m := msg.GetMessage().(type) {
+	case *orrav1.ServiceMessage_Pong:
+		id = WSPong
+		payload = TaskResult{Type: WSPong, ServiceID: m.Pong.GetServiceId()}
+	case *orrav1.ServiceMessage_TaskAck:
+		payload.Type, report = WSTaskAck, m.TaskAck
+	case *orrav1.ServiceMessage_TaskStatus:
+		payload.Type, report = "task_status", m.TaskStatus
+	case *orrav1.ServiceMessage_TaskInterimResult:
+		payload.Type, report = "task_interim_result", m.TaskInterimResult
+	case *orrav1.ServiceMessage_TaskResult:
+		payload.Type, report = "task_result", m.TaskResult
+	case *orrav1.ServiceMessage_TaskHeartbeat:
+		payload.Type, report = WSTaskHeartbeat, m.TaskHeartbeat
+	case *orrav1.ServiceMessage_HealthProbeResult:
+		payload = TaskResult{Type: WSHealthProbeResult, ServiceID: m.HealthProbeResult.GetServiceId(), ProbeID: m.HealthProbeResult.GetProbeId()}
+	default:
+		return nil, fmt.Errorf("empty service message %q", id)
+	}
+
+	if report != nil {
+		result, err := valueJSON(report.GetResult())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert task result: %w", err)
+		}
+		details, err := valueJSON(report.GetErrorDetails())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert task error details: %w", err)
+		}
+		payload.TaskID = report.GetTaskId()
+		payload.ExecutionID = report.GetExecutionId()
+		payload.ServiceID = report.GetServiceId()
+		payload.IdempotencyKey = IdempotencyKey(report.GetIdempotencyKey())
+		payload.Result = result
+		payload.Error = report.GetError()
+		payload.ErrorCode = report.GetErrorCode()
+		payload.ErrorDetails = details
+		payload.Retryable = report.Retryable
+		payload.Status = report.GetStatus()
+		payload.DeliveryID = report.GetDeliveryId()
+	}
+
+	return json.Marshal(struct {
+		ID      string     `json:"id"`
+		Payload TaskResult `json:"payload"`
+	}{ID: id, Payload: payload})
+}
+
+func valueJSON(value *structpb.Value) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return protojson.Marshal(value)
+}
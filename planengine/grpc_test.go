@@ -0,0 +1,121 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/orra-dev/orra/planengine/proto/orrav1"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGRPCTransport(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.Engine.WebSocketManager = NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+	listener := bufconn.Listen(1 << 20)
+	server := app.NewGRPCServer(nil)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := orrav1.NewServiceTransportClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("rejects unauthenticated services", func(t *testing.T) {
+		stream, err := client.Connect(metadata.AppendToOutgoingContext(ctx, GRPCServiceIDMetadata, service.ID, "authorization", "Bearer wrong-key"))
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	stream, err := client.Connect(metadata.AppendToOutgoingContext(ctx, GRPCServiceIDMetadata, service.ID, "authorization", "Bearer project-api-key"))
+	require.NoError(t, err)
+
+	recv := func() *orrav1.EngineMessage {
+		t.Helper()
+		for {
+			msg, err := stream.Recv()
+			require.NoError(t, err)
+			if msg.GetPing() == nil {
+				return msg
+			}
+		}
+	}
+
+	require.NotEmpty(t, recv().GetResumeToken().GetToken())
+	require.Eventually(t, func() bool { return app.Engine.WebSocketManager.IsServiceHealthy(service.ID) }, time.Second, 5*time.Millisecond)
+
+	_, _, err = service.IdempotencyStore.InitializeOrGetExecution("key-1", "e_1")
+	require.NoError(t, err)
+	task := &Task{
+		Type:            "task_request",
+		ID:              "task1",
+		ExecutionID:     "e_1",
+		IdempotencyKey:  "key-1",
+		Input:           json.RawMessage(`{"message":"hello"}`),
+		TraceParent:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		TraceState:      "orra=1",
+		OrchestrationID: "o_1",
+	}
+	require.NoError(t, app.Engine.WebSocketManager.SendTask(service.ID, task))
+
+	request := recv().GetTask()
+	require.NotNil(t, request)
+	assert.Equal(t, "task1", request.GetId())
+	assert.Equal(t, task.DeliveryID, request.GetDeliveryId())
+	assert.Equal(t, "hello", request.GetInput().GetStructValue().GetFields()["message"].GetStringValue())
+	assert.Equal(t, task.TraceParent, request.GetTraceparent())
+	assert.Equal(t, task.TraceState, request.GetTracestate())
+	assert.Equal(t, task.OrchestrationID, request.GetOrchestrationId())
+
+	result, err := structpb.NewValue(map[string]any{"echo": "hello"})
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&orrav1.ServiceMessage{Id: "m_1", Message: &orrav1.ServiceMessage_TaskResult{TaskResult: &orrav1.TaskReport{
+		TaskId:         "task1",
+		ExecutionId:    "e_1",
+		ServiceId:      service.ID,
+		IdempotencyKey: "key-1",
+		Result:         result,
+	}}}))
+	assert.Equal(t, "m_1", recv().GetAck().GetId())
+
+	execution, _ := service.IdempotencyStore.GetExecutionWithResult("key-1")
+	assert.Equal(t, ExecutionCompleted, execution.State)
+	assert.JSONEq(t, `{"echo":"hello"}`, string(execution.Result))
+
+	app.Engine.WebSocketManager.deliveryMu.Lock()
+	assert.Empty(t, app.Engine.WebSocketManager.deliveries, "results acknowledge their task's delivery")
+	app.Engine.WebSocketManager.deliveryMu.Unlock()
+
+	require.NoError(t, stream.CloseSend())
+	require.Eventually(t, func() bool { return !app.Engine.WebSocketManager.IsServiceHealthy(service.ID) }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,188 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	healthCheckTimeout = 5 * time.Second
+	// llmPingTTL spaces out checking the LLM provider, so frequent probes don't turn into a stream of API calls
+	llmPingTTL = 30 * time.Second
+)
+
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusFailed       = "failed"
+	HealthStatusReady        = "ready"
+	HealthStatusNotReady     = "not_ready"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+// Pinger is a dependency the plan engine checks before it's considered healthy or ready
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthCheck is the outcome of checking a single dependency
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport is the outcome of a liveness or readiness probe
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// Ping checks the storage is open and can be read from
+func (b *BadgerDB) Ping(_ context.Context) error {
+	if b == nil {
+		return fmt.Errorf("storage is not initialised")
+	}
+	if b.db.IsClosed() {
+		return fmt.Errorf("storage is closed")
+	}
+	return b.db.View(func(*badger.Txn) error { return nil })
+}
+
+// Ping checks the WebSocket manager is still accepting service connections
+func (wsm *WebSocketManager) Ping(_ context.Context) error {
+	if wsm == nil || wsm.melody == nil {
+		return fmt.Errorf("websocket manager is not initialised")
+	}
+	if wsm.melody.IsClosed() {
+		return fmt.Errorf("websocket manager is closed")
+	}
+	return nil
+}
+
+// llmPing remembers the last time the LLM provider was checked, and its outcome
+type llmPing struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// Ping checks the reasoning provider is reachable by listing its models. The outcome is reused for llmPingTTL.
+func (l *LLMClient) Ping(ctx context.Context) error {
+	if l == nil {
+		return fmt.Errorf("LLM provider is not initialised")
+	}
+	l.ping.mu.Lock()
+	defer l.ping.mu.Unlock()
+
+	if !l.ping.checkedAt.IsZero() && time.Since(l.ping.checkedAt) < llmPingTTL {
+		return l.ping.err
+	}
+
+	_, err := l.reasoningClient.ListModels(ctx)
+	if err != nil {
+		err = fmt.Errorf("LLM provider is unreachable: %w", err)
+	}
+	l.ping.checkedAt, l.ping.err = time.Now(), err
+	return err
+}
+
+// livenessChecks are the plan engine's own dependencies, a restart may recover them
+func (app *App) livenessChecks() map[string]Pinger {
+	return map[string]Pinger{
+		"storage":   app.Db,
+		"websocket": app.Engine.WebSocketManager,
+	}
+}
+
+// readinessChecks add the external dependencies needed to serve orchestrations to the liveness checks
+func (app *App) readinessChecks() map[string]Pinger {
+	checks := app.livenessChecks()
+	checks["llm"] = app.LLM
+	return checks
+}
+
+// runHealthChecks runs the checks concurrently, reporting whether they all passed
+func runHealthChecks(ctx context.Context, checks map[string]Pinger) (map[string]HealthCheck, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]HealthCheck, len(checks))
+	healthy := true
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Pinger) {
+			defer wg.Done()
+			result := HealthCheck{Status: HealthStatusOK}
+			if err := pingDependency(ctx, check); err != nil {
+				result = HealthCheck{Status: HealthStatusFailed, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			healthy = healthy && result.Status == HealthStatusOK
+		}(name, check)
+	}
+	wg.Wait()
+	return results, healthy
+}
+
+func pingDependency(ctx context.Context, check Pinger) error {
+	if check == nil {
+		return fmt.Errorf("not configured")
+	}
+	return check.Ping(ctx)
+}
+
+// LivenessHandler reports whether the plan engine is alive, failing when its storage or WebSocket manager are
+// broken so it's restarted. External dependencies are left to the readiness probe.
+func (app *App) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := runHealthChecks(r.Context(), app.livenessChecks())
+	report := HealthReport{Status: HealthStatusOK, Checks: checks}
+	if !healthy {
+		report.Status = HealthStatusFailed
+	}
+	app.writeHealthReport(w, report, healthy)
+}
+
+// ReadinessHandler reports whether the plan engine can serve traffic. It stops being ready as soon as it starts
+// shutting down, or while its storage, LLM provider or WebSocket manager are unavailable.
+func (app *App) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if app.RootCtx != nil && app.RootCtx.Err() != nil {
+		app.writeHealthReport(w, HealthReport{Status: HealthStatusShuttingDown}, false)
+		return
+	}
+
+	checks, ready := runHealthChecks(r.Context(), app.readinessChecks())
+	report := HealthReport{Status: HealthStatusReady, Checks: checks}
+	if !ready {
+		report.Status = HealthStatusNotReady
+	}
+	app.writeHealthReport(w, report, ready)
+}
+
+func (app *App) writeHealthReport(w http.ResponseWriter, report HealthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.Logger.Error().Err(err).Msg("Failed to write health report")
+	}
+}
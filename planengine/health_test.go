@@ -0,0 +1,112 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (f *fakePinger) Ping(context.Context) error {
+	return f.err
+}
+
+func probe(t *testing.T, app *App, path string) (int, HealthReport) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	var report HealthReport
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+	return rr.Code, report
+}
+
+func TestHealthProbes(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	llm := &fakePinger{}
+	app.LLM = llm
+	app.Engine.WebSocketManager = NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	// The WebSocket manager opens once its hub is running
+	require.Eventually(t, func() bool { return !app.Engine.WebSocketManager.melody.IsClosed() }, time.Second, 10*time.Millisecond)
+
+	t.Run("healthy and ready", func(t *testing.T) {
+		code, report := probe(t, app, "/healthz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, HealthStatusOK, report.Status)
+		assert.Len(t, report.Checks, 2)
+
+		code, report = probe(t, app, "/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, HealthStatusReady, report.Status)
+		assert.Equal(t, map[string]HealthCheck{
+			"storage":   {Status: HealthStatusOK},
+			"websocket": {Status: HealthStatusOK},
+			"llm":       {Status: HealthStatusOK},
+		}, report.Checks)
+	})
+
+	t.Run("an unreachable LLM provider only fails readiness", func(t *testing.T) {
+		llm.err = fmt.Errorf("LLM provider is unreachable: connection refused")
+		defer func() { llm.err = nil }()
+
+		code, _ := probe(t, app, "/healthz")
+		assert.Equal(t, http.StatusOK, code)
+
+		code, report := probe(t, app, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, HealthStatusNotReady, report.Status)
+		assert.Equal(t, HealthStatusFailed, report.Checks["llm"].Status)
+		assert.Contains(t, report.Checks["llm"].Error, "connection refused")
+		assert.Equal(t, HealthStatusOK, report.Checks["storage"].Status)
+	})
+
+	t.Run("shutting down stops readiness", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		app.RootCtx = ctx
+		defer func() { app.RootCtx = nil }()
+		cancel()
+
+		code, report := probe(t, app, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, HealthStatusShuttingDown, report.Status)
+	})
+
+	t.Run("a closed websocket manager fails liveness", func(t *testing.T) {
+		require.NoError(t, app.Engine.WebSocketManager.melody.Close())
+		require.Eventually(t, app.Engine.WebSocketManager.melody.IsClosed, time.Second, 10*time.Millisecond)
+
+		code, report := probe(t, app, "/healthz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, HealthStatusFailed, report.Status)
+		assert.Equal(t, HealthCheck{Status: HealthStatusFailed, Error: "websocket manager is closed"}, report.Checks["websocket"])
+	})
+
+	t.Run("missing storage fails liveness", func(t *testing.T) {
+		assert.NoError(t, app.Db.Ping(context.Background()))
+		app.Db = nil
+
+		code, report := probe(t, app, "/healthz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "storage is not initialised", report.Checks["storage"].Error)
+	})
+}
@@ -143,6 +143,36 @@ func (s *IdempotencyStore) PauseExecution(key IdempotencyKey) {
 	}
 }
 
+// PauseInProgressExecutions pauses every execution still in progress, returning how many were paused
+func (s *IdempotencyStore) PauseInProgressExecutions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paused := 0
+	for _, execution := range s.executions {
+		if execution.State == ExecutionInProgress {
+			execution.State = ExecutionPaused
+			execution.LeaseExpiry = time.Time{}
+			paused++
+		}
+	}
+	return paused
+}
+
+// InProgressExecutions counts the executions still in progress
+func (s *IdempotencyStore) InProgressExecutions() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inProgress := 0
+	for _, execution := range s.executions {
+		if execution.State == ExecutionInProgress {
+			inProgress++
+		}
+	}
+	return inProgress
+}
+
 func (s *IdempotencyStore) ResumeExecution(key IdempotencyKey) (*Execution, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,145 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"slices"
+
+	"github.com/olahol/melody"
+)
+
+// WSInstanceQueryParam identifies which of a service's instances a connection belongs to
+const WSInstanceQueryParam = "instanceId"
+
+// serviceInstances are the live sessions of a service, one per instance. Tasks are dispatched across instances
+// round-robin. Services running a single instance connect without an instance ID, so their reconnections
+// replace their previous session.
+type serviceInstances struct {
+	sessions map[string]serviceSession
+	ids      []string
+	next     int
+}
+
+// addInstance registers the session of a service instance, replacing the instance's previous session if it reconnected
+func (wsm *WebSocketManager) addInstance(serviceID string, s serviceSession) {
+	instanceID := sessionInstanceID(s)
+
+	wsm.connMu.Lock()
+	defer wsm.connMu.Unlock()
+
+	instances, ok := wsm.connMap[serviceID]
+	if !ok {
+		instances = &serviceInstances{sessions: make(map[string]serviceSession)}
+		wsm.connMap[serviceID] = instances
+	}
+	if _, reconnected := instances.sessions[instanceID]; !reconnected {
+		instances.ids = append(instances.ids, instanceID)
+	}
+	instances.sessions[instanceID] = s
+}
+
+// removeInstance unregisters a service instance's session, unless the instance has since reconnected.
+// It returns whether the session was removed and how many of the service's instances remain connected.
+func (wsm *WebSocketManager) removeInstance(serviceID string, s serviceSession) (removed bool, remaining int) {
+	instanceID := sessionInstanceID(s)
+
+	wsm.connMu.Lock()
+	defer wsm.connMu.Unlock()
+
+	instances, ok := wsm.connMap[serviceID]
+	if !ok {
+		return false, 0
+	}
+	if instances.sessions[instanceID] == s {
+		delete(instances.sessions, instanceID)
+		instances.ids = slices.DeleteFunc(instances.ids, func(id string) bool { return id == instanceID })
+		removed = true
+	}
+	if len(instances.sessions) == 0 {
+		delete(wsm.connMap, serviceID)
+	}
+	return removed, len(instances.sessions)
+}
+
+// isCurrentSession reports whether the session is still its service instance's connection
+func (wsm *WebSocketManager) isCurrentSession(serviceID string, s serviceSession) bool {
+	wsm.connMu.RLock()
+	defer wsm.connMu.RUnlock()
+
+	instances, ok := wsm.connMap[serviceID]
+	return ok && instances.sessions[sessionInstanceID(s)] == s
+}
+
+// nextInstance picks the service instance to dispatch a message to, taking turns between its instances.
+// Messages with a routing key go to the instance earlier messages with the key went to, while it's connected.
+func (wsm *WebSocketManager) nextInstance(serviceID, routingKey string) (instanceID string, s serviceSession, ok bool) {
+	wsm.connMu.Lock()
+	defer wsm.connMu.Unlock()
+
+	instances, ok := wsm.connMap[serviceID]
+	if !ok || len(instances.ids) == 0 {
+		return "", nil, false
+	}
+	pick := func() string {
+		id := instances.ids[instances.next%len(instances.ids)]
+		instances.next = (instances.next + 1) % len(instances.ids)
+		return id
+	}
+
+	if routingKey != "" {
+		instanceID = wsm.pinInstanceLocked(instances, serviceID, routingKey, pick)
+	} else {
+		instanceID = pick()
+	}
+	return instanceID, instances.sessions[instanceID], true
+}
+
+// connectionCount returns how many service instances are connected
+func (wsm *WebSocketManager) connectionCount() int {
+	wsm.connMu.RLock()
+	defer wsm.connMu.RUnlock()
+
+	count := 0
+	for _, instances := range wsm.connMap {
+		count += len(instances.sessions)
+	}
+	return count
+}
+
+// instanceSessions returns the sessions of all the service's connected instances
+func (wsm *WebSocketManager) instanceSessions(serviceID string) []serviceSession {
+	wsm.connMu.RLock()
+	defer wsm.connMu.RUnlock()
+
+	instances, ok := wsm.connMap[serviceID]
+	if !ok {
+		return nil
+	}
+	sessions := make([]serviceSession, 0, len(instances.ids))
+	for _, id := range instances.ids {
+		sessions = append(sessions, instances.sessions[id])
+	}
+	return sessions
+}
+
+// sessionInstanceID returns the instance ID a service connected with, if any. WebSocket connections
+// pass it as a query param, other transports set it on the session before connecting.
+func sessionInstanceID(s serviceSession) string {
+	if ws, ok := s.(*melody.Session); ok && ws.Request != nil {
+		return ws.Request.URL.Query().Get(WSInstanceQueryParam)
+	}
+	id, _ := s.Get(WSInstanceQueryParam)
+	instanceID, _ := id.(string)
+	return instanceID
+}
+
+// sessionServiceID returns the service the session was connected for, which is who its messages are from
+func sessionServiceID(s serviceSession) string {
+	id, _ := s.Get("serviceID")
+	serviceID, _ := id.(string)
+	return serviceID
+}
@@ -0,0 +1,190 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+var ErrIPNotAllowed = errors.New("client IP address is not allowed for this project")
+
+// ProjectSecurity holds a project's network access restrictions
+type ProjectSecurity struct {
+	// AllowedCIDRs restricts which networks may use the project's credentials, empty allows all
+	AllowedCIDRs []string `json:"allowedCidrs"`
+	// RequireRegistrationTokens only lets services register with a single use registration token
+	RequireRegistrationTokens bool `json:"requireRegistrationTokens,omitempty"`
+}
+
+// Validate ensures every allowlist entry is a valid CIDR range or IP address
+func (s ProjectSecurity) Validate() error {
+	for _, entry := range s.AllowedCIDRs {
+		if _, err := parseAllowlistEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProjectSecurityUpdate changes a project's security settings, settings left out are kept as they are so editing
+// the allowlist never loosens the registration rules
+type ProjectSecurityUpdate struct {
+	AllowedCIDRs              *[]string `json:"allowedCidrs,omitempty"`
+	RequireRegistrationTokens *bool     `json:"requireRegistrationTokens,omitempty"`
+}
+
+// Validate ensures every allowlist entry sent is a valid CIDR range or IP address
+func (u ProjectSecurityUpdate) Validate() error {
+	if u.AllowedCIDRs == nil {
+		return nil
+	}
+	return ProjectSecurity{AllowedCIDRs: *u.AllowedCIDRs}.Validate()
+}
+
+// apply returns the security settings with the update's changes
+func (u ProjectSecurityUpdate) apply(security ProjectSecurity) ProjectSecurity {
+	if u.AllowedCIDRs != nil {
+		security.AllowedCIDRs = slices.Clone(*u.AllowedCIDRs)
+	}
+	if u.RequireRegistrationTokens != nil {
+		security.RequireRegistrationTokens = *u.RequireRegistrationTokens
+	}
+	if security.AllowedCIDRs == nil {
+		security.AllowedCIDRs = make([]string, 0)
+	}
+	return security
+}
+
+// Allows reports whether the address falls inside the project's allowlist
+func (s ProjectSecurity) Allows(addr netip.Addr) bool {
+	if len(s.AllowedCIDRs) == 0 {
+		return true
+	}
+	for _, entry := range s.AllowedCIDRs {
+		prefix, err := parseAllowlistEntry(entry)
+		if err != nil {
+			continue
+		}
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAllowlistEntry(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR range %q: %w", entry, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q: %w", entry, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// clientAddr returns the caller's address, honouring X-Forwarded-For only when the peer is a trusted proxy
+func (app *App) clientAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address %q", r.RemoteAddr)
+	}
+	peer = peer.Unmap()
+
+	trusted := ProjectSecurity{AllowedCIDRs: app.Cfg.TrustedProxies}
+	if len(app.Cfg.TrustedProxies) == 0 || !trusted.Allows(peer) {
+		return peer, nil
+	}
+
+	// Walk the chain from the closest hop, skipping our own proxies
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = addr.Unmap()
+		if !trusted.Allows(addr) {
+			return addr, nil
+		}
+		peer = addr
+	}
+	return peer, nil
+}
+
+// enforceIPAllowlist rejects requests from outside the project's allowed networks
+func (app *App) enforceIPAllowlist(r *http.Request, project *Project) error {
+	if len(project.Security.AllowedCIDRs) == 0 {
+		return nil
+	}
+	addr, err := app.clientAddr(r)
+	if err != nil {
+		return err
+	}
+	if !project.Security.Allows(addr) {
+		return ErrIPNotAllowed
+	}
+	return nil
+}
+
+// UpdateProjectSecurity changes a project's network access restrictions and registration rules
+func (app *App) UpdateProjectSecurity(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProjectFor(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	var update ProjectSecurityUpdate
+	if err := decodeRequest(w, r, &update, projectSecurityFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if err := update.Validate(); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("allowedCidrs"), err))
+		return
+	}
+
+	// Refuse changes that would immediately lock the caller out
+	if addr, err := app.clientAddr(r); err == nil && !update.apply(project.Security).Allows(addr) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("allowedCidrs"), fmt.Sprintf("allowlist must include the caller's address %s", addr)))
+		return
+	}
+
+	security, err := app.Engine.UpdateProjectSecurity(project.ID, update)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectSecurityUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(security); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
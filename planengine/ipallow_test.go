@@ -0,0 +1,100 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectSecurity_Allows(t *testing.T) {
+	security := ProjectSecurity{AllowedCIDRs: []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"}}
+	require.NoError(t, security.Validate())
+
+	assert.True(t, security.Allows(netip.MustParseAddr("10.1.2.3")))
+	assert.True(t, security.Allows(netip.MustParseAddr("192.0.2.7")))
+	assert.True(t, security.Allows(netip.MustParseAddr("::ffff:10.1.2.3")))
+	assert.True(t, security.Allows(netip.MustParseAddr("2001:db8::1")))
+	assert.False(t, security.Allows(netip.MustParseAddr("192.0.2.8")))
+
+	assert.True(t, ProjectSecurity{}.Allows(netip.MustParseAddr("203.0.113.1")), "an empty allowlist allows everyone")
+	assert.Error(t, ProjectSecurity{AllowedCIDRs: []string{"10.0.0.0/33"}}.Validate())
+}
+
+func TestApp_ClientAddr(t *testing.T) {
+	app := &App{Cfg: Config{TrustedProxies: []string{"10.0.0.0/8"}}}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:4321"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.6")
+	addr, err := app.clientAddr(req)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.9", addr.String())
+
+	req.RemoteAddr = "198.51.100.1:4321"
+	addr, err = app.clientAddr(req)
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.1", addr.String(), "forwarded headers from untrusted peers are ignored")
+}
+
+func TestIPAllowlist(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	send := func(method, path, remoteAddr string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", project.APIKey))
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	securityPath := fmt.Sprintf("/projects/%s/security", project.ID)
+
+	w := send(http.MethodPatch, securityPath, "198.51.100.1:1234", []byte(`{"allowedCidrs":["192.0.2.0/24"]}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "callers can't lock themselves out")
+
+	w = send(http.MethodPatch, securityPath, "192.0.2.10:1234", []byte(`{"allowedCidrs":["192.0.2.0/24"]}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/groundings", "192.0.2.10:1234", nil).Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/groundings", "198.51.100.1:1234", nil).Code)
+
+	w = send(http.MethodPatch, "/projects/p_other/security", "192.0.2.10:1234", []byte(`{"allowedCidrs":[]}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	t.Run("editing the allowlist keeps the registration rules", func(t *testing.T) {
+		w := send(http.MethodPatch, securityPath, "192.0.2.10:1234", []byte(`{"requireRegistrationTokens":true}`))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = send(http.MethodPatch, securityPath, "192.0.2.10:1234", []byte(`{"allowedCidrs":["192.0.2.0/24","198.51.100.0/24"]}`))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var security ProjectSecurity
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&security))
+		assert.True(t, security.RequireRegistrationTokens)
+		assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24"}, security.AllowedCIDRs)
+
+		w = send(http.MethodPatch, "/projects", "192.0.2.10:1234", []byte(`{"security":{"allowedCidrs":["192.0.2.0/24"]}}`))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		stored, err := app.Db.LoadProject(project.ID)
+		require.NoError(t, err)
+		assert.True(t, stored.Security.RequireRegistrationTokens)
+		assert.Equal(t, []string{"192.0.2.0/24"}, stored.Security.AllowedCIDRs)
+
+		w = send(http.MethodPatch, securityPath, "192.0.2.10:1234", []byte(`{"allowedCidrs":[],"requireTokens":true}`))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "unknown fields are rejected")
+	})
+}
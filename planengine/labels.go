@@ -0,0 +1,144 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MaxOrchestrationLabels = 32
+	maxLabelValueLength    = 256
+)
+
+// Label keys can't hold ':' as filters separate keys from values with it
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+
+// validateLabels checks an orchestration's labels can be stored and filtered on
+func validateLabels(labels map[string]string) error {
+	if len(labels) > MaxOrchestrationLabels {
+		return fmt.Errorf("at most %d labels are allowed", MaxOrchestrationLabels)
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("label %q must be at most 63 letters, digits, '.', '_', '/' or '-' and start with a letter or digit", key)
+		}
+		if len(value) > maxLabelValueLength {
+			return fmt.Errorf("label %s value must be at most %d characters", key, maxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// mergeLabels returns the base labels overridden by the given ones, without changing either
+func mergeLabels(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// OrchestrationQuery filters a project's orchestrations. Every label must match and, when statuses are
+// given, orchestrations must have one of them. Queries with a limit or cursor are paginated, see OrchestrationPage.
+type OrchestrationQuery struct {
+	// Labels maps label keys to the required value, an empty value only requires the label to be set
+	Labels   map[string]string
+	Statuses []Status
+	// From and To bound when orchestrations were accepted, either may be zero
+	From time.Time
+	To   time.Time
+	// Text must appear in the orchestration's action, ignoring case
+	Text string
+	OrchestrationPage
+}
+
+func parseOrchestrationQuery(values url.Values) (OrchestrationQuery, error) {
+	var query OrchestrationQuery
+
+	for _, label := range values["label"] {
+		key, value, _ := strings.Cut(label, ":")
+		if !labelKeyPattern.MatchString(key) {
+			return OrchestrationQuery{}, fmt.Errorf("invalid label filter %q, expected key:value or key", label)
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[key] = value
+	}
+
+	for _, statuses := range values["status"] {
+		for _, name := range strings.Split(statuses, ",") {
+			var status Status
+			if err := status.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+				return OrchestrationQuery{}, fmt.Errorf("invalid status filter %q", name)
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+
+	for param, bound := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := values.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return OrchestrationQuery{}, fmt.Errorf("invalid %s filter %q, expected an RFC 3339 time", param, value)
+			}
+			*bound = parsed
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return OrchestrationQuery{}, fmt.Errorf("the to filter must not be before the from filter")
+	}
+	query.Text = strings.TrimSpace(values.Get("q"))
+
+	page, err := parseOrchestrationPage(values)
+	if err != nil {
+		return OrchestrationQuery{}, err
+	}
+	query.OrchestrationPage = page
+
+	return query, nil
+}
+
+// Matches reports whether an orchestration passes the query's filters
+func (q OrchestrationQuery) Matches(orchestration *Orchestration) bool {
+	for key, value := range q.Labels {
+		actual, ok := orchestration.Labels[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	if !q.From.IsZero() && orchestration.Timestamp.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && orchestration.Timestamp.After(q.To) {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(orchestration.Action.Content), strings.ToLower(q.Text)) {
+		return false
+	}
+	if len(q.Statuses) == 0 {
+		return true
+	}
+	for _, status := range q.Statuses {
+		if orchestration.Status == status {
+			return true
+		}
+	}
+	return false
+}
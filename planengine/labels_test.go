@@ -0,0 +1,100 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, validateLabels(map[string]string{"tenant": "acme", "team/owner": "billing"}))
+	assert.Error(t, validateLabels(map[string]string{"tenant:id": "acme"}))
+	assert.Error(t, validateLabels(map[string]string{"-tenant": "acme"}))
+	assert.Error(t, validateLabels(map[string]string{"tenant": strings.Repeat("a", maxLabelValueLength+1)}))
+
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxOrchestrationLabels; i++ {
+		tooMany[strings.Repeat("k", i+1)] = "v"
+	}
+	assert.Error(t, validateLabels(tooMany))
+}
+
+func TestParseOrchestrationQuery(t *testing.T) {
+	query, err := parseOrchestrationQuery(url.Values{
+		"label":  {"tenant:acme", "urgent"},
+		"status": {"failed,timed_out", "completed"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "acme", "urgent": ""}, query.Labels)
+	assert.Equal(t, []Status{Failed, TimedOut, Completed}, query.Statuses)
+
+	_, err = parseOrchestrationQuery(url.Values{"status": {"broken"}})
+	assert.Error(t, err)
+	_, err = parseOrchestrationQuery(url.Values{"label": {":acme"}})
+	assert.Error(t, err)
+}
+
+func TestListOrchestrationsByLabel(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	for _, o := range []*Orchestration{
+		{ID: "o_acme_failed", Status: Failed, Labels: map[string]string{"tenant": "acme", "urgent": "true"}},
+		{ID: "o_acme_done", Status: Completed, Labels: map[string]string{"tenant": "acme"}},
+		{ID: "o_globex_failed", Status: Failed, Labels: map[string]string{"tenant": "globex"}},
+		{ID: "o_unlabelled", Status: Failed},
+	} {
+		o.ProjectID = project.ID
+		app.Engine.orchestrationStore[o.ID] = o
+	}
+
+	list := func(rawQuery string) (int, OrchestrationListView) {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations?"+rawQuery, nil)
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+
+		var view OrchestrationListView
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&view))
+		}
+		return w.Code, view
+	}
+	ids := func(views []OrchestrationView) []string {
+		var out []string
+		for _, v := range views {
+			out = append(out, v.ID)
+		}
+		return out
+	}
+
+	code, view := list("label=tenant:acme&status=failed")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"o_acme_failed"}, ids(view.Failed))
+	assert.Empty(t, view.Completed)
+	assert.Equal(t, map[string]string{"tenant": "acme", "urgent": "true"}, view.Failed[0].Labels)
+
+	code, view = list("label=tenant")
+	require.Equal(t, http.StatusOK, code)
+	assert.ElementsMatch(t, []string{"o_acme_failed", "o_globex_failed"}, ids(view.Failed))
+	assert.Equal(t, []string{"o_acme_done"}, ids(view.Completed))
+
+	code, _ = list("status=unknown")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,43 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"time"
+)
+
+// WSTaskHeartbeat is the message type services use to renew the lease on a task they're executing
+const WSTaskHeartbeat = "task_heartbeat"
+
+const (
+	LeaseGranted = "granted"
+	LeaseExpired = "expired"
+)
+
+func (wsm *WebSocketManager) recordLease(pending pendingDelivery, lease TaskLease, timestamp time.Time) {
+	if lease.Event == LeaseExpired {
+		wsm.logger.Warn().
+			Str("ServiceID", pending.task.ServiceID).
+			Str("TaskID", pending.task.ID).
+			Str("InstanceID", lease.InstanceID).
+			Str("Reason", lease.Reason).
+			Msg("Task lease expired, redelivering task")
+	}
+	if wsm.onLease != nil {
+		wsm.onLease(pending.task, lease, timestamp)
+	}
+}
+
+// recordTaskLease records a change to a task's lease in its orchestration's log, for inspections to show
+func (p *PlanEngine) recordTaskLease(task Task, lease TaskLease, timestamp time.Time) {
+	if task.Type != "task_request" || p.LogManager == nil {
+		return
+	}
+	if err := p.LogManager.AppendTaskLeaseEvent(task.OrchestrationID, task.ID, task.ServiceID, lease, timestamp); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", task.OrchestrationID).Msg("Failed to record task lease")
+	}
+}
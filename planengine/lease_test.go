@@ -0,0 +1,108 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orra-dev/orra/planengine/proto/orrav1"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiredTaskLeasesAreReassigned(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.ConfigureDelivery(TaskDelivery{LeaseTTL: time.Second})
+
+	var mu sync.Mutex
+	var leases []TaskLease
+	wsm.onLease = func(_ Task, lease TaskLease, _ time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		leases = append(leases, lease)
+	}
+	recorded := func() []TaskLease {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]TaskLease(nil), leases...)
+	}
+
+	// The sessions' endpoints are never posted to, their queued messages are read directly
+	instance := func(id string) *callbackSession {
+		s := &callbackSession{wsm: wsm, serviceID: "s_echo", outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+		s.Set(WSInstanceQueryParam, id)
+		wsm.HandleConnection("s_echo", "Echo", s)
+		return s
+	}
+	received := func(s *callbackSession) Task {
+		t.Helper()
+		select {
+		case message := <-s.outbound:
+			var task Task
+			require.NoError(t, json.Unmarshal(message, &task))
+			return task
+		default:
+			t.Fatal("no task was sent to the instance")
+			return Task{}
+		}
+	}
+	report := func(s *callbackSession, messageType string, task Task) {
+		message, _ := json.Marshal(map[string]any{"id": "m_" + messageType, "payload": map[string]string{
+			"type": messageType, "serviceId": "s_echo", "taskId": task.ID, "executionId": task.ExecutionID, "deliveryId": task.DeliveryID,
+		}})
+		wsm.HandleMessage(s, message, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	}
+
+	a, b := instance("a"), instance("b")
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1", OrchestrationID: "o_1"}))
+	task := received(a)
+
+	report(a, WSTaskHeartbeat, task)
+	assert.Equal(t, []TaskLease{{Event: LeaseGranted, InstanceID: "a"}}, recorded())
+
+	wsm.redeliverOverdue(time.Now())
+	assert.Empty(t, b.outbound, "leased tasks aren't redelivered while their lease is renewed")
+
+	wsm.redeliverOverdue(time.Now().Add(2 * time.Second))
+	assert.Equal(t, TaskLease{Event: LeaseExpired, InstanceID: "a", Reason: "lease not renewed"}, recorded()[1])
+	reassigned := received(b)
+	assert.Equal(t, task.ID, reassigned.ID)
+	assert.True(t, reassigned.Redelivered)
+
+	report(b, "task_status", reassigned)
+	report(b, "task_result", reassigned)
+	wsm.deliveryMu.Lock()
+	assert.Empty(t, wsm.deliveries, "tasks are no longer leased once their result is reported")
+	wsm.deliveryMu.Unlock()
+	assert.Equal(t, TaskLease{Event: LeaseGranted, InstanceID: "b"}, recorded()[2])
+
+	t.Run("leases are revoked when their instance disconnects", func(t *testing.T) {
+		require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task2", ExecutionID: "e_2", IdempotencyKey: "key-2", OrchestrationID: "o_1"}))
+		task := received(a)
+		report(a, WSTaskAck, task)
+
+		require.NoError(t, a.Close())
+		assert.Equal(t, TaskLease{Event: LeaseExpired, InstanceID: "a", Reason: "instance disconnected"}, recorded()[4])
+		wsm.redeliverOverdue(time.Now())
+		assert.Equal(t, task.ID, received(b).ID)
+	})
+
+	t.Run("gRPC services renew leases with heartbeats", func(t *testing.T) {
+		data, err := serviceMessageJSON(&orrav1.ServiceMessage{Id: "m_1", Message: &orrav1.ServiceMessage_TaskHeartbeat{TaskHeartbeat: &orrav1.TaskReport{ExecutionId: "e_2"}}})
+		require.NoError(t, err)
+		var message struct {
+			Payload TaskResult `json:"payload"`
+		}
+		require.NoError(t, json.Unmarshal(data, &message))
+		assert.Equal(t, WSTaskHeartbeat, message.Payload.Type)
+		assert.Equal(t, "e_2", message.Payload.ExecutionID)
+	})
+}
@@ -30,6 +30,16 @@ type LLMClient struct {
 	embeddingsClient *open.Client
 	embeddingsModel  string
 	logger           zerolog.Logger
+	// ping is the last readiness check of the reasoning provider
+	ping llmPing
+	// pricing prices the reasoning model's tokens for usage accounting
+	pricing LLMPricing
+}
+
+// LLMPricing is what a model charges per million prompt and completion tokens, in USD
+type LLMPricing struct {
+	PromptCostPerMillion     float64
+	CompletionCostPerMillion float64
 }
 
 type LLMClientConfig struct {
@@ -90,6 +100,10 @@ func NewLLMClient(cfg Config, logger zerolog.Logger) (*LLMClient, error) {
 		embeddingsClient: open.NewClient(cfg.PlanCache.OpenaiApiKey),
 		embeddingsModel:  string(open.AdaEmbeddingV2),
 		logger:           logger,
+		pricing: LLMPricing{
+			PromptCostPerMillion:     cfg.Reasoning.PromptCostPerMillion,
+			CompletionCostPerMillion: cfg.Reasoning.CompletionCostPerMillion,
+		},
 	}, nil
 }
 
@@ -124,6 +138,7 @@ func (l *LLMClient) Generate(ctx context.Context, prompt string) (response strin
 	if err != nil {
 		return "", err
 	}
+	reportLLMUsage(ctx, llmCallUsage(resp.Usage.PromptTokens, resp.Usage.CompletionTokens, l.pricing), l.reasoningModel)
 	return resp.Choices[0].Message.Content, nil
 }
 
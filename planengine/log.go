@@ -9,6 +9,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"slices"
 	"sort"
@@ -85,6 +86,16 @@ func (lm *LogManager) GetLog(orchestrationID string) *Log {
 	return lm.logs[orchestrationID]
 }
 
+// DeleteLog forgets an orchestration's log and removes it from storage
+func (lm *LogManager) DeleteLog(orchestrationID string) error {
+	lm.mu.Lock()
+	delete(lm.logs, orchestrationID)
+	delete(lm.orchestrations, orchestrationID)
+	lm.mu.Unlock()
+
+	return lm.storage.DeleteLog(orchestrationID)
+}
+
 func (lm *LogManager) PrepLogForOrchestration(projectID string, orchestrationID string, plan *ExecutionPlan) *Log {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
@@ -139,6 +150,48 @@ func (lm *LogManager) MarkTask(orchestrationID, taskID string, s Status, timesta
 	return nil
 }
 
+// InFlightTasks returns the orchestration's tasks currently being processed by services
+func (lm *LogManager) InFlightTasks(orchestrationID string) []*SubTask {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	state, ok := lm.orchestrations[orchestrationID]
+	if !ok || state.Plan == nil {
+		return nil
+	}
+
+	var tasks []*SubTask
+	for _, task := range state.Plan.Tasks {
+		if state.TasksStatuses[task.ID] == Processing {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// FinishedTaskOutputs returns the logged outputs of the orchestration's tasks that completed or were skipped, keyed by task
+func (lm *LogManager) FinishedTaskOutputs(orchestrationID string) map[string]LogEntry {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	state, ok := lm.orchestrations[orchestrationID]
+	log := lm.logs[orchestrationID]
+	if !ok || state.Plan == nil || log == nil {
+		return nil
+	}
+
+	outputs := make(map[string]LogEntry)
+	for _, entry := range log.ReadFrom(0) {
+		if entry.GetEntryType() != "task_output" {
+			continue
+		}
+		if status := state.TasksStatuses[entry.GetID()]; status == Completed || status == Skipped {
+			outputs[entry.GetID()] = entry
+		}
+	}
+	return outputs
+}
+
 func (lm *LogManager) MarkOrchestrationCompleted(orchestrationID string) Status {
 	return lm.MarkOrchestration(orchestrationID, Completed, nil)
 }
@@ -154,7 +207,7 @@ func (lm *LogManager) MarkOrchestration(orchestrationID string, s Status, reason
 	state, ok := lm.orchestrations[orchestrationID]
 	if !ok {
 		lm.Logger.Debug().Str("OrchestrationID", orchestrationID).Msg("orchestration has no associated state in log")
-		return state.Status
+		return s
 	}
 
 	if reason != nil {
@@ -195,13 +248,35 @@ func (lm *LogManager) AppendToLog(orchestrationID, entryType, id string, value j
 }
 
 func (lm *LogManager) AppendTaskFailureToLog(orchestrationID, id, producerID, failure string, attemptNo int, skipWebhook bool) error {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-
-	var f = LoggedFailure{
+	return lm.appendFailureToLog(orchestrationID, id, producerID, attemptNo, LoggedFailure{
 		Failure:     failure,
 		SkipWebhook: skipWebhook,
+	})
+}
+
+// AppendTaskErrorToLog logs the failure of a task's execution, with the service's error code and details if it reported any.
+// Terminal failures are ones retrying can't fix, their orchestration is compensated but not dead-lettered for a re-drive.
+func (lm *LogManager) AppendTaskErrorToLog(orchestrationID, id, producerID string, err error, attemptNo int, terminal bool) error {
+	failure := LoggedFailure{Failure: err.Error(), Terminal: terminal}
+	var taskErr *TaskError
+	if errors.As(err, &taskErr) {
+		failure.Code = taskErr.Code
+		failure.Details = taskErr.Details
 	}
+	return lm.appendFailureToLog(orchestrationID, id, producerID, attemptNo, failure)
+}
+
+// AppendTaskTimeoutToLog logs a task failure that times out the whole orchestration
+func (lm *LogManager) AppendTaskTimeoutToLog(orchestrationID, id, producerID, failure string, attemptNo int) error {
+	return lm.appendFailureToLog(orchestrationID, id, producerID, attemptNo, LoggedFailure{
+		Failure:  failure,
+		TimedOut: true,
+	})
+}
+
+func (lm *LogManager) appendFailureToLog(orchestrationID, id, producerID string, attemptNo int, f LoggedFailure) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
 
 	value, err := json.Marshal(f)
 	if err != nil {
@@ -239,6 +314,74 @@ func (lm *LogManager) AppendTaskStatusEvent(
 		event.Error = err.Error()
 	}
 
+	return lm.appendTaskStatusEvent(event, attemptNo)
+}
+
+// AppendTaskCompletedEvent records a task completed by its service, flagged when it was slow for the service
+func (lm *LogManager) AppendTaskCompletedEvent(orchestrationID, taskID, serviceID string, timestamp time.Time, attemptNo int, slow *TaskDurationAnomaly) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.appendTaskStatusEvent(TaskStatusEvent{
+		ID:              fmt.Sprintf("evt_%s_%s", strings.ToLower(taskID), short.New()),
+		OrchestrationID: orchestrationID,
+		TaskID:          taskID,
+		Status:          Completed,
+		Timestamp:       timestamp,
+		ServiceID:       serviceID,
+		Slow:            slow,
+	}, attemptNo)
+}
+
+// AppendTaskCacheHitEvent records a task completed with a cached output, rather than by its service
+func (lm *LogManager) AppendTaskCacheHitEvent(orchestrationID, taskID, serviceID string, timestamp time.Time) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.appendTaskStatusEvent(TaskStatusEvent{
+		ID:              fmt.Sprintf("evt_%s_%s", strings.ToLower(taskID), short.New()),
+		OrchestrationID: orchestrationID,
+		TaskID:          taskID,
+		Status:          Completed,
+		Timestamp:       timestamp,
+		ServiceID:       serviceID,
+		CacheHit:        true,
+	}, 0)
+}
+
+// AppendTaskReroutedEvent records a sticky task dispatched to another instance than its orchestration's earlier tasks
+func (lm *LogManager) AppendTaskReroutedEvent(orchestrationID, taskID, serviceID, fromInstance, toInstance string, timestamp time.Time) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.appendTaskStatusEvent(TaskStatusEvent{
+		ID:              fmt.Sprintf("evt_%s_%s", strings.ToLower(taskID), short.New()),
+		OrchestrationID: orchestrationID,
+		TaskID:          taskID,
+		Status:          Processing,
+		Timestamp:       timestamp,
+		ServiceID:       serviceID,
+		Rerouted:        &TaskReroute{FromInstance: fromInstance, ToInstance: toInstance},
+	}, 0)
+}
+
+// AppendTaskLeaseEvent records a task's lease being granted to a service instance or expiring
+func (lm *LogManager) AppendTaskLeaseEvent(orchestrationID, taskID, serviceID string, lease TaskLease, timestamp time.Time) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.appendTaskStatusEvent(TaskStatusEvent{
+		ID:              fmt.Sprintf("evt_%s_%s", strings.ToLower(taskID), short.New()),
+		OrchestrationID: orchestrationID,
+		TaskID:          taskID,
+		Status:          Processing,
+		Timestamp:       timestamp,
+		ServiceID:       serviceID,
+		Lease:           &lease,
+	}, 0)
+}
+
+func (lm *LogManager) appendTaskStatusEvent(event TaskStatusEvent, attemptNo int) error {
 	// Create a new log entry
 	eventData, err := json.Marshal(event)
 	if err != nil {
@@ -246,7 +389,14 @@ func (lm *LogManager) AppendTaskStatusEvent(
 	}
 
 	// Append to log with new task_status type
-	lm.AppendToLog(orchestrationID, "task_status", eventID, eventData, taskID, attemptNo)
+	lm.AppendToLog(event.OrchestrationID, "task_status", event.ID, eventData, event.TaskID, attemptNo)
+
+	if event.Status == Failed && lm.planEngine != nil {
+		lm.planEngine.notifyInBackground(func() { lm.planEngine.notifyTaskFailed(event) })
+	}
+	if event.Slow != nil && lm.planEngine != nil {
+		lm.planEngine.notifyInBackground(func() { lm.planEngine.notifyTaskSlow(event) })
+	}
 
 	return nil
 }
@@ -387,7 +537,7 @@ func (lm *LogManager) FinalizeOrchestration(
 		return fmt.Errorf("failed to finalize orchestration: %w", err)
 	}
 
-	if status != Failed {
+	if status != Failed && status != TimedOut {
 		return nil
 	}
 
@@ -490,6 +640,17 @@ func (l *Log) Append(storageId string, entry LogEntry, persist bool) {
 	}
 }
 
+// Head returns the offset the next entry is appended at, and when the last entry was appended
+func (l *Log) Head() (uint64, time.Time) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.Entries) == 0 {
+		return l.CurrentOffset, time.Time{}
+	}
+	return l.CurrentOffset, l.Entries[len(l.Entries)-1].Timestamp
+}
+
 func (l *Log) ReadFrom(offset uint64) []LogEntry {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
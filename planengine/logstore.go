@@ -7,7 +7,6 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -18,7 +17,7 @@ import (
 func (b *BadgerDB) StoreLogEntry(orchestrationID string, entry LogEntry) error {
 	// Use orchestrationID in key for correct grouping and retrieval
 	key := fmt.Sprintf("orchestration:%s:entry:%020d", orchestrationID, entry.GetOffset())
-	value, err := json.Marshal(entry)
+	value, err := b.encodePayload(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal entry: %w", err)
 	}
@@ -30,7 +29,7 @@ func (b *BadgerDB) StoreLogEntry(orchestrationID string, entry LogEntry) error {
 
 func (b *BadgerDB) StoreState(state *OrchestrationState) error {
 	key := fmt.Sprintf("orchestration:%s:state", state.ID)
-	value, err := json.Marshal(state)
+	value, err := b.encodePayload(state)
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
@@ -52,7 +51,7 @@ func (b *BadgerDB) LoadEntries(orchestrationID string) ([]LogEntry, error) {
 			item := it.Item()
 			var entry LogEntry
 			err := item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &entry)
+				return b.decodePayload(val, &entry)
 			})
 			if err != nil {
 				return err
@@ -84,7 +83,7 @@ func (b *BadgerDB) ListOrchestrationStates() ([]*OrchestrationState, error) {
 
 			var state OrchestrationState
 			err := item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &state)
+				return b.decodePayload(val, &state)
 			})
 			if err != nil {
 				return fmt.Errorf("failed to unmarshal state: %w", err)
@@ -111,7 +110,7 @@ func (b *BadgerDB) LoadState(orchestrationID string) (*OrchestrationState, error
 		}
 
 		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &state)
+			return b.decodePayload(val, &state)
 		})
 	})
 
@@ -121,3 +120,10 @@ func (b *BadgerDB) LoadState(orchestrationID string) (*OrchestrationState, error
 
 	return &state, nil
 }
+
+// DeleteLog deletes an orchestration's log entries and state
+func (b *BadgerDB) DeleteLog(orchestrationID string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return deletePrefix(txn, []byte(fmt.Sprintf("orchestration:%s:", orchestrationID)))
+	})
+}
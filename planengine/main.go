@@ -36,9 +36,45 @@ func main() {
 		_ = storage.Close()
 	}(db)
 
+	if cfg.Encryption.MasterKey != "" {
+		keys, err := NewStaticKeyProviderFromConfig(cfg.Encryption)
+		if err != nil {
+			log.Fatalf("could not initialise payload encryption for plan engine server: %s", err.Error())
+		}
+		db.EnablePayloadEncryption(NewPayloadCipher(keys))
+	}
+
+	auditLog, err := NewAuditLog(cfg.Audit, db, app.Logger)
+	if err != nil {
+		log.Fatalf("could not initialise audit log for plan engine server: %s", err.Error())
+	}
+
+	ca, err := readCertificateAuthority(cfg.TLS)
+	if err != nil {
+		log.Fatalf("could not load client CA for plan engine server: %s", err.Error())
+	}
+
+	adminCredential, err := LoadAdminCredential(cfg.Admin, cfg.StoragePath, app.Logger)
+	if err != nil {
+		log.Fatalf("could not load admin credential for plan engine server: %s", err.Error())
+	}
+
+	registrationTokens, err := NewRegistrationTokens(db)
+	if err != nil {
+		log.Fatalf("could not initialise registration tokens for plan engine server: %s", err.Error())
+	}
+
 	rootCtx, rootCancel := context.WithCancel(context.Background())
 	defer rootCancel()
 
+	shutdownTracing, err := setupTracing(rootCtx, cfg.Tracing)
+	if err != nil {
+		log.Fatalf("could not initialise tracing for plan engine server: %s", err.Error())
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	llmClient, err := NewLLMClient(cfg, app.Logger)
 	if err != nil {
 		log.Fatalf("could not initialise LLM client for plan engine server: %s", err.Error())
@@ -46,6 +82,14 @@ func main() {
 
 	engine := NewPlanEngine()
 	wsManager := NewWebSocketManager(app.Logger)
+	wsManager.ConfigureHeartbeat(cfg.Heartbeat)
+	wsManager.ConfigureDelivery(cfg.TaskDelivery)
+	wsManager.ConfigureHealthProbes(cfg.HealthProbe)
+	wsManager.ConfigureReconnection(cfg.Reconnection)
+	wsManager.ConfigureSendQueue(cfg.SendQueue)
+	if cfg.NATS.URL != "" {
+		wsManager.AddTransport(NewNATSTransport(cfg.NATS, app.Logger))
+	}
 	matcher := NewMatcher(llmClient, app.Logger)
 	vCache := NewVectorCache(llmClient, matcher, 1000, 24*time.Hour, app.Logger)
 	logManager, err := NewLogManager(rootCtx, db, LogsRetentionPeriod, engine)
@@ -55,10 +99,40 @@ func main() {
 	pddlValidSvc := NewPddlValidationService(cfg.PddlValidatorPath, cfg.PddlValidationTimeout, app.Logger)
 	logManager.Logger = app.Logger
 	engine.Initialise(rootCtx, db, db, db, db, logManager, wsManager, vCache, pddlValidSvc, matcher, app.Logger)
+	engine.DeadLetters = db
+	engine.WebhookDeadLetters = db
+	engine.WebhookDeliveries = db
+	engine.TaskLogs = db
+	engine.Submissions = db
+	engine.Usage = db
+	engine.ConfigureWebhookRetries(cfg.WebhookRetry)
+	engine.ConfigureWebhookAddresses(cfg.WebhookAddresses)
+	engine.ConfigureSlowTasks(cfg.SlowTasks)
+
+	go engine.SweepExpiringAPIKeys(rootCtx, APIKeyExpirySweepInterval, APIKeyExpiryNoticeWindow)
+	go engine.EvaluateAlerts(rootCtx, AlertEvaluationInterval)
+
+	scheduler, err := NewScheduler(db, app.runSchedule, app.Logger)
+	if err != nil {
+		log.Fatalf("could not initialise scheduler for plan engine server: %s", err.Error())
+	}
+	go scheduler.Run(rootCtx, SchedulerTickInterval)
+	app.Limiter.StartCleanup(rootCtx)
 
 	app.Engine = engine
 	app.Router = mux.NewRouter()
 	app.Db = db
+	app.Audit = auditLog
+	app.CA = ca
+	app.Admin = adminCredential
+	app.RegistrationTokens = registrationTokens
+	app.Submissions = NewSubmissions(db, cfg.IdempotencyWindow)
+	app.Scheduler = scheduler
+	app.Templates = db
+	app.LLM = llmClient
+	if cfg.OIDC.IssuerURL != "" {
+		app.OIDC = NewOIDCVerifier(cfg.OIDC)
+	}
 	app.RootCtx = rootCtx
 	app.RootCancel = rootCancel
 	app.configureRoutes()
@@ -0,0 +1,124 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathRoot prefixes references written JSONPath style, "$.task1.customer.email" is the same as "$task1.customer.email"
+const jsonPathRoot = "$."
+
+// fieldPathSegment is a step into an output, either an object field or an array index
+type fieldPathSegment struct {
+	Field   string
+	Index   int
+	IsIndex bool
+}
+
+// parseFieldPath splits a mapping expression such as "customer.addresses[0].city" into its segments
+func parseFieldPath(path string) ([]fieldPathSegment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("field path is empty")
+	}
+
+	var segments []fieldPathSegment
+	for _, part := range strings.Split(path, ".") {
+		field, indexes, _ := strings.Cut(part, "[")
+		if field == "" && len(segments) == 0 || field == "" && indexes == "" {
+			return nil, fmt.Errorf("field path %q has an empty field", path)
+		}
+		if field != "" {
+			segments = append(segments, fieldPathSegment{Field: field})
+		}
+		if indexes == "" {
+			continue
+		}
+
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 || !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("field path %q has an invalid array index", path)
+			}
+			segments = append(segments, fieldPathSegment{Index: n, IsIndex: true})
+		}
+	}
+	return segments, nil
+}
+
+// selectField picks the value a mapping expression points to out of a decoded output.
+// Fields named with dots are matched as they are first, so outputs keyed that way keep working.
+func selectField(output map[string]any, path string) (any, bool) {
+	if value, ok := output[path]; ok {
+		return value, true
+	}
+
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var current any = output
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[segment.Field]
+			if segment.IsIndex || !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			if !segment.IsIndex || segment.Index >= len(node) {
+				return nil, false
+			}
+			current = node[segment.Index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// selectSpec finds the spec of the value a mapping expression points to, in the spec of a whole output
+func selectSpec(spec Spec, path string) (Spec, bool) {
+	if property, ok := spec.Properties[path]; ok {
+		return property, true
+	}
+
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return Spec{}, false
+	}
+
+	current := spec
+	for _, segment := range segments {
+		if segment.IsIndex {
+			if current.Type != "array" || current.Items == nil {
+				return Spec{}, false
+			}
+			current = *current.Items
+			continue
+		}
+		property, ok := current.Properties[segment.Field]
+		if !ok {
+			return Spec{}, false
+		}
+		current = property
+	}
+	return current, true
+}
+
+// rootField is the top level field a mapping expression starts from
+func rootField(path string) string {
+	segments, err := parseFieldPath(path)
+	if err != nil || segments[0].IsIndex {
+		return path
+	}
+	return segments[0].Field
+}
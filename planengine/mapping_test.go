@@ -0,0 +1,105 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	segments, err := parseFieldPath("customer.addresses[1].city")
+	require.NoError(t, err)
+	assert.Equal(t, []fieldPathSegment{
+		{Field: "customer"},
+		{Field: "addresses"},
+		{Index: 1, IsIndex: true},
+		{Field: "city"},
+	}, segments)
+
+	segments, err = parseFieldPath("matrix[0][2]")
+	require.NoError(t, err)
+	assert.Equal(t, []fieldPathSegment{{Field: "matrix"}, {Index: 0, IsIndex: true}, {Index: 2, IsIndex: true}}, segments)
+
+	for _, path := range []string{"", "customer..email", "items[x]", "items[-1]", "items[0", ".email"} {
+		_, err := parseFieldPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestSelectField(t *testing.T) {
+	var output map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"customer": {"email": "jane@example.com", "orders": [{"id": "o1"}, {"id": "o2"}]},
+		"legacy.key": "kept"
+	}`), &output))
+
+	tests := []struct {
+		path   string
+		want   any
+		exists bool
+	}{
+		{"customer.email", "jane@example.com", true},
+		{"customer.orders[1].id", "o2", true},
+		{"customer.orders[2].id", nil, false},
+		{"customer.email.domain", nil, false},
+		{"customer[0]", nil, false},
+		{"legacy.key", "kept", true},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			value, exists := selectField(output, tt.path)
+			assert.Equal(t, tt.exists, exists)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+}
+
+func TestSelectSpec(t *testing.T) {
+	output := Spec{
+		Type: "object",
+		Properties: map[string]Spec{
+			"customer": {
+				Type: "object",
+				Properties: map[string]Spec{
+					"emails": {Type: "array", Items: &Spec{Type: "string"}},
+				},
+			},
+		},
+	}
+
+	spec, ok := selectSpec(output, "customer.emails[0]")
+	require.True(t, ok)
+	assert.Equal(t, "string", spec.Type)
+
+	_, ok = selectSpec(output, "customer[0]")
+	assert.False(t, ok)
+	_, ok = selectSpec(output, "customer.phone")
+	assert.False(t, ok)
+}
+
+func TestMergeValueMapsSelectsMappedFields(t *testing.T) {
+	merged, err := mergeValueMapsToJson(
+		map[string]json.RawMessage{
+			"task1": json.RawMessage(`{"customer": {"email": "jane@example.com", "tags": ["vip"]}}`),
+		},
+		TaskDependenciesWithKeys{
+			"task1": {
+				{TaskKey: "email", DependencyKey: "customer.email"},
+				{TaskKey: "tag", DependencyKey: "customer.tags[0]"},
+				{TaskKey: "phone", DependencyKey: "customer.phone"},
+			},
+		},
+	)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"email": "jane@example.com", "tag": "vip"}`, string(merged))
+}
@@ -0,0 +1,291 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricBuckets are the upper bounds of latency histograms, in seconds
+var metricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics collects the plan engine's operational metrics and renders them in the Prometheus text format.
+// Its methods are safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	mu                 sync.Mutex
+	orchestrations     *counterVec
+	taskDispatch       *histogramVec
+	webhookDeliveries  *counterVec
+	httpRequests       *histogramVec
+	notificationPosts  *counterVec
+	slowTasks          *counterVec
+	websocketConnected func() int
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		orchestrations: &counterVec{
+			name:   "orra_orchestrations_total",
+			help:   "Orchestrations that finished, by status.",
+			labels: []string{"status"},
+		},
+		taskDispatch: &histogramVec{
+			name:   "orra_task_dispatch_duration_seconds",
+			help:   "Time from dispatching a task to a service to receiving its result, by status.",
+			labels: []string{"status"},
+		},
+		webhookDeliveries: &counterVec{
+			name:   "orra_webhook_deliveries_total",
+			help:   "Webhook delivery attempts, by outcome.",
+			labels: []string{"outcome"},
+		},
+		httpRequests: &histogramVec{
+			name:   "orra_http_request_duration_seconds",
+			help:   "HTTP request durations, by method, route and status code.",
+			labels: []string{"method", "route", "code"},
+		},
+		notificationPosts: &counterVec{
+			name:   "orra_notification_posts_total",
+			help:   "Messages posted to notification channels, by channel type and outcome.",
+			labels: []string{"type", "outcome"},
+		},
+		slowTasks: &counterVec{
+			name:   "orra_slow_tasks_total",
+			help:   "Tasks that took far longer than their service usually takes, by service.",
+			labels: []string{"service"},
+		},
+	}
+}
+
+func (m *Metrics) ObserveOrchestration(status Status) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.orchestrations.inc(status.String())
+}
+
+func (m *Metrics) ObserveTaskDispatch(status Status, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.taskDispatch.observe(elapsed.Seconds(), status.String())
+}
+
+func (m *Metrics) ObserveWebhookDelivery(succeeded bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhookDeliveries.inc(metricOutcome(succeeded))
+}
+
+func (m *Metrics) ObserveNotificationPost(channelType string, succeeded bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notificationPosts.inc(channelType, metricOutcome(succeeded))
+}
+
+func (m *Metrics) ObserveSlowTask(serviceID string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slowTasks.inc(serviceID)
+}
+
+func (m *Metrics) ObserveHTTPRequest(method, route string, code int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpRequests.observe(elapsed.Seconds(), method, route, strconv.Itoa(code))
+}
+
+func metricOutcome(succeeded bool) string {
+	if succeeded {
+		return "succeeded"
+	}
+	return "failed"
+}
+
+// WriteTo renders every metric in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if m != nil {
+		m.mu.Lock()
+		m.orchestrations.write(&b)
+		m.taskDispatch.write(&b)
+		m.webhookDeliveries.write(&b)
+		m.notificationPosts.write(&b)
+		m.slowTasks.write(&b)
+		m.httpRequests.write(&b)
+		m.mu.Unlock()
+
+		connections := 0
+		if m.websocketConnected != nil {
+			connections = m.websocketConnected()
+		}
+		b.WriteString("# HELP orra_websocket_connections Service instances currently connected over WebSocket.\n")
+		b.WriteString("# TYPE orra_websocket_connections gauge\n")
+		fmt.Fprintf(&b, "orra_websocket_connections %d\n", connections)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	if c.values == nil {
+		c.values = make(map[string]float64)
+	}
+	c.values[metricLabels(c.labels, labelValues)]++
+}
+
+func (c *counterVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, labels := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s{%s} %s\n", c.name, labels, formatMetric(c.values[labels]))
+	}
+}
+
+type histogramVec struct {
+	name   string
+	help   string
+	labels []string
+	series map[string]*histogram
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	if h.series == nil {
+		h.series = make(map[string]*histogram)
+	}
+	labels := metricLabels(h.labels, labelValues)
+	series, ok := h.series[labels]
+	if !ok {
+		series = &histogram{buckets: make([]uint64, len(metricBuckets))}
+		h.series[labels] = series
+	}
+	for i, bound := range metricBuckets {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *histogramVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, labels := range sortedKeys(h.series) {
+		series := h.series[labels]
+		for i, bound := range metricBuckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, labels, formatMetric(bound), series.buckets[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, labels, series.count)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", h.name, labels, formatMetric(series.sum))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", h.name, labels, series.count)
+	}
+}
+
+func metricLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, values[i])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricsMiddleware records how long each routed HTTP request took. WebSocket upgrades are left alone, they
+// last as long as the connection.
+func (app *App) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		app.Engine.Metrics.ObserveHTTPRequest(r.Method, route, recorder.status, time.Since(start))
+	})
+}
+
+// MetricsHandler serves the plan engine's metrics to Prometheus, behind a bearer token when one is configured
+func (app *App) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if token := app.Cfg.Metrics.Token; token != "" {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthenticated, "invalid metrics token"))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	if _, err := app.Engine.Metrics.WriteTo(w); err != nil {
+		logger := app.requestLogger(r)
+		logger.Error().Err(err).Msg("Failed to write metrics")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Engine.Metrics = NewMetrics()
+	app.Engine.Metrics.websocketConnected = func() int { return 3 }
+
+	scrape := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	app.Engine.Metrics.ObserveOrchestration(Completed)
+	app.Engine.Metrics.ObserveOrchestration(Completed)
+	app.Engine.Metrics.ObserveOrchestration(Failed)
+	app.Engine.Metrics.ObserveTaskDispatch(Completed, 30*time.Millisecond)
+	app.Engine.Metrics.ObserveWebhookDelivery(false)
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.Header.Set("Authorization", "Bearer project-api-key")
+	app.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := scrape("")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metricsContentType, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE orra_orchestrations_total counter")
+	assert.Contains(t, body, `orra_orchestrations_total{status="completed"} 2`)
+	assert.Contains(t, body, `orra_orchestrations_total{status="failed"} 1`)
+	assert.Contains(t, body, `orra_task_dispatch_duration_seconds_bucket{status="completed",le="0.025"} 0`)
+	assert.Contains(t, body, `orra_task_dispatch_duration_seconds_bucket{status="completed",le="0.05"} 1`)
+	assert.Contains(t, body, `orra_task_dispatch_duration_seconds_count{status="completed"} 1`)
+	assert.Contains(t, body, `orra_webhook_deliveries_total{outcome="failed"} 1`)
+	assert.Contains(t, body, `orra_http_request_duration_seconds_count{method="GET",route="/webhooks",code="200"} 1`)
+	assert.Contains(t, body, "orra_websocket_connections 3")
+
+	t.Run("requires the configured token", func(t *testing.T) {
+		app.Cfg.Metrics.Token = "scraper-token"
+		defer func() { app.Cfg.Metrics.Token = "" }()
+
+		assert.Equal(t, http.StatusUnauthorized, scrape("").Code)
+		assert.Equal(t, http.StatusUnauthorized, scrape("wrong").Code)
+		assert.Equal(t, http.StatusOK, scrape("scraper-token").Code)
+	})
+}
@@ -8,36 +8,130 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
 )
 
 func (app *App) APIKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unauthorized, "Authorization header is missing"))
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, "Authorization header is missing"))
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			errs.HTTPErrorResponse(w, app.Logger, errs.E(errs.Unauthorized, "Invalid Authorization header format"))
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, "Invalid Authorization header format"))
 			return
 		}
 
-		apiKey := parts[1]
+		credential := parts[1]
 
-		// Store the API key in the request context
-		ctx := context.WithValue(r.Context(), apiKeyContextKey, apiKey)
+		principal, err := app.authenticate(r, credential)
+		if errors.Is(err, ErrNotProjectMember) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+			return
+		} else if err != nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthenticated, err))
+			return
+		}
+
+		// Invalid API keys are rejected by the handlers, only known projects have restrictions to enforce
+		project, err := app.principalProject(principal)
+		if err == nil {
+			if err := verifyClientCertificate(r, project.ID, ""); err != nil {
+				httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+				return
+			}
+			if err := app.enforceIPAllowlist(r, project); err != nil {
+				logger := app.requestLogger(r)
+				logger.Warn().Err(err).Str("ProjectID", project.ID).Str("RemoteAddr", r.RemoteAddr).Msg("Request rejected by IP allowlist")
+				httpErrorResponse(w, logger, errs.E(errs.Unauthorized, err))
+				return
+			}
+		} else if _, _, ok := clientCertificateIdentity(r); ok {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+			return
+		}
+
+		if err != nil {
+			project = nil
+		}
+		if principal.User == nil && principal.RegistrationToken == nil {
+			principal.Actor = auditActor(project, principal.APIKey)
+		}
+		clientAddr := r.RemoteAddr
+		if addr, err := app.clientAddr(r); err == nil {
+			clientAddr = addr.String()
+		}
+		principal.RateLimitKey = principal.rateLimitKey(project, clientAddr)
+
+		if app.Limiter != nil {
+			decision := app.Limiter.AllowRequest(principal.RateLimitKey)
+			writeRateLimitHeaders(w, "", decision)
+			if !decision.Allowed {
+				tooManyRequestsResponse(w, decision.RetryAfter, RateLimitExceededErrCode, "Request rate limit exceeded")
+				return
+			}
+		}
+
+		// Store the caller in the request context
+		ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+		if principal.APIKey != "" {
+			ctx = context.WithValue(ctx, apiKeyContextKey, principal.APIKey)
+		}
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	}
 }
 
+// OrchestrationRateLimitMiddleware limits how many orchestrations a caller can submit per minute
+func (app *App) OrchestrationRateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromRequest(r)
+		if app.Limiter == nil || principal == nil || principal.RateLimitKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		decision := app.Limiter.AllowOrchestration(principal.RateLimitKey)
+		writeRateLimitHeaders(w, "Orchestrations-", decision)
+		if !decision.Allowed {
+			tooManyRequestsResponse(w, decision.RetryAfter, RateLimitExceededErrCode, "Orchestration rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// APIVersionMiddleware rejects requests expecting an API version other than the one served, and tells clients of
+// legacy unprefixed paths where the versioned API lives
+func (app *App) APIVersionMiddleware(legacy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(APIVersionHeader, CurrentAPIVersion)
+			if legacy {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", APIVersionPrefix, r.URL.Path))
+			}
+
+			if requested := r.Header.Get(APIVersionHeader); requested != "" && requested != CurrentAPIVersion {
+				httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(UnsupportedAPIVersionErrCode), fmt.Sprintf("unsupported API version %s, this plan engine serves version %s", requested, CurrentAPIVersion)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *App) VersionHeaderMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(VersionHeader, Version)
@@ -0,0 +1,249 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+var ErrClientCertificateMismatch = errors.New("client certificate was not issued for this project")
+
+// CertificateAuthority signs per-project client certificates for mutual TLS
+type CertificateAuthority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+}
+
+// ClientCertificate is a freshly issued client certificate, the private key is only ever returned here
+type ClientCertificate struct {
+	SerialNumber  string    `json:"serialNumber"`
+	ServiceID     string    `json:"serviceId,omitempty"`
+	Certificate   string    `json:"certificate"`
+	PrivateKey    string    `json:"privateKey"`
+	CACertificate string    `json:"caCertificate"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+func LoadCertificateAuthority(certFile, keyFile string) (*CertificateAuthority, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client CA key pair: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("client CA certificate %s is not a certificate authority", certFile)
+	}
+
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("client CA private key cannot sign certificates")
+	}
+
+	return &CertificateAuthority{
+		cert:    cert,
+		key:     signer,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+	}, nil
+}
+
+// CertPool returns a pool trusting only this authority
+func (ca *CertificateAuthority) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// Issue signs a client certificate binding the holder to a project and, optionally, one of its services
+func (ca *CertificateAuthority) Issue(projectID, serviceID string, ttl time.Duration) (*ClientCertificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{projectID},
+			CommonName:   serviceID,
+		},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(ttl),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign client certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode client key: %w", err)
+	}
+
+	return &ClientCertificate{
+		SerialNumber:  serial.Text(16),
+		ServiceID:     serviceID,
+		Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKey:    string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		CACertificate: string(ca.certPEM),
+		ExpiresAt:     template.NotAfter,
+	}, nil
+}
+
+// NewServerTLSConfig builds the TLS config for the HTTP API and /ws endpoint.
+// Client certificates are verified against the client CA when one is configured.
+func NewServerTLSConfig(cfg TLS, ca *CertificateAuthority) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch cfg.ClientAuth {
+	case ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid TLS client auth [%s], select one of [%s, %s, %s]", cfg.ClientAuth, ClientAuthNone, ClientAuthOptional, ClientAuthRequire)
+	}
+
+	if ca == nil {
+		return nil, fmt.Errorf("a client CA is required when TLS client auth is %s", cfg.ClientAuth)
+	}
+	tlsConfig.ClientCAs = ca.CertPool()
+
+	return tlsConfig, nil
+}
+
+// clientCertificateIdentity returns the project and service a verified client certificate was issued for.
+// Certificates signed by the CA outside the plan engine carry no project and are trusted as operator certificates.
+func clientCertificateIdentity(r *http.Request) (projectID, serviceID string, ok bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", "", false
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	if len(leaf.Subject.Organization) > 0 {
+		projectID = leaf.Subject.Organization[0]
+	}
+	return projectID, leaf.Subject.CommonName, true
+}
+
+// verifyClientCertificate ensures a presented client certificate belongs to the authenticated project and service
+func verifyClientCertificate(r *http.Request, projectID, serviceID string) error {
+	certProjectID, certServiceID, ok := clientCertificateIdentity(r)
+	if !ok || certProjectID == "" {
+		return nil
+	}
+	if certProjectID != projectID {
+		return ErrClientCertificateMismatch
+	}
+	if serviceID != "" && certServiceID != "" && certServiceID != serviceID {
+		return fmt.Errorf("client certificate was not issued for service %s", serviceID)
+	}
+	return nil
+}
+
+func readCertificateAuthority(cfg TLS) (*CertificateAuthority, error) {
+	if cfg.ClientCAFile == "" {
+		return nil, nil
+	}
+	if cfg.ClientCAKeyFile == "" {
+		// Without the CA key certificates can still be verified, just not issued
+		data, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("client CA %s is not PEM encoded", cfg.ClientCAFile)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client CA certificate: %w", err)
+		}
+		return &CertificateAuthority{cert: cert, certPEM: data}, nil
+	}
+	return LoadCertificateAuthority(cfg.ClientCAFile, cfg.ClientCAKeyFile)
+}
+
+// certificateRequest names the service a client certificate is issued for
+type certificateRequest struct {
+	ServiceID string `json:"serviceId"`
+}
+
+// IssueClientCertificate mints a client certificate scoped to the caller's project
+func (app *App) IssueClientCertificate(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	if app.CA == nil || app.CA.key == nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ClientCertificatesDisabledErrCode), "client certificate issuance is not enabled"))
+		return
+	}
+
+	var request certificateRequest
+	if err := decodeRequest(w, r, &request, certificateRequestFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if request.ServiceID != "" && !app.Engine.ServiceBelongsToProject(request.ServiceID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("serviceId"), "unknown service for project"))
+		return
+	}
+
+	cert, err := app.CA.Issue(project.ID, request.ServiceID, app.Cfg.TLS.ClientCertTTL)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ClientCertificateIssueFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(cert); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
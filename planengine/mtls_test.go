@@ -0,0 +1,100 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertificateAuthority(t *testing.T) *CertificateAuthority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "orra test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &CertificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func TestCertificateAuthority_Issue(t *testing.T) {
+	ca := newTestCertificateAuthority(t)
+
+	issued, err := ca.Issue("p_test", "s_echo", time.Hour)
+	require.NoError(t, err)
+
+	_, err = tls.X509KeyPair([]byte(issued.Certificate), []byte(issued.PrivateKey))
+	require.NoError(t, err, "certificate and key should form a usable pair")
+
+	block, _ := pem.Decode([]byte(issued.Certificate))
+	require.NotNil(t, block)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:     ca.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+
+	t.Run("certificate is bound to its project and service", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/ws?serviceId=s_echo", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: chains}
+
+		assert.NoError(t, verifyClientCertificate(req, "p_test", "s_echo"))
+		assert.ErrorIs(t, verifyClientCertificate(req, "p_other", ""), ErrClientCertificateMismatch)
+		assert.Error(t, verifyClientCertificate(req, "p_test", "s_other"))
+	})
+
+	t.Run("requests without a client certificate are left to API key auth", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/orchestrations", nil)
+		assert.NoError(t, verifyClientCertificate(req, "p_test", ""))
+	})
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	ca := newTestCertificateAuthority(t)
+
+	cfg, err := NewServerTLSConfig(TLS{ClientAuth: ClientAuthRequire}, ca)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	_, err = NewServerTLSConfig(TLS{ClientAuth: ClientAuthOptional}, nil)
+	assert.Error(t, err, "verifying client certificates needs a CA")
+
+	_, err = NewServerTLSConfig(TLS{ClientAuth: "sometimes"}, ca)
+	assert.Error(t, err)
+}
@@ -0,0 +1,248 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	NATSConnectSubject    = "connect"
+	NATSDisconnectSubject = "disconnect"
+	NATSTasksSubject      = "tasks"
+	NATSResultsSubject    = "results"
+)
+
+// natsConn is the subset of a NATS connection the transport uses
+type natsConn interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error)
+	Close()
+}
+
+// NATSTransport relays tasks and results through a NATS server, so services consume tasks from a subject and
+// publish results without holding a connection to the plan engine. Each service uses four subjects:
+//
+//	<prefix>.<projectID>.<serviceID>.connect     service announces itself, optionally with a resume token
+//	<prefix>.<projectID>.<serviceID>.tasks       plan engine publishes tasks, pings and acknowledgements
+//	<prefix>.<projectID>.<serviceID>.results     service publishes the messages it'd send over the WebSocket
+//	<prefix>.<projectID>.<serviceID>.disconnect  service signs off
+//
+// Services are identified by their subjects, so the NATS server's permissions must restrict each service
+// to its own subjects.
+type NATSTransport struct {
+	cfg      NATS
+	conn     natsConn
+	engine   *PlanEngine
+	logger   zerolog.Logger
+	sessions map[string]*natsSession
+	mu       sync.Mutex
+}
+
+func NewNATSTransport(cfg NATS, logger zerolog.Logger) *NATSTransport {
+	return &NATSTransport{
+		cfg:      cfg,
+		logger:   logger,
+		sessions: make(map[string]*natsSession),
+	}
+}
+
+func (t *NATSTransport) Name() string {
+	return "nats"
+}
+
+func (t *NATSTransport) Start(ctx context.Context, engine *PlanEngine) error {
+	if t.conn == nil {
+		conn, err := nats.Connect(t.cfg.URL, nats.Name("orra-plan-engine"), nats.MaxReconnects(-1))
+		if err != nil {
+			return fmt.Errorf("failed to connect to NATS server: %w", err)
+		}
+		t.conn = conn
+	}
+	t.engine = engine
+
+	handlers := map[string]nats.MsgHandler{
+		NATSConnectSubject:    t.handleConnect,
+		NATSDisconnectSubject: t.handleDisconnect,
+		NATSResultsSubject:    t.handleResult,
+	}
+	for subject, handler := range handlers {
+		if _, err := t.conn.Subscribe(t.subject("*", "*", subject), handler); err != nil {
+			t.conn.Close()
+			return fmt.Errorf("failed to subscribe to %s subjects: %w", subject, err)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		t.conn.Close()
+	}()
+	return nil
+}
+
+func (t *NATSTransport) subject(projectID, serviceID, kind string) string {
+	return strings.Join([]string{t.cfg.SubjectPrefix, projectID, serviceID, kind}, ".")
+}
+
+// parseSubject returns the project and service a message was published for
+func (t *NATSTransport) parseSubject(subject string) (projectID, serviceID string, ok bool) {
+	tokens := strings.Split(strings.TrimPrefix(subject, t.cfg.SubjectPrefix+"."), ".")
+	if len(tokens) != 3 || tokens[0] == "" || tokens[1] == "" {
+		return "", "", false
+	}
+	return tokens[0], tokens[1], true
+}
+
+func (t *NATSTransport) handleConnect(msg *nats.Msg) {
+	projectID, serviceID, ok := t.parseSubject(msg.Subject)
+	if !ok {
+		return
+	}
+
+	var hello struct {
+		ResumeToken string `json:"resumeToken"`
+	}
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &hello); err != nil {
+			t.logger.Warn().Err(err).Str("ServiceID", serviceID).Msg("Invalid NATS connect message")
+			return
+		}
+	}
+	if _, err := t.connect(projectID, serviceID, hello.ResumeToken); err != nil {
+		t.logger.Warn().Err(err).Str("ServiceID", serviceID).Msg("Rejected NATS service connection")
+	}
+}
+
+func (t *NATSTransport) handleDisconnect(msg *nats.Msg) {
+	_, serviceID, ok := t.parseSubject(msg.Subject)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	session, connected := t.sessions[serviceID]
+	t.mu.Unlock()
+	if connected {
+		_ = session.Close()
+	}
+}
+
+// handleResult relays a service's message to the WebSocketManager, services that publish
+// without announcing themselves first are connected implicitly.
+func (t *NATSTransport) handleResult(msg *nats.Msg) {
+	projectID, serviceID, ok := t.parseSubject(msg.Subject)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	session, connected := t.sessions[serviceID]
+	t.mu.Unlock()
+	if !connected {
+		var err error
+		if session, err = t.connect(projectID, serviceID, ""); err != nil {
+			t.logger.Warn().Err(err).Str("ServiceID", serviceID).Msg("Dropped NATS message from unknown service")
+			return
+		}
+	}
+
+	t.engine.WebSocketManager.HandleMessage(session, msg.Data, t.engine.GetServiceByID)
+}
+
+func (t *NATSTransport) connect(projectID, serviceID, resumeToken string) (*natsSession, error) {
+	if !t.engine.ServiceBelongsToProject(serviceID, projectID) {
+		return nil, fmt.Errorf("unknown service for project")
+	}
+	serviceName, err := t.engine.GetServiceName(projectID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &natsSession{
+		transport: t,
+		serviceID: serviceID,
+		subject:   t.subject(projectID, serviceID, NATSTasksSubject),
+		keys:      map[string]any{"projectID": projectID, WSResumeQueryParam: resumeToken},
+	}
+
+	t.mu.Lock()
+	previous := t.sessions[serviceID]
+	t.sessions[serviceID] = session
+	t.mu.Unlock()
+	if previous != nil {
+		previous.markClosed()
+	}
+
+	t.engine.WebSocketManager.HandleConnection(serviceID, serviceName, session)
+	return session, nil
+}
+
+// natsSession adapts a service's subjects to a serviceSession
+type natsSession struct {
+	transport *NATSTransport
+	serviceID string
+	subject   string
+	closed    bool
+	keys      map[string]any
+	mu        sync.RWMutex
+}
+
+func (s *natsSession) Write(message []byte) error {
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return fmt.Errorf("nats session for service %s is closed", s.serviceID)
+	}
+	return s.transport.conn.Publish(s.subject, message)
+}
+
+// Close ends the session, as there's no socket to close the WebSocketManager is told directly
+func (s *natsSession) Close() error {
+	if !s.markClosed() {
+		return nil
+	}
+
+	s.transport.mu.Lock()
+	if s.transport.sessions[s.serviceID] == s {
+		delete(s.transport.sessions, s.serviceID)
+	}
+	s.transport.mu.Unlock()
+
+	s.transport.engine.WebSocketManager.HandleDisconnection(s.serviceID, s)
+	return nil
+}
+
+func (s *natsSession) markClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	return true
+}
+
+func (s *natsSession) Get(key string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+func (s *natsSession) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = value
+}
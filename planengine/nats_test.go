@@ -0,0 +1,124 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSConn records published messages and lets tests deliver messages to subscriptions
+type fakeNATSConn struct {
+	mu        sync.Mutex
+	published map[string][][]byte
+	handlers  map[string]nats.MsgHandler
+}
+
+func newFakeNATSConn() *fakeNATSConn {
+	return &fakeNATSConn{published: make(map[string][][]byte), handlers: make(map[string]nats.MsgHandler)}
+}
+
+func (c *fakeNATSConn) Publish(subject string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published[subject] = append(c.published[subject], data)
+	return nil
+}
+
+func (c *fakeNATSConn) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[subject] = handler
+	return nil, nil
+}
+
+func (c *fakeNATSConn) Close() {}
+
+func (c *fakeNATSConn) deliver(wildcard, subject string, data []byte) {
+	c.mu.Lock()
+	handler := c.handlers[wildcard]
+	c.mu.Unlock()
+	handler(&nats.Msg{Subject: subject, Data: data})
+}
+
+func (c *fakeNATSConn) messageTypes(subject string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var types []string
+	for _, data := range c.published[subject] {
+		var msg struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(data, &msg)
+		types = append(types, msg.Type)
+	}
+	return types
+}
+
+func TestNATSTransport(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	app.Engine.WebSocketManager = wsm
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+	conn := newFakeNATSConn()
+	transport := NewNATSTransport(NATS{SubjectPrefix: "orra"}, zerolog.New(zerolog.NewTestWriter(t)))
+	transport.conn = conn
+	wsm.AddTransport(transport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wsm.StartTransports(ctx, app.Engine)
+
+	tasksSubject := "orra.project-id.s_echo.tasks"
+
+	t.Run("ignores services of other projects", func(t *testing.T) {
+		conn.deliver("orra.*.*.connect", "orra.other-project.s_echo.connect", nil)
+		assert.False(t, wsm.IsServiceHealthy(service.ID))
+	})
+
+	conn.deliver("orra.*.*.connect", "orra.project-id.s_echo.connect", nil)
+	require.True(t, wsm.IsServiceHealthy(service.ID))
+	assert.Equal(t, []string{WSResumeToken}, conn.messageTypes(tasksSubject))
+
+	_, _, err := service.IdempotencyStore.InitializeOrGetExecution("key-1", "e_1")
+	require.NoError(t, err)
+	task := &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1", Input: json.RawMessage(`{}`)}
+	require.NoError(t, wsm.SendTask(service.ID, task))
+	assert.Equal(t, []string{WSResumeToken, "task_request"}, conn.messageTypes(tasksSubject))
+
+	result, _ := json.Marshal(map[string]any{"id": "m_1", "payload": map[string]any{
+		"type":           "task_result",
+		"taskId":         "task1",
+		"executionId":    "e_1",
+		"serviceId":      service.ID,
+		"idempotencyKey": "key-1",
+		"result":         map[string]string{"echo": "hello"},
+	}})
+	conn.deliver("orra.*.*.results", "orra.project-id.s_echo.results", result)
+
+	execution, _ := service.IdempotencyStore.GetExecutionWithResult("key-1")
+	assert.Equal(t, ExecutionCompleted, execution.State)
+	assert.Equal(t, []string{WSResumeToken, "task_request", "ACK"}, conn.messageTypes(tasksSubject))
+
+	wsm.deliveryMu.Lock()
+	assert.Empty(t, wsm.deliveries)
+	wsm.deliveryMu.Unlock()
+
+	conn.deliver("orra.*.*.disconnect", "orra.project-id.s_echo.disconnect", nil)
+	assert.False(t, wsm.IsServiceHealthy(service.ID))
+}
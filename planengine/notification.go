@@ -0,0 +1,265 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	NotificationChannelSlack   = "slack"
+	NotificationChannelDiscord = "discord"
+
+	notificationPostTimeout = 10 * time.Second
+)
+
+// notificationHosts are the hosts each chat tool serves its incoming webhooks from
+var notificationHosts = map[string][]string{
+	NotificationChannelSlack:   {"hooks.slack.com"},
+	NotificationChannelDiscord: {"discord.com", "discordapp.com"},
+}
+
+// NotificationEvents are the events notification channels can be told about
+var NotificationEvents = []string{
+	ProjectEventOrchestrationCompleted,
+	ProjectEventOrchestrationFailed,
+	ProjectEventAlertTriggered,
+	ProjectEventAlertResolved,
+}
+
+// NotificationChannel posts human-readable messages to a chat tool's incoming webhook. Channels without events
+// are told about every notification event.
+type NotificationChannel struct {
+	Type   string   `json:"type"`
+	Url    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// ProjectNotifications holds the chat channels a project's orchestration outcomes are announced in
+type ProjectNotifications struct {
+	Channels []NotificationChannel `json:"channels"`
+}
+
+// Validate ensures every channel is a supported chat tool with an HTTPS incoming webhook URL on the tool's own host
+func (n ProjectNotifications) Validate() error {
+	for i, channel := range n.Channels {
+		hosts, supported := notificationHosts[channel.Type]
+		if !supported {
+			return fmt.Errorf("channel %d: type must be %q or %q", i, NotificationChannelSlack, NotificationChannelDiscord)
+		}
+		u, err := url.ParseRequestURI(channel.Url)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("channel %d: url must be an absolute URL", i)
+		}
+		if u.Scheme != "https" {
+			return fmt.Errorf("channel %d: url must use https", i)
+		}
+		if isPrivateHost(u.Hostname(), isPublicAddress) {
+			return fmt.Errorf("channel %d: %w", i, ErrPrivateEndpoint)
+		}
+		if !slices.Contains(hosts, strings.ToLower(u.Hostname())) {
+			return fmt.Errorf("channel %d: %s urls must be on %s", i, channel.Type, strings.Join(hosts, " or "))
+		}
+		for _, event := range channel.Events {
+			if !slices.Contains(NotificationEvents, event) {
+				return fmt.Errorf("channel %d: unknown event %q", i, event)
+			}
+		}
+	}
+	return nil
+}
+
+func (c NotificationChannel) subscribed(event string) bool {
+	return len(c.Events) == 0 || slices.Contains(c.Events, event)
+}
+
+func (c NotificationChannel) bold() string {
+	if c.Type == NotificationChannelDiscord {
+		return "**"
+	}
+	return "*"
+}
+
+func (c NotificationChannel) payload(text string) any {
+	if c.Type == NotificationChannelDiscord {
+		return map[string]string{"content": text}
+	}
+	return map[string]string{"text": text}
+}
+
+// message renders an orchestration outcome for the channel's chat tool
+func (c NotificationChannel) message(project *Project, orchestration *Orchestration, event string, reason json.RawMessage) any {
+	bold := c.bold()
+
+	var text string
+	switch event {
+	case ProjectEventOrchestrationCompleted:
+		text = fmt.Sprintf("✅ %sOrchestration completed%s in project %s\n", bold, bold, project.Name)
+	default:
+		text = fmt.Sprintf("❌ %sOrchestration failed%s in project %s\n", bold, bold, project.Name)
+	}
+	text += fmt.Sprintf("ID: %s", orchestration.ID)
+	if orchestration.Action.Content != "" {
+		text += fmt.Sprintf("\nAction: %s", orchestration.Action.Content)
+	}
+	if reason := notificationReason(reason); reason != "" {
+		text += fmt.Sprintf("\nReason: %s", reason)
+	}
+	return c.payload(text)
+}
+
+// alertMessage renders an alert triggering or resolving for the channel's chat tool
+func (c NotificationChannel) alertMessage(project *Project, event string, alert Alert) any {
+	bold := c.bold()
+
+	var text string
+	switch event {
+	case ProjectEventAlertResolved:
+		text = fmt.Sprintf("✅ %sAlert resolved%s in project %s: %s\n", bold, bold, project.Name, alert.Rule)
+	default:
+		text = fmt.Sprintf("🚨 %sAlert triggered%s in project %s: %s\n", bold, bold, project.Name, alert.Rule)
+	}
+
+	switch alert.Metric {
+	case AlertMetricFailureRate:
+		text += fmt.Sprintf("Failure rate: %.0f%% over %s (threshold %.0f%%)", alert.Value*100, alert.Window, alert.Threshold*100)
+	case AlertMetricServiceDisconnected:
+		text += fmt.Sprintf("Service %s (%s) disconnected for over %s", alert.ServiceName, alert.ServiceID, alert.Window)
+	}
+	return c.payload(text)
+}
+
+func notificationReason(reason json.RawMessage) string {
+	if len(reason) == 0 || string(reason) == "null" {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(reason, &text); err == nil {
+		return text
+	}
+	return string(reason)
+}
+
+// notifyChannels announces an orchestration's outcome in the project's notification channels subscribed to it
+func (p *PlanEngine) notifyChannels(project *Project, orchestrationID, event string, reason json.RawMessage) {
+	if len(project.Notifications.Channels) == 0 {
+		return
+	}
+	orchestration, err := p.getOrchestration(orchestrationID)
+	if err != nil {
+		p.Logger.Warn().
+			Err(err).
+			Str("OrchestrationID", orchestrationID).
+			Msg("Failed to load orchestration for notification channels")
+		return
+	}
+
+	for _, channel := range project.Notifications.Channels {
+		if !channel.subscribed(event) {
+			continue
+		}
+		err := p.postNotification(channel.Url, channel.message(project, orchestration, event, reason))
+		p.Metrics.ObserveNotificationPost(channel.Type, err == nil)
+		if err != nil {
+			p.Logger.Warn().
+				Err(err).
+				Str("ProjectID", project.ID).
+				Str("OrchestrationID", orchestrationID).
+				Str("Channel", channel.Type).
+				Msg("Failed to post orchestration notification")
+		}
+	}
+}
+
+// postNotification sends a message to a channel's incoming webhook, through the client webhooks are sent with so
+// it only ever reaches the addresses they may
+func (p *PlanEngine) postNotification(channelUrl string, message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notificationPostTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channelUrl, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// UpdateProjectNotifications replaces a project's notification channels
+func (p *PlanEngine) UpdateProjectNotifications(projectID string, notifications ProjectNotifications) error {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Notifications = notifications
+	return p.updateProject(updated)
+}
+
+// UpdateProjectNotifications replaces the caller's project notification channels
+func (app *App) UpdateProjectNotifications(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProjectFor(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	var notifications ProjectNotifications
+	if err := decodeRequest(w, r, &notifications, projectNotificationsFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if err := notifications.Validate(); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("channels"), err))
+		return
+	}
+
+	if notifications.Channels == nil {
+		notifications.Channels = make([]NotificationChannel, 0)
+	}
+
+	if err := app.Engine.UpdateProjectNotifications(project.ID, notifications); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(NotificationsUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(notifications); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
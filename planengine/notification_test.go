@@ -0,0 +1,104 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationChannels(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+
+	received := make(chan map[string]string, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		received <- map[string]string{"path": r.URL.Path, "text": message["text"], "content": message["content"]}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/projects/"+project.ID+"/notifications", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	messages := func() map[string]map[string]string {
+		t.Helper()
+		byPath := map[string]map[string]string{}
+		for {
+			select {
+			case message := <-received:
+				byPath[message["path"]] = message
+			case <-time.After(200 * time.Millisecond):
+				return byPath
+			}
+		}
+	}
+
+	w := update(`{"channels":[
+		{"type":"slack","url":"https://hooks.slack.com/services/T000/B000/XXXX"},
+		{"type":"discord","url":"https://discord.com/api/webhooks/1/abc","events":["orchestration.failed"]}
+	]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, app.Engine.projects[project.ID].Notifications.Channels, 2)
+
+	// Deliver to the local receiver in place of the chat tools
+	channels := app.Engine.projects[project.ID].Notifications.Channels
+	channels[0].Url = receiver.URL + "/slack"
+	channels[1].Url = receiver.URL + "/discord"
+
+	orchestration := &Orchestration{ID: "o_notify", ProjectID: project.ID, Action: Action{Content: "Refund order 42"}}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+
+	app.Engine.notifyOrchestrationFinished(project.ID, orchestration.ID, Completed, nil)
+	sent := messages()
+	require.Len(t, sent, 1, "the discord channel only subscribed to failures")
+	assert.Contains(t, sent["/slack"]["text"], "*Orchestration completed*")
+	assert.Contains(t, sent["/slack"]["text"], "Refund order 42")
+
+	app.Engine.notifyOrchestrationFinished(project.ID, orchestration.ID, Failed, json.RawMessage(`"payment service unavailable"`))
+	sent = messages()
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent["/slack"]["text"], "Reason: payment service unavailable")
+	assert.Contains(t, sent["/discord"]["content"], "**Orchestration failed**")
+	assert.Contains(t, sent["/discord"]["content"], "ID: o_notify")
+
+	t.Run("rejects invalid channels", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"teams","url":"https://hooks.slack.com/services/T000/B000/XXXX"}]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"slack","url":"not a url"}]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"slack","url":"http://hooks.slack.com/services/T000/B000/XXXX"}]}`).Code, "urls must use https")
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"slack","url":"https://discord.com/api/webhooks/1/abc"}]}`).Code, "urls must be on the tool's host")
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"slack","url":"https://hooks.slack.com/services/T000/B000/XXXX","events":["task.failed"]}]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, update(`{"chanels":[]}`).Code, "unknown fields are rejected")
+	})
+
+	t.Run("refuses loopback channels", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"slack","url":"https://127.0.0.1/services/T000/B000/XXXX"}]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, update(`{"channels":[{"type":"discord","url":"https://localhost/api/webhooks/1/abc"}]}`).Code)
+
+		app.Engine.allowPrivateWebhooks = false
+		defer func() { app.Engine.allowPrivateWebhooks = true }()
+		// Connections already open were checked when they were dialled
+		app.Engine.webhookClient.CloseIdleConnections()
+		err := app.Engine.postNotification(receiver.URL+"/slack", map[string]string{"text": "hello"})
+		assert.ErrorContains(t, err, ErrPrivateEndpoint.Error())
+		assert.Empty(t, messages())
+	})
+}
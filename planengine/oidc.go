@@ -0,0 +1,305 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcClockSkew        = time.Minute
+	oidcMinKeysRefresh   = 30 * time.Second
+	oidcDiscoveryPath    = "/.well-known/openid-configuration"
+	oidcHTTPTimeout      = 10 * time.Second
+	oidcMaxResponseBytes = 1 << 20
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrIDTokenExpired = errors.New("ID token has expired")
+)
+
+// UserClaims identifies a human user authenticated through the OIDC provider
+type UserClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+type idTokenClaims struct {
+	UserClaims
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+}
+
+func (c idTokenClaims) audiences() []string {
+	var single string
+	if err := json.Unmarshal(c.Audience, &single); err == nil {
+		return []string{single}
+	}
+	var many []string
+	_ = json.Unmarshal(c.Audience, &many)
+	return many
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDCVerifier validates ID tokens issued by the configured OIDC provider
+type OIDCVerifier struct {
+	issuer      string
+	clientID    string
+	client      *http.Client
+	mu          sync.RWMutex
+	jwksURI     string
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+	now         func() time.Time
+}
+
+func NewOIDCVerifier(cfg OIDC) *OIDCVerifier {
+	return &OIDCVerifier{
+		issuer:   strings.TrimSuffix(cfg.IssuerURL, "/"),
+		clientID: cfg.ClientID,
+		client:   &http.Client{Timeout: oidcHTTPTimeout},
+		keys:     make(map[string]crypto.PublicKey),
+		now:      time.Now,
+	}
+}
+
+// looksLikeJWT distinguishes ID tokens from API keys presented as bearer tokens
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// Verify checks an ID token's signature, issuer, audience and lifetime
+func (v *OIDCVerifier) Verify(ctx context.Context, rawToken string) (*UserClaims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	key, err := v.publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	var claims idTokenClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != v.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !contains(claims.audiences(), v.clientID) {
+		return nil, fmt.Errorf("%w: token was not issued for this client", ErrInvalidIDToken)
+	}
+
+	now := v.now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)) {
+		return nil, ErrIDTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(oidcClockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return &claims.UserClaims, nil
+}
+
+func (v *OIDCVerifier) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// Unknown key IDs usually mean the provider rotated its keys
+	if err := v.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %s", ErrInvalidIDToken, kid)
+}
+
+func (v *OIDCVerifier) refreshKeys(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.now().Sub(v.lastRefresh) < oidcMinKeysRefresh {
+		return nil
+	}
+	v.lastRefresh = v.now()
+
+	if v.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, v.issuer+oidcDiscoveryPath, &discovery); err != nil {
+			return fmt.Errorf("failed to discover OIDC provider: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return fmt.Errorf("OIDC provider %s does not publish a jwks_uri", v.issuer)
+		}
+		v.jwksURI = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	v.keys = keys
+
+	return nil
+}
+
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(http.MaxBytesReader(nil, resp.Body, oidcMaxResponseBytes)).Decode(out)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature)
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+}
+
+func decodeJWTSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
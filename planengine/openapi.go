@@ -0,0 +1,466 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	OpenAPIVersion  = "3.0.3"
+	openAPIPath     = "/openapi.json"
+	openAPIDocsPath = "/docs"
+	swaggerUIPath   = "/docs/swagger-ui/"
+)
+
+// apiOperation documents an API route. Routes are read from the router when the specification is generated, so
+// what's served and what's documented can't drift apart, operations only add what the router can't tell.
+type apiOperation struct {
+	Summary string
+	// Request and Response are zero values of the JSON bodies, their schemas are derived from the Go types
+	Request  any
+	Response any
+	// Status is the success status, http.StatusOK when left out
+	Status int
+	// ContentType of the success response, application/json when left out
+	ContentType string
+	Query       []string
+}
+
+// oneOf documents a body that takes one of several shapes
+type oneOf []any
+
+var apiOperations = map[string]apiOperation{
+	"POST /register/project":                                {Summary: "Register a project", Request: Project{}, Status: http.StatusCreated},
+	"POST /apikeys":                                         {Summary: "Create an additional project API key", Request: apiKeyRequest{}, Status: http.StatusCreated},
+	"POST /webhooks":                                        {Summary: "Add a project webhook", Request: webhookRequest{}, Response: ProjectWebhook{}, Status: http.StatusCreated},
+	"GET /webhooks":                                         {Summary: "List project webhooks", Response: []ProjectWebhook{}},
+	"GET /webhooks/dead-letters":                            {Summary: "List webhook deliveries that exhausted their retries", Response: []WebhookDeadLetter{}},
+	"DELETE /webhooks/dead-letters/{id}":                    {Summary: "Purge a webhook dead letter", Status: http.StatusNoContent},
+	"POST /webhooks/dead-letters/{id}/redrive":              {Summary: "Redeliver a webhook dead letter", Status: http.StatusNoContent},
+	"PATCH /webhooks/{id}":                                  {Summary: "Update a project webhook", Request: ProjectWebhookUpdate{}, Response: ProjectWebhook{}},
+	"DELETE /webhooks/{id}":                                 {Summary: "Remove a project webhook", Status: http.StatusNoContent},
+	"GET /webhooks/{id}/deliveries":                         {Summary: "List a webhook's recent deliveries", Response: []WebhookDelivery{}, Query: []string{"limit"}},
+	"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver": {Summary: "Redeliver a webhook delivery", Response: WebhookDelivery{}},
+	"POST /webhooks/{id}/test":                              {Summary: "Send a test event to a webhook", Response: WebhookDelivery{}},
+	"POST /webhooks/{id}/rotate-secret":                     {Summary: "Rotate a webhook's signing secret", Request: secretRotationRequest{}, Response: ProjectWebhookSecret{}},
+	"POST /register/service":                                {Summary: "Register a service, or update the service registered under its name", Request: ServiceInfo{}, Response: ServiceRegistrationResponse{}},
+	"PUT /register/service":                                 {Summary: "Register a service, or update the service registered under its name", Request: ServiceInfo{}, Response: ServiceRegistrationResponse{}},
+	"POST /register/agent":                                  {Summary: "Register an agent, or update the agent registered under its name", Request: ServiceInfo{}, Response: ServiceRegistrationResponse{}},
+	"PUT /register/agent":                                   {Summary: "Register an agent, or update the agent registered under its name", Request: ServiceInfo{}, Response: ServiceRegistrationResponse{}},
+	"POST /orchestrations":                                  {Summary: "Submit an orchestration, defined in full or from a template", Request: oneOf{Orchestration{}, templatedOrchestrationRequest{}}, Response: Orchestration{}, Status: http.StatusAccepted},
+	"GET /orchestrations":                                   {Summary: "List orchestrations", Response: OrchestrationListView{}, Query: []string{"status", "label", "from", "to", "q", "sort", "limit", "cursor"}},
+	"POST /orchestrations/batch":                            {Summary: "Submit several orchestrations", Request: batchOrchestrationRequest{}, Response: BatchOrchestrationResponse{}},
+	"POST /orchestrations/status":                           {Summary: "Look up the statuses of several orchestrations", Request: orchestrationStatusRequest{}, Response: OrchestrationStatusResponse{}},
+	"GET /orchestrations/search":                            {Summary: "Search orchestrations by their action, labels, error and results", Response: OrchestrationSearchResponse{}, Query: []string{"q", "limit"}},
+	"GET /orchestrations/export":                            {Summary: "Export orchestrations as newline delimited JSON, one orchestration per line", Response: ExportedOrchestration{}, ContentType: NDJSONContentType, Query: []string{"status", "label", "from", "to", "q", "limit", "cursor"}},
+	"DELETE /orchestrations/{id}":                           {Summary: "Delete an orchestration and its records", Status: http.StatusNoContent, Query: []string{"force"}},
+	"POST /orchestrations/{id}/cancel":                      {Summary: "Cancel an orchestration", Request: cancelRequest{}},
+	"POST /orchestrations/{id}/pause":                       {Summary: "Pause an orchestration"},
+	"POST /orchestrations/{id}/resume":                      {Summary: "Resume a paused orchestration"},
+	"POST /orchestrations/{id}/retry":                       {Summary: "Retry a failed orchestration", Response: Orchestration{}, Status: http.StatusAccepted},
+	"POST /orchestrations/{id}/clone":                       {Summary: "Run a copy of an orchestration", Response: Orchestration{}, Status: http.StatusAccepted},
+	"POST /orchestrations/{id}/approvals/{stepId}":          {Summary: "Approve or reject an approval step", Request: approvalRequest{}},
+	"GET /orchestrations/inspections/{id}":                  {Summary: "Inspect an orchestration's tasks", Response: OrchestrationInspectResponse{}, Query: []string{"fields"}},
+	"GET /orchestrations/{id}/timeline":                     {Summary: "Show an orchestration's timeline", Response: OrchestrationTimeline{}},
+	"GET /orchestrations/{id}/logs":                         {Summary: "List an orchestration's task logs", Response: []TaskLog{}, Query: []string{"task", "level", "limit"}},
+	"GET /orchestrations/{id}/graph":                        {Summary: "Render an orchestration's task graph as Mermaid, DOT or JSON", ContentType: "text/plain", Query: []string{"format"}},
+	"GET /orchestrations/{id}/events":                       {Summary: "Stream an orchestration's events", ContentType: "text/event-stream"},
+	"GET /dead-letters":                                     {Summary: "List dead-lettered orchestrations", Response: []DeadLetter{}},
+	"DELETE /dead-letters":                                  {Summary: "Purge all dead letters", Status: http.StatusNoContent},
+	"GET /dead-letters/{id}":                                {Summary: "Inspect a dead letter", Response: DeadLetter{}},
+	"DELETE /dead-letters/{id}":                             {Summary: "Purge a dead letter", Status: http.StatusNoContent},
+	"POST /dead-letters/{id}/redrive":                       {Summary: "Rerun a dead-lettered orchestration", Response: Orchestration{}, Status: http.StatusAccepted},
+	"POST /templates":                                       {Summary: "Create an orchestration template", Request: templateRequest{}, Response: NamedTemplate{}, Status: http.StatusCreated},
+	"GET /templates":                                        {Summary: "List orchestration templates", Response: []NamedTemplate{}},
+	"GET /templates/{name}":                                 {Summary: "Get an orchestration template", Response: NamedTemplate{}},
+	"PUT /templates/{name}":                                 {Summary: "Replace an orchestration template", Request: templateRequest{}, Response: NamedTemplate{}},
+	"DELETE /templates/{name}":                              {Summary: "Delete an orchestration template", Status: http.StatusNoContent},
+	"POST /schedules":                                       {Summary: "Schedule an orchestration", Request: scheduleRequest{}, Response: Schedule{}},
+	"GET /schedules":                                        {Summary: "List schedules", Response: []Schedule{}},
+	"POST /schedules/{id}/pause":                            {Summary: "Pause a schedule", Response: Schedule{}},
+	"POST /schedules/{id}/resume":                           {Summary: "Resume a schedule", Response: Schedule{}},
+	"DELETE /schedules/{id}":                                {Summary: "Delete a schedule", Status: http.StatusNoContent},
+	"GET /ws":                                               {Summary: "Connect a service over WebSocket", Status: http.StatusSwitchingProtocols, Query: []string{"serviceId", WSInstanceQueryParam, WSEncodingQueryParam, WSMaxMessageQueryParam, WSProtocolVersionQueryParam, WSResumeQueryParam}},
+	"GET /services":                                         {Summary: "List registered services", Response: []ServiceView{}},
+	"GET /services/health":                                  {Summary: "Score the health of the project's services", Response: ServiceHealthScoreboard{}, Query: []string{"window"}},
+	"GET /services/discover":                                {Summary: "Discover services by capability", Response: ServiceDiscoveryResponse{}, Query: []string{"capability"}},
+	"GET /services/{id}":                                    {Summary: "Get a registered service", Response: ServiceView{}},
+	"DELETE /services/{id}":                                 {Summary: "Deregister a service", Status: http.StatusNoContent},
+	"GET /services/{id}/versions":                           {Summary: "List a service's recent versions", Response: ServiceVersionHistory{}},
+	"GET /services/{id}/versions/{version}":                 {Summary: "Get one of a service's recent versions", Response: ServiceRevision{}},
+	"POST /services/{id}/callback":                          {Summary: "Send a callback service's messages", Status: http.StatusAccepted},
+	"GET /services/{id}/tasks":                              {Summary: "Long-poll for a service's tasks", Query: []string{"wait", WSInstanceQueryParam}},
+	"POST /services/{id}/results":                           {Summary: "Send a polling service's messages", Status: http.StatusAccepted},
+	"GET /services/{id}/queues":                             {Summary: "Report on a service's send queues", Response: ServiceQueues{}},
+	"POST /services/{id}/drain":                             {Summary: "Drain a service", Request: drainRequest{}, Response: ServiceDrain{}, Status: http.StatusAccepted},
+	"POST /auth/ws-token":                                   {Summary: "Issue a WebSocket connection token", Request: wsTokenRequest{}, Response: WSToken{}, Status: http.StatusCreated},
+	"POST /certificates":                                    {Summary: "Issue a client certificate", Request: certificateRequest{}, Response: ClientCertificate{}, Status: http.StatusCreated},
+	"POST /groundings":                                      {Summary: "Apply a grounding", Request: GroundingSpec{}, Response: GroundingSpec{}, Status: http.StatusCreated},
+	"GET /groundings":                                       {Summary: "List groundings", Response: []GroundingSpec{}},
+	"DELETE /groundings":                                    {Summary: "Remove all groundings", Status: http.StatusNoContent},
+	"DELETE /groundings/{name}":                             {Summary: "Remove a grounding", Status: http.StatusNoContent},
+	"GET /audit":                                            {Summary: "List audit events", Response: []AuditEvent{}, Query: []string{"action", "since", "until", "limit"}},
+	"PATCH /projects":                                       {Summary: "Rename a project or change its settings", Request: ProjectUpdate{}},
+	"DELETE /projects":                                      {Summary: "Delete a project", Status: http.StatusNoContent},
+	"POST /projects/members":                                {Summary: "Add a project member", Request: ProjectMember{}, Response: ProjectMember{}, Status: http.StatusCreated},
+	"GET /projects/members":                                 {Summary: "List project members", Response: []ProjectMember{}},
+	"DELETE /projects/members/{member}":                     {Summary: "Remove a project member", Status: http.StatusNoContent},
+	"PATCH /projects/{id}/security":                         {Summary: "Change a project's network allowlist or registration rules", Request: ProjectSecurityUpdate{}, Response: ProjectSecurity{}},
+	"PATCH /projects/{id}/limits":                           {Summary: "Replace a project's limits", Request: ProjectLimits{}, Response: ProjectLimits{}},
+	"PATCH /projects/{id}/notifications":                    {Summary: "Replace a project's notification channels", Request: ProjectNotifications{}, Response: ProjectNotifications{}},
+	"GET /projects/{id}/alerts":                             {Summary: "List a project's alert rules and firing alerts", Response: ProjectAlertsView{}},
+	"PATCH /projects/{id}/alerts":                           {Summary: "Replace a project's alert rules", Request: ProjectAlerts{}, Response: ProjectAlerts{}},
+	"GET /projects/{id}/usage":                              {Summary: "Report a project's usage", Response: ProjectUsage{}, Query: []string{"from", "to"}},
+	"POST /registration-tokens":                             {Summary: "Mint a service registration token", Request: registrationTokenRequest{}, Status: http.StatusCreated},
+	"GET /users/me":                                         {Summary: "Show the caller and their project memberships"},
+	"GET /overview":                                         {Summary: "Summarise a project's recent activity", Response: ProjectOverview{}, Query: []string{"window"}},
+	"GET /admin/projects":                                   {Summary: "List all projects, with what each holds and when it was last active", Response: []AdminProjectSummary{}},
+	"GET /admin/projects/{id}":                              {Summary: "Inspect any project", Response: AdminProjectDetail{}},
+	"POST /admin/orchestrations/{id}/fail":                  {Summary: "Force an orchestration in any project to fail", Request: adminFailRequest{}},
+	"GET /admin/debug/stats":                                {Summary: "Report runtime and engine statistics", Response: DiagnosticStats{}},
+	"GET /admin/debug/goroutines":                           {Summary: "Dump goroutine stacks", ContentType: "text/plain"},
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// OpenAPISpec generates an OpenAPI 3 specification of the versioned API from the router's routes
+func (app *App) OpenAPISpec() (map[string]any, error) {
+	schemas := newOpenAPISchemas()
+	paths := map[string]map[string]any{}
+
+	err := app.Router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path, ok := strings.CutPrefix(template, APIVersionPrefix)
+		if !ok {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+
+		for _, method := range methods {
+			key := method + " " + path
+			operation, ok := apiOperations[key]
+			if !ok {
+				return fmt.Errorf("route %s is not documented", key)
+			}
+			if paths[path] == nil {
+				paths[path] = map[string]any{}
+			}
+			paths[path][strings.ToLower(method)] = schemas.operation(method, path, operation)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"openapi": OpenAPIVersion,
+		"info": map[string]any{
+			"title":   "Orra Plan Engine API",
+			"version": CurrentAPIVersion,
+		},
+		"servers": []map[string]any{{"url": APIVersionPrefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []map[string][]string{{"apiKey": {}}},
+	}, nil
+}
+
+type openAPISchemas struct {
+	components map[string]any
+}
+
+func newOpenAPISchemas() *openAPISchemas {
+	return &openAPISchemas{components: map[string]any{}}
+}
+
+func (s *openAPISchemas) operation(method, path string, operation apiOperation) map[string]any {
+	tag, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	spec := map[string]any{
+		"summary":     operation.Summary,
+		"operationId": operationID(method, path),
+		"tags":        []string{tag},
+	}
+
+	var parameters []map[string]any
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		parameters = append(parameters, map[string]any{"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+	}
+	for _, name := range operation.Query {
+		parameters = append(parameters, map[string]any{"name": name, "in": "query", "schema": map[string]any{"type": "string"}})
+	}
+	if len(parameters) > 0 {
+		spec["parameters"] = parameters
+	}
+	if path == "/register/project" {
+		spec["security"] = []map[string][]string{}
+	}
+
+	if operation.Request != nil {
+		schema := map[string]any{}
+		if shapes, ok := operation.Request.(oneOf); ok {
+			var options []map[string]any
+			for _, shape := range shapes {
+				options = append(options, s.schema(reflect.TypeOf(shape)))
+			}
+			schema["oneOf"] = options
+		} else {
+			schema = s.schema(reflect.TypeOf(operation.Request))
+		}
+		spec["requestBody"] = map[string]any{
+			"content": map[string]any{"application/json": map[string]any{"schema": schema}},
+		}
+	}
+
+	status := operation.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := map[string]any{"description": http.StatusText(status)}
+	if status != http.StatusNoContent && status != http.StatusSwitchingProtocols {
+		contentType := operation.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		schema := map[string]any{"type": "object"}
+		if operation.Response != nil {
+			schema = s.schema(reflect.TypeOf(operation.Response))
+		} else if contentType != "application/json" {
+			schema = map[string]any{"type": "string"}
+		}
+		response["content"] = map[string]any{contentType: map[string]any{"schema": schema}}
+	}
+	// Errors are problem details, their code tells clients what went wrong
+	responses := map[string]any{
+		fmt.Sprint(status): response,
+		"400":              s.problemResponse("The request is invalid or refers to something that doesn't exist"),
+		"default":          s.problemResponse("Unexpected error"),
+	}
+	if _, public := spec["security"]; !public {
+		responses["401"] = s.problemResponse("The credentials are missing or invalid")
+		responses["403"] = s.problemResponse("The credentials don't grant access to the operation")
+	}
+	spec["responses"] = responses
+	return spec
+}
+
+func (s *openAPISchemas) problemResponse(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{ProblemContentType: map[string]any{"schema": s.schema(reflect.TypeOf(Problem{}))}},
+	}
+}
+
+// operationID names an operation for generated clients, e.g. GET /orchestrations/{id}/logs is getOrchestrationsIdLogs
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == ':'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	durationType    = reflect.TypeOf(Duration{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schema derives a JSON schema from a Go type the way encoding/json would marshal it. Named structs are kept as
+// components so recursive types resolve.
+func (s *openAPISchemas) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]any{"type": "string", "example": "30s"}
+	case t == rawMessageType:
+		return map[string]any{}
+	case t.Implements(jsonMarshalType) || reflect.PointerTo(t).Implements(jsonMarshalType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := s.components[name]; !ok {
+			// Placeholder so recursive types refer back to the component being built
+			s.components[name] = map[string]any{}
+			s.components[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (s *openAPISchemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	s.addProperties(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (s *openAPISchemas) addProperties(t reflect.Type, properties map[string]any) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		// Embedded structs without a JSON name have their fields promoted, as encoding/json does
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct && fieldType != durationType && fieldType != timeType {
+			s.addProperties(fieldType, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		switch fieldType.Kind() {
+		case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+}
+
+// OpenAPIHandler serves the generated OpenAPI specification
+func (app *App) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := app.OpenAPISpec()
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(spec); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+const swaggerUIScript = `window.ui = SwaggerUIBundle({ url: "` + openAPIPath + `", dom_id: "#swagger-ui" });`
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Orra Plan Engine API</title>
+  <link rel="stylesheet" href="` + swaggerUIPath + `swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + swaggerUIPath + `swagger-ui-bundle.js"></script>
+  <script>` + swaggerUIScript + `</script>
+</body>
+</html>
+`
+
+const swaggerUIMissingPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Orra Plan Engine API</title>
+</head>
+<body>
+  <p>Swagger UI isn't installed, set DOCS_SWAGGER_UI_DIR to a copy of the swagger-ui-dist package to browse the API here.</p>
+  <p>The API's OpenAPI specification is at <a href="` + openAPIPath + `">` + openAPIPath + `</a>.</p>
+</body>
+</html>
+`
+
+// swaggerUICSP only lets Swagger UI load the plan engine's own copy of its assets, and run its own inline script
+var swaggerUICSP = func() string {
+	sum := sha256.Sum256([]byte(swaggerUIScript))
+	return fmt.Sprintf("default-src 'self'; script-src 'self' 'sha256-%s'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'",
+		base64.StdEncoding.EncodeToString(sum[:]))
+}()
+
+// OpenAPIDocsHandler serves Swagger UI for browsing and trying out the API. Its assets are served from the
+// operator's copy of swagger-ui-dist, so no third party scripts are loaded.
+func (app *App) OpenAPIDocsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", swaggerUICSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if app.Cfg.Docs.SwaggerUIDir == "" {
+		_, _ = w.Write([]byte(swaggerUIMissingPage))
+		return
+	}
+	_, _ = w.Write([]byte(swaggerUIPage))
+}
+
+// SwaggerUIHandler serves Swagger UI's assets from the configured copy of swagger-ui-dist
+func (app *App) SwaggerUIHandler() http.Handler {
+	files := http.StripPrefix(swaggerUIPath, http.FileServer(http.FS(os.DirFS(app.Cfg.Docs.SwaggerUIDir))))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, openAPIPath, nil)
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Servers    []struct{ URL string }               `json:"servers"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&spec))
+	assert.Equal(t, OpenAPIVersion, spec.OpenAPI)
+	require.Len(t, spec.Servers, 1)
+	assert.Equal(t, APIVersionPrefix, spec.Servers[0].URL)
+
+	t.Run("documents every routed operation", func(t *testing.T) {
+		for key := range apiOperations {
+			method, path, _ := strings.Cut(key, " ")
+			assert.Contains(t, spec.Paths[path], strings.ToLower(method), "%s is documented but not routed", key)
+		}
+	})
+
+	t.Run("derives schemas from the handlers' types", func(t *testing.T) {
+		submit := spec.Paths["/orchestrations"]["post"]
+		assert.Equal(t, "postOrchestrations", submit["operationId"])
+		assert.Contains(t, submit["responses"], "202")
+
+		orchestration := spec.Components.Schemas["Orchestration"]
+		assert.Equal(t, "string", orchestration.Properties["status"]["type"])
+		assert.Equal(t, "date-time", orchestration.Properties["timestamp"]["format"])
+		assert.Equal(t, "#/components/schemas/Action", orchestration.Properties["action"]["$ref"])
+
+		errors, ok := submit["responses"].(map[string]any)["400"].(map[string]any)
+		require.True(t, ok)
+		assert.Contains(t, errors["content"], ProblemContentType)
+		assert.Contains(t, spec.Components.Schemas["Problem"].Properties, "code")
+
+		service := spec.Components.Schemas["ServiceView"]
+		assert.Contains(t, service.Properties, "connected")
+		assert.Contains(t, service.Properties, "schema", "embedded structs have their fields promoted")
+		assert.NotContains(t, service.Properties, "IdempotencyStore")
+
+		logs := spec.Paths["/orchestrations/{id}/logs"]["get"]
+		parameters, ok := logs["parameters"].([]any)
+		require.True(t, ok)
+		assert.Equal(t, "id", parameters[0].(map[string]any)["name"])
+	})
+
+	t.Run("serves Swagger UI", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, openAPIDocsPath, nil)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), openAPIPath)
+		assert.NotContains(t, w.Body.String(), "<script", "Swagger UI isn't loaded until it's installed")
+	})
+
+	t.Run("serves the installed copy of Swagger UI", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "swagger-ui-bundle.js"), []byte("var SwaggerUIBundle;"), 0o644))
+		app.Cfg.Docs.SwaggerUIDir = dir
+		defer func() { app.Cfg.Docs.SwaggerUIDir = "" }()
+		app.Router.PathPrefix(swaggerUIPath).Handler(app.SwaggerUIHandler())
+
+		req := httptest.NewRequest(http.MethodGet, openAPIDocsPath, nil)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), swaggerUIPath+"swagger-ui-bundle.js")
+		assert.NotContains(t, w.Body.String(), "https://", "no third party assets are loaded")
+		assert.Contains(t, w.Header().Get("Content-Security-Policy"), "script-src 'self' 'sha256-")
+
+		req = httptest.NewRequest(http.MethodGet, swaggerUIPath+"swagger-ui-bundle.js", nil)
+		w = httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "var SwaggerUIBundle;", w.Body.String())
+	})
+}
+
+func TestOpenAPISpecRejectsUndocumentedRoutes(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.Router.HandleFunc(APIVersionPrefix+"/undocumented", app.OpenAPIHandler).Methods(http.MethodGet)
+	_, err := app.OpenAPISpec()
+	assert.ErrorContains(t, err, "GET /undocumented")
+}
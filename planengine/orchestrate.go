@@ -7,13 +7,10 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"reflect"
 	"regexp"
@@ -46,6 +43,9 @@ func (p *PlanEngine) prepForError(orchestration *Orchestration, err error, statu
 	orchestration.Timestamp = time.Now().UTC()
 	marshaledErr, _ := json.Marshal(err.Error())
 	orchestration.Error = marshaledErr
+	if orchestration.DryRun {
+		return
+	}
 
 	if storeErr := p.orchestrationStorage.StoreOrchestration(orchestration); storeErr != nil {
 		p.Logger.Error().
@@ -78,24 +78,57 @@ func (p *PlanEngine) InjectGroundingMatchForAnyAppliedSpecs(ctx context.Context,
 	return nil
 }
 
+// PrepareOrchestration plans an orchestration, starting its trace. Orchestrations failing to be planned and dry
+// runs are only traced while they're planned.
 func (p *PlanEngine) PrepareOrchestration(ctx context.Context, projectID string, orchestration *Orchestration, specs []GroundingSpec) error {
-	// Initial setup and validation that shouldn't be retried
-	orchestration.ID = p.GenerateOrchestrationKey()
+	if orchestration.ID == "" {
+		orchestration.ID = p.GenerateOrchestrationKey()
+	}
+	orchestration.ProjectID = projectID
+	if len(orchestration.Lifecycle) == 0 {
+		p.recordLifecycle(orchestration, TimelineOrchestrationAccepted)
+	}
+	ctx = p.startOrchestrationTrace(ctx, orchestration)
+	ctx, span := tracer().Start(ctx, "orchestration.plan")
+
+	err := p.prepareOrchestration(ctx, projectID, orchestration, specs)
+	endSpan(span, err)
+	switch {
+	case err == nil:
+		p.recordLifecycle(orchestration, TimelineOrchestrationPlanned)
+	case orchestration.Status == Failed || orchestration.Status == NotActionable:
+		p.recordLifecycle(orchestration, orchestrationEventType(orchestration.Status))
+	}
+	if err != nil || orchestration.DryRun {
+		p.endOrchestrationTrace(orchestration.ID, orchestration.Status, orchestration.Error)
+	}
+	return err
+}
+
+func (p *PlanEngine) prepareOrchestration(ctx context.Context, projectID string, orchestration *Orchestration, specs []GroundingSpec) error {
+	// Initial setup and validation that shouldn't be retried, deferred orchestrations keep the ID they were accepted with
+	if orchestration.ID == "" {
+		orchestration.ID = p.GenerateOrchestrationKey()
+	}
 	orchestration.Status = Pending
 	orchestration.Timestamp = time.Now().UTC()
 	orchestration.ProjectID = projectID
 
-	p.orchestrationStoreMu.Lock()
-	p.orchestrationStore[orchestration.ID] = orchestration
-	p.orchestrationStoreMu.Unlock()
+	// Dry runs are only planned, so they're kept out of the store
+	if !orchestration.DryRun {
+		p.scheduleSLA(orchestration)
+		p.orchestrationStoreMu.Lock()
+		p.orchestrationStore[orchestration.ID] = orchestration
+		p.orchestrationStoreMu.Unlock()
 
-	// Persist to storage
-	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
-		p.Logger.Error().
-			Err(err).
-			Str("OrchestrationID", orchestration.ID).
-			Msg("Failed to persist orchestration")
-		return fmt.Errorf("failed to persist orchestration: %w", err)
+		// Persist to storage
+		if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+			p.Logger.Error().
+				Err(err).
+				Str("OrchestrationID", orchestration.ID).
+				Msg("Failed to persist orchestration")
+			return fmt.Errorf("failed to persist orchestration: %w", err)
+		}
 	}
 
 	// Non-retryable validations
@@ -105,7 +138,7 @@ func (p *PlanEngine) PrepareOrchestration(ctx context.Context, projectID string,
 		return err
 	}
 
-	if err := p.validateWebhook(orchestration.ProjectID, orchestration.Webhook); err != nil {
+	if err := p.validateOrchestrationWebhook(orchestration.ProjectID, orchestration); err != nil {
 		err = fmt.Errorf("invalid orchestration: %w", err)
 		p.prepForError(orchestration, err, Failed)
 		return err
@@ -118,6 +151,12 @@ func (p *PlanEngine) PrepareOrchestration(ctx context.Context, projectID string,
 		return err
 	}
 
+	if err := p.resolveServiceVersions(orchestration, services); err != nil {
+		err = fmt.Errorf("invalid orchestration: %w", err)
+		p.prepForError(orchestration, err, Failed)
+		return err
+	}
+
 	serviceDescriptions, err := p.serviceDescriptions(services)
 	if err != nil {
 		err = fmt.Errorf("failed to create service descriptions: %w", err)
@@ -132,6 +171,15 @@ func (p *PlanEngine) PrepareOrchestration(ctx context.Context, projectID string,
 		return err
 	}
 
+	// Supplied plans are executed as given, they're not decomposed or grounded
+	if len(orchestration.TaskGraph) > 0 {
+		if err := p.prepareTaskGraph(orchestration, services); err != nil {
+			p.prepForError(orchestration, err, NotActionable)
+			return err
+		}
+		return nil
+	}
+
 	if err := p.InjectGroundingMatchForAnyAppliedSpecs(ctx, orchestration, specs); err != nil {
 		p.prepForError(orchestration, err, Failed)
 		return err
@@ -291,26 +339,123 @@ func (p *PlanEngine) attemptRetryablePreparation(ctx context.Context, orchestrat
 		}
 	}
 
+	plan := composeExecutionPlan(onlyServicesCallingPlan, orchestration)
+	if err := validatePlanAgainstSchemas(plan, taskZero.Input, services); err != nil {
+		p.VectorCache.Remove(orchestration.ProjectID, cachedEntryID)
+		return PreparationError{Status: Failed, Err: fmt.Errorf("execution plan failed schema validation: %w", err)}
+	}
+
 	// Store the final plan
-	orchestration.Plan = onlyServicesCallingPlan
+	orchestration.Plan = plan
 	orchestration.TaskZero = taskZeroInput
 	return nil
 }
 
+// composeExecutionPlan applies the orchestration's fan-outs, branches, approvals and sub-orchestrations to its validated plan
+func composeExecutionPlan(plan *ExecutionPlan, orchestration *Orchestration) *ExecutionPlan {
+	return insertSubOrchestrationSteps(
+		insertApprovalSteps(
+			addBranchConditions(markFanOutTasks(plan, orchestration.FanOut), orchestration.Branches),
+			orchestration.Approvals,
+		),
+		orchestration.SubOrchestrations,
+	)
+}
+
+// DeferOrchestration accepts an orchestration that's only prepared and executed at its runAt time.
+// Its webhook and params are checked straight away so callers learn of mistakes while they're waiting.
+func (p *PlanEngine) DeferOrchestration(ctx context.Context, projectID string, orchestration *Orchestration) error {
+	if err := p.validateActionParams(orchestration.Params); err != nil {
+		return fmt.Errorf("invalid orchestration: %w", err)
+	}
+	if err := p.validateOrchestrationWebhook(projectID, orchestration); err != nil {
+		return fmt.Errorf("invalid orchestration: %w", err)
+	}
+
+	orchestration.ID = p.GenerateOrchestrationKey()
+	orchestration.Status = Scheduled
+	orchestration.Timestamp = time.Now().UTC()
+	orchestration.ProjectID = projectID
+	orchestration.recordLifecycle(orchestrationEventType(Scheduled))
+	p.scheduleSLA(orchestration)
+
+	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		return fmt.Errorf("failed to persist orchestration: %w", err)
+	}
+
+	p.orchestrationStoreMu.Lock()
+	p.orchestrationStore[orchestration.ID] = orchestration
+	p.orchestrationStoreMu.Unlock()
+
+	p.scheduleOrchestrationStart(ctx, orchestration)
+	return nil
+}
+
+func (p *PlanEngine) scheduleOrchestrationStart(ctx context.Context, orchestration *Orchestration) {
+	orchestrationID := orchestration.ID
+	time.AfterFunc(time.Until(*orchestration.RunAt), func() {
+		p.startDeferredOrchestration(ctx, orchestrationID)
+	})
+}
+
+func (p *PlanEngine) startDeferredOrchestration(ctx context.Context, orchestrationID string) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Deferred orchestrations may have been cancelled while they waited
+	p.orchestrationStoreMu.Lock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists || orchestration.Status != Scheduled {
+		p.orchestrationStoreMu.Unlock()
+		return
+	}
+	orchestration.Status = Pending
+	p.orchestrationStoreMu.Unlock()
+
+	if err := p.PrepareOrchestration(ctx, orchestration.ProjectID, orchestration, p.GetGroundingSpecs(orchestration.ProjectID)); err != nil {
+		p.Logger.Error().
+			Err(err).
+			Str("OrchestrationID", orchestrationID).
+			Str("Status", orchestration.Status.String()).
+			Msg("Deferred orchestration cannot be executed")
+
+		// Nobody is waiting on a response, so the failure is reported through the webhook
+		if err := p.triggerWebhook(orchestration); err != nil {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Failed to trigger webhook for deferred orchestration")
+		}
+		return
+	}
+
+	p.DispatchOrchestration(ctx, orchestration)
+}
+
 func (p *PlanEngine) ExecuteOrchestration(ctx context.Context, orchestration *Orchestration) {
 	p.Logger.Debug().Msgf("About to create Log for orchestration %s", orchestration.ID)
 	log := p.LogManager.PrepLogForOrchestration(orchestration.ProjectID, orchestration.ID, orchestration.Plan)
 
+	// Checked and started under one lock, so a cancellation can't land in between and be overwritten
+	p.orchestrationStoreMu.Lock()
+	if orchestration.Status == Cancelled {
+		p.orchestrationStoreMu.Unlock()
+		p.Logger.Debug().Msgf("Orchestration %s was cancelled before execution", orchestration.ID)
+		return
+	}
+	orchestration.recordLifecycle(TimelineOrchestrationStarted)
 	orchestration.Status = Processing
 	orchestration.Timestamp = time.Now().UTC()
+	snapshot := *orchestration
+	p.orchestrationStoreMu.Unlock()
 
-	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+	if err := p.orchestrationStorage.StoreOrchestration(&snapshot); err != nil {
 		p.Logger.Error().
 			Err(err).
 			Str("OrchestrationID", orchestration.ID).
 			Msg("Failed to persist orchestration")
 	}
 
+	retriedOutputs := p.retriedTaskOutputs(orchestration)
+
 	p.Logger.Debug().Msgf("About to create and start workers for orchestration %s", orchestration.ID)
 	p.createAndStartWorkers(
 		ctx,
@@ -318,7 +463,11 @@ func (p *PlanEngine) ExecuteOrchestration(ctx context.Context, orchestration *Or
 		orchestration.Plan,
 		orchestration.GetTimeout(),
 		orchestration.GetHealthCheckGracePeriod(),
+		orchestration.GetTaskExecutionTimeout(),
+		orchestration.RetryPolicy,
+		retriedOutputs,
 	)
+	p.scheduleOrchestrationTimeout(orchestration)
 
 	initialEntry := NewLogEntry("task_output", TaskZero, orchestration.TaskZero, "control-panel", 0)
 	log.Append(orchestration.ID, initialEntry, true)
@@ -327,6 +476,8 @@ func (p *PlanEngine) ExecuteOrchestration(ctx context.Context, orchestration *Or
 		Str("OrchestrationID", orchestration.ID).
 		Interface("InitialEntry", initialEntry).
 		Msg("Appended initial entry to Log")
+
+	p.seedRetriedTaskOutputs(orchestration.ID, retriedOutputs)
 }
 
 func (p *PlanEngine) FinalizeOrchestration(
@@ -344,10 +495,15 @@ func (p *PlanEngine) FinalizeOrchestration(
 		return fmt.Errorf("plan engine cannot finalize missing orchestration %s", orchestrationID)
 	}
 
+	previous := orchestration.Status
+	if previous != status {
+		orchestration.recordLifecycle(orchestrationEventType(status))
+	}
 	orchestration.Status = status
 	orchestration.Timestamp = time.Now().UTC()
 	orchestration.Error = reason
 	orchestration.Results = results
+	p.releaseOrchestrationSlotLocked(orchestrationID)
 
 	// Persist updated state
 	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
@@ -358,6 +514,16 @@ func (p *PlanEngine) FinalizeOrchestration(
 		return fmt.Errorf("failed to persist orchestration state: %w", err)
 	}
 
+	if previous != status {
+		p.Metrics.ObserveOrchestration(status)
+		p.endOrchestrationTrace(orchestration.ID, status, reason)
+	}
+
+	// Finalizing is retried when the webhook can't be reached, the project is only told once
+	if previous != status && orchestration.ParentID == "" {
+		p.notifyInBackground(func() { p.notifyOrchestrationFinished(orchestration.ProjectID, orchestration.ID, status, reason) })
+	}
+
 	p.Logger.Debug().
 		Str("OrchestrationID", orchestration.ID).
 		Msgf("About to FinalizeOrchestration with status: %s", orchestration.Status.String())
@@ -369,6 +535,9 @@ func (p *PlanEngine) FinalizeOrchestration(
 	}
 
 	p.cleanupLogWorkers(orchestration.ID)
+	if p.WebSocketManager != nil {
+		p.WebSocketManager.releaseAffinities(orchestration.ID)
+	}
 
 	return nil
 }
@@ -382,9 +551,11 @@ func (p *PlanEngine) CancelOrchestration(orchestrationID string, reason json.Raw
 		return fmt.Errorf("plan engine cannot cancel missing orchestration %s", orchestrationID)
 	}
 
+	orchestration.recordLifecycle(orchestrationEventType(Cancelled))
 	orchestration.Status = Cancelled
 	orchestration.Timestamp = time.Now().UTC()
 	orchestration.Error = reason
+	p.releaseOrchestrationSlotLocked(orchestrationID)
 
 	// Persist updated state
 	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
@@ -398,6 +569,59 @@ func (p *PlanEngine) CancelOrchestration(orchestrationID string, reason json.Raw
 	return nil
 }
 
+// ForceFailOrchestration fails an unfinished orchestration on an operator's behalf, notifying its webhook
+// and compensating any completed tasks as a task failure would.
+func (p *PlanEngine) ForceFailOrchestration(orchestrationID string, reason string) (*Orchestration, error) {
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	var status Status
+	if exists {
+		status = orchestration.Status
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if !exists {
+		return nil, ErrOrchestrationNotFound
+	}
+
+	if orchestrationFinished(status) {
+		return nil, fmt.Errorf("%w with status %s", ErrOrchestrationFinished, status.String())
+	}
+
+	if err := p.failOrchestration(orchestrationID, reason); err != nil {
+		return nil, err
+	}
+
+	p.Logger.Info().
+		Str("OrchestrationID", orchestrationID).
+		Str("ProjectID", orchestration.ProjectID).
+		Str("Reason", reason).
+		Msg("Orchestration failed by administrator")
+
+	return orchestration, nil
+}
+
+// failOrchestration fails an unfinished orchestration for a reason outside its tasks, notifying its webhook and
+// compensating any completed tasks as a task failure would
+func (p *PlanEngine) failOrchestration(orchestrationID string, reason string) error {
+	payload, err := json.Marshal(struct {
+		OrchestrationID string `json:"orchestration"`
+		Error           string `json:"error"`
+	}{
+		OrchestrationID: orchestrationID,
+		Error:           reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal failure reason: %w", err)
+	}
+
+	// Orchestrations that haven't started executing have no log, or completed tasks to compensate
+	if p.LogManager.GetLog(orchestrationID) == nil {
+		return p.FinalizeOrchestration(orchestrationID, Failed, payload, nil, false)
+	}
+	p.LogManager.MarkOrchestrationFailed(orchestrationID, reason)
+	return p.LogManager.FinalizeOrchestration(orchestrationID, Failed, payload, nil, false)
+}
+
 func (p *PlanEngine) CancelAnyActiveOrchestrations() error {
 	candidates := p.getAllActiveOrchestrations()
 	if len(candidates) == 0 {
@@ -433,7 +657,7 @@ func (p *PlanEngine) getAllActiveOrchestrations() []*Orchestration {
 
 	var result []*Orchestration
 	for _, o := range p.orchestrationStore {
-		if o.Status == Processing {
+		if o.Status == Processing || o.Status == Paused {
 			result = append(result, o)
 		}
 	}
@@ -455,6 +679,9 @@ func (p *PlanEngine) serviceDescriptions(services []*ServiceInfo) (string, error
 			return "", fmt.Errorf("failed to marshal service schema: %w", err)
 		}
 		out[i] = fmt.Sprintf("Service ID: %s\nService Name: %s\nDescription: %s\nSchema: %s", service.ID, service.Name, service.Description, string(schemaStr))
+		if len(service.Capabilities) > 0 {
+			out[i] += "\nCapabilities: " + strings.Join(service.Capabilities, ", ")
+		}
 	}
 	return strings.Join(out, "\n\n"), nil
 }
@@ -481,6 +708,9 @@ func (p *PlanEngine) discoverProjectServices(projectID string) ([]*ServiceInfo,
 }
 
 func (p *PlanEngine) decomposeAction(ctx context.Context, orchestration *Orchestration, action string, actionParams json.RawMessage, serviceDescriptions string, retryCauseIfAny string) (*ExecutionPlan, string, bool, error) {
+	ctx = withLLMUsage(ctx, func(usage LLMUsage, model string) {
+		p.recordPlanningUsage(orchestration, usage, model)
+	})
 	cacheResult, _, err := p.VectorCache.Get(
 		ctx,
 		orchestration.ProjectID,
@@ -521,6 +751,28 @@ func (p *PlanEngine) validateActionParams(params ActionParams) error {
 	return nil
 }
 
+// validateOrchestrationWebhook checks the orchestration's results go to one of the project's webhooks, or only to
+// its callback webhook when it has one and left out the project's
+func (p *PlanEngine) validateOrchestrationWebhook(projectID string, orchestration *Orchestration) error {
+	if callback := orchestration.Callback; callback != nil {
+		u, err := url.ParseRequestURI(callback.Url)
+		if err != nil {
+			return fmt.Errorf("callback webhook url %s is not valid: %w", callback.Url, err)
+		}
+		// Results are sent to callbacks in the clear otherwise
+		if u.Scheme != "https" {
+			return fmt.Errorf("callback webhook url %s must use https", callback.Url)
+		}
+		if !p.allowPrivateWebhooks && isPrivateHost(u.Hostname(), isPublicAddress) {
+			return fmt.Errorf("callback webhook url %s: %w", callback.Url, ErrPrivateEndpoint)
+		}
+		if orchestration.Webhook == "" {
+			return nil
+		}
+	}
+	return p.validateWebhook(projectID, orchestration.Webhook)
+}
+
 func (p *PlanEngine) validateWebhook(projectID string, webhookUrl string) error {
 	if len(strings.TrimSpace(webhookUrl)) == 0 {
 		return fmt.Errorf("a webhook url is required to return orchestration results")
@@ -530,7 +782,10 @@ func (p *PlanEngine) validateWebhook(projectID string, webhookUrl string) error
 		return fmt.Errorf("webhook url %s is not valid: %w", webhookUrl, err)
 	}
 
-	project := p.projects[projectID]
+	project, _ := p.cachedProject(projectID)
+	if project == nil {
+		return fmt.Errorf("webhook url %s not found in project %s", webhookUrl, projectID)
+	}
 	if !contains(project.Webhooks, webhookUrl) {
 		return fmt.Errorf("webhook url %s not found in project %s", webhookUrl, projectID)
 	}
@@ -667,7 +922,17 @@ func (p *PlanEngine) enhanceWithServiceDetails(services []*ServiceInfo, subTasks
 	return nil
 }
 
-func (p *PlanEngine) createAndStartWorkers(ctx context.Context, orchestrationID string, plan *ExecutionPlan, taskTimeout, healthCheckGracePeriod time.Duration) {
+func (p *PlanEngine) createAndStartWorkers(ctx context.Context, orchestrationID string, plan *ExecutionPlan, taskTimeout, healthCheckGracePeriod, taskExecutionTimeout time.Duration, retryPolicy *RetryPolicy, retriedOutputs map[string]LogEntry) {
+	// Looked up before taking the worker lock, finalizing holds the store lock while stopping workers
+	var subOrchestrations []SubOrchestration
+	var serviceVersions, plannedVersions map[string]string
+	var priority Priority
+	if orchestration, err := p.getOrchestration(orchestrationID); err == nil {
+		subOrchestrations = orchestration.SubOrchestrations
+		serviceVersions, plannedVersions = orchestration.ServiceVersions, orchestration.PlannedVersions
+		priority = orchestration.Priority
+	}
+
 	p.workerMu.Lock()
 	defer p.workerMu.Unlock()
 
@@ -677,7 +942,6 @@ func (p *PlanEngine) createAndStartWorkers(ctx context.Context, orchestrationID
 
 	for _, task := range plan.Tasks {
 		taskDeps := task.extractDependencies()
-		resultAggregatorDeps[task.ID] = struct{}{}
 
 		p.Logger.Debug().
 			Fields(map[string]any{
@@ -687,6 +951,34 @@ func (p *PlanEngine) createAndStartWorkers(ctx context.Context, orchestrationID
 			}).
 			Msg("Task extracted dependencies")
 
+		// Tasks a retry reuses already have their output, they aren't run again
+		if _, reused := retriedOutputs[task.ID]; reused {
+			if task.Type != TaskTypeApproval {
+				resultAggregatorDeps[task.ID] = struct{}{}
+			}
+			continue
+		}
+
+		if task.Type == TaskTypeApproval {
+			approvalCtx, cancel := context.WithCancel(ctx)
+			p.logWorkers[orchestrationID][task.ID] = cancel
+			go NewApprovalWorker(task, p.LogManager).Start(approvalCtx, orchestrationID)
+			continue
+		}
+		if task.Type == TaskTypeOrchestration {
+			spec, ok := subOrchestrationFor(task, subOrchestrations)
+			if !ok {
+				p.Logger.Error().Str("taskID", task.ID).Msg("Sub-orchestration step has no matching sub-orchestration")
+				return
+			}
+			resultAggregatorDeps[task.ID] = struct{}{}
+			subCtx, cancel := context.WithCancel(ctx)
+			p.logWorkers[orchestrationID][task.ID] = cancel
+			go NewSubOrchestrationWorker(task, spec, p.LogManager).Start(subCtx, orchestrationID)
+			continue
+		}
+		resultAggregatorDeps[task.ID] = struct{}{}
+
 		service, err := p.GetServiceByID(task.Service)
 		if err != nil {
 			p.Logger.Error().Err(err).
@@ -696,14 +988,38 @@ func (p *PlanEngine) createAndStartWorkers(ctx context.Context, orchestrationID
 			return
 		}
 
-		worker := NewTaskWorker(
-			service,
-			task.ID,
-			taskDeps,
-			taskTimeout,
-			healthCheckGracePeriod,
-			p.LogManager,
-		)
+		var worker LogWorker
+		if task.FanOut != nil {
+			fanOutWorker := NewFanOutWorker(
+				service,
+				task,
+				taskTimeout,
+				taskExecutionTimeout,
+				healthCheckGracePeriod,
+				resolveRetryPolicy(retryPolicy, service.RetryPolicy),
+				p.LogManager,
+			).(*FanOutWorker)
+			fanOutWorker.VersionConstraint = serviceVersions[service.Name]
+			fanOutWorker.PlannedVersion = plannedVersions[service.Name]
+			fanOutWorker.Priority = priority
+			worker = fanOutWorker
+		} else {
+			taskWorker := NewTaskWorker(
+				service,
+				task.ID,
+				taskDeps,
+				taskTimeout,
+				taskExecutionTimeout,
+				healthCheckGracePeriod,
+				resolveRetryPolicy(retryPolicy, service.RetryPolicy),
+				p.LogManager,
+			).(*TaskWorker)
+			taskWorker.Condition = task.Condition
+			taskWorker.VersionConstraint = serviceVersions[service.Name]
+			taskWorker.PlannedVersion = plannedVersions[service.Name]
+			taskWorker.Priority = priority
+			worker = taskWorker
+		}
 		taskCtx, cancel := context.WithCancel(ctx)
 		p.logWorkers[orchestrationID][task.ID] = cancel
 		p.Logger.Debug().
@@ -765,10 +1081,20 @@ func (p *PlanEngine) cleanupLogWorkers(orchestrationID string) {
 			cancel() // This will trigger ctx.Done() in the worker
 		}
 		delete(p.logWorkers, orchestrationID)
+		p.releasePauseGate(orchestrationID)
 		p.Logger.Debug().
 			Str("OrchestrationID", orchestrationID).
 			Msg("Cleaned up task workers for orchestration.")
 	}
+
+	if deadline, exists := p.deadlines[orchestrationID]; exists {
+		deadline.Stop()
+		delete(p.deadlines, orchestrationID)
+	}
+	if sla, exists := p.slaTimers[orchestrationID]; exists {
+		sla.Stop()
+		delete(p.slaTimers, orchestrationID)
+	}
 }
 
 func (p *PlanEngine) callingPlanMinusTaskZero(callingPlan *ExecutionPlan) (*SubTask, *ExecutionPlan) {
@@ -877,62 +1203,48 @@ func (p *PlanEngine) validateActionable(subTasks []*SubTask) error {
 func (p *PlanEngine) triggerWebhook(orchestration *Orchestration) error {
 	var payload = struct {
 		OrchestrationID string            `json:"orchestrationId"`
+		ParentID        string            `json:"parentId,omitempty"`
+		RetryOf         string            `json:"retryOf,omitempty"`
+		CloneOf         string            `json:"cloneOf,omitempty"`
+		ContinuedFrom   string            `json:"continuedFrom,omitempty"`
+		ContinuedAs     string            `json:"continuedAs,omitempty"`
 		Results         []json.RawMessage `json:"results"`
 		Status          Status            `json:"status"`
 		Error           json.RawMessage   `json:"error,omitempty"`
 	}{
 		OrchestrationID: orchestration.ID,
+		ParentID:        orchestration.ParentID,
+		RetryOf:         orchestration.RetryOf,
+		CloneOf:         orchestration.CloneOf,
+		ContinuedFrom:   orchestration.ContinuedFrom,
+		ContinuedAs:     orchestration.ContinuedAs,
 		Results:         orchestration.Results,
 		Status:          orchestration.Status,
 		Error:           orchestration.Error,
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to trigger webhook failed to marshal payload: %w", err)
-	}
-
 	p.Logger.Trace().
 		Str("ProjectID", orchestration.ProjectID).
 		Str("OrchestrationID", orchestration.ID).
-		Str("Webhook", orchestration.Webhook).
-		RawJSON("Payload", jsonPayload).
-		Msg("Triggering webhook")
+		Msg("Triggering orchestration webhook")
 
-	// Create a new request
-	req, err := http.NewRequest("POST", orchestration.Webhook, bytes.NewBuffer(jsonPayload))
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to marshal orchestration result: %w", err)
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Orra/1.0")
-
-	// Create an HTTP client with a timeout
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-
-	// Send the request
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			p.Logger.Error().
+	// Only the webhooks failing to accept the results are retried, the others aren't sent them twice
+	for _, webhook := range orchestration.resultWebhooks() {
+		if err := p.postWebhook(orchestration.ProjectID, webhook, OrchestrationEventResult, json.RawMessage(body)); err != nil {
+			p.Logger.Warn().
+				Err(err).
+				Str("ProjectID", orchestration.ProjectID).
 				Str("OrchestrationID", orchestration.ID).
-				Err(fmt.Errorf("failed to close response body when triggering Webhook: %w", err))
+				Str("Webhook", webhook).
+				Msg("Failed to deliver orchestration result, retrying")
+			p.notifyInBackground(func() { p.retryOrchestrationResult(orchestration.ProjectID, webhook, body, err) })
 		}
-	}(resp.Body)
-
-	// Check the response status
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
-
 	return nil
 }
 
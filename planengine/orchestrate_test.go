@@ -7,11 +7,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -483,3 +488,50 @@ func TestCallingPlanMinusTaskZero_SameKeyDifferentValues(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("$task0.%s", secondActionKey), task2.Input["action"],
 		"task2 should reference the unique action field in TaskZero")
 }
+
+func TestDeferredOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.RootCtx = context.Background()
+	project.Webhooks = []string{"http://localhost/webhook"}
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	runAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	t.Run("unregistered webhook is rejected", func(t *testing.T) {
+		w := submit(fmt.Sprintf(`{"action":{"type":"user","content":"Echo"},"webhook":"http://localhost/unknown","runAt":%q}`, runAt))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	w := submit(fmt.Sprintf(`{"action":{"type":"user","content":"Echo"},"webhook":"http://localhost/webhook","runAt":%q}`, runAt))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var accepted Orchestration
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, Scheduled, accepted.Status)
+	require.NotNil(t, accepted.RunAt)
+
+	list := app.Engine.GetOrchestrationList(project.ID, OrchestrationQuery{})
+	require.Len(t, list.Scheduled, 1)
+	assert.Equal(t, accepted.ID, list.Scheduled[0].ID)
+	assert.Equal(t, accepted.RunAt.Unix(), list.Scheduled[0].RunAt.Unix())
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	app.Engine.WebSocketManager = NewWebSocketManager(app.Logger)
+	_, err = app.Engine.AbortOrchestration(accepted.ID, "no longer needed")
+	require.NoError(t, err)
+
+	// A cancelled deferred orchestration is not started when its time comes
+	app.Engine.startDeferredOrchestration(context.Background(), accepted.ID)
+	assert.Equal(t, Cancelled, app.Engine.orchestrationStore[accepted.ID].Status)
+}
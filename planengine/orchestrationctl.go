@@ -0,0 +1,386 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+// AbortOrchestration cancels an unfinished orchestration. Task workers are stopped so nothing more is
+// dispatched, services working on in-flight tasks are told to stop and the project's webhooks are notified.
+func (p *PlanEngine) AbortOrchestration(orchestrationID string, reason string) (*Orchestration, error) {
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	var status Status
+	if exists {
+		status = orchestration.Status
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if !exists {
+		return nil, ErrOrchestrationNotFound
+	}
+
+	if orchestrationFinished(status) {
+		return nil, fmt.Errorf("%w with status %s", ErrOrchestrationFinished, status.String())
+	}
+
+	p.cleanupLogWorkers(orchestrationID)
+
+	cancelledAt := time.Now().UTC()
+	for _, task := range p.LogManager.InFlightTasks(orchestrationID) {
+		if err := p.LogManager.MarkTask(orchestrationID, task.ID, Cancelled, cancelledAt); err != nil {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Str("TaskID", task.ID).Msg("Failed to mark task cancelled")
+		}
+
+		if err := p.WebSocketManager.SendTaskCancellation(task.Service, &TaskCancellation{
+			Type:            "task_cancellation",
+			ID:              task.ID,
+			OrchestrationID: orchestrationID,
+			ServiceID:       task.Service,
+			Reason:          reason,
+		}); err != nil {
+			p.Logger.Warn().Err(err).Str("OrchestrationID", orchestrationID).Str("TaskID", task.ID).Msg("Failed to send task cancellation")
+		}
+	}
+
+	payload, err := json.Marshal(struct {
+		OrchestrationID string `json:"orchestration"`
+		Error           string `json:"error"`
+	}{
+		OrchestrationID: orchestrationID,
+		Error:           reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cancellation reason: %w", err)
+	}
+
+	p.LogManager.MarkOrchestration(orchestrationID, Cancelled, payload)
+	if err := p.CancelOrchestration(orchestrationID, payload); err != nil {
+		return nil, err
+	}
+
+	if project, err := p.GetProjectByID(orchestration.ProjectID); err == nil {
+		p.notifyInBackground(func() {
+			p.notifyOrchestrationEvent(project, orchestrationID, ProjectEventOrchestrationCancelled, map[string]any{
+				"orchestrationId": orchestrationID,
+				"reason":          reason,
+			})
+		})
+	}
+
+	return orchestration, nil
+}
+
+// PauseOrchestration stops an orchestration dispatching further tasks, in-flight tasks are left to complete
+func (p *PlanEngine) PauseOrchestration(orchestrationID string) (*Orchestration, error) {
+	// Close the gate before the status changes so no task slips through
+	p.pauseMu.Lock()
+	if _, exists := p.pauseGates[orchestrationID]; !exists {
+		p.pauseGates[orchestrationID] = make(chan struct{})
+	}
+	p.pauseMu.Unlock()
+
+	orchestration, err := p.transitionOrchestration(orchestrationID, Processing, Paused, ErrOrchestrationNotPausable)
+	if err != nil {
+		p.pauseMu.Lock()
+		if orchestration == nil || orchestration.Status != Paused {
+			delete(p.pauseGates, orchestrationID)
+		}
+		p.pauseMu.Unlock()
+		return nil, err
+	}
+
+	p.LogManager.MarkOrchestration(orchestrationID, Paused, nil)
+	return orchestration, nil
+}
+
+// ResumeOrchestration continues dispatching a paused orchestration's tasks from where it stopped
+func (p *PlanEngine) ResumeOrchestration(orchestrationID string) (*Orchestration, error) {
+	orchestration, err := p.transitionOrchestration(orchestrationID, Paused, Processing, ErrOrchestrationNotResumable)
+	if err != nil {
+		return nil, err
+	}
+
+	p.LogManager.MarkOrchestration(orchestrationID, Processing, nil)
+	p.releasePauseGate(orchestrationID)
+	return orchestration, nil
+}
+
+// DeleteOrchestration purges a finished orchestration and everything stored about it: its log, task logs, dead letter,
+// webhook deliveries and dead letters, cached task outputs, idempotent submissions and sub-orchestrations. Forcing it
+// cancels an unfinished orchestration first.
+func (p *PlanEngine) DeleteOrchestration(orchestrationID string, force bool) error {
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	var status Status
+	var children []OrchestrationLink
+	if exists {
+		status = orchestration.Status
+		children = slices.Clone(orchestration.Children)
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if !exists {
+		return ErrOrchestrationNotFound
+	}
+
+	if !orchestrationFinished(status) {
+		if !force {
+			return fmt.Errorf("%w, orchestration is %s", ErrOrchestrationUnfinished, status.String())
+		}
+		if _, err := p.AbortOrchestration(orchestrationID, "deleted on request"); err != nil && !errors.Is(err, ErrOrchestrationFinished) {
+			return err
+		}
+	}
+
+	for _, child := range children {
+		if err := p.DeleteOrchestration(child.ID, force); err != nil && !errors.Is(err, ErrOrchestrationNotFound) {
+			return fmt.Errorf("failed to delete sub-orchestration %s: %w", child.ID, err)
+		}
+	}
+
+	if err := p.purgeOrchestration(orchestration); err != nil {
+		return err
+	}
+
+	p.orchestrationStoreMu.Lock()
+	delete(p.orchestrationStore, orchestrationID)
+	p.orchestrationStoreMu.Unlock()
+	p.releasePauseGate(orchestrationID)
+
+	return nil
+}
+
+// purgeOrchestration deletes everything stored about an orchestration. The orchestration itself goes last, so a
+// failed purge can be retried.
+func (p *PlanEngine) purgeOrchestration(orchestration *Orchestration) error {
+	if err := p.LogManager.DeleteLog(orchestration.ID); err != nil {
+		return fmt.Errorf("failed to delete orchestration log: %w", err)
+	}
+	if p.TaskLogs != nil {
+		if err := p.TaskLogs.DeleteTaskLogs(orchestration.ID); err != nil {
+			return fmt.Errorf("failed to delete task logs: %w", err)
+		}
+	}
+	if p.DeadLetters != nil {
+		if err := p.DeadLetters.DeleteDeadLetter(orchestration.ProjectID, orchestration.ID); err != nil {
+			return fmt.Errorf("failed to delete dead letter: %w", err)
+		}
+	}
+	if p.WebhookDeliveries != nil {
+		if err := p.WebhookDeliveries.DeleteOrchestrationWebhookDeliveries(orchestration.ProjectID, orchestration.ID); err != nil {
+			return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+		}
+	}
+	if p.WebhookDeadLetters != nil {
+		if err := p.WebhookDeadLetters.DeleteOrchestrationWebhookDeadLetters(orchestration.ProjectID, orchestration.ID); err != nil {
+			return fmt.Errorf("failed to delete webhook dead letters: %w", err)
+		}
+	}
+	if p.Submissions != nil {
+		if err := p.Submissions.DeleteOrchestrationSubmissions(orchestration.ProjectID, orchestration.ID); err != nil {
+			return fmt.Errorf("failed to delete idempotent submissions: %w", err)
+		}
+	}
+	if p.ResultCache != nil {
+		p.ResultCache.DeleteOrchestration(orchestration.ID)
+	}
+	return p.orchestrationStorage.DeleteOrchestration(orchestration)
+}
+
+func (p *PlanEngine) transitionOrchestration(orchestrationID string, from, to Status, errInvalid error) (*Orchestration, error) {
+	p.orchestrationStoreMu.Lock()
+	defer p.orchestrationStoreMu.Unlock()
+
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		return nil, ErrOrchestrationNotFound
+	}
+	return p.transitionOrchestrationLocked(orchestration, from, to, "", errInvalid)
+}
+
+// transitionOrchestrationLocked moves an orchestration between statuses, pausedBy records what paused it.
+// The caller holds orchestrationStoreMu.
+func (p *PlanEngine) transitionOrchestrationLocked(orchestration *Orchestration, from, to Status, pausedBy string, errInvalid error) (*Orchestration, error) {
+	if orchestration.Status != from {
+		return orchestration, fmt.Errorf("%w, orchestration is %s", errInvalid, orchestration.Status.String())
+	}
+
+	lifecycle, previouslyPausedBy := orchestration.Lifecycle, orchestration.PausedBy
+	if to == Processing {
+		orchestration.recordLifecycle(TimelineOrchestrationResumed)
+	} else {
+		orchestration.recordLifecycle(orchestrationEventType(to))
+	}
+	orchestration.Status = to
+	orchestration.PausedBy = pausedBy
+	orchestration.Timestamp = time.Now().UTC()
+	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		orchestration.Status = from
+		orchestration.PausedBy = previouslyPausedBy
+		orchestration.Lifecycle = lifecycle
+		return nil, fmt.Errorf("failed to persist orchestration state: %w", err)
+	}
+
+	return orchestration, nil
+}
+
+// awaitDispatch blocks while the orchestration is paused, it fails if the worker is stopped first
+func (p *PlanEngine) awaitDispatch(ctx context.Context, orchestrationID string) error {
+	p.pauseMu.RLock()
+	gate, paused := p.pauseGates[orchestrationID]
+	p.pauseMu.RUnlock()
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *PlanEngine) releasePauseGate(orchestrationID string) {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+
+	if gate, exists := p.pauseGates[orchestrationID]; exists {
+		close(gate)
+		delete(p.pauseGates, orchestrationID)
+	}
+}
+
+// projectOrchestrationID returns the orchestration in the request path if it belongs to the caller's project
+func (app *App) projectOrchestrationID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return "", false
+	}
+
+	orchestrationID := mux.Vars(r)["id"]
+	if !app.Engine.OrchestrationBelongsToProject(orchestrationID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
+		return "", false
+	}
+
+	return orchestrationID, true
+}
+
+func (app *App) orchestrationControlResponse(w http.ResponseWriter, orchestration *Orchestration, status Status, err error) {
+	switch {
+	case errors.Is(err, ErrOrchestrationNotFound):
+		httpErrorResponse(w, app.Logger, errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), err))
+		return
+	case errors.Is(err, ErrOrchestrationFinished), errors.Is(err, ErrOrchestrationNotPausable), errors.Is(err, ErrOrchestrationNotResumable):
+		httpErrorResponse(w, app.Logger, errs.E(errs.Invalid, err))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":     orchestration.ID,
+		"status": status,
+	}); err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// cancelRequest is the optional body of a cancellation
+type cancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelOrchestrationHandler aborts one of the caller's unfinished orchestrations
+func (app *App) CancelOrchestrationHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID, ok := app.projectOrchestrationID(w, r)
+	if !ok {
+		return
+	}
+
+	var request cancelRequest
+	if err := decodeOptionalRequest(w, r, &request, cancelFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if request.Reason == "" {
+		request.Reason = "cancelled on request"
+	}
+
+	orchestration, err := app.Engine.AbortOrchestration(orchestrationID, request.Reason)
+	app.orchestrationControlResponse(w, orchestration, Cancelled, err)
+}
+
+// PauseOrchestrationHandler freezes dispatching of one of the caller's orchestrations
+func (app *App) PauseOrchestrationHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID, ok := app.projectOrchestrationID(w, r)
+	if !ok {
+		return
+	}
+
+	orchestration, err := app.Engine.PauseOrchestration(orchestrationID)
+	app.orchestrationControlResponse(w, orchestration, Paused, err)
+}
+
+// ResumeOrchestrationHandler continues one of the caller's paused orchestrations
+func (app *App) ResumeOrchestrationHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID, ok := app.projectOrchestrationID(w, r)
+	if !ok {
+		return
+	}
+
+	orchestration, err := app.Engine.ResumeOrchestration(orchestrationID)
+	app.orchestrationControlResponse(w, orchestration, Processing, err)
+}
+
+// DeleteOrchestrationHandler purges one of the caller's orchestrations, unfinished ones are only deleted when forced
+func (app *App) DeleteOrchestrationHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID, ok := app.projectOrchestrationID(w, r)
+	if !ok {
+		return
+	}
+
+	var force bool
+	if value := r.URL.Query().Get("force"); value != "" {
+		var err error
+		if force, err = strconv.ParseBool(value); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("force"), "force must be true or false"))
+			return
+		}
+	}
+
+	err := app.Engine.DeleteOrchestration(orchestrationID, force)
+	switch {
+	case errors.Is(err, ErrOrchestrationNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), err))
+		return
+	case errors.Is(err, ErrOrchestrationUnfinished):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Invalid, err))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(OrchestrationDeleteFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,312 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRunningOrchestration registers an orchestration whose first task is being processed by a service
+func setupRunningOrchestration(t *testing.T, app *App, projectID string) *Orchestration {
+	t.Helper()
+
+	if app.Engine.LogManager == nil {
+		logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+		require.NoError(t, err)
+		app.Engine.LogManager = logManager
+	}
+	if app.Engine.WebSocketManager == nil {
+		app.Engine.WebSocketManager = NewWebSocketManager(app.Logger)
+	}
+
+	plan := &ExecutionPlan{
+		ProjectID: projectID,
+		Tasks: []*SubTask{
+			{ID: "task1", Service: "s_echo"},
+			{ID: "task2", Service: "s_audit"},
+		},
+	}
+	orchestration := &Orchestration{
+		ID:        app.Engine.GenerateOrchestrationKey(),
+		ProjectID: projectID,
+		Plan:      plan,
+		Status:    Processing,
+	}
+	app.Engine.orchestrationStoreMu.Lock()
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+	app.Engine.orchestrationStoreMu.Unlock()
+
+	// Notifications about the orchestration finishing outlive the test otherwise
+	t.Cleanup(app.Engine.notifying.Wait)
+
+	app.Engine.LogManager.PrepLogForOrchestration(projectID, orchestration.ID, plan)
+	require.NoError(t, app.Engine.LogManager.MarkTask(orchestration.ID, "task1", Processing, time.Now().UTC()))
+
+	return orchestration
+}
+
+func TestCancelOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	events := make(chan ProjectEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+
+	cancel := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/"+id+"/cancel", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := cancel(orchestration.ID, `{"reason":"no longer needed","force":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), UnknownRequestFieldErrCode)
+	assert.Equal(t, Processing, orchestration.Status)
+
+	w = cancel(orchestration.ID, `{"reason":"no longer needed"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, Cancelled, orchestration.Status)
+	assert.Contains(t, string(orchestration.Error), "no longer needed")
+
+	state := app.Engine.LogManager.orchestrations[orchestration.ID]
+	assert.Equal(t, Cancelled, state.Status)
+	assert.Equal(t, Cancelled, state.TasksStatuses["task1"], "in-flight tasks are cancelled")
+	assert.NotContains(t, state.TasksStatuses, "task2", "undispatched tasks are left as they were")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, ProjectEventOrchestrationCancelled, event.Event)
+		assert.Equal(t, project.ID, event.ProjectID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("project webhook was not notified")
+	}
+
+	t.Run("finished orchestrations cannot be cancelled", func(t *testing.T) {
+		w := cancel(orchestration.ID, `{"reason":"no longer needed"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("cancellations without a body use a default reason", func(t *testing.T) {
+		unexplained := setupRunningOrchestration(t, app, project.ID)
+		w := cancel(unexplained.ID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, Cancelled, unexplained.Status)
+		assert.Contains(t, string(unexplained.Error), "cancelled on request")
+
+		select {
+		case <-events:
+		case <-time.After(2 * time.Second):
+			t.Fatal("project webhook was not notified")
+		}
+	})
+
+	t.Run("orchestrations of other projects cannot be cancelled", func(t *testing.T) {
+		other := setupRunningOrchestration(t, app, "p_other")
+		w := cancel(other.ID, `{"reason":"no longer needed"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, Processing, other.Status)
+	})
+}
+
+func TestPauseAndResumeOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+
+	send := func(id, action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/"+id+"/"+action, nil)
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(orchestration.ID, "resume")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "only paused orchestrations can be resumed")
+
+	w = send(orchestration.ID, "pause")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, Paused, orchestration.Status)
+	assert.Equal(t, Paused, app.Engine.LogManager.orchestrations[orchestration.ID].Status)
+
+	w = send(orchestration.ID, "pause")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "paused orchestrations cannot be paused again")
+
+	dispatched := make(chan error, 1)
+	go func() {
+		dispatched <- app.Engine.awaitDispatch(context.Background(), orchestration.ID)
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("tasks were dispatched while the orchestration was paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	w = send(orchestration.ID, "resume")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, Processing, orchestration.Status)
+
+	select {
+	case err := <-dispatched:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("tasks were not dispatched after the orchestration resumed")
+	}
+
+	t.Run("stopped workers stop waiting", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, send(orchestration.ID, "pause").Code)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, app.Engine.awaitDispatch(ctx, orchestration.ID), context.Canceled)
+	})
+}
+
+func TestDeleteOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Engine.TaskLogs = app.Db
+	app.Engine.DeadLetters = app.Db
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	require.NoError(t, app.Db.StoreOrchestration(orchestration))
+
+	child := setupRunningOrchestration(t, app, project.ID)
+	child.ParentID = orchestration.ID
+	require.NoError(t, app.Db.StoreOrchestration(child))
+	orchestration.Children = []OrchestrationLink{{ID: child.ID, TaskID: "task2"}}
+
+	require.NoError(t, app.Db.StoreTaskLogs([]TaskLog{{ID: "l_1", OrchestrationID: orchestration.ID, TaskID: "task1", Message: "charging card 4242", Timestamp: time.Now().UTC()}}))
+	require.NoError(t, app.Db.StoreDeadLetter(&DeadLetter{OrchestrationID: orchestration.ID, ProjectID: project.ID, Status: Failed}))
+
+	send := func(id, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/orchestrations/"+id+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send("o_unknown", "").Code)
+
+	w := send(orchestration.ID, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "running orchestrations are only deleted when forced")
+	assert.True(t, app.Engine.OrchestrationBelongsToProject(orchestration.ID, project.ID))
+
+	assert.Equal(t, http.StatusBadRequest, send(orchestration.ID, "?force=maybe").Code)
+
+	w = send(orchestration.ID, "?force=true")
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	for _, id := range []string{orchestration.ID, child.ID} {
+		assert.False(t, app.Engine.OrchestrationBelongsToProject(id, project.ID))
+		assert.Nil(t, app.Engine.LogManager.GetLog(id))
+		_, err := app.Db.LoadOrchestration(id)
+		assert.ErrorIs(t, err, ErrOrchestrationNotFound)
+		entries, err := app.Db.LoadEntries(id)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		_, err = app.Db.LoadState(id)
+		assert.Error(t, err)
+	}
+
+	logs, err := app.Db.ListTaskLogs(orchestration.ID)
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+	_, err = app.Db.LoadDeadLetter(project.ID, orchestration.ID)
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+
+	orchestrations, err := app.Db.ListProjectOrchestrations(project.ID)
+	require.NoError(t, err)
+	assert.Empty(t, orchestrations)
+
+	assert.Equal(t, http.StatusBadRequest, send(orchestration.ID, "").Code, "deleted orchestrations are unknown")
+}
+
+func TestDeleteOrchestrationPurgesWebhookAndCachedData(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Engine.WebhookDeliveries = app.Db
+	app.Engine.WebhookDeadLetters = app.Db
+	app.Engine.Submissions = app.Db
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	require.NoError(t, app.Db.StoreOrchestration(orchestration))
+	const other = "o_other"
+	webhook := "https://example.com/webhook"
+
+	for _, orchestrationID := range []string{orchestration.ID, other} {
+		result := json.RawMessage(fmt.Sprintf(`{"orchestrationId":%q,"results":[{"card":"4242"}]}`, orchestrationID))
+		require.NoError(t, app.Db.StoreWebhookDelivery(newWebhookDelivery(project.ID, projectWebhookID(webhook), webhook, OrchestrationEventResult, result)))
+		failed, err := json.Marshal(ProjectEvent{Event: ProjectEventTaskFailed, ProjectID: project.ID, Data: map[string]any{"orchestrationId": orchestrationID}})
+		require.NoError(t, err)
+		require.NoError(t, app.Db.StoreWebhookDelivery(newWebhookDelivery(project.ID, projectWebhookID(webhook), webhook, ProjectEventTaskFailed, failed)))
+
+		require.NoError(t, app.Db.StoreWebhookDeadLetter(&WebhookDeadLetter{
+			ID: "wdl_result_" + orchestrationID, ProjectID: project.ID, Webhook: webhook,
+			Event:   ProjectEvent{Event: OrchestrationEventResult, ProjectID: project.ID},
+			Payload: result,
+		}))
+		require.NoError(t, app.Db.StoreWebhookDeadLetter(&WebhookDeadLetter{
+			ID: "wdl_event_" + orchestrationID, ProjectID: project.ID, Webhook: webhook,
+			Event: ProjectEvent{Event: ProjectEventTaskFailed, ProjectID: project.ID, Data: map[string]any{"orchestrationId": orchestrationID}},
+		}))
+
+		app.Engine.ResultCache.Put("key_"+orchestrationID, orchestrationID, json.RawMessage(`{"card":"4242"}`), time.Hour)
+		require.NoError(t, app.Db.StoreSubmission(&Submission{ProjectID: project.ID, Key: "order_" + orchestrationID, OrchestrationID: orchestrationID}, time.Hour))
+	}
+
+	require.NoError(t, app.Engine.DeleteOrchestration(orchestration.ID, true))
+
+	deliveries, err := app.Db.ListWebhookDeliveries(project.ID, projectWebhookID(webhook))
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		assert.Equal(t, other, delivery.orchestrationID())
+	}
+
+	deadLetters, err := app.Db.ListWebhookDeadLetters(project.ID)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 2)
+	for _, deadLetter := range deadLetters {
+		assert.Equal(t, other, deadLetter.orchestrationID())
+	}
+
+	_, hit := app.Engine.ResultCache.Get("key_" + orchestration.ID)
+	assert.False(t, hit)
+	_, hit = app.Engine.ResultCache.Get("key_" + other)
+	assert.True(t, hit)
+
+	_, err = app.Db.LoadSubmission(project.ID, "order_"+orchestration.ID)
+	assert.ErrorIs(t, err, ErrSubmissionNotFound)
+	_, err = app.Db.LoadSubmission(project.ID, "order_"+other)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,160 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OrchestrationSortTimestamp   = "timestamp"
+	OrchestrationSortPriority    = "priority"
+	defaultOrchestrationSort     = "-" + OrchestrationSortTimestamp
+	defaultOrchestrationPageSize = 50
+	MaxOrchestrationPageSize     = 500
+)
+
+var orchestrationSorts = []string{OrchestrationSortTimestamp, OrchestrationSortPriority}
+
+// OrchestrationPage asks for one page of a project's orchestrations, sorted by Sort. Sorts are ascending
+// unless prefixed with '-', e.g. the default -timestamp lists the newest orchestrations first.
+type OrchestrationPage struct {
+	Sort   string
+	Limit  int
+	Cursor *orchestrationCursor
+}
+
+// orchestrationCursor is the last orchestration of a page, the next page starts right after it. It keeps the
+// orchestration's sort keys rather than its position, so pages don't shift as orchestrations are added or removed.
+type orchestrationCursor struct {
+	Sort      string    `json:"s"`
+	ID        string    `json:"i"`
+	Timestamp time.Time `json:"t"`
+	Priority  Priority  `json:"p,omitempty"`
+}
+
+func parseOrchestrationPage(values url.Values) (OrchestrationPage, error) {
+	page := OrchestrationPage{Sort: defaultOrchestrationSort}
+
+	if sort := values.Get("sort"); sort != "" {
+		if !slices.Contains(orchestrationSorts, strings.TrimPrefix(sort, "-")) {
+			return OrchestrationPage{}, fmt.Errorf("invalid sort %q, expected one of %s, optionally prefixed with '-' for descending order", sort, strings.Join(orchestrationSorts, ", "))
+		}
+		page.Sort = sort
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxOrchestrationPageSize {
+			return OrchestrationPage{}, fmt.Errorf("invalid limit %q, expected a number from 1 to %d", limit, MaxOrchestrationPageSize)
+		}
+		page.Limit = n
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		decoded, err := decodeOrchestrationCursor(cursor)
+		if err != nil {
+			return OrchestrationPage{}, fmt.Errorf("invalid cursor")
+		}
+		if decoded.Sort != page.Sort {
+			return OrchestrationPage{}, fmt.Errorf("the cursor belongs to a list sorted by %s, not %s", decoded.Sort, page.Sort)
+		}
+		page.Cursor = decoded
+		if page.Limit == 0 {
+			page.Limit = defaultOrchestrationPageSize
+		}
+	}
+
+	return page, nil
+}
+
+// paginated reports whether a page was asked for, otherwise every orchestration is listed
+func (p OrchestrationPage) paginated() bool {
+	return p.Limit > 0
+}
+
+func newOrchestrationCursor(sort string, o *Orchestration) *orchestrationCursor {
+	return &orchestrationCursor{Sort: sort, ID: o.ID, Timestamp: o.Timestamp, Priority: o.Priority}
+}
+
+func (c *orchestrationCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeOrchestrationCursor(cursor string) (*orchestrationCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded orchestrationCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.ID == "" {
+		return nil, fmt.Errorf("cursor has no orchestration")
+	}
+	return &decoded, nil
+}
+
+// compareOrchestrations orders two orchestrations' sort keys by the sort, ties are broken by acceptance time then
+// ID so every orchestration has a single position
+func compareOrchestrations(sort string, a, b *orchestrationCursor) int {
+	field, descending := strings.CutPrefix(sort, "-")
+
+	var order int
+	if field == OrchestrationSortPriority {
+		// Ranks count down from the most urgent priority, so -priority lists urgent orchestrations first
+		order = b.Priority.rank() - a.Priority.rank()
+	}
+	if order == 0 {
+		order = a.Timestamp.Compare(b.Timestamp)
+	}
+	if order == 0 {
+		order = strings.Compare(a.ID, b.ID)
+	}
+	if descending {
+		return -order
+	}
+	return order
+}
+
+// paginate sorts the orchestrations and returns the page after the cursor, along with the cursor of the page
+// following it when there is one
+func (p OrchestrationPage) paginate(orchestrations []*Orchestration) ([]*Orchestration, string) {
+	keys := make(map[string]*orchestrationCursor, len(orchestrations))
+	for _, o := range orchestrations {
+		keys[o.ID] = newOrchestrationCursor(p.Sort, o)
+	}
+	slices.SortFunc(orchestrations, func(a, b *Orchestration) int {
+		return compareOrchestrations(p.Sort, keys[a.ID], keys[b.ID])
+	})
+
+	start := 0
+	if p.Cursor != nil {
+		start, _ = slices.BinarySearchFunc(orchestrations, p.Cursor, func(o *Orchestration, cursor *orchestrationCursor) int {
+			if compareOrchestrations(p.Sort, keys[o.ID], cursor) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	end := min(start+p.Limit, len(orchestrations))
+	page := orchestrations[start:end]
+	if end == len(orchestrations) {
+		return page, ""
+	}
+	return page, keys[page[len(page)-1].ID].encode()
+}
@@ -0,0 +1,145 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOrchestrationPage(t *testing.T) {
+	query, err := parseOrchestrationQuery(url.Values{})
+	require.NoError(t, err)
+	assert.False(t, query.paginated())
+	assert.Equal(t, defaultOrchestrationSort, query.Sort)
+
+	query, err = parseOrchestrationQuery(url.Values{
+		"sort":  {"priority"},
+		"limit": {"10"},
+		"from":  {"2025-01-01T00:00:00Z"},
+		"q":     {" refund "},
+	})
+	require.NoError(t, err)
+	assert.True(t, query.paginated())
+	assert.Equal(t, OrchestrationSortPriority, query.Sort)
+	assert.Equal(t, 10, query.Limit)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), query.From)
+	assert.Equal(t, "refund", query.Text)
+
+	cursor := newOrchestrationCursor(defaultOrchestrationSort, &Orchestration{ID: "o_1", Timestamp: time.Now()}).encode()
+	query, err = parseOrchestrationQuery(url.Values{"cursor": {cursor}})
+	require.NoError(t, err)
+	assert.Equal(t, defaultOrchestrationPageSize, query.Limit, "a cursor alone pages with the default size")
+
+	for _, values := range []url.Values{
+		{"sort": {"action"}},
+		{"limit": {"0"}},
+		{"limit": {fmt.Sprint(MaxOrchestrationPageSize + 1)}},
+		{"cursor": {"not-a-cursor"}},
+		{"cursor": {cursor}, "sort": {"timestamp"}},
+		{"from": {"yesterday"}},
+		{"from": {"2025-02-01T00:00:00Z"}, "to": {"2025-01-01T00:00:00Z"}},
+	} {
+		_, err := parseOrchestrationQuery(values)
+		assert.Error(t, err, values)
+	}
+}
+
+func TestListOrchestrationsPaginated(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 7 {
+		o := &Orchestration{
+			ID:        fmt.Sprintf("o_%d", i),
+			ProjectID: project.ID,
+			Status:    Completed,
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Action:    Action{Content: fmt.Sprintf("Ship order %d", i)},
+		}
+		if i%2 == 0 {
+			o.Action.Content = fmt.Sprintf("Refund order %d", i)
+			o.Priority = PriorityHigh
+		}
+		app.Engine.orchestrationStore[o.ID] = o
+	}
+
+	list := func(query string) OrchestrationListView {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations?"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var view OrchestrationListView
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&view))
+		return view
+	}
+	ids := func(views []OrchestrationView) []string {
+		var ids []string
+		for _, view := range views {
+			ids = append(ids, view.ID)
+		}
+		return ids
+	}
+
+	t.Run("unpaginated lists stay grouped by status", func(t *testing.T) {
+		view := list("")
+		assert.Len(t, view.Completed, 7)
+		assert.Empty(t, view.Orchestrations)
+		assert.Equal(t, 7, view.Total)
+	})
+
+	t.Run("pages through every orchestration, newest first", func(t *testing.T) {
+		first := list("limit=3")
+		assert.Equal(t, []string{"o_6", "o_5", "o_4"}, ids(first.Orchestrations))
+		assert.Equal(t, 7, first.Total)
+		assert.Empty(t, first.Completed)
+		require.NotEmpty(t, first.NextCursor)
+
+		// Orchestrations added since the first page don't shift the pages after it
+		app.Engine.orchestrationStore["o_new"] = &Orchestration{ID: "o_new", ProjectID: project.ID, Status: Completed, Timestamp: start.Add(time.Hour * 24)}
+		defer delete(app.Engine.orchestrationStore, "o_new")
+
+		second := list("limit=3&cursor=" + first.NextCursor)
+		assert.Equal(t, []string{"o_3", "o_2", "o_1"}, ids(second.Orchestrations))
+		third := list("limit=3&cursor=" + second.NextCursor)
+		assert.Equal(t, []string{"o_0"}, ids(third.Orchestrations))
+		assert.Empty(t, third.NextCursor)
+	})
+
+	t.Run("sorts", func(t *testing.T) {
+		assert.Equal(t, []string{"o_0", "o_1", "o_2"}, ids(list("limit=3&sort=timestamp").Orchestrations))
+
+		first := list("limit=3&sort=-priority")
+		assert.Equal(t, []string{"o_6", "o_4", "o_2"}, ids(first.Orchestrations))
+		second := list("limit=3&sort=-priority&cursor=" + first.NextCursor)
+		assert.Equal(t, []string{"o_0", "o_5", "o_3"}, ids(second.Orchestrations))
+	})
+
+	t.Run("filters by time and action text", func(t *testing.T) {
+		view := list("limit=10&q=REFUND&from=" + url.QueryEscape(start.Add(time.Hour).Format(time.RFC3339)))
+		assert.Equal(t, []string{"o_6", "o_4", "o_2"}, ids(view.Orchestrations))
+		assert.Equal(t, 3, view.Total)
+
+		view = list("to=" + url.QueryEscape(start.Add(time.Hour).Format(time.RFC3339)))
+		assert.Len(t, view.Completed, 2)
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const MaxOrchestrationStatusIDs = 500
+
+var orchestrationStatusFields = []string{"ids"}
+
+// orchestrationStatusRequest lists the orchestrations to report the status of
+type orchestrationStatusRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// OrchestrationStatus is where an orchestration is at, without its tasks and results
+type OrchestrationStatus struct {
+	ID        string          `json:"id"`
+	Status    Status          `json:"status"`
+	Error     json.RawMessage `json:"error,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// OrchestrationStatusResponse reports the requested orchestrations' statuses in request order
+type OrchestrationStatusResponse struct {
+	Orchestrations []OrchestrationStatus `json:"orchestrations"`
+	// NotFound lists requested IDs that aren't the project's orchestrations, or have expired
+	NotFound []string `json:"notFound"`
+}
+
+// OrchestrationStatuses looks up the statuses of several of a project's orchestrations at once
+func (p *PlanEngine) OrchestrationStatuses(projectID string, ids []string) OrchestrationStatusResponse {
+	response := OrchestrationStatusResponse{
+		Orchestrations: make([]OrchestrationStatus, 0, len(ids)),
+		NotFound:       make([]string, 0),
+	}
+	seen := make(map[string]struct{}, len(ids))
+
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		orchestration, ok := p.orchestrationStore[id]
+		if !ok || orchestration.ProjectID != projectID {
+			response.NotFound = append(response.NotFound, id)
+			continue
+		}
+		response.Orchestrations = append(response.Orchestrations, OrchestrationStatus{
+			ID:        orchestration.ID,
+			Status:    orchestration.Status,
+			Error:     orchestration.Error,
+			Timestamp: orchestration.Timestamp,
+		})
+	}
+	return response
+}
+
+// OrchestrationStatusHandler reports the statuses of many of the caller's orchestrations in one request, for
+// dashboards tracking concurrent runs
+func (app *App) OrchestrationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	var request orchestrationStatusRequest
+	if err := decodeRequest(w, r, &request, orchestrationStatusFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	switch {
+	case len(request.IDs) == 0:
+		httpErrorResponse(w, app.requestLogger(r), missingField("ids"))
+		return
+	case len(request.IDs) > MaxOrchestrationStatusIDs:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("ids"), fmt.Sprintf("at most %d orchestrations can be looked up at once", MaxOrchestrationStatusIDs)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.Engine.OrchestrationStatuses(project.ID, request.IDs)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
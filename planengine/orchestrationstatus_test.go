@@ -0,0 +1,64 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrchestrationStatusHandler(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	for _, o := range []*Orchestration{
+		{ID: "o_running", ProjectID: project.ID, Status: Processing, Timestamp: now},
+		{ID: "o_failed", ProjectID: project.ID, Status: Failed, Error: json.RawMessage(`"service unavailable"`), Timestamp: now},
+		{ID: "o_other", ProjectID: "other-project", Status: Completed, Timestamp: now},
+	} {
+		app.Engine.orchestrationStore[o.ID] = o
+	}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/status", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(`{"ids":["o_failed","o_running","o_other","o_missing","o_failed"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response OrchestrationStatusResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response.Orchestrations, 2, "duplicates are reported once")
+	assert.Equal(t, "o_failed", response.Orchestrations[0].ID)
+	assert.Equal(t, Failed, response.Orchestrations[0].Status)
+	assert.JSONEq(t, `"service unavailable"`, string(response.Orchestrations[0].Error))
+	assert.Equal(t, "o_running", response.Orchestrations[1].ID)
+	assert.Equal(t, Processing, response.Orchestrations[1].Status)
+	assert.Equal(t, []string{"o_other", "o_missing"}, response.NotFound, "other projects' orchestrations aren't revealed")
+
+	tooMany := make([]string, MaxOrchestrationStatusIDs+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%q", fmt.Sprintf("o_%d", i))
+	}
+	for _, body := range []string{`{"ids":[]}`, `{}`, `{"ids":[` + strings.Join(tooMany, ",") + `]}`} {
+		assert.Equal(t, http.StatusBadRequest, send(body).Code)
+	}
+}
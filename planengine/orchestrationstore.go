@@ -7,7 +7,6 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -15,7 +14,12 @@ import (
 )
 
 var (
-	ErrOrchestrationNotFound = errors.New("orchestration not found")
+	ErrOrchestrationNotFound     = errors.New("orchestration not found")
+	ErrOrchestrationFinished     = errors.New("orchestration has already finished")
+	ErrOrchestrationNotPausable  = errors.New("only processing orchestrations can be paused")
+	ErrOrchestrationNotResumable = errors.New("only paused orchestrations can be resumed")
+	ErrOrchestrationNotRetryable = errors.New("only failed or timed out orchestrations can be retried")
+	ErrOrchestrationUnfinished   = errors.New("orchestration has not finished, force its deletion to cancel it first")
 )
 
 // StoreOrchestration persists an orchestration
@@ -23,7 +27,7 @@ func (b *BadgerDB) StoreOrchestration(orchestration *Orchestration) error {
 	return b.db.Update(func(txn *badger.Txn) error {
 		// Store orchestration data
 		oKey := fmt.Sprintf("orchestration:info:%s", orchestration.ID)
-		oData, err := json.Marshal(orchestration)
+		oData, err := b.encodePayload(orchestration)
 		if err != nil {
 			return fmt.Errorf("failed to marshal orchestration: %w", err)
 		}
@@ -60,7 +64,7 @@ func (b *BadgerDB) LoadOrchestration(id string) (*Orchestration, error) {
 		}
 
 		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &orchestration)
+			return b.decodePayload(val, &orchestration)
 		})
 	})
 
@@ -107,3 +111,16 @@ func (b *BadgerDB) ListProjectOrchestrations(projectID string) ([]*Orchestration
 
 	return orchestrations, nil
 }
+
+// DeleteOrchestration removes an orchestration and its project index entry
+func (b *BadgerDB) DeleteOrchestration(orchestration *Orchestration) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete([]byte(fmt.Sprintf("orchestration:info:%s", orchestration.ID))); err != nil {
+			return fmt.Errorf("failed to delete orchestration: %w", err)
+		}
+		if err := txn.Delete([]byte(fmt.Sprintf("orchestration:project:%s:%s", orchestration.ProjectID, orchestration.ID))); err != nil {
+			return fmt.Errorf("failed to delete project orchestration index: %w", err)
+		}
+		return nil
+	})
+}
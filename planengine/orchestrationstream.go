@@ -0,0 +1,202 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	OrchestrationStreamStatus     = "status"
+	OrchestrationStreamTaskStatus = "task_status"
+	OrchestrationStreamTaskResult = "task_result"
+	// orchestrationStreamInterval is how often a stream checks for changes, like the workers tailing a log
+	orchestrationStreamInterval = 100 * time.Millisecond
+	// orchestrationStreamKeepAlive is how long a stream may go quiet before a comment keeps proxies from closing it
+	orchestrationStreamKeepAlive = 15 * time.Second
+)
+
+// OrchestrationStatusChange is streamed whenever an orchestration's status changes, once it has finished it
+// carries the orchestration's results or error
+type OrchestrationStatusChange struct {
+	OrchestrationID string            `json:"orchestrationId"`
+	Status          Status            `json:"status"`
+	Timestamp       time.Time         `json:"timestamp"`
+	Results         []json.RawMessage `json:"results,omitempty"`
+	Error           json.RawMessage   `json:"error,omitempty"`
+}
+
+// TaskResultEvent is streamed as a task's output is logged
+type TaskResultEvent struct {
+	OrchestrationID string          `json:"orchestrationId"`
+	TaskID          string          `json:"taskId"`
+	ServiceID       string          `json:"serviceId,omitempty"`
+	Output          json.RawMessage `json:"output"`
+	Timestamp       time.Time       `json:"timestamp"`
+}
+
+func (p *PlanEngine) orchestrationStatusChange(orchestrationID string) (OrchestrationStatusChange, bool) {
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		return OrchestrationStatusChange{}, false
+	}
+	change := OrchestrationStatusChange{
+		OrchestrationID: orchestrationID,
+		Status:          orchestration.Status,
+		Timestamp:       orchestration.Timestamp,
+	}
+	if orchestrationFinished(orchestration.Status) {
+		change.Results = orchestration.Results
+		change.Error = orchestration.Error
+	}
+	return change, true
+}
+
+// streamEvent maps a log entry to the event streamed for it, it returns no event for entries that aren't streamed
+func streamEvent(orchestrationID string, entry LogEntry) (string, any) {
+	switch entry.GetEntryType() {
+	case "task_status":
+		var event TaskStatusEvent
+		if err := json.Unmarshal(entry.GetValue(), &event); err != nil {
+			return "", nil
+		}
+		return OrchestrationStreamTaskStatus, event
+	case "task_output":
+		if entry.GetID() == TaskZero || entry.GetProducerID() == ConditionProducerID {
+			return "", nil
+		}
+		return OrchestrationStreamTaskResult, TaskResultEvent{
+			OrchestrationID: orchestrationID,
+			TaskID:          entry.GetID(),
+			ServiceID:       entry.GetProducerID(),
+			Output:          entry.GetValue(),
+			Timestamp:       entry.GetTimestamp(),
+		}
+	}
+	return "", nil
+}
+
+func writeStreamEvent(w io.Writer, event, id string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// OrchestrationEventsHandler streams one of the project's orchestrations as Server-Sent Events, its status
+// changes and its tasks' statuses and results, until it finishes or the client goes away. Task events carry
+// their log offset as their ID, so clients reconnecting with Last-Event-ID pick up where they left off.
+func (app *App) OrchestrationEventsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	orchestrationID := mux.Vars(r)["id"]
+	if !app.Engine.OrchestrationBelongsToProject(orchestrationID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
+		return
+	}
+
+	var offset uint64
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if last, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+			offset = last + 1
+		}
+	}
+
+	// Streams outlive the server's write timeout, they end when the orchestration does
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(orchestrationStreamInterval)
+	defer ticker.Stop()
+
+	var last *OrchestrationStatusChange
+	lastWrite := time.Now()
+	for {
+		// The status is read before the log, so the task events logged before an orchestration finished are
+		// streamed ahead of its final status
+		change, exists := app.Engine.orchestrationStatusChange(orchestrationID)
+		if !exists {
+			return
+		}
+
+		wrote := false
+		if app.Engine.LogManager != nil {
+			if log := app.Engine.LogManager.GetLog(orchestrationID); log != nil {
+				for _, entry := range log.ReadFrom(offset) {
+					offset = entry.GetOffset() + 1
+					event, data := streamEvent(orchestrationID, entry)
+					if event == "" {
+						continue
+					}
+					if err := writeStreamEvent(w, event, strconv.FormatUint(entry.GetOffset(), 10), data); err != nil {
+						return
+					}
+					wrote = true
+				}
+			}
+		}
+
+		if last == nil || last.Status != change.Status {
+			if err := writeStreamEvent(w, OrchestrationStreamStatus, "", change); err != nil {
+				return
+			}
+			last = &change
+			wrote = true
+		}
+
+		if !wrote && time.Since(lastWrite) >= orchestrationStreamKeepAlive {
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			wrote = true
+		}
+		if wrote {
+			lastWrite = time.Now()
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+
+		if orchestrationFinished(change.Status) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type streamedEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func readStreamedEvents(t *testing.T, scanner *bufio.Scanner, n int) []streamedEvent {
+	t.Helper()
+	var events []streamedEvent
+	var current streamedEvent
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.event != "" {
+				events = append(events, current)
+			}
+			current = streamedEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	require.Len(t, events, n)
+	return events
+}
+
+func TestOrchestrationEventsStream(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	orchestration := &Orchestration{
+		ID:        "o_stream",
+		ProjectID: project.ID,
+		Status:    Processing,
+		Plan:      &ExecutionPlan{Tasks: []*SubTask{{ID: TaskZero}, {ID: "task1", Service: "s_payments"}}},
+	}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+	logManager.PrepLogForOrchestration(project.ID, orchestration.ID, orchestration.Plan)
+	logManager.AppendToLog(orchestration.ID, "task_output", TaskZero, json.RawMessage(`{"orderId":"o-1"}`), "control-panel", 0)
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	openStream := func(lastEventID string) (*http.Response, *bufio.Scanner) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/orchestrations/o_stream/events", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp, bufio.NewScanner(resp.Body)
+	}
+
+	resp, scanner := openStream("")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := readStreamedEvents(t, scanner, 1)
+	assert.Equal(t, OrchestrationStreamStatus, events[0].event)
+	assert.Contains(t, events[0].data, `"status":"processing"`)
+
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_payments", Completed, nil, time.Now().UTC(), 0))
+	logManager.AppendToLog(orchestration.ID, "task_output", "task1", json.RawMessage(`{"charged":true}`), "s_payments", 0)
+	app.Engine.orchestrationStoreMu.Lock()
+	orchestration.Status = Completed
+	orchestration.Results = []json.RawMessage{json.RawMessage(`{"charged":true}`)}
+	app.Engine.orchestrationStoreMu.Unlock()
+
+	events = readStreamedEvents(t, scanner, 3)
+	assert.Equal(t, OrchestrationStreamTaskStatus, events[0].event)
+	assert.Equal(t, "1", events[0].id)
+	assert.Contains(t, events[0].data, `"status":"completed"`)
+
+	assert.Equal(t, OrchestrationStreamTaskResult, events[1].event)
+	assert.Equal(t, "2", events[1].id)
+	var result TaskResultEvent
+	require.NoError(t, json.Unmarshal([]byte(events[1].data), &result))
+	assert.Equal(t, "task1", result.TaskID)
+	assert.JSONEq(t, `{"charged":true}`, string(result.Output))
+
+	assert.Equal(t, OrchestrationStreamStatus, events[2].event)
+	var change OrchestrationStatusChange
+	require.NoError(t, json.Unmarshal([]byte(events[2].data), &change))
+	assert.Equal(t, Completed, change.Status)
+	require.Len(t, change.Results, 1)
+	assert.False(t, scanner.Scan(), "the stream ends once the orchestration finishes")
+
+	t.Run("reconnecting resumes after the last event", func(t *testing.T) {
+		resp, scanner := openStream("1")
+		defer resp.Body.Close()
+
+		events := readStreamedEvents(t, scanner, 2)
+		assert.Equal(t, OrchestrationStreamTaskResult, events[0].event)
+		assert.Equal(t, OrchestrationStreamStatus, events[1].event)
+	})
+
+	t.Run("other projects' orchestrations can't be streamed", func(t *testing.T) {
+		app.Engine.orchestrationStore["o_other"] = &Orchestration{ID: "o_other", ProjectID: "p_other", Status: Processing}
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/o_other/events", nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -20,8 +20,11 @@ type OrchestrationView struct {
 	ID           string               `json:"id"`
 	Action       string               `json:"action"`
 	Status       Status               `json:"status"`
+	Priority     Priority             `json:"priority,omitempty"`
 	Error        json.RawMessage      `json:"error,omitempty"`
 	Timestamp    time.Time            `json:"timestamp"`
+	RunAt        *time.Time           `json:"runAt,omitempty"`
+	Labels       map[string]string    `json:"labels,omitempty"`
 	Compensation *CompensationSummary `json:"compensation,omitempty"`
 }
 
@@ -33,19 +36,35 @@ type CompensationSummary struct {
 }
 
 type OrchestrationListView struct {
+	Scheduled     []OrchestrationView `json:"scheduled,omitempty"`
+	Queued        []OrchestrationView `json:"queued,omitempty"`
 	Pending       []OrchestrationView `json:"pending,omitempty"`
 	Processing    []OrchestrationView `json:"processing,omitempty"`
 	Completed     []OrchestrationView `json:"completed,omitempty"`
 	Failed        []OrchestrationView `json:"failed,omitempty"`
+	TimedOut      []OrchestrationView `json:"timedOut,omitempty"`
 	NotActionable []OrchestrationView `json:"notActionable,omitempty"`
+	// Orchestrations is the requested page of orchestrations when the list is paginated, and is empty otherwise
+	Orchestrations []OrchestrationView `json:"orchestrations,omitempty"`
+	// Total counts the orchestrations passing the filters, across all pages
+	Total      int    `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 type OrchestrationInspectResponse struct {
 	ID        string                `json:"id"`
+	ParentID  string                `json:"parentId,omitempty"`
+	RetryOf   string                `json:"retryOf,omitempty"`
+	CloneOf   string                `json:"cloneOf,omitempty"`
+	Chain     *ContinuationChain    `json:"chain,omitempty"`
+	Children  []OrchestrationLink   `json:"children,omitempty"`
 	Status    Status                `json:"status"`
 	Action    string                `json:"action"`
 	Timestamp time.Time             `json:"timestamp"`
 	Error     json.RawMessage       `json:"error,omitempty"`
+	Budget    *Budget               `json:"budget,omitempty"`
+	Usage     *OrchestrationUsage   `json:"usage,omitempty"`
+	SLA       *SLAStatus            `json:"sla,omitempty"`
 	Tasks     []TaskInspectResponse `json:"tasks,omitempty"`
 	Results   []json.RawMessage     `json:"results,omitempty"`
 	Duration  time.Duration         `json:"duration"` // Time since orchestration started
@@ -53,6 +72,8 @@ type OrchestrationInspectResponse struct {
 
 type TaskInspectResponse struct {
 	ID                  string                    `json:"id"`
+	Type                string                    `json:"type,omitempty"`
+	ChildID             string                    `json:"childOrchestrationId,omitempty"`
 	ServiceID           string                    `json:"serviceId"`
 	ServiceName         string                    `json:"serviceName"` // Added service name
 	Status              Status                    `json:"status"`
@@ -99,29 +120,33 @@ type taskLookupMaps struct {
 
 type task0Values map[string]interface{}
 
-func (p *PlanEngine) GetOrchestrationList(projectID string) OrchestrationListView {
-	// Get orchestrations for this project
-	orchestrations := p.getProjectOrchestrations(projectID)
-
-	// Convert to view objects and group by status
-	grouped := make(map[Status][]OrchestrationView)
-	for _, o := range orchestrations {
-		view := OrchestrationView{
-			ID:        o.ID,
-			Action:    o.Action.Content,
-			Status:    o.Status,
-			Error:     o.Error,
-			Timestamp: o.Timestamp,
+// GetOrchestrationList lists the project's orchestrations passing the query's filters, grouped by status with the
+// newest first. Paginated queries list a page of them in the query's sort order instead.
+func (p *PlanEngine) GetOrchestrationList(projectID string, query OrchestrationQuery) OrchestrationListView {
+	var matching []*Orchestration
+	for _, o := range p.getProjectOrchestrations(projectID) {
+		if query.Matches(o) {
+			matching = append(matching, o)
 		}
+	}
 
-		if o.Status == Failed {
-			if log := p.LogManager.GetLog(o.ID); log != nil {
-				entries := log.ReadFrom(0)
-				view.Compensation = p.processCompensationSummary(entries, o.Plan)
-			}
+	if query.paginated() {
+		page, nextCursor := query.paginate(matching)
+		list := OrchestrationListView{
+			Orchestrations: make([]OrchestrationView, 0, len(page)),
+			Total:          len(matching),
+			NextCursor:     nextCursor,
 		}
+		for _, o := range page {
+			list.Orchestrations = append(list.Orchestrations, p.orchestrationListEntry(o))
+		}
+		return list
+	}
 
-		grouped[o.Status] = append(grouped[o.Status], view)
+	// Convert to view objects and group by status
+	grouped := make(map[Status][]OrchestrationView)
+	for _, o := range matching {
+		grouped[o.Status] = append(grouped[o.Status], p.orchestrationListEntry(o))
 	}
 
 	// Sort each group by timestamp (newest first)
@@ -132,14 +157,39 @@ func (p *PlanEngine) GetOrchestrationList(projectID string) OrchestrationListVie
 	}
 
 	return OrchestrationListView{
+		Scheduled:     grouped[Scheduled],
+		Queued:        grouped[Queued],
 		Pending:       grouped[Pending],
 		Processing:    grouped[Processing],
 		Completed:     grouped[Completed],
 		Failed:        grouped[Failed],
+		TimedOut:      grouped[TimedOut],
 		NotActionable: grouped[NotActionable],
+		Total:         len(matching),
 	}
 }
 
+func (p *PlanEngine) orchestrationListEntry(o *Orchestration) OrchestrationView {
+	view := OrchestrationView{
+		ID:        o.ID,
+		Action:    o.Action.Content,
+		Status:    o.Status,
+		Priority:  o.Priority,
+		Error:     o.Error,
+		Timestamp: o.Timestamp,
+		RunAt:     o.RunAt,
+		Labels:    o.Labels,
+	}
+
+	if o.Status == Failed || o.Status == TimedOut {
+		if log := p.LogManager.GetLog(o.ID); log != nil {
+			entries := log.ReadFrom(0)
+			view.Compensation = p.processCompensationSummary(entries, o.Plan)
+		}
+	}
+	return view
+}
+
 func (p *PlanEngine) processCompensationSummary(entries []LogEntry, plan *ExecutionPlan) *CompensationSummary {
 	if plan == nil {
 		return nil
@@ -227,19 +277,37 @@ func (p *PlanEngine) getProjectOrchestrations(projectID string) []*Orchestration
 }
 
 func (p *PlanEngine) InspectOrchestration(orchestrationID string) (*OrchestrationInspectResponse, error) {
+	return p.inspectOrchestration(orchestrationID, true)
+}
+
+// inspectOrchestration inspects an orchestration, leaving out its tasks unless they're wanted since building them
+// is most of the work
+func (p *PlanEngine) inspectOrchestration(orchestrationID string, withTasks bool) (*OrchestrationInspectResponse, error) {
 	// Get orchestration with appropriate locking
 	orchestration, err := p.getOrchestration(orchestrationID)
 	if err != nil {
 		return nil, err
 	}
 
+	usage := p.orchestrationUsage(orchestrationID)
+	sla := p.orchestrationSLA(orchestrationID)
+	chain := p.orchestrationChain(orchestrationID)
+
 	if orchestration.FailedBeforeDecomposition() {
 		return &OrchestrationInspectResponse{
 			ID:        orchestration.ID,
+			ParentID:  orchestration.ParentID,
+			RetryOf:   orchestration.RetryOf,
+			CloneOf:   orchestration.CloneOf,
+			Chain:     chain,
+			Children:  orchestration.Children,
 			Status:    Failed,
 			Action:    orchestration.Action.Content,
 			Timestamp: orchestration.Timestamp,
 			Error:     orchestration.Error,
+			Budget:    orchestration.Budget,
+			Usage:     usage,
+			SLA:       sla,
 			Duration:  time.Since(orchestration.Timestamp),
 		}, nil
 	}
@@ -247,49 +315,76 @@ func (p *PlanEngine) InspectOrchestration(orchestrationID string) (*Orchestratio
 	if orchestration.Status == NotActionable {
 		return &OrchestrationInspectResponse{
 			ID:        orchestration.ID,
+			ParentID:  orchestration.ParentID,
+			RetryOf:   orchestration.RetryOf,
+			CloneOf:   orchestration.CloneOf,
+			Chain:     chain,
+			Children:  orchestration.Children,
 			Status:    NotActionable,
 			Action:    orchestration.Action.Content,
 			Timestamp: orchestration.Timestamp,
 			Error:     orchestration.Error,
+			Budget:    orchestration.Budget,
+			Usage:     usage,
+			SLA:       sla,
 			Duration:  time.Since(orchestration.Timestamp),
 		}, nil
 	}
 
-	if orchestration.Status == Cancelled {
+	if orchestration.Status == Cancelled || orchestration.Status == Scheduled || orchestration.Status == Queued {
 		return &OrchestrationInspectResponse{
 			ID:        orchestration.ID,
-			Status:    Cancelled,
+			ParentID:  orchestration.ParentID,
+			RetryOf:   orchestration.RetryOf,
+			CloneOf:   orchestration.CloneOf,
+			Chain:     chain,
+			Children:  orchestration.Children,
+			Status:    orchestration.Status,
 			Action:    orchestration.Action.Content,
 			Timestamp: orchestration.Timestamp,
 			Error:     orchestration.Error,
+			Budget:    orchestration.Budget,
+			Usage:     usage,
+			SLA:       sla,
 			Duration:  time.Since(orchestration.Timestamp),
 		}, nil
 	}
 
-	// Build lookup maps for constructing the response
-	lookupMaps, err := p.buildLookupMaps(orchestrationID, orchestration)
-	if err != nil {
-		return nil, err
-	}
+	var tasks []TaskInspectResponse
+	if withTasks {
+		// Build lookup maps for constructing the response
+		lookupMaps, err := p.buildLookupMaps(orchestrationID, orchestration)
+		if err != nil {
+			return nil, err
+		}
 
-	// Build task responses
-	tasks, err := p.buildTaskResponses(orchestration, lookupMaps)
-	if err != nil {
-		return nil, err
-	}
+		// Build task responses
+		tasks, err = p.buildTaskResponses(orchestration, lookupMaps)
+		if err != nil {
+			return nil, err
+		}
 
-	p.Logger.Trace().
-		Str("OrchestrationID", orchestrationID).
-		Interface("Tasks", tasks).
-		Msg("task responses")
+		p.Logger.Trace().
+			Str("OrchestrationID", orchestrationID).
+			Interface("Tasks", tasks).
+			Msg("task responses")
+	}
 
 	// Construct final response
 	return &OrchestrationInspectResponse{
 		ID:        orchestration.ID,
+		ParentID:  orchestration.ParentID,
+		RetryOf:   orchestration.RetryOf,
+		CloneOf:   orchestration.CloneOf,
+		Chain:     chain,
+		Children:  orchestration.Children,
 		Status:    orchestration.Status,
 		Action:    orchestration.Action.Content,
 		Timestamp: orchestration.Timestamp,
 		Error:     orchestration.Error,
+		Budget:    orchestration.Budget,
+		Usage:     usage,
+		SLA:       sla,
 		Tasks:     tasks,
 		Duration:  time.Since(orchestration.Timestamp),
 		Results:   orchestration.Results,
@@ -473,6 +568,7 @@ func (p *PlanEngine) buildSingleTaskResponse(
 
 	taskResp := TaskInspectResponse{
 		ID:            task.ID,
+		Type:          task.Type,
 		ServiceID:     task.Service,
 		ServiceName:   lookupMaps.serviceNames[task.Service],
 		Status:        finalStatus, // Use the determined final status
@@ -522,6 +618,21 @@ func (p *PlanEngine) buildSingleTaskResponse(
 		taskResp.InterimResults = interimResults
 	}
 
+	// Approval and sub-orchestration steps aren't run by a service
+	switch task.Type {
+	case TaskTypeApproval:
+		taskResp.ServiceName = task.ServiceName
+		return taskResp, nil
+	case TaskTypeOrchestration:
+		taskResp.ServiceName = task.ServiceName
+		for _, child := range orchestration.Children {
+			if child.TaskID == task.ID {
+				taskResp.ChildID = child.ID
+			}
+		}
+		return taskResp, nil
+	}
+
 	service, err := p.GetServiceByID(task.Service)
 	if err != nil {
 		return TaskInspectResponse{}, fmt.Errorf("error getting service: %w", err)
@@ -636,7 +747,7 @@ func resolveTask0Ref(ref string, task0Vals task0Values) (interface{}, error) {
 	}
 
 	field := strings.TrimPrefix(ref, "$task0.")
-	value, ok := task0Vals[field]
+	value, ok := selectField(task0Vals, field)
 	if !ok {
 		return nil, fmt.Errorf("task0 field not found: %s", field)
 	}
@@ -0,0 +1,258 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PlanValidationIssue is a planned task input that doesn't fit the declared schema of the task's service
+type PlanValidationIssue struct {
+	TaskID  string `json:"taskId"`
+	Service string `json:"service"`
+	Input   string `json:"input"`
+	Message string `json:"message"`
+}
+
+func (i PlanValidationIssue) Error() string {
+	return fmt.Sprintf("task %s input %s for service %s: %s", i.TaskID, i.Input, i.Service, i.Message)
+}
+
+// PlanValidationReport lists every schema mismatch found in a plan, so they can all be fixed at once
+type PlanValidationReport struct {
+	Issues []PlanValidationIssue `json:"issues"`
+}
+
+func (r *PlanValidationReport) Error() string {
+	messages := make([]string, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		messages = append(messages, issue.Error())
+	}
+	return fmt.Sprintf("%d input(s) do not match service schemas: %s", len(r.Issues), strings.Join(messages, "; "))
+}
+
+// Unwrap exposes the individual issues, preparation retries feed them back to the planner one by one
+func (r *PlanValidationReport) Unwrap() []error {
+	out := make([]error, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		out = append(out, issue)
+	}
+	return out
+}
+
+// validatePlanAgainstSchemas checks every service task's inputs against the input schema of its service.
+// Literal values and action params are type checked as they are, references to other tasks' outputs
+// must name an output the upstream service declares with a compatible type.
+func validatePlanAgainstSchemas(plan *ExecutionPlan, taskZero map[string]any, services []*ServiceInfo) error {
+	serviceMap := make(map[string]*ServiceInfo, len(services))
+	for _, service := range services {
+		serviceMap[service.ID] = service
+	}
+	tasks := make(map[string]*SubTask, len(plan.Tasks))
+	for _, task := range plan.Tasks {
+		tasks[task.ID] = task
+	}
+
+	report := &PlanValidationReport{}
+	for _, task := range plan.Tasks {
+		if task.Type != "" {
+			continue
+		}
+		service, ok := serviceMap[task.Service]
+		if !ok {
+			continue
+		}
+
+		for inputKey, value := range task.Input {
+			expected, declared := service.Schema.Input.Properties[inputKey]
+			if !declared {
+				continue
+			}
+			// Fanned out tasks receive one element at a time, so the plan holds an array of them
+			if task.FanOut != nil && task.FanOut.Input == inputKey {
+				element := expected
+				expected = Spec{Type: "array", Items: &element}
+			}
+
+			issue := func(message string) {
+				report.Issues = append(report.Issues, PlanValidationIssue{TaskID: task.ID, Service: service.ID, Input: inputKey, Message: message})
+			}
+
+			dep, depKey := extractDependencyIDAndKey(value)
+			switch {
+			case dep == "":
+				for _, message := range checkValueAgainstSpec(inputKey, value, expected) {
+					issue(message)
+				}
+			case dep == TaskZero:
+				param, exists := selectField(taskZero, depKey)
+				if !exists {
+					issue(fmt.Sprintf("references missing action param %s", depKey))
+					continue
+				}
+				for _, message := range checkValueAgainstSpec(inputKey, param, expected) {
+					issue(message)
+				}
+			default:
+				upstream, exists := tasks[dep]
+				if !exists {
+					issue(fmt.Sprintf("references unknown task %s", dep))
+					continue
+				}
+				upstreamService, ok := serviceMap[upstream.Service]
+				// Outputs can only be checked against services declaring them
+				if upstream.Type != "" || !ok || len(upstreamService.Schema.Output.Properties) == 0 {
+					continue
+				}
+				output, declared := selectSpec(upstreamService.Schema.Output, depKey)
+				if !declared {
+					issue(fmt.Sprintf("references output %s which service %s does not declare", depKey, upstreamService.ID))
+					continue
+				}
+				if !compatibleSpecs(output, expected) {
+					issue(fmt.Sprintf("expects %s but output %s of task %s is %s", describeSpec(expected), depKey, dep, describeSpec(output)))
+				}
+			}
+		}
+	}
+
+	if len(report.Issues) > 0 {
+		return report
+	}
+	return nil
+}
+
+// compatibleSpecs reports whether an output described by from can be passed to an input described by to
+func compatibleSpecs(from, to Spec) bool {
+	switch {
+	case from.Type == "" || to.Type == "":
+		return true
+	case from.Type == "integer" && to.Type == "number":
+		return true
+	case from.Type != to.Type:
+		return false
+	case from.Type == "array" && from.Items != nil && to.Items != nil:
+		return compatibleSpecs(*from.Items, *to.Items)
+	}
+	return true
+}
+
+// checkValueAgainstSpec returns a message for each way the value doesn't fit the spec
+func checkValueAgainstSpec(path string, value any, spec Spec) []string {
+	mismatch := func() []string {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, describeSpec(spec), jsonTypeOf(value))}
+	}
+
+	switch spec.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return mismatch()
+		}
+	case "number", "integer":
+		number, ok := numberOf(value)
+		if !ok || (spec.Type == "integer" && number != math.Trunc(number)) {
+			return mismatch()
+		}
+		if spec.Minimum != 0 && number < float64(spec.Minimum) {
+			return []string{fmt.Sprintf("%s: %v is less than the minimum of %d", path, value, spec.Minimum)}
+		}
+		if spec.Maximum != 0 && number > float64(spec.Maximum) {
+			return []string{fmt.Sprintf("%s: %v is greater than the maximum of %d", path, value, spec.Maximum)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch()
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		var messages []string
+		for _, field := range spec.Required {
+			if _, present := object[field]; !present {
+				messages = append(messages, fmt.Sprintf("%s.%s: is required", path, field))
+			}
+		}
+		fields := make([]string, 0, len(object))
+		for field := range object {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fieldSpec, declared := spec.Properties[field]
+			// Optional fields may be null, SDKs send unset optional fields that way
+			if !declared || (object[field] == nil && !slices.Contains(spec.Required, field)) {
+				continue
+			}
+			messages = append(messages, checkValueAgainstSpec(path+"."+field, object[field], fieldSpec)...)
+		}
+		return messages
+	case "array":
+		elements, ok := value.([]any)
+		if !ok {
+			return mismatch()
+		}
+		if spec.Items == nil {
+			return nil
+		}
+		var messages []string
+		for i, element := range elements {
+			messages = append(messages, checkValueAgainstSpec(fmt.Sprintf("%s[%d]", path, i), element, *spec.Items)...)
+		}
+		return messages
+	}
+	return nil
+}
+
+func numberOf(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func describeSpec(spec Spec) string {
+	if spec.Type == "array" && spec.Items != nil && spec.Items.Type != "" {
+		return fmt.Sprintf("array of %s", spec.Items.Type)
+	}
+	return spec.Type
+}
+
+func jsonTypeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if _, ok := numberOf(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
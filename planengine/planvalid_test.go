@@ -0,0 +1,139 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePlanAgainstSchemas(t *testing.T) {
+	services := []*ServiceInfo{
+		{
+			ID: "s_orders",
+			Schema: ServiceSchema{
+				Input: Spec{Type: "object", Properties: map[string]Spec{
+					"id":       {Type: "string"},
+					"quantity": {Type: "integer", Minimum: 1, Maximum: 10},
+					"address": {Type: "object", Required: []string{"city"}, Properties: map[string]Spec{
+						"city": {Type: "string"},
+					}},
+				}},
+				Output: Spec{Type: "object", Properties: map[string]Spec{
+					"total": {Type: "number"},
+					"items": {Type: "array", Items: &Spec{Type: "string"}},
+				}},
+			},
+		},
+		{
+			ID: "s_invoice",
+			Schema: ServiceSchema{
+				Input: Spec{Type: "object", Properties: map[string]Spec{
+					"amount": {Type: "number"},
+					"sku":    {Type: "string"},
+				}},
+			},
+		},
+	}
+	taskZero := map[string]any{"orderId": "o-1", "count": float64(2), "city": "Paris"}
+
+	tests := []struct {
+		name   string
+		tasks  []*SubTask
+		issues []PlanValidationIssue
+	}{
+		{
+			name: "valid plan",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{"id": "$task0.orderId", "quantity": "$task0.count", "address": map[string]any{"city": "Paris"}}},
+				{ID: "task2", Service: "s_invoice", Input: map[string]any{"amount": "$task1.total", "sku": "sku-1"}},
+			},
+		},
+		{
+			name: "action param of the wrong type",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{"id": "$task0.count"}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task1", Service: "s_orders", Input: "id", Message: "id: expected string, got number"}},
+		},
+		{
+			name: "literal out of range",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{"quantity": float64(11)}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task1", Service: "s_orders", Input: "quantity", Message: "quantity: 11 is greater than the maximum of 10"}},
+		},
+		{
+			name: "fractional integer",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{"quantity": 1.5}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task1", Service: "s_orders", Input: "quantity", Message: "quantity: expected integer, got number"}},
+		},
+		{
+			name: "nested object missing a required field",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{"address": map[string]any{}}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task1", Service: "s_orders", Input: "address", Message: "address.city: is required"}},
+		},
+		{
+			name: "missing action param",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{"id": "$task0.customerId"}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task1", Service: "s_orders", Input: "id", Message: "references missing action param customerId"}},
+		},
+		{
+			name: "undeclared upstream output",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{}},
+				{ID: "task2", Service: "s_invoice", Input: map[string]any{"amount": "$task1.subtotal"}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task2", Service: "s_invoice", Input: "amount", Message: "references output subtotal which service s_orders does not declare"}},
+		},
+		{
+			name: "incompatible upstream output",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{}},
+				{ID: "task2", Service: "s_invoice", Input: map[string]any{"sku": "$task1.items"}},
+			},
+			issues: []PlanValidationIssue{{TaskID: "task2", Service: "s_invoice", Input: "sku", Message: "expects string but output items of task task1 is array of string"}},
+		},
+		{
+			name: "fanned out input takes an array of the declared type",
+			tasks: []*SubTask{
+				{ID: "task1", Service: "s_orders", Input: map[string]any{}},
+				{ID: "task2", Service: "s_invoice", Input: map[string]any{"sku": "$task1.items"}, FanOut: &FanOut{Input: "sku"}},
+			},
+		},
+		{
+			name: "approval steps are skipped",
+			tasks: []*SubTask{
+				{ID: "approval_task1", Type: TaskTypeApproval, Service: "s_invoice", Input: map[string]any{"amount": "pending"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePlanAgainstSchemas(&ExecutionPlan{Tasks: tt.tasks}, taskZero, services)
+			if len(tt.issues) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var report *PlanValidationReport
+			require.True(t, errors.As(err, &report))
+			assert.Equal(t, tt.issues, report.Issues)
+			assert.Len(t, report.Unwrap(), len(tt.issues))
+		})
+	}
+}
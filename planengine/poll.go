@@ -0,0 +1,237 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	pollSessionBufferSize = 256
+	pollBatchSize         = 32
+	defaultPollWait       = 20 * time.Second
+	maxPollWait           = 30 * time.Second
+	// pollIdleTimeout is how long a polling service may go without polling before it's treated as disconnected
+	pollIdleTimeout = 2 * maxPollWait
+)
+
+// pollSession adapts a service polling for its tasks over plain HTTP to a serviceSession, for networks that block
+// WebSockets. Tasks queue until the service next polls, the service posts its results back over HTTP.
+type pollSession struct {
+	wsm       *WebSocketManager
+	serviceID string
+	outbound  chan []byte
+	lastPoll  atomic.Int64
+	done      chan struct{}
+	closeOnce sync.Once
+	keys      map[string]any
+	keysMu    sync.RWMutex
+}
+
+func newPollSession(wsm *WebSocketManager, serviceID string) *pollSession {
+	s := &pollSession{
+		wsm:       wsm,
+		serviceID: serviceID,
+		outbound:  make(chan []byte, pollSessionBufferSize),
+		done:      make(chan struct{}),
+		keys:      make(map[string]any),
+	}
+	s.touch()
+	return s
+}
+
+// pollSession returns the session of a service instance polling for its tasks, if it's polled recently
+func (wsm *WebSocketManager) pollSession(serviceID, instanceID string) *pollSession {
+	for _, s := range wsm.instanceSessions(serviceID) {
+		if session, ok := s.(*pollSession); ok && sessionInstanceID(session) == instanceID {
+			return session
+		}
+	}
+	return nil
+}
+
+// Write queues a message until the service next polls. A polling service can't answer pings, so the session answers
+// them itself for as long as the service keeps polling.
+func (s *pollSession) Write(message []byte) error {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return fmt.Errorf("failed to read message type: %w", err)
+	}
+	if envelope.Type == WSPing {
+		if time.Since(time.Unix(0, s.lastPoll.Load())) < pollIdleTimeout {
+			s.Set("lastPong", time.Now().UTC())
+		}
+		return nil
+	}
+	if !slices.Contains(callbackMessageTypes, envelope.Type) {
+		return nil
+	}
+
+	select {
+	case <-s.done:
+		return fmt.Errorf("poll session for service %s is closed", s.serviceID)
+	default:
+	}
+	select {
+	case s.outbound <- message:
+		return nil
+	default:
+		return fmt.Errorf("poll session message buffer is full")
+	}
+}
+
+// Close stops queuing messages, as there's no socket to close the WebSocketManager is told directly
+func (s *pollSession) Close() error {
+	closed := false
+	s.closeOnce.Do(func() {
+		close(s.done)
+		closed = true
+	})
+	if closed {
+		s.wsm.HandleDisconnection(s.serviceID, s)
+	}
+	return nil
+}
+
+func (s *pollSession) queued() int {
+	return len(s.outbound)
+}
+
+func (s *pollSession) Get(key string) (any, bool) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+func (s *pollSession) Set(key string, value any) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.keys[key] = value
+}
+
+func (s *pollSession) touch() {
+	s.lastPoll.Store(time.Now().UnixNano())
+}
+
+// poll waits up to wait for the service's next messages, returning as soon as any are queued
+func (s *pollSession) poll(ctx context.Context, wait time.Duration) []json.RawMessage {
+	s.touch()
+	defer s.touch()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	messages := []json.RawMessage{}
+	select {
+	case message := <-s.outbound:
+		messages = append(messages, message)
+	case <-timer.C:
+		return messages
+	case <-ctx.Done():
+		return messages
+	case <-s.done:
+		return messages
+	}
+	for len(messages) < pollBatchSize {
+		select {
+		case message := <-s.outbound:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+	return messages
+}
+
+// PollServiceTasks long-polls for a service's tasks, the first poll connects the service instance. Tasks are only
+// delivered once the service acknowledges them, so tasks in a response that never reaches the service are redelivered.
+func (app *App) PollServiceTasks(w http.ResponseWriter, r *http.Request) {
+	serviceID := mux.Vars(r)["id"]
+
+	project, err := app.authorizeServiceConnection(r, serviceID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+		return
+	}
+	serviceName, err := app.Engine.GetServiceName(project.ID, serviceID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), err))
+		return
+	}
+
+	wait := defaultPollWait
+	if value := r.URL.Query().Get("wait"); value != "" {
+		wait, err = time.ParseDuration(value)
+		if err != nil || wait < 0 || wait > maxPollWait {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("wait"), fmt.Sprintf("wait must be a duration of at most %s", maxPollWait)))
+			return
+		}
+	}
+
+	wsm := app.Engine.WebSocketManager
+	instanceID := r.URL.Query().Get(WSInstanceQueryParam)
+	session := wsm.pollSession(serviceID, instanceID)
+	if session == nil {
+		session = newPollSession(wsm, serviceID)
+		session.Set("projectID", project.ID)
+		session.Set(WSInstanceQueryParam, instanceID)
+		wsm.HandleConnection(serviceID, serviceName, session)
+	}
+
+	messages := session.poll(r.Context(), wait)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"messages": messages}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// PostServiceResults accepts a polling service's messages, the same messages services send over the WebSocket
+func (app *App) PostServiceResults(w http.ResponseWriter, r *http.Request) {
+	serviceID := mux.Vars(r)["id"]
+
+	if _, err := app.authorizeServiceConnection(r, serviceID); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, err))
+		return
+	}
+
+	wsm := app.Engine.WebSocketManager
+	session := wsm.pollSession(serviceID, r.URL.Query().Get(WSInstanceQueryParam))
+	if session == nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, "service instance is not polling for tasks"))
+		return
+	}
+	session.touch()
+
+	body, err := readRequestBody(w, r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	message, err := callbackMessage(body, serviceID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	wsm.HandleMessage(session, message, app.Engine.GetServiceByID)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,107 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollingServices(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	app.Engine.WebSocketManager = wsm
+
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+	poll := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/services/"+service.ID+"/tasks?instanceId=i_1&"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	postResult := func(instanceID string, payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"id": "m_1", "payload": payload})
+		req := httptest.NewRequest(http.MethodPost, "/services/"+service.ID+"/results?instanceId="+instanceID, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	polled := func(rr *httptest.ResponseRecorder) []Task {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response struct {
+			Messages []Task `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response.Messages
+	}
+
+	assert.Empty(t, polled(poll("wait=10ms")), "the first poll connects the service")
+	require.True(t, wsm.IsServiceHealthy(service.ID))
+
+	_, _, err := service.IdempotencyStore.InitializeOrGetExecution("key-1", "e_1")
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = wsm.SendTask(service.ID, &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1", Input: json.RawMessage(`{}`)})
+	}()
+
+	tasks := polled(poll("wait=5s"))
+	require.Len(t, tasks, 1, "polls wait for the service's next task")
+	assert.Equal(t, "task1", tasks[0].ID)
+
+	rr := postResult("i_1", map[string]any{"type": WSTaskAck, "executionId": "e_1", "deliveryId": tasks[0].DeliveryID})
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	wsm.deliveryMu.Lock()
+	assert.Empty(t, wsm.deliveries, "polled tasks are delivered once acknowledged")
+	wsm.deliveryMu.Unlock()
+
+	rr = postResult("i_1", map[string]any{
+		"type":           "task_result",
+		"taskId":         "task1",
+		"executionId":    "e_1",
+		"idempotencyKey": "key-1",
+		"result":         map[string]string{"echo": "hello"},
+	})
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	execution, _ := service.IdempotencyStore.GetExecutionWithResult("key-1")
+	assert.Equal(t, ExecutionCompleted, execution.State)
+	assert.JSONEq(t, `{"echo":"hello"}`, string(execution.Result))
+
+	t.Run("rejects invalid polls", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, poll("wait=1m").Code)
+		assert.Equal(t, http.StatusBadRequest, postResult("i_unknown", map[string]any{"type": "task_result"}).Code)
+	})
+
+	t.Run("services that stop polling are disconnected", func(t *testing.T) {
+		session := wsm.pollSession(service.ID, "i_1")
+		require.NotNil(t, session)
+		session.lastPoll.Store(time.Now().Add(-pollIdleTimeout).UnixNano())
+		session.Set("lastPong", time.Time{})
+
+		require.NoError(t, session.Write([]byte(`{"type":"ping"}`)))
+		lastPong, _ := session.Get("lastPong")
+		assert.True(t, lastPong.(time.Time).IsZero(), "pings go unanswered once the service stops polling")
+
+		require.NoError(t, session.Close())
+		assert.False(t, wsm.IsServiceHealthy(service.ID))
+	})
+}
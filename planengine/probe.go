@@ -0,0 +1,169 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+const (
+	// WSHealthProbe asks a service to prove it's still handling messages, not just keeping its socket alive
+	WSHealthProbe = "health_probe"
+	// WSHealthProbeResult answers a health probe with its probe ID
+	WSHealthProbeResult = "health_probe_result"
+	healthProbeKey      = "healthProbe"
+)
+
+// healthProbe tracks the probes sent to one service instance. An instance failing FailureThreshold probes in
+// a row is degraded until it next answers one.
+type healthProbe struct {
+	mu       sync.Mutex
+	id       string
+	deadline time.Time
+	failures int
+	degraded bool
+}
+
+// ConfigureHealthProbes enables health probes, they're disabled without an interval
+func (wsm *WebSocketManager) ConfigureHealthProbes(cfg HealthProbe) {
+	if cfg.Interval > 0 {
+		wsm.probeInterval = cfg.Interval
+	}
+	if cfg.Timeout > 0 {
+		wsm.probeTimeout = cfg.Timeout
+	}
+	if cfg.FailureThreshold > 0 {
+		wsm.probeThreshold = cfg.FailureThreshold
+	}
+}
+
+// answersProbes reports whether a session's service can answer probes itself. Callback and polling sessions
+// answer pings on their service's behalf, so they're left to their own liveness checks.
+func answersProbes(s serviceSession) bool {
+	switch s.(type) {
+	case *callbackSession, *pollSession:
+		return false
+	default:
+		return true
+	}
+}
+
+func sessionHealthProbe(s serviceSession) *healthProbe {
+	value, _ := s.Get(healthProbeKey)
+	probe, _ := value.(*healthProbe)
+	return probe
+}
+
+// probeRoutine probes a service instance every probe interval, for as long as the instance stays connected
+func (wsm *WebSocketManager) probeRoutine(serviceID string, s serviceSession) {
+	probe := sessionHealthProbe(s)
+	ticker := time.NewTicker(wsm.probeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !wsm.isCurrentSession(serviceID, s) {
+			return
+		}
+
+		id := probe.next(wsm.probeTimeout, wsm.probeThreshold, func(failures int) {
+			wsm.logger.Warn().
+				Str("ServiceID", serviceID).
+				Str("InstanceID", sessionInstanceID(s)).
+				Int("Failures", failures).
+				Msg("Service instance degraded after failing health probes")
+		})
+		if id == "" {
+			continue
+		}
+
+		message := fmt.Sprintf(`{ "type": "%s", "serviceId": "%s", "probeId": "%s", "protocolVersion": %d }`, WSHealthProbe, serviceID, id, CurrentProtocolVersion)
+		if err := wsm.writeMessage(s, []byte(message)); err != nil {
+			wsm.logger.Debug().Err(err).Str("ServiceID", serviceID).Msg("Failed to send health probe")
+		}
+	}
+}
+
+// next counts the outstanding probe as failed once its deadline passes, returning the ID of the next probe to
+// send. No probe is sent while the outstanding one may still be answered.
+func (p *healthProbe) next(timeout time.Duration, threshold int, onDegraded func(failures int)) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.id != "" {
+		if now.Before(p.deadline) {
+			return ""
+		}
+		p.failures++
+		if p.failures >= threshold && !p.degraded {
+			p.degraded = true
+			onDegraded(p.failures)
+		}
+	}
+
+	p.id = fmt.Sprintf("hp_%s", short.New())
+	p.deadline = now.Add(timeout)
+	return p.id
+}
+
+// answer settles the outstanding probe, reporting whether it recovered a degraded instance
+func (p *healthProbe) answer(id string) (answered, recovered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id == "" || id != p.id {
+		return false, false
+	}
+	recovered = p.degraded
+	p.id = ""
+	p.failures = 0
+	p.degraded = false
+	return true, recovered
+}
+
+func (p *healthProbe) isDegraded() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.degraded
+}
+
+func (wsm *WebSocketManager) handleHealthProbeResult(s serviceSession, result TaskResult) {
+	probe := sessionHealthProbe(s)
+	if probe == nil {
+		return
+	}
+	answered, recovered := probe.answer(result.ProbeID)
+	if !answered {
+		wsm.logger.Debug().Str("ServiceID", result.ServiceID).Str("ProbeID", result.ProbeID).Msg("Received answer to an unknown health probe")
+		return
+	}
+	if recovered {
+		wsm.logger.Info().
+			Str("ServiceID", result.ServiceID).
+			Str("InstanceID", sessionInstanceID(s)).
+			Msg("Service instance recovered by answering a health probe")
+	}
+}
+
+// IsServiceDegraded reports whether all the service's connected instances have failed their recent health probes
+func (wsm *WebSocketManager) IsServiceDegraded(serviceID string) bool {
+	sessions := wsm.instanceSessions(serviceID)
+	if len(sessions) == 0 {
+		return false
+	}
+	for _, s := range sessions {
+		probe := sessionHealthProbe(s)
+		if probe == nil || !probe.isDegraded() {
+			return false
+		}
+	}
+	return true
+}
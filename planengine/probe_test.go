@@ -0,0 +1,56 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthProbesDegradeUnresponsiveServices(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.Nop())
+	wsm.ConfigureHealthProbes(HealthProbe{Interval: 20 * time.Millisecond, Timeout: 10 * time.Millisecond, FailureThreshold: 2})
+
+	s := newGRPCSession(nil)
+	wsm.HandleConnection("s_echo", "Echo", s)
+	defer wsm.HandleDisconnection("s_echo", s)
+
+	assert.Eventually(t, func() bool {
+		return wsm.IsServiceDegraded("s_echo")
+	}, time.Second, 5*time.Millisecond, "services not answering probes are degraded")
+	assert.True(t, wsm.IsServiceHealthy("s_echo"), "degraded services keep their connection")
+
+	// Answers the latest probe sent, until one is answered before it's replaced
+	assert.Eventually(t, func() bool {
+		var probeID string
+		for len(s.outbound) > 0 {
+			if probe := (<-s.outbound).GetHealthProbe(); probe != nil {
+				probeID = probe.GetProbeId()
+			}
+		}
+		if probeID == "" {
+			return false
+		}
+		answer, _ := json.Marshal(map[string]any{"id": "m_probe", "payload": map[string]any{
+			"type": WSHealthProbeResult, "serviceId": "s_echo", "probeId": probeID,
+		}})
+		wsm.HandleMessage(s, answer, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+		return !wsm.IsServiceDegraded("s_echo")
+	}, time.Second, 5*time.Millisecond, "answering a probe recovers the service")
+
+	t.Run("sessions answering pings themselves aren't probed", func(t *testing.T) {
+		callback := &callbackSession{wsm: wsm, serviceID: "s_callback", outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+		wsm.HandleConnection("s_callback", "Callback", callback)
+		require.Nil(t, sessionHealthProbe(callback))
+		assert.False(t, wsm.IsServiceDegraded("s_callback"))
+	})
+}
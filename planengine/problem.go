@@ -0,0 +1,139 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:orra:error:"
+	internalErrorMsg   = "internal server error - please contact support"
+)
+
+// Problem is an RFC 7807 problem details error body. Code is stable for clients to branch on, Error repeats the
+// problem in the body shape used before problem details, so clients predating them keep reading errors.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Code      string            `json:"code"`
+	Param     string            `json:"param,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+	Error     errs.ServiceError `json:"error"`
+}
+
+func newProblem(status int, kind, code, param, detail string) Problem {
+	return Problem{
+		Type:   problemTypePrefix + strings.TrimPrefix(code, "Orra:"),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Param:  param,
+		Error: errs.ServiceError{
+			Kind:    kind,
+			Code:    code,
+			Param:   param,
+			Message: detail,
+		},
+	}
+}
+
+// problemStatus maps an error kind to its response status, as errs.HTTPErrorResponse does
+func problemStatus(kind errs.Kind) int {
+	switch kind {
+	case errs.Invalid, errs.Exist, errs.NotExist, errs.Private, errs.BrokenLink, errs.Validation, errs.InvalidRequest:
+		return http.StatusBadRequest
+	case errs.Unauthenticated:
+		return http.StatusUnauthorized
+	case errs.Unauthorized:
+		return http.StatusForbidden
+	case errs.UnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// problemCode is the error's code, or one standing for its kind when it has none
+func problemCode(e *errs.Error) string {
+	if e.Code != "" {
+		return string(e.Code)
+	}
+	switch e.Kind {
+	case errs.Validation:
+		return ValidationFailedErrCode
+	case errs.InvalidRequest, errs.Private, errs.BrokenLink:
+		return InvalidRequestErrCode
+	case errs.Invalid:
+		return InvalidOperationErrCode
+	case errs.Exist:
+		return AlreadyExistsErrCode
+	case errs.NotExist:
+		return NotFoundErrCode
+	case errs.Unauthenticated:
+		return UnauthenticatedErrCode
+	case errs.Unauthorized:
+		return UnauthorizedErrCode
+	case errs.UnsupportedMediaType:
+		return UnsupportedMediaTypeErrCode
+	default:
+		return InternalErrCode
+	}
+}
+
+// httpErrorResponse replies with an error as problem details and logs it. Internal errors are logged in full but
+// their details are withheld from the caller.
+func httpErrorResponse(w http.ResponseWriter, lgr zerolog.Logger, err error) {
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		lgr.Error().Err(err).Int("http_statuscode", http.StatusInternalServerError).Msg("Unknown Error")
+		writeProblem(w, newProblem(http.StatusInternalServerError, errs.Unanticipated.String(), InternalErrCode, "", internalErrorMsg))
+		return
+	}
+
+	status := problemStatus(e.Kind)
+	code := problemCode(e)
+	lgr.Error().Err(e.Err).
+		Int("http_statuscode", status).
+		Str("Kind", e.Kind.String()).
+		Str("Parameter", string(e.Param)).
+		Str("Code", code).
+		Msg("error response sent to client")
+
+	problem := newProblem(status, e.Kind.String(), code, string(e.Param), e.Error())
+	if e.Kind == errs.Internal || e.Kind == errs.Database {
+		problem = newProblem(status, errs.Internal.String(), code, "", internalErrorMsg)
+	}
+
+	if e.Kind == errs.Unauthenticated {
+		realm := e.Realm
+		if realm == "" {
+			realm = "default"
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s"`, realm))
+	}
+	writeProblem(w, problem)
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	body, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, _ = fmt.Fprintln(w, string(body))
+}
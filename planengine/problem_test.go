@@ -0,0 +1,88 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPErrorResponse(t *testing.T) {
+	respond := func(err error) (*httptest.ResponseRecorder, Problem) {
+		w := httptest.NewRecorder()
+		httpErrorResponse(w, zerolog.Nop(), err)
+
+		var problem Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, w.Code, problem.Status)
+		return w, problem
+	}
+
+	t.Run("describes errors with their code", func(t *testing.T) {
+		w, problem := respond(errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), errs.Parameter("id"), "unknown service: s_1"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "urn:orra:error:UnknownService", problem.Type)
+		assert.Equal(t, "Bad Request", problem.Title)
+		assert.Equal(t, UnknownServiceErrCode, problem.Code)
+		assert.Equal(t, "id", problem.Param)
+		assert.Equal(t, "unknown service: s_1", problem.Detail)
+		assert.Equal(t, problem.Code, problem.Error.Code, "the legacy error member is kept")
+		assert.Equal(t, problem.Detail, problem.Error.Message)
+	})
+
+	t.Run("falls back to a code for the error's kind", func(t *testing.T) {
+		_, problem := respond(errs.E(errs.Validation, errs.Parameter("sla"), "sla must be positive"))
+		assert.Equal(t, ValidationFailedErrCode, problem.Code)
+	})
+
+	t.Run("challenges unauthenticated requests", func(t *testing.T) {
+		w, problem := respond(errs.E(errs.Unauthenticated, "invalid token"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, UnauthenticatedErrCode, problem.Code)
+		assert.Equal(t, `Bearer realm="default"`, w.Header().Get("WWW-Authenticate"))
+
+		w, problem = respond(errs.E(errs.Unauthorized, "forbidden"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, UnauthorizedErrCode, problem.Code)
+	})
+
+	t.Run("withholds internal details", func(t *testing.T) {
+		w, problem := respond(errs.E(errs.Internal, "disk full at /var/lib/orra"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, InternalErrCode, problem.Code)
+		assert.NotContains(t, problem.Detail, "disk full")
+
+		_, problem = respond(errors.New("boom"))
+		assert.Equal(t, InternalErrCode, problem.Code)
+		assert.NotContains(t, problem.Detail, "boom")
+	})
+}
+
+func TestProblemRequestID(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/services/s_unknown", nil)
+	req.Header.Set("Authorization", "Bearer project-api-key")
+	req.Header.Set(RequestIDHeader, "trace-me")
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+
+	var problem Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, UnknownServiceErrCode, problem.Code)
+	assert.Equal(t, "trace-me", problem.RequestID)
+}
@@ -0,0 +1,202 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+// ProjectUpdate changes a project's name and settings, settings left out are kept as they are
+type ProjectUpdate struct {
+	Name          *string                `json:"name,omitempty"`
+	Security      *ProjectSecurityUpdate `json:"security,omitempty"`
+	Limits        *ProjectLimits         `json:"limits,omitempty"`
+	Notifications *ProjectNotifications  `json:"notifications,omitempty"`
+	Alerts        *ProjectAlerts         `json:"alerts,omitempty"`
+}
+
+// UpdateProject renames a project and replaces the settings included in the update
+func (p *PlanEngine) UpdateProject(projectID string, update ProjectUpdate) (*Project, error) {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	if update.Name != nil {
+		updated.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Security != nil {
+		updated.Security = update.Security.apply(project.Security)
+	}
+	if update.Limits != nil {
+		updated.Limits = *update.Limits
+	}
+	if update.Notifications != nil {
+		updated.Notifications = *update.Notifications
+	}
+	if update.Alerts != nil {
+		updated.Alerts = *update.Alerts
+	}
+	if err := p.updateProject(updated); err != nil {
+		return nil, err
+	}
+
+	// Raised limits may free slots for queued orchestrations
+	if update.Limits != nil {
+		p.orchestrationStoreMu.Lock()
+		p.drainOrchestrationQueueLocked(projectID)
+		p.orchestrationStoreMu.Unlock()
+	}
+	return updated, nil
+}
+
+// DeleteProject removes a project for good. Its unfinished orchestrations are cancelled and its services
+// disconnected, then its orchestrations and everything else stored under it are purged and its API keys revoked.
+// Audit events are kept, they record who deleted the project.
+func (p *PlanEngine) DeleteProject(projectID string) error {
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	orchestrations, err := p.orchestrationStorage.ListProjectOrchestrations(projectID)
+	if err != nil {
+		return err
+	}
+	for _, orchestration := range orchestrations {
+		// Orchestrations no longer held in memory have expired, only their stored records are left
+		if !p.OrchestrationBelongsToProject(orchestration.ID, projectID) {
+			if err := p.purgeOrchestration(orchestration); err != nil {
+				return fmt.Errorf("failed to delete orchestration %s: %w", orchestration.ID, err)
+			}
+			continue
+		}
+		if err := p.DeleteOrchestration(orchestration.ID, true); err != nil && !errors.Is(err, ErrOrchestrationNotFound) {
+			return fmt.Errorf("failed to delete orchestration %s: %w", orchestration.ID, err)
+		}
+	}
+
+	p.servicesMu.Lock()
+	services := p.services[projectID]
+	delete(p.services, projectID)
+	p.servicesMu.Unlock()
+	if p.WebSocketManager != nil {
+		for serviceID := range services {
+			p.WebSocketManager.DisconnectService(serviceID)
+		}
+	}
+
+	// Changes underway are stored before the project is deleted, so they can't bring it back
+	p.projectWriteMu.Lock()
+	err = p.pStorage.DeleteProject(project)
+	if err == nil {
+		p.projectsMu.Lock()
+		delete(p.projects, projectID)
+		p.projectsMu.Unlock()
+	}
+	p.projectWriteMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to delete project: %w", err)
+	}
+
+	p.orchestrationStoreMu.Lock()
+	delete(p.orchestrationQueues, projectID)
+	delete(p.runningCounts, projectID)
+	p.orchestrationStoreMu.Unlock()
+
+	return nil
+}
+
+// UpdateProjectHandler renames the caller's project or changes its settings
+func (app *App) UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	var update ProjectUpdate
+	if err := decodeRequest(w, r, &update, projectUpdateFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if err := validateProjectUpdate(&update); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if update.Security != nil {
+		// Refuse changes that would immediately lock the caller out
+		if addr, err := app.clientAddr(r); err == nil && !update.Security.apply(project.Security).Allows(addr) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("security"), fmt.Sprintf("allowlist must include the caller's address %s", addr)))
+			return
+		}
+	}
+	if update.Notifications != nil && update.Notifications.Channels == nil {
+		update.Notifications.Channels = make([]NotificationChannel, 0)
+	}
+	if update.Alerts != nil && update.Alerts.Rules == nil {
+		update.Alerts.Rules = make([]AlertRule, 0)
+	}
+
+	updated, err := app.Engine.UpdateProject(project.ID, update)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":            updated.ID,
+		"name":          updated.Name,
+		"webhooks":      updated.Webhooks,
+		"security":      updated.Security,
+		"limits":        updated.Limits,
+		"notifications": updated.Notifications,
+		"alerts":        updated.Alerts,
+		"createdAt":     updated.CreatedAt,
+		"updatedAt":     updated.UpdatedAt,
+	}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// DeleteProjectHandler removes the caller's project along with its schedules, orchestrations and services
+func (app *App) DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	// Schedules go first so none fire while the project is torn down
+	if app.Scheduler != nil {
+		if err := app.Scheduler.RemoveProject(project.ID); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectDeletionFailedErrCode), err))
+			return
+		}
+	}
+
+	if err := app.Engine.DeleteProject(project.ID); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ProjectDeletionFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateProject(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	project.Name = "Shop"
+	project.Limits = ProjectLimits{MaxConcurrentOrchestrations: 5}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/projects", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(`{"name":" Storefront ","alerts":{"rules":[{"name":"failing","metric":"failure_rate","threshold":0.5,"window":"10m"}]}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Name   string        `json:"name"`
+		Limits ProjectLimits `json:"limits"`
+		Alerts ProjectAlerts `json:"alerts"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "Storefront", response.Name)
+	assert.Equal(t, 5, response.Limits.MaxConcurrentOrchestrations, "settings left out are kept")
+	require.Len(t, response.Alerts.Rules, 1)
+
+	stored, err := app.Db.LoadProject(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Storefront", stored.Name)
+	assert.NotEmpty(t, stored.APIKeyHashes)
+
+	for _, body := range []string{
+		`{"name":"  "}`,
+		`{"limits":{"maxConcurrentOrchestrations":-1}}`,
+		`{"alerts":{"rules":[{"name":"bad","metric":"latency"}]}}`,
+		`{"webhooks":["http://localhost/hook"]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, send(body).Code, body)
+	}
+}
+
+func TestDeleteProject(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+	app.Engine.TaskLogs = app.Db
+	app.Engine.DeadLetters = app.Db
+
+	scheduler, err := NewScheduler(app.Db, func(context.Context, *Schedule) ScheduleRun { return ScheduleRun{} }, app.Logger)
+	require.NoError(t, err)
+	app.Scheduler = scheduler
+	_, err = scheduler.Add(project.ID, "@daily", OrchestrationTemplate{Action: Action{Content: "echo"}})
+	require.NoError(t, err)
+
+	running := setupRunningOrchestration(t, app, project.ID)
+	require.NoError(t, app.Db.StoreOrchestration(running))
+	expired := &Orchestration{ID: "o_expired", ProjectID: project.ID, Status: Completed, Timestamp: time.Now().Add(-30 * 24 * time.Hour)}
+	require.NoError(t, app.Db.StoreOrchestration(expired))
+
+	service := &ServiceInfo{ID: "s_echo", Name: "echo", Type: Service, ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	require.NoError(t, app.Db.StoreService(service))
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+	session := &callbackSession{wsm: app.Engine.WebSocketManager, serviceID: service.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	session.Set(WSInstanceQueryParam, "i_1")
+	app.Engine.WebSocketManager.HandleConnection(service.ID, service.Name, session)
+
+	require.NoError(t, app.Db.StoreGrounding(createTestGroundingSpec(project.ID)))
+
+	send := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/projects", nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodDelete)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	assert.Equal(t, Cancelled, running.Status, "running orchestrations are cancelled")
+	for _, id := range []string{running.ID, expired.ID} {
+		_, err := app.Db.LoadOrchestration(id)
+		assert.ErrorIs(t, err, ErrOrchestrationNotFound)
+	}
+
+	assert.Empty(t, app.Engine.WebSocketManager.instanceSessions(service.ID), "services are disconnected")
+	_, err = app.Db.LoadServiceByProjectID(project.ID, service.ID)
+	assert.ErrorIs(t, err, ErrServiceNotFound)
+	assert.False(t, app.Engine.ServiceBelongsToProject(service.ID, project.ID))
+
+	groundings, err := app.Db.ListProjectGroundings(project.ID)
+	require.NoError(t, err)
+	assert.Empty(t, groundings)
+	assert.Empty(t, scheduler.List(project.ID))
+
+	_, err = app.Db.LoadProject(project.ID)
+	assert.ErrorIs(t, err, ErrProjectNotFound)
+	_, err = app.Db.LoadProjectByAPIKey("project-api-key")
+	assert.ErrorIs(t, err, ErrProjectAPIKeyNotFound)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodDelete).Code, "the project's API keys are revoked")
+}
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,16 +16,29 @@ import (
 	"github.com/dgraph-io/badger/v4"
 )
 
+const apiKeyLookupKey = "meta:api-key-lookup-key"
+
 var (
 	ErrProjectNotFound       = errors.New("project not found")
 	ErrProjectAPIKeyNotFound = errors.New("project api key not found")
+	ErrProjectMemberNotFound = errors.New("project member not found")
 )
 
 func (b *BadgerDB) StoreProject(project *Project) error {
 	return b.db.Update(func(txn *badger.Txn) error {
+		// Drop indices keyed by plaintext API keys stored before keys were hashed
+		for _, key := range append([]string{project.APIKey}, project.AdditionalAPIKeys...) {
+			if key == "" {
+				continue
+			}
+			if err := txn.Delete([]byte(fmt.Sprintf("apikey:%s", key))); err != nil {
+				return fmt.Errorf("failed to remove plaintext api key index: %w", err)
+			}
+		}
+
 		// Store project data
 		projectKey := fmt.Sprintf("project:%s", project.ID)
-		projectData, err := json.Marshal(project)
+		projectData, err := json.Marshal(project.withoutPlaintextAPIKeys())
 		if err != nil {
 			return fmt.Errorf("failed to marshal project: %w", err)
 		}
@@ -33,17 +47,11 @@ func (b *BadgerDB) StoreProject(project *Project) error {
 			return fmt.Errorf("failed to store project: %w", err)
 		}
 
-		// Store API key index
-		primaryKeyIndex := fmt.Sprintf("apikey:%s", project.APIKey)
-		if err := txn.Set([]byte(primaryKeyIndex), []byte(project.ID)); err != nil {
-			return fmt.Errorf("failed to store api key index: %w", err)
-		}
-
-		// Store additional API key indices
-		for _, key := range project.AdditionalAPIKeys {
-			additionalKeyIndex := fmt.Sprintf("apikey:%s", key)
-			if err := txn.Set([]byte(additionalKeyIndex), []byte(project.ID)); err != nil {
-				return fmt.Errorf("failed to store additional api key index: %w", err)
+		// Store API key indices
+		for _, key := range project.APIKeyHashes {
+			keyIndex := fmt.Sprintf("apikey:%s", key.LookupID)
+			if err := txn.Set([]byte(keyIndex), []byte(project.ID)); err != nil {
+				return fmt.Errorf("failed to store api key index: %w", err)
 			}
 		}
 
@@ -75,11 +83,47 @@ func (b *BadgerDB) LoadProject(id string) (*Project, error) {
 	return &project, nil
 }
 
+// APIKeyLookupKey returns the key API keys' storage indices are derived with, generating it on first use
+func (b *BadgerDB) APIKeyLookupKey() ([]byte, error) {
+	b.lookupKeyMu.Lock()
+	defer b.lookupKeyMu.Unlock()
+	if b.lookupKey != nil {
+		return b.lookupKey, nil
+	}
+
+	var key []byte
+	err := b.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(apiKeyLookupKey))
+		if err == nil {
+			key, err = item.ValueCopy(nil)
+			return err
+		}
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate api key lookup key: %w", err)
+		}
+		return txn.Set([]byte(apiKeyLookupKey), key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.lookupKey = key
+	return key, nil
+}
+
 func (b *BadgerDB) LoadProjectByAPIKey(apiKey string) (*Project, error) {
-	var projectID string
+	lookupKey, err := b.APIKeyLookupKey()
+	if err != nil {
+		return nil, err
+	}
 
-	err := b.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(fmt.Sprintf("apikey:%s", apiKey)))
+	var projectID string
+	err = b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(fmt.Sprintf("apikey:%s", apiKeyLookupID(lookupKey, apiKey))))
 		if err != nil {
 			if errors.Is(err, badger.ErrKeyNotFound) {
 				return ErrProjectAPIKeyNotFound
@@ -97,7 +141,16 @@ func (b *BadgerDB) LoadProjectByAPIKey(apiKey string) (*Project, error) {
 		return nil, err
 	}
 
-	return b.LoadProject(projectID)
+	project, err := b.LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !project.HasAPIKey(apiKey) {
+		return nil, ErrProjectAPIKeyNotFound
+	}
+
+	return project, nil
 }
 
 func (b *BadgerDB) ListProjects() ([]*Project, error) {
@@ -133,7 +186,64 @@ func (b *BadgerDB) ListProjects() ([]*Project, error) {
 	return projects, nil
 }
 
-func (b *BadgerDB) AddProjectAPIKey(projectID string, apiKey string) error {
+func (b *BadgerDB) DeleteProject(project *Project) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete([]byte(fmt.Sprintf("project:%s", project.ID))); err != nil {
+			return fmt.Errorf("failed to delete project: %w", err)
+		}
+
+		for _, key := range project.APIKeyHashes {
+			if err := txn.Delete([]byte(fmt.Sprintf("apikey:%s", key.LookupID))); err != nil {
+				return fmt.Errorf("failed to revoke api key: %w", err)
+			}
+		}
+		for _, key := range append([]string{project.APIKey}, project.AdditionalAPIKeys...) {
+			if key == "" {
+				continue
+			}
+			if err := txn.Delete([]byte(fmt.Sprintf("apikey:%s", key))); err != nil {
+				return fmt.Errorf("failed to revoke plaintext api key: %w", err)
+			}
+		}
+
+		// Services are only indexed by project, their info is keyed by service ID
+		serviceIndex := []byte(fmt.Sprintf("service:project:%s:", project.ID))
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = serviceIndex
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		var serviceIDs []string
+		for it.Seek(serviceIndex); it.ValidForPrefix(serviceIndex); it.Next() {
+			serviceIDs = append(serviceIDs, string(it.Item().Key()[len(serviceIndex):]))
+		}
+		it.Close()
+		for _, serviceID := range serviceIDs {
+			if err := txn.Delete([]byte(fmt.Sprintf("service:info:%s", serviceID))); err != nil {
+				return fmt.Errorf("failed to delete service %s: %w", serviceID, err)
+			}
+		}
+
+		for _, prefix := range []string{
+			"service:project:",
+			"grounding:info:",
+			"grounding:project:",
+			templateKeyPrefix,
+			deadLetterKeyPrefix,
+			webhookDeadLetterKeyPrefix,
+			webhookDeliveryKeyPrefix,
+			"submission:",
+			usageKeyPrefix,
+		} {
+			if err := deletePrefix(txn, []byte(prefix+project.ID+":")); err != nil {
+				return fmt.Errorf("failed to delete project data under %s: %w", prefix, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BadgerDB) AddProjectAPIKey(projectID string, apiKey HashedAPIKey) error {
 	return b.db.Update(func(txn *badger.Txn) error {
 		// First load the project
 		project, err := b.LoadProject(projectID)
@@ -142,7 +252,7 @@ func (b *BadgerDB) AddProjectAPIKey(projectID string, apiKey string) error {
 		}
 
 		// Add the new API key
-		project.AdditionalAPIKeys = append(project.AdditionalAPIKeys, apiKey)
+		project.APIKeyHashes = append(project.APIKeyHashes, apiKey)
 		project.UpdatedAt = time.Now().UTC()
 
 		// Store the updated project
@@ -156,7 +266,7 @@ func (b *BadgerDB) AddProjectAPIKey(projectID string, apiKey string) error {
 		}
 
 		// Store the API key index
-		if err := txn.Set([]byte(fmt.Sprintf("apikey:%s", apiKey)), []byte(projectID)); err != nil {
+		if err := txn.Set([]byte(fmt.Sprintf("apikey:%s", apiKey.LookupID)), []byte(projectID)); err != nil {
 			return fmt.Errorf("failed to store api key index: %w", err)
 		}
 
@@ -164,7 +274,7 @@ func (b *BadgerDB) AddProjectAPIKey(projectID string, apiKey string) error {
 	})
 }
 
-func (b *BadgerDB) AddProjectWebhook(projectID string, webhook string) error {
+func (b *BadgerDB) AddProjectWebhook(projectID string, webhook, webhookID string, options ProjectWebhookOptions, secret WebhookSecret) error {
 	return b.db.Update(func(txn *badger.Txn) error {
 		// First load the project
 		project, err := b.LoadProject(projectID)
@@ -174,6 +284,11 @@ func (b *BadgerDB) AddProjectWebhook(projectID string, webhook string) error {
 
 		// Add the new webhook
 		project.Webhooks = append(project.Webhooks, webhook)
+		project.setWebhookID(webhook, webhookID)
+		project.setWebhookEvents(webhook, options.Events)
+		project.setWebhookFormat(webhook, options.Format)
+		project.setWebhookRequest(webhook, newWebhookRequest(options.Headers, options.Timeout))
+		project.setWebhookSecret(webhook, secret)
 		project.UpdatedAt = time.Now().UTC()
 
 		// Store the updated project
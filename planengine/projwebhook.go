@@ -0,0 +1,366 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+var (
+	ErrProjectWebhookNotFound = errors.New("project webhook not found")
+	ErrProjectWebhookExists   = errors.New("project webhook already exists")
+)
+
+// ProjectWebhook is one of a project's notification targets. A webhook keeps the ID it was added with when its URL
+// changes, so its delivery log stays with it.
+type ProjectWebhook struct {
+	ID     string   `json:"id"`
+	Url    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Format string   `json:"format,omitempty"`
+	// Headers only lists the names of the webhook's static headers, their values are never shown
+	Headers []string `json:"headers,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+	// Secret signs the webhook's deliveries, it's only shown when the webhook is added
+	Secret string `json:"secret,omitempty"`
+}
+
+// ProjectWebhookOptions are the events a webhook is subscribed to, the format its payloads are delivered in, and
+// the static headers and timeout of its deliveries
+type ProjectWebhookOptions struct {
+	Events  []string          `json:"events"`
+	Format  string            `json:"format"`
+	Headers map[string]string `json:"headers"`
+	Timeout *Duration         `json:"timeout"`
+}
+
+// ProjectWebhookUpdate changes a webhook's URL, the events it's subscribed to, its payload format, its static
+// headers, its timeout, or any of them. Clearing its events subscribes the webhook to every event, and a zero
+// timeout restores the default.
+type ProjectWebhookUpdate struct {
+	Url     string             `json:"url"`
+	Events  *[]string          `json:"events"`
+	Format  *string            `json:"format"`
+	Headers *map[string]string `json:"headers"`
+	Timeout *Duration          `json:"timeout"`
+}
+
+// projectWebhookID derives a webhook's ID from its URL, for webhooks added without a stored ID and for callbacks
+func projectWebhookID(webhookUrl string) string {
+	sum := sha256.Sum256([]byte(webhookUrl))
+	return "wh_" + hex.EncodeToString(sum[:8])
+}
+
+// webhookID returns the ID a project's webhook is known by
+func (p *Project) webhookID(webhookUrl string) string {
+	if id, ok := p.WebhookIDs[webhookUrl]; ok {
+		return id
+	}
+	return projectWebhookID(webhookUrl)
+}
+
+// newWebhookID picks the ID of a webhook being added to the project. It's derived from the URL, unless a webhook
+// that has since moved off the URL already has that ID.
+func (p *Project) newWebhookID(webhookUrl string) string {
+	id := projectWebhookID(webhookUrl)
+	if slices.ContainsFunc(p.Webhooks, func(webhook string) bool { return p.webhookID(webhook) == id }) {
+		return fmt.Sprintf("wh_%s", short.New())
+	}
+	return id
+}
+
+func (p *Project) setWebhookID(webhookUrl, id string) {
+	if p.WebhookIDs == nil {
+		p.WebhookIDs = make(map[string]string)
+	}
+	p.WebhookIDs[webhookUrl] = id
+}
+
+// moveWebhookID keeps a webhook's ID when its URL changes, or drops it with the webhook when to is empty
+func (p *Project) moveWebhookID(from, to string) {
+	id := p.webhookID(from)
+	delete(p.WebhookIDs, from)
+	if to != "" {
+		p.setWebhookID(to, id)
+	}
+}
+
+// webhookIndex returns the position of the project's webhook with the ID, or -1
+func (p *Project) webhookIndex(id string) int {
+	return slices.IndexFunc(p.Webhooks, func(webhook string) bool { return p.webhookID(webhook) == id })
+}
+
+func projectWebhooks(project *Project) []ProjectWebhook {
+	webhooks := make([]ProjectWebhook, 0, len(project.Webhooks))
+	for _, webhook := range project.Webhooks {
+		webhooks = append(webhooks, project.webhook(webhook))
+	}
+	return webhooks
+}
+
+func (p *Project) webhook(webhookUrl string) ProjectWebhook {
+	webhook := ProjectWebhook{
+		ID:      p.webhookID(webhookUrl),
+		Url:     webhookUrl,
+		Events:  p.WebhookEvents[webhookUrl],
+		Format:  p.WebhookFormats[webhookUrl],
+		Headers: p.WebhookRequests[webhookUrl].headerNames(),
+	}
+	if timeout := p.WebhookRequests[webhookUrl].Timeout; timeout > 0 {
+		webhook.Timeout = timeout.String()
+	}
+	return webhook
+}
+
+// webhookSubscribed reports whether a webhook receives an event, webhooks without subscriptions receive them all
+func (p *Project) webhookSubscribed(webhookUrl, event string) bool {
+	events := p.WebhookEvents[webhookUrl]
+	return len(events) == 0 || slices.Contains(events, event)
+}
+
+// setWebhookEvents subscribes a webhook to events, or to every event when there are none
+func (p *Project) setWebhookEvents(webhookUrl string, events []string) {
+	if len(events) == 0 {
+		delete(p.WebhookEvents, webhookUrl)
+		return
+	}
+	if p.WebhookEvents == nil {
+		p.WebhookEvents = make(map[string][]string)
+	}
+	events = slices.Clone(events)
+	slices.Sort(events)
+	p.WebhookEvents[webhookUrl] = slices.Compact(events)
+}
+
+func validateWebhookEvents(events []string) error {
+	for _, event := range events {
+		if !slices.Contains(ProjectEvents, event) {
+			return errs.E(errs.Validation, errs.Parameter("events"), fmt.Sprintf("unknown event %q", event))
+		}
+	}
+	return nil
+}
+
+// validateWebhookURL checks a webhook is an absolute HTTP or HTTPS URL, and not one naming a private address.
+// Deliveries check the addresses hosts resolve to as well, when they're sent.
+func (p *PlanEngine) validateWebhookURL(webhookUrl string) error {
+	u, err := url.ParseRequestURI(webhookUrl)
+	if err != nil || u.Host == "" {
+		return errs.E(errs.Validation, errs.Parameter("url"), "url must be an absolute URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errs.E(errs.Validation, errs.Parameter("url"), "url must use http or https")
+	}
+	if !p.allowPrivateWebhooks && isPrivateHost(u.Hostname(), isPublicAddress) {
+		return errs.E(errs.Validation, errs.Parameter("url"), ErrPrivateEndpoint)
+	}
+	return nil
+}
+
+// UpdateProjectWebhook points one of a project's webhooks at a new URL and changes the events it's subscribed to,
+// its payload format and its delivery options
+func (p *PlanEngine) UpdateProjectWebhook(projectID, id string, update ProjectWebhookUpdate) (ProjectWebhook, error) {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return ProjectWebhook{}, err
+	}
+
+	i := project.webhookIndex(id)
+	if i < 0 {
+		return ProjectWebhook{}, ErrProjectWebhookNotFound
+	}
+	current := project.Webhooks[i]
+	webhookUrl := cmp.Or(update.Url, current)
+	if current != webhookUrl && slices.Contains(project.Webhooks, webhookUrl) {
+		return ProjectWebhook{}, ErrProjectWebhookExists
+	}
+
+	events := project.WebhookEvents[current]
+	if update.Events != nil {
+		events = *update.Events
+	}
+	format := project.WebhookFormats[current]
+	if update.Format != nil {
+		format = *update.Format
+	}
+	request := project.WebhookRequests[current]
+	if update.Headers != nil {
+		request.Headers = *update.Headers
+	}
+	if update.Timeout != nil {
+		request.Timeout = update.Timeout.Duration
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Webhooks = slices.Clone(project.Webhooks)
+	updated.Webhooks[i] = webhookUrl
+	updated.WebhookEvents = maps.Clone(project.WebhookEvents)
+	updated.setWebhookEvents(current, nil)
+	updated.setWebhookEvents(webhookUrl, events)
+	updated.WebhookFormats = maps.Clone(project.WebhookFormats)
+	updated.setWebhookFormat(current, "")
+	updated.setWebhookFormat(webhookUrl, format)
+	updated.WebhookRequests = maps.Clone(project.WebhookRequests)
+	updated.setWebhookRequest(current, WebhookRequest{})
+	updated.setWebhookRequest(webhookUrl, newWebhookRequest(request.Headers, &Duration{request.Timeout}))
+	updated.WebhookSecrets = maps.Clone(project.WebhookSecrets)
+	updated.moveWebhookSecret(current, webhookUrl)
+	updated.WebhookIDs = maps.Clone(project.WebhookIDs)
+	updated.moveWebhookID(current, webhookUrl)
+	if err := p.updateProject(updated); err != nil {
+		return ProjectWebhook{}, err
+	}
+	return updated.webhook(webhookUrl), nil
+}
+
+// RemoveProjectWebhook stops a project's events being delivered to one of its webhooks
+func (p *PlanEngine) RemoveProjectWebhook(projectID, id string) error {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return err
+	}
+
+	i := project.webhookIndex(id)
+	if i < 0 {
+		return ErrProjectWebhookNotFound
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.Webhooks = slices.Delete(slices.Clone(project.Webhooks), i, i+1)
+	updated.WebhookEvents = maps.Clone(project.WebhookEvents)
+	updated.setWebhookEvents(project.Webhooks[i], nil)
+	updated.WebhookFormats = maps.Clone(project.WebhookFormats)
+	updated.setWebhookFormat(project.Webhooks[i], "")
+	updated.WebhookRequests = maps.Clone(project.WebhookRequests)
+	updated.setWebhookRequest(project.Webhooks[i], WebhookRequest{})
+	updated.WebhookSecrets = maps.Clone(project.WebhookSecrets)
+	updated.moveWebhookSecret(project.Webhooks[i], "")
+	updated.WebhookIDs = maps.Clone(project.WebhookIDs)
+	updated.moveWebhookID(project.Webhooks[i], "")
+	return p.updateProject(updated)
+}
+
+// ListWebhooks returns the caller's project webhooks
+func (app *App) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(projectWebhooks(project)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// UpdateWebhook points one of the caller's project webhooks at a new URL, or changes the events it's subscribed to,
+// its payload format or its delivery options
+func (app *App) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	var request ProjectWebhookUpdate
+	if err := decodeRequest(w, r, &request, projectWebhookUpdateFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if request.Url == "" && request.Events == nil && request.Format == nil && request.Headers == nil && request.Timeout == nil {
+		httpErrorResponse(w, app.requestLogger(r), missingField("url"))
+		return
+	}
+	if request.Url != "" {
+		if err := app.Engine.validateWebhookURL(request.Url); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), err)
+			return
+		}
+	}
+	if request.Events != nil {
+		if err := validateWebhookEvents(*request.Events); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), err)
+			return
+		}
+	}
+	if request.Format != nil {
+		if err := validateWebhookFormat(*request.Format); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), err)
+			return
+		}
+	}
+	if request.Headers != nil {
+		if err := validateWebhookHeaders(*request.Headers); err != nil {
+			httpErrorResponse(w, app.requestLogger(r), err)
+			return
+		}
+	}
+	if err := validateWebhookTimeout(request.Timeout); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	webhook, err := app.Engine.UpdateProjectWebhook(project.ID, mux.Vars(r)["id"], request)
+	switch {
+	case errors.Is(err, ErrProjectWebhookNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, err))
+		return
+	case errors.Is(err, ErrProjectWebhookExists):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("url"), err))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ProjectWebhookUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(webhook); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// DeleteWebhook removes one of the caller's project webhooks
+func (app *App) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	if err := app.Engine.RemoveProjectWebhook(project.ID, mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, ErrProjectWebhookNotFound) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, err))
+			return
+		}
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ProjectWebhookUpdateFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,195 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManageProjectWebhooks(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	listWebhooks := func() []ProjectWebhook {
+		t.Helper()
+		w := request(http.MethodGet, "/webhooks", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var webhooks []ProjectWebhook
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&webhooks))
+		return webhooks
+	}
+
+	assert.Empty(t, listWebhooks())
+
+	w := request(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/first"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var added ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&added))
+	require.NotEmpty(t, added.ID)
+	require.Equal(t, http.StatusCreated, request(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/second"}`).Code)
+
+	webhooks := listWebhooks()
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, ProjectWebhook{ID: added.ID, Url: added.Url}, webhooks[0])
+
+	w = request(http.MethodPatch, "/webhooks/"+added.ID, `{"url":"https://hooks.example.com/updated"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, "https://hooks.example.com/updated", updated.Url)
+	assert.Equal(t, added.ID, updated.ID, "webhooks keep their ID when their URL changes")
+	assert.Equal(t, []string{"https://hooks.example.com/updated", "https://hooks.example.com/second"}, app.Engine.projects[project.ID].Webhooks)
+
+	w = request(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/first"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var readded ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&readded))
+	assert.NotEqual(t, updated.ID, readded.ID, "webhooks added at a moved webhook's old URL get their own ID")
+	require.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/webhooks/"+readded.ID, "").Code)
+
+	require.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/webhooks/"+updated.ID, "").Code)
+	webhooks = listWebhooks()
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, "https://hooks.example.com/second", webhooks[0].Url)
+
+	stored, err := app.Db.LoadProject(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://hooks.example.com/second"}, stored.Webhooks)
+
+	t.Run("rejects invalid changes", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodDelete, "/webhooks/wh_unknown", "").Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/wh_unknown", `{"url":"https://hooks.example.com/other"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+webhooks[0].ID, `{"url":"not a url"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+webhooks[0].ID, `{}`).Code)
+
+		w := request(http.MethodPatch, "/webhooks/"+webhooks[0].ID, `{"uri":"https://hooks.example.com/other"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), UnknownRequestFieldErrCode)
+	})
+
+	t.Run("rejects private addresses", func(t *testing.T) {
+		app.Engine.allowPrivateWebhooks = false
+		defer func() { app.Engine.allowPrivateWebhooks = true }()
+
+		for _, webhookUrl := range []string{"http://169.254.169.254/latest/meta-data", "http://localhost:8080/hook", "http://10.0.0.7/hook", "http://[::1]/hook", "ftp://hooks.example.com/hook"} {
+			body := `{"url":"` + webhookUrl + `"}`
+			assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks", body).Code, webhookUrl)
+			assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+webhooks[0].ID, body).Code, webhookUrl)
+		}
+		assert.Equal(t, []string{"https://hooks.example.com/second"}, app.Engine.projects[project.ID].Webhooks)
+	})
+}
+
+func TestProjectWebhookEventSubscriptions(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+
+	received := make(chan string, 8)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received <- r.URL.Path + " " + event.Event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	notified := func(event string) []string {
+		t.Helper()
+		app.Engine.NotifyProjectWebhooks(app.Engine.projects[project.ID], event, nil)
+		var deliveries []string
+		for {
+			select {
+			case delivery := <-received:
+				deliveries = append(deliveries, delivery)
+			case <-time.After(100 * time.Millisecond):
+				return deliveries
+			}
+		}
+	}
+
+	w := request(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`/failures","events":["task.failed","orchestration.failed","task.failed"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var failures ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&failures))
+	assert.Equal(t, []string{ProjectEventOrchestrationFailed, ProjectEventTaskFailed}, failures.Events)
+	require.Equal(t, http.StatusCreated, request(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`/all"}`).Code)
+
+	stored, err := app.Db.LoadProject(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, failures.Events, stored.WebhookEvents[failures.Url])
+
+	assert.Equal(t, []string{"/all " + ProjectEventServiceDrained}, notified(ProjectEventServiceDrained))
+	assert.ElementsMatch(t, []string{"/failures " + ProjectEventTaskFailed, "/all " + ProjectEventTaskFailed}, notified(ProjectEventTaskFailed))
+
+	t.Run("services disconnecting are reported to subscribed webhooks", func(t *testing.T) {
+		app.Engine.WebSocketManager = NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+		app.Engine.WebSocketManager.onDisconnect = app.Engine.notifyServiceDisconnected
+		service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+		app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+		session := &callbackSession{keys: map[string]any{}, done: make(chan struct{})}
+		app.Engine.WebSocketManager.HandleConnection(service.ID, service.Name, session)
+		app.Engine.WebSocketManager.HandleDisconnection(service.ID, session)
+
+		select {
+		case delivery := <-received:
+			assert.Equal(t, "/all "+ProjectEventServiceDisconnected, delivery)
+		case <-time.After(2 * time.Second):
+			t.Fatal("project webhook was not notified")
+		}
+	})
+
+	t.Run("clearing a webhook's events subscribes it to all of them", func(t *testing.T) {
+		w := request(http.MethodPatch, "/webhooks/"+failures.ID, `{"events":[]}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var updated ProjectWebhook
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+		assert.Empty(t, updated.Events)
+		assert.Len(t, notified(ProjectEventServiceDrained), 2)
+	})
+
+	t.Run("webhooks keep their events when their URL changes", func(t *testing.T) {
+		w := request(http.MethodPatch, "/webhooks/"+failures.ID, `{"events":["orchestration.completed"]}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = request(http.MethodPatch, "/webhooks/"+failures.ID, `{"url":"`+receiver.URL+`/completions"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var updated ProjectWebhook
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+		assert.Equal(t, []string{ProjectEventOrchestrationCompleted}, updated.Events)
+		assert.Equal(t, map[string][]string{updated.Url: updated.Events}, app.Engine.projects[project.ID].WebhookEvents)
+	})
+
+	t.Run("rejects unknown events", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/other","events":["task.exploded"]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+projectWebhookID(receiver.URL+"/all"), `{"events":["task.exploded"]}`).Code)
+	})
+}
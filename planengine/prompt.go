@@ -114,7 +114,7 @@ Guidelines:
 1. Each service described above contains input/output types and description. You must strictly adhere to these types and descriptions when using the services.
 2. Each task in the plan should strictly use one of the available services. Follow the JSON conventions for each task.
 3. Each task MUST have a unique ID, which is strictly increasing.
-4. With the excpetion of Task 0, whose inputs are constants derived from the User Action, inputs for other tasks have to be outputs from preceding tasks. In the latter case, use the format $taskId to denote the ID of the previous task whose output will be the input.
+4. With the excpetion of Task 0, whose inputs are constants derived from the User Action, inputs for other tasks have to be outputs from preceding tasks. In the latter case, use the format $taskId to denote the ID of the previous task whose output will be the input. Select nested output fields with dots and array indexes, e.g. $task1.customer.emails[0].
 5. There can only be a single Task 0, other tasks HAVE TO CORRESPOND TO AVAILABLE SERVICES.
 6. Task 0 should not be assigned a service, as it is a placeholder for inputs that are constants derived from the User Action params.
 7. When assigning service IDs to tasks, PLEASE PRESERVE THE EXACT ORIGINAL CASING of the IDs because they are case sensitive.
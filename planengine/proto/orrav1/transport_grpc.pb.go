@@ -0,0 +1,139 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: orrav1/transport.proto
+
+package orrav1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ServiceTransport_Connect_FullMethodName = "/orra.v1.ServiceTransport/Connect"
+)
+
+// ServiceTransportClient is the client API for ServiceTransport service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ServiceTransport connects services and agents to the plan engine over gRPC, as an alternative to the WebSocket.
+//
+// Connections are authenticated with the same credentials as the WebSocket, sent as metadata:
+//
+//	authorization:        "Bearer <api key or ws token>"
+//	x-orra-service-id:    the connecting service's ID
+//	x-orra-resume-token:  optional, the token of the previous connection, to replay messages sent while disconnected
+type ServiceTransportClient interface {
+	// Connect opens a service's stream. The plan engine streams tasks to the service, the service streams back
+	// acknowledgements, statuses and results.
+	Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ServiceMessage, EngineMessage], error)
+}
+
+type serviceTransportClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewServiceTransportClient(cc grpc.ClientConnInterface) ServiceTransportClient {
+	return &serviceTransportClient{cc}
+}
+
+func (c *serviceTransportClient) Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ServiceMessage, EngineMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ServiceTransport_ServiceDesc.Streams[0], ServiceTransport_Connect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ServiceMessage, EngineMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ServiceTransport_ConnectClient = grpc.BidiStreamingClient[ServiceMessage, EngineMessage]
+
+// ServiceTransportServer is the server API for ServiceTransport service.
+// All implementations must embed UnimplementedServiceTransportServer
+// for forward compatibility.
+//
+// ServiceTransport connects services and agents to the plan engine over gRPC, as an alternative to the WebSocket.
+//
+// Connections are authenticated with the same credentials as the WebSocket, sent as metadata:
+//
+//	authorization:        "Bearer <api key or ws token>"
+//	x-orra-service-id:    the connecting service's ID
+//	x-orra-resume-token:  optional, the token of the previous connection, to replay messages sent while disconnected
+type ServiceTransportServer interface {
+	// Connect opens a service's stream. The plan engine streams tasks to the service, the service streams back
+	// acknowledgements, statuses and results.
+	Connect(grpc.BidiStreamingServer[ServiceMessage, EngineMessage]) error
+	mustEmbedUnimplementedServiceTransportServer()
+}
+
+// UnimplementedServiceTransportServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedServiceTransportServer struct{}
+
+func (UnimplementedServiceTransportServer) Connect(grpc.BidiStreamingServer[ServiceMessage, EngineMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedServiceTransportServer) mustEmbedUnimplementedServiceTransportServer() {}
+func (UnimplementedServiceTransportServer) testEmbeddedByValue()                          {}
+
+// UnsafeServiceTransportServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ServiceTransportServer will
+// result in compilation errors.
+type UnsafeServiceTransportServer interface {
+	mustEmbedUnimplementedServiceTransportServer()
+}
+
+func RegisterServiceTransportServer(s grpc.ServiceRegistrar, srv ServiceTransportServer) {
+	// If the following call pancis, it indicates UnimplementedServiceTransportServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ServiceTransport_ServiceDesc, srv)
+}
+
+func _ServiceTransport_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ServiceTransportServer).Connect(&grpc.GenericServerStream[ServiceMessage, EngineMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ServiceTransport_ConnectServer = grpc.BidiStreamingServer[ServiceMessage, EngineMessage]
+
+// ServiceTransport_ServiceDesc is the grpc.ServiceDesc for ServiceTransport service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ServiceTransport_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "orra.v1.ServiceTransport",
+	HandlerType: (*ServiceTransportServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _ServiceTransport_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "orrav1/transport.proto",
+}
@@ -0,0 +1,191 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	"github.com/olahol/melody"
+)
+
+var ErrSendQueueFull = errors.New("service connection send queue is full")
+
+const sendQueueKey = "sendQueue"
+
+// queuedSession is a session queuing its outbound messages itself, e.g. a gRPC stream or a callback endpoint
+type queuedSession interface {
+	queued() int
+}
+
+// sendQueue tracks a service connection's messages waiting to be sent, and those dropped as too many were waiting.
+// WebSocket messages are counted from when they're written until melody sends them.
+type sendQueue struct {
+	pending atomic.Int64
+	dropped atomic.Int64
+}
+
+// SendQueueStats reports on the send queue of one of a service's connected instances
+type SendQueueStats struct {
+	InstanceID string `json:"instanceId"`
+	Depth      int    `json:"depth"`
+	Dropped    int64  `json:"dropped"`
+	Busy       bool   `json:"busy"`
+}
+
+// ServiceQueues reports on the send queues of a service's connections
+type ServiceQueues struct {
+	ServiceID   string           `json:"serviceId"`
+	Busy        bool             `json:"busy"`
+	Connections []SendQueueStats `json:"connections"`
+}
+
+// ConfigureSendQueue replaces the default send queue bounds, unset settings keep their defaults
+func (wsm *WebSocketManager) ConfigureSendQueue(cfg SendQueue) {
+	if cfg.Size > 0 {
+		wsm.sendQueueSize = cfg.Size
+		wsm.melody.Config.MessageBufferSize = cfg.Size
+	}
+	if cfg.BusyThreshold > 0 {
+		wsm.busyThreshold = cfg.BusyThreshold
+	}
+}
+
+func sessionSendQueue(s serviceSession) *sendQueue {
+	value, _ := s.Get(sendQueueKey)
+	queue, _ := value.(*sendQueue)
+	return queue
+}
+
+func (q *sendQueue) depth(s serviceSession) int {
+	if queued, ok := s.(queuedSession); ok {
+		return queued.queued()
+	}
+	return int(q.pending.Load())
+}
+
+// reserve makes room for n messages, unless the queue can't fit them
+func (q *sendQueue) reserve(s serviceSession, n, size int) bool {
+	if queued, ok := s.(queuedSession); ok {
+		return queued.queued()+n <= size
+	}
+	if q.pending.Add(int64(n)) > int64(size) {
+		q.pending.Add(-int64(n))
+		return false
+	}
+	return true
+}
+
+func (q *sendQueue) release(s serviceSession, n int) {
+	if _, ok := s.(queuedSession); !ok {
+		q.pending.Add(-int64(n))
+	}
+}
+
+// writeMessage writes a JSON message to a session in the encoding it negotiated, dropping it if the session's
+// send queue is full, e.g. as the service is too slow to read its messages. Messages larger than the service
+// accepts are written in chunks, which all fit in the queue or are dropped together.
+func (wsm *WebSocketManager) writeMessage(s serviceSession, message []byte) error {
+	frames := [][]byte{message}
+	if maxBytes := sessionMaxMessageBytes(s); maxBytes > 0 && len(message) > maxBytes {
+		chunks, err := chunkMessage(message, maxBytes)
+		if err != nil {
+			return err
+		}
+		frames = chunks
+	}
+
+	queue := sessionSendQueue(s)
+	if queue == nil {
+		for _, frame := range frames {
+			if err := writeEncoded(s, frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !queue.reserve(s, len(frames), wsm.sendQueueSize) {
+		queue.dropped.Add(1)
+		serviceID, _ := s.Get("serviceID")
+		wsm.logger.Warn().
+			Interface("ServiceID", serviceID).
+			Str("InstanceID", sessionInstanceID(s)).
+			Int("QueueSize", wsm.sendQueueSize).
+			Msg("Dropped message for service connection with a full send queue")
+		return ErrSendQueueFull
+	}
+	for i, frame := range frames {
+		if err := writeEncoded(s, frame); err != nil {
+			queue.release(s, len(frames)-i)
+			return err
+		}
+	}
+	return nil
+}
+
+func (wsm *WebSocketManager) handleMessageSent(s *melody.Session, _ []byte) {
+	if queue := sessionSendQueue(s); queue != nil {
+		queue.release(s, 1)
+	}
+}
+
+// IsServiceBusy reports whether all the service's connected instances have backed up send queues
+func (wsm *WebSocketManager) IsServiceBusy(serviceID string) bool {
+	sessions := wsm.instanceSessions(serviceID)
+	if len(sessions) == 0 {
+		return false
+	}
+	for _, s := range sessions {
+		queue := sessionSendQueue(s)
+		if queue == nil || queue.depth(s) < wsm.busyThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+// ServiceQueues returns the send queue depth and dropped messages of each of the service's connected instances
+func (wsm *WebSocketManager) ServiceQueues(serviceID string) ServiceQueues {
+	queues := ServiceQueues{ServiceID: serviceID, Connections: []SendQueueStats{}}
+	for _, s := range wsm.instanceSessions(serviceID) {
+		stats := SendQueueStats{InstanceID: sessionInstanceID(s)}
+		if queue := sessionSendQueue(s); queue != nil {
+			stats.Depth = queue.depth(s)
+			stats.Dropped = queue.dropped.Load()
+			stats.Busy = stats.Depth >= wsm.busyThreshold
+		}
+		queues.Connections = append(queues.Connections, stats)
+	}
+	queues.Busy = wsm.IsServiceBusy(serviceID)
+	return queues
+}
+
+// ServiceQueuesHandler reports on the send queues of one of the caller's services
+func (app *App) ServiceQueuesHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	service, err := app.Engine.GetService(project.ID, mux.Vars(r)["id"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.Engine.WebSocketManager.ServiceQueues(service.ID)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
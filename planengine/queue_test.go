@@ -0,0 +1,77 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendQueuesAreBounded(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.ConfigureSendQueue(SendQueue{Size: 2, BusyThreshold: 2})
+	app.Engine.WebSocketManager = wsm
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+	// The session's endpoint is never posted to, so its messages stay queued
+	session := &callbackSession{wsm: wsm, serviceID: service.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	wsm.HandleConnection(service.ID, service.Name, session)
+
+	for _, id := range []string{"task1", "task2"} {
+		require.NoError(t, wsm.SendTask(service.ID, &Task{Type: "task_request", ID: id, OrchestrationID: "o_1"}))
+	}
+	assert.True(t, wsm.IsServiceBusy(service.ID))
+	err := wsm.SendTask(service.ID, &Task{Type: "task_request", ID: "task3", OrchestrationID: "o_1"})
+	assert.ErrorIs(t, err, ErrSendQueueFull)
+
+	req := httptest.NewRequest(http.MethodGet, "/services/"+service.ID+"/queues", nil)
+	req.Header.Set("Authorization", "Bearer project-api-key")
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var queues ServiceQueues
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&queues))
+	assert.True(t, queues.Busy)
+	assert.Equal(t, []SendQueueStats{{Depth: 2, Dropped: 1, Busy: true}}, queues.Connections)
+
+	t.Run("websocket messages leave the queue once sent", func(t *testing.T) {
+		wsm := NewWebSocketManager(zerolog.Nop())
+		wsm.melody.HandleConnect(func(s *melody.Session) {
+			wsm.HandleConnection("s_echo", "Echo", s)
+		})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = wsm.melody.HandleRequest(w, r)
+		}))
+		defer server.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Eventually(t, func() bool { return wsm.IsServiceHealthy("s_echo") }, time.Second, 5*time.Millisecond)
+
+		require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task1", OrchestrationID: "o_1"}))
+		assert.Eventually(t, func() bool {
+			queues := wsm.ServiceQueues("s_echo")
+			return len(queues.Connections) == 1 && queues.Connections[0].Depth == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+}
@@ -0,0 +1,172 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	requestsBucket           = "requests"
+	orchestrationsBucket     = "orchestrations"
+	rateLimitIdleTimeout     = 10 * time.Minute
+	rateLimitCleanupInterval = time.Minute
+)
+
+// tokenBucket refills continuously up to its capacity
+type tokenBucket struct {
+	capacity   float64
+	tokens     float64
+	refillRate float64 // tokens per second
+	last       time.Time
+}
+
+func newTokenBucket(capacity, refillRate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity:   capacity,
+		tokens:     capacity,
+		refillRate: refillRate,
+		last:       now,
+	}
+}
+
+// take attempts to remove a token, returning the tokens left or how long until one is available
+func (b *tokenBucket) take(now time.Time) (bool, int, time.Duration) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.refillRate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, int(b.tokens), 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.refillRate * float64(time.Second))
+	return false, 0, wait
+}
+
+// RateLimitDecision describes the outcome of a rate limit check
+type RateLimitDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimiter enforces token bucket limits per caller, callers are identified by their project and API key so
+// only authenticated callers are given buckets
+type RateLimiter struct {
+	mu      sync.Mutex
+	cfg     RateLimit
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func NewRateLimiter(cfg RateLimit) *RateLimiter {
+	return &RateLimiter{
+		cfg:     cfg,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// AllowRequest applies the general requests per second limit for a caller
+func (rl *RateLimiter) AllowRequest(caller string) RateLimitDecision {
+	if rl.cfg.RequestsPerSecond <= 0 {
+		return RateLimitDecision{Allowed: true}
+	}
+
+	burst := rl.cfg.RequestsBurst
+	if burst < 1 {
+		burst = int(math.Ceil(rl.cfg.RequestsPerSecond))
+	}
+	return rl.allow(requestsBucket, caller, float64(burst), rl.cfg.RequestsPerSecond)
+}
+
+// AllowOrchestration applies the orchestrations per minute limit for a caller
+func (rl *RateLimiter) AllowOrchestration(caller string) RateLimitDecision {
+	if rl.cfg.OrchestrationsPerMinute <= 0 {
+		return RateLimitDecision{Allowed: true}
+	}
+
+	perMinute := float64(rl.cfg.OrchestrationsPerMinute)
+	return rl.allow(orchestrationsBucket, caller, perMinute, perMinute/60)
+}
+
+func (rl *RateLimiter) allow(bucketName, caller string, capacity, refillRate float64) RateLimitDecision {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	key := fmt.Sprintf("%s:%s", bucketName, caller)
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(capacity, refillRate, now)
+		rl.buckets[key] = bucket
+	}
+
+	allowed, remaining, retryAfter := bucket.take(now)
+	return RateLimitDecision{
+		Allowed:    allowed,
+		Limit:      int(capacity),
+		Remaining:  remaining,
+		RetryAfter: retryAfter,
+	}
+}
+
+// StartCleanup periodically drops the buckets of callers that have gone idle
+func (rl *RateLimiter) StartCleanup(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				rl.evictIdle()
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (rl *RateLimiter) evictIdle() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) > rateLimitIdleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func writeRateLimitHeaders(w http.ResponseWriter, prefix string, decision RateLimitDecision) {
+	if decision.Limit == 0 {
+		return
+	}
+	w.Header().Set(fmt.Sprintf("X-RateLimit-%sLimit", prefix), strconv.Itoa(decision.Limit))
+	w.Header().Set(fmt.Sprintf("X-RateLimit-%sRemaining", prefix), strconv.Itoa(decision.Remaining))
+}
+
+// tooManyRequestsResponse replies with a 429 as problem details
+func tooManyRequestsResponse(w http.ResponseWriter, retryAfter time.Duration, code, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeProblem(w, newProblem(http.StatusTooManyRequests, "too many requests", code, "", message))
+}
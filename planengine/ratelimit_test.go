@@ -0,0 +1,125 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_AllowRequest(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 1, RequestsBurst: 2})
+	limiter.now = func() time.Time { return now }
+
+	first := limiter.AllowRequest("sk-orra-v1-abc")
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 2, first.Limit)
+	assert.Equal(t, 1, first.Remaining)
+
+	assert.True(t, limiter.AllowRequest("sk-orra-v1-abc").Allowed)
+
+	denied := limiter.AllowRequest("sk-orra-v1-abc")
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, time.Second, denied.RetryAfter)
+
+	assert.True(t, limiter.AllowRequest("sk-orra-v1-other").Allowed, "limits are tracked per API key")
+
+	now = now.Add(time.Second)
+	assert.True(t, limiter.AllowRequest("sk-orra-v1-abc").Allowed, "tokens refill over time")
+}
+
+func TestRateLimiter_DisabledWhenZero(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{})
+	for i := 0; i < 100; i++ {
+		require.True(t, limiter.AllowRequest("sk-orra-v1-abc").Allowed)
+		require.True(t, limiter.AllowOrchestration("sk-orra-v1-abc").Allowed)
+	}
+}
+
+func TestOrchestrationRateLimitMiddleware(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Limiter = NewRateLimiter(RateLimit{RequestsPerSecond: 100, OrchestrationsPerMinute: 1})
+
+	handler := app.APIKeyMiddleware(app.OrchestrationRateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations", nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := send()
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("X-RateLimit-Orchestrations-Limit"))
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Orchestrations-Remaining"))
+	assert.Equal(t, "100", rr.Header().Get("X-RateLimit-Limit"))
+
+	rr = send()
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), RateLimitExceededErrCode)
+}
+
+func TestRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 1})
+	limiter.now = func() time.Time { return now }
+
+	limiter.AllowRequest("apikey:project-id:key-a")
+	now = now.Add(rateLimitIdleTimeout / 2)
+	limiter.AllowRequest("apikey:project-id:key-b")
+
+	now = now.Add(rateLimitIdleTimeout/2 + time.Second)
+	limiter.evictIdle()
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, requestsBucket+":apikey:project-id:key-b")
+}
+
+func TestAPIKeyMiddleware_RateLimitsResolvedCallers(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Limiter = NewRateLimiter(RateLimit{RequestsPerSecond: 1, RequestsBurst: 3})
+
+	handler := app.APIKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	var codes []int
+	for i := range 5 {
+		codes = append(codes, send(fmt.Sprintf("sk-orra-v1-unknown-%d", i)).Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes,
+		"unknown API keys share their client address's bucket")
+	assert.Len(t, app.Limiter.buckets, 1)
+	assert.Contains(t, app.Limiter.buckets, requestsBucket+":ip:192.0.2.1")
+
+	rr := send("project-api-key")
+	assert.Equal(t, http.StatusOK, rr.Code, "known keys have their own bucket")
+	assert.Equal(t, "3", rr.Header().Get("X-RateLimit-Limit"))
+	key, ok := project.MatchingAPIKey("project-api-key")
+	require.True(t, ok)
+	assert.Contains(t, app.Limiter.buckets, fmt.Sprintf("%s:apikey:%s:%s", requestsBucket, project.ID, key.ID))
+}
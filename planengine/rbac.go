@@ -0,0 +1,351 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+// Role governs what a project member is allowed to do
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleDeveloper Role = "developer"
+	RoleViewer    Role = "viewer"
+
+	ProjectHeader = "X-Orra-Project"
+)
+
+var (
+	ErrNotProjectMember  = errors.New("user is not a member of the project")
+	ErrNoProjectSelected = fmt.Errorf("no project selected, set the %s header", ProjectHeader)
+	ErrInsufficientRole  = errors.New("insufficient role for this operation")
+	ErrProjectNeedsOwner = errors.New("a project must keep at least one owner")
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer:    1,
+	RoleDeveloper: 2,
+	RoleOwner:     3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Allows reports whether the role grants at least the required role's permissions
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// ProjectMember grants an OIDC user a role on a project.
+// Members can be added by verified email before their subject is known.
+type ProjectMember struct {
+	Subject string    `json:"subject,omitempty"`
+	Email   string    `json:"email,omitempty"`
+	Role    Role      `json:"role"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+func (m ProjectMember) matches(claims *UserClaims) bool {
+	if m.Subject != "" {
+		return m.Subject == claims.Subject
+	}
+	return m.Email != "" && claims.EmailVerified && strings.EqualFold(m.Email, claims.Email)
+}
+
+func (m ProjectMember) identifiedBy(identifier string) bool {
+	return (m.Subject != "" && m.Subject == identifier) || (m.Email != "" && strings.EqualFold(m.Email, identifier))
+}
+
+// MemberRole returns the user's role on the project, if they're a member
+func (p *Project) MemberRole(claims *UserClaims) (Role, bool) {
+	for _, member := range p.Members {
+		if member.matches(claims) {
+			return member.Role, true
+		}
+	}
+	return "", false
+}
+
+func (p *Project) ownerCount() int {
+	count := 0
+	for _, member := range p.Members {
+		if member.Role == RoleOwner {
+			count++
+		}
+	}
+	return count
+}
+
+type principalContextKey struct{}
+
+// Principal is the authenticated caller of a project scoped endpoint, either an API key or an OIDC user.
+// API keys act with owner permissions on their project.
+type Principal struct {
+	Actor     string
+	Role      Role
+	ProjectID string
+	APIKey    string
+	User      *UserClaims
+	// RegistrationToken is set when the caller may only register the token's service
+	RegistrationToken *RegistrationToken
+	// RateLimitKey identifies the caller to the rate limiter, see rateLimitKey
+	RateLimitKey string
+}
+
+// rateLimitKey identifies the principal for rate limiting, API keys by their project and key ID so each key has
+// its own bucket. Only verified users are identified without a project, API keys matching no project share their
+// client address's bucket.
+func (p *Principal) rateLimitKey(project *Project, clientAddr string) string {
+	if p.User != nil {
+		return "user:" + p.User.Subject
+	}
+	if project == nil {
+		return "ip:" + clientAddr
+	}
+	if p.RegistrationToken != nil {
+		return "regtoken:" + project.ID
+	}
+	if key, ok := project.MatchingAPIKey(p.APIKey); ok {
+		return fmt.Sprintf("apikey:%s:%s", project.ID, key.ID)
+	}
+	return "project:" + project.ID
+}
+
+func principalFromRequest(r *http.Request) *Principal {
+	principal, _ := r.Context().Value(principalContextKey{}).(*Principal)
+	return principal
+}
+
+// authenticate resolves the principal for a bearer credential
+func (app *App) authenticate(r *http.Request, credential string) (*Principal, error) {
+	if strings.HasPrefix(credential, RegistrationTokenPrefix) {
+		return app.authenticateRegistrationToken(credential)
+	}
+	if app.OIDC == nil || !looksLikeJWT(credential) {
+		return &Principal{Actor: auditActor(nil, credential), Role: RoleOwner, APIKey: credential}, nil
+	}
+
+	claims, err := app.OIDC.Verify(r.Context(), credential)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Actor: "user:" + claims.Subject, User: claims}
+
+	projectID := r.Header.Get(ProjectHeader)
+	if projectID == "" {
+		// Users belonging to a single project don't need to pick one
+		if projects := app.Engine.ProjectsForUser(claims); len(projects) == 1 {
+			projectID = projects[0].ID
+		}
+	}
+	if projectID == "" {
+		return principal, nil
+	}
+
+	project, err := app.Engine.GetProjectByID(projectID)
+	if err != nil {
+		return nil, ErrNotProjectMember
+	}
+	role, ok := project.MemberRole(claims)
+	if !ok {
+		return nil, ErrNotProjectMember
+	}
+
+	principal.ProjectID = project.ID
+	principal.Role = role
+	return principal, nil
+}
+
+// principalProject resolves the project the principal is acting on
+func (app *App) principalProject(principal *Principal) (*Project, error) {
+	if principal == nil {
+		return nil, fmt.Errorf("request is not authenticated")
+	}
+	if principal.User == nil && principal.RegistrationToken == nil {
+		return app.Engine.GetProjectByApiKey(principal.APIKey)
+	}
+	if principal.ProjectID == "" {
+		return nil, ErrNoProjectSelected
+	}
+	return app.Engine.GetProjectByID(principal.ProjectID)
+}
+
+// requestProject resolves the project an authenticated request is acting on
+func (app *App) requestProject(r *http.Request) (*Project, error) {
+	return app.principalProject(principalFromRequest(r))
+}
+
+// requestProjectFor resolves the caller's project for a request naming a project in its path, projects other than
+// the caller's are unknown to it
+func (app *App) requestProjectFor(r *http.Request) (*Project, error) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		return nil, errs.E(errs.InvalidRequest, err)
+	}
+	if projectID := mux.Vars(r)["id"]; projectID != project.ID {
+		return nil, errs.E(errs.NotExist, errs.Code(UnknownProjectErrCode), "unknown project: "+projectID)
+	}
+	return project, nil
+}
+
+// RequireRole rejects callers whose role on the project is below the required role
+func (app *App) RequireRole(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromRequest(r)
+		if principal == nil || !principal.Role.Allows(required) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unauthorized, ErrInsufficientRole))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// withRole authenticates the caller and requires at least the given role on the project
+func (app *App) withRole(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return app.APIKeyMiddleware(app.RequireRole(required, next))
+}
+
+// optionalUser returns the OIDC user making an otherwise unauthenticated request, if any
+func (app *App) optionalUser(r *http.Request) *UserClaims {
+	if app.OIDC == nil {
+		return nil
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !looksLikeJWT(token) {
+		return nil
+	}
+	claims, err := app.OIDC.Verify(r.Context(), token)
+	if err != nil {
+		logger := app.requestLogger(r)
+		logger.Warn().Err(err).Msg("Ignoring invalid ID token")
+		return nil
+	}
+	return claims
+}
+
+// AddProjectMember grants a user a role on the caller's project
+func (app *App) AddProjectMember(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	var member ProjectMember
+	if err := decodeRequest(w, r, &member, projectMemberFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if member.Subject == "" && member.Email == "" {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("email"), "either a subject or an email is required"))
+		return
+	}
+	if !member.Role.Valid() {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("role"), fmt.Sprintf("role must be one of %s, %s or %s", RoleOwner, RoleDeveloper, RoleViewer)))
+		return
+	}
+	member.AddedAt = time.Now().UTC()
+
+	if err := app.Engine.AddProjectMember(project.ID, member); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ProjectMemberUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(member); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// ListProjectMembers returns the users with access to the caller's project
+func (app *App) ListProjectMembers(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	members := project.Members
+	if members == nil {
+		members = make([]ProjectMember, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
+
+// RemoveProjectMember revokes a user's access to the caller's project
+func (app *App) RemoveProjectMember(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	identifier := mux.Vars(r)["member"]
+	if err := app.Engine.RemoveProjectMember(project.ID, identifier); err != nil {
+		if errors.Is(err, ErrProjectMemberNotFound) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, err))
+			return
+		}
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ProjectMemberUpdateFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CurrentUser returns the signed-in user and the projects they're a member of
+func (app *App) CurrentUser(w http.ResponseWriter, r *http.Request) {
+	principal := principalFromRequest(r)
+	if principal == nil || principal.User == nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, "only available to users signed in with OIDC"))
+		return
+	}
+
+	type membership struct {
+		ProjectID   string `json:"projectId"`
+		ProjectName string `json:"projectName"`
+		Role        Role   `json:"role"`
+	}
+
+	memberships := make([]membership, 0)
+	for _, project := range app.Engine.ProjectsForUser(principal.User) {
+		role, _ := project.MemberRole(principal.User)
+		memberships = append(memberships, membership{ProjectID: project.ID, ProjectName: project.Name, Role: role})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"user":     principal.User,
+		"projects": memberships,
+	}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	provider := &testOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   provider.server.URL,
+			"jwks_uri": provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+
+	return provider
+}
+
+func (p *testOIDCProvider) token(t *testing.T, subject, email string, expiresAt time.Time) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	require.NoError(t, err)
+	claims, err := json.Marshal(map[string]any{
+		"iss":            p.server.URL,
+		"aud":            "orra",
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"exp":            expiresAt.Unix(),
+	})
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCVerifier_Verify(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	verifier := NewOIDCVerifier(OIDC{IssuerURL: provider.server.URL, ClientID: "orra"})
+
+	claims, err := verifier.Verify(context.Background(), provider.token(t, "user-1", "dev@example.com", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "dev@example.com", claims.Email)
+
+	_, err = verifier.Verify(context.Background(), provider.token(t, "user-1", "dev@example.com", time.Now().Add(-time.Hour)))
+	assert.ErrorIs(t, err, ErrIDTokenExpired)
+
+	tampered := provider.token(t, "user-1", "dev@example.com", time.Now().Add(time.Hour))
+	_, err = verifier.Verify(context.Background(), tampered[:len(tampered)-4]+"AAAA")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestRBAC_ProjectRoles(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	provider := newTestOIDCProvider(t)
+	app.OIDC = NewOIDCVerifier(OIDC{IssuerURL: provider.server.URL, ClientID: "orra"})
+
+	send := func(method, path, credential string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credential))
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// API keys act as project owners
+	w := send(http.MethodPost, "/projects/members", project.APIKey, []byte(`{"email":"viewer@example.com","role":"viewer"}`))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = send(http.MethodPost, "/projects/members", project.APIKey, []byte(`{"subject":"dev-1","role":"developer"}`))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = send(http.MethodPost, "/projects/members", project.APIKey, []byte(`{"subject":"dev-2","rol":"owner"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "unknown fields are rejected")
+
+	viewer := provider.token(t, "viewer-1", "viewer@example.com", time.Now().Add(time.Hour))
+	developer := provider.token(t, "dev-1", "dev@example.com", time.Now().Add(time.Hour))
+	stranger := provider.token(t, "stranger", "stranger@example.com", time.Now().Add(time.Hour))
+
+	t.Run("viewers can read but not mutate", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, "/groundings", viewer, nil).Code)
+		assert.Equal(t, http.StatusForbidden, send(http.MethodDelete, "/groundings", viewer, nil).Code)
+	})
+
+	t.Run("developers can mutate but not manage keys", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/groundings", developer, nil).Code)
+		assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/apikeys", developer, nil).Code)
+	})
+
+	t.Run("non members are rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/groundings", nil)
+		req.Header.Set("Authorization", "Bearer "+stranger)
+		req.Header.Set(ProjectHeader, project.ID)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("users registering a project become its owner", func(t *testing.T) {
+		w := send(http.MethodPost, "/register/project", stranger, []byte(`{"name":"strangers"}`))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		w = send(http.MethodGet, "/users/me", stranger, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"role":"owner"`)
+	})
+}
@@ -0,0 +1,279 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+const RegistrationTokenPrefix = "ort_"
+
+var (
+	ErrInvalidRegistrationToken  = errors.New("invalid registration token")
+	ErrRegistrationTokenExpired  = errors.New("registration token has expired")
+	ErrRegistrationTokenUsed     = errors.New("registration token has already been used")
+	ErrRegistrationTokenRequired = errors.New("project requires a registration token to register services")
+	ErrRegistrationTokensOff     = errors.New("registration tokens are not enabled")
+	ErrRegistrationTokenInUse    = errors.New("registration token is being used by another registration")
+)
+
+// RegistrationToken lets a single service register itself with a project without holding the project API key.
+// The token is signed by the plan engine and bound to the service name it was minted for.
+type RegistrationToken struct {
+	ID          string     `json:"id"`
+	ProjectID   string     `json:"projectId"`
+	ServiceName string     `json:"serviceName"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UsedAt      *time.Time `json:"usedAt,omitempty"`
+}
+
+type registrationClaims struct {
+	ID          string `json:"jti"`
+	ProjectID   string `json:"prj"`
+	ServiceName string `json:"svc"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+type RegistrationTokenStorage interface {
+	RegistrationSigningKey() ([]byte, error)
+	StoreRegistrationToken(token *RegistrationToken) error
+	LoadRegistrationToken(id string) (*RegistrationToken, error)
+	RedeemRegistrationToken(id string, usedAt time.Time) error
+}
+
+// RegistrationTokens mints and redeems service registration tokens
+type RegistrationTokens struct {
+	storage RegistrationTokenStorage
+	key     []byte
+	now     func() time.Time
+
+	claimsMu sync.Mutex
+	claimed  map[string]struct{}
+}
+
+func NewRegistrationTokens(storage RegistrationTokenStorage) (*RegistrationTokens, error) {
+	key, err := storage.RegistrationSigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registration token signing key: %w", err)
+	}
+	return &RegistrationTokens{storage: storage, key: key, now: time.Now, claimed: make(map[string]struct{})}, nil
+}
+
+// Issue mints a token for registering the named service, the signed token is only ever returned here
+func (t *RegistrationTokens) Issue(projectID, serviceName string, ttl time.Duration) (*RegistrationToken, string, error) {
+	now := t.now().UTC()
+	token := &RegistrationToken{
+		ID:          "rt_" + short.New(),
+		ProjectID:   projectID,
+		ServiceName: serviceName,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+
+	payload, err := json.Marshal(registrationClaims{
+		ID:          token.ID,
+		ProjectID:   token.ProjectID,
+		ServiceName: token.ServiceName,
+		ExpiresAt:   token.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal registration token claims: %w", err)
+	}
+
+	if err := t.storage.StoreRegistrationToken(token); err != nil {
+		return nil, "", fmt.Errorf("failed to store registration token: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return token, RegistrationTokenPrefix + encoded + "." + t.sign(encoded), nil
+}
+
+// Verify checks a presented token's signature and lifetime and that it hasn't been used
+func (t *RegistrationTokens) Verify(raw string) (*RegistrationToken, error) {
+	encoded, signature, ok := strings.Cut(strings.TrimPrefix(raw, RegistrationTokenPrefix), ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return nil, ErrInvalidRegistrationToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	var claims registrationClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	if t.now().After(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, ErrRegistrationTokenExpired
+	}
+
+	token, err := t.storage.LoadRegistrationToken(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	if token.UsedAt != nil {
+		return nil, ErrRegistrationTokenUsed
+	}
+	return token, nil
+}
+
+// Redeem marks a token used, it fails if the token was redeemed concurrently
+func (t *RegistrationTokens) Redeem(token *RegistrationToken) error {
+	return t.storage.RedeemRegistrationToken(token.ID, t.now().UTC())
+}
+
+// Claim holds a token for one registration at a time, until the returned release is called. Tokens are only
+// redeemed once their registration succeeds, so a failed registration leaves the token for another attempt.
+func (t *RegistrationTokens) Claim(token *RegistrationToken) (func(), error) {
+	t.claimsMu.Lock()
+	defer t.claimsMu.Unlock()
+	if _, ok := t.claimed[token.ID]; ok {
+		return nil, ErrRegistrationTokenInUse
+	}
+	t.claimed[token.ID] = struct{}{}
+
+	return func() {
+		t.claimsMu.Lock()
+		defer t.claimsMu.Unlock()
+		delete(t.claimed, token.ID)
+	}, nil
+}
+
+func (t *RegistrationTokens) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authenticateRegistrationToken resolves a principal that may only register the token's service
+func (app *App) authenticateRegistrationToken(credential string) (*Principal, error) {
+	if app.RegistrationTokens == nil {
+		return nil, ErrRegistrationTokensOff
+	}
+	token, err := app.RegistrationTokens.Verify(credential)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		Actor:             "regtoken:" + token.ID,
+		ProjectID:         token.ProjectID,
+		RegistrationToken: token,
+	}, nil
+}
+
+// withRegistrationAccess lets registration tokens through in addition to callers with the required role
+func (app *App) withRegistrationAccess(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return app.APIKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if principal := principalFromRequest(r); principal != nil && principal.RegistrationToken != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		app.RequireRole(required, next).ServeHTTP(w, r)
+	})
+}
+
+// authoriseRegistration checks the caller may register the named service. Callers using a registration token
+// hold it until they call the returned redeem, with whether their registration succeeded.
+func (app *App) authoriseRegistration(r *http.Request, project *Project, serviceName string) (func(registered bool) error, error) {
+	principal := principalFromRequest(r)
+	if principal == nil || principal.RegistrationToken == nil {
+		if project.Security.RequireRegistrationTokens {
+			return nil, errs.E(errs.Unauthorized, ErrRegistrationTokenRequired)
+		}
+		return func(bool) error { return nil }, nil
+	}
+
+	token := principal.RegistrationToken
+	if token.ServiceName != serviceName {
+		return nil, errs.E(errs.Unauthorized, fmt.Errorf("registration token was issued for service %s", token.ServiceName))
+	}
+	release, err := app.RegistrationTokens.Claim(token)
+	if err != nil {
+		return nil, errs.E(errs.Unauthenticated, err)
+	}
+
+	return func(registered bool) error {
+		defer release()
+		if !registered {
+			return nil
+		}
+		if err := app.RegistrationTokens.Redeem(token); err != nil {
+			return errs.E(errs.Unauthenticated, err)
+		}
+		return nil
+	}, nil
+}
+
+// registrationTokenRequest names the service a registration token is minted for
+type registrationTokenRequest struct {
+	ServiceName string    `json:"serviceName"`
+	TTL         *Duration `json:"ttl"`
+}
+
+// CreateRegistrationToken mints a single use token for registering a named service with the caller's project
+func (app *App) CreateRegistrationToken(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	if app.RegistrationTokens == nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, ErrRegistrationTokensOff))
+		return
+	}
+
+	var request registrationTokenRequest
+	if err := decodeRequest(w, r, &request, []string{"serviceName", "ttl"}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if strings.TrimSpace(request.ServiceName) == "" {
+		httpErrorResponse(w, app.requestLogger(r), missingField("serviceName"))
+		return
+	}
+
+	ttl := RegistrationTokenTTL
+	if request.TTL != nil {
+		ttl = request.TTL.Duration
+	}
+	if ttl <= 0 || ttl > RegistrationTokenMaxTTL {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("ttl"), fmt.Sprintf("ttl must be positive and at most %s", RegistrationTokenMaxTTL)))
+		return
+	}
+
+	token, signed, err := app.RegistrationTokens.Issue(project.ID, request.ServiceName, ttl)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(RegistrationTokenIssueFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":          token.ID,
+		"token":       signed,
+		"serviceName": token.ServiceName,
+		"expiresAt":   token.ExpiresAt,
+	}); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
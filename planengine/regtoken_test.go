@@ -0,0 +1,173 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationTokens_SignedAndSingleUse(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	tokens, err := NewRegistrationTokens(app.Db)
+	require.NoError(t, err)
+
+	token, signed, err := tokens.Issue("p_test", "echo", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signed, RegistrationTokenPrefix))
+
+	verified, err := tokens.Verify(signed)
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, verified.ID)
+	assert.Equal(t, "echo", verified.ServiceName)
+
+	t.Run("signing key survives restarts", func(t *testing.T) {
+		restarted, err := NewRegistrationTokens(app.Db)
+		require.NoError(t, err)
+		_, err = restarted.Verify(signed)
+		assert.NoError(t, err)
+	})
+
+	t.Run("tampered tokens are rejected", func(t *testing.T) {
+		encoded, signature, _ := strings.Cut(strings.TrimPrefix(signed, RegistrationTokenPrefix), ".")
+		_, err := tokens.Verify(RegistrationTokenPrefix + encoded + "x." + signature)
+		assert.ErrorIs(t, err, ErrInvalidRegistrationToken)
+	})
+
+	t.Run("expired tokens are rejected", func(t *testing.T) {
+		_, expired, err := tokens.Issue("p_test", "echo", time.Hour)
+		require.NoError(t, err)
+
+		tokens.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		defer func() { tokens.now = time.Now }()
+
+		_, err = tokens.Verify(expired)
+		assert.ErrorIs(t, err, ErrRegistrationTokenExpired)
+	})
+
+	t.Run("tokens can only be redeemed once", func(t *testing.T) {
+		require.NoError(t, tokens.Redeem(verified))
+		assert.ErrorIs(t, tokens.Redeem(verified), ErrRegistrationTokenUsed)
+
+		_, err := tokens.Verify(signed)
+		assert.ErrorIs(t, err, ErrRegistrationTokenUsed)
+	})
+}
+
+func TestRegisterServiceWithRegistrationToken(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	tokens, err := NewRegistrationTokens(app.Db)
+	require.NoError(t, err)
+	app.RegistrationTokens = tokens
+
+	send := func(method, path, credential string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+credential)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	mint := func(serviceName string) string {
+		w := send(http.MethodPost, "/registration-tokens", project.APIKey, `{"serviceName":"`+serviceName+`","ttl":"1h"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var response struct {
+			Token       string    `json:"token"`
+			ServiceName string    `json:"serviceName"`
+			ExpiresAt   time.Time `json:"expiresAt"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, serviceName, response.ServiceName)
+		return response.Token
+	}
+
+	registration := func(name string) string {
+		return `{"name":"` + name + `","description":"echoes input","schema":{"input":{"type":"object","properties":{"message":{"type":"string"}}},"output":{"type":"object","properties":{"message":{"type":"string"}}}}}`
+	}
+
+	t.Run("token registers only its bound service, once", func(t *testing.T) {
+		token := mint("echo")
+
+		w := send(http.MethodPost, "/register/service", token, registration("other"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send(http.MethodPost, "/register/service", token, registration("echo"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = send(http.MethodPost, "/register/service", token, registration("echo"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("token is only redeemed by a successful registration", func(t *testing.T) {
+		token := mint("echo")
+
+		// echo is already registered as a service, so it can't be registered as an agent
+		w := send(http.MethodPost, "/register/agent", token, registration("echo"))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = send(http.MethodPost, "/register/service", token, registration("echo"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("token is held by one registration at a time", func(t *testing.T) {
+		token := mint("echo")
+		verified, err := tokens.Verify(token)
+		require.NoError(t, err)
+
+		release, err := tokens.Claim(verified)
+		require.NoError(t, err)
+		w := send(http.MethodPost, "/register/service", token, registration("echo"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		release()
+
+		w = send(http.MethodPost, "/register/service", token, registration("echo"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("token grants no other access", func(t *testing.T) {
+		token := mint("echo")
+
+		w := send(http.MethodGet, "/orchestrations", token, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send(http.MethodPost, "/registration-tokens", token, `{"serviceName":"echo"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("projects can require registration tokens", func(t *testing.T) {
+		project.Security.RequireRegistrationTokens = true
+		require.NoError(t, app.Db.StoreProject(project))
+		defer func() {
+			project.Security.RequireRegistrationTokens = false
+			require.NoError(t, app.Db.StoreProject(project))
+		}()
+
+		w := send(http.MethodPost, "/register/service", project.APIKey, registration("echo"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send(http.MethodPost, "/register/service", mint("echo"), registration("echo"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("service name is required", func(t *testing.T) {
+		w := send(http.MethodPost, "/registration-tokens", project.APIKey, `{"ttl":"1h"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,118 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const registrationSigningKey = "meta:registration-signing-key"
+
+var ErrRegistrationTokenNotFound = errors.New("registration token not found")
+
+// RegistrationSigningKey returns the key registration tokens are signed with, generating it on first use
+func (b *BadgerDB) RegistrationSigningKey() ([]byte, error) {
+	var key []byte
+
+	err := b.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(registrationSigningKey))
+		if err == nil {
+			key, err = item.ValueCopy(nil)
+			return err
+		}
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		return txn.Set([]byte(registrationSigningKey), key)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (b *BadgerDB) StoreRegistrationToken(token *RegistrationToken) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return setRegistrationToken(txn, token)
+	})
+}
+
+func (b *BadgerDB) LoadRegistrationToken(id string) (*RegistrationToken, error) {
+	var token *RegistrationToken
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		var err error
+		token, err = getRegistrationToken(txn, id)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RedeemRegistrationToken marks a token used in the same transaction it's checked in, so it can only be redeemed once
+func (b *BadgerDB) RedeemRegistrationToken(id string, usedAt time.Time) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		token, err := getRegistrationToken(txn, id)
+		if err != nil {
+			return err
+		}
+		if token.UsedAt != nil {
+			return ErrRegistrationTokenUsed
+		}
+
+		token.UsedAt = &usedAt
+		return setRegistrationToken(txn, token)
+	})
+}
+
+func getRegistrationToken(txn *badger.Txn, id string) (*RegistrationToken, error) {
+	item, err := txn.Get([]byte(fmt.Sprintf("regtoken:%s", id)))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrRegistrationTokenNotFound
+		}
+		return nil, err
+	}
+
+	var token RegistrationToken
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &token)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registration token: %w", err)
+	}
+	return &token, nil
+}
+
+func setRegistrationToken(txn *badger.Txn, token *RegistrationToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration token: %w", err)
+	}
+
+	// Records are only needed until the token expires
+	ttl := time.Until(token.ExpiresAt) + time.Hour
+	entry := badger.NewEntry([]byte(fmt.Sprintf("regtoken:%s", token.ID)), data).WithTTL(ttl)
+	if err := txn.SetEntry(entry); err != nil {
+		return fmt.Errorf("failed to store registration token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	short "github.com/lithammer/shortuuid/v4"
+	"github.com/rs/zerolog"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern is what a caller's request ID must look like to be propagated, others are replaced
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:+=@/-]{1,128}$`)
+
+// quietRoutes are polled by probes and scrapers, their requests are only logged at debug level
+var quietRoutes = []string{"/health", "/healthz", "/readyz", "/metrics"}
+
+type requestIDKey struct{}
+
+type requestLoggerKey struct{}
+
+func newRequestID() string {
+	return "req_" + short.New()
+}
+
+// requestID is the caller's request ID when it's usable, a new one otherwise
+func requestID(provided string) string {
+	if requestIDPattern.MatchString(provided) {
+		return provided
+	}
+	return newRequestID()
+}
+
+// RequestIDFromContext returns the ID of the request the context belongs to, it's empty outside requests
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger logs with the request's ID, so support can find everything logged about a reported request
+func (app *App) requestLogger(r *http.Request) zerolog.Logger {
+	if logger, ok := r.Context().Value(requestLoggerKey{}).(zerolog.Logger); ok {
+		return logger
+	}
+	return app.Logger
+}
+
+// requestRecorder records a response's status and size, and adds the request's ID to JSON error bodies
+type requestRecorder struct {
+	http.ResponseWriter
+	requestID string
+	status    int
+	bytes     int
+	annotate  bool
+}
+
+func (rr *requestRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+		rr.annotate = status >= http.StatusBadRequest &&
+			(strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") ||
+				strings.HasPrefix(rr.Header().Get("Content-Type"), ProblemContentType))
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *requestRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	if rr.annotate {
+		rr.annotate = false
+		if annotated, ok := withRequestID(b, rr.requestID); ok {
+			n, err := rr.ResponseWriter.Write(annotated)
+			rr.bytes += n
+			if err != nil {
+				return 0, err
+			}
+			return len(b), nil
+		}
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush and extend deadlines through the recorder
+func (rr *requestRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// withRequestID adds the request ID to an error body, problem details or shaped like errs.HTTPErrorResponse's.
+// Other bodies are left alone.
+func withRequestID(body []byte, requestID string) ([]byte, bool) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, false
+	}
+	var serviceError map[string]json.RawMessage
+	if err := json.Unmarshal(response["error"], &serviceError); err != nil || serviceError == nil {
+		return nil, false
+	}
+
+	serviceError["requestId"], _ = json.Marshal(requestID)
+	response["error"], _ = json.Marshal(serviceError)
+	if _, ok := response["type"]; ok {
+		response["requestId"], _ = json.Marshal(requestID)
+	}
+	annotated, err := json.Marshal(response)
+	if err != nil {
+		return nil, false
+	}
+	if bytes.HasSuffix(body, []byte("\n")) {
+		annotated = append(annotated, '\n')
+	}
+	return annotated, true
+}
+
+// RequestIDMiddleware gives every request an ID, the caller's X-Request-ID when it sent a usable one, returns it in
+// the X-Request-ID header and in error bodies, and logs the request once it's served. Handlers log with the ID
+// through requestLogger.
+func (app *App) RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r.Header.Get(RequestIDHeader))
+		logger := app.Logger.With().Str("RequestID", id).Logger()
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, requestLoggerKey{}, logger)
+		r = r.WithContext(ctx)
+		w.Header().Set(RequestIDHeader, id)
+
+		// WebSocket upgrades need the connection itself, they can't be recorded
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := &requestRecorder{ResponseWriter: w, requestID: id}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		level := zerolog.InfoLevel
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			level = zerolog.ErrorLevel
+		case recorder.status >= http.StatusBadRequest:
+			level = zerolog.WarnLevel
+		case slices.Contains(quietRoutes, route):
+			level = zerolog.DebugLevel
+		}
+		logger.WithLevel(level).
+			Str("Method", r.Method).
+			Str("Route", route).
+			Int("Status", recorder.status).
+			Int("Bytes", recorder.bytes).
+			Dur("Duration", time.Since(start)).
+			Msg("HTTP request served")
+	})
+}
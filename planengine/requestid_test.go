@@ -0,0 +1,91 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	app, _, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	var logs bytes.Buffer
+	app.Logger = zerolog.New(&logs)
+
+	get := func(path, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("generates an ID when the caller doesn't send one", func(t *testing.T) {
+		rr := get("/orchestrations", "")
+		assert.True(t, strings.HasPrefix(rr.Header().Get(RequestIDHeader), "req_"))
+	})
+
+	t.Run("propagates the caller's ID", func(t *testing.T) {
+		rr := get("/orchestrations", "support-ticket-42")
+		assert.Equal(t, "support-ticket-42", rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("replaces IDs that can't be logged safely", func(t *testing.T) {
+		rr := get("/orchestrations", "bad id\nwith a newline")
+		assert.True(t, strings.HasPrefix(rr.Header().Get(RequestIDHeader), "req_"))
+	})
+
+	t.Run("error responses and their logs carry the ID", func(t *testing.T) {
+		logs.Reset()
+		rr := get("/orchestrations/inspections/o_missing", "trace-me")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var body struct {
+			Error struct {
+				Kind      string `json:"kind"`
+				RequestID string `json:"requestId"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.Equal(t, "trace-me", body.Error.RequestID)
+		assert.NotEmpty(t, body.Error.Kind)
+
+		lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+		require.Len(t, lines, 2, "the error and the served request are logged")
+		for _, line := range lines {
+			assert.Contains(t, line, `"RequestID":"trace-me"`)
+		}
+		assert.Contains(t, lines[1], `"Route":"/orchestrations/inspections/{id}"`)
+		assert.Contains(t, lines[1], `"Status":400`)
+	})
+}
+
+func TestWebSocketMessageRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	wsm := NewWebSocketManager(zerolog.New(&logs))
+	s := &callbackSession{wsm: wsm, serviceID: "s_1", outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+
+	wsm.HandleMessage(s, []byte(`{"type":"task_result","id":"msg_1","protocolVersion":99,"payload":{}}`), nil)
+	assert.Contains(t, logs.String(), `"RequestID":"msg_1"`)
+
+	logs.Reset()
+	wsm.HandleMessage(s, []byte(`{"type":"task_result","id":"msg_2","requestId":"req_from_sdk","protocolVersion":99,"payload":{}}`), nil)
+	assert.Contains(t, logs.String(), `"RequestID":"req_from_sdk"`)
+}
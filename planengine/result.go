@@ -22,6 +22,7 @@ func NewResultAggregator(dependencies DependencyKeySet, logManager *LogManager)
 			Processed:       make(map[string]bool),
 			DependencyState: make(map[string]json.RawMessage),
 		},
+		skipped: make(map[string]bool),
 	}
 }
 
@@ -101,6 +102,9 @@ func (r *ResultAggregator) processEntry(entry LogEntry, orchestrationID string)
 
 	// Store the entry's output in our dependency state
 	r.logState.DependencyState[entry.GetID()] = entry.GetValue()
+	if entry.GetProducerID() == ConditionProducerID {
+		r.skipped[entry.GetID()] = true
+	}
 
 	if !resultDependenciesMet(r.logState.DependencyState, r.Dependencies) {
 		return nil
@@ -121,9 +125,25 @@ func (r *ResultAggregator) processEntry(entry LogEntry, orchestrationID string)
 	}
 
 	completed := r.LogManager.MarkOrchestrationCompleted(orchestrationID)
-	results := r.logState.DependencyState.SortedValues()
 
-	if err := r.LogManager.FinalizeOrchestration(orchestrationID, completed, nil, results[len(results)-1], false); err != nil {
+	// Tasks skipped by a branch have no result of their own
+	ran := make(DependencyState)
+	for id, output := range r.logState.DependencyState {
+		if !r.skipped[id] {
+			ran[id] = output
+		}
+	}
+	var result json.RawMessage
+	if results := ran.SortedValues(); len(results) > 0 {
+		result = results[len(results)-1]
+	}
+
+	// The next orchestration of a chain is linked before the webhook reports this one's completion
+	if completed == Completed {
+		r.LogManager.planEngine.continueAsNew(orchestrationID)
+	}
+
+	if err := r.LogManager.FinalizeOrchestration(orchestrationID, completed, nil, result, false); err != nil {
 		skipWebhook := strings.Contains(err.Error(), "failed to trigger webhook")
 		return r.LogManager.AppendTaskFailureToLog(
 			orchestrationID,
@@ -0,0 +1,195 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxResultCacheTTL           = 7 * 24 * time.Hour
+	resultCacheCleanupInterval  = 10 * time.Minute
+	resultCacheDefaultCapacity  = 10000
+	resultCacheEvictionFraction = 10
+)
+
+// ResultCachePolicy lets a deterministic service have its outputs reused. Tasks calling the service with an
+// input it has already seen within the TTL are completed with the earlier output, across orchestrations.
+type ResultCachePolicy struct {
+	TTL Duration `json:"ttl"`
+}
+
+func (c *ResultCachePolicy) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.TTL.Duration <= 0 || c.TTL.Duration > maxResultCacheTTL {
+		return fmt.Errorf("ttl must be positive and at most %s", maxResultCacheTTL)
+	}
+	return nil
+}
+
+// TaskResultCache memoizes the outputs of cacheable services, keyed by the service and the task input
+type TaskResultCache struct {
+	mu       sync.Mutex
+	entries  map[string]cachedTaskResult
+	capacity int
+}
+
+type cachedTaskResult struct {
+	Output          json.RawMessage
+	OrchestrationID string // The orchestration whose task produced the output
+	ExpiresAt       time.Time
+}
+
+func NewTaskResultCache(capacity int) *TaskResultCache {
+	if capacity <= 0 {
+		capacity = resultCacheDefaultCapacity
+	}
+	return &TaskResultCache{
+		entries:  make(map[string]cachedTaskResult),
+		capacity: capacity,
+	}
+}
+
+// taskResultCacheKey hashes a task's input with its service's identity. The service version is included
+// so outputs cached before a service re-registers, possibly with different behaviour, are never reused.
+func taskResultCacheKey(service *ServiceInfo, input json.RawMessage) string {
+	return computeHash(fmt.Sprintf("%s:%s:%d:%s", service.ProjectID, service.ID, service.Version, input))
+}
+
+func (c *TaskResultCache) Get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().UTC().After(entry.ExpiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.Output, true
+}
+
+func (c *TaskResultCache) Put(key, orchestrationID string, output json.RawMessage, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.capacity {
+		c.evictLocked()
+	}
+	c.entries[key] = cachedTaskResult{Output: output, OrchestrationID: orchestrationID, ExpiresAt: time.Now().UTC().Add(ttl)}
+}
+
+// DeleteOrchestration drops the outputs an orchestration's tasks put in the cache
+func (c *TaskResultCache) DeleteOrchestration(orchestrationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if entry.OrchestrationID == orchestrationID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// evictLocked drops expired entries, then those closest to expiring until there's room again
+func (c *TaskResultCache) evictLocked() {
+	now := time.Now().UTC()
+	for key, entry := range c.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(c.entries, key)
+		}
+	}
+
+	target := c.capacity - c.capacity/resultCacheEvictionFraction
+	if len(c.entries) < target {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].ExpiresAt.Before(c.entries[keys[j]].ExpiresAt)
+	})
+	for _, key := range keys[:len(keys)-target+1] {
+		delete(c.entries, key)
+	}
+}
+
+func (c *TaskResultCache) StartCleanup(ctx context.Context) {
+	ticker := time.NewTicker(resultCacheCleanupInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				c.cleanup()
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (c *TaskResultCache) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UTC()
+	for key, entry := range c.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// executeTaskCached completes the task with a cached output of its service when there is one, otherwise it
+// executes the task and caches the output. Only services declaring a cache policy are cached.
+func (w *TaskWorker) executeTaskCached(ctx context.Context, orchestrationID string) (json.RawMessage, bool, error) {
+	cache := w.LogManager.planEngine.ResultCache
+	if w.Service.Cache == nil || cache == nil {
+		result, err := w.executeTaskWithRetry(ctx, orchestrationID)
+		return result, false, err
+	}
+
+	input, err := mergeValueMapsToJson(w.logState.DependencyState, w.Dependencies)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal input: %w", err)
+	}
+	key := taskResultCacheKey(w.Service, input)
+
+	if output, hit := cache.Get(key); hit {
+		w.LogManager.Logger.Debug().
+			Str("OrchestrationID", orchestrationID).
+			Str("TaskID", w.TaskID).
+			Str("ServiceID", w.Service.ID).
+			Msg("Task completed from the result cache")
+		result, err := json.Marshal(TaskResultPayload{Task: output})
+		return result, true, err
+	}
+
+	result, err := w.executeTaskWithRetry(ctx, orchestrationID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var payload TaskResultPayload
+	// Results not matching the service's output schema fail the task, they're never reused
+	if err := json.Unmarshal(result, &payload); err == nil && len(payload.Task) > 0 && w.checkTaskOutput(payload.Task) == nil {
+		cache.Put(key, orchestrationID, payload.Task, w.Service.Cache.TTL.Duration)
+	}
+	return result, false, nil
+}
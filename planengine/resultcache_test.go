@@ -0,0 +1,91 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultCachePolicyValidate(t *testing.T) {
+	assert.NoError(t, (*ResultCachePolicy)(nil).Validate())
+	assert.NoError(t, (&ResultCachePolicy{TTL: Duration{time.Hour}}).Validate())
+	assert.Error(t, (&ResultCachePolicy{}).Validate())
+	assert.Error(t, (&ResultCachePolicy{TTL: Duration{maxResultCacheTTL + time.Second}}).Validate())
+}
+
+func TestTaskResultCache(t *testing.T) {
+	cache := NewTaskResultCache(10)
+	service := &ServiceInfo{ID: "s_lookup", ProjectID: "p_1", Version: 1}
+	key := taskResultCacheKey(service, json.RawMessage(`{"sku":"a1"}`))
+
+	_, hit := cache.Get(key)
+	assert.False(t, hit)
+
+	cache.Put(key, "o_test", json.RawMessage(`{"price":10}`), time.Hour)
+	output, hit := cache.Get(key)
+	require.True(t, hit)
+	assert.JSONEq(t, `{"price":10}`, string(output))
+
+	assert.NotEqual(t, key, taskResultCacheKey(service, json.RawMessage(`{"sku":"b2"}`)), "inputs are part of the key")
+	updated := *service
+	updated.Version = 2
+	assert.NotEqual(t, key, taskResultCacheKey(&updated, json.RawMessage(`{"sku":"a1"}`)), "re-registered services start afresh")
+
+	t.Run("expired outputs are not reused", func(t *testing.T) {
+		cache.Put("expired", "o_test", json.RawMessage(`{}`), -time.Second)
+		_, hit := cache.Get("expired")
+		assert.False(t, hit)
+	})
+
+	t.Run("outputs closest to expiring are evicted when full", func(t *testing.T) {
+		full := NewTaskResultCache(10)
+		for i := 0; i < 10; i++ {
+			full.Put(string(rune('a'+i)), "o_test", json.RawMessage(`{}`), time.Duration(i+1)*time.Minute)
+		}
+		full.Put("new", "o_test", json.RawMessage(`{}`), time.Hour)
+
+		_, hit := full.Get("a")
+		assert.False(t, hit)
+		_, hit = full.Get("j")
+		assert.True(t, hit)
+		_, hit = full.Get("new")
+		assert.True(t, hit)
+		assert.Less(t, len(full.entries), 10)
+	})
+}
+
+func TestExecuteTaskCachedReusesOutputs(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	service := &ServiceInfo{ID: "s_lookup", ProjectID: project.ID, Version: 1, Cache: &ResultCachePolicy{TTL: Duration{time.Hour}}}
+	worker := NewTaskWorker(service, "task1", TaskDependenciesWithKeys{TaskZero: {{TaskKey: "sku", DependencyKey: "sku"}}}, time.Second, 0, time.Second, resolveRetryPolicy(nil, nil), logManager).(*TaskWorker)
+	worker.logState.DependencyState[TaskZero] = json.RawMessage(`{"sku":"a1"}`)
+
+	input, err := mergeValueMapsToJson(worker.logState.DependencyState, worker.Dependencies)
+	require.NoError(t, err)
+	app.Engine.ResultCache.Put(taskResultCacheKey(service, input), "o_earlier", json.RawMessage(`{"price":10}`), time.Hour)
+
+	result, hit, err := worker.executeTaskCached(context.Background(), "o_1")
+	require.NoError(t, err)
+	assert.True(t, hit)
+
+	var payload TaskResultPayload
+	require.NoError(t, json.Unmarshal(result, &payload))
+	assert.JSONEq(t, `{"price":10}`, string(payload.Task))
+	assert.Nil(t, payload.Usage, "cached outputs cost nothing")
+}
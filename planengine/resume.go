@@ -0,0 +1,229 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/olahol/melody"
+)
+
+const (
+	WSResumeToken       = "resume_token"
+	WSResumeTokenPrefix = "rt_"
+	WSResumeQueryParam  = "resumeToken"
+)
+
+var (
+	ErrServiceNotConnected = errors.New("service is not connected")
+	ErrOutboxFull          = errors.New("service outbox is full")
+)
+
+// serviceOutbox buffers the messages sent to a service while all its instances are briefly disconnected.
+// An instance resumes its connection with its last token to receive them in the order they were sent.
+type serviceOutbox struct {
+	resumeTokens   map[string]string
+	messages       [][]byte
+	disconnectedAt time.Time
+}
+
+// ConfigureReconnection replaces the default reconnection settings, unset settings keep their defaults
+func (wsm *WebSocketManager) ConfigureReconnection(cfg Reconnection) {
+	if cfg.ResumeWindow > 0 {
+		wsm.resumeWindow = cfg.ResumeWindow
+	}
+	if cfg.MaxBufferedMessages > 0 {
+		wsm.maxBuffered = cfg.MaxBufferedMessages
+	}
+}
+
+// send writes a message to one of the service's connected instances, returning the instance it was sent to.
+// Messages with a routing key are sent to the same instance, see nextInstance.
+// Messages sent while the service is disconnected are buffered if buffer is set and the service may still resume
+// its connection, they're otherwise rejected with ErrServiceNotConnected.
+func (wsm *WebSocketManager) send(serviceID, routingKey string, message []byte, buffer bool) (string, error) {
+	wsm.outboxMu.Lock()
+	defer wsm.outboxMu.Unlock()
+
+	if instanceID, session, connected := wsm.nextInstance(serviceID, routingKey); connected {
+		return instanceID, wsm.writeMessage(session, message)
+	}
+	return "", wsm.buffer(serviceID, message, buffer)
+}
+
+// broadcast writes a message to all the service's connected instances, e.g. to cancel a task whichever instance
+// is running it. Messages sent while the service is disconnected are buffered like those sent with send.
+func (wsm *WebSocketManager) broadcast(serviceID string, message []byte) error {
+	wsm.outboxMu.Lock()
+	defer wsm.outboxMu.Unlock()
+
+	sessions := wsm.instanceSessions(serviceID)
+	if len(sessions) == 0 {
+		return wsm.buffer(serviceID, message, true)
+	}
+
+	var errs []error
+	for _, session := range sessions {
+		if err := wsm.writeMessage(session, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(sessions) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (wsm *WebSocketManager) buffer(serviceID string, message []byte, buffer bool) error {
+	outbox, resumable := wsm.outboxes[serviceID]
+	if resumable && !outbox.disconnectedAt.IsZero() && time.Since(outbox.disconnectedAt) > wsm.resumeWindow {
+		delete(wsm.outboxes, serviceID)
+		resumable = false
+	}
+	if !buffer || !resumable {
+		return fmt.Errorf("%w: %s", ErrServiceNotConnected, serviceID)
+	}
+	if len(outbox.messages) >= wsm.maxBuffered {
+		return fmt.Errorf("%w: %d messages are waiting for service %s to reconnect", ErrOutboxFull, len(outbox.messages), serviceID)
+	}
+
+	outbox.messages = append(outbox.messages, message)
+	return nil
+}
+
+// connect registers a service instance's new session, replaying the messages buffered since the service was last
+// connected if the instance resumed with a valid token. The instance is then issued a new token to resume its next connection.
+func (wsm *WebSocketManager) connect(serviceID string, s serviceSession) error {
+	resumeToken := sessionResumeToken(s)
+	instanceID := sessionInstanceID(s)
+
+	wsm.outboxMu.Lock()
+	defer wsm.outboxMu.Unlock()
+
+	wsm.addInstance(serviceID, s)
+
+	outbox, ok := wsm.outboxes[serviceID]
+	if !ok {
+		outbox = &serviceOutbox{resumeTokens: make(map[string]string)}
+		wsm.outboxes[serviceID] = outbox
+	}
+
+	var missed [][]byte
+	switch {
+	case resumeToken == "":
+	case resumeToken != outbox.resumeTokens[instanceID]:
+		wsm.logger.Warn().Str("ServiceID", serviceID).Msg("Service reconnected with an unknown resume token")
+	case !outbox.disconnectedAt.IsZero() && time.Since(outbox.disconnectedAt) > wsm.resumeWindow:
+		wsm.logger.Warn().Str("ServiceID", serviceID).Msg("Service reconnected after its resume window")
+	default:
+		missed = outbox.messages
+	}
+	if dropped := len(outbox.messages) - len(missed); dropped > 0 {
+		wsm.logger.Info().Str("ServiceID", serviceID).Int("Dropped", dropped).Msg("Dropped messages buffered for a previous connection")
+	}
+	outbox.messages = nil
+	outbox.disconnectedAt = time.Time{}
+
+	token, err := newResumeToken()
+	if err != nil {
+		delete(outbox.resumeTokens, instanceID)
+		return err
+	}
+	outbox.resumeTokens[instanceID] = token
+
+	// The token message also tells the service the largest message it may send in one piece, larger ones are chunked,
+	// and the protocol versions the plan engine speaks alongside the one the connection negotiated
+	tokenMessage, err := json.Marshal(struct {
+		Type                      string `json:"type"`
+		ServiceID                 string `json:"serviceId"`
+		Token                     string `json:"token"`
+		Replayed                  int    `json:"replayed"`
+		MaxMessageBytes           int64  `json:"maxMessageBytes"`
+		ProtocolVersion           int    `json:"protocolVersion"`
+		SupportedProtocolVersions []int  `json:"supportedProtocolVersions"`
+	}{
+		Type:                      WSResumeToken,
+		ServiceID:                 serviceID,
+		Token:                     token,
+		Replayed:                  len(missed),
+		MaxMessageBytes:           WSMaxMessageBytes,
+		ProtocolVersion:           sessionProtocolVersion(s),
+		SupportedProtocolVersions: SupportedProtocolVersions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal resume token: %w", err)
+	}
+	if err := wsm.writeMessage(s, tokenMessage); err != nil {
+		return fmt.Errorf("failed to send resume token: %w", err)
+	}
+
+	for _, message := range missed {
+		if err := wsm.writeMessage(s, message); err != nil {
+			return fmt.Errorf("failed to replay buffered message: %w", err)
+		}
+	}
+	if len(missed) > 0 {
+		wsm.logger.Info().Str("ServiceID", serviceID).Int("Replayed", len(missed)).Msg("Replayed messages buffered while service was disconnected")
+	}
+	return nil
+}
+
+// disconnect unregisters a service instance's session. Once the service's last instance disconnects, its messages
+// are buffered until an instance resumes its connection or the resume window ends.
+func (wsm *WebSocketManager) disconnect(serviceID string, s serviceSession) (removed bool, remaining int) {
+	wsm.outboxMu.Lock()
+	defer wsm.outboxMu.Unlock()
+
+	removed, remaining = wsm.removeInstance(serviceID, s)
+	if outbox, ok := wsm.outboxes[serviceID]; ok && removed && remaining == 0 {
+		outbox.disconnectedAt = time.Now().UTC()
+	}
+	return removed, remaining
+}
+
+// expireOutboxes drops the buffered messages of services that didn't resume their connection in time
+func (wsm *WebSocketManager) expireOutboxes(now time.Time) {
+	wsm.outboxMu.Lock()
+	defer wsm.outboxMu.Unlock()
+
+	for serviceID, outbox := range wsm.outboxes {
+		if outbox.disconnectedAt.IsZero() || now.Sub(outbox.disconnectedAt) <= wsm.resumeWindow {
+			continue
+		}
+		if len(outbox.messages) > 0 {
+			wsm.logger.Warn().
+				Str("ServiceID", serviceID).
+				Int("Dropped", len(outbox.messages)).
+				Msg("Service did not reconnect in time to receive its buffered messages")
+		}
+		delete(wsm.outboxes, serviceID)
+	}
+}
+
+// sessionResumeToken returns the token a service resumed its connection with, if any. WebSocket connections
+// pass it as a query param, other transports set it on the session before connecting.
+func sessionResumeToken(s serviceSession) string {
+	if ws, ok := s.(*melody.Session); ok && ws.Request != nil {
+		return ws.Request.URL.Query().Get(WSResumeQueryParam)
+	}
+	token, _ := s.Get(WSResumeQueryParam)
+	resumeToken, _ := token.(string)
+	return resumeToken
+}
+
+func newResumeToken() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate resume token: %w", err)
+	}
+	return WSResumeTokenPrefix + hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,132 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+// RetryOrchestration starts a new run of a failed orchestration from its failure point. The run keeps the
+// original plan, tasks that already finished hand over their logged outputs and only the rest are executed.
+func (p *PlanEngine) RetryOrchestration(ctx context.Context, orchestrationID string) (*Orchestration, error) {
+	p.orchestrationStoreMu.RLock()
+	failed, exists := p.orchestrationStore[orchestrationID]
+	var retry *Orchestration
+	var err error
+	switch {
+	case !exists:
+		err = ErrOrchestrationNotFound
+	case failed.Status != Failed && failed.Status != TimedOut, failed.Plan == nil:
+		err = ErrOrchestrationNotRetryable
+	case failed.ParentID != "":
+		err = fmt.Errorf("%w: sub-orchestrations are retried with their parent", ErrOrchestrationNotRetryable)
+	default:
+		retry = &Orchestration{
+			ID:                     p.GenerateOrchestrationKey(),
+			ProjectID:              failed.ProjectID,
+			RetryOf:                failed.ID,
+			Action:                 failed.Action,
+			Params:                 failed.Params,
+			Plan:                   failed.Plan,
+			Status:                 Pending,
+			Timestamp:              time.Now().UTC(),
+			Priority:               failed.Priority,
+			Timeout:                failed.Timeout,
+			HealthCheckGracePeriod: failed.HealthCheckGracePeriod,
+			OrchestrationTimeout:   failed.OrchestrationTimeout,
+			TaskExecutionTimeout:   failed.TaskExecutionTimeout,
+			SLA:                    failed.SLA,
+			RetryPolicy:            failed.RetryPolicy,
+			Budget:                 failed.Budget,
+			Approvals:              failed.Approvals,
+			SubOrchestrations:      failed.SubOrchestrations,
+			FanOut:                 failed.FanOut,
+			Branches:               failed.Branches,
+			TaskGraph:              failed.TaskGraph,
+			Webhook:                failed.Webhook,
+			Callback:               failed.Callback,
+			StreamResults:          failed.StreamResults,
+			Labels:                 failed.Labels,
+			ServiceVersions:        failed.ServiceVersions,
+			PlannedVersions:        failed.PlannedVersions,
+			TaskZero:               failed.TaskZero,
+			GroundingHit:           failed.GroundingHit,
+		}
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.LogManager.GetLog(orchestrationID) == nil {
+		return nil, fmt.Errorf("%w: orchestration %s has no log to resume from", ErrOrchestrationNotRetryable, orchestrationID)
+	}
+
+	p.scheduleSLA(retry)
+	p.orchestrationStoreMu.Lock()
+	p.orchestrationStore[retry.ID] = retry
+	p.orchestrationStoreMu.Unlock()
+
+	if err := p.orchestrationStorage.StoreOrchestration(retry); err != nil {
+		return nil, fmt.Errorf("failed to persist orchestration: %w", err)
+	}
+
+	p.DispatchOrchestration(ctx, retry)
+	return retry, nil
+}
+
+// retriedTaskOutputs returns the outputs a retry reuses from the orchestration it retries, if any
+func (p *PlanEngine) retriedTaskOutputs(orchestration *Orchestration) map[string]LogEntry {
+	if orchestration.RetryOf == "" {
+		return nil
+	}
+	return p.LogManager.FinishedTaskOutputs(orchestration.RetryOf)
+}
+
+// seedRetriedTaskOutputs logs the reused outputs as the retry's own, so the tasks depending on them run straight away
+func (p *PlanEngine) seedRetriedTaskOutputs(orchestrationID string, outputs map[string]LogEntry) {
+	for taskID, entry := range outputs {
+		status := Completed
+		if entry.GetProducerID() == ConditionProducerID {
+			status = Skipped
+		}
+		if err := p.LogManager.MarkTask(orchestrationID, taskID, status, time.Now().UTC()); err != nil {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msgf("Cannot reuse output of task %s", taskID)
+			continue
+		}
+		p.LogManager.AppendToLog(orchestrationID, "task_output", taskID, entry.GetValue(), entry.GetProducerID(), entry.GetAttemptNum())
+	}
+}
+
+// RetryOrchestrationHandler re-runs one of the caller's failed orchestrations from its failure point
+func (app *App) RetryOrchestrationHandler(w http.ResponseWriter, r *http.Request) {
+	orchestrationID, ok := app.projectOrchestrationID(w, r)
+	if !ok {
+		return
+	}
+
+	retry, err := app.Engine.RetryOrchestration(app.RootCtx, orchestrationID)
+	switch {
+	case errors.Is(err, ErrOrchestrationNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), err))
+		return
+	case errors.Is(err, ErrOrchestrationNotRetryable):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Invalid, err))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+
+	app.writeAcceptedOrchestration(w, retry)
+}
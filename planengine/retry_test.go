@@ -0,0 +1,63 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	orchestration := setupRunningOrchestration(t, app, project.ID)
+	lm := app.Engine.LogManager
+	lm.AppendToLog(orchestration.ID, "task_output", "task1", json.RawMessage(`{"echo":"hi"}`), "s_echo", 0)
+	require.NoError(t, lm.MarkTaskCompleted(orchestration.ID, "task1", time.Now().UTC()))
+	require.NoError(t, lm.MarkTask(orchestration.ID, "task2", Failed, time.Now().UTC()))
+
+	retry := func(orchestrationID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations/"+orchestrationID+"/retry", nil)
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := retry(orchestration.ID)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "unfinished orchestrations cannot be retried")
+
+	app.Engine.orchestrationStoreMu.Lock()
+	orchestration.Status = Failed
+	app.Engine.orchestrationStoreMu.Unlock()
+
+	w = retry(orchestration.ID)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var accepted Orchestration
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&accepted))
+	assert.NotEqual(t, orchestration.ID, accepted.ID)
+	assert.Equal(t, orchestration.ID, accepted.RetryOf)
+	assert.Len(t, accepted.Plan.Tasks, len(orchestration.Plan.Tasks))
+
+	require.Eventually(t, func() bool { return lm.GetLog(accepted.ID) != nil }, 2*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, reused := lm.FinishedTaskOutputs(accepted.ID)["task1"]
+		return reused
+	}, 2*time.Second, 10*time.Millisecond)
+
+	reused := lm.FinishedTaskOutputs(accepted.ID)
+	assert.JSONEq(t, `{"echo":"hi"}`, string(reused["task1"].GetValue()))
+	assert.NotContains(t, reused, "task2", "failed tasks run again")
+}
@@ -0,0 +1,129 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	back "github.com/cenkalti/backoff/v4"
+)
+
+const (
+	defaultRetryInitialInterval = 2 * time.Second
+	defaultRetryBackoffFactor   = 2.0
+	maxRetryInterval            = 30 * time.Second
+	maxRetryAttempts            = 20
+)
+
+// RetryPolicy controls how often, and how quickly, a failed task is retried before its orchestration fails.
+// Services declare a policy when they register, an orchestration request may override it for all its tasks.
+type RetryPolicy struct {
+	MaxAttempts     int       `json:"maxAttempts,omitempty"`
+	InitialInterval *Duration `json:"initialInterval,omitempty"`
+	BackoffFactor   float64   `json:"backoffFactor,omitempty"`
+	// RetryableCodes limits retries to service failures reporting one of these codes, when empty all failures are retried
+	RetryableCodes []string `json:"retryableCodes,omitempty"`
+}
+
+// TaskError is a failure reported by a service for a task. Services may classify it with an error code, whether
+// it's worth retrying and structured details, unclassified failures are treated as retryable.
+type TaskError struct {
+	Code      string
+	Message   string
+	Retryable *bool
+	Details   json.RawMessage
+}
+
+func (e *TaskError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Validate ensures the policy's settings are within the limits the task workers support
+func (r *RetryPolicy) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxAttempts < 0 || r.MaxAttempts > maxRetryAttempts {
+		return fmt.Errorf("maxAttempts must be between 1 and %d", maxRetryAttempts)
+	}
+	if r.InitialInterval != nil && (r.InitialInterval.Duration <= 0 || r.InitialInterval.Duration > maxRetryInterval) {
+		return fmt.Errorf("initialInterval must be positive and at most %s", maxRetryInterval)
+	}
+	if r.BackoffFactor != 0 && r.BackoffFactor < 1 {
+		return errors.New("backoffFactor must be at least 1")
+	}
+	for _, code := range r.RetryableCodes {
+		if code == "" {
+			return errors.New("retryableCodes cannot contain empty codes")
+		}
+	}
+	return nil
+}
+
+// resolveRetryPolicy merges the orchestration's policy over the service's, unset settings fall back to the defaults
+func resolveRetryPolicy(orchestration, service *RetryPolicy) RetryPolicy {
+	resolved := RetryPolicy{
+		MaxAttempts:     maxRetries,
+		InitialInterval: &Duration{defaultRetryInitialInterval},
+		BackoffFactor:   defaultRetryBackoffFactor,
+	}
+
+	for _, policy := range []*RetryPolicy{service, orchestration} {
+		if policy == nil {
+			continue
+		}
+		if policy.MaxAttempts > 0 {
+			resolved.MaxAttempts = policy.MaxAttempts
+		}
+		if policy.InitialInterval != nil {
+			resolved.InitialInterval = policy.InitialInterval
+		}
+		if policy.BackoffFactor > 0 {
+			resolved.BackoffFactor = policy.BackoffFactor
+		}
+		if len(policy.RetryableCodes) > 0 {
+			resolved.RetryableCodes = policy.RetryableCodes
+		}
+	}
+
+	return resolved
+}
+
+// Retryable reports whether a failed attempt may be retried under the policy. A service's own classification
+// of its failure wins over the policy's retryable codes. Failures raised by the plan engine, e.g. undeliverable
+// tasks or unhealthy services, are always retryable.
+func (r RetryPolicy) Retryable(err error) bool {
+	var taskErr *TaskError
+	if !errors.As(err, &taskErr) {
+		return true
+	}
+	if taskErr.Retryable != nil {
+		return *taskErr.Retryable
+	}
+	return len(r.RetryableCodes) == 0 || slices.Contains(r.RetryableCodes, taskErr.Code)
+}
+
+func (r RetryPolicy) backOff() *back.ExponentialBackOff {
+	expBackoff := back.NewExponentialBackOff()
+
+	expBackoff.InitialInterval = r.InitialInterval.Duration
+	expBackoff.MaxInterval = maxRetryInterval // Cap maximum delay
+	expBackoff.Multiplier = r.BackoffFactor
+	expBackoff.RandomizationFactor = 0.1 // Add some jitter
+	expBackoff.MaxElapsedTime = 0        // Use consecutiveErrs, timeout, healthCheckGracePeriod for permanent backoff
+
+	// Reset timer to apply our changes
+	expBackoff.Reset()
+	return expBackoff
+}
@@ -0,0 +1,75 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRetryPolicy(t *testing.T) {
+	t.Run("defaults apply without policies", func(t *testing.T) {
+		policy := resolveRetryPolicy(nil, nil)
+		assert.Equal(t, maxRetries, policy.MaxAttempts)
+		assert.Equal(t, defaultRetryInitialInterval, policy.InitialInterval.Duration)
+		assert.Equal(t, defaultRetryBackoffFactor, policy.BackoffFactor)
+		assert.Empty(t, policy.RetryableCodes)
+	})
+
+	t.Run("orchestration policy overrides the service's", func(t *testing.T) {
+		service := &RetryPolicy{
+			MaxAttempts:     3,
+			InitialInterval: &Duration{500 * time.Millisecond},
+			RetryableCodes:  []string{"RATE_LIMITED"},
+		}
+		orchestration := &RetryPolicy{MaxAttempts: 8, BackoffFactor: 1.5}
+
+		policy := resolveRetryPolicy(orchestration, service)
+		assert.Equal(t, 8, policy.MaxAttempts)
+		assert.Equal(t, 500*time.Millisecond, policy.InitialInterval.Duration)
+		assert.Equal(t, 1.5, policy.BackoffFactor)
+		assert.Equal(t, []string{"RATE_LIMITED"}, policy.RetryableCodes)
+
+		backOff := policy.backOff()
+		assert.Equal(t, 500*time.Millisecond, backOff.InitialInterval)
+		assert.Equal(t, 1.5, backOff.Multiplier)
+	})
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	policy := resolveRetryPolicy(&RetryPolicy{RetryableCodes: []string{"RATE_LIMITED"}}, nil)
+
+	assert.True(t, policy.Retryable(RetryableError{Err: &TaskError{Code: "RATE_LIMITED", Message: "slow down"}}))
+	assert.False(t, policy.Retryable(RetryableError{Err: &TaskError{Code: "BAD_INPUT", Message: "missing id"}}))
+	assert.False(t, policy.Retryable(fmt.Errorf("wrapped: %w", &TaskError{Message: "no code"})))
+	assert.True(t, policy.Retryable(RetryableError{Err: errors.New("task execution timed out waiting for result")}),
+		"plan engine failures are always retried")
+
+	assert.True(t, resolveRetryPolicy(nil, nil).Retryable(&TaskError{Code: "BAD_INPUT"}),
+		"all failures are retried without retryable codes")
+
+	retryable, terminal := true, false
+	assert.True(t, policy.Retryable(&TaskError{Code: "BAD_INPUT", Retryable: &retryable}),
+		"services classifying a failure as retryable override the policy's codes")
+	assert.False(t, resolveRetryPolicy(nil, nil).Retryable(RetryableError{Err: &TaskError{Code: "RATE_LIMITED", Retryable: &terminal}}),
+		"services classifying a failure as terminal are never retried")
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	assert.NoError(t, (*RetryPolicy)(nil).Validate())
+	assert.NoError(t, (&RetryPolicy{MaxAttempts: 3, InitialInterval: &Duration{time.Second}, BackoffFactor: 2}).Validate())
+
+	assert.Error(t, (&RetryPolicy{MaxAttempts: -1}).Validate())
+	assert.Error(t, (&RetryPolicy{MaxAttempts: maxRetryAttempts + 1}).Validate())
+	assert.Error(t, (&RetryPolicy{InitialInterval: &Duration{time.Hour}}).Validate())
+	assert.Error(t, (&RetryPolicy{BackoffFactor: 0.5}).Validate())
+	assert.Error(t, (&RetryPolicy{RetryableCodes: []string{""}}).Validate())
+}
@@ -0,0 +1,94 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ServiceRouting decides which of a service's instances its tasks are dispatched to
+type ServiceRouting string
+
+const (
+	// RoundRobinRouting takes turns between a service's instances, it's the default
+	RoundRobinRouting ServiceRouting = "round-robin"
+	// StickyRouting sends all of an orchestration's tasks for a service to the same instance, for stateful agents
+	StickyRouting ServiceRouting = "sticky"
+)
+
+func (r ServiceRouting) Validate() error {
+	switch r {
+	case "", RoundRobinRouting, StickyRouting:
+		return nil
+	default:
+		return fmt.Errorf("routing must be %q or %q", RoundRobinRouting, StickyRouting)
+	}
+}
+
+// routingKey returns the routing hint for the service's tasks of an orchestration, if the service is sticky
+func (si *ServiceInfo) routingKey(orchestrationID string) string {
+	if si.Routing != StickyRouting {
+		return ""
+	}
+	return orchestrationID
+}
+
+// pinnedInstance returns the instance the service's tasks with the routing key are pinned to, if any
+func (wsm *WebSocketManager) pinnedInstance(serviceID, routingKey string) (string, bool) {
+	if routingKey == "" {
+		return "", false
+	}
+
+	wsm.connMu.RLock()
+	defer wsm.connMu.RUnlock()
+	instanceID, ok := wsm.affinities[routingKey][serviceID]
+	return instanceID, ok
+}
+
+// pinInstanceLocked returns the instance the service's tasks with the routing key are pinned to, pinning them to
+// the picked instance if they aren't yet or if their instance disconnected. Callers must hold connMu.
+func (wsm *WebSocketManager) pinInstanceLocked(instances *serviceInstances, serviceID, routingKey string, pick func() string) string {
+	pinned, ok := wsm.affinities[routingKey][serviceID]
+	if _, connected := instances.sessions[pinned]; ok && connected {
+		return pinned
+	}
+
+	instanceID := pick()
+	if wsm.affinities[routingKey] == nil {
+		wsm.affinities[routingKey] = make(map[string]string)
+	}
+	wsm.affinities[routingKey][serviceID] = instanceID
+	return instanceID
+}
+
+// releaseAffinities unpins the tasks with the routing key once they're no longer dispatched, e.g. when their
+// orchestration has finished
+func (wsm *WebSocketManager) releaseAffinities(routingKey string) {
+	wsm.connMu.Lock()
+	defer wsm.connMu.Unlock()
+	delete(wsm.affinities, routingKey)
+}
+
+// recordTaskRerouted records that a sticky task fell back to another instance of its service, as the instance
+// its orchestration's earlier tasks ran on has disconnected
+func (p *PlanEngine) recordTaskRerouted(task Task, fromInstance, toInstance string) {
+	p.Logger.Warn().
+		Str("OrchestrationID", task.OrchestrationID).
+		Str("TaskID", task.ID).
+		Str("ServiceID", task.ServiceID).
+		Str("FromInstance", fromInstance).
+		Str("ToInstance", toInstance).
+		Msg("Sticky task rerouted to another service instance")
+
+	if task.Type != "task_request" || p.LogManager == nil {
+		return
+	}
+	if err := p.LogManager.AppendTaskReroutedEvent(task.OrchestrationID, task.ID, task.ServiceID, fromInstance, toInstance, time.Now().UTC()); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", task.OrchestrationID).Msg("Failed to record rerouted task")
+	}
+}
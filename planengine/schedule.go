@@ -0,0 +1,500 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	short "github.com/lithammer/shortuuid/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ScheduleActive = "active"
+	SchedulePaused = "paused"
+)
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Schedule submits an orchestration built from its template each time its cron expression fires
+type Schedule struct {
+	ID            string                `json:"id"`
+	ProjectID     string                `json:"projectId"`
+	Cron          string                `json:"cron"`
+	Orchestration OrchestrationTemplate `json:"orchestration"`
+	Status        string                `json:"status"`
+	NextRunAt     *time.Time            `json:"nextRunAt,omitempty"`
+	LastRun       *ScheduleRun          `json:"lastRun,omitempty"`
+	CreatedAt     time.Time             `json:"createdAt"`
+	cron          *CronSchedule
+}
+
+// ScheduleRun records the orchestration a schedule last submitted
+type ScheduleRun struct {
+	At              time.Time `json:"at"`
+	OrchestrationID string    `json:"orchestrationId,omitempty"`
+	Status          Status    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// OrchestrationTemplate holds the orchestration request fields a schedule submits on every run
+type OrchestrationTemplate struct {
+	Action                 Action             `json:"action"`
+	Params                 ActionParams       `json:"data"`
+	Webhook                string             `json:"webhook"`
+	Priority               Priority           `json:"priority,omitempty"`
+	Timeout                *Duration          `json:"timeout,omitempty"`
+	HealthCheckGracePeriod *Duration          `json:"healthCheckGracePeriod,omitempty"`
+	OrchestrationTimeout   *Duration          `json:"orchestrationTimeout,omitempty"`
+	TaskExecutionTimeout   *Duration          `json:"taskExecutionTimeout,omitempty"`
+	SLA                    *Duration          `json:"sla,omitempty"`
+	RetryPolicy            *RetryPolicy       `json:"retryPolicy,omitempty"`
+	Budget                 *Budget            `json:"budget,omitempty"`
+	Approvals              []ApprovalGate     `json:"approvals,omitempty"`
+	SubOrchestrations      []SubOrchestration `json:"subOrchestrations,omitempty"`
+	FanOut                 []FanOutSpec       `json:"fanOut,omitempty"`
+	Branches               []Branch           `json:"branches,omitempty"`
+	TaskGraph              []PlannedTask      `json:"taskGraph,omitempty"`
+	StreamResults          bool               `json:"streamResults,omitempty"`
+	Labels                 map[string]string  `json:"labels,omitempty"`
+	ServiceVersions        map[string]string  `json:"serviceVersions,omitempty"`
+}
+
+func (t OrchestrationTemplate) Orchestration() *Orchestration {
+	return &Orchestration{
+		Action:                 t.Action,
+		Params:                 t.Params,
+		Webhook:                t.Webhook,
+		Priority:               t.Priority,
+		Timeout:                t.Timeout,
+		HealthCheckGracePeriod: t.HealthCheckGracePeriod,
+		OrchestrationTimeout:   t.OrchestrationTimeout,
+		TaskExecutionTimeout:   t.TaskExecutionTimeout,
+		SLA:                    t.SLA,
+		RetryPolicy:            t.RetryPolicy,
+		Budget:                 t.Budget,
+		Approvals:              t.Approvals,
+		SubOrchestrations:      t.SubOrchestrations,
+		FanOut:                 t.FanOut,
+		Branches:               t.Branches,
+		TaskGraph:              t.TaskGraph,
+		StreamResults:          t.StreamResults,
+		Labels:                 t.Labels,
+		ServiceVersions:        t.ServiceVersions,
+	}
+}
+
+// NewOrchestrationTemplate captures the request fields an orchestration was submitted with, so it can be resubmitted
+func NewOrchestrationTemplate(o *Orchestration) OrchestrationTemplate {
+	return OrchestrationTemplate{
+		Action:                 o.Action,
+		Params:                 o.Params,
+		Webhook:                o.Webhook,
+		Priority:               o.Priority,
+		Timeout:                o.Timeout,
+		HealthCheckGracePeriod: o.HealthCheckGracePeriod,
+		OrchestrationTimeout:   o.OrchestrationTimeout,
+		TaskExecutionTimeout:   o.TaskExecutionTimeout,
+		SLA:                    o.SLA,
+		RetryPolicy:            o.RetryPolicy,
+		Budget:                 o.Budget,
+		Approvals:              o.Approvals,
+		SubOrchestrations:      o.SubOrchestrations,
+		FanOut:                 o.FanOut,
+		Branches:               o.Branches,
+		TaskGraph:              o.TaskGraph,
+		StreamResults:          o.StreamResults,
+		Labels:                 o.Labels,
+		ServiceVersions:        o.ServiceVersions,
+	}
+}
+
+type ScheduleStorage interface {
+	StoreSchedule(schedule *Schedule) error
+	ListSchedules() ([]*Schedule, error)
+	DeleteSchedule(id string) error
+}
+
+// ScheduleRunner submits a schedule's orchestration, reporting what was submitted
+type ScheduleRunner func(ctx context.Context, schedule *Schedule) ScheduleRun
+
+// Scheduler fires orchestrations for every active schedule when they're due
+type Scheduler struct {
+	storage   ScheduleStorage
+	run       ScheduleRunner
+	schedules map[string]*Schedule
+	mu        sync.Mutex
+	now       func() time.Time
+	Logger    zerolog.Logger
+}
+
+func NewScheduler(storage ScheduleStorage, run ScheduleRunner, logger zerolog.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		storage:   storage,
+		run:       run,
+		schedules: make(map[string]*Schedule),
+		now:       time.Now,
+		Logger:    logger,
+	}
+
+	schedules, err := storage.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		if schedule.cron, err = ParseCron(schedule.Cron); err != nil {
+			logger.Error().Err(err).Str("ScheduleID", schedule.ID).Msg("Skipping schedule with invalid cron expression")
+			continue
+		}
+		s.schedules[schedule.ID] = schedule
+	}
+
+	return s, nil
+}
+
+// Add starts firing a new schedule for the project
+func (s *Scheduler) Add(projectID, expr string, template OrchestrationTemplate) (*Schedule, error) {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	schedule := &Schedule{
+		ID:            "sch_" + short.New(),
+		ProjectID:     projectID,
+		Cron:          expr,
+		Orchestration: template,
+		Status:        ScheduleActive,
+		CreatedAt:     now,
+		cron:          cron,
+	}
+	schedule.NextRunAt = nextRunAt(cron, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.storage.StoreSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("failed to store schedule: %w", err)
+	}
+	s.schedules[schedule.ID] = schedule
+	return schedule.snapshot(), nil
+}
+
+// List returns the project's schedules, oldest first
+func (s *Scheduler) List(projectID string) []*Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*Schedule, 0)
+	for _, schedule := range s.schedules {
+		if schedule.ProjectID == projectID {
+			result = append(result, schedule.snapshot())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// SetPaused stops or restarts firing one of the project's schedules
+func (s *Scheduler) SetPaused(projectID, id string, paused bool) (*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, exists := s.schedules[id]
+	if !exists || schedule.ProjectID != projectID {
+		return nil, ErrScheduleNotFound
+	}
+
+	status, next := ScheduleActive, nextRunAt(schedule.cron, s.now().UTC())
+	if paused {
+		status, next = SchedulePaused, nil
+	}
+
+	updated := schedule.snapshot()
+	updated.Status, updated.NextRunAt = status, next
+	if err := s.storage.StoreSchedule(updated); err != nil {
+		return nil, fmt.Errorf("failed to store schedule: %w", err)
+	}
+	s.schedules[id] = updated
+	return updated.snapshot(), nil
+}
+
+// Remove deletes one of the project's schedules
+func (s *Scheduler) Remove(projectID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, exists := s.schedules[id]
+	if !exists || schedule.ProjectID != projectID {
+		return ErrScheduleNotFound
+	}
+	if err := s.storage.DeleteSchedule(id); err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	delete(s.schedules, id)
+	return nil
+}
+
+// RemoveProject deletes all the project's schedules
+func (s *Scheduler) RemoveProject(projectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, schedule := range s.schedules {
+		if schedule.ProjectID != projectID {
+			continue
+		}
+		if err := s.storage.DeleteSchedule(id); err != nil {
+			return fmt.Errorf("failed to delete schedule: %w", err)
+		}
+		delete(s.schedules, id)
+	}
+	return nil
+}
+
+// Run fires due schedules every interval until the context is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.fireDue(ctx)
+		}
+	}
+}
+
+// fireDue runs every active schedule whose next run has passed. Runs missed while the plan engine
+// was down are fired once, rather than once per missed slot.
+func (s *Scheduler) fireDue(ctx context.Context) {
+	now := s.now().UTC()
+
+	s.mu.Lock()
+	var due []*Schedule
+	for _, schedule := range s.schedules {
+		if schedule.Status != ScheduleActive || schedule.NextRunAt == nil || schedule.NextRunAt.After(now) {
+			continue
+		}
+		schedule.NextRunAt = nextRunAt(schedule.cron, now)
+		due = append(due, schedule.snapshot())
+	}
+	s.mu.Unlock()
+
+	for _, schedule := range due {
+		go s.fire(ctx, schedule)
+	}
+}
+
+func (s *Scheduler) fire(ctx context.Context, schedule *Schedule) {
+	run := s.run(ctx, schedule)
+	if run.Error != "" {
+		s.Logger.Error().Str("ScheduleID", schedule.ID).Str("ProjectID", schedule.ProjectID).Str("Error", run.Error).Msg("Scheduled orchestration failed to start")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.schedules[schedule.ID]
+	if !exists {
+		return
+	}
+	current.LastRun = &run
+	if err := s.storage.StoreSchedule(current); err != nil {
+		s.Logger.Error().Err(err).Str("ScheduleID", schedule.ID).Msg("Failed to store schedule's last run")
+	}
+}
+
+func (s *Schedule) snapshot() *Schedule {
+	clone := *s
+	return &clone
+}
+
+func nextRunAt(cron *CronSchedule, after time.Time) *time.Time {
+	next := cron.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// runSchedule submits a schedule's orchestration as if its project had requested it
+func (app *App) runSchedule(ctx context.Context, schedule *Schedule) ScheduleRun {
+	orchestration := schedule.Orchestration.Orchestration()
+	run := ScheduleRun{At: time.Now().UTC()}
+
+	err := app.Engine.PrepareOrchestration(ctx, schedule.ProjectID, orchestration, app.Engine.GetGroundingSpecs(schedule.ProjectID))
+	run.OrchestrationID = orchestration.ID
+	run.Status = orchestration.Status
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+
+	app.Engine.DispatchOrchestration(ctx, orchestration)
+	return run
+}
+
+// scheduleView reports a schedule with its last run's current orchestration status
+func (app *App) scheduleView(schedule *Schedule) *Schedule {
+	if schedule.LastRun == nil || schedule.LastRun.OrchestrationID == "" {
+		return schedule
+	}
+	app.Engine.orchestrationStoreMu.RLock()
+	defer app.Engine.orchestrationStoreMu.RUnlock()
+
+	if orchestration, exists := app.Engine.orchestrationStore[schedule.LastRun.OrchestrationID]; exists {
+		lastRun := *schedule.LastRun
+		lastRun.Status = orchestration.Status
+		schedule.LastRun = &lastRun
+	}
+	return schedule
+}
+
+// scheduleRequest runs an orchestration, defined in full or from a template, on a cron schedule
+type scheduleRequest struct {
+	Cron          string          `json:"cron"`
+	Orchestration json.RawMessage `json:"orchestration"`
+}
+
+func (app *App) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	var request scheduleRequest
+	if err := decodeRequest(w, r, &request, scheduleFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if strings.TrimSpace(request.Cron) == "" {
+		httpErrorResponse(w, app.requestLogger(r), missingField("cron"))
+		return
+	}
+	if len(request.Orchestration) == 0 {
+		httpErrorResponse(w, app.requestLogger(r), missingField("orchestration"))
+		return
+	}
+	if _, err := ParseCron(request.Cron); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("cron"), err))
+		return
+	}
+
+	var template OrchestrationTemplate
+	if err := decodeObject(request.Orchestration, &template, scheduleTemplateFields, "orchestration"); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if err := validateOrchestrationRequest(template.Orchestration()); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if err := app.Engine.validateWebhook(project.ID, template.Webhook); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("orchestration.webhook"), err))
+		return
+	}
+
+	schedule, err := app.Scheduler.Add(project.ID, request.Cron, template)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ScheduleUpdateFailedErrCode), err))
+		return
+	}
+
+	writeSchedule(w, app, http.StatusCreated, schedule)
+}
+
+func (app *App) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	schedules := app.Scheduler.List(project.ID)
+	for i, schedule := range schedules {
+		schedules[i] = app.scheduleView(schedule)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(schedules); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+func (app *App) PauseSchedule(w http.ResponseWriter, r *http.Request) {
+	app.setSchedulePaused(w, r, true)
+}
+
+func (app *App) ResumeSchedule(w http.ResponseWriter, r *http.Request) {
+	app.setSchedulePaused(w, r, false)
+}
+
+func (app *App) setSchedulePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	schedule, err := app.Scheduler.SetPaused(project.ID, mux.Vars(r)["id"], paused)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), scheduleError(err))
+		return
+	}
+
+	writeSchedule(w, app, http.StatusOK, schedule)
+}
+
+func (app *App) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	if err := app.Scheduler.Remove(project.ID, mux.Vars(r)["id"]); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), scheduleError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func scheduleError(err error) error {
+	if errors.Is(err, ErrScheduleNotFound) {
+		return errs.E(errs.NotExist, errs.Code(UnknownScheduleErrCode), err)
+	}
+	return errs.E(errs.Unanticipated, errs.Code(ScheduleUpdateFailedErrCode), err)
+}
+
+func writeSchedule(w http.ResponseWriter, app *App, status int, schedule *Schedule) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(app.scheduleView(schedule)); err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedules(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	project.Webhooks = []string{"http://localhost/hook"}
+
+	runs := make(chan *Schedule, 4)
+	runner := func(_ context.Context, schedule *Schedule) ScheduleRun {
+		runs <- schedule
+		return ScheduleRun{At: time.Now().UTC(), OrchestrationID: "o_scheduled", Status: Pending}
+	}
+	scheduler, err := NewScheduler(app.Db, runner, app.Logger)
+	require.NoError(t, err)
+	app.Scheduler = scheduler
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	list := func(t *testing.T) []Schedule {
+		w := send(http.MethodGet, "/schedules", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var schedules []Schedule
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&schedules))
+		return schedules
+	}
+
+	w := send(http.MethodPost, "/schedules", `{"cron":"*/5 * * * *","orchestration":{"action":{"content":"echo"},"webhook":"http://localhost/hook","data":[{"field":"message","value":"hi"}]}}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created Schedule
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, ScheduleActive, created.Status)
+	assert.Equal(t, "echo", created.Orchestration.Action.Content)
+	require.NotNil(t, created.NextRunAt)
+	assert.Zero(t, created.NextRunAt.Minute()%5)
+
+	t.Run("invalid schedules are rejected", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			body      string
+			wantParam string
+		}{
+			{"invalid cron", `{"cron":"every day","orchestration":{"action":{"content":"echo"},"webhook":"http://localhost/hook"}}`, "cron"},
+			{"missing orchestration", `{"cron":"@daily"}`, "orchestration"},
+			{"unknown orchestration field", `{"cron":"@daily","orchestration":{"action":{"content":"echo"},"webhook":"http://localhost/hook","plan":{}}}`, "orchestration.plan"},
+			{"unregistered webhook", `{"cron":"@daily","orchestration":{"action":{"content":"echo"},"webhook":"http://localhost/other"}}`, "orchestration.webhook"},
+		}
+		for _, tt := range tests {
+			w := send(http.MethodPost, "/schedules", tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, tt.name)
+
+			var response errs.ErrResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, tt.wantParam, response.Error.Param, tt.name)
+		}
+	})
+
+	t.Run("due schedules fire and record their last run", func(t *testing.T) {
+		scheduler.now = func() time.Time { return created.NextRunAt.Add(time.Second) }
+		scheduler.fireDue(context.Background())
+
+		select {
+		case schedule := <-runs:
+			assert.Equal(t, created.ID, schedule.ID)
+		case <-time.After(2 * time.Second):
+			t.Fatal("due schedule did not fire")
+		}
+
+		require.Eventually(t, func() bool {
+			schedules := list(t)
+			return len(schedules) == 1 && schedules[0].LastRun != nil
+		}, 2*time.Second, 10*time.Millisecond)
+
+		schedule := list(t)[0]
+		assert.Equal(t, "o_scheduled", schedule.LastRun.OrchestrationID)
+		assert.Equal(t, Pending, schedule.LastRun.Status)
+		assert.True(t, schedule.NextRunAt.After(*created.NextRunAt))
+	})
+
+	t.Run("paused schedules don't fire", func(t *testing.T) {
+		w := send(http.MethodPost, "/schedules/"+created.ID+"/pause", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, SchedulePaused, list(t)[0].Status)
+
+		scheduler.now = func() time.Time { return created.NextRunAt.Add(24 * time.Hour) }
+		scheduler.fireDue(context.Background())
+		select {
+		case <-runs:
+			t.Fatal("paused schedule fired")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		w = send(http.MethodPost, "/schedules/"+created.ID+"/resume", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, ScheduleActive, list(t)[0].Status)
+	})
+
+	t.Run("schedules survive restarts", func(t *testing.T) {
+		restarted, err := NewScheduler(app.Db, runner, app.Logger)
+		require.NoError(t, err)
+
+		schedules := restarted.List(project.ID)
+		require.Len(t, schedules, 1)
+		assert.Equal(t, "hi", schedules[0].Orchestration.Params[0].Value)
+		assert.NotNil(t, schedules[0].LastRun)
+	})
+
+	t.Run("schedules can be deleted", func(t *testing.T) {
+		w := send(http.MethodDelete, "/schedules/"+created.ID, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, list(t))
+
+		w = send(http.MethodDelete, "/schedules/"+created.ID, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
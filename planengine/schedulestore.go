@@ -0,0 +1,62 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const scheduleKeyPrefix = "schedule:"
+
+// StoreSchedule persists a schedule, its orchestration template is encrypted like orchestration payloads
+func (b *BadgerDB) StoreSchedule(schedule *Schedule) error {
+	data, err := b.encodePayload(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(scheduleKeyPrefix+schedule.ID), data)
+	})
+}
+
+func (b *BadgerDB) ListSchedules() ([]*Schedule, error) {
+	var schedules []*Schedule
+	prefix := []byte(scheduleKeyPrefix)
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var schedule Schedule
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &schedule)
+			}); err != nil {
+				return fmt.Errorf("failed to load schedule %s: %w", it.Item().Key(), err)
+			}
+			schedules = append(schedules, &schedule)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (b *BadgerDB) DeleteSchedule(id string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(scheduleKeyPrefix + id))
+	})
+}
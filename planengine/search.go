@@ -0,0 +1,283 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+	// maxSearchTermLength skips indexing long runs, e.g. encoded blobs in results, nobody searches for them
+	maxSearchTermLength = 64
+)
+
+// searchFields are what orchestrations are searched by. Matches in an orchestration's action rank above matches
+// in its labels, which rank above matches in its error or results.
+var searchFields = []struct {
+	name   string
+	weight float64
+	text   func(o *Orchestration) string
+}{
+	{"action", 3, func(o *Orchestration) string { return o.Action.Content }},
+	{"labels", 2, func(o *Orchestration) string {
+		var text strings.Builder
+		for key, value := range o.Labels {
+			text.WriteString(key + " " + value + " ")
+		}
+		return text.String()
+	}},
+	{"error", 1, func(o *Orchestration) string { return string(o.Error) }},
+	{"results", 1, func(o *Orchestration) string {
+		var text strings.Builder
+		for _, result := range o.Results {
+			text.Write(result)
+			text.WriteByte(' ')
+		}
+		return text.String()
+	}},
+}
+
+// OrchestrationSearchHit is an orchestration matching a search, with how well it matched
+type OrchestrationSearchHit struct {
+	OrchestrationView
+	Score float64 `json:"score"`
+	// Matched lists the fields the search terms were found in
+	Matched []string `json:"matched"`
+}
+
+// OrchestrationSearchResponse holds the best matching orchestrations first
+type OrchestrationSearchResponse struct {
+	Query string                   `json:"query"`
+	Hits  []OrchestrationSearchHit `json:"hits"`
+	// Total counts every matching orchestration, including those past the limit
+	Total int `json:"total"`
+}
+
+// searchIndex is an inverted index over the orchestrations. Each one is reindexed whenever it's stored, and dropped
+// when it's deleted, so searches never scan the orchestration store.
+type searchIndex struct {
+	mu sync.Mutex
+	// postings maps a term to the orchestrations holding it, and the fields it's in
+	postings map[string]map[string][]string
+	docs     map[string]searchDocument
+}
+
+type searchDocument struct {
+	projectID string
+	terms     []string
+}
+
+// searchTerms splits text into lowercase words and numbers
+func searchTerms(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var kept []string
+	for _, term := range terms {
+		if len(term) <= maxSearchTermLength {
+			kept = append(kept, term)
+		}
+	}
+	return kept
+}
+
+// index replaces what's indexed about an orchestration with its current content
+func (s *searchIndex) index(o *Orchestration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs == nil {
+		s.docs = make(map[string]searchDocument)
+		s.postings = make(map[string]map[string][]string)
+	}
+	s.remove(o.ID)
+	s.add(o)
+}
+
+// drop removes an orchestration from the index
+func (s *searchIndex) drop(orchestrationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(orchestrationID)
+}
+
+func (s *searchIndex) add(o *Orchestration) {
+	fieldsByTerm := make(map[string][]string)
+	for _, field := range searchFields {
+		for _, term := range searchTerms(field.text(o)) {
+			fields := fieldsByTerm[term]
+			if len(fields) == 0 || fields[len(fields)-1] != field.name {
+				fieldsByTerm[term] = append(fields, field.name)
+			}
+		}
+	}
+
+	doc := searchDocument{projectID: o.ProjectID, terms: make([]string, 0, len(fieldsByTerm))}
+	for term, fields := range fieldsByTerm {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[string][]string)
+		}
+		s.postings[term][o.ID] = fields
+		doc.terms = append(doc.terms, term)
+	}
+	s.docs[o.ID] = doc
+}
+
+func (s *searchIndex) remove(orchestrationID string) {
+	for _, term := range s.docs[orchestrationID].terms {
+		delete(s.postings[term], orchestrationID)
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+		}
+	}
+	delete(s.docs, orchestrationID)
+}
+
+// SearchOrchestrations finds a project's orchestrations holding every term of the query, best matches first.
+// Ties go to the most recent orchestration.
+func (p *PlanEngine) SearchOrchestrations(projectID, query string, limit int) OrchestrationSearchResponse {
+	response := OrchestrationSearchResponse{Query: query, Hits: make([]OrchestrationSearchHit, 0)}
+	terms := searchTerms(query)
+	slices.Sort(terms)
+	terms = slices.Compact(terms)
+	if len(terms) == 0 {
+		return response
+	}
+
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	p.search.mu.Lock()
+	// Only orchestrations holding the rarest term can hold them all
+	candidates := p.search.postings[terms[0]]
+	for _, term := range terms[1:] {
+		if len(p.search.postings[term]) < len(candidates) {
+			candidates = p.search.postings[term]
+		}
+	}
+	var hits []OrchestrationSearchHit
+	for id := range candidates {
+		// Orchestrations are only searched while they're held in memory
+		if _, ok := p.orchestrationStore[id]; !ok || p.search.docs[id].projectID != projectID {
+			continue
+		}
+		hit, ok := p.search.match(id, terms)
+		if !ok {
+			continue
+		}
+		hit.OrchestrationView = OrchestrationView{ID: id}
+		hits = append(hits, hit)
+	}
+	p.search.mu.Unlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return p.orchestrationStore[hits[i].ID].Timestamp.After(p.orchestrationStore[hits[j].ID].Timestamp)
+	})
+
+	response.Total = len(hits)
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for _, hit := range hits {
+		hit.OrchestrationView = p.orchestrationListEntry(p.orchestrationStore[hit.ID])
+		response.Hits = append(response.Hits, hit)
+	}
+	return response
+}
+
+// searchIndexedStorage keeps the search index up to date with every orchestration stored or deleted
+type searchIndexedStorage struct {
+	OrchestrationStorage
+	search *searchIndex
+}
+
+func (s searchIndexedStorage) StoreOrchestration(orchestration *Orchestration) error {
+	if err := s.OrchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		return err
+	}
+	s.search.index(orchestration)
+	return nil
+}
+
+func (s searchIndexedStorage) DeleteOrchestration(orchestration *Orchestration) error {
+	if err := s.OrchestrationStorage.DeleteOrchestration(orchestration); err != nil {
+		return err
+	}
+	s.search.drop(orchestration.ID)
+	return nil
+}
+
+// match scores an indexed orchestration against the search terms, it has to hold them all
+func (s *searchIndex) match(orchestrationID string, terms []string) (OrchestrationSearchHit, bool) {
+	var hit OrchestrationSearchHit
+	matched := make(map[string]bool)
+	for _, term := range terms {
+		fields, ok := s.postings[term][orchestrationID]
+		if !ok {
+			return OrchestrationSearchHit{}, false
+		}
+		for _, name := range fields {
+			matched[name] = true
+		}
+	}
+	for _, field := range searchFields {
+		if !matched[field.name] {
+			continue
+		}
+		hit.Matched = append(hit.Matched, field.name)
+		for _, term := range terms {
+			if slices.Contains(s.postings[term][orchestrationID], field.name) {
+				hit.Score += field.weight
+			}
+		}
+	}
+	return hit, true
+}
+
+// SearchOrchestrationsHandler finds the caller's orchestrations by words in their action, labels, error or
+// results, e.g. ?q=refund 4821
+func (app *App) SearchOrchestrationsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(searchTerms(query)) == 0 {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("q"), "a search query with at least one word or number is required"))
+		return
+	}
+	limit := DefaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxSearchLimit {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("limit"), fmt.Sprintf("invalid limit %q, expected a number from 1 to %d", value, MaxSearchLimit)))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.Engine.SearchOrchestrations(project.ID, query, limit)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"refund", "order", "4821", "for", "jane"}, searchTerms(`Refund order #4821 for "Jane"!`))
+	assert.Empty(t, searchTerms(" ,.- "))
+}
+
+func TestSearchOrchestrations(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	now := time.Now().UTC()
+	for _, o := range []*Orchestration{
+		{ID: "o_refund", Status: Completed, Action: Action{Content: "Refund order 4821 for the customer"}, Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "o_refund_later", Status: Processing, Action: Action{Content: "Process a refund"}, Labels: map[string]string{"order": "4821"}, Timestamp: now.Add(-time.Hour)},
+		{ID: "o_shipping", Status: Failed, Action: Action{Content: "Ship order 99"}, Error: json.RawMessage(`"carrier rejected the refund address"`), Timestamp: now},
+		{ID: "o_other_project", ProjectID: "another-project", Status: Completed, Action: Action{Content: "Refund order 4821"}},
+	} {
+		if o.ProjectID == "" {
+			o.ProjectID = project.ID
+		}
+		app.Engine.orchestrationStore[o.ID] = o
+		require.NoError(t, app.Engine.orchestrationStorage.StoreOrchestration(o))
+	}
+
+	search := func(rawQuery string) (int, OrchestrationSearchResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/search?"+rawQuery, nil)
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+
+		var response OrchestrationSearchResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		}
+		return w.Code, response
+	}
+	ids := func(response OrchestrationSearchResponse) []string {
+		var out []string
+		for _, hit := range response.Hits {
+			out = append(out, hit.ID)
+		}
+		return out
+	}
+
+	t.Run("finds orchestrations holding every term, best matches first", func(t *testing.T) {
+		code, response := search("q=" + url.QueryEscape("REFUND 4821"))
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"o_refund", "o_refund_later"}, ids(response))
+		assert.Equal(t, 2, response.Total)
+		assert.Equal(t, []string{"action"}, response.Hits[0].Matched)
+		assert.Equal(t, []string{"action", "labels"}, response.Hits[1].Matched)
+		assert.Greater(t, response.Hits[0].Score, response.Hits[1].Score)
+		assert.Equal(t, Completed, response.Hits[0].Status)
+	})
+
+	t.Run("searches errors and results", func(t *testing.T) {
+		_, response := search("q=carrier")
+		assert.Equal(t, []string{"o_shipping"}, ids(response))
+		assert.Equal(t, []string{"error"}, response.Hits[0].Matched)
+
+		app.Engine.orchestrationStoreMu.Lock()
+		orchestration := app.Engine.orchestrationStore["o_refund_later"]
+		orchestration.Results = []json.RawMessage{json.RawMessage(`{"refundId":"rf_77"}`)}
+		orchestration.Status = Completed
+		app.Engine.orchestrationStoreMu.Unlock()
+		require.NoError(t, app.Engine.orchestrationStorage.StoreOrchestration(orchestration))
+
+		_, response = search("q=rf_77")
+		assert.Equal(t, []string{"o_refund_later"}, ids(response))
+		assert.Equal(t, []string{"results"}, response.Hits[0].Matched)
+	})
+
+	t.Run("reindexes any change", func(t *testing.T) {
+		app.Engine.orchestrationStoreMu.Lock()
+		orchestration := app.Engine.orchestrationStore["o_refund_later"]
+		orchestration.Labels = map[string]string{"order": "5150"}
+		app.Engine.orchestrationStoreMu.Unlock()
+		require.NoError(t, app.Engine.orchestrationStorage.StoreOrchestration(orchestration))
+
+		_, response := search("q=5150")
+		assert.Equal(t, []string{"o_refund_later"}, ids(response))
+		_, response = search("q=" + url.QueryEscape("refund 4821"))
+		assert.Equal(t, []string{"o_refund"}, ids(response))
+	})
+
+	t.Run("limits hits and counts them all", func(t *testing.T) {
+		_, response := search("q=refund&limit=1")
+		assert.Len(t, response.Hits, 1)
+		assert.Equal(t, 3, response.Total)
+	})
+
+	t.Run("drops orchestrations that are gone", func(t *testing.T) {
+		app.Engine.orchestrationStoreMu.Lock()
+		orchestration := app.Engine.orchestrationStore["o_shipping"]
+		delete(app.Engine.orchestrationStore, "o_shipping")
+		app.Engine.orchestrationStoreMu.Unlock()
+		require.NoError(t, app.Engine.orchestrationStorage.DeleteOrchestration(orchestration))
+
+		_, response := search("q=carrier")
+		assert.Empty(t, response.Hits)
+	})
+
+	t.Run("rejects empty queries and bad limits", func(t *testing.T) {
+		code, _ := search("q=" + url.QueryEscape(" - "))
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = search("q=refund&limit=1000")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
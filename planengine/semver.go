@@ -0,0 +1,241 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a semantic version, MAJOR.MINOR.PATCH with an optional pre-release. Build metadata is ignored.
+type SemVer struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// ParseSemVer parses a full semantic version, e.g. 2.1.0 or v2.1.0-rc.1
+func ParseSemVer(value string) (SemVer, error) {
+	version, parts, err := parsePartialSemVer(value)
+	if err != nil {
+		return SemVer{}, err
+	}
+	if parts != 3 {
+		return SemVer{}, fmt.Errorf("invalid semantic version %q, expected MAJOR.MINOR.PATCH", value)
+	}
+	return version, nil
+}
+
+// parsePartialSemVer parses versions that may leave out their minor and patch numbers, as constraints do, and
+// reports how many numbers were given
+func parsePartialSemVer(value string) (SemVer, int, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	trimmed, _, _ = strings.Cut(trimmed, "+")
+	core, pre, hasPre := strings.Cut(trimmed, "-")
+	if hasPre && pre == "" {
+		return SemVer{}, 0, fmt.Errorf("invalid semantic version %q, the pre-release is empty", value)
+	}
+
+	numbers := strings.Split(core, ".")
+	if core == "" || len(numbers) > 3 {
+		return SemVer{}, 0, fmt.Errorf("invalid semantic version %q, expected MAJOR.MINOR.PATCH", value)
+	}
+	if hasPre && len(numbers) != 3 {
+		return SemVer{}, 0, fmt.Errorf("invalid semantic version %q, pre-releases need MAJOR.MINOR.PATCH", value)
+	}
+
+	parsed := make([]int, 3)
+	for i, number := range numbers {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 0 || (len(number) > 1 && number[0] == '0') {
+			return SemVer{}, 0, fmt.Errorf("invalid semantic version %q, %q is not a version number", value, number)
+		}
+		parsed[i] = n
+	}
+	return SemVer{Major: parsed[0], Minor: parsed[1], Patch: parsed[2], Pre: pre}, len(numbers), nil
+}
+
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare orders versions by precedence, pre-releases come before their release
+func (v SemVer) Compare(other SemVer) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff != 0 {
+			return sign(diff)
+		}
+	}
+	switch {
+	case v.Pre == other.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case other.Pre == "":
+		return -1
+	}
+	return comparePreReleases(v.Pre, other.Pre)
+}
+
+// comparePreReleases orders pre-releases identifier by identifier, numeric identifiers numerically and before
+// alphanumeric ones
+func comparePreReleases(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// VersionConstraint is a set of version bounds a version must all be within, e.g. ">=2.1 <3". Bounds are
+// separated by commas or spaces and may be:
+//   - an exact or partial version, 2.1.3 or 2.1 (any 2.1.x), optionally prefixed with '='
+//   - a comparison, >2.1, >=2.1, <3 or <=2.4
+//   - a tilde range, ~2.1 (>=2.1.0 <2.2.0)
+//   - a caret range, ^2.1 (>=2.1.0 <3.0.0)
+type VersionConstraint struct {
+	bounds []versionBound
+}
+
+type versionBound struct {
+	op      string
+	version SemVer
+}
+
+// ParseVersionConstraint parses a version constraint, see VersionConstraint
+func ParseVersionConstraint(value string) (VersionConstraint, error) {
+	terms := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(terms) == 0 {
+		return VersionConstraint{}, fmt.Errorf("version constraint is empty")
+	}
+
+	var constraint VersionConstraint
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+		// Operators may be separated from their version, e.g. ">= 2.1"
+		if strings.TrimLeft(term, "<>=~^") == "" && i+1 < len(terms) {
+			i++
+			term += terms[i]
+		}
+		bounds, err := parseVersionBounds(term)
+		if err != nil {
+			return VersionConstraint{}, err
+		}
+		constraint.bounds = append(constraint.bounds, bounds...)
+	}
+	return constraint, nil
+}
+
+func parseVersionBounds(term string) ([]versionBound, error) {
+	var op string
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+		if rest, ok := strings.CutPrefix(term, prefix); ok {
+			op, term = prefix, rest
+			break
+		}
+	}
+	version, parts, err := parsePartialSemVer(term)
+	if err != nil {
+		return nil, err
+	}
+
+	// next is the first version past the given one's unspecified numbers, e.g. 2.2.0 for 2.1
+	next := func(parts int) SemVer {
+		switch parts {
+		case 1:
+			return SemVer{Major: version.Major + 1}
+		case 2:
+			return SemVer{Major: version.Major, Minor: version.Minor + 1}
+		}
+		return SemVer{Major: version.Major, Minor: version.Minor, Patch: version.Patch + 1}
+	}
+	release := SemVer{Major: version.Major, Minor: version.Minor, Patch: version.Patch}
+
+	switch op {
+	case ">=":
+		return []versionBound{{">=", version}}, nil
+	case "<":
+		return []versionBound{{"<", version}}, nil
+	case ">":
+		if parts == 3 {
+			return []versionBound{{">", version}}, nil
+		}
+		return []versionBound{{">=", next(parts)}}, nil
+	case "<=":
+		if parts == 3 {
+			return []versionBound{{"<=", version}}, nil
+		}
+		return []versionBound{{"<", next(parts)}}, nil
+	case "~":
+		return []versionBound{{">=", version}, {"<", next(min(parts, 2))}}, nil
+	case "^":
+		switch {
+		case version.Major > 0 || parts == 1:
+			return []versionBound{{">=", version}, {"<", next(1)}}, nil
+		case version.Minor > 0 || parts == 2:
+			return []versionBound{{">=", version}, {"<", next(2)}}, nil
+		}
+		return []versionBound{{">=", version}, {"<", next(3)}}, nil
+	}
+	if parts == 3 {
+		return []versionBound{{"=", version}}, nil
+	}
+	return []versionBound{{">=", release}, {"<", next(parts)}}, nil
+}
+
+// Allows reports whether the version is within every bound of the constraint
+func (c VersionConstraint) Allows(version SemVer) bool {
+	for _, bound := range c.bounds {
+		order := version.Compare(bound.version)
+		var ok bool
+		switch bound.op {
+		case "=":
+			ok = order == 0
+		case ">":
+			ok = order > 0
+		case ">=":
+			ok = order >= 0
+		case "<":
+			ok = order < 0
+		case "<=":
+			ok = order <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
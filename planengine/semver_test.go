@@ -0,0 +1,80 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSemVer(t *testing.T) {
+	version, err := ParseSemVer("v2.1.3-rc.1+build.7")
+	require.NoError(t, err)
+	assert.Equal(t, SemVer{Major: 2, Minor: 1, Patch: 3, Pre: "rc.1"}, version)
+	assert.Equal(t, "2.1.3-rc.1", version.String())
+
+	for _, invalid := range []string{"", "2.1", "2.1.3.4", "2.x.3", "02.1.3", "2.1.3-", "-1.0.0"} {
+		_, err := ParseSemVer(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.0.1", "1.2.0", "2.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		lower, err := ParseSemVer(ordered[i-1])
+		require.NoError(t, err)
+		higher, err := ParseSemVer(ordered[i])
+		require.NoError(t, err)
+		assert.Equal(t, -1, lower.Compare(higher), "%s < %s", lower, higher)
+		assert.Equal(t, 1, higher.Compare(lower), "%s > %s", higher, lower)
+		assert.Equal(t, 0, higher.Compare(higher))
+	}
+}
+
+func TestVersionConstraintAllows(t *testing.T) {
+	tests := []struct {
+		constraint string
+		allowed    []string
+		denied     []string
+	}{
+		{">=2.1", []string{"2.1.0", "2.5.3", "3.0.0"}, []string{"2.0.9"}},
+		{">=2.1, <3", []string{"2.1.0", "2.9.9"}, []string{"3.0.0", "2.0.0"}},
+		{">= 2.1 < 3", []string{"2.4.0"}, []string{"3.1.0"}},
+		{"2.1", []string{"2.1.0", "2.1.9"}, []string{"2.2.0", "2.0.9"}},
+		{"=2.1.3", []string{"2.1.3"}, []string{"2.1.4"}},
+		{">2.1", []string{"2.2.0"}, []string{"2.1.9"}},
+		{"<=2.1", []string{"2.1.9"}, []string{"2.2.0"}},
+		{"~2.1.3", []string{"2.1.3", "2.1.8"}, []string{"2.2.0", "2.1.2"}},
+		{"^2.1", []string{"2.1.0", "2.9.0"}, []string{"3.0.0", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+	}
+	for _, tt := range tests {
+		constraint, err := ParseVersionConstraint(tt.constraint)
+		require.NoError(t, err, tt.constraint)
+		for _, version := range tt.allowed {
+			assert.True(t, constraint.Allows(mustSemVer(t, version)), "%s allows %s", tt.constraint, version)
+		}
+		for _, version := range tt.denied {
+			assert.False(t, constraint.Allows(mustSemVer(t, version)), "%s denies %s", tt.constraint, version)
+		}
+	}
+
+	for _, invalid := range []string{"", " , ", ">=x", "~>2", "2.1-rc.1"} {
+		_, err := ParseVersionConstraint(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func mustSemVer(t *testing.T, value string) SemVer {
+	t.Helper()
+	version, err := ParseSemVer(value)
+	require.NoError(t, err)
+	return version
+}
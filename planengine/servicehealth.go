@@ -0,0 +1,182 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const defaultServiceHealthWindow = time.Hour
+
+// inFlightEvents are the task events after which a task is being worked on by its service
+var inFlightEvents = []string{TimelineTaskDispatched, TimelineTaskRetried, TimelineTaskStarted, TimelineTaskRerouted}
+
+// ServiceHealth is a service's connection state, the tasks it's working on, and how its tasks fared over the
+// scoreboard's window
+type ServiceHealth struct {
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	Type           ServiceType `json:"type"`
+	Connected      bool        `json:"connected"`
+	Instances      int         `json:"instances"`
+	Draining       bool        `json:"draining,omitempty"`
+	Degraded       bool        `json:"degraded,omitempty"`
+	Busy           bool        `json:"busy,omitempty"`
+	LastSeen       *time.Time  `json:"lastSeen,omitempty"`
+	InFlightTasks  int         `json:"inFlightTasks"`
+	CompletedTasks int         `json:"completedTasks"`
+	FailedTasks    int         `json:"failedTasks"`
+	ErrorRate      float64     `json:"errorRate"`
+	// AverageLatency is the average time between a task being dispatched and completing
+	AverageLatency time.Duration `json:"averageLatency"`
+}
+
+// ServiceHealthScoreboard is the health of every service registered to a project, task outcomes are counted from Since
+type ServiceHealthScoreboard struct {
+	Since    time.Time       `json:"since"`
+	Services []ServiceHealth `json:"services"`
+}
+
+// serviceTaskStats accumulates a service's task outcomes and latencies across orchestration logs
+type serviceTaskStats struct {
+	inFlight  int
+	completed int
+	failed    int
+	latency   time.Duration
+}
+
+// ServiceHealthScoreboard reports on every service registered to the project. Task outcomes and latencies are
+// taken from the orchestration logs still held in memory, so windows longer than their retention undercount.
+func (p *PlanEngine) ServiceHealthScoreboard(projectID string, window time.Duration) ServiceHealthScoreboard {
+	scoreboard := ServiceHealthScoreboard{
+		Since:    time.Now().UTC().Add(-window),
+		Services: []ServiceHealth{},
+	}
+
+	stats := map[string]*serviceTaskStats{}
+	for _, o := range p.getProjectOrchestrations(projectID) {
+		p.orchestrationStoreMu.RLock()
+		live := slices.Contains(liveStatuses, o.Status)
+		p.orchestrationStoreMu.RUnlock()
+		p.countServiceTaskStats(o.ID, live, scoreboard.Since, stats)
+	}
+
+	services, _ := p.discoverProjectServices(projectID)
+	for _, service := range services {
+		health := ServiceHealth{ID: service.ID, Name: service.Name, Type: service.Type}
+		if s, ok := stats[service.ID]; ok {
+			health.InFlightTasks = s.inFlight
+			health.CompletedTasks, health.FailedTasks = s.completed, s.failed
+			health.ErrorRate = failureRate(s.failed, s.completed+s.failed)
+			if s.completed > 0 {
+				health.AverageLatency = s.latency / time.Duration(s.completed)
+			}
+		}
+		if wsm := p.WebSocketManager; wsm != nil {
+			health.Connected = wsm.IsServiceHealthy(service.ID)
+			health.Instances = len(wsm.instanceSessions(service.ID))
+			health.Draining = wsm.IsServiceDraining(service.ID)
+			health.Degraded = wsm.IsServiceDegraded(service.ID)
+			health.Busy = wsm.IsServiceBusy(service.ID)
+			if lastSeen, ok := wsm.ServiceLastSeen(service.ID); ok {
+				health.LastSeen = &lastSeen
+			}
+		}
+		scoreboard.Services = append(scoreboard.Services, health)
+	}
+
+	sort.Slice(scoreboard.Services, func(i, j int) bool {
+		return scoreboard.Services[i].Name < scoreboard.Services[j].Name
+	})
+	return scoreboard
+}
+
+// countServiceTaskStats adds an orchestration's task outcomes since then, and the tasks it's still waiting on when
+// it's live, to each service's stats
+func (p *PlanEngine) countServiceTaskStats(orchestrationID string, live bool, since time.Time, stats map[string]*serviceTaskStats) {
+	if p.LogManager == nil {
+		return
+	}
+	log := p.LogManager.GetLog(orchestrationID)
+	if log == nil {
+		return
+	}
+
+	dispatched := map[string]time.Time{}
+	latest := map[string]TimelineEvent{}
+	for _, event := range taskTimelineEvents(log.ReadFrom(0)) {
+		if event.ServiceID == "" {
+			continue
+		}
+		latest[event.TaskID] = event
+		service, ok := stats[event.ServiceID]
+		if !ok {
+			service = &serviceTaskStats{}
+			stats[event.ServiceID] = service
+		}
+
+		switch event.Type {
+		case TimelineTaskDispatched, TimelineTaskRetried:
+			dispatched[event.TaskID] = event.Timestamp
+		case taskEventType(Completed):
+			if event.Timestamp.Before(since) {
+				continue
+			}
+			service.completed++
+			if start, ok := dispatched[event.TaskID]; ok && !event.CacheHit {
+				service.latency += event.Timestamp.Sub(start)
+			}
+		case taskEventType(Failed), taskEventType(TimedOut):
+			if !event.Timestamp.Before(since) {
+				service.failed++
+			}
+		}
+	}
+
+	if !live {
+		return
+	}
+	for _, event := range latest {
+		if slices.Contains(inFlightEvents, event.Type) {
+			stats[event.ServiceID].inFlight++
+		}
+	}
+}
+
+// ServiceHealthHandler returns the health of every service registered to the caller's project. Task outcomes are
+// counted over the last hour by default, e.g. ?window=24h widens it.
+func (app *App) ServiceHealthHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	window := defaultServiceHealthWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		window, err = time.ParseDuration(value)
+		if err != nil || window <= 0 || window > maxOverviewWindow {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("window"), "window must be a duration up to 720h, e.g. 1h"))
+			return
+		}
+	}
+
+	scoreboard := app.Engine.ServiceHealthScoreboard(project.ID, window)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(scoreboard); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
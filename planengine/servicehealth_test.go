@@ -0,0 +1,112 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceHealthScoreboard(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	app.Engine.WebSocketManager = wsm
+
+	payments := &ServiceInfo{ID: "s_payments", Name: "Payments", Type: Service, ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	shipping := &ServiceInfo{ID: "s_shipping", Name: "Shipping", Type: Service, ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{payments.ID: payments, shipping.ID: shipping}
+
+	connect := func(service *ServiceInfo) *callbackSession {
+		s := &callbackSession{wsm: wsm, serviceID: service.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+		s.Set(WSInstanceQueryParam, "i_1")
+		wsm.HandleConnection(service.ID, service.Name, s)
+		return s
+	}
+	connect(payments)
+	wsm.HandleDisconnection(shipping.ID, connect(shipping))
+
+	now := time.Now().UTC()
+	for _, o := range []*Orchestration{
+		{ID: "o_running", Status: Processing, Timestamp: now.Add(-time.Minute)},
+		{ID: "o_done", Status: Completed, Timestamp: now.Add(-10 * time.Minute)},
+		{ID: "o_broken", Status: Failed, Timestamp: now.Add(-20 * time.Minute)},
+		{ID: "o_old", Status: Failed, Timestamp: now.Add(-48 * time.Hour)},
+	} {
+		o.ProjectID = project.ID
+		o.Plan = &ExecutionPlan{Tasks: []*SubTask{{ID: "task1", Service: payments.ID}, {ID: "task2", Service: shipping.ID}}}
+		app.Engine.orchestrationStore[o.ID] = o
+		logManager.PrepLogForOrchestration(o.ProjectID, o.ID, o.Plan)
+	}
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_running", "task1", payments.ID, Processing, nil, now.Add(-time.Minute), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_done", "task1", payments.ID, Processing, nil, now.Add(-10*time.Minute), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_done", "task1", payments.ID, Completed, nil, now.Add(-10*time.Minute).Add(2*time.Second), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_broken", "task1", payments.ID, Processing, nil, now.Add(-20*time.Minute), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_broken", "task1", payments.ID, Completed, nil, now.Add(-20*time.Minute).Add(4*time.Second), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_broken", "task2", shipping.ID, Failed, errors.New("no carrier"), now.Add(-19*time.Minute), 1))
+	require.NoError(t, logManager.AppendTaskStatusEvent("o_old", "task2", shipping.ID, Failed, errors.New("no carrier"), now.Add(-48*time.Hour), 1))
+
+	getScoreboard := func(query string) (int, ServiceHealthScoreboard) {
+		req := httptest.NewRequest(http.MethodGet, "/services/health"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+
+		var scoreboard ServiceHealthScoreboard
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&scoreboard))
+		}
+		return rr.Code, scoreboard
+	}
+
+	t.Run("reports on every service", func(t *testing.T) {
+		code, scoreboard := getScoreboard("")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, scoreboard.Services, 2)
+
+		paymentsHealth := scoreboard.Services[0]
+		assert.Equal(t, payments.ID, paymentsHealth.ID)
+		assert.True(t, paymentsHealth.Connected)
+		assert.Equal(t, 1, paymentsHealth.Instances)
+		require.NotNil(t, paymentsHealth.LastSeen)
+		assert.Equal(t, 1, paymentsHealth.InFlightTasks)
+		assert.Equal(t, 2, paymentsHealth.CompletedTasks)
+		assert.Zero(t, paymentsHealth.FailedTasks)
+		assert.Equal(t, 3*time.Second, paymentsHealth.AverageLatency)
+
+		shippingHealth := scoreboard.Services[1]
+		assert.Equal(t, shipping.ID, shippingHealth.ID)
+		assert.False(t, shippingHealth.Connected)
+		assert.Zero(t, shippingHealth.Instances)
+		require.NotNil(t, shippingHealth.LastSeen, "a disconnected service was last seen when it disconnected")
+		assert.Equal(t, 1, shippingHealth.FailedTasks, "failures outside the window aren't counted")
+		assert.Equal(t, 1.0, shippingHealth.ErrorRate)
+	})
+
+	t.Run("window", func(t *testing.T) {
+		code, scoreboard := getScoreboard("?window=5m")
+		require.Equal(t, http.StatusOK, code)
+		assert.Zero(t, scoreboard.Services[0].CompletedTasks)
+		assert.Equal(t, 1, scoreboard.Services[0].InFlightTasks, "in-flight tasks are counted whatever the window")
+
+		code, _ = getScoreboard("?window=nope")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
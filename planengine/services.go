@@ -0,0 +1,134 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+// ServiceView is a registered service as declared, along with how it's connected
+type ServiceView struct {
+	*ServiceInfo
+	Connected bool       `json:"connected"`
+	Instances int        `json:"instances"`
+	LastSeen  *time.Time `json:"lastSeen,omitempty"`
+	// Revisions are listed by the service's versions, rather than with the service
+	Revisions []ServiceRevision `json:"revisions,omitempty"`
+	// EndpointSecret is only handed to the service, when it registers
+	EndpointSecret string `json:"endpointSecret,omitempty"`
+}
+
+func (p *PlanEngine) serviceView(service *ServiceInfo) ServiceView {
+	view := ServiceView{ServiceInfo: service}
+	if wsm := p.WebSocketManager; wsm != nil {
+		view.Connected = wsm.IsServiceHealthy(service.ID)
+		view.Instances = len(wsm.instanceSessions(service.ID))
+		if lastSeen, ok := wsm.ServiceLastSeen(service.ID); ok {
+			view.LastSeen = &lastSeen
+		}
+	}
+	return view
+}
+
+// DeregisterService removes a decommissioned service from its project, closing its connections. Orchestrations
+// can no longer be planned with it, those waiting on it time out.
+func (p *PlanEngine) DeregisterService(projectID, serviceID string) error {
+	if _, err := p.GetService(projectID, serviceID); err != nil {
+		return err
+	}
+
+	if err := p.svcStorage.DeleteService(projectID, serviceID); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	p.servicesMu.Lock()
+	delete(p.services[projectID], serviceID)
+	if len(p.services[projectID]) == 0 {
+		delete(p.services, projectID)
+	}
+	p.servicesMu.Unlock()
+
+	// Services are only let back in while they're registered, so they can't reconnect once closed
+	if p.WebSocketManager != nil {
+		p.WebSocketManager.DisconnectService(serviceID)
+	}
+	return nil
+}
+
+// ListServicesHandler lists the services registered to the caller's project by name
+func (app *App) ListServicesHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	services, _ := app.Engine.discoverProjectServices(project.ID)
+	views := make([]ServiceView, 0, len(services))
+	for _, service := range services {
+		views = append(views, app.Engine.serviceView(service))
+	}
+	sort.SliceStable(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(views); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// GetServiceHandler returns one of the caller's project services, including its declared schema
+func (app *App) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	service, err := app.Engine.GetService(project.ID, mux.Vars(r)["id"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.Engine.serviceView(service)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// DeregisterServiceHandler removes one of the caller's project services
+func (app *App) DeregisterServiceHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	serviceID := mux.Vars(r)["id"]
+	if !app.Engine.ServiceBelongsToProject(serviceID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), "unknown service: "+serviceID))
+		return
+	}
+
+	if err := app.Engine.DeregisterService(project.ID, serviceID); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(ServiceDeregistrationFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
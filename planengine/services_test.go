@@ -0,0 +1,93 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceEndpoints(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	wsm := NewWebSocketManager(app.Logger)
+	app.Engine.WebSocketManager = wsm
+
+	payments := &ServiceInfo{
+		ID:          "s_payments",
+		Name:        "Payments",
+		Description: "Charges cards",
+		Type:        Service,
+		ProjectID:   project.ID,
+		Schema: ServiceSchema{
+			Input:  Spec{Type: "object", Properties: map[string]Spec{"amount": {Type: "number"}}},
+			Output: Spec{Type: "object", Properties: map[string]Spec{"status": {Type: "string"}}},
+		},
+		IdempotencyStore: NewIdempotencyStore(0),
+	}
+	audit := &ServiceInfo{ID: "s_audit", Name: "Audit", Type: Service, ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	for _, service := range []*ServiceInfo{payments, audit} {
+		require.NoError(t, app.Db.StoreService(service))
+	}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{payments.ID: payments, audit.ID: audit}
+
+	session := &callbackSession{wsm: wsm, serviceID: payments.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	session.Set(WSInstanceQueryParam, "i_1")
+	wsm.HandleConnection(payments.ID, payments.Name, session)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("lists services by name", func(t *testing.T) {
+		w := send(http.MethodGet, "/services")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var services []ServiceView
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&services))
+		require.Len(t, services, 2)
+		assert.Equal(t, audit.ID, services[0].ID)
+		assert.False(t, services[0].Connected)
+		assert.Equal(t, payments.ID, services[1].ID)
+		assert.True(t, services[1].Connected)
+		assert.Equal(t, 1, services[1].Instances)
+	})
+
+	t.Run("shows a service's declared schema", func(t *testing.T) {
+		w := send(http.MethodGet, "/services/"+payments.ID)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var service ServiceView
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&service))
+		assert.Equal(t, "Charges cards", service.Description)
+		assert.Equal(t, "number", service.Schema.Input.Properties["amount"].Type)
+
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/services/s_unknown").Code)
+	})
+
+	t.Run("deregisters services and closes their connections", func(t *testing.T) {
+		w := send(http.MethodDelete, "/services/"+payments.ID)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		assert.False(t, app.Engine.ServiceBelongsToProject(payments.ID, project.ID))
+		assert.Empty(t, wsm.instanceSessions(payments.ID))
+		_, err := app.Db.LoadServiceByProjectID(project.ID, payments.ID)
+		assert.ErrorIs(t, err, ErrServiceNotFound)
+
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodDelete, "/services/"+payments.ID).Code)
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, "/services/"+audit.ID).Code, "other services are left registered")
+	})
+}
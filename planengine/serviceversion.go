@@ -0,0 +1,255 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	ServiceVersionMismatchCode = "SERVICE_VERSION_MISMATCH"
+	// MaxServiceRevisions caps how many of a service's versions are kept addressable
+	MaxServiceRevisions = 10
+)
+
+// ServiceRevision is a version of a service as it was registered
+type ServiceRevision struct {
+	SemanticVersion string        `json:"semanticVersion,omitempty"`
+	Version         int64         `json:"version"`
+	Description     string        `json:"description"`
+	Schema          ServiceSchema `json:"schema"`
+	RegisteredAt    time.Time     `json:"registeredAt"`
+}
+
+// ServiceVersionHistory lists a service's recent versions, newest first
+type ServiceVersionHistory struct {
+	ServiceID       string            `json:"serviceId"`
+	Name            string            `json:"name"`
+	SemanticVersion string            `json:"semanticVersion,omitempty"`
+	Versions        []ServiceRevision `json:"versions"`
+}
+
+// ServiceVersionMismatch are the details of a task failed for its service no longer satisfying the
+// orchestration's version constraint
+type ServiceVersionMismatch struct {
+	Service    string `json:"service"`
+	Constraint string `json:"constraint"`
+	Version    string `json:"version,omitempty"`
+}
+
+// recordRevision adds the service's registration to the revisions carried over from its previous one.
+// Re-registering the same semantic version, as services do on every restart, replaces its revision.
+func (s *ServiceInfo) recordRevision(previous []ServiceRevision, registeredAt time.Time) {
+	revisions := slices.Clone(previous)
+	if n := len(revisions); n > 0 && revisions[n-1].SemanticVersion == s.SemanticVersion {
+		revisions = revisions[:n-1]
+	}
+	revisions = append(revisions, ServiceRevision{
+		SemanticVersion: s.SemanticVersion,
+		Version:         s.Version,
+		Description:     s.Description,
+		Schema:          s.Schema,
+		RegisteredAt:    registeredAt,
+	})
+	if len(revisions) > MaxServiceRevisions {
+		revisions = revisions[len(revisions)-MaxServiceRevisions:]
+	}
+	s.Revisions = revisions
+}
+
+// revision finds the service's revision for a semantic version
+func (s *ServiceInfo) revision(version SemVer) (ServiceRevision, bool) {
+	for _, revision := range s.Revisions {
+		if parsed, err := ParseSemVer(revision.SemanticVersion); err == nil && parsed.Compare(version) == 0 {
+			return revision, true
+		}
+	}
+	return ServiceRevision{}, false
+}
+
+// validateServiceVersions checks an orchestration's version constraints, keyed by service name
+func validateServiceVersions(constraints map[string]string) error {
+	names := make([]string, 0, len(constraints))
+	for name := range constraints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("service names cannot be empty")
+		}
+		if _, err := ParseVersionConstraint(constraints[name]); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resolveServiceVersions checks the project's services satisfy the orchestration's version constraints, and
+// records the versions it's planned against. Orchestrations are not planned with services at other versions.
+func (p *PlanEngine) resolveServiceVersions(orchestration *Orchestration, services []*ServiceInfo) error {
+	names := make([]string, 0, len(orchestration.ServiceVersions))
+	for name := range orchestration.ServiceVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		constraint := orchestration.ServiceVersions[name]
+		i := slices.IndexFunc(services, func(s *ServiceInfo) bool { return s.Name == name })
+		if i < 0 {
+			return fmt.Errorf("service %s is pinned to %s but is not registered", name, constraint)
+		}
+		if err := checkServiceVersion(services[i], constraint); err != nil {
+			return err
+		}
+	}
+
+	resolved := make(map[string]string)
+	for _, service := range services {
+		if service.SemanticVersion != "" {
+			resolved[service.Name] = service.SemanticVersion
+		}
+	}
+	if len(resolved) > 0 {
+		orchestration.PlannedVersions = resolved
+	}
+	return nil
+}
+
+// checkServiceVersion checks the service's registered version satisfies a version constraint
+func checkServiceVersion(service *ServiceInfo, constraint string) error {
+	parsed, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", service.Name, err)
+	}
+	if service.SemanticVersion == "" {
+		return fmt.Errorf("service %s is pinned to %s but registered without a semantic version", service.Name, constraint)
+	}
+	version, err := ParseSemVer(service.SemanticVersion)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", service.Name, err)
+	}
+	if !parsed.Allows(version) {
+		return fmt.Errorf("service %s is registered at version %s, which does not satisfy %s", service.Name, service.SemanticVersion, constraint)
+	}
+	return nil
+}
+
+// checkServiceVersion checks the service the task is about to be dispatched to is still at a version the
+// orchestration allows, services may be upgraded while it's underway
+func (w *TaskWorker) checkServiceVersion(orchestrationID string) error {
+	current, err := w.LogManager.planEngine.GetServiceByID(w.Service.ID)
+	if err != nil {
+		// Deregistered services are reported once the task can't be sent to them
+		return nil
+	}
+
+	if w.VersionConstraint == "" {
+		if w.PlannedVersion != "" && current.SemanticVersion != w.PlannedVersion {
+			w.LogManager.Logger.Warn().
+				Str("OrchestrationID", orchestrationID).
+				Str("TaskID", w.TaskID).
+				Str("ServiceName", current.Name).
+				Str("PlannedVersion", w.PlannedVersion).
+				Str("ServiceVersion", current.SemanticVersion).
+				Msg("Service was upgraded after the orchestration was planned, its version is not pinned")
+		}
+		return nil
+	}
+
+	err = checkServiceVersion(current, w.VersionConstraint)
+	if err == nil {
+		return nil
+	}
+	details, _ := json.Marshal(ServiceVersionMismatch{
+		Service:    current.Name,
+		Constraint: w.VersionConstraint,
+		Version:    current.SemanticVersion,
+	})
+	retryable := false
+	return &TaskError{Code: ServiceVersionMismatchCode, Message: err.Error(), Retryable: &retryable, Details: details}
+}
+
+// serviceVersionHistory lists the service's revisions, newest first
+func serviceVersionHistory(service *ServiceInfo) ServiceVersionHistory {
+	versions := slices.Clone(service.Revisions)
+	slices.Reverse(versions)
+	if versions == nil {
+		versions = []ServiceRevision{}
+	}
+	return ServiceVersionHistory{
+		ServiceID:       service.ID,
+		Name:            service.Name,
+		SemanticVersion: service.SemanticVersion,
+		Versions:        versions,
+	}
+}
+
+// ListServiceVersionsHandler lists the recent versions of one of the caller's project services
+func (app *App) ListServiceVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	service, err := app.Engine.GetService(project.ID, mux.Vars(r)["id"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(serviceVersionHistory(service)); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// GetServiceVersionHandler returns one of the recent versions of one of the caller's project services
+func (app *App) GetServiceVersionHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	vars := mux.Vars(r)
+	service, err := app.Engine.GetService(project.ID, vars["id"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceErrCode), err))
+		return
+	}
+
+	version, err := ParseSemVer(vars["version"])
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("version"), err))
+		return
+	}
+	revision, ok := service.revision(version)
+	if !ok {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownServiceVersionErrCode), errs.Parameter("version"), fmt.Sprintf("service %s has no recent version %s", service.Name, version)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revision); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceVersions(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	const schema = `{"input":{"type":"object","properties":{"id":{"type":"string"}}},"output":{"type":"object","properties":{"total":{"type":"number"}}}}`
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	register := func(version, description string) ServiceRegistrationResponse {
+		body := fmt.Sprintf(`{"name":"invoice-agent","description":%q,"semanticVersion":%q,"schema":%s}`, description, version, schema)
+		w := serve(http.MethodPut, "/register/agent", body)
+		require.Less(t, w.Code, http.StatusBadRequest, w.Body.String())
+		var response ServiceRegistrationResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+
+	registered := register("2.0.0", "invoices")
+	register("2.1.0", "invoices, itemised")
+	register("2.1.0", "invoices, itemised on restart")
+
+	t.Run("recent versions are addressable", func(t *testing.T) {
+		w := serve(http.MethodGet, "/services/"+registered.ID+"/versions", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var history ServiceVersionHistory
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&history))
+		assert.Equal(t, "2.1.0", history.SemanticVersion)
+		require.Len(t, history.Versions, 2, "re-registering a version replaces it")
+		assert.Equal(t, "invoices, itemised on restart", history.Versions[0].Description)
+		assert.Equal(t, "2.0.0", history.Versions[1].SemanticVersion)
+
+		w = serve(http.MethodGet, "/services/"+registered.ID+"/versions/v2.0.0", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var revision ServiceRevision
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&revision))
+		assert.Equal(t, "invoices", revision.Description)
+		assert.EqualValues(t, 1, revision.Version)
+
+		w = serve(http.MethodGet, "/services/"+registered.ID+"/versions/1.0.0", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), UnknownServiceVersionErrCode)
+
+		w = serve(http.MethodGet, "/services/"+registered.ID, "")
+		assert.NotContains(t, w.Body.String(), `"revisions"`, "services are shown without their revisions")
+	})
+
+	t.Run("versions are validated", func(t *testing.T) {
+		w := serve(http.MethodPut, "/register/agent", `{"name":"invoice-agent","description":"invoices","semanticVersion":"2.1","schema":`+schema+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "semanticVersion")
+
+		w = serve(http.MethodPost, "/orchestrations", `{"action":{"content":"invoice"},"webhook":"http://localhost/hook","serviceVersions":{"invoice-agent":">=two"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "serviceVersions")
+	})
+
+	t.Run("orchestrations are planned against satisfying versions", func(t *testing.T) {
+		services, err := app.Engine.discoverProjectServices(project.ID)
+		require.NoError(t, err)
+
+		pinned := &Orchestration{ServiceVersions: map[string]string{"invoice-agent": ">=2.1"}}
+		require.NoError(t, app.Engine.resolveServiceVersions(pinned, services))
+		assert.Equal(t, map[string]string{"invoice-agent": "2.1.0"}, pinned.PlannedVersions)
+
+		outdated := &Orchestration{ServiceVersions: map[string]string{"invoice-agent": "^3"}}
+		assert.ErrorContains(t, app.Engine.resolveServiceVersions(outdated, services), "does not satisfy ^3")
+
+		unknown := &Orchestration{ServiceVersions: map[string]string{"billing-agent": "1.0"}}
+		assert.ErrorContains(t, app.Engine.resolveServiceVersions(unknown, services), "not registered")
+	})
+
+	t.Run("tasks are not dispatched to upgraded services", func(t *testing.T) {
+		service, err := app.Engine.GetServiceByID(registered.ID)
+		require.NoError(t, err)
+		worker := NewTaskWorker(service, "task1", nil, time.Second, 0, time.Second, resolveRetryPolicy(nil, nil), logManager).(*TaskWorker)
+		worker.VersionConstraint, worker.PlannedVersion = "~2.1", "2.1.0"
+		require.NoError(t, worker.checkServiceVersion("o_1"))
+
+		register("3.0.0", "invoices, restructured")
+		err = worker.checkServiceVersion("o_1")
+		var taskErr *TaskError
+		require.True(t, errors.As(err, &taskErr))
+		assert.Equal(t, ServiceVersionMismatchCode, taskErr.Code)
+		assert.False(t, resolveRetryPolicy(nil, nil).Retryable(err), "version mismatches are terminal")
+		assert.JSONEq(t, `{"service":"invoice-agent","constraint":"~2.1","version":"3.0.0"}`, string(taskErr.Details))
+
+		worker.VersionConstraint = ""
+		assert.NoError(t, worker.checkServiceVersion("o_1"), "unpinned services may be upgraded")
+	})
+}
+
+func TestServiceRevisionsAreCapped(t *testing.T) {
+	service := &ServiceInfo{Name: "invoice-agent"}
+	for i := range MaxServiceRevisions + 3 {
+		service.SemanticVersion = fmt.Sprintf("1.%d.0", i)
+		service.Version = int64(i + 1)
+		service.recordRevision(service.Revisions, time.Now())
+	}
+
+	require.Len(t, service.Revisions, MaxServiceRevisions)
+	assert.Equal(t, "1.3.0", service.Revisions[0].SemanticVersion)
+	assert.Equal(t, fmt.Sprintf("1.%d.0", MaxServiceRevisions+2), service.Revisions[MaxServiceRevisions-1].SemanticVersion)
+}
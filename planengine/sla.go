@@ -0,0 +1,102 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const maxSLA = 30 * 24 * time.Hour
+
+func validateSLA(sla *Duration) error {
+	if sla == nil {
+		return nil
+	}
+	if sla.Duration <= 0 || sla.Duration > maxSLA {
+		return fmt.Errorf("sla must be positive and at most %s", maxSLA)
+	}
+	return nil
+}
+
+// scheduleSLA escalates the orchestration if it isn't finished by its SLA deadline. The deadline is fixed
+// when the orchestration is first accepted, so time spent scheduled or queued counts against it.
+func (p *PlanEngine) scheduleSLA(orchestration *Orchestration) {
+	if orchestration.SLA == nil || orchestration.DryRun || orchestration.SLABreached {
+		return
+	}
+	if orchestration.SLADeadline == nil {
+		deadline := time.Now().UTC().Add(orchestration.SLA.Duration)
+		orchestration.SLADeadline = &deadline
+	}
+
+	orchestrationID := orchestration.ID
+	timer := time.AfterFunc(time.Until(*orchestration.SLADeadline), func() {
+		p.breachSLA(orchestrationID)
+	})
+
+	p.workerMu.Lock()
+	if existing, exists := p.slaTimers[orchestrationID]; exists {
+		existing.Stop()
+	}
+	p.slaTimers[orchestrationID] = timer
+	p.workerMu.Unlock()
+}
+
+// breachSLA marks an orchestration that overran its SLA and notifies the project's webhooks.
+// Unlike a timeout the orchestration carries on running, it's left to the project to escalate.
+func (p *PlanEngine) breachSLA(orchestrationID string) {
+	p.workerMu.Lock()
+	delete(p.slaTimers, orchestrationID)
+	p.workerMu.Unlock()
+
+	p.orchestrationStoreMu.Lock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists || orchestration.SLABreached || orchestrationFinished(orchestration.Status) {
+		p.orchestrationStoreMu.Unlock()
+		return
+	}
+	orchestration.SLABreached = true
+	if err := p.orchestrationStorage.StoreOrchestration(orchestration); err != nil {
+		p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Failed to persist SLA breach")
+	}
+	projectID, status, deadline := orchestration.ProjectID, orchestration.Status, *orchestration.SLADeadline
+	p.orchestrationStoreMu.Unlock()
+
+	p.Logger.Warn().
+		Str("OrchestrationID", orchestrationID).
+		Str("ProjectID", projectID).
+		Time("Deadline", deadline).
+		Msg("Orchestration breached its SLA")
+
+	if project, err := p.GetProjectByID(projectID); err == nil {
+		p.notifyInBackground(func() {
+			p.notifyOrchestrationEvent(project, orchestrationID, ProjectEventSLABreached, map[string]any{
+				"orchestrationId": orchestrationID,
+				"deadline":        deadline,
+				"status":          status,
+			})
+		})
+	}
+}
+
+// SLAStatus reports an orchestration's SLA deadline in inspections, and whether it was breached
+type SLAStatus struct {
+	Deadline time.Time `json:"deadline"`
+	Breached bool      `json:"breached"`
+}
+
+func (p *PlanEngine) orchestrationSLA(orchestrationID string) *SLAStatus {
+	p.orchestrationStoreMu.RLock()
+	defer p.orchestrationStoreMu.RUnlock()
+
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists || orchestration.SLADeadline == nil {
+		return nil
+	}
+	return &SLAStatus{Deadline: *orchestration.SLADeadline, Breached: orchestration.SLABreached}
+}
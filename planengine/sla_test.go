@@ -0,0 +1,81 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSLABreach(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	events := make(chan ProjectEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	t.Run("overrunning orchestrations are marked and reported but keep running", func(t *testing.T) {
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.SLA = &Duration{50 * time.Millisecond}
+
+		app.Engine.scheduleSLA(orchestration)
+		require.NotNil(t, orchestration.SLADeadline)
+
+		select {
+		case event := <-events:
+			assert.Equal(t, ProjectEventSLABreached, event.Event)
+			assert.Equal(t, orchestration.ID, event.Data.(map[string]any)["orchestrationId"])
+		case <-time.After(2 * time.Second):
+			t.Fatal("project webhook was not notified")
+		}
+
+		sla := app.Engine.orchestrationSLA(orchestration.ID)
+		require.NotNil(t, sla)
+		assert.True(t, sla.Breached)
+		assert.Equal(t, *orchestration.SLADeadline, sla.Deadline)
+		assert.Equal(t, Processing, orchestration.Status)
+	})
+
+	t.Run("orchestrations finished in time are not reported", func(t *testing.T) {
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.SLA = &Duration{50 * time.Millisecond}
+
+		app.Engine.scheduleSLA(orchestration)
+		app.Engine.cleanupLogWorkers(orchestration.ID)
+
+		select {
+		case <-events:
+			t.Fatal("SLA breached after the orchestration finished")
+		case <-time.After(200 * time.Millisecond):
+		}
+		assert.False(t, app.Engine.orchestrationSLA(orchestration.ID).Breached)
+	})
+
+	t.Run("deadlines are kept when orchestrations are rescheduled", func(t *testing.T) {
+		deadline := time.Now().UTC().Add(time.Hour)
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.SLA = &Duration{time.Minute}
+		orchestration.SLADeadline = &deadline
+
+		app.Engine.scheduleSLA(orchestration)
+		defer app.Engine.cleanupLogWorkers(orchestration.ID)
+		assert.Equal(t, deadline, *orchestration.SLADeadline)
+	})
+}
@@ -0,0 +1,133 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// TaskDurationAnomaly describes how far a slow task's duration was from its service's baseline
+type TaskDurationAnomaly struct {
+	Duration time.Duration `json:"duration"`
+	Mean     time.Duration `json:"mean"`
+	StdDev   time.Duration `json:"stdDev"`
+	// Deviations is how many standard deviations over the mean the task took
+	Deviations float64 `json:"deviations"`
+	Samples    int     `json:"samples"`
+}
+
+// latencyBaseline is a ring of a service's most recent task durations
+type latencyBaseline struct {
+	samples []time.Duration
+	next    int
+}
+
+func (b *latencyBaseline) add(duration time.Duration, size int) {
+	if len(b.samples) < size {
+		b.samples = append(b.samples, duration)
+		return
+	}
+	b.samples[b.next%len(b.samples)] = duration
+	b.next = (b.next + 1) % len(b.samples)
+}
+
+func (b *latencyBaseline) stats() (mean, stdDev float64) {
+	for _, sample := range b.samples {
+		mean += float64(sample)
+	}
+	mean /= float64(len(b.samples))
+
+	var variance float64
+	for _, sample := range b.samples {
+		variance += math.Pow(float64(sample)-mean, 2)
+	}
+	return mean, math.Sqrt(variance / float64(len(b.samples)))
+}
+
+// ConfigureSlowTasks replaces the default slow task settings, unset settings keep their defaults
+func (p *PlanEngine) ConfigureSlowTasks(cfg SlowTasks) {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+
+	if cfg.BaselineSize > 0 {
+		p.slowTasks.BaselineSize = cfg.BaselineSize
+	}
+	if cfg.MinSamples > 0 {
+		p.slowTasks.MinSamples = cfg.MinSamples
+	}
+	if cfg.Deviations > 0 {
+		p.slowTasks.Deviations = cfg.Deviations
+	}
+	if cfg.MinDuration > 0 {
+		p.slowTasks.MinDuration = cfg.MinDuration
+	}
+	p.slowTasks.Webhook = cfg.Webhook
+}
+
+// observeTaskDuration compares a task's duration with its service's baseline, returning how anomalous it was when
+// it's slow, before adding it to the baseline. Baselines adapt to services becoming slower for good, as recent
+// durations replace older ones.
+func (p *PlanEngine) observeTaskDuration(serviceID string, duration time.Duration) *TaskDurationAnomaly {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+
+	baseline, ok := p.latencyBaselines[serviceID]
+	if !ok {
+		baseline = &latencyBaseline{}
+		p.latencyBaselines[serviceID] = baseline
+	}
+	defer baseline.add(duration, p.slowTasks.BaselineSize)
+
+	if len(baseline.samples) < p.slowTasks.MinSamples || duration < p.slowTasks.MinDuration {
+		return nil
+	}
+
+	// Services with very steady durations would otherwise flag tasks only slightly slower than usual
+	mean, stdDev := baseline.stats()
+	spread := math.Max(stdDev, mean/10)
+	if spread == 0 {
+		return nil
+	}
+	deviations := (float64(duration) - mean) / spread
+	if deviations <= p.slowTasks.Deviations {
+		return nil
+	}
+
+	p.Metrics.ObserveSlowTask(serviceID)
+	return &TaskDurationAnomaly{
+		Duration:   duration,
+		Mean:       time.Duration(mean),
+		StdDev:     time.Duration(stdDev),
+		Deviations: math.Round(deviations*10) / 10,
+		Samples:    len(baseline.samples),
+	}
+}
+
+// notifyTaskSlow tells the orchestration's project about one of its tasks being slow, when slow tasks are announced
+func (p *PlanEngine) notifyTaskSlow(event TaskStatusEvent) {
+	p.latencyMu.Lock()
+	announced := p.slowTasks.Webhook
+	p.latencyMu.Unlock()
+	if !announced {
+		return
+	}
+	orchestration, err := p.getOrchestration(event.OrchestrationID)
+	if err != nil {
+		return
+	}
+	project, err := p.GetProjectByID(orchestration.ProjectID)
+	if err != nil {
+		return
+	}
+	p.notifyOrchestrationEvent(project, event.OrchestrationID, ProjectEventTaskSlow, map[string]any{
+		"orchestrationId": event.OrchestrationID,
+		"taskId":          event.TaskID,
+		"serviceId":       event.ServiceID,
+		"slow":            event.Slow,
+	})
+}
@@ -0,0 +1,128 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveTaskDuration(t *testing.T) {
+	plane := NewPlanEngine()
+	plane.ConfigureSlowTasks(SlowTasks{BaselineSize: 10, MinSamples: 5})
+
+	for _, ms := range []int{900, 1000, 1100, 1000} {
+		assert.Nil(t, plane.observeTaskDuration("s_echo", time.Duration(ms)*time.Millisecond))
+	}
+	assert.Nil(t, plane.observeTaskDuration("s_echo", 10*time.Second), "the baseline needs enough samples first")
+	assert.Nil(t, plane.observeTaskDuration("s_other", 10*time.Second), "services have their own baselines")
+
+	t.Run("flags durations far above the baseline", func(t *testing.T) {
+		slow := plane.observeTaskDuration("s_echo", 30*time.Second)
+		require.NotNil(t, slow)
+		assert.Equal(t, 30*time.Second, slow.Duration)
+		assert.Equal(t, 5, slow.Samples)
+		assert.Equal(t, 2800*time.Millisecond, slow.Mean)
+		assert.Greater(t, slow.Deviations, SlowTaskDeviations)
+
+		assert.Nil(t, plane.observeTaskDuration("s_echo", 3*time.Second))
+	})
+
+	t.Run("tasks shorter than the minimum duration are never slow", func(t *testing.T) {
+		fast := NewPlanEngine()
+		for range 20 {
+			fast.observeTaskDuration("s_fast", 10*time.Millisecond)
+		}
+		assert.Nil(t, fast.observeTaskDuration("s_fast", 500*time.Millisecond))
+	})
+
+	t.Run("steady services are only flagged well outside their usual duration", func(t *testing.T) {
+		steady := NewPlanEngine()
+		for range 20 {
+			steady.observeTaskDuration("s_steady", 2*time.Second)
+		}
+		assert.Nil(t, steady.observeTaskDuration("s_steady", 2500*time.Millisecond))
+		assert.NotNil(t, steady.observeTaskDuration("s_steady", 3*time.Second))
+	})
+
+	t.Run("the baseline only keeps recent durations", func(t *testing.T) {
+		shifted := NewPlanEngine()
+		shifted.ConfigureSlowTasks(SlowTasks{BaselineSize: 5, MinSamples: 5})
+		for range 5 {
+			shifted.observeTaskDuration("s_shift", time.Second)
+		}
+		for range 5 {
+			shifted.observeTaskDuration("s_shift", 20*time.Second)
+		}
+		assert.Nil(t, shifted.observeTaskDuration("s_shift", 20*time.Second))
+	})
+}
+
+func TestSlowTaskMarkedAndAnnounced(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	received := make(chan ProjectEvent, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+	project.Webhooks = []string{receiver.URL}
+
+	now := time.Now().UTC()
+	orchestration := &Orchestration{ID: "o_slow", ProjectID: project.ID, Status: Processing, Timestamp: now}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+	logManager.PrepLogForOrchestration(project.ID, orchestration.ID, &ExecutionPlan{})
+
+	slow := &TaskDurationAnomaly{Duration: 30 * time.Second, Mean: time.Second, StdDev: 100 * time.Millisecond, Deviations: 290, Samples: 20}
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_echo", Processing, nil, now, 0))
+	require.NoError(t, logManager.AppendTaskCompletedEvent(orchestration.ID, "task1", "s_echo", now.Add(30*time.Second), 0, slow))
+
+	timeline, err := app.Engine.OrchestrationTimeline(orchestration.ID)
+	require.NoError(t, err)
+	var completed *TimelineEvent
+	for i, event := range timeline.Events {
+		if event.Type == taskEventType(Completed) {
+			completed = &timeline.Events[i]
+		}
+	}
+	require.NotNil(t, completed)
+	assert.Equal(t, slow, completed.Slow)
+
+	select {
+	case <-received:
+		t.Fatal("slow tasks are only announced when enabled")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	app.Engine.ConfigureSlowTasks(SlowTasks{Webhook: true})
+	require.NoError(t, logManager.AppendTaskCompletedEvent(orchestration.ID, "task2", "s_echo", now.Add(time.Minute), 0, slow))
+	select {
+	case event := <-received:
+		assert.Equal(t, ProjectEventTaskSlow, event.Event)
+		data, ok := event.Data.(map[string]any)
+		require.True(t, ok)
+		assert.Equal(t, "task2", data["taskId"])
+		assert.NotNil(t, data["slow"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("project webhook was not notified")
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	IdempotencyKeyHeader    = "Idempotency-Key"
+	IdempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	ErrIdempotencyKeyInUse   = errors.New("a request with this idempotency key is still being processed")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyTooLong = fmt.Errorf("idempotency key must be at most %d characters", maxIdempotencyKeyLength)
+	ErrSubmissionNotFound    = errors.New("submission not found")
+)
+
+// Submission records the orchestration created for a request sent with an Idempotency-Key header
+type Submission struct {
+	ProjectID       string    `json:"projectId"`
+	Key             string    `json:"key"`
+	Fingerprint     string    `json:"fingerprint"`
+	OrchestrationID string    `json:"orchestrationId"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+type SubmissionStorage interface {
+	StoreSubmission(submission *Submission, ttl time.Duration) error
+	LoadSubmission(projectID, key string) (*Submission, error)
+	DeleteOrchestrationSubmissions(projectID, orchestrationID string) error
+}
+
+// Submissions deduplicates orchestration requests that are resubmitted with the same idempotency key,
+// keys are remembered for the configured window after the original request was accepted.
+type Submissions struct {
+	storage  SubmissionStorage
+	window   time.Duration
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+	now      func() time.Time
+}
+
+func NewSubmissions(storage SubmissionStorage, window time.Duration) *Submissions {
+	return &Submissions{
+		storage:  storage,
+		window:   window,
+		inFlight: make(map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+// submissionFingerprint identifies a request's content so a key can't be reused for a different orchestration
+func submissionFingerprint(orchestration *Orchestration) (string, error) {
+	data, err := json.Marshal(orchestration)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Claim reserves a key for a new request. When the key was already used for the same request
+// the original orchestration's ID is returned and nothing is reserved.
+func (s *Submissions) Claim(projectID, key, fingerprint string) (string, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return "", ErrIdempotencyKeyTooLong
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claim := submissionClaim(projectID, key)
+	if _, exists := s.inFlight[claim]; exists {
+		return "", ErrIdempotencyKeyInUse
+	}
+
+	submission, err := s.storage.LoadSubmission(projectID, key)
+	switch {
+	case err == nil:
+		if submission.Fingerprint != fingerprint {
+			return "", ErrIdempotencyKeyReused
+		}
+		return submission.OrchestrationID, nil
+	case !errors.Is(err, ErrSubmissionNotFound):
+		return "", err
+	}
+
+	s.inFlight[claim] = struct{}{}
+	return "", nil
+}
+
+// Complete remembers the orchestration created for a claimed key for the dedupe window
+func (s *Submissions) Complete(projectID, key, fingerprint, orchestrationID string) error {
+	defer s.Release(projectID, key)
+
+	return s.storage.StoreSubmission(&Submission{
+		ProjectID:       projectID,
+		Key:             key,
+		Fingerprint:     fingerprint,
+		OrchestrationID: orchestrationID,
+		CreatedAt:       s.now().UTC(),
+	}, s.window)
+}
+
+// Release frees a claimed key without recording a submission, so a failed request can be retried
+func (s *Submissions) Release(projectID, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, submissionClaim(projectID, key))
+}
+
+func submissionClaim(projectID, key string) string {
+	return projectID + ":" + key
+}
+
+// claimSubmission reserves a request's idempotency key, returning the original orchestration for resubmitted requests.
+// Requests without a key, or when deduplication is off, pass through with an empty fingerprint.
+func (app *App) claimSubmission(w http.ResponseWriter, r *http.Request, projectID, key string, orchestration *Orchestration) (string, *Orchestration, bool) {
+	if key == "" || app.Submissions == nil {
+		return "", nil, true
+	}
+
+	fingerprint, err := submissionFingerprint(orchestration)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return "", nil, false
+	}
+
+	orchestrationID, err := app.Submissions.Claim(projectID, key, fingerprint)
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyTooLong):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter(IdempotencyKeyHeader), err))
+		return "", nil, false
+	case errors.Is(err, ErrIdempotencyKeyInUse), errors.Is(err, ErrIdempotencyKeyReused):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Exist, errs.Code(IdempotencyKeyConflictErrCode), err))
+		return "", nil, false
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return "", nil, false
+	}
+
+	if orchestrationID == "" {
+		return fingerprint, nil, true
+	}
+
+	original, err := app.Engine.getOrchestration(orchestrationID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), err))
+		return "", nil, false
+	}
+	return fingerprint, original, true
+}
+
+// completeSubmission records the orchestration an idempotent request created, the request has already succeeded
+// so failing to record it is only logged.
+func (app *App) completeSubmission(r *http.Request, projectID, key, fingerprint string, orchestration *Orchestration) {
+	if fingerprint == "" {
+		return
+	}
+
+	if err := app.Submissions.Complete(projectID, key, fingerprint, orchestration.ID); err != nil {
+		logger := app.requestLogger(r)
+		logger.Error().
+			Err(err).
+			Str("OrchestrationID", orchestration.ID).
+			Str("IdempotencyKey", key).
+			Msg("Failed to record idempotent submission")
+	}
+}
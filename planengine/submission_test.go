@@ -0,0 +1,92 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentOrchestrationSubmission(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.RootCtx = context.Background()
+	app.Submissions = NewSubmissions(app.Db, time.Hour)
+	project.Webhooks = []string{"http://localhost/webhook"}
+
+	runAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := fmt.Sprintf(`{"action":{"type":"user","content":"Echo"},"webhook":"http://localhost/webhook","runAt":%q}`, runAt)
+
+	submit := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orchestrations", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	orchestrationID := func(w *httptest.ResponseRecorder) string {
+		var orchestration Orchestration
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &orchestration))
+		return orchestration.ID
+	}
+
+	first := submit("order-42", body)
+	require.Equal(t, http.StatusAccepted, first.Code, first.Body.String())
+
+	t.Run("resubmitted request returns the original orchestration", func(t *testing.T) {
+		w := submit("order-42", body)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		assert.Equal(t, "true", w.Header().Get(IdempotentReplayHeader))
+		assert.Equal(t, orchestrationID(first), orchestrationID(w))
+		assert.Len(t, app.Engine.GetOrchestrationList(project.ID, OrchestrationQuery{}).Scheduled, 1)
+	})
+
+	t.Run("key reused for a different request is rejected", func(t *testing.T) {
+		w := submit("order-42", strings.Replace(body, "Echo", "Echo twice", 1))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), IdempotencyKeyConflictErrCode)
+	})
+
+	t.Run("key being processed is rejected", func(t *testing.T) {
+		_, err := app.Submissions.Claim(project.ID, "order-43", "fingerprint")
+		require.NoError(t, err)
+		defer app.Submissions.Release(project.ID, "order-43")
+
+		w := submit("order-43", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("failed request frees its key", func(t *testing.T) {
+		invalid := strings.Replace(body, "http://localhost/webhook", "http://localhost/unknown", 1)
+		w := submit("order-44", invalid)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = submit("order-44", body)
+		assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		assert.NotEqual(t, orchestrationID(first), orchestrationID(w))
+	})
+
+	t.Run("requests without a key are not deduplicated", func(t *testing.T) {
+		w := submit("", body)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		assert.NotEqual(t, orchestrationID(first), orchestrationID(w))
+	})
+}
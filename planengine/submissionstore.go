@@ -0,0 +1,77 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const submissionKeyPrefix = "submission:"
+
+func submissionKey(projectID, key string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", submissionKeyPrefix, projectID, key))
+}
+
+// StoreSubmission persists a submission, records expire once the dedupe window has passed
+func (b *BadgerDB) StoreSubmission(submission *Submission, ttl time.Duration) error {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal submission: %w", err)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry(submissionKey(submission.ProjectID, submission.Key), data).WithTTL(ttl)
+		if err := txn.SetEntry(entry); err != nil {
+			return fmt.Errorf("failed to store submission: %w", err)
+		}
+		return nil
+	})
+}
+
+func (b *BadgerDB) LoadSubmission(projectID, key string) (*Submission, error) {
+	var submission Submission
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(submissionKey(projectID, key))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrSubmissionNotFound
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &submission)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// DeleteOrchestrationSubmissions deletes the project's submissions that created an orchestration, resubmitting
+// their requests creates a new orchestration
+func (b *BadgerDB) DeleteOrchestrationSubmissions(projectID, orchestrationID string) error {
+	prefix := []byte(fmt.Sprintf("%s%s:", submissionKeyPrefix, projectID))
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return deleteMatching(txn, prefix, func(val []byte) (bool, error) {
+			var submission Submission
+			if err := json.Unmarshal(val, &submission); err != nil {
+				return false, err
+			}
+			return submission.OrchestrationID == orchestrationID, nil
+		})
+	})
+}
@@ -0,0 +1,216 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TaskTypeOrchestration       = "orchestration"
+	SubOrchestrationProducerID  = "orchestration"
+	subOrchestrationStepPrefix  = "orchestration_"
+	subOrchestrationPollingRate = 250 * time.Millisecond
+)
+
+// SubOrchestration is a smaller orchestration run as a step of its parent, its results become the step's output
+type SubOrchestration struct {
+	// ID names the step within the parent orchestration
+	ID     string       `json:"id"`
+	Action Action       `json:"action"`
+	Params ActionParams `json:"data,omitempty"`
+}
+
+// OrchestrationLink ties a child orchestration to the parent task that launched it
+type OrchestrationLink struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskId"`
+}
+
+type SubOrchestrationWorker struct {
+	TaskID     string
+	Spec       SubOrchestration
+	LogManager *LogManager
+}
+
+// insertSubOrchestrationSteps adds a step to the plan for every sub-orchestration, they run alongside the planned tasks
+func insertSubOrchestrationSteps(plan *ExecutionPlan, specs []SubOrchestration) *ExecutionPlan {
+	if len(specs) == 0 {
+		return plan
+	}
+
+	composed := *plan
+	composed.Tasks = append([]*SubTask{}, plan.Tasks...)
+	for _, spec := range specs {
+		composed.Tasks = append(composed.Tasks, &SubTask{
+			ID:          subOrchestrationStepPrefix + spec.ID,
+			Type:        TaskTypeOrchestration,
+			ServiceName: spec.ID,
+			Input:       map[string]any{"action": spec.Action.Content},
+		})
+	}
+	return &composed
+}
+
+func subOrchestrationFor(task *SubTask, specs []SubOrchestration) (SubOrchestration, bool) {
+	for _, spec := range specs {
+		if subOrchestrationStepPrefix+spec.ID == task.ID {
+			return spec, true
+		}
+	}
+	return SubOrchestration{}, false
+}
+
+func NewSubOrchestrationWorker(task *SubTask, spec SubOrchestration, logManager *LogManager) *SubOrchestrationWorker {
+	return &SubOrchestrationWorker{
+		TaskID:     task.ID,
+		Spec:       spec,
+		LogManager: logManager,
+	}
+}
+
+// Start launches the child orchestration and waits for it to finish, stopping the worker aborts the child
+func (s *SubOrchestrationWorker) Start(ctx context.Context, parentID string) {
+	planEngine := s.LogManager.planEngine
+	if err := planEngine.awaitDispatch(ctx, parentID); err != nil {
+		return
+	}
+
+	startedTs := time.Now().UTC()
+	if err := s.LogManager.AppendTaskStatusEvent(parentID, s.TaskID, SubOrchestrationProducerID, Processing, nil, startedTs, 0); err != nil {
+		s.LogManager.Logger.Error().Err(err).Str("OrchestrationID", parentID).Msgf("Cannot start sub-orchestration step %s", s.TaskID)
+		return
+	}
+	if err := s.LogManager.MarkTask(parentID, s.TaskID, Processing, startedTs); err != nil {
+		s.LogManager.Logger.Error().Err(err).Str("OrchestrationID", parentID).Msgf("Cannot start sub-orchestration step %s", s.TaskID)
+		return
+	}
+
+	child, err := planEngine.launchSubOrchestration(ctx, parentID, s.TaskID, s.Spec)
+	if err != nil {
+		s.fail(parentID, err)
+		return
+	}
+
+	output, err := planEngine.awaitSubOrchestration(ctx, child)
+	if ctx.Err() != nil {
+		if _, err := planEngine.AbortOrchestration(child.ID, fmt.Sprintf("parent orchestration %s stopped", parentID)); err != nil {
+			s.LogManager.Logger.Debug().Err(err).Str("OrchestrationID", child.ID).Msg("Sub-orchestration was not aborted")
+		}
+		return
+	}
+	if err != nil {
+		s.fail(parentID, err)
+		return
+	}
+
+	s.LogManager.AppendToLog(parentID, "task_output", s.TaskID, output, SubOrchestrationProducerID, 0)
+	completedTs := time.Now().UTC()
+	if err := s.LogManager.AppendTaskStatusEvent(parentID, s.TaskID, SubOrchestrationProducerID, Completed, nil, completedTs, 0); err != nil {
+		s.LogManager.Logger.Error().Err(err).Str("OrchestrationID", parentID).Msgf("Cannot complete sub-orchestration step %s", s.TaskID)
+		return
+	}
+	if err := s.LogManager.MarkTaskCompleted(parentID, s.TaskID, completedTs); err != nil {
+		s.LogManager.Logger.Error().Err(err).Str("OrchestrationID", parentID).Msgf("Cannot complete sub-orchestration step %s", s.TaskID)
+	}
+}
+
+func (s *SubOrchestrationWorker) fail(parentID string, err error) {
+	s.LogManager.Logger.Error().Err(err).Str("OrchestrationID", parentID).Msgf("Sub-orchestration step %s failed", s.TaskID)
+
+	failedTs := time.Now().UTC()
+	if err := s.LogManager.AppendTaskStatusEvent(parentID, s.TaskID, SubOrchestrationProducerID, Failed, err, failedTs, 0); err != nil {
+		return
+	}
+	if err := s.LogManager.MarkTask(parentID, s.TaskID, Failed, failedTs); err != nil {
+		return
+	}
+	_ = s.LogManager.AppendTaskFailureToLog(parentID, s.TaskID, SubOrchestrationProducerID, err.Error(), 0, false)
+}
+
+// launchSubOrchestration prepares and starts a child orchestration. Children run outside the project's
+// concurrency limit, their parent already holds a slot and waiting on the queue could deadlock it.
+func (p *PlanEngine) launchSubOrchestration(ctx context.Context, parentID, taskID string, spec SubOrchestration) (*Orchestration, error) {
+	parent, err := p.getOrchestration(parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.orchestrationStoreMu.RLock()
+	child := &Orchestration{
+		ID:                     p.GenerateOrchestrationKey(),
+		ParentID:               parentID,
+		Action:                 spec.Action,
+		Params:                 spec.Params,
+		Webhook:                parent.Webhook,
+		Priority:               parent.Priority,
+		Timeout:                parent.Timeout,
+		HealthCheckGracePeriod: parent.HealthCheckGracePeriod,
+		OrchestrationTimeout:   parent.OrchestrationTimeout,
+		TaskExecutionTimeout:   parent.TaskExecutionTimeout,
+		RetryPolicy:            parent.RetryPolicy,
+	}
+	p.orchestrationStoreMu.RUnlock()
+
+	if err := p.linkSubOrchestration(parent, OrchestrationLink{ID: child.ID, TaskID: taskID}); err != nil {
+		return nil, err
+	}
+
+	if err := p.PrepareOrchestration(ctx, parent.ProjectID, child, p.GetGroundingSpecs(parent.ProjectID)); err != nil {
+		return nil, fmt.Errorf("sub-orchestration %s cannot be executed: %w", spec.ID, err)
+	}
+
+	// The child outlives its step's worker until it's aborted, so it's not tied to the worker's context
+	go p.ExecuteOrchestration(context.WithoutCancel(ctx), child)
+	return child, nil
+}
+
+func (p *PlanEngine) linkSubOrchestration(parent *Orchestration, link OrchestrationLink) error {
+	p.orchestrationStoreMu.Lock()
+	defer p.orchestrationStoreMu.Unlock()
+
+	parent.Children = append(parent.Children, link)
+	if err := p.orchestrationStorage.StoreOrchestration(parent); err != nil {
+		return fmt.Errorf("failed to persist orchestration state: %w", err)
+	}
+	return nil
+}
+
+// awaitSubOrchestration waits for a child orchestration to finish, returning its results as the step's output
+func (p *PlanEngine) awaitSubOrchestration(ctx context.Context, child *Orchestration) (json.RawMessage, error) {
+	ticker := time.NewTicker(subOrchestrationPollingRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.orchestrationStoreMu.RLock()
+			status, results, reason := child.Status, child.Results, child.Error
+			p.orchestrationStoreMu.RUnlock()
+
+			if !orchestrationFinished(status) {
+				continue
+			}
+			if status != Completed {
+				return nil, fmt.Errorf("sub-orchestration %s finished with status %s: %s", child.ID, status.String(), string(reason))
+			}
+
+			return json.Marshal(struct {
+				OrchestrationID string            `json:"orchestrationId"`
+				Results         []json.RawMessage `json:"results"`
+			}{
+				OrchestrationID: child.ID,
+				Results:         results,
+			})
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertSubOrchestrationSteps(t *testing.T) {
+	plan := &ExecutionPlan{
+		ProjectID: "p_test",
+		Tasks:     []*SubTask{{ID: "task1", Service: "s_echo", Input: map[string]any{"message": "$task0.message"}}},
+	}
+
+	composed := insertSubOrchestrationSteps(plan, []SubOrchestration{{ID: "notify", Action: Action{Content: "Notify the customer"}}})
+
+	require.Len(t, composed.Tasks, 2)
+	step := composed.Tasks[1]
+	assert.Equal(t, "orchestration_notify", step.ID)
+	assert.Equal(t, TaskTypeOrchestration, step.Type)
+	assert.Empty(t, step.extractDependencies())
+	assert.Len(t, plan.Tasks, 1, "the planned tasks are left untouched")
+
+	spec, ok := subOrchestrationFor(step, []SubOrchestration{{ID: "notify"}})
+	assert.True(t, ok)
+	assert.Equal(t, "notify", spec.ID)
+
+	assert.Same(t, plan, insertSubOrchestrationSteps(plan, nil))
+}
+
+func TestAwaitSubOrchestration(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	parent := &Orchestration{
+		ID:        app.Engine.GenerateOrchestrationKey(),
+		ProjectID: project.ID,
+		Plan:      &ExecutionPlan{ProjectID: project.ID, Tasks: []*SubTask{{ID: "orchestration_notify", Type: TaskTypeOrchestration, ServiceName: "notify"}}},
+		Status:    Processing,
+		TaskZero:  json.RawMessage(`{}`),
+	}
+	app.Engine.orchestrationStore[parent.ID] = parent
+	app.Engine.LogManager.PrepLogForOrchestration(project.ID, parent.ID, parent.Plan)
+	newChild := func() *Orchestration {
+		child := &Orchestration{ID: app.Engine.GenerateOrchestrationKey(), ProjectID: project.ID, ParentID: parent.ID, Status: Processing}
+		app.Engine.orchestrationStoreMu.Lock()
+		app.Engine.orchestrationStore[child.ID] = child
+		app.Engine.orchestrationStoreMu.Unlock()
+		require.NoError(t, app.Engine.linkSubOrchestration(parent, OrchestrationLink{ID: child.ID, TaskID: "orchestration_notify"}))
+		return child
+	}
+
+	t.Run("completed children return their results", func(t *testing.T) {
+		child := newChild()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = app.Engine.FinalizeOrchestration(child.ID, Completed, nil, []json.RawMessage{json.RawMessage(`{"sent":true}`)}, true)
+		}()
+
+		output, err := app.Engine.awaitSubOrchestration(context.Background(), child)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"orchestrationId":"`+child.ID+`","results":[{"sent":true}]}`, string(output))
+	})
+
+	t.Run("unsuccessful children fail the step", func(t *testing.T) {
+		child := newChild()
+		require.NoError(t, app.Engine.FinalizeOrchestration(child.ID, Failed, json.RawMessage(`"no service"`), nil, true))
+
+		_, err := app.Engine.awaitSubOrchestration(context.Background(), child)
+		assert.ErrorContains(t, err, "no service")
+	})
+
+	inspection, err := app.Engine.InspectOrchestration(parent.ID)
+	require.NoError(t, err)
+	require.Len(t, inspection.Children, 2)
+	require.Len(t, inspection.Tasks, 1)
+	assert.Equal(t, inspection.Children[1].ID, inspection.Tasks[0].ChildID, "steps link to their latest child")
+
+	child, err := app.Engine.InspectOrchestration(inspection.Children[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, parent.ID, child.ParentID)
+}
@@ -167,3 +167,15 @@ func (b *BadgerDB) ListServices() ([]*ServiceInfo, error) {
 
 	return services, nil
 }
+
+func (b *BadgerDB) DeleteService(projectID, serviceID string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete([]byte(fmt.Sprintf("service:info:%s", serviceID))); err != nil {
+			return fmt.Errorf("failed to delete service: %w", err)
+		}
+		if err := txn.Delete([]byte(fmt.Sprintf("service:project:%s:%s", projectID, serviceID))); err != nil {
+			return fmt.Errorf("failed to delete project service index: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,171 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var taskGraphIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// PlannedTask is a task of an execution plan supplied with the orchestration request. Inputs are literal
+// values or references to action params ($task0.<field>) and to other tasks' outputs ($<task>.<field>).
+type PlannedTask struct {
+	ID      string         `json:"id"`
+	Service string         `json:"service"`
+	Input   map[string]any `json:"input"`
+	// DependsOn lists tasks that must complete first, without any of their output being used
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// validateTaskGraph checks a supplied plan's tasks are uniquely named and only reference action params and
+// other tasks of the graph, without any cycles.
+func validateTaskGraph(graph []PlannedTask, params ActionParams) error {
+	fields := make(map[string]struct{}, len(params))
+	for _, param := range params {
+		fields[param.Field] = struct{}{}
+	}
+
+	tasks := make(map[string]PlannedTask, len(graph))
+	for i, task := range graph {
+		switch {
+		case !taskGraphIDPattern.MatchString(task.ID):
+			return fmt.Errorf("tasks[%d]: id must consist of letters, digits, '-' or '_'", i)
+		case strings.EqualFold(task.ID, TaskZero):
+			return fmt.Errorf("tasks[%d]: id %s is reserved for the action params", i, TaskZero)
+		case strings.HasPrefix(task.ID, approvalStepPrefix), strings.HasPrefix(task.ID, subOrchestrationStepPrefix):
+			return fmt.Errorf("tasks[%d]: id %s uses a reserved prefix", i, task.ID)
+		case strings.TrimSpace(task.Service) == "":
+			return fmt.Errorf("tasks[%d]: service is required", i)
+		}
+		if _, exists := tasks[task.ID]; exists {
+			return fmt.Errorf("tasks[%d]: id %s is not unique", i, task.ID)
+		}
+		tasks[task.ID] = task
+	}
+
+	dependencies := make(map[string][]string, len(graph))
+	for _, task := range graph {
+		for inputKey, value := range task.Input {
+			dep, key := extractDependencyIDAndKey(value)
+			switch {
+			case dep == "":
+				continue
+			case dep == TaskZero:
+				if _, exists := fields[rootField(key)]; !exists {
+					return fmt.Errorf("task %s input %s references unknown action param %s", task.ID, inputKey, key)
+				}
+				continue
+			case dep == task.ID:
+				return fmt.Errorf("task %s input %s references its own output", task.ID, inputKey)
+			}
+			if _, err := parseFieldPath(key); err != nil {
+				return fmt.Errorf("task %s input %s: %w", task.ID, inputKey, err)
+			}
+			if _, exists := tasks[dep]; !exists {
+				return fmt.Errorf("task %s input %s references unknown task %s", task.ID, inputKey, dep)
+			}
+			dependencies[task.ID] = append(dependencies[task.ID], dep)
+		}
+		for _, dep := range task.DependsOn {
+			if _, exists := tasks[dep]; !exists || dep == task.ID {
+				return fmt.Errorf("task %s depends on unknown task %s", task.ID, dep)
+			}
+			dependencies[task.ID] = append(dependencies[task.ID], dep)
+		}
+	}
+
+	return checkTaskGraphAcyclic(graph, dependencies)
+}
+
+func checkTaskGraphAcyclic(graph []PlannedTask, dependencies map[string][]string) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(graph))
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("task %s is part of a dependency cycle", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, dep := range dependencies[id] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+
+	for _, task := range graph {
+		if err := visit(task.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareTaskGraph builds the execution plan from the orchestration's supplied task graph, in place of
+// decomposing its action. Literal inputs are moved into task zero, like the inputs of decomposed plans.
+func (p *PlanEngine) prepareTaskGraph(orchestration *Orchestration, services []*ServiceInfo) error {
+	tasks := make([]*SubTask, 0, len(orchestration.TaskGraph))
+	for _, planned := range orchestration.TaskGraph {
+		input := make(map[string]any, len(planned.Input))
+		for key, value := range planned.Input {
+			input[key] = value
+		}
+		tasks = append(tasks, &SubTask{ID: planned.ID, Service: planned.Service, Input: input, DependsOn: planned.DependsOn})
+	}
+
+	if err := p.validateSubTaskInputs(services, tasks); err != nil {
+		return fmt.Errorf("task graph failed validation: %w", err)
+	}
+	if err := p.enhanceWithServiceDetails(services, tasks); err != nil {
+		return fmt.Errorf("error enhancing task graph with service details: %w", err)
+	}
+
+	taskZero := make(map[string]any, len(orchestration.Params))
+	for _, param := range orchestration.Params {
+		taskZero[param.Field] = param.Value
+	}
+	for _, task := range tasks {
+		for inputKey, value := range task.Input {
+			if dep, _ := extractDependencyIDAndKey(value); dep != "" {
+				continue
+			}
+			field := fmt.Sprintf("%s_%s", task.ID, inputKey)
+			if _, exists := taskZero[field]; exists {
+				return fmt.Errorf("task graph input %s clashes with an action param of the same name", field)
+			}
+			taskZero[field] = value
+			task.Input[inputKey] = fmt.Sprintf("$%s.%s", TaskZero, field)
+		}
+	}
+
+	plan := composeExecutionPlan(&ExecutionPlan{ProjectID: orchestration.ProjectID, Tasks: tasks}, orchestration)
+	if err := validatePlanAgainstSchemas(plan, taskZero, services); err != nil {
+		return fmt.Errorf("task graph failed schema validation: %w", err)
+	}
+
+	taskZeroInput, err := json.Marshal(taskZero)
+	if err != nil {
+		return fmt.Errorf("failed to convert task zero to raw JSON: %w", err)
+	}
+
+	orchestration.Plan = plan
+	orchestration.TaskZero = taskZeroInput
+	return nil
+}
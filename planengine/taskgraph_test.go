@@ -0,0 +1,144 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTaskGraph(t *testing.T) {
+	params := ActionParams{{Field: "orderId", Value: "o-1"}}
+
+	tests := []struct {
+		name    string
+		graph   []PlannedTask
+		wantErr string
+	}{
+		{
+			name: "valid graph",
+			graph: []PlannedTask{
+				{ID: "lookup", Service: "s_orders", Input: map[string]any{"id": "$task0.orderId"}},
+				{ID: "notify", Service: "s_notify", Input: map[string]any{"email": "$lookup.email", "channel": "email"}},
+				{ID: "audit", Service: "s_audit", DependsOn: []string{"notify"}},
+			},
+		},
+		{
+			name:    "invalid id",
+			graph:   []PlannedTask{{ID: "look up", Service: "s_orders"}},
+			wantErr: "tasks[0]: id must consist of",
+		},
+		{
+			name:    "reserved task zero id",
+			graph:   []PlannedTask{{ID: "task0", Service: "s_orders"}},
+			wantErr: "reserved for the action params",
+		},
+		{
+			name:    "reserved prefix",
+			graph:   []PlannedTask{{ID: "approval_lookup", Service: "s_orders"}},
+			wantErr: "reserved prefix",
+		},
+		{
+			name:    "missing service",
+			graph:   []PlannedTask{{ID: "lookup"}},
+			wantErr: "service is required",
+		},
+		{
+			name: "duplicate id",
+			graph: []PlannedTask{
+				{ID: "lookup", Service: "s_orders"},
+				{ID: "lookup", Service: "s_audit"},
+			},
+			wantErr: "tasks[1]: id lookup is not unique",
+		},
+		{
+			name:    "unknown action param",
+			graph:   []PlannedTask{{ID: "lookup", Service: "s_orders", Input: map[string]any{"id": "$task0.customerId"}}},
+			wantErr: "unknown action param customerId",
+		},
+		{
+			name:    "unknown task",
+			graph:   []PlannedTask{{ID: "notify", Service: "s_notify", Input: map[string]any{"email": "$lookup.email"}}},
+			wantErr: "unknown task lookup",
+		},
+		{
+			name:    "own output",
+			graph:   []PlannedTask{{ID: "lookup", Service: "s_orders", Input: map[string]any{"id": "$lookup.id"}}},
+			wantErr: "references its own output",
+		},
+		{
+			name:    "unknown dependency",
+			graph:   []PlannedTask{{ID: "audit", Service: "s_audit", DependsOn: []string{"notify"}}},
+			wantErr: "depends on unknown task notify",
+		},
+		{
+			name: "cycle",
+			graph: []PlannedTask{
+				{ID: "a", Service: "s_orders", Input: map[string]any{"id": "$c.id"}},
+				{ID: "b", Service: "s_orders", Input: map[string]any{"id": "$a.id"}},
+				{ID: "c", Service: "s_orders", DependsOn: []string{"b"}},
+			},
+			wantErr: "dependency cycle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTaskGraph(tt.graph, params)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPrepareTaskGraph(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	services := []*ServiceInfo{
+		fakeService("s_orders", []string{"id", "region"}),
+		fakeService("s_notify", []string{"email"}),
+		fakeService("s_audit", nil),
+	}
+
+	orchestration := &Orchestration{
+		ProjectID: project.ID,
+		Action:    Action{Content: "Notify the customer of their order"},
+		Params:    ActionParams{{Field: "orderId", Value: "o-1"}},
+		TaskGraph: []PlannedTask{
+			{ID: "lookup", Service: "s_orders", Input: map[string]any{"id": "$task0.orderId", "region": "eu"}},
+			{ID: "notify", Service: "s_notify", Input: map[string]any{"email": "$lookup.email"}},
+			{ID: "audit", Service: "s_audit", Input: map[string]any{}, DependsOn: []string{"notify"}},
+		},
+	}
+
+	require.NoError(t, app.Engine.prepareTaskGraph(orchestration, services))
+	require.Len(t, orchestration.Plan.Tasks, 3)
+
+	lookup := orchestration.Plan.Tasks[0]
+	assert.Equal(t, "$task0.orderId", lookup.Input["id"])
+	assert.Equal(t, "$task0.lookup_region", lookup.Input["region"])
+	assert.Equal(t, "eu", orchestration.TaskGraph[0].Input["region"], "the submitted graph is left untouched")
+
+	var taskZero map[string]any
+	require.NoError(t, json.Unmarshal(orchestration.TaskZero, &taskZero))
+	assert.Equal(t, map[string]any{"orderId": "o-1", "lookup_region": "eu"}, taskZero)
+
+	assert.Contains(t, orchestration.Plan.Tasks[2].extractDependencies(), "notify")
+
+	orchestration.TaskGraph[1].Input = map[string]any{"email": "$lookup.email", "subject": "Your order"}
+	err := app.Engine.prepareTaskGraph(orchestration, services)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "input subject not supported by service s_notify")
+}
@@ -0,0 +1,253 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+const (
+	// WSTaskLog carries log lines a service wrote while executing an orchestration's tasks
+	WSTaskLog = "task_log"
+	// maxTaskLogLines and maxTaskLogMessageBytes bound what's kept from a single task_log message
+	maxTaskLogLines        = 100
+	maxTaskLogMessageBytes = 8 * 1024
+	defaultTaskLogsLimit   = 500
+	maxTaskLogsLimit       = 5000
+)
+
+const (
+	TaskLogDebug = "debug"
+	TaskLogInfo  = "info"
+	TaskLogWarn  = "warn"
+	TaskLogError = "error"
+)
+
+var taskLogSeverity = map[string]int{
+	TaskLogDebug: 0,
+	TaskLogInfo:  1,
+	TaskLogWarn:  2,
+	TaskLogError: 3,
+}
+
+// TaskLog is a line a service logged while executing one of an orchestration's tasks
+type TaskLog struct {
+	ID              string          `json:"id"`
+	OrchestrationID string          `json:"orchestrationId"`
+	TaskID          string          `json:"taskId,omitempty"`
+	ServiceID       string          `json:"serviceId"`
+	InstanceID      string          `json:"instanceId,omitempty"`
+	Level           string          `json:"level"`
+	Message         string          `json:"message"`
+	Fields          json.RawMessage `json:"fields,omitempty"`
+	Timestamp       time.Time       `json:"timestamp"`
+}
+
+// TaskLogStorage keeps the log lines services stream for an orchestration's tasks
+type TaskLogStorage interface {
+	StoreTaskLogs(logs []TaskLog) error
+	ListTaskLogs(orchestrationID string) ([]TaskLog, error)
+	DeleteTaskLogs(orchestrationID string) error
+}
+
+// taskLogMessage is a batch of log lines, lines without their own orchestration or task IDs belong to the batch's
+type taskLogMessage struct {
+	Type            string    `json:"type"`
+	OrchestrationID string    `json:"orchestrationId"`
+	TaskID          string    `json:"taskId"`
+	Logs            []TaskLog `json:"logs"`
+}
+
+// normaliseTaskLogLevel lowercases a level, unknown levels are logged as info
+func normaliseTaskLogLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level == "warning" {
+		return TaskLogWarn
+	}
+	if _, ok := taskLogSeverity[level]; !ok {
+		return TaskLogInfo
+	}
+	return level
+}
+
+// handleTaskLogs passes on the log lines a service sent, they're recorded as the connection's service's lines
+func (wsm *WebSocketManager) handleTaskLogs(s serviceSession, serviceID string, payload json.RawMessage) {
+	var message taskLogMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		wsm.logger.Error().Err(err).Msg("Failed to unmarshal task logs")
+		return
+	}
+
+	wsm.UpdateServiceHealth(serviceID, true)
+	if len(message.Logs) > maxTaskLogLines {
+		wsm.logger.Warn().
+			Str("ServiceID", serviceID).
+			Int("Lines", len(message.Logs)).
+			Msgf("Dropped task log lines over the %d line limit", maxTaskLogLines)
+		message.Logs = message.Logs[:maxTaskLogLines]
+	}
+
+	for i := range message.Logs {
+		line := &message.Logs[i]
+		if line.OrchestrationID == "" {
+			line.OrchestrationID = message.OrchestrationID
+		}
+		if line.TaskID == "" {
+			line.TaskID = message.TaskID
+		}
+		if len(line.Message) > maxTaskLogMessageBytes {
+			line.Message = line.Message[:maxTaskLogMessageBytes]
+		}
+	}
+
+	if wsm.onTaskLogs != nil {
+		wsm.onTaskLogs(serviceID, sessionInstanceID(s), message.Logs)
+	}
+}
+
+// recordTaskLogs stores the log lines a service sent, dropping those about orchestrations outside its project
+func (p *PlanEngine) recordTaskLogs(serviceID, instanceID string, logs []TaskLog) {
+	if p.TaskLogs == nil || len(logs) == 0 {
+		return
+	}
+
+	projectID, err := p.GetProjectIDForService(serviceID)
+	if err != nil {
+		p.Logger.Warn().Err(err).Str("ServiceID", serviceID).Msg("Dropped task logs from an unknown service")
+		return
+	}
+
+	now := time.Now().UTC()
+	kept := make([]TaskLog, 0, len(logs))
+	for _, line := range logs {
+		if line.OrchestrationID == "" || !p.OrchestrationBelongsToProject(line.OrchestrationID, projectID) {
+			p.Logger.Warn().
+				Str("ServiceID", serviceID).
+				Str("OrchestrationID", line.OrchestrationID).
+				Msg("Dropped task log for an orchestration outside the service's project")
+			continue
+		}
+
+		line.ID = fmt.Sprintf("tl_%s", short.New())
+		line.ServiceID = serviceID
+		line.InstanceID = instanceID
+		line.Level = normaliseTaskLogLevel(line.Level)
+		if line.Timestamp.IsZero() {
+			line.Timestamp = now
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	if err := p.TaskLogs.StoreTaskLogs(kept); err != nil {
+		p.Logger.Error().Err(err).Str("ServiceID", serviceID).Msg("Failed to store task logs")
+	}
+}
+
+// TaskLogFilter narrows an orchestration's logs to a task and to lines at or above a level
+type TaskLogFilter struct {
+	TaskID string
+	Level  string
+	Limit  int
+}
+
+// OrchestrationLogs returns an orchestration's task logs matching the filter in the order they were logged,
+// keeping the latest lines when there are more than the limit
+func (p *PlanEngine) OrchestrationLogs(orchestrationID string, filter TaskLogFilter) ([]TaskLog, error) {
+	if p.TaskLogs == nil {
+		return []TaskLog{}, nil
+	}
+
+	logs, err := p.TaskLogs.ListTaskLogs(orchestrationID)
+	if err != nil {
+		return nil, errs.E(errs.Internal, err)
+	}
+
+	minSeverity := taskLogSeverity[filter.Level]
+	matched := make([]TaskLog, 0, len(logs))
+	for _, line := range logs {
+		if filter.TaskID != "" && line.TaskID != filter.TaskID {
+			continue
+		}
+		if taskLogSeverity[line.Level] < minSeverity {
+			continue
+		}
+		matched = append(matched, line)
+	}
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+	return matched, nil
+}
+
+func parseTaskLogFilter(r *http.Request) (TaskLogFilter, error) {
+	query := r.URL.Query()
+	filter := TaskLogFilter{TaskID: query.Get("task"), Limit: defaultTaskLogsLimit}
+
+	if level := query.Get("level"); level != "" {
+		level = strings.ToLower(level)
+		if _, ok := taskLogSeverity[level]; !ok {
+			return filter, errs.E(errs.Validation, errs.Parameter("level"), "level must be one of debug, info, warn or error")
+		}
+		filter.Level = level
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxTaskLogsLimit {
+			return filter, errs.E(errs.Validation, errs.Parameter("limit"), fmt.Sprintf("limit must be between 1 and %d", maxTaskLogsLimit))
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// OrchestrationLogsHandler returns the logs services streamed while executing one of the project's orchestrations
+func (app *App) OrchestrationLogsHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	orchestrationID := mux.Vars(r)["id"]
+	if !app.Engine.OrchestrationBelongsToProject(orchestrationID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
+		return
+	}
+
+	filter, err := parseTaskLogFilter(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	logs, err := app.Engine.OrchestrationLogs(orchestrationID, filter)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(logs); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
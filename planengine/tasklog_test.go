@@ -0,0 +1,111 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskLogCollection(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.Engine.TaskLogs = app.Db
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.onTaskLogs = app.Engine.recordTaskLogs
+	app.Engine.WebSocketManager = wsm
+
+	service := &ServiceInfo{ID: "s_payments", Name: "Payments", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+	app.Engine.orchestrationStore["o_logs"] = &Orchestration{ID: "o_logs", ProjectID: project.ID, Status: Processing}
+	app.Engine.orchestrationStore["o_foreign"] = &Orchestration{ID: "o_foreign", ProjectID: "p_other", Status: Processing}
+
+	s := &callbackSession{wsm: wsm, serviceID: service.ID, outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	s.Set("serviceID", service.ID)
+	s.Set(WSInstanceQueryParam, "i_1")
+	stream := func(payload map[string]any) {
+		message, _ := json.Marshal(map[string]any{"id": "m_log", "payload": payload})
+		wsm.HandleMessage(s, message, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	}
+
+	start := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	stream(map[string]any{
+		"type": WSTaskLog, "serviceId": "s_impersonated", "orchestrationId": "o_logs", "taskId": "task1",
+		"logs": []map[string]any{
+			{"level": "debug", "message": "charging card", "timestamp": start},
+			{"level": "WARNING", "message": "gateway slow", "fields": map[string]any{"latencyMs": 900}, "timestamp": start.Add(time.Second)},
+			{"level": "error", "message": strings.Repeat("x", maxTaskLogMessageBytes+10), "taskId": "task2", "timestamp": start.Add(2 * time.Second)},
+		},
+	})
+	stream(map[string]any{
+		"type": WSTaskLog, "serviceId": service.ID, "orchestrationId": "o_foreign", "taskId": "task1",
+		"logs": []map[string]any{{"level": "info", "message": "not ours"}},
+	})
+
+	getLogs := func(query string) (int, []TaskLog) {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/o_logs/logs"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+
+		var logs []TaskLog
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&logs))
+		}
+		return rr.Code, logs
+	}
+
+	t.Run("stores streamed lines in the order they were logged", func(t *testing.T) {
+		code, logs := getLogs("")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, logs, 3)
+
+		assert.Equal(t, "charging card", logs[0].Message)
+		assert.Equal(t, TaskLogDebug, logs[0].Level)
+		assert.Equal(t, "task1", logs[0].TaskID)
+		assert.Equal(t, service.ID, logs[0].ServiceID, "lines are from the connection's service, not the one claimed")
+		assert.Equal(t, "i_1", logs[0].InstanceID)
+		assert.NotEmpty(t, logs[0].ID)
+		assert.Equal(t, TaskLogWarn, logs[1].Level)
+		assert.JSONEq(t, `{"latencyMs":900}`, string(logs[1].Fields))
+		assert.Equal(t, "task2", logs[2].TaskID, "lines can override the batch's task")
+		assert.Len(t, logs[2].Message, maxTaskLogMessageBytes)
+	})
+
+	t.Run("filters by level and task", func(t *testing.T) {
+		_, logs := getLogs("?level=warn")
+		assert.Len(t, logs, 2)
+
+		_, logs = getLogs("?level=warn&task=task1")
+		require.Len(t, logs, 1)
+		assert.Equal(t, "gateway slow", logs[0].Message)
+
+		_, logs = getLogs("?limit=1")
+		require.Len(t, logs, 1)
+		assert.Equal(t, "task2", logs[0].TaskID, "the latest lines are kept")
+	})
+
+	t.Run("rejects unknown levels", func(t *testing.T) {
+		code, _ := getLogs("?level=verbose")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("drops lines about other projects' orchestrations", func(t *testing.T) {
+		logs, err := app.Db.ListTaskLogs("o_foreign")
+		require.NoError(t, err)
+		assert.Empty(t, logs)
+	})
+}
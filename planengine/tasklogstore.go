@@ -0,0 +1,71 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const taskLogKeyPrefix = "tasklog:"
+
+// taskLogKey orders an orchestration's logs by when they were logged
+func taskLogKey(line TaskLog) []byte {
+	return []byte(fmt.Sprintf("%s%s:%020d:%s", taskLogKeyPrefix, line.OrchestrationID, line.Timestamp.UnixNano(), line.ID))
+}
+
+// StoreTaskLogs persists task log lines for TaskLogRetention, they're encrypted like orchestration payloads
+func (b *BadgerDB) StoreTaskLogs(logs []TaskLog) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		for _, line := range logs {
+			data, err := b.encodePayload(line)
+			if err != nil {
+				return fmt.Errorf("failed to marshal task log: %w", err)
+			}
+			if err := txn.SetEntry(badger.NewEntry(taskLogKey(line), data).WithTTL(TaskLogRetention)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BadgerDB) ListTaskLogs(orchestrationID string) ([]TaskLog, error) {
+	var logs []TaskLog
+	prefix := []byte(fmt.Sprintf("%s%s:", taskLogKeyPrefix, orchestrationID))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var line TaskLog
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &line)
+			}); err != nil {
+				return fmt.Errorf("failed to load task log %s: %w", it.Item().Key(), err)
+			}
+			logs = append(logs, line)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (b *BadgerDB) DeleteTaskLogs(orchestrationID string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return deletePrefix(txn, []byte(fmt.Sprintf("%s%s:", taskLogKeyPrefix, orchestrationID)))
+	})
+}
@@ -0,0 +1,72 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	InvalidTaskInputCode  = "INVALID_TASK_INPUT"
+	InvalidTaskOutputCode = "INVALID_TASK_OUTPUT"
+	// maxReportedSchemaViolations caps the violations a failed task's error lists
+	maxReportedSchemaViolations = 20
+)
+
+// SchemaViolations are the details of a task failed for a value not matching its service's schema
+type SchemaViolations struct {
+	Violations []string `json:"violations"`
+}
+
+// checkTaskValue checks a task input or output against the service's schema for it. Mismatches fail the task with
+// a terminal TaskError listing them, retrying the task with the same value can't fix it.
+func checkTaskValue(service *ServiceInfo, spec Spec, value json.RawMessage, kind, code string) error {
+	// Services registered before schemas were required may not have one
+	if spec.Type == "" {
+		return nil
+	}
+
+	var decoded any
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return taskSchemaError(service, kind, code, []string{fmt.Sprintf("%s: is not valid JSON", kind)})
+	}
+	violations := checkValueAgainstSpec(kind, decoded, spec)
+	if len(violations) == 0 {
+		return nil
+	}
+	return taskSchemaError(service, kind, code, violations)
+}
+
+func taskSchemaError(service *ServiceInfo, kind, code string, violations []string) *TaskError {
+	message := fmt.Sprintf("task %s does not match the %s schema of service %s: %s", kind, kind, service.Name, violations[0])
+	if len(violations) > 1 {
+		message += fmt.Sprintf(" (and %d more)", len(violations)-1)
+	}
+	if len(violations) > maxReportedSchemaViolations {
+		violations = violations[:maxReportedSchemaViolations]
+	}
+	details, _ := json.Marshal(SchemaViolations{Violations: violations})
+
+	retryable := false
+	return &TaskError{Code: code, Message: message, Retryable: &retryable, Details: details}
+}
+
+// checkTaskInput checks the input the task is about to be dispatched with against its service's input schema
+func (w *TaskWorker) checkTaskInput() error {
+	input, err := mergeValueMapsToJson(w.logState.DependencyState, w.Dependencies)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+	return checkTaskValue(w.Service, w.Service.Schema.Input, input, "input", InvalidTaskInputCode)
+}
+
+// checkTaskOutput checks a task's result against its service's output schema, before it's passed to the tasks
+// depending on it
+func (w *TaskWorker) checkTaskOutput(output json.RawMessage) error {
+	return checkTaskValue(w.Service, w.Service.Schema.Output, output, "output", InvalidTaskOutputCode)
+}
@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lookupSchema = ServiceSchema{
+	Input: Spec{Type: "object", Required: []string{"sku"}, Properties: map[string]Spec{
+		"sku":      {Type: "string"},
+		"quantity": {Type: "integer", Minimum: 1},
+	}},
+	Output: Spec{Type: "object", Required: []string{"price"}, Properties: map[string]Spec{
+		"price": {Type: "number"},
+		"note":  {Type: "string"},
+	}},
+}
+
+func TestCheckTaskValue(t *testing.T) {
+	service := &ServiceInfo{ID: "s_lookup", Name: "lookup", Schema: lookupSchema}
+	check := func(value string) error {
+		return checkTaskValue(service, lookupSchema.Input, json.RawMessage(value), "input", InvalidTaskInputCode)
+	}
+
+	assert.NoError(t, check(`{"sku":"a1","quantity":2,"extra":true}`))
+	assert.NoError(t, check(`{"sku":"a1","quantity":null}`), "optional fields may be null")
+	assert.NoError(t, checkTaskValue(service, Spec{}, json.RawMessage(`"anything"`), "input", InvalidTaskInputCode),
+		"services without a schema aren't checked")
+
+	err := check(`{"quantity":0.5}`)
+	var taskErr *TaskError
+	require.True(t, errors.As(err, &taskErr))
+	assert.Equal(t, InvalidTaskInputCode, taskErr.Code)
+	assert.False(t, resolveRetryPolicy(nil, nil).Retryable(err), "schema violations are terminal")
+	assert.Contains(t, taskErr.Message, "service lookup")
+	assert.Contains(t, taskErr.Message, "(and 1 more)")
+
+	var details SchemaViolations
+	require.NoError(t, json.Unmarshal(taskErr.Details, &details))
+	assert.Equal(t, []string{"input.sku: is required", "input.quantity: expected integer, got number"}, details.Violations)
+
+	require.True(t, errors.As(check(`[]`), &taskErr))
+	assert.Equal(t, []string{"input: expected object, got array"}, mustViolations(t, taskErr))
+}
+
+func TestTaskWorkerEnforcesSchemas(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+
+	service := &ServiceInfo{ID: "s_lookup", Name: "lookup", ProjectID: project.ID, Version: 1, Schema: lookupSchema, Cache: &ResultCachePolicy{TTL: Duration{time.Hour}}}
+	worker := NewTaskWorker(service, "task1", TaskDependenciesWithKeys{TaskZero: {{TaskKey: "sku", DependencyKey: "sku"}}}, time.Second, 0, time.Second, resolveRetryPolicy(nil, nil), logManager).(*TaskWorker)
+
+	t.Run("inputs are checked before dispatch", func(t *testing.T) {
+		worker.logState.DependencyState[TaskZero] = json.RawMessage(`{"sku":42}`)
+		var taskErr *TaskError
+		require.True(t, errors.As(worker.checkTaskInput(), &taskErr))
+		assert.Equal(t, []string{"input.sku: expected string, got number"}, mustViolations(t, taskErr))
+
+		worker.logState.DependencyState[TaskZero] = json.RawMessage(`{"sku":"a1"}`)
+		assert.NoError(t, worker.checkTaskInput())
+	})
+
+	t.Run("invalid results are not passed along", func(t *testing.T) {
+		_, err := worker.processTaskResult("o_1", json.RawMessage(`{"task":{"price":"ten"}}`))
+		var taskErr *TaskError
+		require.True(t, errors.As(err, &taskErr))
+		assert.Equal(t, InvalidTaskOutputCode, taskErr.Code)
+		assert.Equal(t, []string{"output.price: expected number, got string"}, mustViolations(t, taskErr))
+		assert.Nil(t, logManager.GetLog("o_1"), "nothing is logged for the task's dependents")
+
+		result, err := worker.processTaskResult("o_1", json.RawMessage(`{"task":{"price":10,"note":null}}`))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"price":10,"note":null}`, string(result))
+	})
+}
+
+func mustViolations(t *testing.T, taskErr *TaskError) []string {
+	t.Helper()
+	var details SchemaViolations
+	require.NoError(t, json.Unmarshal(taskErr.Details, &details))
+	return details.Violations
+}
@@ -18,6 +18,8 @@ import (
 
 	back "github.com/cenkalti/backoff/v4"
 	short "github.com/lithammer/shortuuid/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -32,40 +34,36 @@ func (e RetryableError) Error() string {
 	return fmt.Sprintf("%v", e.Err)
 }
 
+func (e RetryableError) Unwrap() error {
+	return e.Err
+}
+
 func NewTaskWorker(
 	service *ServiceInfo,
 	taskID string,
 	dependencies TaskDependenciesWithKeys,
 	timeout time.Duration,
+	executionTimeout time.Duration,
 	healthCheckGracePeriod time.Duration,
+	retryPolicy RetryPolicy,
 	logManager *LogManager,
 ) LogWorker {
-	expBackoff := back.NewExponentialBackOff()
-
-	// Configure backoff parameters
-	expBackoff.InitialInterval = 2 * time.Second // Start with 2 seconds delay
-	expBackoff.MaxInterval = 30 * time.Second    // Cap maximum delay at 30 seconds
-	expBackoff.Multiplier = 2.0                  // Double the delay each time
-	expBackoff.RandomizationFactor = 0.1         // Add some jitter
-	expBackoff.MaxElapsedTime = 0                // Use consecutiveErrs, timeout, healthCheckGracePeriod for permanent backoff
-
-	// Reset timer to apply our changes
-	expBackoff.Reset()
-
 	return &TaskWorker{
 		Service:                service,
 		TaskID:                 taskID,
 		Dependencies:           dependencies,
 		Timeout:                timeout,
+		ExecutionTimeout:       executionTimeout,
 		HealthCheckGracePeriod: healthCheckGracePeriod,
 		LogManager:             logManager,
+		RetryPolicy:            retryPolicy,
 		logState: &LogState{
 			LastOffset:      0,
 			Processed:       make(map[string]bool),
 			DependencyState: make(map[string]json.RawMessage),
 		},
 		pauseStart: time.Time{},
-		backOff:    expBackoff,
+		backOff:    retryPolicy.backOff(),
 	}
 }
 
@@ -144,26 +142,62 @@ func (w *TaskWorker) processEntry(ctx context.Context, entry LogEntry, orchestra
 		return nil
 	}
 
+	// Paused orchestrations don't dispatch new tasks until they're resumed
+	if err := w.LogManager.planEngine.awaitDispatch(ctx, orchestrationID); err != nil {
+		w.LogManager.Logger.Info().Msgf("Task %s for orchestration %s was stopped while paused", w.TaskID, orchestrationID)
+		return nil
+	}
+
+	if skipped, err := w.skipUnlessConditionMet(orchestrationID); skipped || err != nil {
+		return err
+	}
+
 	processingTs := time.Now().UTC()
 	if err := w.LogManager.MarkTask(orchestrationID, w.TaskID, Processing, processingTs); err != nil {
 		return err
 	}
 
+	// Services upgraded past the orchestration's pinned versions are never dispatched to
+	if err := w.checkServiceVersion(orchestrationID); err != nil {
+		w.LogManager.Logger.Error().Err(err).Msgf("Cannot dispatch task %s for orchestration %s", w.TaskID, orchestrationID)
+		return w.failTask(orchestrationID, err)
+	}
+
+	// Inputs not matching the service's schema are never dispatched
+	if err := w.checkTaskInput(); err != nil {
+		w.LogManager.Logger.Error().Err(err).Msgf("Cannot dispatch task %s for orchestration %s", w.TaskID, orchestrationID)
+		return w.failTask(orchestrationID, err)
+	}
+
+	// Tasks with an execution timeout fail once it's exceeded, however many attempts they have left
+	execCtx := ctx
+	if w.ExecutionTimeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, w.ExecutionTimeout)
+		defer cancel()
+	}
+
 	// Execute our task
-	taskOutput, err := w.executeTaskWithRetry(ctx, orchestrationID)
+	taskOutput, cacheHit, err := w.executeTaskCached(execCtx, orchestrationID)
+	if errors.Is(err, context.Canceled) {
+		w.LogManager.Logger.Info().Msgf("Task %s for orchestration %s was stopped before completing", w.TaskID, orchestrationID)
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return w.timeOutTask(orchestrationID)
+	}
 	if err != nil {
 		w.LogManager.Logger.Error().Err(err).Msgf("Cannot execute task %s for orchestration %s", w.TaskID, orchestrationID)
-		failedTs := time.Now().UTC()
-		if err := w.LogManager.AppendTaskStatusEvent(orchestrationID, w.TaskID, w.Service.ID, Failed, err, failedTs, w.consecutiveErrs); err != nil {
-			return err
-		}
-		if err := w.LogManager.MarkTask(orchestrationID, w.TaskID, Failed, failedTs); err != nil {
-			return err
-		}
-		return w.LogManager.AppendTaskFailureToLog(orchestrationID, w.TaskID, w.Service.ID, err.Error(), w.consecutiveErrs, false)
+		return w.failTask(orchestrationID, err)
 	}
 
-	if err := w.processTaskResult(orchestrationID, taskOutput); err != nil {
+	result, err := w.processTaskResult(orchestrationID, taskOutput)
+	var taskErr *TaskError
+	if errors.As(err, &taskErr) {
+		w.LogManager.Logger.Error().Err(err).Msgf("Task %s for orchestration %s returned an invalid result", w.TaskID, orchestrationID)
+		return w.failTask(orchestrationID, err)
+	}
+	if err != nil {
 		w.LogManager.Logger.Error().Err(err).Msgf("Cannot process task %s result for orchestration %s", w.TaskID, orchestrationID)
 		return w.LogManager.AppendTaskFailureToLog(
 			orchestrationID,
@@ -179,7 +213,13 @@ func (w *TaskWorker) processEntry(ctx context.Context, entry LogEntry, orchestra
 	w.logState.Processed[entry.GetID()] = true
 
 	completedTs := time.Now().UTC()
-	if err = w.LogManager.AppendTaskStatusEvent(orchestrationID, w.TaskID, w.Service.ID, Completed, nil, completedTs, w.consecutiveErrs); err != nil {
+	if cacheHit {
+		err = w.LogManager.AppendTaskCacheHitEvent(orchestrationID, w.TaskID, w.Service.ID, completedTs)
+	} else {
+		slow := w.LogManager.planEngine.observeTaskDuration(w.Service.ID, completedTs.Sub(processingTs))
+		err = w.LogManager.AppendTaskCompletedEvent(orchestrationID, w.TaskID, w.Service.ID, completedTs, w.consecutiveErrs, slow)
+	}
+	if err != nil {
 		return err
 	}
 
@@ -188,14 +228,60 @@ func (w *TaskWorker) processEntry(ctx context.Context, entry LogEntry, orchestra
 		return w.LogManager.AppendTaskFailureToLog(orchestrationID, w.TaskID, w.Service.ID, err.Error(), w.consecutiveErrs, false)
 	}
 
+	w.LogManager.planEngine.streamTaskResult(orchestrationID, w.TaskID, w.Service.ID, result)
 	return nil
 }
 
+// failTask fails the task with the error, the task's service or its retry policy decide whether it's terminal
+func (w *TaskWorker) failTask(orchestrationID string, err error) error {
+	failedTs := time.Now().UTC()
+	if err := w.LogManager.AppendTaskStatusEvent(orchestrationID, w.TaskID, w.Service.ID, Failed, err, failedTs, w.consecutiveErrs); err != nil {
+		return err
+	}
+	if err := w.LogManager.MarkTask(orchestrationID, w.TaskID, Failed, failedTs); err != nil {
+		return err
+	}
+	return w.LogManager.AppendTaskErrorToLog(orchestrationID, w.TaskID, w.Service.ID, err, w.consecutiveErrs, !w.RetryPolicy.Retryable(err))
+}
+
+func (w *TaskWorker) timeOutTask(orchestrationID string) error {
+	reason := fmt.Errorf("task %s exceeded its execution timeout of %s", w.TaskID, w.ExecutionTimeout)
+	w.LogManager.Logger.Error().Err(reason).Msgf("Task %s for orchestration %s timed out", w.TaskID, orchestrationID)
+
+	timedOutTs := time.Now().UTC()
+	if err := w.LogManager.AppendTaskStatusEvent(orchestrationID, w.TaskID, w.Service.ID, TimedOut, reason, timedOutTs, w.consecutiveErrs); err != nil {
+		return err
+	}
+	if err := w.LogManager.MarkTask(orchestrationID, w.TaskID, TimedOut, timedOutTs); err != nil {
+		return err
+	}
+
+	// The service may still be working on the task
+	if err := w.LogManager.planEngine.WebSocketManager.SendTaskCancellation(w.Service.ID, &TaskCancellation{
+		Type:            "task_cancellation",
+		ID:              w.TaskID,
+		OrchestrationID: orchestrationID,
+		ServiceID:       w.Service.ID,
+		Reason:          reason.Error(),
+	}); err != nil {
+		w.LogManager.Logger.Warn().Err(err).Str("OrchestrationID", orchestrationID).Str("TaskID", w.TaskID).Msg("Failed to send task cancellation")
+	}
+
+	return w.LogManager.AppendTaskTimeoutToLog(orchestrationID, w.TaskID, w.Service.ID, reason.Error(), w.consecutiveErrs)
+}
+
 func (w *TaskWorker) executeTaskWithRetry(ctx context.Context, orchestrationID string) (json.RawMessage, error) {
 	var result json.RawMessage
 	w.consecutiveErrs = 0
+	// Tasks given up on while held back mustn't hold back others
+	defer w.LogManager.planEngine.heldTasks.release(w.Service.ID, w.heldTaskKey(orchestrationID))
 
 	operation := func() error {
+		// The orchestration was cancelled or finished, there's nothing left to retry
+		if ctx.Err() != nil {
+			return back.Permanent(ctx.Err())
+		}
+
 		logger := w.LogManager.Logger.With().
 			Str("Operation", "executeTaskWithRetry").
 			Str("OrchestrationID", orchestrationID).
@@ -212,11 +298,19 @@ func (w *TaskWorker) executeTaskWithRetry(ctx context.Context, orchestrationID s
 		var err error
 		result, err = w.tryExecute(ctx, orchestrationID)
 		if err != nil {
+			if ctx.Err() != nil {
+				return back.Permanent(ctx.Err())
+			}
+
 			if w.triggerPauseExecution(err) {
 				return err
 			}
 
 			w.consecutiveErrs++
+			if !w.RetryPolicy.Retryable(err) {
+				logger.Trace().Err(err).Msg("Stop retrying task - failure is not retryable")
+				return back.Permanent(err)
+			}
 			if w.stopRetryingTask() {
 				logger.Trace().Err(err).Msg("Stop retrying task - too many consecutive failures")
 				return back.Permanent(fmt.Errorf("too many consecutive failures: %w", err))
@@ -244,7 +338,7 @@ func (w *TaskWorker) executeTaskWithRetry(ctx context.Context, orchestrationID s
 		return nil
 	}
 
-	err := back.RetryNotify(operation, w.backOff, func(err error, duration time.Duration) {
+	err := back.RetryNotify(operation, back.WithContext(w.backOff, ctx), func(err error, duration time.Duration) {
 		if retryErr, ok := err.(RetryableError); ok {
 			w.LogManager.Logger.Info().
 				Err(retryErr.Err).
@@ -311,10 +405,11 @@ func (w *TaskWorker) processInterimTaskResults(orchestrationID string, outputs [
 	}
 }
 
-func (w *TaskWorker) processTaskResult(orchestrationID string, output json.RawMessage) error {
+// processTaskResult logs a task result, returning the task output without the compensation data
+func (w *TaskWorker) processTaskResult(orchestrationID string, output json.RawMessage) (json.RawMessage, error) {
 	var resultPayload TaskResultPayload
 	if err := json.Unmarshal(output, &resultPayload); err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"failed to unmarshal task [%s] result for orchestration [%s]: %v",
 			w.TaskID,
 			orchestrationID,
@@ -322,6 +417,16 @@ func (w *TaskWorker) processTaskResult(orchestrationID string, output json.RawMe
 		)
 	}
 
+	if err := w.checkTaskOutput(resultPayload.Task); err != nil {
+		return nil, err
+	}
+
+	if resultPayload.ContinueAsNew != nil {
+		if err := w.LogManager.planEngine.requestContinueAsNew(orchestrationID, resultPayload.ContinueAsNew); err != nil {
+			return nil, fmt.Errorf("task [%s] for orchestration [%s]: %w", w.TaskID, orchestrationID, err)
+		}
+	}
+
 	// Store the task result first
 	w.LogManager.AppendToLog(
 		orchestrationID,
@@ -331,9 +436,10 @@ func (w *TaskWorker) processTaskResult(orchestrationID string, output json.RawMe
 		w.Service.ID,
 		w.consecutiveErrs,
 	)
+	w.LogManager.planEngine.recordTaskUsage(orchestrationID, w.TaskID, resultPayload.Usage)
 
 	if !w.Service.Revertible {
-		return nil
+		return resultPayload.Task, nil
 	}
 
 	if err := w.LogManager.AppendCompensationDataStored(
@@ -342,7 +448,7 @@ func (w *TaskWorker) processTaskResult(orchestrationID string, output json.RawMe
 		w.Service.ID,
 		resultPayload.Compensation,
 	); err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"failed to store compensation data for task [%s] result for orchestration [%s]: %v",
 			w.TaskID,
 			orchestrationID,
@@ -350,42 +456,59 @@ func (w *TaskWorker) processTaskResult(orchestrationID string, output json.RawMe
 		)
 	}
 
-	return nil
+	return resultPayload.Task, nil
 }
 
 func (w *TaskWorker) stopRetryingTask() bool {
-	return w.consecutiveErrs >= maxRetries
+	return w.consecutiveErrs >= w.RetryPolicy.MaxAttempts
 }
 
 func (w *TaskWorker) checkServiceHealth(orchestrationID string) error {
-	isServiceHealthy := w.isServiceHealthy()
+	// Draining services only finish the tasks they already have, new tasks wait for the service to reconnect.
+	// Busy services have backed up send queues, new tasks wait for them to catch up.
+	// Degraded services have stopped answering health probes, new tasks wait for them to recover.
+	// Tasks held back for the service are then dispatched to it by their orchestration's priority.
+	wsm := w.LogManager.planEngine.WebSocketManager
+	heldTasks := &w.LogManager.planEngine.heldTasks
+	isServiceHealthy := w.isServiceHealthy() &&
+		!wsm.IsServiceDraining(w.Service.ID) &&
+		!wsm.IsServiceBusy(w.Service.ID) &&
+		!wsm.IsServiceDegraded(w.Service.ID)
+	outranked := isServiceHealthy && heldTasks.outranked(w.Service.ID, w.Priority)
 	logger := w.LogManager.Logger.
 		With().
 		Str("Operation", "checkServiceHealth").
 		Str("OrchestrationID", orchestrationID).
 		Str("TaskID", w.TaskID).
 		Str("Service", w.Service.Name).
-		Bool("isServiceHealthy", isServiceHealthy).Logger()
+		Bool("isServiceHealthy", isServiceHealthy).
+		Bool("outranked", outranked).Logger()
 
-	if isServiceHealthy {
+	if isServiceHealthy && !outranked {
 		if !w.pauseStart.IsZero() {
 			logger.Trace().Msg("reset service health")
 		}
 		w.pauseStart = time.Time{}
+		heldTasks.release(w.Service.ID, w.heldTaskKey(orchestrationID))
 		return nil
 	}
+	heldTasks.hold(w.Service.ID, w.heldTaskKey(orchestrationID), w.Priority)
 
 	// Start tracking pause time if not already tracking
 	if w.pauseStart.IsZero() {
 		logger.Trace().Msg("start pausing task")
 
+		reason := fmt.Errorf("service %s is not healthy", w.Service.ID)
+		if outranked {
+			reason = fmt.Errorf("service %s is taking higher priority tasks first", w.Service.ID)
+		}
 		w.pauseStart = time.Now().UTC()
 		if err := w.LogManager.AppendTaskStatusEvent(
 			orchestrationID,
 			w.TaskID,
 			w.Service.ID,
 			Paused,
-			fmt.Errorf("service %s is not healthy", w.Service.ID),
+			reason,
 			w.pauseStart,
 			w.consecutiveErrs,
 		); err != nil {
@@ -483,6 +606,19 @@ func (w *TaskWorker) executeTask(ctx context.Context, orchestrationID string, ke
 		Interface("Input", tempInput).
 		Msg("Task input")
 
+	ctx, span := tracer().Start(w.LogManager.planEngine.orchestrationTraceContext(ctx, orchestrationID), "task.execute",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("orra.orchestration_id", orchestrationID),
+			attribute.String("orra.task_id", w.TaskID),
+			attribute.String("orra.service_id", w.Service.ID),
+			attribute.String("orra.service_name", w.Service.Name),
+			attribute.String("orra.execution_id", executionID),
+			attribute.Int("orra.consecutive_errors", w.consecutiveErrs),
+		))
+
+	// Services continue the trace from the task's trace context
+	headers := traceHeaders(ctx)
 	task := &Task{
 		Type:            "task_request",
 		ID:              w.TaskID,
@@ -493,16 +629,22 @@ func (w *TaskWorker) executeTask(ctx context.Context, orchestrationID string, ke
 		OrchestrationID: orchestrationID,
 		ProjectID:       w.Service.ProjectID,
 		Status:          Processing,
+		RoutingKey:      w.Service.routingKey(orchestrationID),
+		TraceParent:     headers.Get(traceParentKey),
+		TraceState:      headers.Get(traceStateKey),
 	}
 
 	logger.Trace().Msg("Executing task request - about to send task")
 
+	dispatched := time.Now()
 	if err := w.LogManager.planEngine.WebSocketManager.SendTask(w.Service.ID, task); err != nil {
 		logger.Trace().Err(err).Msg("Failed to send task request to service - trying again using RetryableError")
 
 		// Pause execution before returning error
 		w.Service.IdempotencyStore.PauseExecution(key)
-		return nil, RetryableError{Err: fmt.Errorf("failed to send task: %w", err)}
+		err = RetryableError{Err: fmt.Errorf("failed to send task: %w", err)}
+		endSpan(span, err)
+		return nil, err
 	}
 
 	if err := w.LogManager.AppendTaskStatusEvent(
@@ -517,7 +659,14 @@ func (w *TaskWorker) executeTask(ctx context.Context, orchestrationID string, ke
 		logger.Error().Err(err).Msg("Failed to append processing status after paused status")
 	}
 
-	return w.waitForResult(ctx, orchestrationID, key, executionID)
+	result, err := w.waitForResult(ctx, orchestrationID, key, executionID)
+	status := Completed
+	if err != nil {
+		status = Failed
+	}
+	w.LogManager.planEngine.Metrics.ObserveTaskDispatch(status, time.Since(dispatched))
+	endSpan(span, err)
+	return result, err
 }
 
 func (w *TaskWorker) waitForResult(ctx context.Context, orchestrationID string, key IdempotencyKey, executionID string) (json.RawMessage, error) {
@@ -626,10 +775,11 @@ func mergeValueMapsToJson(src map[string]json.RawMessage, dependencies TaskDepen
 		}
 
 		for _, k := range dependencies[depID] {
-			if _, ok := temp[k.DependencyKey]; !ok {
+			value, ok := selectField(temp, k.DependencyKey)
+			if !ok {
 				continue
 			}
-			out[k.TaskKey] = temp[k.DependencyKey]
+			out[k.TaskKey] = value
 		}
 	}
 	return json.Marshal(out)
@@ -644,6 +794,11 @@ func taskDependenciesMet(s map[string]json.RawMessage, e TaskDependenciesWithKey
 	return true
 }
 
+// heldTaskKey identifies the task among those held back for its service
+func (w *TaskWorker) heldTaskKey(orchestrationID string) string {
+	return orchestrationID + ":" + w.TaskID
+}
+
 func (w *TaskWorker) isServiceHealthy() bool {
 	return w.LogManager.planEngine.WebSocketManager.IsServiceHealthy(w.Service.ID)
 }
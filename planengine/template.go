@@ -0,0 +1,379 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateExists   = errors.New("template already exists")
+)
+
+var templateParamTypes = []string{"string", "number", "boolean", "object", "array"}
+
+// NamedTemplate is a reusable orchestration definition, clients submit it by name with just its params
+type NamedTemplate struct {
+	Name        string          `json:"name"`
+	ProjectID   string          `json:"projectId"`
+	Description string          `json:"description,omitempty"`
+	Params      []TemplateParam `json:"params,omitempty"`
+	// Orchestration holds the action and constraints every orchestration from the template is submitted with
+	Orchestration OrchestrationTemplate `json:"orchestration"`
+	CreatedAt     time.Time             `json:"createdAt"`
+	UpdatedAt     time.Time             `json:"updatedAt"`
+}
+
+// TemplateParam describes a param a template's orchestrations are submitted with
+type TemplateParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     any    `json:"default,omitempty"`
+}
+
+type TemplateStorage interface {
+	StoreTemplate(template *NamedTemplate) error
+	LoadTemplate(projectID, name string) (*NamedTemplate, error)
+	ListTemplates(projectID string) ([]*NamedTemplate, error)
+	DeleteTemplate(projectID, name string) error
+}
+
+func (p TemplateParam) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("name is required")
+	}
+	if !slices.Contains(templateParamTypes, p.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(templateParamTypes, ", "))
+	}
+	if p.Default != nil && !templateParamHasType(p.Default, p.Type) {
+		return fmt.Errorf("default must be a %s", p.Type)
+	}
+	return nil
+}
+
+func templateParamHasType(value any, paramType string) bool {
+	switch value.(type) {
+	case string:
+		return paramType == "string"
+	case float64:
+		return paramType == "number"
+	case bool:
+		return paramType == "boolean"
+	case map[string]any:
+		return paramType == "object"
+	case []any:
+		return paramType == "array"
+	}
+	return false
+}
+
+// Instantiate builds an orchestration from the template, the params are checked against the template's schema
+// and added to its data in schema order. Params left out fall back to their default.
+func (t *NamedTemplate) Instantiate(params map[string]any) (*Orchestration, error) {
+	for name := range params {
+		if !slices.ContainsFunc(t.Params, func(p TemplateParam) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("unknown param %q", name)
+		}
+	}
+
+	orchestration := t.Orchestration.Orchestration()
+	orchestration.Template = t.Name
+	orchestration.Params = slices.Clone(orchestration.Params)
+	for _, param := range t.Params {
+		value, supplied := params[param.Name]
+		if !supplied || value == nil {
+			value = param.Default
+		}
+		if value == nil {
+			if param.Required {
+				return nil, fmt.Errorf("param %q is required", param.Name)
+			}
+			continue
+		}
+		if !templateParamHasType(value, param.Type) {
+			return nil, fmt.Errorf("param %q must be a %s", param.Name, param.Type)
+		}
+
+		orchestration.Params = slices.DeleteFunc(orchestration.Params, func(p ActionParam) bool { return p.Field == param.Name })
+		orchestration.Params = append(orchestration.Params, ActionParam{Field: param.Name, Value: value})
+	}
+	return orchestration, nil
+}
+
+func validateTemplate(template *NamedTemplate) error {
+	if err := validateNaming(template.Name, "name"); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("name"), err)
+	}
+
+	names := make(map[string]struct{}, len(template.Params))
+	for i, param := range template.Params {
+		if err := param.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter(fmt.Sprintf("params[%d]", i)), err)
+		}
+		if _, exists := names[param.Name]; exists {
+			return errs.E(errs.Validation, errs.Parameter(fmt.Sprintf("params[%d].name", i)), "param names must be unique")
+		}
+		names[param.Name] = struct{}{}
+	}
+
+	return validateOrchestrationRequest(template.Orchestration.Orchestration())
+}
+
+// decodeOrchestrationSubmission decodes a POST /orchestrations body, which either defines the orchestration
+// in full or names one of the project's templates with its params.
+func (app *App) decodeOrchestrationSubmission(w http.ResponseWriter, r *http.Request, projectID string) (*Orchestration, error) {
+	body, err := readRequestBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return app.decodeOrchestrationBody(body, projectID)
+}
+
+// templatedOrchestrationRequest runs an orchestration from a named template
+type templatedOrchestrationRequest struct {
+	Template      string            `json:"template"`
+	Params        map[string]any    `json:"params"`
+	Webhook       string            `json:"webhook"`
+	Callback      *CallbackWebhook  `json:"callback"`
+	StreamResults bool              `json:"streamResults"`
+	Labels        map[string]string `json:"labels"`
+	RunAt         *time.Time        `json:"runAt"`
+	Priority      Priority          `json:"priority"`
+	DryRun        bool              `json:"dryRun"`
+}
+
+// decodeOrchestrationBody decodes a single orchestration request, defined in full or from a template
+func (app *App) decodeOrchestrationBody(body []byte, projectID string) (*Orchestration, error) {
+	var probe struct {
+		Template string `json:"template"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil || probe.Template == "" {
+		var orchestration Orchestration
+		if err := decodeObject(body, &orchestration, orchestrationFields, ""); err != nil {
+			return nil, err
+		}
+		return &orchestration, nil
+	}
+
+	var request templatedOrchestrationRequest
+	if err := decodeObject(body, &request, templatedOrchestrationFields, ""); err != nil {
+		return nil, err
+	}
+
+	template, err := app.loadTemplate(projectID, request.Template)
+	if errors.Is(err, ErrTemplateNotFound) {
+		return nil, errs.E(errs.Validation, errs.Code(UnknownTemplateErrCode), errs.Parameter("template"), err)
+	}
+	if err != nil {
+		return nil, errs.E(errs.Unanticipated, err)
+	}
+
+	orchestration, err := template.Instantiate(request.Params)
+	if err != nil {
+		return nil, errs.E(errs.Validation, errs.Parameter("params"), err)
+	}
+	if request.Webhook != "" {
+		orchestration.Webhook = request.Webhook
+	}
+	orchestration.Callback = request.Callback
+	if request.StreamResults {
+		orchestration.StreamResults = true
+	}
+	orchestration.Labels = mergeLabels(orchestration.Labels, request.Labels)
+	if request.Priority != "" {
+		orchestration.Priority = request.Priority
+	}
+	orchestration.RunAt = request.RunAt
+	orchestration.DryRun = request.DryRun
+	return orchestration, nil
+}
+
+func (app *App) loadTemplate(projectID, name string) (*NamedTemplate, error) {
+	if app.Templates == nil {
+		return nil, ErrTemplateNotFound
+	}
+	return app.Templates.LoadTemplate(projectID, name)
+}
+
+func (app *App) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	template, err := app.decodeTemplate(w, r, project.ID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	if _, err := app.Templates.LoadTemplate(project.ID, template.Name); err == nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Exist, errs.Code(TemplateExistsErrCode), errs.Parameter("name"), ErrTemplateExists))
+		return
+	}
+
+	template.CreatedAt = time.Now().UTC()
+	template.UpdatedAt = template.CreatedAt
+	if err := app.Templates.StoreTemplate(template); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(TemplateUpdateFailedErrCode), err))
+		return
+	}
+
+	writeTemplateResponse(w, app, http.StatusCreated, template)
+}
+
+func (app *App) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	templates, err := app.Templates.ListTemplates(project.ID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	if templates == nil {
+		templates = []*NamedTemplate{}
+	}
+
+	writeTemplateResponse(w, app, http.StatusOK, templates)
+}
+
+func (app *App) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.requestTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	writeTemplateResponse(w, app, http.StatusOK, template)
+}
+
+// UpdateTemplate replaces a template's definition, orchestrations already submitted from it are unaffected
+func (app *App) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	existing, ok := app.requestTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	template, err := app.decodeTemplate(w, r, existing.ProjectID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	if template.Name != existing.Name {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("name"), "templates cannot be renamed"))
+		return
+	}
+
+	template.CreatedAt = existing.CreatedAt
+	template.UpdatedAt = time.Now().UTC()
+	if err := app.Templates.StoreTemplate(template); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(TemplateUpdateFailedErrCode), err))
+		return
+	}
+
+	writeTemplateResponse(w, app, http.StatusOK, template)
+}
+
+func (app *App) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.requestTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Templates.DeleteTemplate(template.ProjectID, template.Name); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(TemplateUpdateFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// templateRequest creates or replaces a named orchestration template
+type templateRequest struct {
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Params        []TemplateParam `json:"params"`
+	Orchestration json.RawMessage `json:"orchestration"`
+}
+
+func (app *App) decodeTemplate(w http.ResponseWriter, r *http.Request, projectID string) (*NamedTemplate, error) {
+	var request templateRequest
+	if err := decodeRequest(w, r, &request, templateFields); err != nil {
+		return nil, err
+	}
+	if vars := mux.Vars(r); request.Name == "" && vars["name"] != "" {
+		request.Name = vars["name"]
+	}
+	if len(request.Orchestration) == 0 {
+		return nil, missingField("orchestration")
+	}
+
+	template := &NamedTemplate{
+		Name:        request.Name,
+		ProjectID:   projectID,
+		Description: request.Description,
+		Params:      request.Params,
+	}
+	if err := decodeObject(request.Orchestration, &template.Orchestration, scheduleTemplateFields, "orchestration"); err != nil {
+		return nil, err
+	}
+	if err := validateTemplate(template); err != nil {
+		return nil, err
+	}
+	if err := app.Engine.validateWebhook(projectID, template.Orchestration.Webhook); err != nil {
+		return nil, errs.E(errs.Validation, errs.Parameter("orchestration.webhook"), err)
+	}
+	return template, nil
+}
+
+func (app *App) requestTemplate(w http.ResponseWriter, r *http.Request) (*NamedTemplate, bool) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return nil, false
+	}
+
+	template, err := app.Templates.LoadTemplate(project.ID, mux.Vars(r)["name"])
+	switch {
+	case errors.Is(err, ErrTemplateNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownTemplateErrCode), err))
+		return nil, false
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return nil, false
+	}
+	return template, true
+}
+
+func writeTemplateResponse(w http.ResponseWriter, app *App, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		httpErrorResponse(w, app.Logger, errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
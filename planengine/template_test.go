@@ -0,0 +1,154 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamedTemplateInstantiate(t *testing.T) {
+	template := &NamedTemplate{
+		Name: "onboard-customer",
+		Params: []TemplateParam{
+			{Name: "customerId", Type: "string", Required: true},
+			{Name: "plan", Type: "string", Default: "starter"},
+			{Name: "seats", Type: "number"},
+		},
+		Orchestration: OrchestrationTemplate{
+			Action:  Action{Type: "action", Content: "Onboard customer {customerId}"},
+			Params:  ActionParams{{Field: "region", Value: "eu"}, {Field: "plan", Value: "free"}},
+			Webhook: "http://localhost/hook",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]any
+		want    ActionParams
+		wantErr string
+	}{
+		{
+			name:   "supplied params and defaults",
+			params: map[string]any{"customerId": "cust_1"},
+			want:   ActionParams{{Field: "region", Value: "eu"}, {Field: "customerId", Value: "cust_1"}, {Field: "plan", Value: "starter"}},
+		},
+		{
+			name:   "supplied params override defaults",
+			params: map[string]any{"customerId": "cust_1", "plan": "pro", "seats": float64(5)},
+			want:   ActionParams{{Field: "region", Value: "eu"}, {Field: "customerId", Value: "cust_1"}, {Field: "plan", Value: "pro"}, {Field: "seats", Value: float64(5)}},
+		},
+		{name: "missing required param", params: map[string]any{}, wantErr: `param "customerId" is required`},
+		{name: "unknown param", params: map[string]any{"customerId": "cust_1", "tier": "gold"}, wantErr: `unknown param "tier"`},
+		{name: "mistyped param", params: map[string]any{"customerId": "cust_1", "seats": "five"}, wantErr: `param "seats" must be a number`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestration, err := template.Instantiate(tt.params)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, orchestration.Params)
+			assert.Equal(t, "onboard-customer", orchestration.Template)
+			assert.Equal(t, template.Orchestration.Action, orchestration.Action)
+		})
+	}
+
+	assert.Len(t, template.Orchestration.Params, 2, "the template's data is left untouched")
+}
+
+func TestTemplateEndpoints(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Templates = app.Db
+	project.Webhooks = []string{"http://localhost/hook", "http://localhost/other"}
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+project.APIKey)
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	definition := `{
+		"name": "onboard-customer",
+		"params": [{"name": "customerId", "type": "string", "required": true}],
+		"orchestration": {"action": {"content": "Onboard customer {customerId}"}, "webhook": "http://localhost/hook", "priority": "low"}
+	}`
+
+	w := request(http.MethodPost, "/templates", definition)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = request(http.MethodPost, "/templates", definition)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "template names are unique")
+
+	w = request(http.MethodPost, "/templates", `{"name": "Bad Name", "orchestration": {"action": {"content": "x"}, "webhook": "http://localhost/hook"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(http.MethodPost, "/templates", `{"name": "typed", "params": [{"name": "n", "type": "integer"}], "orchestration": {"action": {"content": "x"}, "webhook": "http://localhost/hook"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(http.MethodPut, "/templates/onboard-customer", `{
+		"description": "Sets up new customers",
+		"params": [{"name": "customerId", "type": "string", "required": true}],
+		"orchestration": {"action": {"content": "Onboard customer {customerId}"}, "webhook": "http://localhost/hook", "priority": "low"}
+	}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = request(http.MethodGet, "/templates/onboard-customer", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var template NamedTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&template))
+	assert.Equal(t, "Sets up new customers", template.Description)
+	assert.False(t, template.CreatedAt.IsZero())
+
+	t.Run("orchestrations are submitted by template name", func(t *testing.T) {
+		submit := func(body string) (*Orchestration, error) {
+			req := httptest.NewRequest(http.MethodPost, "/orchestrations", bytes.NewBufferString(body))
+			return app.decodeOrchestrationSubmission(httptest.NewRecorder(), req, project.ID)
+		}
+
+		orchestration, err := submit(`{"template": "onboard-customer", "params": {"customerId": "cust_1"}, "webhook": "http://localhost/other"}`)
+		require.NoError(t, err)
+		assert.Equal(t, "Onboard customer {customerId}", orchestration.Action.Content)
+		assert.Equal(t, ActionParams{{Field: "customerId", Value: "cust_1"}}, orchestration.Params)
+		assert.Equal(t, "http://localhost/other", orchestration.Webhook)
+		assert.Equal(t, PriorityLow, orchestration.Priority)
+
+		_, err = submit(`{"template": "onboard-customer", "params": {}}`)
+		assert.ErrorContains(t, err, `param "customerId" is required`)
+
+		_, err = submit(`{"template": "onboard-customer", "action": {"content": "x"}}`)
+		assert.ErrorContains(t, err, `unknown field "action"`)
+
+		w := request(http.MethodPost, "/orchestrations", `{"template": "unknown", "params": {}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), UnknownTemplateErrCode)
+	})
+
+	w = request(http.MethodGet, "/templates", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var templates []NamedTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&templates))
+	assert.Len(t, templates, 1)
+
+	w = request(http.MethodDelete, "/templates/onboard-customer", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = request(http.MethodGet, "/templates/onboard-customer", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,88 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const templateKeyPrefix = "template:"
+
+func templateKey(projectID, name string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", templateKeyPrefix, projectID, name))
+}
+
+// StoreTemplate persists a named template, its orchestration is encrypted like orchestration payloads
+func (b *BadgerDB) StoreTemplate(template *NamedTemplate) error {
+	data, err := b.encodePayload(template)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %w", err)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(templateKey(template.ProjectID, template.Name), data)
+	})
+}
+
+func (b *BadgerDB) LoadTemplate(projectID, name string) (*NamedTemplate, error) {
+	var template NamedTemplate
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(templateKey(projectID, name))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return b.decodePayload(val, &template)
+		})
+	})
+
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template: %w", err)
+	}
+	return &template, nil
+}
+
+func (b *BadgerDB) ListTemplates(projectID string) ([]*NamedTemplate, error) {
+	var templates []*NamedTemplate
+	prefix := []byte(fmt.Sprintf("%s%s:", templateKeyPrefix, projectID))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var template NamedTemplate
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &template)
+			}); err != nil {
+				return fmt.Errorf("failed to load template %s: %w", it.Item().Key(), err)
+			}
+			templates = append(templates, &template)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+func (b *BadgerDB) DeleteTemplate(projectID, name string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(templateKey(projectID, name))
+	})
+}
@@ -0,0 +1,288 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	TimelineOrchestrationAccepted = "orchestration.accepted"
+	TimelineOrchestrationPlanned  = "orchestration.planned"
+	TimelineOrchestrationStarted  = "orchestration.started"
+	TimelineOrchestrationResumed  = "orchestration.resumed"
+	TimelineTaskDispatched        = "task.dispatched"
+	TimelineTaskRetried           = "task.retried"
+	TimelineTaskStarted           = "task.started"
+	TimelineTaskRerouted          = "task.rerouted"
+	TimelineTaskLeaseExpired      = "task.lease_expired"
+	TimelineWebhookDelivered      = "webhook.delivered"
+	TimelineWebhookFailed         = "webhook.failed"
+)
+
+// LifecycleEvent records an orchestration reaching a stage of its lifecycle, its tasks' events are in its log
+type LifecycleEvent struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TimelineEvent is a step in an orchestration's execution. Elapsed is the time since the orchestration was
+// accepted, Duration is how long the step the event ends took, e.g. planning or a task's attempt.
+type TimelineEvent struct {
+	Type       string        `json:"type"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	TaskID     string        `json:"taskId,omitempty"`
+	ServiceID  string        `json:"serviceId,omitempty"`
+	Attempt    int           `json:"attempt,omitempty"`
+	CacheHit   bool          `json:"cacheHit,omitempty"`
+	Instance   string        `json:"instance,omitempty"`
+	Webhook    string        `json:"webhook,omitempty"`
+	Event      string        `json:"event,omitempty"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Slow marks a task that completed far outside its service's usual durations
+	Slow *TaskDurationAnomaly `json:"slow,omitempty"`
+}
+
+// OrchestrationTimeline lists an orchestration's events in the order they happened
+type OrchestrationTimeline struct {
+	OrchestrationID string          `json:"orchestrationId"`
+	Status          Status          `json:"status"`
+	Duration        time.Duration   `json:"duration"`
+	Events          []TimelineEvent `json:"events"`
+}
+
+func orchestrationEventType(status Status) string {
+	return "orchestration." + status.String()
+}
+
+func taskEventType(status Status) string {
+	return "task." + status.String()
+}
+
+// recordLifecycle adds a stage to an orchestration's lifecycle, the caller must hold orchestrationStoreMu
+// once the orchestration is stored
+func (o *Orchestration) recordLifecycle(eventType string) {
+	o.Lifecycle = append(o.Lifecycle, LifecycleEvent{Type: eventType, Timestamp: time.Now().UTC()})
+}
+
+func (p *PlanEngine) recordLifecycle(orchestration *Orchestration, eventType string) {
+	p.orchestrationStoreMu.Lock()
+	defer p.orchestrationStoreMu.Unlock()
+	orchestration.recordLifecycle(eventType)
+}
+
+// OrchestrationTimeline builds an orchestration's timeline from its lifecycle, its log's task events, and the
+// deliveries of webhooks about it
+func (p *PlanEngine) OrchestrationTimeline(orchestrationID string) (*OrchestrationTimeline, error) {
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	if !exists {
+		p.orchestrationStoreMu.RUnlock()
+		return nil, errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID)
+	}
+	status := orchestration.Status
+	projectID := orchestration.ProjectID
+	lifecycle := slices.Clone(orchestration.Lifecycle)
+	webhooks := orchestration.resultWebhooks()
+	p.orchestrationStoreMu.RUnlock()
+
+	var events []TimelineEvent
+	for _, stage := range lifecycle {
+		events = append(events, TimelineEvent{Type: stage.Type, Timestamp: stage.Timestamp})
+	}
+	if p.LogManager != nil {
+		if log := p.LogManager.GetLog(orchestrationID); log != nil {
+			events = append(events, taskTimelineEvents(log.ReadFrom(0))...)
+		}
+	}
+	events = append(events, p.webhookTimelineEvents(projectID, orchestrationID, webhooks)...)
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	measureTimeline(events)
+
+	timeline := &OrchestrationTimeline{
+		OrchestrationID: orchestrationID,
+		Status:          status,
+		Events:          events,
+	}
+	if len(events) > 0 {
+		timeline.Duration = events[len(events)-1].Elapsed
+	}
+	return timeline, nil
+}
+
+// taskTimelineEvents turns the task status events in an orchestration's log into timeline events
+func taskTimelineEvents(entries []LogEntry) []TimelineEvent {
+	var events []TimelineEvent
+	for _, entry := range entries {
+		if entry.GetEntryType() != "task_status" {
+			continue
+		}
+		var status TaskStatusEvent
+		if err := json.Unmarshal(entry.GetValue(), &status); err != nil {
+			continue
+		}
+
+		event := TimelineEvent{
+			Type:      taskEventType(status.Status),
+			Timestamp: status.Timestamp,
+			TaskID:    status.TaskID,
+			ServiceID: status.ServiceID,
+			CacheHit:  status.CacheHit,
+			Error:     status.Error,
+			Slow:      status.Slow,
+		}
+		switch {
+		case status.Lease != nil && status.Lease.Event == LeaseGranted:
+			event.Type = TimelineTaskStarted
+			event.Instance = status.Lease.InstanceID
+		case status.Lease != nil:
+			event.Type = TimelineTaskLeaseExpired
+			event.Instance = status.Lease.InstanceID
+			event.Error = status.Lease.Reason
+		case status.Rerouted != nil:
+			event.Type = TimelineTaskRerouted
+			event.Instance = status.Rerouted.ToInstance
+		case status.Status == Processing:
+			// Each attempt's status is logged with the number of failed attempts before it
+			event.Type = TimelineTaskDispatched
+			event.Attempt = entry.GetAttemptNum() + 1
+			if event.Attempt > 1 {
+				event.Type = TimelineTaskRetried
+			}
+		case status.Status == Failed:
+			event.Attempt = entry.GetAttemptNum()
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// webhookTimelineEvents returns the attempts at delivering webhooks about an orchestration, to its project's
+// webhooks as well as its own
+func (p *PlanEngine) webhookTimelineEvents(projectID, orchestrationID string, webhooks []string) []TimelineEvent {
+	if p.WebhookDeliveries == nil {
+		return nil
+	}
+	if project, err := p.GetProjectByID(projectID); err == nil {
+		webhooks = append(webhooks, project.Webhooks...)
+	}
+	slices.Sort(webhooks)
+
+	var events []TimelineEvent
+	for _, webhook := range slices.Compact(webhooks) {
+		deliveries, err := p.WebhookDeliveries.ListWebhookDeliveries(projectID, p.webhookID(projectID, webhook))
+		if err != nil {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Str("Webhook", webhook).Msg("Failed to list webhook deliveries for timeline")
+			continue
+		}
+		for _, delivery := range deliveries {
+			payload, err := parseWebhookPayload(delivery.Payload)
+			if err != nil || payload.OrchestrationID != orchestrationID {
+				continue
+			}
+
+			event := TimelineEvent{
+				Type:       TimelineWebhookDelivered,
+				Timestamp:  delivery.Timestamp,
+				Duration:   time.Duration(delivery.LatencyMs) * time.Millisecond,
+				Webhook:    delivery.Webhook,
+				Event:      delivery.Event,
+				StatusCode: delivery.StatusCode,
+				Error:      delivery.Error,
+			}
+			if !delivery.Succeeded {
+				event.Type = TimelineWebhookFailed
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// measureTimeline sets how long after the first event each event happened, and how long the steps ending with
+// planning, starting, finishing, and each task attempt's events took
+func measureTimeline(events []TimelineEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	start := events[0].Timestamp
+	var accepted, started time.Time
+	dispatched := map[string]time.Time{}
+	for i := range events {
+		event := &events[i]
+		event.Elapsed = event.Timestamp.Sub(start)
+
+		switch event.Type {
+		case TimelineOrchestrationAccepted, orchestrationEventType(Scheduled):
+			accepted = event.Timestamp
+		case TimelineOrchestrationPlanned:
+			event.Duration = sinceIfSet(event.Timestamp, accepted)
+		case orchestrationEventType(Queued):
+			started = event.Timestamp
+		case TimelineOrchestrationStarted:
+			event.Duration = sinceIfSet(event.Timestamp, started)
+			started = event.Timestamp
+		case orchestrationEventType(Completed), orchestrationEventType(Failed), orchestrationEventType(NotActionable),
+			orchestrationEventType(Cancelled), orchestrationEventType(TimedOut):
+			event.Duration = sinceIfSet(event.Timestamp, started)
+		case TimelineTaskDispatched, TimelineTaskRetried:
+			dispatched[event.TaskID] = event.Timestamp
+		case TimelineTaskStarted, taskEventType(Completed), taskEventType(Failed),
+			taskEventType(TimedOut), taskEventType(Cancelled):
+			event.Duration = sinceIfSet(event.Timestamp, dispatched[event.TaskID])
+		}
+	}
+}
+
+func sinceIfSet(timestamp, since time.Time) time.Duration {
+	if since.IsZero() {
+		return 0
+	}
+	return timestamp.Sub(since)
+}
+
+// OrchestrationTimelineHandler returns the timeline of one of the project's orchestrations
+func (app *App) OrchestrationTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	orchestrationID := mux.Vars(r)["id"]
+	if !app.Engine.OrchestrationBelongsToProject(orchestrationID, project.ID) {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownOrchestrationErrCode), "unknown orchestration: "+orchestrationID))
+		return
+	}
+
+	timeline, err := app.Engine.OrchestrationTimeline(orchestrationID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(timeline); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
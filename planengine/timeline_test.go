@@ -0,0 +1,121 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrchestrationTimeline(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	logManager, err := NewLogManager(context.Background(), app.Db, LogsRetentionPeriod, app.Engine)
+	require.NoError(t, err)
+	app.Engine.LogManager = logManager
+	app.Engine.WebhookDeliveries = app.Db
+	// The timeline's deliveries are stored below, the webhook is only told about alerts so none are sent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+	project.Webhooks = []string{receiver.URL}
+	project.setWebhookEvents(receiver.URL, []string{ProjectEventAlertTriggered})
+	require.NoError(t, app.Db.StoreProject(project))
+
+	start := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	at := func(offset time.Duration) time.Time { return start.Add(offset) }
+
+	orchestration := &Orchestration{
+		ID:        "o_timeline",
+		ProjectID: project.ID,
+		Status:    Processing,
+		Plan:      &ExecutionPlan{Tasks: []*SubTask{{ID: "task1", Service: "s_payments"}}},
+		Lifecycle: []LifecycleEvent{
+			{Type: TimelineOrchestrationAccepted, Timestamp: at(0)},
+			{Type: TimelineOrchestrationPlanned, Timestamp: at(2 * time.Second)},
+			{Type: TimelineOrchestrationStarted, Timestamp: at(3 * time.Second)},
+		},
+	}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+	logManager.PrepLogForOrchestration(project.ID, orchestration.ID, orchestration.Plan)
+
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_payments", Processing, nil, at(4*time.Second), 0))
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_payments", Failed, errors.New("payment gateway timeout"), at(5*time.Second), 1))
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_payments", Processing, nil, at(6*time.Second), 1))
+	require.NoError(t, logManager.AppendTaskLeaseEvent(orchestration.ID, "task1", "s_payments", TaskLease{Event: LeaseGranted, InstanceID: "i_1"}, at(6500*time.Millisecond)))
+	require.NoError(t, logManager.AppendTaskStatusEvent(orchestration.ID, "task1", "s_payments", Completed, nil, at(8*time.Second), 1))
+
+	delivery := newWebhookDelivery(project.ID, projectWebhookID(project.Webhooks[0]), project.Webhooks[0], ProjectEventOrchestrationCompleted, json.RawMessage(`{"orchestrationId":"o_timeline","status":"completed"}`))
+	delivery.Timestamp = at(10 * time.Second)
+	delivery.Succeeded, delivery.StatusCode, delivery.LatencyMs = true, http.StatusOK, 120
+	require.NoError(t, app.Db.StoreWebhookDelivery(delivery))
+	other := newWebhookDelivery(project.ID, projectWebhookID(project.Webhooks[0]), project.Webhooks[0], ProjectEventOrchestrationCompleted, json.RawMessage(`{"orchestrationId":"o_other"}`))
+	require.NoError(t, app.Db.StoreWebhookDelivery(other))
+
+	require.NoError(t, app.Engine.FinalizeOrchestration(orchestration.ID, Completed, nil, nil, true))
+	app.Engine.notifying.Wait()
+
+	req := httptest.NewRequest(http.MethodGet, "/orchestrations/o_timeline/timeline", nil)
+	req.Header.Set("Authorization", "Bearer project-api-key")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var timeline OrchestrationTimeline
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&timeline))
+	assert.Equal(t, Completed, timeline.Status)
+
+	var types []string
+	for _, event := range timeline.Events {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []string{
+		TimelineOrchestrationAccepted,
+		TimelineOrchestrationPlanned,
+		TimelineOrchestrationStarted,
+		TimelineTaskDispatched,
+		"task.failed",
+		TimelineTaskRetried,
+		TimelineTaskStarted,
+		"task.completed",
+		TimelineWebhookDelivered,
+		"orchestration.completed",
+	}, types)
+
+	events := timeline.Events
+	assert.Equal(t, 2*time.Second, events[1].Duration, "planning took 2s")
+	assert.Equal(t, 1, events[3].Attempt)
+	assert.Equal(t, time.Second, events[4].Duration, "the first attempt failed after 1s")
+	assert.Equal(t, "payment gateway timeout", events[4].Error)
+	assert.Equal(t, 2, events[5].Attempt)
+	assert.Equal(t, "i_1", events[6].Instance)
+	assert.Equal(t, 500*time.Millisecond, events[6].Duration, "the retry was picked up after 500ms")
+	assert.Equal(t, 2*time.Second, events[7].Duration, "the retry completed 2s after it was dispatched")
+	assert.Equal(t, 8*time.Second, events[7].Elapsed)
+	assert.Equal(t, project.Webhooks[0], events[8].Webhook)
+	assert.Equal(t, 120*time.Millisecond, events[8].Duration)
+	assert.Greater(t, events[9].Duration, time.Duration(0))
+	assert.Equal(t, events[9].Elapsed, timeline.Duration)
+
+	t.Run("unknown orchestrations aren't found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orchestrations/o_unknown/timeline", nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func orchestrationFinished(status Status) bool {
+	switch status {
+	case Completed, Failed, NotActionable, Cancelled, TimedOut:
+		return true
+	}
+	return false
+}
+
+// scheduleOrchestrationTimeout times the orchestration out if it's still running once its timeout elapses
+func (p *PlanEngine) scheduleOrchestrationTimeout(orchestration *Orchestration) {
+	timeout := orchestration.GetOrchestrationTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	orchestrationID := orchestration.ID
+	deadline := time.AfterFunc(timeout, func() {
+		if err := p.TimeOutOrchestration(orchestrationID, timeout); err != nil && !errors.Is(err, ErrOrchestrationFinished) {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Msg("Failed to time out orchestration")
+		}
+	})
+
+	p.workerMu.Lock()
+	p.deadlines[orchestrationID] = deadline
+	p.workerMu.Unlock()
+}
+
+// TimeOutOrchestration ends an orchestration that overran its timeout. Its task workers are stopped, services
+// working on in-flight tasks are told to stop and completed tasks are compensated as they would be for a failure.
+func (p *PlanEngine) TimeOutOrchestration(orchestrationID string, timeout time.Duration) error {
+	p.orchestrationStoreMu.RLock()
+	orchestration, exists := p.orchestrationStore[orchestrationID]
+	var status Status
+	if exists {
+		status = orchestration.Status
+	}
+	p.orchestrationStoreMu.RUnlock()
+	if !exists {
+		return ErrOrchestrationNotFound
+	}
+	if orchestrationFinished(status) {
+		return fmt.Errorf("%w with status %s", ErrOrchestrationFinished, status.String())
+	}
+
+	reason := fmt.Sprintf("orchestration exceeded its timeout of %s", timeout)
+	p.cleanupLogWorkers(orchestrationID)
+
+	timedOutAt := time.Now().UTC()
+	for _, task := range p.LogManager.InFlightTasks(orchestrationID) {
+		if err := p.LogManager.MarkTask(orchestrationID, task.ID, TimedOut, timedOutAt); err != nil {
+			p.Logger.Error().Err(err).Str("OrchestrationID", orchestrationID).Str("TaskID", task.ID).Msg("Failed to mark task timed out")
+		}
+
+		if err := p.WebSocketManager.SendTaskCancellation(task.Service, &TaskCancellation{
+			Type:            "task_cancellation",
+			ID:              task.ID,
+			OrchestrationID: orchestrationID,
+			ServiceID:       task.Service,
+			Reason:          reason,
+		}); err != nil {
+			p.Logger.Warn().Err(err).Str("OrchestrationID", orchestrationID).Str("TaskID", task.ID).Msg("Failed to send task cancellation")
+		}
+	}
+
+	payload, err := json.Marshal(struct {
+		OrchestrationID string `json:"orchestration"`
+		Error           string `json:"error"`
+	}{
+		OrchestrationID: orchestrationID,
+		Error:           reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal timeout reason: %w", err)
+	}
+
+	p.LogManager.MarkOrchestration(orchestrationID, TimedOut, []byte(reason))
+	if err := p.LogManager.FinalizeOrchestration(orchestrationID, TimedOut, payload, nil, false); err != nil {
+		return err
+	}
+
+	p.Logger.Info().
+		Str("OrchestrationID", orchestrationID).
+		Str("ProjectID", orchestration.ProjectID).
+		Dur("Timeout", timeout).
+		Msg("Orchestration timed out")
+
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrchestrationTimeouts(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	notifications := make(chan map[string]any, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		notifications <- payload
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	awaitNotification := func(t *testing.T) map[string]any {
+		t.Helper()
+		select {
+		case payload := <-notifications:
+			return payload
+		case <-time.After(2 * time.Second):
+			t.Fatal("orchestration webhook was not notified")
+			return nil
+		}
+	}
+
+	t.Run("orchestrations time out once their timeout elapses", func(t *testing.T) {
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Webhook = webhook.URL
+		orchestration.OrchestrationTimeout = &Duration{50 * time.Millisecond}
+
+		app.Engine.scheduleOrchestrationTimeout(orchestration)
+
+		payload := awaitNotification(t)
+		assert.Equal(t, orchestration.ID, payload["orchestrationId"])
+		assert.Equal(t, "timed_out", payload["status"])
+
+		timedOut, err := app.Engine.getOrchestration(orchestration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, TimedOut, timedOut.Status)
+		assert.Contains(t, string(timedOut.Error), "exceeded its timeout")
+
+		state := app.Engine.LogManager.orchestrations[orchestration.ID]
+		assert.Equal(t, TimedOut, state.Status)
+		assert.Equal(t, TimedOut, state.TasksStatuses["task1"], "in-flight tasks are timed out")
+
+		err = app.Engine.TimeOutOrchestration(orchestration.ID, time.Second)
+		assert.ErrorIs(t, err, ErrOrchestrationFinished)
+	})
+
+	t.Run("finished orchestrations don't time out", func(t *testing.T) {
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Webhook = webhook.URL
+		orchestration.OrchestrationTimeout = &Duration{50 * time.Millisecond}
+
+		app.Engine.scheduleOrchestrationTimeout(orchestration)
+		app.Engine.cleanupLogWorkers(orchestration.ID)
+
+		select {
+		case <-notifications:
+			t.Fatal("orchestration timed out after it finished")
+		case <-time.After(200 * time.Millisecond):
+		}
+		assert.Equal(t, Processing, orchestration.Status)
+	})
+
+	t.Run("timed out tasks time out their orchestration", func(t *testing.T) {
+		orchestration := setupRunningOrchestration(t, app, project.ID)
+		orchestration.Webhook = webhook.URL
+
+		require.NoError(t, app.Engine.LogManager.AppendTaskTimeoutToLog(orchestration.ID, "task1", "s_echo", "task task1 exceeded its execution timeout of 1s", 1))
+
+		var failure LogEntry
+		for _, entry := range app.Engine.LogManager.GetLog(orchestration.ID).ReadFrom(0) {
+			if entry.GetEntryType() == "task_failure" {
+				failure = entry
+			}
+		}
+		require.NotEmpty(t, failure.GetID())
+
+		tracker := NewFailureTracker(app.Engine.LogManager).(*FailureTracker)
+		require.NoError(t, tracker.processEntry(failure, orchestration.ID))
+
+		payload := awaitNotification(t)
+		assert.Equal(t, "timed_out", payload["status"])
+		assert.Equal(t, TimedOut, app.Engine.LogManager.orchestrations[orchestration.ID].Status)
+	})
+}
@@ -0,0 +1,121 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	traceParentKey = "traceparent"
+	traceStateKey  = "tracestate"
+)
+
+// tracer returns the plan engine's tracer from the global provider set by setupTracing, until then its spans
+// aren't recorded
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/orra-dev/orra/planengine")
+}
+
+// traceContext propagates spans in the W3C Trace Context format, to services and webhooks alike
+var traceContext = propagation.TraceContext{}
+
+// setupTracing exports the plan engine's spans to an OTLP/HTTP collector, returning a function flushing and
+// stopping the exporter. Nothing is exported without an endpoint.
+func setupTracing(ctx context.Context, cfg Tracing) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(traceContext)
+	return provider.Shutdown, nil
+}
+
+// endSpan records a span's error, if any, before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceHeaders returns the W3C trace context of the span in ctx, it's empty when the span isn't recorded
+func traceHeaders(ctx context.Context) propagation.MapCarrier {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier
+}
+
+// startOrchestrationTrace starts the span covering an orchestration's lifecycle, continuing its parent
+// orchestration's trace for sub-orchestrations. The span ends when the orchestration is finalized.
+func (p *PlanEngine) startOrchestrationTrace(ctx context.Context, orchestration *Orchestration) context.Context {
+	if orchestration.ParentID != "" {
+		ctx = p.orchestrationTraceContext(ctx, orchestration.ParentID)
+	}
+	ctx, span := tracer().Start(ctx, "orchestration", trace.WithAttributes(
+		attribute.String("orra.orchestration_id", orchestration.ID),
+		attribute.String("orra.project_id", orchestration.ProjectID),
+		attribute.String("orra.action", orchestration.Action.Content),
+	))
+	p.orchestrationSpans.Store(orchestration.ID, span)
+	return ctx
+}
+
+// endOrchestrationTrace ends an orchestration's lifecycle span with its final status
+func (p *PlanEngine) endOrchestrationTrace(orchestrationID string, status Status, reason json.RawMessage) {
+	value, ok := p.orchestrationSpans.Load(orchestrationID)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(attribute.String("orra.status", status.String()))
+	if status != Completed {
+		span.SetStatus(codes.Error, notificationReason(reason))
+	}
+	span.End()
+
+	// Only the span's context is needed from now on
+	p.orchestrationSpans.Store(orchestrationID, trace.SpanFromContext(trace.ContextWithSpanContext(context.Background(), span.SpanContext())))
+}
+
+// orchestrationTraceContext returns ctx carrying an orchestration's lifecycle span, so spans started from it
+// join the orchestration's trace
+func (p *PlanEngine) orchestrationTraceContext(ctx context.Context, orchestrationID string) context.Context {
+	value, ok := p.orchestrationSpans.Load(orchestrationID)
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithSpan(ctx, value.(trace.Span))
+}
@@ -0,0 +1,85 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestOrchestrationTracing(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		_ = provider.Shutdown(context.Background())
+	}()
+
+	traceParents := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParents <- r.Header.Get(traceParentKey)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	parent := &Orchestration{ID: "o_traced", ProjectID: project.ID, Action: Action{Content: "Refund order 42"}}
+	child := &Orchestration{ID: "o_traced_child", ProjectID: project.ID, ParentID: parent.ID}
+	app.Engine.startOrchestrationTrace(context.Background(), parent)
+	app.Engine.startOrchestrationTrace(context.Background(), child)
+
+	event := ProjectEvent{Event: ProjectEventSLABreached, ProjectID: project.ID, Data: map[string]any{"orchestrationId": parent.ID}}
+	require.NoError(t, app.Engine.postWebhook(project.ID, receiver.URL, event.Event, event))
+	traceParent := <-traceParents
+
+	app.Engine.endOrchestrationTrace(child.ID, Completed, nil)
+	app.Engine.endOrchestrationTrace(parent.ID, Failed, json.RawMessage(`"payment service unavailable"`))
+	app.Engine.endOrchestrationTrace(parent.ID, Failed, nil)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()+" "+span.SpanContext().SpanID().String()] = span
+	}
+	require.Len(t, spans, 3, "lifecycle spans are only ended once")
+
+	var orchestration, subOrchestration, delivery sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch {
+		case span.Name() == "webhook.deliver":
+			delivery = span
+		case span.Parent().IsValid():
+			subOrchestration = span
+		default:
+			orchestration = span
+		}
+	}
+	require.NotNil(t, orchestration)
+	require.NotNil(t, subOrchestration)
+	require.NotNil(t, delivery)
+
+	traceID := orchestration.SpanContext().TraceID()
+	assert.Equal(t, codes.Error, orchestration.Status().Code)
+	assert.Equal(t, "payment service unavailable", orchestration.Status().Description)
+	assert.Equal(t, traceID, subOrchestration.SpanContext().TraceID(), "sub-orchestrations join their parent's trace")
+	assert.Equal(t, orchestration.SpanContext().SpanID(), delivery.Parent().SpanID())
+	assert.Equal(t, "00-"+traceID.String()+"-"+delivery.SpanContext().SpanID().String()+"-01", traceParent,
+		"webhooks receive the delivery's trace context")
+}
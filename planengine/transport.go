@@ -0,0 +1,37 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+)
+
+// Transport connects services to the plan engine through something other than the plan engine's own
+// WebSocket, e.g. a message broker. A transport hands each connected service's session to the WebSocketManager,
+// which then delivers tasks, pings and resumes it like any WebSocket connection.
+type Transport interface {
+	// Name identifies the transport in logs
+	Name() string
+	// Start begins accepting service connections until ctx is done
+	Start(ctx context.Context, engine *PlanEngine) error
+}
+
+// AddTransport registers a transport to start alongside the plan engine
+func (wsm *WebSocketManager) AddTransport(transport Transport) {
+	wsm.transports = append(wsm.transports, transport)
+}
+
+// StartTransports starts the registered transports, a transport that fails to start is logged and skipped
+func (wsm *WebSocketManager) StartTransports(ctx context.Context, engine *PlanEngine) {
+	for _, transport := range wsm.transports {
+		if err := transport.Start(ctx, engine); err != nil {
+			wsm.logger.Error().Err(err).Str("Transport", transport.Name()).Msg("Failed to start service transport")
+			continue
+		}
+		wsm.logger.Info().Str("Transport", transport.Name()).Msg("Started service transport")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -26,39 +27,125 @@ type contextKey struct{}
 var apiKeyContextKey = contextKey{}
 
 type PlanEngine struct {
-	projects             map[string]*Project
-	services             map[string]map[string]*ServiceInfo
-	groundings           map[string]map[string]*GroundingSpec
-	groundingsMu         sync.RWMutex
-	servicesMu           sync.RWMutex
+	projects     map[string]*Project
+	services     map[string]map[string]*ServiceInfo
+	groundings   map[string]map[string]*GroundingSpec
+	groundingsMu sync.RWMutex
+	servicesMu   sync.RWMutex
+	// projects are replaced rather than changed once added, projectsMu guards the map. projectWriteMu
+	// serialises project changes, so concurrent ones can't overwrite each other.
+	projectsMu     sync.RWMutex
+	projectWriteMu sync.Mutex
+	// registrationMu serialises service registrations, so each name is registered once
+	registrationMu       sync.Mutex
 	orchestrationStore   map[string]*Orchestration
 	orchestrationStoreMu sync.RWMutex
 	LogManager           *LogManager
 	logWorkers           map[string]map[string]context.CancelFunc
 	workerMu             sync.RWMutex
-	WebSocketManager     *WebSocketManager
-	VectorCache          *VectorCache
-	PddlValidator        PddlValidator
-	SimilarityMatcher    SimilarityMatcher
-	pStorage             ProjectStorage
-	svcStorage           ServiceStorage
-	orchestrationStorage OrchestrationStorage
-	groundingStorage     GroundingStorage
-	Logger               zerolog.Logger
+	pauseGates           map[string]chan struct{}
+	pauseMu              sync.RWMutex
+	deadlines            map[string]*time.Timer
+	slaTimers            map[string]*time.Timer
+	// Running orchestrations and the queues of those waiting for a slot, guarded by orchestrationStoreMu
+	runningOrchestrations map[string]string
+	runningCounts         map[string]int
+	orchestrationQueues   map[string][]queuedOrchestration
+	approvals             map[string]*pendingApproval
+	heldTasks             serviceHolds // Tasks waiting for their service, dispatched by priority
+	approvalsMu           sync.Mutex
+	notifying             sync.WaitGroup  // Project notifications being sent in the background
+	stopping              <-chan struct{} // Closed once the engine shuts down, ending webhook retries
+	WebSocketManager      *WebSocketManager
+	VectorCache           *VectorCache
+	ResultCache           *TaskResultCache
+	PddlValidator         PddlValidator
+	SimilarityMatcher     SimilarityMatcher
+	pStorage              ProjectStorage
+	svcStorage            ServiceStorage
+	orchestrationStorage  OrchestrationStorage
+	groundingStorage      GroundingStorage
+	DeadLetters           DeadLetterStorage
+	WebhookDeadLetters    WebhookDeadLetterStorage
+	WebhookDeliveries     WebhookDeliveryStorage
+	TaskLogs              TaskLogStorage
+	Submissions           SubmissionStorage
+	Usage                 UsageStorage
+	Metrics               *Metrics
+	webhookRetry          WebhookRetry
+	// Webhooks are only sent to public addresses unless allowPrivateWebhooks, webhookClient checks every connection
+	allowPrivateWebhooks bool
+	webhookClient        *http.Client
+	slowTasks            SlowTasks
+	// latencyBaselines holds each service's recent task durations, by service ID. latencyMu guards them along
+	// with the slow task settings.
+	latencyBaselines map[string]*latencyBaseline
+	latencyMu        sync.Mutex
+	Logger           zerolog.Logger
+	// orchestrationSpans holds each orchestration's lifecycle span by orchestration ID, even once it has ended, so
+	// spans about the orchestration join its trace. It's kept apart from the orchestration store so its lock isn't needed.
+	orchestrationSpans sync.Map
+	alerts             alertStates
+	search             searchIndex
 }
 
 type ServiceFinder func(serviceID string) (*ServiceInfo, error)
 
+// serviceSession is a service's connection to the plan engine, either a melody WebSocket session or a gRPC stream
+type serviceSession interface {
+	Write(message []byte) error
+	Close() error
+	Get(key string) (any, bool)
+	Set(key string, value any)
+}
+
 type WebSocketManager struct {
 	melody            *melody.Melody
 	logger            zerolog.Logger
-	connMap           map[string]*melody.Session
+	connMap           map[string]*serviceInstances
 	connMu            sync.RWMutex
 	messageExpiration time.Duration
 	pingInterval      time.Duration
-	pongWait          time.Duration
+	maxMissedPings    int
 	serviceHealth     map[string]bool
-	healthMu          sync.RWMutex
+	// lastSeen is when each service's last connected instance disconnected, guarded by healthMu
+	lastSeen map[string]time.Time
+	healthMu sync.RWMutex
+	tokens   *WSTokenStore
+	// onStaleConnection releases the in-flight tasks of a service whose connection was reaped
+	onStaleConnection func(serviceID string)
+	deliveries        map[string]*pendingDelivery
+	deliveryMu        sync.Mutex
+	ackTimeout        time.Duration
+	maxRedeliveries   int
+	outboxes          map[string]*serviceOutbox
+	outboxMu          sync.Mutex
+	resumeWindow      time.Duration
+	maxBuffered       int
+	transports        []Transport
+	callbackClient    *http.Client
+	// affinities pins the tasks of each routing key to a service instance, by service
+	affinities map[string]map[string]string
+	// draining services finish their in-flight tasks without being sent new ones
+	draining map[string]bool
+	// onReroute records a task with a routing key dispatched to another instance than its earlier tasks
+	onReroute func(task Task, fromInstance, toInstance string)
+	// sendQueueSize bounds each connection's queued messages, connections with busyThreshold queued are busy
+	sendQueueSize int
+	busyThreshold int
+	// leaseTTL is how long acknowledged tasks stay leased without being renewed, zero disables leases
+	leaseTTL time.Duration
+	// onLease records a task's lease being granted or expiring
+	onLease func(task Task, lease TaskLease, timestamp time.Time)
+	// probeInterval is how often connected instances are sent health probes, zero disables them. Instances failing
+	// probeThreshold probes in a row, i.e. not answering within probeTimeout, are degraded.
+	probeInterval  time.Duration
+	probeTimeout   time.Duration
+	probeThreshold int
+	// onDisconnect notifies a service's project once its last connected instance disconnects
+	onDisconnect func(serviceID string)
+	// onTaskLogs stores the log lines an instance streamed while executing tasks
+	onTaskLogs func(serviceID, instanceID string, logs []TaskLog)
 }
 
 // ProjectStorage defines the interface for project persistence operations
@@ -69,27 +156,56 @@ type ProjectStorage interface {
 	// LoadProject retrieves a project by its ID
 	LoadProject(id string) (*Project, error)
 
-	// LoadProjectByAPIKey retrieves a project using an API key (primary or additional)
+	// LoadProjectByAPIKey retrieves a project using a plaintext API key (primary or additional)
 	LoadProjectByAPIKey(apiKey string) (*Project, error)
 
+	// APIKeyLookupKey returns the key API keys' storage indices are derived with, see apiKeyLookupID
+	APIKeyLookupKey() ([]byte, error)
+
 	// ListProjects returns all projects
 	ListProjects() ([]*Project, error)
 
-	// AddProjectAPIKey adds a new API key to a project
-	AddProjectAPIKey(projectID string, apiKey string) error
+	// DeleteProject removes a project, revoking its API keys, along with its services, groundings, templates,
+	// dead letters, webhook deliveries, submissions and usage
+	DeleteProject(project *Project) error
 
-	// AddProjectWebhook adds a new webhook URL to a project
-	AddProjectWebhook(projectID string, webhook string) error
+	// AddProjectAPIKey adds a new hashed API key to a project
+	AddProjectAPIKey(projectID string, apiKey HashedAPIKey) error
+
+	// AddProjectWebhook adds a new webhook URL to a project, subscribed to its options' events or to all of them if there are none
+	AddProjectWebhook(projectID string, webhook, webhookID string, options ProjectWebhookOptions, secret WebhookSecret) error
 }
 
 type Project struct {
-	ID                string    `json:"id"`
-	Name              string    `json:"name"`
-	APIKey            string    `json:"apiKey"`
-	AdditionalAPIKeys []string  `json:"additionalAPIKeys"`
-	Webhooks          []string  `json:"webhooks"`
-	CreatedAt         time.Time `json:"createdAt"`
-	UpdatedAt         time.Time `json:"updatedAt"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// APIKey only holds the plaintext primary key while it's being handed out, it is never persisted.
+	APIKey string `json:"apiKey,omitempty"`
+	// AdditionalAPIKeys is only populated for projects stored before keys were hashed.
+	AdditionalAPIKeys []string        `json:"additionalAPIKeys,omitempty"`
+	APIKeyHashes      []HashedAPIKey  `json:"apiKeyHashes"`
+	Webhooks          []string        `json:"webhooks"`
+	Members           []ProjectMember `json:"members,omitempty"`
+	Security          ProjectSecurity `json:"security"`
+	Limits            ProjectLimits   `json:"limits"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+	// WebhookEvents holds the events each webhook subscribed to, by URL. Webhooks without any receive every event.
+	WebhookEvents map[string][]string `json:"webhookEvents,omitempty"`
+	// WebhookIDs holds the ID each webhook keeps when its URL changes, by URL. Webhooks without one are identified
+	// by their URL.
+	WebhookIDs map[string]string `json:"webhookIds,omitempty"`
+	// WebhookSecrets holds the secrets each webhook's deliveries are signed with, by URL
+	WebhookSecrets map[string]WebhookSecret `json:"webhookSecrets,omitempty"`
+	// WebhookFormats holds the payload format of each webhook not receiving native events, by URL
+	WebhookFormats map[string]string `json:"webhookFormats,omitempty"`
+	// WebhookRequests holds the static headers and delivery timeout of each webhook configuring them, by URL.
+	// Header values often hold credentials, so they're never returned by the API.
+	WebhookRequests map[string]WebhookRequest `json:"webhookRequests,omitempty"`
+	// Notifications are the chat channels orchestration outcomes are announced in
+	Notifications ProjectNotifications `json:"notifications"`
+	// Alerts are the rules the project is alerted on, see EvaluateAlerts
+	Alerts ProjectAlerts `json:"alerts"`
 }
 
 type OrchestrationState struct {
@@ -110,6 +226,7 @@ type LogStore interface {
 	LoadEntries(orchestrationID string) ([]LogEntry, error)
 	ListOrchestrationStates() ([]*OrchestrationState, error)
 	LoadState(orchestrationID string) (*OrchestrationState, error)
+	DeleteLog(orchestrationID string) error
 }
 
 type LogEntry struct {
@@ -160,6 +277,7 @@ type ResultAggregator struct {
 	Dependencies DependencyKeySet
 	LogManager   *LogManager
 	logState     *LogState
+	skipped      map[string]bool
 }
 
 type FailureTracker struct {
@@ -168,8 +286,12 @@ type FailureTracker struct {
 }
 
 type LoggedFailure struct {
-	Failure     string `json:"failure"`
-	SkipWebhook bool   `json:"skipWebhook"`
+	Failure     string          `json:"failure"`
+	Code        string          `json:"code,omitempty"`
+	Details     json.RawMessage `json:"details,omitempty"`
+	Terminal    bool            `json:"terminal,omitempty"`
+	SkipWebhook bool            `json:"skipWebhook"`
+	TimedOut    bool            `json:"timedOut,omitempty"`
 }
 
 type TaskWorker struct {
@@ -177,8 +299,14 @@ type TaskWorker struct {
 	TaskID                 string
 	Dependencies           TaskDependenciesWithKeys
 	Timeout                time.Duration
+	ExecutionTimeout       time.Duration // Limits the task's attempts in total, zero is unlimited
 	HealthCheckGracePeriod time.Duration
 	LogManager             *LogManager
+	RetryPolicy            RetryPolicy
+	Condition              *TaskCondition // Skips the task unless it holds, nil always runs it
+	VersionConstraint      string         // Service versions the task may be dispatched to, empty allows any
+	PlannedVersion         string         // Service version the orchestration was planned against
+	Priority               Priority       // Orders the task against others held back for the same service
 	logState               *LogState
 	backOff                *back.ExponentialBackOff
 	pauseStart             time.Time // Track pause duration
@@ -193,8 +321,31 @@ type TaskStatusEvent struct {
 	Timestamp       time.Time `json:"timestamp"`
 	ServiceID       string    `json:"serviceId,omitempty"`
 	Error           string    `json:"error,omitempty"`
+	// CacheHit marks a task completed with a cached output of its service, without calling it
+	CacheHit bool `json:"cacheHit,omitempty"`
+	// Rerouted marks a sticky task sent to another instance of its service, as its pinned instance disconnected
+	Rerouted *TaskReroute `json:"rerouted,omitempty"`
+	// Lease marks a task's lease being granted to a service instance, or expiring
+	Lease *TaskLease `json:"lease,omitempty"`
+	// Slow marks a task completed far outside its service's usual durations
+	Slow *TaskDurationAnomaly `json:"slow,omitempty"`
+}
+
+// TaskReroute is the service instance a sticky task fell back to
+type TaskReroute struct {
+	FromInstance string `json:"fromInstance"`
+	ToInstance   string `json:"toInstance"`
 }
 
+// TaskLease is a change to the lease of a service instance executing a task
+type TaskLease struct {
+	Event      string `json:"event"`
+	InstanceID string `json:"instanceId,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Task is sent to a service to execute a subtask. Services acknowledge each delivery by its DeliveryID,
+// a delivery is sent again until acknowledged so services discard deliveries of tasks they're already executing.
 type Task struct {
 	Type            string          `json:"type"`
 	ID              string          `json:"id"`
@@ -202,9 +353,26 @@ type Task struct {
 	ExecutionID     string          `json:"executionId"`
 	IdempotencyKey  IdempotencyKey  `json:"idempotencyKey"`
 	ServiceID       string          `json:"serviceId"`
-	OrchestrationID string          `json:"-"`
+	DeliveryID      string          `json:"deliveryId,omitempty"`
+	Redelivered     bool            `json:"redelivered,omitempty"`
+	TraceParent     string          `json:"traceparent,omitempty"`
+	TraceState      string          `json:"tracestate,omitempty"`
+	OrchestrationID string          `json:"orchestrationId,omitempty"`
+	ProtocolVersion int             `json:"protocolVersion,omitempty"`
 	ProjectID       string          `json:"-"`
 	Status          Status          `json:"-"`
+	// RoutingKey pins the tasks sharing it to one instance of the service, see StickyRouting
+	RoutingKey string `json:"-"`
+}
+
+// TaskCancellation tells a service to stop working on a task for a cancelled orchestration
+type TaskCancellation struct {
+	Type            string `json:"type"`
+	ID              string `json:"id"`
+	OrchestrationID string `json:"orchestrationId"`
+	ServiceID       string `json:"serviceId"`
+	Reason          string `json:"reason,omitempty"`
+	ProtocolVersion int    `json:"protocolVersion,omitempty"`
 }
 
 type TaskResult struct {
@@ -215,12 +383,20 @@ type TaskResult struct {
 	IdempotencyKey IdempotencyKey  `json:"idempotencyKey"`
 	Result         json.RawMessage `json:"result,omitempty"`
 	Error          string          `json:"error,omitempty"`
+	ErrorCode      string          `json:"errorCode,omitempty"`
+	ErrorDetails   json.RawMessage `json:"errorDetails,omitempty"`
+	Retryable      *bool           `json:"retryable,omitempty"`
 	Status         string          `json:"status,omitempty"`
+	DeliveryID     string          `json:"deliveryId,omitempty"`
+	ProbeID        string          `json:"probeId,omitempty"`
 }
 
 type TaskResultPayload struct {
 	Task         json.RawMessage   `json:"task"`
 	Compensation *CompensationData `json:"compensation"`
+	Usage        *TaskUsage        `json:"usage,omitempty"`
+	// ContinueAsNew asks for the orchestration to carry on as a new orchestration once it completes
+	ContinueAsNew *ContinueAsNew `json:"continueAsNew,omitempty"`
 }
 
 type Spec struct {
@@ -253,18 +429,29 @@ type ServiceStorage interface {
 
 	// ListServices returns all services
 	ListServices() ([]*ServiceInfo, error)
+
+	// DeleteService removes a project's service
+	DeleteService(projectID, serviceID string) error
 }
 
 type ServiceInfo struct {
-	Type             ServiceType       `json:"type"`
-	ID               string            `json:"id"`
-	Name             string            `json:"name"`
-	Description      string            `json:"description"`
-	Schema           ServiceSchema     `json:"schema"`
-	Revertible       bool              `json:"revertible"`
-	ProjectID        string            `json:"projectID"`
-	Version          int64             `json:"version"`
-	IdempotencyStore *IdempotencyStore `json:"-"`
+	Type             ServiceType        `json:"type"`
+	ID               string             `json:"id"`
+	Name             string             `json:"name"`
+	Description      string             `json:"description"`
+	Schema           ServiceSchema      `json:"schema"`
+	Revertible       bool               `json:"revertible"`
+	RetryPolicy      *RetryPolicy       `json:"retryPolicy,omitempty"`
+	Cache            *ResultCachePolicy `json:"cache,omitempty"`
+	ProjectID        string             `json:"projectID"`
+	Version          int64              `json:"version"`
+	Endpoint         string             `json:"endpoint,omitempty"`
+	Routing          ServiceRouting     `json:"routing,omitempty"`
+	SemanticVersion  string             `json:"semanticVersion,omitempty"`
+	Capabilities     []string           `json:"capabilities,omitempty"`
+	Revisions        []ServiceRevision  `json:"revisions,omitempty"`
+	EndpointSecret   string             `json:"endpointSecret,omitempty"`
+	IdempotencyStore *IdempotencyStore  `json:"-"`
 }
 
 // OrchestrationStorage defines the interface for orchestration persistence operations
@@ -277,23 +464,60 @@ type OrchestrationStorage interface {
 
 	// ListProjectOrchestrations returns all orchestrations for a project
 	ListProjectOrchestrations(projectID string) ([]*Orchestration, error)
+
+	// DeleteOrchestration removes an orchestration for good
+	DeleteOrchestration(orchestration *Orchestration) error
 }
 
 type Orchestration struct {
-	ID                     string            `json:"id"`
-	ProjectID              string            `json:"projectID"`
-	Action                 Action            `json:"action"`
-	Params                 ActionParams      `json:"data"`
-	Plan                   *ExecutionPlan    `json:"plan"`
-	Results                []json.RawMessage `json:"results"`
-	Status                 Status            `json:"status"`
-	Error                  json.RawMessage   `json:"error,omitempty"`
-	Timestamp              time.Time         `json:"timestamp"`
-	Timeout                *Duration         `json:"timeout,omitempty"`
-	HealthCheckGracePeriod *Duration         `json:"healthCheckGracePeriod,omitempty"`
-	Webhook                string            `json:"webhook"`
-	TaskZero               json.RawMessage   `json:"taskZero"`
-	GroundingHit           *GroundingHit     `json:"groundingHit,omitempty"`
+	ID                     string              `json:"id"`
+	ProjectID              string              `json:"projectID"`
+	Action                 Action              `json:"action"`
+	Params                 ActionParams        `json:"data"`
+	Plan                   *ExecutionPlan      `json:"plan"`
+	Results                []json.RawMessage   `json:"results"`
+	Status                 Status              `json:"status"`
+	Error                  json.RawMessage     `json:"error,omitempty"`
+	Timestamp              time.Time           `json:"timestamp"`
+	RunAt                  *time.Time          `json:"runAt,omitempty"`
+	Priority               Priority            `json:"priority,omitempty"`
+	Timeout                *Duration           `json:"timeout,omitempty"`
+	HealthCheckGracePeriod *Duration           `json:"healthCheckGracePeriod,omitempty"`
+	OrchestrationTimeout   *Duration           `json:"orchestrationTimeout,omitempty"`
+	TaskExecutionTimeout   *Duration           `json:"taskExecutionTimeout,omitempty"`
+	SLA                    *Duration           `json:"sla,omitempty"`
+	SLADeadline            *time.Time          `json:"slaDeadline,omitempty"`
+	SLABreached            bool                `json:"slaBreached,omitempty"`
+	RetryPolicy            *RetryPolicy        `json:"retryPolicy,omitempty"`
+	Budget                 *Budget             `json:"budget,omitempty"`
+	Usage                  *OrchestrationUsage `json:"usage,omitempty"`
+	Approvals              []ApprovalGate      `json:"approvals,omitempty"`
+	PendingApprovals       []PendingApproval   `json:"pendingApprovals,omitempty"`
+	PausedBy               string              `json:"pausedBy,omitempty"`
+	SubOrchestrations      []SubOrchestration  `json:"subOrchestrations,omitempty"`
+	FanOut                 []FanOutSpec        `json:"fanOut,omitempty"`
+	Branches               []Branch            `json:"branches,omitempty"`
+	TaskGraph              []PlannedTask       `json:"taskGraph,omitempty"`
+	ParentID               string              `json:"parentId,omitempty"`
+	RetryOf                string              `json:"retryOf,omitempty"`
+	CloneOf                string              `json:"cloneOf,omitempty"`
+	ContinuedFrom          string              `json:"continuedFrom,omitempty"`
+	ContinuedAs            string              `json:"continuedAs,omitempty"`
+	Continuation           int                 `json:"continuation,omitempty"`
+	ContinueAsNew          *ContinueAsNew      `json:"continueAsNew,omitempty"`
+	Template               string              `json:"template,omitempty"`
+	Labels                 map[string]string   `json:"labels,omitempty"`
+	ServiceVersions        map[string]string   `json:"serviceVersions,omitempty"`
+	PlannedVersions        map[string]string   `json:"plannedVersions,omitempty"`
+	DryRun                 bool                `json:"dryRun,omitempty"`
+	Children               []OrchestrationLink `json:"children,omitempty"`
+	Webhook                string              `json:"webhook"`
+	Callback               *CallbackWebhook    `json:"callback,omitempty"`
+	StreamResults          bool                `json:"streamResults,omitempty"`
+	TaskZero               json.RawMessage     `json:"taskZero"`
+	GroundingHit           *GroundingHit       `json:"groundingHit,omitempty"`
+	// Lifecycle records when the orchestration reached each stage, for its timeline
+	Lifecycle []LifecycleEvent `json:"lifecycle,omitempty"`
 }
 
 type Duration struct {
@@ -358,6 +582,11 @@ type SubTask struct {
 	Capabilities   []string       `json:"capabilities,omitempty"`
 	ExpectedInput  Spec           `json:"expected_input,omitempty"`
 	ExpectedOutput Spec           `json:"expected_output,omitempty"`
+	Type           string         `json:"type,omitempty"`
+	Message        string         `json:"message,omitempty"`
+	FanOut         *FanOut        `json:"fan_out,omitempty"`
+	Condition      *TaskCondition `json:"condition,omitempty"`
+	DependsOn      []string       `json:"depends_on,omitempty"`
 }
 
 type TaskDependencyMapping struct {
@@ -0,0 +1,226 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	usageDateLayout         = "2006-01-02"
+	defaultProjectUsageDays = 30
+)
+
+// LLMUsage is the tokens consumed by LLM calls, and what they cost
+type LLMUsage struct {
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Tokens           int     `json:"tokens"`
+	CostUSD          float64 `json:"costUSD"`
+}
+
+func (u *LLMUsage) add(other LLMUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.Tokens += other.Tokens
+	u.CostUSD += other.CostUSD
+}
+
+// PlanningUsage is what planning an orchestration cost, across the LLM calls made to decompose its action
+type PlanningUsage struct {
+	LLMUsage
+	Calls int    `json:"calls"`
+	Model string `json:"model,omitempty"`
+}
+
+// DailyUsage totals a project's planning and task usage over a UTC day
+type DailyUsage struct {
+	Date     string   `json:"date"`
+	Planning LLMUsage `json:"planning"`
+	Tasks    LLMUsage `json:"tasks"`
+	Tokens   int      `json:"tokens"`
+	CostUSD  float64  `json:"costUSD"`
+}
+
+func (d *DailyUsage) add(other DailyUsage) {
+	d.Planning.add(other.Planning)
+	d.Tasks.add(other.Tasks)
+	d.Tokens = d.Planning.Tokens + d.Tasks.Tokens
+	d.CostUSD = d.Planning.CostUSD + d.Tasks.CostUSD
+}
+
+// ProjectUsage totals a project's usage between two dates, inclusive. Days without any usage are left out.
+type ProjectUsage struct {
+	ProjectID string       `json:"projectId"`
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Planning  LLMUsage     `json:"planning"`
+	Tasks     LLMUsage     `json:"tasks"`
+	Tokens    int          `json:"tokens"`
+	CostUSD   float64      `json:"costUSD"`
+	Days      []DailyUsage `json:"days"`
+}
+
+// UsageStorage keeps each project's usage aggregated by day
+type UsageStorage interface {
+	AddProjectUsage(projectID string, usage DailyUsage) error
+	ListProjectUsage(projectID, from, to string) ([]DailyUsage, error)
+}
+
+type llmUsageKey struct{}
+
+// withLLMUsage has the LLM calls made with the context report their usage to record
+func withLLMUsage(ctx context.Context, record func(usage LLMUsage, model string)) context.Context {
+	return context.WithValue(ctx, llmUsageKey{}, record)
+}
+
+func reportLLMUsage(ctx context.Context, usage LLMUsage, model string) {
+	if record, ok := ctx.Value(llmUsageKey{}).(func(LLMUsage, string)); ok {
+		record(usage, model)
+	}
+}
+
+// llmCallUsage prices an LLM call's tokens at the configured cost per million prompt and completion tokens
+func llmCallUsage(promptTokens, completionTokens int, pricing LLMPricing) LLMUsage {
+	return LLMUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Tokens:           promptTokens + completionTokens,
+		CostUSD: float64(promptTokens)*pricing.PromptCostPerMillion/1_000_000 +
+			float64(completionTokens)*pricing.CompletionCostPerMillion/1_000_000,
+	}
+}
+
+// recordPlanningUsage adds an LLM call made while planning the orchestration to its usage and its project's.
+// Planning usage doesn't count against the orchestration's budget, which caps what its tasks consume.
+func (p *PlanEngine) recordPlanningUsage(orchestration *Orchestration, usage LLMUsage, model string) {
+	p.orchestrationStoreMu.Lock()
+	if orchestration.Usage == nil {
+		orchestration.Usage = &OrchestrationUsage{}
+	}
+	if orchestration.Usage.Planning == nil {
+		orchestration.Usage.Planning = &PlanningUsage{}
+	}
+	orchestration.Usage.Planning.add(usage)
+	orchestration.Usage.Planning.Calls++
+	orchestration.Usage.Planning.Model = model
+	projectID := orchestration.ProjectID
+	p.orchestrationStoreMu.Unlock()
+
+	p.addProjectUsage(projectID, DailyUsage{Planning: usage})
+}
+
+// taskLLMUsage is a task's reported usage, its total tokens default to its prompt and completion tokens
+func taskLLMUsage(usage *TaskUsage) LLMUsage {
+	tokens := usage.Tokens
+	if tokens == 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return LLMUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Tokens:           tokens,
+		CostUSD:          usage.CostUSD,
+	}
+}
+
+func (p *PlanEngine) addProjectUsage(projectID string, usage DailyUsage) {
+	if p.Usage == nil {
+		return
+	}
+	usage.Date = time.Now().UTC().Format(usageDateLayout)
+	usage.add(DailyUsage{})
+	if err := p.Usage.AddProjectUsage(projectID, usage); err != nil {
+		p.Logger.Error().Err(err).Str("ProjectID", projectID).Msg("Failed to record project usage")
+	}
+}
+
+// ProjectUsage totals the project's daily usage between the dates
+func (p *PlanEngine) ProjectUsage(projectID, from, to string) (*ProjectUsage, error) {
+	result := &ProjectUsage{ProjectID: projectID, From: from, To: to, Days: []DailyUsage{}}
+	if p.Usage == nil {
+		return result, nil
+	}
+
+	days, err := p.Usage.ListProjectUsage(projectID, from, to)
+	if err != nil {
+		return nil, errs.E(errs.Internal, err)
+	}
+	for _, day := range days {
+		result.Planning.add(day.Planning)
+		result.Tasks.add(day.Tasks)
+		result.Days = append(result.Days, day)
+	}
+	result.Tokens = result.Planning.Tokens + result.Tasks.Tokens
+	result.CostUSD = result.Planning.CostUSD + result.Tasks.CostUSD
+	return result, nil
+}
+
+// parseUsagePeriod reads the from and to dates, defaulting to the last defaultProjectUsageDays days. Usage is
+// only kept for UsageRetention, so periods can't be longer.
+func parseUsagePeriod(r *http.Request) (string, string, error) {
+	query := r.URL.Query()
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := query.Get("to"); value != "" {
+		date, err := time.Parse(usageDateLayout, value)
+		if err != nil {
+			return "", "", errs.E(errs.Validation, errs.Parameter("to"), "to must be a date, e.g. 2025-01-31")
+		}
+		to = date
+	}
+
+	from := to.AddDate(0, 0, -(defaultProjectUsageDays - 1))
+	if value := query.Get("from"); value != "" {
+		date, err := time.Parse(usageDateLayout, value)
+		if err != nil {
+			return "", "", errs.E(errs.Validation, errs.Parameter("from"), "from must be a date, e.g. 2025-01-01")
+		}
+		from = date
+	}
+
+	switch {
+	case from.After(to):
+		return "", "", errs.E(errs.Validation, errs.Parameter("from"), "from must not be after to")
+	case to.Sub(from) >= UsageRetention:
+		return "", "", errs.E(errs.Validation, errs.Parameter("from"), fmt.Sprintf("usage is kept for %d days", int(UsageRetention.Hours()/24)))
+	}
+	return from.Format(usageDateLayout), to.Format(usageDateLayout), nil
+}
+
+// ProjectUsageHandler returns the project's planning and task usage by day
+func (app *App) ProjectUsageHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProjectFor(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	from, to, err := parseUsagePeriod(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	usage, err := app.Engine.ProjectUsage(project.ID, from, to)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Internal, err))
+		return
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAccounting(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.Engine.Usage = app.Db
+
+	orchestration := &Orchestration{ID: "o_usage", ProjectID: project.ID, Status: Processing}
+	app.Engine.orchestrationStore[orchestration.ID] = orchestration
+
+	t.Run("planning LLM calls are priced and added to the orchestration", func(t *testing.T) {
+		pricing := LLMPricing{PromptCostPerMillion: 1.1, CompletionCostPerMillion: 4.4}
+		ctx := withLLMUsage(context.Background(), func(usage LLMUsage, model string) {
+			app.Engine.recordPlanningUsage(orchestration, usage, model)
+		})
+		reportLLMUsage(ctx, llmCallUsage(1000, 500, pricing), O3MiniReasoningModel)
+		reportLLMUsage(ctx, llmCallUsage(1000, 500, pricing), O3MiniReasoningModel)
+		reportLLMUsage(context.Background(), llmCallUsage(1000, 500, pricing), O3MiniReasoningModel)
+
+		usage := app.Engine.orchestrationUsage(orchestration.ID)
+		require.NotNil(t, usage)
+		require.NotNil(t, usage.Planning)
+		assert.Equal(t, 2, usage.Planning.Calls)
+		assert.Equal(t, 3000, usage.Planning.Tokens)
+		assert.Equal(t, 2000, usage.Planning.PromptTokens)
+		assert.InDelta(t, 0.0066, usage.Planning.CostUSD, 1e-9)
+		assert.Equal(t, O3MiniReasoningModel, usage.Planning.Model)
+		assert.Zero(t, usage.Tokens, "planning isn't capped by the orchestration's budget")
+	})
+
+	t.Run("task usage totals default to the reported prompt and completion tokens", func(t *testing.T) {
+		app.Engine.recordTaskUsage(orchestration.ID, "task1", &TaskUsage{PromptTokens: 300, CompletionTokens: 100, CostUSD: 0.01})
+		app.Engine.recordTaskUsage(orchestration.ID, "task2", &TaskUsage{Tokens: 50, CostUSD: 0.002})
+
+		usage := app.Engine.orchestrationUsage(orchestration.ID)
+		assert.Equal(t, 450, usage.Tokens)
+		assert.Equal(t, 300, usage.PromptTokens)
+		assert.Equal(t, 100, usage.CompletionTokens)
+		assert.InDelta(t, 0.012, usage.CostUSD, 1e-9)
+	})
+
+	getUsage := func(projectID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/projects/"+projectID+"/usage"+query, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("the project's usage is aggregated by day", func(t *testing.T) {
+		earlier := DailyUsage{Date: time.Now().UTC().AddDate(0, 0, -3).Format(usageDateLayout), Tasks: LLMUsage{Tokens: 1000, CostUSD: 1}}
+		require.NoError(t, app.Db.AddProjectUsage(project.ID, earlier))
+		require.NoError(t, app.Db.AddProjectUsage("p_other", DailyUsage{Date: earlier.Date, Tasks: LLMUsage{Tokens: 7}}))
+
+		rr := getUsage(project.ID, "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var usage ProjectUsage
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&usage))
+		require.Len(t, usage.Days, 2)
+		assert.Equal(t, earlier.Date, usage.Days[0].Date)
+		assert.Equal(t, time.Now().UTC().Format(usageDateLayout), usage.Days[1].Date)
+		assert.Equal(t, 3000, usage.Days[1].Planning.Tokens)
+		assert.Equal(t, 450, usage.Days[1].Tasks.Tokens)
+		assert.Equal(t, 3450, usage.Days[1].Tokens)
+		assert.Equal(t, 1450, usage.Tasks.Tokens)
+		assert.Equal(t, 4450, usage.Tokens)
+		assert.InDelta(t, 1.0186, usage.CostUSD, 1e-9)
+
+		rr = getUsage(project.ID, "?to="+earlier.Date+"&from="+earlier.Date)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&usage))
+		require.Len(t, usage.Days, 1)
+		assert.Equal(t, 1000, usage.Tokens)
+	})
+
+	t.Run("rejects invalid periods and other projects", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, getUsage(project.ID, "?from=yesterday").Code)
+		assert.Equal(t, http.StatusBadRequest, getUsage(project.ID, "?from=2025-02-01&to=2025-01-01").Code)
+		assert.Equal(t, http.StatusBadRequest, getUsage(project.ID, "?from=2024-01-01&to=2025-01-01").Code)
+		assert.Equal(t, http.StatusBadRequest, getUsage("p_other", "").Code)
+	})
+}
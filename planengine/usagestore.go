@@ -0,0 +1,93 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	usageKeyPrefix = "usage:"
+	// usageUpdateAttempts bounds retrying an update that conflicted with a concurrent one for the same day
+	usageUpdateAttempts = 5
+)
+
+func usageKey(projectID, date string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", usageKeyPrefix, projectID, date))
+}
+
+// AddProjectUsage adds usage to the project's total for its day, which is kept for UsageRetention
+func (b *BadgerDB) AddProjectUsage(projectID string, usage DailyUsage) error {
+	var err error
+	for attempt := 0; attempt < usageUpdateAttempts; attempt++ {
+		err = b.db.Update(func(txn *badger.Txn) error {
+			key := usageKey(projectID, usage.Date)
+			day := DailyUsage{Date: usage.Date}
+
+			item, err := txn.Get(key)
+			switch {
+			case errors.Is(err, badger.ErrKeyNotFound):
+			case err != nil:
+				return err
+			default:
+				if err := item.Value(func(val []byte) error {
+					return b.decodePayload(val, &day)
+				}); err != nil {
+					return fmt.Errorf("failed to load usage %s: %w", key, err)
+				}
+			}
+
+			day.add(usage)
+			data, err := b.encodePayload(day)
+			if err != nil {
+				return fmt.Errorf("failed to marshal usage: %w", err)
+			}
+			return txn.SetEntry(badger.NewEntry(key, data).WithTTL(UsageRetention))
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// ListProjectUsage returns the project's daily usage from one date to another, inclusive, oldest first
+func (b *BadgerDB) ListProjectUsage(projectID, from, to string) ([]DailyUsage, error) {
+	var days []DailyUsage
+	prefix := []byte(fmt.Sprintf("%s%s:", usageKeyPrefix, projectID))
+	last := string(usageKey(projectID, to))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(usageKey(projectID, from)); it.ValidForPrefix(prefix); it.Next() {
+			if string(it.Item().Key()) > last {
+				break
+			}
+			var day DailyUsage
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &day)
+			}); err != nil {
+				return fmt.Errorf("failed to load usage %s: %w", it.Item().Key(), err)
+			}
+			days = append(days, day)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
@@ -0,0 +1,309 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	v "github.com/RussellLuo/validating/v3"
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+// Fields clients may submit on each validated endpoint, anything else is rejected.
+// Nested documents such as service schemas are not checked, they carry JSON schema annotations.
+var (
+	projectRegistrationFields    = []string{"name", "webhooks", "security", "limits", "createdAt"}
+	projectUpdateFields          = []string{"name", "security", "limits", "notifications", "alerts"}
+	projectSecurityFields        = []string{"allowedCidrs", "requireRegistrationTokens"}
+	projectNotificationsFields   = []string{"channels"}
+	projectMemberFields          = []string{"subject", "email", "role"}
+	projectLimitsFields          = []string{"maxConcurrentOrchestrations"}
+	projectAlertsFields          = []string{"rules"}
+	projectWebhookUpdateFields   = []string{"url", "events", "format", "headers", "timeout"}
+	wsTokenFields                = []string{"serviceId"}
+	approvalDecisionFields       = []string{"token", "approved", "comment"}
+	certificateRequestFields     = []string{"serviceId"}
+	drainFields                  = []string{"timeout"}
+	cancelFields                 = []string{"reason"}
+	secretRotationFields         = []string{"gracePeriod"}
+	adminFailFields              = []string{"reason"}
+	serviceRegistrationFields    = []string{"id", "name", "description", "schema", "revertible", "version", "retryPolicy", "cache", "endpoint", "routing", "semanticVersion", "capabilities"}
+	orchestrationFields          = []string{"action", "data", "webhook", "runAt", "priority", "timeout", "healthCheckGracePeriod", "orchestrationTimeout", "taskExecutionTimeout", "sla", "retryPolicy", "budget", "approvals", "subOrchestrations", "fanOut", "branches", "taskGraph", "streamResults", "labels", "dryRun", "callback", "serviceVersions"}
+	scheduleFields               = []string{"cron", "orchestration"}
+	templatedOrchestrationFields = []string{"template", "params", "webhook", "callback", "streamResults", "labels", "runAt", "priority", "dryRun"}
+	templateFields               = []string{"name", "description", "params", "orchestration"}
+	scheduleTemplateFields       = []string{"action", "data", "webhook", "priority", "timeout", "healthCheckGracePeriod", "orchestrationTimeout", "taskExecutionTimeout", "sla", "retryPolicy", "budget", "approvals", "subOrchestrations", "fanOut", "branches", "taskGraph", "streamResults", "labels", "serviceVersions"}
+)
+
+// decodeRequest strictly decodes a JSON object request body into dst.
+// Oversized bodies, malformed JSON, unknown fields and mistyped values are returned as structured errors.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst any, allowed []string) error {
+	body, err := readRequestBody(w, r)
+	if err != nil {
+		return err
+	}
+	return decodeObject(body, dst, allowed, "")
+}
+
+// decodeOptionalRequest is decodeRequest for handlers whose body may be left out, dst is left as is without one
+func decodeOptionalRequest(w http.ResponseWriter, r *http.Request, dst any, allowed []string) error {
+	body, err := readOptionalRequestBody(w, r)
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	return decodeObject(body, dst, allowed, "")
+}
+
+// readRequestBody reads a size-limited, non-empty request body for decoding
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := readOptionalRequestBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), "request body is empty")
+	}
+	return body, nil
+}
+
+// readOptionalRequestBody reads a size-limited request body, returning nil when it's empty or only whitespace
+func readOptionalRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errs.E(errs.InvalidRequest, errs.Code(RequestBodyTooLargeErrCode), fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		}
+		return nil, errs.E(errs.InvalidRequest, err)
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	return body, nil
+}
+
+// decodeObject strictly decodes a JSON object into dst, prefixing reported fields with the object's path
+func decodeObject(body []byte, dst any, allowed []string, path string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		if path != "" {
+			return errs.E(errs.Validation, errs.Code(JSONMarshalingFailErrCode), errs.Parameter(path), path+" must be a JSON object")
+		}
+		return errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), "request body must be a JSON object")
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !slices.Contains(allowed, name) {
+			return errs.E(errs.Validation, errs.Code(UnknownRequestFieldErrCode), errs.Parameter(fieldPath(path, name)), fmt.Sprintf("unknown field %q", fieldPath(path, name)))
+		}
+	}
+
+	if err := json.Unmarshal(body, dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			field := fieldPath(path, typeErr.Field)
+			return errs.E(errs.Validation, errs.Code(JSONMarshalingFailErrCode), errs.Parameter(field), fmt.Sprintf("%s must be a %s", field, typeErr.Type))
+		}
+		return errs.E(errs.InvalidRequest, errs.Code(JSONMarshalingFailErrCode), err)
+	}
+
+	return nil
+}
+
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func missingField(name string) error {
+	return errs.E(errs.Validation, errs.Code(MissingRequiredFieldErrCode), errs.Parameter(name), fmt.Sprintf("%s is required", name))
+}
+
+func validateProjectRegistration(project *Project) error {
+	if strings.TrimSpace(project.Name) == "" {
+		return missingField("name")
+	}
+	if err := project.Security.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("security"), err)
+	}
+	if err := project.Limits.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("limits"), err)
+	}
+	return nil
+}
+
+func validateProjectUpdate(update *ProjectUpdate) error {
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return missingField("name")
+	}
+	if update.Security != nil {
+		if err := update.Security.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter("security"), err)
+		}
+	}
+	if update.Limits != nil {
+		if err := update.Limits.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter("limits"), err)
+		}
+	}
+	if update.Notifications != nil {
+		if err := update.Notifications.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter("notifications"), err)
+		}
+	}
+	if update.Alerts != nil {
+		if err := update.Alerts.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter("alerts"), err)
+		}
+	}
+	return nil
+}
+
+func validateServiceRegistration(service *ServiceInfo) error {
+	if strings.TrimSpace(service.Name) == "" {
+		return missingField("name")
+	}
+	if strings.TrimSpace(service.Description) == "" {
+		return missingField("description")
+	}
+	if service.Schema.Input.Type == "" {
+		return missingField("schema.input")
+	}
+	if service.Schema.Output.Type == "" {
+		return missingField("schema.output")
+	}
+
+	if validationErrs := v.Validate(service.Validation()); len(validationErrs) > 0 {
+		first := validationErrs[0]
+		return errs.E(errs.Validation, errs.Parameter(first.Field()), first.Message())
+	}
+	if err := service.RetryPolicy.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("retryPolicy"), err)
+	}
+	if err := service.Cache.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("cache"), err)
+	}
+	if service.Cache != nil && service.Revertible {
+		return errs.E(errs.Validation, errs.Parameter("cache"), "revertible services cannot be cached")
+	}
+	if err := service.Routing.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("routing"), err)
+	}
+	if err := validateCapabilityTags(service.Capabilities); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("capabilities"), err)
+	}
+	if service.SemanticVersion != "" {
+		if _, err := ParseSemVer(service.SemanticVersion); err != nil {
+			return errs.E(errs.Validation, errs.Parameter("semanticVersion"), err)
+		}
+	}
+	if service.Endpoint != "" {
+		return validateServiceEndpoint(service.Endpoint)
+	}
+	return nil
+}
+
+func validateOrchestrationRequest(orchestration *Orchestration) error {
+	if strings.TrimSpace(orchestration.Action.Content) == "" {
+		return missingField("action.content")
+	}
+	if strings.TrimSpace(orchestration.Webhook) == "" && orchestration.Callback == nil {
+		return missingField("webhook")
+	}
+	if callback := orchestration.Callback; callback != nil {
+		if strings.TrimSpace(callback.Url) == "" {
+			return missingField("callback.url")
+		}
+		if _, err := url.ParseRequestURI(callback.Url); err != nil {
+			return errs.E(errs.Validation, errs.Parameter("callback.url"), err)
+		}
+	}
+	for i, param := range orchestration.Params {
+		if strings.TrimSpace(param.Field) == "" {
+			return missingField(fmt.Sprintf("data[%d].field", i))
+		}
+	}
+	if orchestration.OrchestrationTimeout != nil && orchestration.OrchestrationTimeout.Duration <= 0 {
+		return errs.E(errs.Validation, errs.Parameter("orchestrationTimeout"), "orchestrationTimeout must be positive")
+	}
+	if orchestration.TaskExecutionTimeout != nil && orchestration.TaskExecutionTimeout.Duration <= 0 {
+		return errs.E(errs.Validation, errs.Parameter("taskExecutionTimeout"), "taskExecutionTimeout must be positive")
+	}
+	if err := orchestration.RetryPolicy.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("retryPolicy"), err)
+	}
+	if err := validateSLA(orchestration.SLA); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("sla"), err)
+	}
+	if err := orchestration.Budget.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("budget"), err)
+	}
+	if err := orchestration.Priority.Validate(); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("priority"), err)
+	}
+	for i, gate := range orchestration.Approvals {
+		if strings.TrimSpace(gate.Service) == "" {
+			return missingField(fmt.Sprintf("approvals[%d].service", i))
+		}
+	}
+	subOrchestrationIDs := make(map[string]struct{}, len(orchestration.SubOrchestrations))
+	for i, sub := range orchestration.SubOrchestrations {
+		if strings.TrimSpace(sub.ID) == "" {
+			return missingField(fmt.Sprintf("subOrchestrations[%d].id", i))
+		}
+		if strings.TrimSpace(sub.Action.Content) == "" {
+			return missingField(fmt.Sprintf("subOrchestrations[%d].action.content", i))
+		}
+		if _, exists := subOrchestrationIDs[sub.ID]; exists {
+			return errs.E(errs.Validation, errs.Parameter(fmt.Sprintf("subOrchestrations[%d].id", i)), "sub-orchestration ids must be unique")
+		}
+		subOrchestrationIDs[sub.ID] = struct{}{}
+	}
+	for i, fanOut := range orchestration.FanOut {
+		if strings.TrimSpace(fanOut.Service) == "" {
+			return missingField(fmt.Sprintf("fanOut[%d].service", i))
+		}
+		if strings.TrimSpace(fanOut.Input) == "" {
+			return missingField(fmt.Sprintf("fanOut[%d].input", i))
+		}
+		if err := fanOut.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter(fmt.Sprintf("fanOut[%d].maxParallel", i)), err)
+		}
+	}
+	for i, branch := range orchestration.Branches {
+		if err := branch.Validate(); err != nil {
+			return errs.E(errs.Validation, errs.Parameter(fmt.Sprintf("branches[%d]", i)), err)
+		}
+	}
+	if err := validateLabels(orchestration.Labels); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("labels"), err)
+	}
+	if err := validateServiceVersions(orchestration.ServiceVersions); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("serviceVersions"), err)
+	}
+	if err := validateTaskGraph(orchestration.TaskGraph, orchestration.Params); err != nil {
+		return errs.E(errs.Validation, errs.Parameter("taskGraph"), err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestValidation(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.CA = newTestCertificateAuthority(t)
+
+	send := func(path, body string) (int, Problem) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", project.APIKey))
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+
+		var response Problem
+		if w.Code >= http.StatusBadRequest {
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		}
+		return w.Code, response
+	}
+
+	validSchema := `{"input":{"type":"object","title":"Input","properties":{"id":{"type":"string","title":"Id"}}},"output":{"type":"object","properties":{"ok":{"type":"boolean"}}}}`
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		wantCode  string
+		wantParam string
+	}{
+		{"empty project body", "/register/project", ``, JSONMarshalingFailErrCode, ""},
+		{"project body not an object", "/register/project", `["demo"]`, JSONMarshalingFailErrCode, ""},
+		{"unknown project field", "/register/project", `{"name":"demo","apiKey":"sk-orra-chosen"}`, UnknownRequestFieldErrCode, "apiKey"},
+		{"missing project name", "/register/project", `{"webhooks":[]}`, MissingRequiredFieldErrCode, "name"},
+		{"mistyped project field", "/register/project", `{"name":42}`, JSONMarshalingFailErrCode, "name"},
+		{"unknown service field", "/register/service", `{"name":"echo","description":"echoes","schema":` + validSchema + `,"status":"ready"}`, UnknownRequestFieldErrCode, "status"},
+		{"missing service description", "/register/service", `{"name":"echo","schema":` + validSchema + `}`, MissingRequiredFieldErrCode, "description"},
+		{"missing service schema", "/register/agent", `{"name":"echo","description":"echoes"}`, MissingRequiredFieldErrCode, "schema.input"},
+		{"unknown orchestration field", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","plan":{}}`, UnknownRequestFieldErrCode, "plan"},
+		{"missing orchestration action", "/orchestrations", `{"webhook":"http://localhost/hook"}`, MissingRequiredFieldErrCode, "action.content"},
+		{"missing orchestration webhook", "/orchestrations", `{"action":{"content":"echo"}}`, MissingRequiredFieldErrCode, "webhook"},
+		{"invalid service retry policy", "/register/service", `{"name":"echo","description":"echoes","schema":` + validSchema + `,"retryPolicy":{"backoffFactor":0.5}}`, ValidationFailedErrCode, "retryPolicy"},
+		{"cached revertible service", "/register/service", `{"name":"echo","description":"echoes","schema":` + validSchema + `,"revertible":true,"cache":{"ttl":"1h"}}`, ValidationFailedErrCode, "cache"},
+		{"invalid orchestration retry policy", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","retryPolicy":{"maxAttempts":100}}`, ValidationFailedErrCode, "retryPolicy"},
+		{"unknown orchestration priority", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","priority":"urgent"}`, ValidationFailedErrCode, "priority"},
+		{"duplicate sub-orchestration ids", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","subOrchestrations":[{"id":"a","action":{"content":"one"}},{"id":"a","action":{"content":"two"}}]}`, ValidationFailedErrCode, "subOrchestrations[1].id"},
+		{"fan out parallelism out of range", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","fanOut":[{"service":"echo","input":"urls","maxParallel":1000}]}`, ValidationFailedErrCode, "fanOut[0].maxParallel"},
+		{"unknown branch operator", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","branches":[{"when":{"service":"fraud","field":"score","operator":"<","value":0.3},"then":["refund"]}]}`, ValidationFailedErrCode, "branches[0]"},
+		{"task graph dependency cycle", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","taskGraph":[{"id":"a","service":"echo","input":{"x":"$b.y"}},{"id":"b","service":"echo","input":{"y":"$a.x"}}]}`, ValidationFailedErrCode, "taskGraph"},
+		{"negative orchestration sla", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","sla":"-1m"}`, ValidationFailedErrCode, "sla"},
+		{"budget without limits", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","budget":{"onExceeded":"pause"}}`, ValidationFailedErrCode, "budget"},
+		{"invalid orchestration label", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","labels":{"tenant:acme":"yes"}}`, ValidationFailedErrCode, "labels"},
+		{"orchestration param without field", "/orchestrations", `{"action":{"content":"echo"},"webhook":"http://localhost/hook","data":[{"value":1}]}`, MissingRequiredFieldErrCode, "data[0].field"},
+		{"unknown websocket token field", "/auth/ws-token", `{"serviceId":"s_echo","service":"s_echo"}`, UnknownRequestFieldErrCode, "service"},
+		{"unknown certificate request field", "/certificates", `{"serviceId":"s_echo","commonName":"s_echo"}`, UnknownRequestFieldErrCode, "commonName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := send(tt.path, tt.body)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, tt.wantCode, response.Code)
+			assert.Equal(t, tt.wantParam, response.Param)
+		})
+	}
+
+	t.Run("oversized body is rejected", func(t *testing.T) {
+		body := `{"name":"` + strings.Repeat("a", int(MaxRequestBodyBytes)) + `"}`
+		status, response := send("/register/project", body)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, RequestBodyTooLargeErrCode, response.Code)
+	})
+
+	t.Run("service schemas may carry JSON schema annotations", func(t *testing.T) {
+		status, _ := send("/register/service", `{"name":"echo","description":"echoes","schema":`+validSchema+`}`)
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("well formed project registers", func(t *testing.T) {
+		status, _ := send("/register/project", `{"name":"demo","createdAt":"2024-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusCreated, status)
+	})
+}
@@ -0,0 +1,85 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/olahol/melody"
+)
+
+const (
+	// APIVersionHeader carries the HTTP API version a client expects on requests, and the version that served
+	// the request on responses
+	APIVersionHeader = "X-Orra-API-Version"
+	// CurrentAPIVersion is the HTTP API version served under APIVersionPrefix and the legacy unprefixed paths
+	CurrentAPIVersion = "1"
+	APIVersionPrefix  = "/api/v" + CurrentAPIVersion
+)
+
+// WSProtocolVersionQueryParam negotiates the version of the task and result message schema a service speaks
+const WSProtocolVersionQueryParam = "protocolVersion"
+
+// WSProtocolError tells a service its message wasn't handled, because it was in a protocol version the
+// connection didn't negotiate
+const WSProtocolError = "protocol_error"
+
+const (
+	// ProtocolVersion1 is the original message schema, services connecting without a version speak it
+	ProtocolVersion1 = 1
+	// CurrentProtocolVersion is the latest message schema the plan engine speaks
+	CurrentProtocolVersion = ProtocolVersion1
+)
+
+// SupportedProtocolVersions are the message schema versions services may connect with, oldest first
+var SupportedProtocolVersions = []int{ProtocolVersion1}
+
+func validateProtocolVersion(value string) error {
+	if value == "" {
+		return nil
+	}
+	if version, err := strconv.Atoi(value); err != nil || !slices.Contains(SupportedProtocolVersions, version) {
+		return fmt.Errorf("unsupported protocol version %q, supported versions are %v", value, SupportedProtocolVersions)
+	}
+	return nil
+}
+
+// sessionProtocolVersion returns the protocol version a service negotiated for its WebSocket. Other transports
+// have their message schema fixed by their own framing, so they always speak the original version.
+func sessionProtocolVersion(s serviceSession) int {
+	if ws, ok := s.(*melody.Session); ok && ws.Request != nil {
+		if version, err := strconv.Atoi(ws.Request.URL.Query().Get(WSProtocolVersionQueryParam)); err == nil {
+			return version
+		}
+	}
+	return ProtocolVersion1
+}
+
+// rejectProtocolVersion tells a service the message it sent was in a protocol version its connection didn't
+// negotiate, along with the version it did and those the plan engine speaks. The message isn't acknowledged.
+func (wsm *WebSocketManager) rejectProtocolVersion(s serviceSession, messageID string, version int) error {
+	message, err := json.Marshal(struct {
+		Type                      string `json:"type"`
+		ID                        string `json:"id"`
+		Error                     string `json:"error"`
+		ProtocolVersion           int    `json:"protocolVersion"`
+		SupportedProtocolVersions []int  `json:"supportedProtocolVersions"`
+	}{
+		Type:                      WSProtocolError,
+		ID:                        messageID,
+		Error:                     fmt.Sprintf("protocol version %d wasn't negotiated, the connection speaks version %d", version, sessionProtocolVersion(s)),
+		ProtocolVersion:           sessionProtocolVersion(s),
+		SupportedProtocolVersions: SupportedProtocolVersions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal protocol error: %w", err)
+	}
+	return wsm.writeMessage(s, message)
+}
@@ -0,0 +1,97 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolVersionNegotiation(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.Nop())
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleMessage(func(s *melody.Session, msg []byte) {
+		wsm.HandleMessage(s, msg, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?" + WSProtocolVersionQueryParam + "=1"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := func() map[string]any {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		var message map[string]any
+		require.NoError(t, conn.ReadJSON(&message))
+		return message
+	}
+
+	token := read()
+	require.Equal(t, WSResumeToken, token["type"])
+	assert.EqualValues(t, ProtocolVersion1, token["protocolVersion"])
+	assert.Equal(t, []any{float64(ProtocolVersion1)}, token["supportedProtocolVersions"])
+
+	send := func(id string, version int) {
+		t.Helper()
+		envelope := map[string]any{"id": id, "payload": map[string]any{"type": WSTaskAck, "serviceId": "s_echo", "executionId": "e_1"}}
+		if version != 0 {
+			envelope["protocolVersion"] = version
+		}
+		msg, _ := json.Marshal(envelope)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, msg))
+	}
+
+	send("m_unnegotiated", 2)
+	rejected := read()
+	assert.Equal(t, WSProtocolError, rejected["type"], "messages in a version the connection didn't negotiate are rejected")
+	assert.Equal(t, "m_unnegotiated", rejected["id"])
+	assert.EqualValues(t, ProtocolVersion1, rejected["protocolVersion"])
+	assert.NotEmpty(t, rejected["error"])
+
+	send("m_versioned", ProtocolVersion1)
+	ack := read()
+	assert.Equal(t, "m_versioned", ack["id"])
+	assert.EqualValues(t, CurrentProtocolVersion, ack["protocolVersion"], "outbound envelopes carry the protocol version")
+
+	send("m_unversioned", 0)
+	assert.Equal(t, "m_unversioned", read()["id"], "envelopes without a version are from older services")
+
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1", OrchestrationID: "o_1"}))
+	task := read()
+	assert.Equal(t, "task_request", task["type"])
+	assert.EqualValues(t, CurrentProtocolVersion, task["protocolVersion"])
+
+	require.NoError(t, wsm.SendTaskCancellation("s_echo", &TaskCancellation{Type: "task_cancellation", ID: "task1", OrchestrationID: "o_1"}))
+	cancellation := read()
+	assert.Equal(t, "task_cancellation", cancellation["type"])
+	assert.EqualValues(t, CurrentProtocolVersion, cancellation["protocolVersion"])
+
+	t.Run("rejects unsupported versions", func(t *testing.T) {
+		assert.NoError(t, validateProtocolVersion(""))
+		assert.NoError(t, validateProtocolVersion("1"))
+		assert.Error(t, validateProtocolVersion("2"))
+		assert.Error(t, validateProtocolVersion("v1"))
+	})
+}
@@ -0,0 +1,362 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ProjectEventAPIKeyExpiring            = "apikey.expiring"
+	ProjectEventOrchestrationCancelled    = "orchestration.cancelled"
+	ProjectEventApprovalRequested         = "orchestration.approval_requested"
+	ProjectEventOrchestrationDeadLettered = "orchestration.dead_lettered"
+	ProjectEventBudgetExceeded            = "orchestration.budget_exceeded"
+	ProjectEventSLABreached               = "sla.breached"
+	ProjectEventServiceDrained            = "service.drained"
+	ProjectEventOrchestrationCompleted    = "orchestration.completed"
+	ProjectEventOrchestrationFailed       = "orchestration.failed"
+	ProjectEventTaskFailed                = "task.failed"
+	ProjectEventServiceDisconnected       = "service.disconnected"
+	ProjectEventAlertTriggered            = "alert.triggered"
+	ProjectEventAlertResolved             = "alert.resolved"
+	ProjectEventTaskSlow                  = "task.slow"
+)
+
+// ProjectEvents are the events a project webhook can subscribe to
+var ProjectEvents = []string{
+	ProjectEventAPIKeyExpiring,
+	ProjectEventOrchestrationCancelled,
+	ProjectEventApprovalRequested,
+	ProjectEventOrchestrationDeadLettered,
+	ProjectEventBudgetExceeded,
+	ProjectEventSLABreached,
+	ProjectEventServiceDrained,
+	ProjectEventOrchestrationCompleted,
+	ProjectEventOrchestrationFailed,
+	ProjectEventTaskFailed,
+	ProjectEventServiceDisconnected,
+	ProjectEventAlertTriggered,
+	ProjectEventAlertResolved,
+	ProjectEventTaskSlow,
+}
+
+const (
+	OrchestrationEventTaskCompleted = "task.completed"
+	// OrchestrationEventResult labels an orchestration's final webhook in its webhook's delivery log
+	OrchestrationEventResult = "orchestration.result"
+	// WebhookEventTest is the synthetic event sent when a webhook is test-fired, every webhook receives it
+	WebhookEventTest = "webhook.test"
+)
+
+// CallbackWebhook is a one-off webhook receiving a single orchestration's results and events, e.g. for
+// request/reply integrations. An exclusive callback receives them instead of the project's webhooks.
+type CallbackWebhook struct {
+	Url       string `json:"url"`
+	Exclusive bool   `json:"exclusive,omitempty"`
+}
+
+// resultWebhooks returns the webhooks an orchestration's results and streamed task outputs are sent to
+func (o *Orchestration) resultWebhooks() []string {
+	var webhooks []string
+	if o.Webhook != "" && (o.Callback == nil || !o.Callback.Exclusive) {
+		webhooks = append(webhooks, o.Webhook)
+	}
+	if o.Callback != nil {
+		webhooks = append(webhooks, o.Callback.Url)
+	}
+	return webhooks
+}
+
+// ProjectEvent is a notification about a project delivered to all of its webhooks
+type ProjectEvent struct {
+	Event     string    `json:"event"`
+	ProjectID string    `json:"projectId"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+// NotifyProjectWebhooks delivers an event to every webhook of the project subscribed to it. Webhooks failing to
+// accept the event are retried in the background, until the event is dead-lettered.
+func (p *PlanEngine) NotifyProjectWebhooks(project *Project, event string, data any) {
+	payload := ProjectEvent{
+		Event:     event,
+		ProjectID: project.ID,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+
+	for _, webhook := range project.Webhooks {
+		if !project.webhookSubscribed(webhook, event) {
+			continue
+		}
+		if err := p.postWebhook(project.ID, webhook, event, payload); err != nil {
+			p.Logger.Warn().
+				Err(err).
+				Str("ProjectID", project.ID).
+				Str("Event", event).
+				Str("Webhook", webhook).
+				Msg("Failed to deliver project event, retrying")
+			p.notifyInBackground(func() { p.retryProjectEvent(webhook, payload, err) })
+		}
+	}
+}
+
+// notifyInBackground sends a project notification without holding up the caller
+func (p *PlanEngine) notifyInBackground(notify func()) {
+	p.notifying.Add(1)
+	go func() {
+		defer p.notifying.Done()
+		notify()
+	}()
+}
+
+// notifyOrchestrationEvent delivers an event about an orchestration to its callback webhook, if it has one, and
+// to the project's webhooks unless the callback is exclusive
+func (p *PlanEngine) notifyOrchestrationEvent(project *Project, orchestrationID, event string, data any) {
+	orchestration, err := p.getOrchestration(orchestrationID)
+	if err != nil || orchestration.Callback == nil {
+		p.NotifyProjectWebhooks(project, event, data)
+		return
+	}
+
+	callback := *orchestration.Callback
+	payload := ProjectEvent{
+		Event:     event,
+		ProjectID: project.ID,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+	if err := p.postWebhook(project.ID, callback.Url, event, payload); err != nil {
+		p.Logger.Warn().
+			Err(err).
+			Str("OrchestrationID", orchestrationID).
+			Str("Event", event).
+			Str("Webhook", callback.Url).
+			Msg("Failed to deliver orchestration event to its callback, retrying")
+		p.notifyInBackground(func() { p.retryProjectEvent(callback.Url, payload, err) })
+	}
+	if !callback.Exclusive {
+		p.NotifyProjectWebhooks(project, event, data)
+	}
+}
+
+// TaskCompletedEvent streams a finished task's output to the webhook of an orchestration with streamResults
+type TaskCompletedEvent struct {
+	Event           string          `json:"event"`
+	OrchestrationID string          `json:"orchestrationId"`
+	TaskID          string          `json:"taskId"`
+	ServiceID       string          `json:"serviceId"`
+	Output          json.RawMessage `json:"output"`
+	Timestamp       time.Time       `json:"timestamp"`
+}
+
+// streamTaskResult delivers a task's output as soon as it completes, if the orchestration opted in.
+// Delivery is best effort and doesn't hold up the orchestration, its final webhook still carries every result.
+func (p *PlanEngine) streamTaskResult(orchestrationID, taskID, serviceID string, output json.RawMessage) {
+	orchestration, err := p.getOrchestration(orchestrationID)
+	if err != nil || !orchestration.StreamResults {
+		return
+	}
+
+	payload := TaskCompletedEvent{
+		Event:           OrchestrationEventTaskCompleted,
+		OrchestrationID: orchestrationID,
+		TaskID:          taskID,
+		ServiceID:       serviceID,
+		Output:          output,
+		Timestamp:       time.Now().UTC(),
+	}
+
+	for _, webhook := range orchestration.resultWebhooks() {
+		p.notifyInBackground(func() {
+			if err := p.postWebhook(orchestration.ProjectID, webhook, OrchestrationEventTaskCompleted, payload); err != nil {
+				p.Logger.Error().
+					Err(err).
+					Str("OrchestrationID", orchestrationID).
+					Str("TaskID", taskID).
+					Str("Webhook", webhook).
+					Msg("Failed to stream task result")
+			}
+		})
+	}
+}
+
+// notifyOrchestrationFinished tells the project's webhooks and notification channels an orchestration it started
+// has completed or failed. Sub-orchestrations report to their parent instead.
+func (p *PlanEngine) notifyOrchestrationFinished(projectID, orchestrationID string, status Status, reason json.RawMessage) {
+	event := ProjectEventOrchestrationFailed
+	if status == Completed {
+		event = ProjectEventOrchestrationCompleted
+	}
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return
+	}
+	p.notifyOrchestrationEvent(project, orchestrationID, event, map[string]any{
+		"orchestrationId": orchestrationID,
+		"status":          status,
+		"reason":          reason,
+	})
+	p.notifyChannels(project, orchestrationID, event, reason)
+}
+
+// notifyTaskFailed tells the orchestration's project about one of its tasks failing
+func (p *PlanEngine) notifyTaskFailed(event TaskStatusEvent) {
+	orchestration, err := p.getOrchestration(event.OrchestrationID)
+	if err != nil {
+		return
+	}
+	project, err := p.GetProjectByID(orchestration.ProjectID)
+	if err != nil {
+		return
+	}
+	p.notifyOrchestrationEvent(project, event.OrchestrationID, ProjectEventTaskFailed, map[string]any{
+		"orchestrationId": event.OrchestrationID,
+		"taskId":          event.TaskID,
+		"serviceId":       event.ServiceID,
+		"error":           event.Error,
+	})
+}
+
+// notifyServiceDisconnected tells the service's project its last connected instance went away
+func (p *PlanEngine) notifyServiceDisconnected(serviceID string) {
+	service, err := p.GetServiceByID(serviceID)
+	if err != nil {
+		return
+	}
+	project, err := p.GetProjectByID(service.ProjectID)
+	if err != nil {
+		return
+	}
+	// Disconnections are handled while the connection closes, webhooks mustn't hold that up
+	p.notifyInBackground(func() {
+		p.NotifyProjectWebhooks(project, ProjectEventServiceDisconnected, map[string]any{
+			"serviceId":   service.ID,
+			"serviceName": service.Name,
+		})
+	})
+}
+
+// postWebhook sends a JSON payload to one of the project's webhooks, see deliverWebhook
+func (p *PlanEngine) postWebhook(projectID, webhookUrl, event string, payload any) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to trigger webhook failed to marshal payload: %w", err)
+	}
+	return p.deliverWebhook(newWebhookDelivery(projectID, p.webhookID(projectID, webhookUrl), webhookUrl, event, jsonPayload))
+}
+
+// webhookID returns the ID a delivery's webhook is known by, callbacks are identified by their URL
+func (p *PlanEngine) webhookID(projectID, webhookUrl string) string {
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return projectWebhookID(webhookUrl)
+	}
+	return project.webhookID(webhookUrl)
+}
+
+// ConfigureWebhookAddresses lets webhooks be sent to private addresses, for local development
+func (p *PlanEngine) ConfigureWebhookAddresses(cfg WebhookAddresses) {
+	p.allowPrivateWebhooks = cfg.AllowPrivate
+}
+
+// webhookAddressAllowed reports whether webhooks may be sent to an address
+func (p *PlanEngine) webhookAddressAllowed(ip net.IP) bool {
+	return p.allowPrivateWebhooks || isPublicAddress(ip)
+}
+
+// deliverWebhook sends a delivery's payload to its webhook, signed with the webhook's secret. Any non 2xx
+// response is an error. The attempt is recorded in the webhook's delivery log either way.
+func (p *PlanEngine) deliverWebhook(delivery *WebhookDelivery) (err error) {
+	// Deliveries about an orchestration join its trace
+	ctx := context.Background()
+	if native, err := parseWebhookPayload(delivery.Payload); err == nil && native.OrchestrationID != "" {
+		ctx = p.orchestrationTraceContext(ctx, native.OrchestrationID)
+	}
+	ctx, span := tracer().Start(ctx, "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("orra.project_id", delivery.ProjectID),
+			attribute.String("orra.webhook_id", delivery.WebhookID),
+			attribute.String("orra.event", delivery.Event),
+		))
+	defer func() {
+		p.recordWebhookDelivery(delivery, err)
+		span.SetAttributes(attribute.Int("http.response.status_code", delivery.StatusCode))
+		endSpan(span, err)
+	}()
+
+	p.Logger.Trace().
+		Str("Webhook", delivery.Webhook).
+		RawJSON("Payload", delivery.Payload).
+		Msg("Triggering webhook")
+
+	request := p.webhookRequest(delivery.ProjectID, delivery.Webhook)
+
+	// Deliveries keep their native payload, so they're converted to the webhook's format when sent
+	body, contentType := []byte(delivery.Payload), "application/json"
+	if p.webhookFormat(delivery.ProjectID, delivery.Webhook) == WebhookFormatCloudEvents {
+		if body, err = cloudEvent(delivery, traceHeaders(ctx).Get(traceParentKey)); err != nil {
+			return err
+		}
+		contentType = cloudEventsContentType
+	}
+
+	// Create a new request, timed out by the webhook's own timeout
+	ctx, cancel := context.WithTimeout(ctx, request.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.Webhook, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers, the webhook's static headers can't override ours
+	request.apply(req)
+	traceContext.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "Orra/1.0")
+	if signature := p.webhookSignature(delivery.ProjectID, delivery.Webhook, time.Now().UTC(), body); signature != "" {
+		req.Header.Set(WebhookSignatureHeader, signature)
+	}
+
+	// Send the request, only ever to a public address
+	resp, err := p.webhookClient.Do(req)
+	delivery.LatencyMs = time.Since(delivery.Timestamp).Milliseconds()
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			p.Logger.Error().
+				Str("Webhook", delivery.Webhook).
+				Err(fmt.Errorf("failed to close response body when triggering Webhook: %w", err))
+		}
+	}(resp.Body)
+
+	delivery.StatusCode = resp.StatusCode
+
+	// Check the response status
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
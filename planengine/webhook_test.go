@@ -0,0 +1,142 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTaskResult(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	events := make(chan TaskCompletedEvent, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event TaskCompletedEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	streamed := &Orchestration{ID: "o_streamed", ProjectID: project.ID, Webhook: webhook.URL, StreamResults: true, Status: Processing}
+	quiet := &Orchestration{ID: "o_quiet", ProjectID: project.ID, Webhook: webhook.URL, Status: Processing}
+	app.Engine.orchestrationStore[streamed.ID] = streamed
+	app.Engine.orchestrationStore[quiet.ID] = quiet
+
+	app.Engine.streamTaskResult(quiet.ID, "task1", "s_echo", json.RawMessage(`{"message":"hi"}`))
+	app.Engine.streamTaskResult(streamed.ID, "task1", "s_echo", json.RawMessage(`{"message":"hi"}`))
+
+	select {
+	case event := <-events:
+		assert.Equal(t, OrchestrationEventTaskCompleted, event.Event)
+		assert.Equal(t, streamed.ID, event.OrchestrationID)
+		assert.Equal(t, "task1", event.TaskID)
+		assert.Equal(t, "s_echo", event.ServiceID)
+		assert.JSONEq(t, `{"message":"hi"}`, string(event.Output))
+	case <-time.After(2 * time.Second):
+		t.Fatal("task result was not streamed")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event for orchestration %s", event.OrchestrationID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOrchestrationCallbackWebhook(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	received := make(chan string, 8)
+	var callbackFailures atomic.Int64
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Event string `json:"event"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if r.URL.Path == "/callback" && callbackFailures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- r.URL.Path + " " + payload.Event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+	project.Webhooks = []string{receiver.URL + "/project"}
+
+	shared := &Orchestration{ID: "o_shared", ProjectID: project.ID, Webhook: receiver.URL + "/project", Callback: &CallbackWebhook{Url: receiver.URL + "/callback"}}
+	exclusive := &Orchestration{ID: "o_exclusive", ProjectID: project.ID, Callback: &CallbackWebhook{Url: receiver.URL + "/callback", Exclusive: true}}
+	app.Engine.orchestrationStore[shared.ID] = shared
+	app.Engine.orchestrationStore[exclusive.ID] = exclusive
+
+	deliveries := func() []string {
+		t.Helper()
+		var paths []string
+		for {
+			select {
+			case path := <-received:
+				paths = append(paths, path)
+			case <-time.After(100 * time.Millisecond):
+				sort.Strings(paths)
+				return paths
+			}
+		}
+	}
+
+	require.NoError(t, app.Engine.triggerWebhook(shared))
+	assert.Equal(t, []string{"/callback ", "/project "}, deliveries(), "results go to the project webhook and the callback")
+	require.NoError(t, app.Engine.triggerWebhook(exclusive))
+	assert.Equal(t, []string{"/callback "}, deliveries())
+
+	app.Engine.notifyOrchestrationEvent(project, shared.ID, ProjectEventSLABreached, nil)
+	assert.Equal(t, []string{"/callback " + ProjectEventSLABreached, "/project " + ProjectEventSLABreached}, deliveries())
+	app.Engine.notifyOrchestrationEvent(project, exclusive.ID, ProjectEventSLABreached, nil)
+	assert.Equal(t, []string{"/callback " + ProjectEventSLABreached}, deliveries(), "exclusive callbacks replace the project webhooks")
+
+	t.Run("only webhooks failing to accept results are retried", func(t *testing.T) {
+		app.Engine.WebhookDeadLetters = app.Db
+		app.Engine.ConfigureWebhookRetries(WebhookRetry{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond})
+		callbackFailures.Store(1)
+
+		require.NoError(t, app.Engine.triggerWebhook(shared))
+		app.Engine.notifying.Wait()
+		assert.Equal(t, []string{"/callback ", "/project "}, deliveries(), "the project webhook is only sent the results once")
+
+		callbackFailures.Store(100)
+		require.NoError(t, app.Engine.triggerWebhook(exclusive))
+		app.Engine.notifying.Wait()
+		deadLetters, err := app.Db.ListWebhookDeadLetters(project.ID)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, OrchestrationEventResult, deadLetters[0].Event.Event)
+		assert.JSONEq(t, `{"orchestrationId":"o_exclusive","results":null,"status":"registered"}`, string(deadLetters[0].Payload), "results are dead-lettered as they were sent")
+		callbackFailures.Store(0)
+	})
+
+	t.Run("callbacks stand in for the project webhook", func(t *testing.T) {
+		orchestration := &Orchestration{Action: Action{Content: "Echo"}, Callback: &CallbackWebhook{Url: "https://example.com/reply"}}
+		assert.NoError(t, validateOrchestrationRequest(orchestration))
+		assert.NoError(t, app.Engine.validateOrchestrationWebhook(project.ID, orchestration))
+
+		orchestration.Callback.Url = "http://example.com/reply"
+		assert.ErrorContains(t, app.Engine.validateOrchestrationWebhook(project.ID, orchestration), "must use https")
+
+		orchestration.Callback.Url = "not a url"
+		assert.Error(t, validateOrchestrationRequest(orchestration))
+		assert.Error(t, app.Engine.validateOrchestrationWebhook(project.ID, orchestration))
+	})
+}
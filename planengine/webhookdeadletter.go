@@ -0,0 +1,240 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	back "github.com/cenkalti/backoff/v4"
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+var ErrWebhookDeadLetterNotFound = errors.New("webhook dead letter not found")
+
+// WebhookDeadLetter records a project event a webhook failed to accept after every delivery attempt,
+// with the event as it was sent so it can be re-driven once the webhook is fixed
+type WebhookDeadLetter struct {
+	ID        string       `json:"id"`
+	ProjectID string       `json:"projectId"`
+	Webhook   string       `json:"webhook"`
+	Event     ProjectEvent `json:"event"`
+	// Payload is what was sent for deliveries that aren't project events, i.e. orchestration results. Their event
+	// only names them.
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError"`
+	DeadLetteredAt time.Time       `json:"deadLetteredAt"`
+}
+
+// body is what's sent to the webhook when the dead letter is delivered
+func (d *WebhookDeadLetter) body() any {
+	if len(d.Payload) > 0 {
+		return d.Payload
+	}
+	return d.Event
+}
+
+// orchestrationID returns the orchestration a dead letter's body is about, if any
+func (d *WebhookDeadLetter) orchestrationID() string {
+	body, err := json.Marshal(d.body())
+	if err != nil {
+		return ""
+	}
+	native, err := parseWebhookPayload(body)
+	if err != nil {
+		return ""
+	}
+	return native.OrchestrationID
+}
+
+type WebhookDeadLetterStorage interface {
+	StoreWebhookDeadLetter(deadLetter *WebhookDeadLetter) error
+	LoadWebhookDeadLetter(projectID, id string) (*WebhookDeadLetter, error)
+	ListWebhookDeadLetters(projectID string) ([]*WebhookDeadLetter, error)
+	DeleteWebhookDeadLetter(projectID, id string) error
+	DeleteOrchestrationWebhookDeadLetters(projectID, orchestrationID string) error
+}
+
+// ConfigureWebhookRetries replaces the default webhook retry settings, unset settings keep their defaults
+func (p *PlanEngine) ConfigureWebhookRetries(cfg WebhookRetry) {
+	if cfg.MaxAttempts > 0 {
+		p.webhookRetry.MaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.InitialInterval > 0 {
+		p.webhookRetry.InitialInterval = cfg.InitialInterval
+	}
+	if cfg.MaxInterval > 0 {
+		p.webhookRetry.MaxInterval = cfg.MaxInterval
+	}
+}
+
+func (r WebhookRetry) backOff() back.BackOff {
+	expBackoff := back.NewExponentialBackOff()
+	expBackoff.InitialInterval = r.InitialInterval
+	expBackoff.MaxInterval = r.MaxInterval
+	expBackoff.Multiplier = 2.0
+	expBackoff.RandomizationFactor = 0.5 // Spread retries to a recovering webhook
+	expBackoff.MaxElapsedTime = 0        // Attempts are bounded by MaxAttempts instead
+
+	expBackoff.Reset()
+	return back.WithMaxRetries(expBackoff, uint64(max(r.MaxAttempts-1, 0)))
+}
+
+// retryProjectEvent retries delivering an event a webhook failed to accept, see retryWebhook
+func (p *PlanEngine) retryProjectEvent(webhook string, event ProjectEvent, err error) {
+	p.retryWebhook(&WebhookDeadLetter{ProjectID: event.ProjectID, Webhook: webhook, Event: event}, err)
+}
+
+// retryOrchestrationResult retries delivering an orchestration's results a webhook failed to accept, see retryWebhook
+func (p *PlanEngine) retryOrchestrationResult(projectID, webhook string, payload json.RawMessage, err error) {
+	p.retryWebhook(&WebhookDeadLetter{
+		ProjectID: projectID,
+		Webhook:   webhook,
+		Event:     ProjectEvent{Event: OrchestrationEventResult, ProjectID: projectID, Timestamp: time.Now().UTC()},
+		Payload:   payload,
+	}, err)
+}
+
+// retryWebhook retries a delivery a webhook failed to accept, with exponential backoff. The delivery is
+// dead-lettered once it's still undelivered after the last attempt, or when the engine shuts down.
+func (p *PlanEngine) retryWebhook(undelivered *WebhookDeadLetter, err error) {
+	event := undelivered.Event
+	attempts := 1
+	backOff := p.webhookRetry.backOff()
+retries:
+	for wait := backOff.NextBackOff(); wait != back.Stop; wait = backOff.NextBackOff() {
+		p.Logger.Debug().
+			Err(err).
+			Str("ProjectID", undelivered.ProjectID).
+			Str("Event", event.Event).
+			Str("Webhook", undelivered.Webhook).
+			Dur("Wait", wait).
+			Msg("Retrying webhook delivery")
+
+		select {
+		case <-time.After(wait):
+		case <-p.stopping:
+			break retries
+		}
+		attempts++
+		if err = p.postWebhook(undelivered.ProjectID, undelivered.Webhook, event.Event, undelivered.body()); err == nil {
+			return
+		}
+	}
+
+	p.Logger.Error().
+		Err(err).
+		Str("ProjectID", undelivered.ProjectID).
+		Str("Event", event.Event).
+		Str("Webhook", undelivered.Webhook).
+		Int("Attempts", attempts).
+		Msg("Failed to deliver webhook, dead-lettering it")
+
+	if p.WebhookDeadLetters == nil {
+		return
+	}
+	undelivered.ID = fmt.Sprintf("wdl_%s", short.New())
+	undelivered.Attempts = attempts
+	undelivered.LastError = err.Error()
+	undelivered.DeadLetteredAt = time.Now().UTC()
+	if err := p.WebhookDeadLetters.StoreWebhookDeadLetter(undelivered); err != nil {
+		p.Logger.Error().Err(err).Str("ProjectID", undelivered.ProjectID).Msg("Failed to dead-letter webhook delivery")
+	}
+}
+
+func (app *App) ListWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	deadLetters, err := app.Engine.WebhookDeadLetters.ListWebhookDeadLetters(project.ID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].DeadLetteredAt.After(deadLetters[j].DeadLetteredAt)
+	})
+	if deadLetters == nil {
+		deadLetters = []*WebhookDeadLetter{}
+	}
+	// Events keep their secrets for re-driving, but only the webhook may see them
+	for _, deadLetter := range deadLetters {
+		deadLetter.Event.Data, _ = redactWebhookSecrets(deadLetter.Event.Data)
+	}
+
+	writeDeadLetterResponse(w, app, http.StatusOK, deadLetters)
+}
+
+// RedriveWebhookDeadLetter delivers a dead-lettered event to its webhook again, it leaves the list once the webhook
+// accepts it. Failed re-drives are recorded on the dead letter.
+func (app *App) RedriveWebhookDeadLetter(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.requestWebhookDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	store := app.Engine.WebhookDeadLetters
+	if err := app.Engine.postWebhook(deadLetter.ProjectID, deadLetter.Webhook, deadLetter.Event.Event, deadLetter.body()); err != nil {
+		deadLetter.Attempts++
+		deadLetter.LastError = err.Error()
+		if err := store.StoreWebhookDeadLetter(deadLetter); err != nil {
+			logger := app.requestLogger(r)
+			logger.Error().Err(err).Str("DeadLetterID", deadLetter.ID).Msg("Failed to record webhook re-drive attempt")
+		}
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(WebhookDeliveryFailedErrCode), err))
+		return
+	}
+
+	if err := store.DeleteWebhookDeadLetter(deadLetter.ProjectID, deadLetter.ID); err != nil {
+		logger := app.requestLogger(r)
+		logger.Error().Err(err).Str("DeadLetterID", deadLetter.ID).Msg("Failed to remove re-driven webhook dead letter")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) PurgeWebhookDeadLetter(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.requestWebhookDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Engine.WebhookDeadLetters.DeleteWebhookDeadLetter(deadLetter.ProjectID, deadLetter.ID); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(DeadLetterUpdateFailedErrCode), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) requestWebhookDeadLetter(w http.ResponseWriter, r *http.Request) (*WebhookDeadLetter, bool) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return nil, false
+	}
+
+	deadLetter, err := app.Engine.WebhookDeadLetters.LoadWebhookDeadLetter(project.ID, mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, ErrWebhookDeadLetterNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, errs.Code(UnknownDeadLetterErrCode), err))
+		return nil, false
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return nil, false
+	}
+	return deadLetter, true
+}
@@ -0,0 +1,131 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRetriesAndDeadLetters(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	app.Engine.WebhookDeadLetters = app.Db
+	app.Engine.ConfigureWebhookRetries(WebhookRetry{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond})
+
+	var failures, attempts atomic.Int64
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	listDeadLetters := func() []WebhookDeadLetter {
+		t.Helper()
+		w := request(http.MethodGet, "/webhooks/dead-letters")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var deadLetters []WebhookDeadLetter
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&deadLetters))
+		return deadLetters
+	}
+
+	failures.Store(1)
+	app.Engine.NotifyProjectWebhooks(project, ProjectEventServiceDrained, map[string]any{"serviceId": "s_echo"})
+	assert.Eventually(t, func() bool { return attempts.Load() == 2 }, time.Second, 5*time.Millisecond, "failed deliveries are retried")
+	assert.Empty(t, listDeadLetters())
+
+	attempts.Store(0)
+	failures.Store(100)
+	app.Engine.NotifyProjectWebhooks(project, ProjectEventServiceDrained, map[string]any{"serviceId": "s_echo"})
+
+	var deadLetters []WebhookDeadLetter
+	require.Eventually(t, func() bool {
+		deadLetters = listDeadLetters()
+		return len(deadLetters) == 1
+	}, time.Second, 5*time.Millisecond, "undeliverable events are dead-lettered")
+	deadLetter := deadLetters[0]
+	assert.EqualValues(t, 3, attempts.Load())
+	assert.Equal(t, 3, deadLetter.Attempts)
+	assert.Equal(t, webhook.URL, deadLetter.Webhook)
+	assert.Equal(t, ProjectEventServiceDrained, deadLetter.Event.Event)
+	assert.Contains(t, deadLetter.LastError, "503")
+
+	w := request(http.MethodPost, "/webhooks/dead-letters/"+deadLetter.ID+"/redrive")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, 4, listDeadLetters()[0].Attempts, "failed re-drives are recorded")
+
+	failures.Store(0)
+	w = request(http.MethodPost, "/webhooks/dead-letters/"+deadLetter.ID+"/redrive")
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.Empty(t, listDeadLetters(), "re-driven events leave the dead-letter list")
+
+	t.Run("lists events without their secrets", func(t *testing.T) {
+		failures.Store(100)
+		app.Engine.NotifyProjectWebhooks(project, ProjectEventApprovalRequested, map[string]any{"stepId": "step1", "token": "approval-token"})
+
+		var deadLetters []WebhookDeadLetter
+		require.Eventually(t, func() bool {
+			deadLetters = listDeadLetters()
+			return len(deadLetters) == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, redactedWebhookValue, deadLetters[0].Event.Data.(map[string]any)["token"])
+
+		stored, err := app.Db.LoadWebhookDeadLetter(project.ID, deadLetters[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "approval-token", stored.Event.Data.(map[string]any)["token"], "re-drives still send the secrets")
+	})
+
+	t.Run("rejects unknown dead letters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks/dead-letters/wdl_unknown/redrive").Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodDelete, "/webhooks/dead-letters/wdl_unknown").Code)
+	})
+}
+
+func TestWebhookRetriesEndOnShutdown(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	stopping := make(chan struct{})
+	app.Engine.stopping = stopping
+	app.Engine.WebhookDeadLetters = app.Db
+	app.Engine.ConfigureWebhookRetries(WebhookRetry{MaxAttempts: 3, InitialInterval: time.Hour, MaxInterval: time.Hour})
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer webhook.Close()
+	project.Webhooks = []string{webhook.URL}
+
+	app.Engine.NotifyProjectWebhooks(project, ProjectEventServiceDrained, map[string]any{"serviceId": "s_echo"})
+	close(stopping)
+	app.Engine.notifying.Wait()
+
+	deadLetters, err := app.Db.ListWebhookDeadLetters(project.ID)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1, "events still being retried are dead-lettered for re-driving")
+	assert.Equal(t, 1, deadLetters[0].Attempts)
+}
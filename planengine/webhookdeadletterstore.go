@@ -0,0 +1,105 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const webhookDeadLetterKeyPrefix = "webhookdeadletter:"
+
+func webhookDeadLetterKey(projectID, id string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", webhookDeadLetterKeyPrefix, projectID, id))
+}
+
+// StoreWebhookDeadLetter persists a webhook dead letter, its event is encrypted like orchestration payloads
+func (b *BadgerDB) StoreWebhookDeadLetter(deadLetter *WebhookDeadLetter) error {
+	data, err := b.encodePayload(deadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook dead letter: %w", err)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(webhookDeadLetterKey(deadLetter.ProjectID, deadLetter.ID), data)
+	})
+}
+
+func (b *BadgerDB) LoadWebhookDeadLetter(projectID, id string) (*WebhookDeadLetter, error) {
+	var deadLetter WebhookDeadLetter
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(webhookDeadLetterKey(projectID, id))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrWebhookDeadLetterNotFound
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return b.decodePayload(val, &deadLetter)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetter, nil
+}
+
+func (b *BadgerDB) ListWebhookDeadLetters(projectID string) ([]*WebhookDeadLetter, error) {
+	var deadLetters []*WebhookDeadLetter
+	prefix := []byte(fmt.Sprintf("%s%s:", webhookDeadLetterKeyPrefix, projectID))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var deadLetter WebhookDeadLetter
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &deadLetter)
+			}); err != nil {
+				return fmt.Errorf("failed to load webhook dead letter %s: %w", it.Item().Key(), err)
+			}
+			deadLetters = append(deadLetters, &deadLetter)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook dead letters: %w", err)
+	}
+	return deadLetters, nil
+}
+
+func (b *BadgerDB) DeleteWebhookDeadLetter(projectID, id string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(webhookDeadLetterKey(projectID, id))
+	})
+}
+
+// DeleteOrchestrationWebhookDeadLetters deletes the project's dead letters about an orchestration
+func (b *BadgerDB) DeleteOrchestrationWebhookDeadLetters(projectID, orchestrationID string) error {
+	prefix := []byte(fmt.Sprintf("%s%s:", webhookDeadLetterKeyPrefix, projectID))
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return deleteMatching(txn, prefix, func(val []byte) (bool, error) {
+			var deadLetter WebhookDeadLetter
+			if err := b.decodePayload(val, &deadLetter); err != nil {
+				return false, err
+			}
+			return deadLetter.orchestrationID() == orchestrationID, nil
+		})
+	})
+}
@@ -0,0 +1,274 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+	short "github.com/lithammer/shortuuid/v4"
+)
+
+const (
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 500
+	redactedWebhookValue        = "[REDACTED]"
+)
+
+// webhookSecretFields are payload fields only the webhook may see, e.g. approval tokens which authorise decisions,
+// they're redacted wherever payloads are kept
+var webhookSecretFields = []string{"token", "secret"}
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+// WebhookDelivery records one attempt at delivering a payload to a webhook, successful or not, so users can
+// find out what happened to a callback they never got. Deliveries are kept for WebhookDeliveryRetention.
+type WebhookDelivery struct {
+	ID           string          `json:"id"`
+	ProjectID    string          `json:"projectId"`
+	WebhookID    string          `json:"webhookId"`
+	Webhook      string          `json:"webhook"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Succeeded    bool            `json:"succeeded"`
+	StatusCode   int             `json:"statusCode,omitempty"`
+	LatencyMs    int64           `json:"latencyMs"`
+	Error        string          `json:"error,omitempty"`
+	RedeliveryOf string          `json:"redeliveryOf,omitempty"`
+	Redacted     bool            `json:"redacted,omitempty"`
+	Timestamp    time.Time       `json:"timestamp"`
+}
+
+type WebhookDeliveryStorage interface {
+	StoreWebhookDelivery(delivery *WebhookDelivery) error
+	LoadWebhookDelivery(projectID, webhookID, id string) (*WebhookDelivery, error)
+	ListWebhookDeliveries(projectID, webhookID string) ([]*WebhookDelivery, error)
+	DeleteOrchestrationWebhookDeliveries(projectID, orchestrationID string) error
+}
+
+func newWebhookDelivery(projectID, webhookID, webhookUrl, event string, payload json.RawMessage) *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:        fmt.Sprintf("whd_%s", short.New()),
+		ProjectID: projectID,
+		WebhookID: webhookID,
+		Webhook:   webhookUrl,
+		Event:     event,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// orchestrationID returns the orchestration a delivery's payload is about, if any
+func (d *WebhookDelivery) orchestrationID() string {
+	native, err := parseWebhookPayload(d.Payload)
+	if err != nil {
+		return ""
+	}
+	return native.OrchestrationID
+}
+
+// redactWebhookSecrets returns a copy of a decoded payload with its secret fields redacted, reporting whether any were
+func redactWebhookSecrets(value any) (any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		out, redacted := make(map[string]any, len(v)), false
+		for key, field := range v {
+			if slices.Contains(webhookSecretFields, key) {
+				out[key], redacted = redactedWebhookValue, true
+				continue
+			}
+			var fieldRedacted bool
+			out[key], fieldRedacted = redactWebhookSecrets(field)
+			redacted = redacted || fieldRedacted
+		}
+		return out, redacted
+	case []any:
+		out, redacted := make([]any, len(v)), false
+		for i, item := range v {
+			var itemRedacted bool
+			out[i], itemRedacted = redactWebhookSecrets(item)
+			redacted = redacted || itemRedacted
+		}
+		return out, redacted
+	default:
+		return value, false
+	}
+}
+
+// redactWebhookPayload redacts a payload's secret fields, payloads without any are returned as they are
+func redactWebhookPayload(payload json.RawMessage) (json.RawMessage, bool) {
+	var decoded any
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return payload, false
+	}
+	decoded, redacted := redactWebhookSecrets(decoded)
+	if !redacted {
+		return payload, false
+	}
+	out, err := json.Marshal(decoded)
+	if err != nil {
+		return payload, false
+	}
+	return out, true
+}
+
+// recordWebhookDelivery adds a finished delivery attempt to its webhook's delivery log, with the payload's secrets
+// redacted since the log is open to every project member
+func (p *PlanEngine) recordWebhookDelivery(delivery *WebhookDelivery, err error) {
+	delivery.Succeeded = err == nil
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	p.Metrics.ObserveWebhookDelivery(delivery.Succeeded)
+	if p.WebhookDeliveries == nil {
+		return
+	}
+
+	stored := *delivery
+	stored.Payload, stored.Redacted = redactWebhookPayload(delivery.Payload)
+	if err := p.WebhookDeliveries.StoreWebhookDelivery(&stored); err != nil {
+		p.Logger.Error().
+			Err(err).
+			Str("ProjectID", delivery.ProjectID).
+			Str("Webhook", delivery.Webhook).
+			Msg("Failed to record webhook delivery")
+	}
+}
+
+// ListWebhookDeliveries returns the latest delivery attempts to one of the caller's project webhooks, newest first
+func (app *App) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	webhookID := mux.Vars(r)["id"]
+	if project.webhookIndex(webhookID) < 0 {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, ErrProjectWebhookNotFound))
+		return
+	}
+
+	limit := defaultWebhookDeliveryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("limit"), "invalid limit, expected a positive integer"))
+			return
+		}
+		limit = min(n, maxWebhookDeliveryLimit)
+	}
+
+	deliveries, err := app.Engine.WebhookDeliveries.ListWebhookDeliveries(project.ID, webhookID)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Timestamp.After(deliveries[j].Timestamp)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	if deliveries == nil {
+		deliveries = []*WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// TestWebhook sends a synthetic event to one of the caller's project webhooks, responding with the delivery so
+// integrators can check the receiver's response code and latency. A failed delivery is reported, not an error.
+func (app *App) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	webhookID := mux.Vars(r)["id"]
+	i := project.webhookIndex(webhookID)
+	if i < 0 {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, ErrProjectWebhookNotFound))
+		return
+	}
+
+	payload, err := json.Marshal(ProjectEvent{
+		Event:     WebhookEventTest,
+		ProjectID: project.ID,
+		Timestamp: time.Now().UTC(),
+		Data:      map[string]any{"webhookId": webhookID, "message": "This is a test event from Orra"},
+	})
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+
+	delivery := newWebhookDelivery(project.ID, webhookID, project.Webhooks[i], WebhookEventTest, payload)
+	_ = app.Engine.deliverWebhook(delivery)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(delivery); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
+
+// RedeliverWebhookDelivery sends a delivery's payload to its webhook again, responding with the new delivery
+func (app *App) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	vars := mux.Vars(r)
+	delivery, err := app.Engine.WebhookDeliveries.LoadWebhookDelivery(project.ID, vars["id"], vars["deliveryId"])
+	switch {
+	case errors.Is(err, ErrWebhookDeliveryNotFound):
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, err))
+		return
+	case err != nil:
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, err))
+		return
+	}
+	i := project.webhookIndex(delivery.WebhookID)
+	if i < 0 {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, ErrProjectWebhookNotFound))
+		return
+	}
+	if delivery.Redacted {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("deliveryId"), "the delivery's secrets weren't kept, it can't be redelivered"))
+		return
+	}
+
+	// Redeliveries go to the webhook's current URL
+	redelivery := newWebhookDelivery(project.ID, delivery.WebhookID, project.Webhooks[i], delivery.Event, delivery.Payload)
+	redelivery.RedeliveryOf = delivery.ID
+	if err := app.Engine.deliverWebhook(redelivery); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(WebhookDeliveryFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(redelivery); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
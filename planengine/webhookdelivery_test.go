@@ -0,0 +1,204 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+	app.Engine.WebhookDeliveries = app.Db
+
+	var accepting atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accepting.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("database is down"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(""))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	listDeliveries := func(query string) []WebhookDelivery {
+		t.Helper()
+		w := request(http.MethodGet, "/webhooks/"+projectWebhookID(receiver.URL)+"/deliveries"+query)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var deliveries []WebhookDelivery
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&deliveries))
+		return deliveries
+	}
+
+	_, err := app.Engine.AddProjectWebhook(project.ID, receiver.URL, ProjectWebhookOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, listDeliveries(""))
+
+	event := ProjectEvent{Event: ProjectEventServiceDrained, ProjectID: project.ID}
+	require.Error(t, app.Engine.postWebhook(project.ID, receiver.URL, event.Event, event))
+
+	deliveries := listDeliveries("")
+	require.Len(t, deliveries, 1)
+	failed := deliveries[0]
+	assert.False(t, failed.Succeeded)
+	assert.Equal(t, ProjectEventServiceDrained, failed.Event)
+	assert.Equal(t, http.StatusInternalServerError, failed.StatusCode)
+	assert.Contains(t, failed.Error, "unexpected status code")
+	assert.JSONEq(t, mustJSON(t, event), string(failed.Payload))
+
+	accepting.Store(true)
+	w := request(http.MethodPost, "/webhooks/"+failed.WebhookID+"/deliveries/"+failed.ID+"/redeliver")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var redelivery WebhookDelivery
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&redelivery))
+	assert.True(t, redelivery.Succeeded)
+	assert.Equal(t, failed.ID, redelivery.RedeliveryOf)
+	assert.Equal(t, http.StatusOK, redelivery.StatusCode)
+
+	deliveries = listDeliveries("")
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, redelivery.ID, deliveries[0].ID, "newest deliveries are listed first")
+	assert.Len(t, listDeliveries("?limit=1"), 1)
+
+	t.Run("keeps secrets out of the log", func(t *testing.T) {
+		var received ProjectEvent
+		receiver.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(http.StatusOK)
+		})
+		approval := ProjectEvent{Event: ProjectEventApprovalRequested, ProjectID: project.ID, Data: map[string]any{"stepId": "step1", "token": "approval-token"}}
+		require.NoError(t, app.Engine.postWebhook(project.ID, receiver.URL, approval.Event, approval))
+		assert.Equal(t, "approval-token", received.Data.(map[string]any)["token"], "webhooks get the secrets")
+
+		logged := listDeliveries("?limit=1")[0]
+		assert.True(t, logged.Redacted)
+		assert.NotContains(t, string(logged.Payload), "approval-token")
+		assert.Contains(t, string(logged.Payload), redactedWebhookValue)
+
+		w := request(http.MethodPost, "/webhooks/"+logged.WebhookID+"/deliveries/"+logged.ID+"/redeliver")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "redacted payloads can't be redelivered")
+	})
+
+	t.Run("rejects unknown webhooks and deliveries", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/webhooks/wh_unknown/deliveries").Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/webhooks/"+failed.WebhookID+"/deliveries?limit=0").Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks/"+failed.WebhookID+"/deliveries/whd_unknown/redeliver").Code)
+	})
+
+	t.Run("keeps the log when the webhook's URL changes", func(t *testing.T) {
+		var path atomic.Value
+		receiver.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path.Store(r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+		})
+		logged := len(listDeliveries(""))
+
+		moved, err := app.Engine.UpdateProjectWebhook(project.ID, failed.WebhookID, ProjectWebhookUpdate{Url: receiver.URL + "/moved"})
+		require.NoError(t, err)
+		require.Equal(t, failed.WebhookID, moved.ID)
+		assert.Len(t, listDeliveries(""), logged)
+
+		w := request(http.MethodPost, "/webhooks/"+failed.WebhookID+"/deliveries/"+failed.ID+"/redeliver")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "/moved", path.Load(), "redeliveries go to the webhook's current URL")
+		assert.Len(t, listDeliveries(""), logged+1)
+	})
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestTestFireWebhook(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+	app.Engine.WebhookDeliveries = app.Db
+
+	var received atomic.Value
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ProjectEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received.Store(event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(""))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	_, err := app.Engine.AddProjectWebhook(project.ID, receiver.URL, ProjectWebhookOptions{Events: []string{ProjectEventTaskFailed}})
+	require.NoError(t, err)
+
+	w := request("/webhooks/" + projectWebhookID(receiver.URL) + "/test")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var delivery WebhookDelivery
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&delivery))
+	assert.True(t, delivery.Succeeded)
+	assert.Equal(t, http.StatusAccepted, delivery.StatusCode)
+	assert.Equal(t, WebhookEventTest, delivery.Event)
+
+	event, ok := received.Load().(ProjectEvent)
+	require.True(t, ok, "test events are sent regardless of the webhook's subscriptions")
+	assert.Equal(t, WebhookEventTest, event.Event)
+	assert.Equal(t, project.ID, event.ProjectID)
+
+	t.Run("only delivers to public addresses", func(t *testing.T) {
+		app.Engine.allowPrivateWebhooks = false
+		defer func() { app.Engine.allowPrivateWebhooks = true }()
+		// Connections already open were checked when they were dialled
+		app.Engine.webhookClient.CloseIdleConnections()
+		received = atomic.Value{}
+
+		w := request("/webhooks/" + projectWebhookID(receiver.URL) + "/test")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var refused WebhookDelivery
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&refused))
+		assert.False(t, refused.Succeeded)
+		assert.Contains(t, refused.Error, ErrPrivateEndpoint.Error())
+		assert.Nil(t, received.Load(), "nothing is sent to private addresses")
+	})
+
+	t.Run("reports failed deliveries", func(t *testing.T) {
+		receiver.Close()
+		w := request("/webhooks/" + projectWebhookID(receiver.URL) + "/test")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var failed WebhookDelivery
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&failed))
+		assert.False(t, failed.Succeeded)
+		assert.NotEmpty(t, failed.Error)
+	})
+
+	t.Run("rejects unknown webhooks", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request("/webhooks/wh_unknown/test").Code)
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const webhookDeliveryKeyPrefix = "webhookdelivery:"
+
+func webhookDeliveryKey(projectID, webhookID, id string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%s", webhookDeliveryKeyPrefix, projectID, webhookID, id))
+}
+
+// StoreWebhookDelivery persists a webhook delivery for WebhookDeliveryRetention, its payload is encrypted like
+// orchestration payloads
+func (b *BadgerDB) StoreWebhookDelivery(delivery *WebhookDelivery) error {
+	data, err := b.encodePayload(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry(webhookDeliveryKey(delivery.ProjectID, delivery.WebhookID, delivery.ID), data).
+			WithTTL(WebhookDeliveryRetention)
+		return txn.SetEntry(entry)
+	})
+}
+
+func (b *BadgerDB) LoadWebhookDelivery(projectID, webhookID, id string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(webhookDeliveryKey(projectID, webhookID, id))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrWebhookDeliveryNotFound
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return b.decodePayload(val, &delivery)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (b *BadgerDB) ListWebhookDeliveries(projectID, webhookID string) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	prefix := []byte(fmt.Sprintf("%s%s:%s:", webhookDeliveryKeyPrefix, projectID, webhookID))
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var delivery WebhookDelivery
+			if err := it.Item().Value(func(val []byte) error {
+				return b.decodePayload(val, &delivery)
+			}); err != nil {
+				return fmt.Errorf("failed to load webhook delivery %s: %w", it.Item().Key(), err)
+			}
+			deliveries = append(deliveries, &delivery)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// DeleteOrchestrationWebhookDeliveries deletes the project's deliveries about an orchestration, across all its webhooks
+func (b *BadgerDB) DeleteOrchestrationWebhookDeliveries(projectID, orchestrationID string) error {
+	prefix := []byte(fmt.Sprintf("%s%s:", webhookDeliveryKeyPrefix, projectID))
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return deleteMatching(txn, prefix, func(val []byte) (bool, error) {
+			var delivery WebhookDelivery
+			if err := b.decodePayload(val, &delivery); err != nil {
+				return false, err
+			}
+			return delivery.orchestrationID() == orchestrationID, nil
+		})
+	})
+}
@@ -0,0 +1,140 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+const (
+	// WebhookFormatNative delivers events as the plan engine's own JSON payloads, it's the default
+	WebhookFormatNative = "native"
+	// WebhookFormatCloudEvents wraps events in structured mode CNCF CloudEvents 1.0 envelopes, so they plug
+	// straight into CloudEvents consumers such as Knative or EventBridge
+	WebhookFormatCloudEvents = "cloudevents"
+
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventTypePrefix   = "dev.orra."
+)
+
+// CloudEvent is a structured mode CloudEvents 1.0 envelope. Traceparent is the distributed tracing extension,
+// every event of an orchestration shares its trace ID.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+	Traceparent     string          `json:"traceparent"`
+}
+
+func validateWebhookFormat(format string) error {
+	switch format {
+	case "", WebhookFormatNative, WebhookFormatCloudEvents:
+		return nil
+	default:
+		return errs.E(errs.Validation, errs.Parameter("format"), fmt.Sprintf("format must be %q or %q", WebhookFormatNative, WebhookFormatCloudEvents))
+	}
+}
+
+func (p *Project) setWebhookFormat(webhookUrl, format string) {
+	if format == "" || format == WebhookFormatNative {
+		delete(p.WebhookFormats, webhookUrl)
+		return
+	}
+	if p.WebhookFormats == nil {
+		p.WebhookFormats = make(map[string]string)
+	}
+	p.WebhookFormats[webhookUrl] = format
+}
+
+// webhookFormat returns the format of a delivery's body, callbacks and webhooks without a format get native events
+func (p *PlanEngine) webhookFormat(projectID, webhookUrl string) string {
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return WebhookFormatNative
+	}
+	if format, ok := project.WebhookFormats[webhookUrl]; ok {
+		return format
+	}
+	return WebhookFormatNative
+}
+
+// nativeWebhookPayload holds what's common to native webhook payloads. Project events carry their details in
+// data, orchestration results and task outputs at the top level.
+type nativeWebhookPayload struct {
+	Timestamp       *time.Time      `json:"timestamp"`
+	OrchestrationID string          `json:"orchestrationId"`
+	ServiceID       string          `json:"serviceId"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func parseWebhookPayload(payload json.RawMessage) (nativeWebhookPayload, error) {
+	var native nativeWebhookPayload
+	if err := json.Unmarshal(payload, &native); err != nil {
+		return nativeWebhookPayload{}, fmt.Errorf("failed to unmarshal webhook payload: %w", err)
+	}
+	if native.Data != nil {
+		data := native.Data
+		_ = json.Unmarshal(data, &native)
+		native.Data = data
+	}
+	return native, nil
+}
+
+// cloudEvent wraps a delivery's native payload in a CloudEvent. Its ID is derived from the payload, so retries and
+// redeliveries of an event keep the ID consumers deduplicate on. The traceparent extension is the delivery's
+// span when it's traced, otherwise a trace shared by an orchestration's events is derived from its ID.
+func cloudEvent(delivery *WebhookDelivery, traceParent string) ([]byte, error) {
+	native, err := parseWebhookPayload(delivery.Payload)
+	if err != nil {
+		return nil, err
+	}
+	data := delivery.Payload
+	if native.Data != nil {
+		data = native.Data
+	}
+
+	sum := sha256.Sum256(delivery.Payload)
+	event := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(sum[:16]),
+		Source:          "/projects/" + delivery.ProjectID,
+		Type:            cloudEventTypePrefix + delivery.Event,
+		Time:            delivery.Timestamp,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	if native.Timestamp != nil {
+		event.Time = *native.Timestamp
+	}
+
+	traceKey := event.ID
+	switch {
+	case native.OrchestrationID != "":
+		event.Subject = "orchestrations/" + native.OrchestrationID
+		traceKey = native.OrchestrationID
+	case native.ServiceID != "":
+		event.Subject = "services/" + native.ServiceID
+	}
+	event.Traceparent = traceParent
+	if event.Traceparent == "" {
+		traceID := sha256.Sum256([]byte(traceKey))
+		event.Traceparent = fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(traceID[:16]), hex.EncodeToString(sum[16:24]))
+	}
+
+	return json.Marshal(event)
+}
@@ -0,0 +1,102 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudEventsWebhookFormat(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+
+	type delivery struct {
+		contentType string
+		body        []byte
+	}
+	deliveries := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{contentType: r.Header.Get("Content-Type"), body: body}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	received := func() delivery {
+		t.Helper()
+		select {
+		case d := <-deliveries:
+			return d
+		case <-time.After(2 * time.Second):
+			t.Fatal("webhook was not notified")
+			return delivery{}
+		}
+	}
+
+	w := request(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`","format":"cloudevents"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var added ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&added))
+	assert.Equal(t, WebhookFormatCloudEvents, added.Format)
+
+	app.Engine.NotifyProjectWebhooks(app.Engine.projects[project.ID], ProjectEventOrchestrationFailed, map[string]any{
+		"orchestrationId": "o_abc",
+		"reason":          "out of budget",
+	})
+	d := received()
+	assert.Equal(t, cloudEventsContentType, d.contentType)
+
+	var event CloudEvent
+	require.NoError(t, json.Unmarshal(d.body, &event))
+	assert.Equal(t, "1.0", event.SpecVersion)
+	assert.Equal(t, "dev.orra.orchestration.failed", event.Type)
+	assert.Equal(t, "/projects/"+project.ID, event.Source)
+	assert.Equal(t, "orchestrations/o_abc", event.Subject)
+	assert.Equal(t, "application/json", event.DataContentType)
+	assert.JSONEq(t, `{"orchestrationId":"o_abc","reason":"out of budget"}`, string(event.Data))
+	assert.NotEmpty(t, event.ID)
+	assert.False(t, event.Time.IsZero())
+	assert.Regexp(t, regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`), event.Traceparent)
+
+	app.Engine.NotifyProjectWebhooks(app.Engine.projects[project.ID], ProjectEventTaskFailed, map[string]any{
+		"orchestrationId": "o_abc",
+	})
+	var next CloudEvent
+	require.NoError(t, json.Unmarshal(received().body, &next))
+	assert.NotEqual(t, event.ID, next.ID)
+	assert.Equal(t, event.Traceparent[3:35], next.Traceparent[3:35], "an orchestration's events share a trace")
+
+	w = request(http.MethodPatch, "/webhooks/"+added.ID, `{"format":"native"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	app.Engine.NotifyProjectWebhooks(app.Engine.projects[project.ID], ProjectEventServiceDrained, nil)
+	d = received()
+	assert.Equal(t, "application/json", d.contentType)
+	assert.Contains(t, string(d.body), `"event":"service.drained"`)
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/other","format":"xml"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+added.ID, `{"format":"xml"}`).Code)
+	})
+}
@@ -0,0 +1,147 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+)
+
+// reservedWebhookHeaders are set by the plan engine on every delivery and can't be overridden
+var reservedWebhookHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Host",
+	"User-Agent",
+	WebhookSignatureHeader,
+}
+
+// forbiddenWebhookHeaders control the connection rather than carry data, or are what cloud metadata services
+// expect, so they're never sent as static headers. Destinations themselves are kept public, see validateWebhookURL.
+var forbiddenWebhookHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Metadata",
+	"Metadata-Flavor",
+	"X-Aws-Ec2-Metadata-Token",
+	"X-Aws-Ec2-Metadata-Token-Ttl-Seconds",
+	"X-Google-Metadata-Request",
+}
+
+// WebhookRequest holds the static headers sent with every delivery to a webhook and how long a delivery may
+// take, e.g. for internal endpoints requiring an auth token. A zero timeout uses WebhookDefaultTimeout.
+type WebhookRequest struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout time.Duration     `json:"timeout,omitempty"`
+}
+
+func (r WebhookRequest) timeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return WebhookDefaultTimeout
+}
+
+// headerNames lists a webhook's static headers without their values, which often hold credentials
+func (r WebhookRequest) headerNames() []string {
+	if len(r.Headers) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// newWebhookRequest canonicalises the header names of a webhook's request options
+func newWebhookRequest(headers map[string]string, timeout *Duration) WebhookRequest {
+	request := WebhookRequest{}
+	if len(headers) > 0 {
+		request.Headers = make(map[string]string, len(headers))
+		for name, value := range headers {
+			request.Headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+		}
+	}
+	if timeout != nil {
+		request.Timeout = timeout.Duration
+	}
+	return request
+}
+
+func validateWebhookHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return errs.E(errs.Validation, errs.Parameter("headers"), fmt.Sprintf("invalid header name %q", name))
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return errs.E(errs.Validation, errs.Parameter("headers"), fmt.Sprintf("invalid value for header %q", name))
+		}
+		if slices.Contains(reservedWebhookHeaders, textproto.CanonicalMIMEHeaderKey(name)) {
+			return errs.E(errs.Validation, errs.Parameter("headers"), fmt.Sprintf("header %q is set by orra and can't be overridden", name))
+		}
+		if slices.Contains(forbiddenWebhookHeaders, textproto.CanonicalMIMEHeaderKey(name)) {
+			return errs.E(errs.Validation, errs.Parameter("headers"), fmt.Sprintf("header %q can't be sent to webhooks", name))
+		}
+	}
+	return nil
+}
+
+func validateWebhookTimeout(timeout *Duration) error {
+	if timeout == nil {
+		return nil
+	}
+	if timeout.Duration < 0 || timeout.Duration > WebhookMaxTimeout {
+		return errs.E(errs.Validation, errs.Parameter("timeout"), fmt.Sprintf("timeout must be between 0s and %s", WebhookMaxTimeout))
+	}
+	return nil
+}
+
+func (p *Project) setWebhookRequest(webhookUrl string, request WebhookRequest) {
+	if len(request.Headers) == 0 && request.Timeout == 0 {
+		delete(p.WebhookRequests, webhookUrl)
+		return
+	}
+	if p.WebhookRequests == nil {
+		p.WebhookRequests = make(map[string]WebhookRequest)
+	}
+	request.Headers = maps.Clone(request.Headers)
+	p.WebhookRequests[webhookUrl] = request
+}
+
+// webhookRequest returns a webhook's request options, callbacks and webhooks without any get the defaults
+func (p *PlanEngine) webhookRequest(projectID, webhookUrl string) WebhookRequest {
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return WebhookRequest{}
+	}
+	return project.WebhookRequests[webhookUrl]
+}
+
+func (r WebhookRequest) apply(req *http.Request) {
+	for name, value := range r.Headers {
+		if slices.Contains(forbiddenWebhookHeaders, name) {
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHeadersAndTimeout(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+
+	headers := make(chan http.Header, 1)
+	var delay time.Duration
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`","headers":{"authorization":"Bearer internal-token","X-Team":"payments"},"timeout":"2s"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var added ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&added))
+	assert.Equal(t, []string{"Authorization", "X-Team"}, added.Headers)
+	assert.Equal(t, "2s", added.Timeout)
+
+	w = request(http.MethodGet, "/webhooks", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "internal-token", "header values are never shown")
+
+	event := ProjectEvent{Event: ProjectEventServiceDrained, ProjectID: project.ID}
+	require.NoError(t, app.Engine.postWebhook(project.ID, receiver.URL, event.Event, event))
+	received := <-headers
+	assert.Equal(t, "Bearer internal-token", received.Get("Authorization"))
+	assert.Equal(t, "payments", received.Get("X-Team"))
+	assert.Equal(t, "application/json", received.Get("Content-Type"))
+
+	stored, err := app.Db.LoadProject(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, stored.WebhookRequests[receiver.URL].Timeout)
+
+	w = request(http.MethodPatch, "/webhooks/"+added.ID, `{"timeout":"100ms"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	delay = 300 * time.Millisecond
+	err = app.Engine.postWebhook(project.ID, receiver.URL, event.Event, event)
+	require.Error(t, err, "deliveries are cut off at the webhook's timeout")
+	<-headers
+
+	delay = 0
+	w = request(http.MethodPatch, "/webhooks/"+added.ID, `{"headers":{},"timeout":"0s"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Empty(t, updated.Headers)
+	assert.Empty(t, updated.Timeout)
+	assert.NotContains(t, app.Engine.projects[project.ID].WebhookRequests, receiver.URL)
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+added.ID, `{"headers":{"Content-Type":"text/plain"}}`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+added.ID, `{"headers":{"X-Bad":"a\r\nb"}}`).Code)
+		for _, name := range []string{"Host", "connection", "Transfer-Encoding", "Metadata-Flavor", "X-aws-ec2-metadata-token"} {
+			body := `{"headers":{"` + name + `":"value"}}`
+			assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+added.ID, body).Code, name)
+			assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/other",`+body[1:]).Code, name)
+		}
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPatch, "/webhooks/"+added.ID, `{"timeout":"5m"}`).Code)
+	})
+}
@@ -0,0 +1,198 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gilcrest/diygoapi/errs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// WebhookSignatureHeader carries a delivery's signature, as "t=<unix timestamp>,v1=<signature>". Each signature
+	// is the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with one of the webhook's secrets, there's a
+	// second one while a rotated out secret is still valid.
+	WebhookSignatureHeader = "X-Orra-Signature"
+	webhookSecretPrefix    = "whsec_"
+)
+
+// WebhookSecret signs a webhook's deliveries. A rotated out secret keeps signing them, alongside the current
+// one, until it expires so receivers have time to switch over.
+type WebhookSecret struct {
+	Current           string     `json:"current"`
+	Previous          string     `json:"previous,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previousExpiresAt,omitempty"`
+}
+
+// ProjectWebhookSecret is a webhook's newly generated signing secret, it's only ever shown once
+type ProjectWebhookSecret struct {
+	ID                string     `json:"id"`
+	Url               string     `json:"url"`
+	Secret            string     `json:"secret"`
+	PreviousExpiresAt *time.Time `json:"previousExpiresAt,omitempty"`
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(secret), nil
+}
+
+// signingSecrets returns the secrets deliveries are signed with at the time
+func (s WebhookSecret) signingSecrets(now time.Time) []string {
+	secrets := []string{s.Current}
+	if s.Previous != "" && s.PreviousExpiresAt != nil && now.Before(*s.PreviousExpiresAt) {
+		secrets = append(secrets, s.Previous)
+	}
+	return secrets
+}
+
+func signWebhookPayload(secrets []string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	parts := []string{"t=" + ts}
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		parts = append(parts, "v1="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// webhookSignature signs a delivery to one of the project's webhooks. Webhooks added before deliveries were
+// signed have no secret until it's first rotated, their deliveries are sent unsigned.
+func (p *PlanEngine) webhookSignature(projectID, webhookUrl string, timestamp time.Time, body []byte) string {
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return ""
+	}
+	secret, ok := project.WebhookSecrets[webhookUrl]
+	if !ok {
+		return ""
+	}
+	return signWebhookPayload(secret.signingSecrets(timestamp), timestamp, body)
+}
+
+// moveWebhookSecret keeps a webhook's secret when its URL changes, or drops it with the webhook when to is empty
+func (p *Project) moveWebhookSecret(from, to string) {
+	secret, ok := p.WebhookSecrets[from]
+	if !ok {
+		return
+	}
+	delete(p.WebhookSecrets, from)
+	if to != "" {
+		p.WebhookSecrets[to] = secret
+	}
+}
+
+func (p *Project) setWebhookSecret(webhookUrl string, secret WebhookSecret) {
+	if p.WebhookSecrets == nil {
+		p.WebhookSecrets = make(map[string]WebhookSecret)
+	}
+	p.WebhookSecrets[webhookUrl] = secret
+}
+
+// RotateProjectWebhookSecret replaces a webhook's signing secret. Deliveries are also signed with the replaced
+// secret for the grace period, a zero grace period revokes it straight away.
+func (p *PlanEngine) RotateProjectWebhookSecret(projectID, id string, gracePeriod time.Duration) (ProjectWebhookSecret, error) {
+	p.projectWriteMu.Lock()
+	defer p.projectWriteMu.Unlock()
+
+	project, err := p.GetProjectByID(projectID)
+	if err != nil {
+		return ProjectWebhookSecret{}, err
+	}
+
+	i := project.webhookIndex(id)
+	if i < 0 {
+		return ProjectWebhookSecret{}, ErrProjectWebhookNotFound
+	}
+	webhookUrl := project.Webhooks[i]
+
+	current, err := generateWebhookSecret()
+	if err != nil {
+		return ProjectWebhookSecret{}, err
+	}
+	secret := WebhookSecret{Current: current}
+	if previous, ok := project.WebhookSecrets[webhookUrl]; ok && gracePeriod > 0 {
+		expiresAt := time.Now().UTC().Add(gracePeriod)
+		secret.Previous = previous.Current
+		secret.PreviousExpiresAt = &expiresAt
+	}
+
+	updated := project.withoutPlaintextAPIKeys()
+	updated.WebhookSecrets = maps.Clone(project.WebhookSecrets)
+	updated.setWebhookSecret(webhookUrl, secret)
+	if err := p.updateProject(updated); err != nil {
+		return ProjectWebhookSecret{}, err
+	}
+
+	return ProjectWebhookSecret{
+		ID:                id,
+		Url:               webhookUrl,
+		Secret:            secret.Current,
+		PreviousExpiresAt: secret.PreviousExpiresAt,
+	}, nil
+}
+
+// secretRotationRequest is the optional body of a webhook secret rotation
+type secretRotationRequest struct {
+	GracePeriod *Duration `json:"gracePeriod"`
+}
+
+// RotateWebhookSecret replaces the signing secret of one of the caller's project webhooks
+func (app *App) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	project, err := app.requestProject(r)
+	if err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, err))
+		return
+	}
+
+	var request secretRotationRequest
+	if err := decodeOptionalRequest(w, r, &request, secretRotationFields); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), err)
+		return
+	}
+	gracePeriod := WebhookSecretGracePeriod
+	if request.GracePeriod != nil {
+		if request.GracePeriod.Duration < 0 || request.GracePeriod.Duration > WebhookSecretMaxGrace {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Validation, errs.Parameter("gracePeriod"), fmt.Sprintf("gracePeriod must be at most %s", WebhookSecretMaxGrace)))
+			return
+		}
+		gracePeriod = request.GracePeriod.Duration
+	}
+
+	secret, err := app.Engine.RotateProjectWebhookSecret(project.ID, mux.Vars(r)["id"], gracePeriod)
+	if err != nil {
+		if errors.Is(err, ErrProjectWebhookNotFound) {
+			httpErrorResponse(w, app.requestLogger(r), errs.E(errs.NotExist, err))
+			return
+		}
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.InvalidRequest, errs.Code(ProjectWebhookUpdateFailedErrCode), err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(secret); err != nil {
+		httpErrorResponse(w, app.requestLogger(r), errs.E(errs.Unanticipated, errs.Code(JSONMarshalingFailErrCode), err))
+		return
+	}
+}
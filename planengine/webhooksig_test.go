@@ -0,0 +1,121 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedWebhookDeliveries(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+	require.NoError(t, app.Db.StoreProject(project))
+
+	type delivery struct {
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{signature: r.Header.Get(WebhookSignatureHeader), body: body}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer project-api-key")
+		w := httptest.NewRecorder()
+		app.Router.ServeHTTP(w, req)
+		return w
+	}
+	// signatures verifies a delivery as a receiver would, returning the secrets it was signed with
+	signatures := func(secrets ...string) []string {
+		t.Helper()
+		app.Engine.NotifyProjectWebhooks(app.Engine.projects[project.ID], ProjectEventServiceDrained, nil)
+		var d delivery
+		select {
+		case d = <-deliveries:
+		case <-time.After(2 * time.Second):
+			t.Fatal("project webhook was not notified")
+		}
+
+		parts := strings.Split(d.signature, ",")
+		require.True(t, strings.HasPrefix(parts[0], "t="), d.signature)
+		var signedWith []string
+		for _, part := range parts[1:] {
+			for _, secret := range secrets {
+				mac := hmac.New(sha256.New, []byte(secret))
+				mac.Write([]byte(strings.TrimPrefix(parts[0], "t=") + "."))
+				mac.Write(d.body)
+				if part == "v1="+hex.EncodeToString(mac.Sum(nil)) {
+					signedWith = append(signedWith, secret)
+				}
+			}
+		}
+		require.Len(t, signedWith, len(parts)-1, "every signature is made with a known secret")
+		return signedWith
+	}
+
+	w := request(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var added ProjectWebhook
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&added))
+	require.True(t, strings.HasPrefix(added.Secret, webhookSecretPrefix))
+	assert.Equal(t, []string{added.Secret}, signatures(added.Secret))
+
+	w = request(http.MethodGet, "/webhooks", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), added.Secret, "secrets are only shown once")
+
+	rotate := func(body string) ProjectWebhookSecret {
+		t.Helper()
+		w := request(http.MethodPost, "/webhooks/"+added.ID+"/rotate-secret", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var rotated ProjectWebhookSecret
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&rotated))
+		return rotated
+	}
+
+	rotated := rotate(`{"gracePeriod":"1h"}`)
+	assert.NotEqual(t, added.Secret, rotated.Secret)
+	require.NotNil(t, rotated.PreviousExpiresAt)
+	assert.Equal(t, []string{rotated.Secret, added.Secret}, signatures(rotated.Secret, added.Secret), "the rotated out secret still signs deliveries")
+
+	stored, err := app.Db.LoadProject(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, rotated.Secret, stored.WebhookSecrets[receiver.URL].Current)
+
+	revoked := rotate(`{"gracePeriod":"0s"}`)
+	assert.Nil(t, revoked.PreviousExpiresAt)
+	assert.Equal(t, []string{revoked.Secret}, signatures(revoked.Secret, rotated.Secret, added.Secret))
+
+	t.Run("rotations without a body keep the old secret for the default grace period", func(t *testing.T) {
+		rotated := rotate("")
+		require.NotNil(t, rotated.PreviousExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(WebhookSecretGracePeriod), *rotated.PreviousExpiresAt, time.Minute)
+	})
+
+	t.Run("rejects invalid rotations", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks/wh_unknown/rotate-secret", "").Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks/"+added.ID+"/rotate-secret", `{"gracePeriod":"200h"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/webhooks/"+added.ID+"/rotate-secret", `{"gracePeriod":"1h","revoke":true}`).Code)
+	})
+}
@@ -8,7 +8,6 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"time"
 
@@ -21,28 +20,64 @@ func NewWebSocketManager(logger zerolog.Logger) *WebSocketManager {
 	m.Config.ConcurrentMessageHandling = true
 	m.Config.WriteWait = WSWriteTimeOut
 	m.Config.MaxMessageSize = WSMaxMessageBytes
+	m.Upgrader.Subprotocols = []string{WSTokenSubprotocol}
 
-	return &WebSocketManager{
+	wsm := &WebSocketManager{
 		melody:            m,
 		logger:            logger,
-		connMap:           make(map[string]*melody.Session),
+		connMap:           make(map[string]*serviceInstances),
 		messageExpiration: time.Hour * 24, // Keep messages for 24 hours
-		pingInterval:      m.Config.PingPeriod,
-		pongWait:          m.Config.PongWait,
+		pingInterval:      WSPingInterval,
+		maxMissedPings:    WSMaxMissedPings,
 		serviceHealth:     make(map[string]bool),
+		lastSeen:          make(map[string]time.Time),
+		tokens:            NewWSTokenStore(WSTokenTTL),
+		deliveries:        make(map[string]*pendingDelivery),
+		ackTimeout:        WSAckTimeout,
+		maxRedeliveries:   WSMaxRedeliveries,
+		outboxes:          make(map[string]*serviceOutbox),
+		resumeWindow:      WSResumeWindow,
+		maxBuffered:       WSMaxBufferedMessages,
+		callbackClient:    newCallbackClient(),
+		affinities:        make(map[string]map[string]string),
+		draining:          make(map[string]bool),
+		sendQueueSize:     WSSendQueueSize,
+		busyThreshold:     WSSendQueueBusyThreshold,
+		probeTimeout:      WSProbeTimeout,
+		probeThreshold:    WSProbeFailureThreshold,
 	}
+	m.HandleSentMessage(wsm.handleMessageSent)
+	m.HandleSentMessageBinary(wsm.handleMessageSent)
+	return wsm
 }
 
-func (wsm *WebSocketManager) HandleConnection(serviceID string, serviceName string, s *melody.Session) {
+// ConfigureHeartbeat replaces the default keepalive settings, unset settings keep their defaults
+func (wsm *WebSocketManager) ConfigureHeartbeat(cfg Heartbeat) {
+	if cfg.PingInterval > 0 {
+		wsm.pingInterval = cfg.PingInterval
+	}
+	if cfg.MaxMissedPings > 0 {
+		wsm.maxMissedPings = cfg.MaxMissedPings
+	}
+}
+
+func (wsm *WebSocketManager) HandleConnection(serviceID string, serviceName string, s serviceSession) {
 	s.Set("serviceID", serviceID)
 	s.Set("lastPong", time.Now().UTC())
+	s.Set(sendQueueKey, &sendQueue{})
+	s.Set(chunksKey, newChunkAssembler())
 
-	wsm.connMu.Lock()
-	wsm.connMap[serviceID] = s
-	wsm.connMu.Unlock()
+	if err := wsm.connect(serviceID, s); err != nil {
+		wsm.logger.Error().Err(err).Str("ServiceID", serviceID).Msg("Failed to resume service connection")
+	}
 
 	wsm.UpdateServiceHealth(serviceID, true)
-	go wsm.pingRoutine(serviceID)
+	wsm.stopDraining(serviceID)
+	go wsm.pingRoutine(serviceID, s)
+	if wsm.probeInterval > 0 && answersProbes(s) {
+		s.Set(healthProbeKey, &healthProbe{})
+		go wsm.probeRoutine(serviceID, s)
+	}
 
 	wsm.logger.Info().
 		Str("serviceID", serviceID).
@@ -50,19 +85,42 @@ func (wsm *WebSocketManager) HandleConnection(serviceID string, serviceName stri
 		Msg("New WebSocket connection established")
 }
 
-func (wsm *WebSocketManager) HandleDisconnection(serviceID string) {
-	wsm.connMu.Lock()
-	delete(wsm.connMap, serviceID)
-	wsm.connMu.Unlock()
-
-	wsm.UpdateServiceHealth(serviceID, false)
+func (wsm *WebSocketManager) HandleDisconnection(serviceID string, s serviceSession) {
+	// A reconnected service may have replaced the session before the old one was closed
+	removed, remaining := wsm.disconnect(serviceID, s)
+	switch {
+	case removed && remaining == 0:
+		wsm.healthMu.Lock()
+		wsm.lastSeen[serviceID] = time.Now().UTC()
+		wsm.healthMu.Unlock()
+		wsm.UpdateServiceHealth(serviceID, false)
+		if wsm.onDisconnect != nil {
+			wsm.onDisconnect(serviceID)
+		}
+	case removed:
+		// The service's other instances take over the tasks this instance has yet to acknowledge
+		wsm.requeueDeliveries(serviceID, sessionInstanceID(s))
+	}
 	wsm.logger.Info().Str("ServiceID", serviceID).Msg("WebSocket connection closed")
 }
 
-func (wsm *WebSocketManager) HandleMessage(s *melody.Session, msg []byte, fn ServiceFinder) {
+// DisconnectService closes every connected instance of the service
+func (wsm *WebSocketManager) DisconnectService(serviceID string) {
+	for _, session := range wsm.instanceSessions(serviceID) {
+		if err := session.Close(); err != nil {
+			wsm.logger.Debug().Err(err).Str("ServiceID", serviceID).Msg("Service connection was already closed")
+		}
+	}
+}
+
+func (wsm *WebSocketManager) HandleMessage(s serviceSession, msg []byte, fn ServiceFinder) {
 	var messageWrapper struct {
-		ID      string          `json:"id"`
-		Payload json.RawMessage `json:"payload"`
+		Type            string          `json:"type"`
+		ID              string          `json:"id"`
+		ProtocolVersion int             `json:"protocolVersion"`
+		Payload         json.RawMessage `json:"payload"`
+		// RequestID correlates the message with the logs about it, the message's ID is used when it's missing
+		RequestID string `json:"requestId,omitempty"`
 	}
 
 	var messagePayload TaskResult
@@ -72,18 +130,65 @@ func (wsm *WebSocketManager) HandleMessage(s *melody.Session, msg []byte, fn Ser
 		return
 	}
 
+	// Messages too large for one WebSocket message arrive in chunks, the reassembled message is handled as usual
+	if messageWrapper.Type == WSChunk {
+		wsm.handleChunk(s, msg, fn)
+		return
+	}
+
+	messageRequestID := messageWrapper.RequestID
+	if messageRequestID == "" {
+		messageRequestID = messageWrapper.ID
+	}
+	logger := wsm.logger.With().Str("RequestID", requestID(messageRequestID)).Logger()
+
+	// Envelopes without a version are from services predating versioning, their messages are handled as before
+	if version := messageWrapper.ProtocolVersion; version != 0 && version != sessionProtocolVersion(s) {
+		logger.Warn().
+			Str("ServiceID", sessionServiceID(s)).
+			Str("MessageID", messageWrapper.ID).
+			Int("ProtocolVersion", version).
+			Int("NegotiatedProtocolVersion", sessionProtocolVersion(s)).
+			Msg("Rejected message with a protocol version the connection didn't negotiate")
+		if err := wsm.rejectProtocolVersion(s, messageWrapper.ID, version); err != nil {
+			logger.Error().Err(err).Msg("Failed to send protocol error")
+		}
+		return
+	}
+
 	if err := json.Unmarshal(messageWrapper.Payload, &messagePayload); err != nil {
-		wsm.logger.Error().Err(err).Msg("Failed to unmarshal WebSocket messageWrapper payload")
+		logger.Error().Err(err).Msg("Failed to unmarshal WebSocket messageWrapper payload")
 		return
 	}
 
+	// Messages are from the service the connection was opened for, whichever service they claim to be from
+	serviceID := sessionServiceID(s)
+	if serviceID == "" {
+		logger.Warn().Str("MessageID", messageWrapper.ID).Msg("Dropped message from a connection without a service")
+		return
+	}
+	if messagePayload.ServiceID != "" && messagePayload.ServiceID != serviceID {
+		logger.Warn().
+			Str("ServiceID", serviceID).
+			Str("ClaimedServiceID", messagePayload.ServiceID).
+			Str("MessageID", messageWrapper.ID).
+			Msg("Message claimed to be from another service")
+	}
+	messagePayload.ServiceID = serviceID
+
 	switch messagePayload.Type {
 	case WSPong:
 		s.Set("lastPong", time.Now().UTC())
 		wsm.UpdateServiceHealth(messagePayload.ServiceID, true)
+	case WSTaskAck:
+		wsm.acknowledgeDelivery(messagePayload.ServiceID, messagePayload.DeliveryID, messagePayload.ExecutionID)
+	case WSTaskHeartbeat:
+		wsm.UpdateServiceHealth(messagePayload.ServiceID, true)
+		wsm.acknowledgeDelivery(messagePayload.ServiceID, messagePayload.DeliveryID, messagePayload.ExecutionID)
 	case "task_status":
 		wsm.UpdateServiceHealth(messagePayload.ServiceID, true)
-		wsm.logger.
+		wsm.acknowledgeDelivery(messagePayload.ServiceID, "", messagePayload.ExecutionID)
+		logger.
 			Info().
 			Str("IdempotencyKey", string(messagePayload.IdempotencyKey)).
 			Str("ServiceID", messagePayload.ServiceID).
@@ -92,31 +197,39 @@ func (wsm *WebSocketManager) HandleMessage(s *melody.Session, msg []byte, fn Ser
 			Msgf("Task status: %s", messagePayload.Status)
 	case "task_interim_result":
 		wsm.UpdateServiceHealth(messagePayload.ServiceID, true)
-		wsm.handleInterimTaskResult(messagePayload, fn)
+		wsm.acknowledgeDelivery(messagePayload.ServiceID, "", messagePayload.ExecutionID)
+		wsm.handleInterimTaskResult(logger, messagePayload, fn)
+	case WSHealthProbeResult:
+		wsm.handleHealthProbeResult(s, messagePayload)
+	case WSTaskLog:
+		wsm.handleTaskLogs(s, serviceID, messageWrapper.Payload)
 	case "task_result":
 		wsm.UpdateServiceHealth(messagePayload.ServiceID, true)
-		wsm.handleTaskResult(messagePayload, fn)
+		wsm.completeDelivery(messagePayload.ServiceID, messagePayload.ExecutionID)
+		wsm.handleTaskResult(logger, messagePayload, fn)
 	default:
-		wsm.logger.Warn().Str("type", messagePayload.Type).Msg("Received unknown messageWrapper type")
+		logger.Warn().Str("type", messagePayload.Type).Msg("Received unknown messageWrapper type")
 	}
 
 	if err := wsm.acknowledgeMessageReceived(s, messageWrapper.ID); err != nil {
-		wsm.logger.Error().Err(err).Msg("Failed to handle messageWrapper acknowledgement")
+		logger.Error().Err(err).Msg("Failed to handle messageWrapper acknowledgement")
 		return
 	}
 }
 
-func (wsm *WebSocketManager) acknowledgeMessageReceived(s *melody.Session, id string) error {
+func (wsm *WebSocketManager) acknowledgeMessageReceived(s serviceSession, id string) error {
 	if isPong := id == WSPong; isPong {
 		return nil
 	}
 
 	ack := struct {
-		Type string `json:"type"`
-		ID   string `json:"id"`
+		Type            string `json:"type"`
+		ID              string `json:"id"`
+		ProtocolVersion int    `json:"protocolVersion"`
 	}{
-		Type: "ACK",
-		ID:   id,
+		Type:            "ACK",
+		ID:              id,
+		ProtocolVersion: CurrentProtocolVersion,
 	}
 
 	acknowledgement, err := json.Marshal(ack)
@@ -124,7 +237,7 @@ func (wsm *WebSocketManager) acknowledgeMessageReceived(s *melody.Session, id st
 		return fmt.Errorf("failed to marshal acknowledgement: %w", err)
 	}
 
-	if err := s.Write(acknowledgement); err != nil {
+	if err := wsm.writeMessage(s, acknowledgement); err != nil {
 		wsm.logger.Error().Err(err).Msg("Failed to send ACK")
 		return fmt.Errorf("failed to send acknowledgement of receipt: %w", err)
 	}
@@ -132,10 +245,10 @@ func (wsm *WebSocketManager) acknowledgeMessageReceived(s *melody.Session, id st
 	return nil
 }
 
-func (wsm *WebSocketManager) handleInterimTaskResult(message TaskResult, fn ServiceFinder) {
+func (wsm *WebSocketManager) handleInterimTaskResult(logger zerolog.Logger, message TaskResult, fn ServiceFinder) {
 	service, err := fn(message.ServiceID)
 	if err != nil {
-		wsm.logger.Error().
+		logger.Error().
 			Err(err).
 			Str("serviceID", message.ServiceID).
 			Msg("Failed to get service when handling interim task result")
@@ -143,17 +256,17 @@ func (wsm *WebSocketManager) handleInterimTaskResult(message TaskResult, fn Serv
 	}
 
 	service.IdempotencyStore.TrackInterimResult(message.IdempotencyKey, message.Result)
-	wsm.logger.Debug().
+	logger.Debug().
 		Str("IdempotencyKey", string(message.IdempotencyKey)).
 		Str("ServiceID", message.ServiceID).
 		Str("TaskID", message.TaskID).
 		Msg("Received interim task result")
 }
 
-func (wsm *WebSocketManager) handleTaskResult(message TaskResult, fn ServiceFinder) {
+func (wsm *WebSocketManager) handleTaskResult(logger zerolog.Logger, message TaskResult, fn ServiceFinder) {
 	service, err := fn(message.ServiceID)
 	if err != nil {
-		wsm.logger.Error().
+		logger.Error().
 			Err(err).
 			Str("serviceID", message.ServiceID).
 			Msg("Failed to get service when handling task result")
@@ -163,83 +276,104 @@ func (wsm *WebSocketManager) handleTaskResult(message TaskResult, fn ServiceFind
 	service.IdempotencyStore.UpdateExecutionResult(
 		message.IdempotencyKey,
 		message.Result,
-		parseError(message.Error),
+		parseError(message),
 	)
 }
 
-func parseError(errStr string) error {
-	if errStr == "" {
+func parseError(message TaskResult) error {
+	if message.Error == "" {
 		return nil
 	}
-	return errors.New(errStr)
+	return &TaskError{
+		Code:      message.ErrorCode,
+		Message:   message.Error,
+		Retryable: message.Retryable,
+		Details:   message.ErrorDetails,
+	}
 }
 
+// SendTask delivers a task to its service, redelivering it until the service acknowledges it.
+// Tasks for disconnected services are delivered once they reconnect.
 func (wsm *WebSocketManager) SendTask(serviceID string, task *Task) error {
-	wsm.connMu.RLock()
-	session, connected := wsm.connMap[serviceID]
-	wsm.connMu.RUnlock()
+	task.ServiceID = serviceID
+	task.ProtocolVersion = CurrentProtocolVersion
+	wsm.trackDelivery(task)
 
-	message, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("failed to convert message to JSON for service %s: %w", serviceID, err)
+	if err := wsm.deliver(task.DeliveryID, time.Now().UTC()); err != nil {
+		wsm.forgetDelivery(task.DeliveryID)
+		return err
 	}
+	return nil
+}
 
-	if !connected {
-		return nil
+func (wsm *WebSocketManager) SendTaskCancellation(serviceID string, cancellation *TaskCancellation) error {
+	wsm.dropDeliveries(serviceID, cancellation.OrchestrationID, cancellation.ID)
+
+	cancellation.ProtocolVersion = CurrentProtocolVersion
+	message, err := json.Marshal(cancellation)
+	if err != nil {
+		return fmt.Errorf("failed to convert cancellation to JSON for service %s: %w", serviceID, err)
 	}
 
-	return session.Write(message)
+	return wsm.broadcast(serviceID, message)
 }
 
-func (wsm *WebSocketManager) pingRoutine(serviceID string) {
+// pingRoutine pings the service over its session until the session is closed or replaced by a reconnection.
+// A ping is missed when no pong arrives before the next one is due, too many missed in a row reap the connection.
+func (wsm *WebSocketManager) pingRoutine(serviceID string, session serviceSession) {
 	ticker := time.NewTicker(wsm.pingInterval)
 	defer ticker.Stop()
 
-	for {
-		<-ticker.C
-
-		wsm.connMu.RLock()
-		session, exists := wsm.connMap[serviceID]
-		wsm.connMu.RUnlock()
-
-		if !exists {
-			wsm.logger.Warn().
+	var lastPing time.Time
+	missed := 0
+	for range ticker.C {
+		if !wsm.isCurrentSession(serviceID, session) {
+			wsm.logger.Debug().
 				Str("ServiceID", serviceID).
 				Msg("Service connection has already been closed")
 			return
 		}
 
-		pingMessage := fmt.Sprintf(`{ "type": "%s", "serviceId": "%s" }`, WSPing, serviceID)
-		if err := session.Write([]byte(pingMessage)); err != nil {
-			wsm.logger.Warn().
-				Str("ServiceID", serviceID).
-				Err(err).
-				Msg("Failed to send ping, closing connection")
-
-			wsm.UpdateServiceHealth(serviceID, false)
-
-			if err := session.Close(); err != nil {
-				return
+		if !lastPing.IsZero() {
+			lastPong, ok := session.Get("lastPong")
+			if !ok || lastPong.(time.Time).Before(lastPing) {
+				missed++
+			} else {
+				missed = 0
 			}
+		}
+		if missed >= wsm.maxMissedPings {
+			wsm.reapConnection(serviceID, session, fmt.Errorf("missed %d pings in a row", missed))
 			return
 		}
 
-		// Check for pong response
-		lastPong, ok := session.Get("lastPong")
-		if !ok || time.Since(lastPong.(time.Time)) > wsm.pongWait {
-			wsm.logger.Warn().
-				Str("ServiceID", serviceID).
-				Msg("Pong timeout, closing connection")
-
-			wsm.UpdateServiceHealth(serviceID, false)
-
-			if err := session.Close(); err != nil {
-				return
-			}
-
+		pingMessage := fmt.Sprintf(`{ "type": "%s", "serviceId": "%s", "protocolVersion": %d }`, WSPing, serviceID, CurrentProtocolVersion)
+		if err := wsm.writeMessage(session, []byte(pingMessage)); err != nil {
+			wsm.reapConnection(serviceID, session, fmt.Errorf("failed to send ping: %w", err))
 			return
 		}
-		wsm.UpdateServiceHealth(serviceID, true)
+		lastPing = time.Now().UTC()
+	}
+}
+
+// reapConnection closes a stale service connection. When it's the service's last instance, the service is marked
+// unhealthy and its in-flight tasks are released, to be delivered again once the service reconnects.
+func (wsm *WebSocketManager) reapConnection(serviceID string, session serviceSession, reason error) {
+	wsm.logger.Warn().
+		Str("ServiceID", serviceID).
+		Err(reason).
+		Msg("Closing stale service connection")
+
+	// A service is only stale once its last instance is, until then its other instances take over
+	if len(wsm.instanceSessions(serviceID)) <= 1 {
+		wsm.UpdateServiceHealth(serviceID, false)
+		if wsm.onStaleConnection != nil {
+			wsm.onStaleConnection(serviceID)
+		}
+	}
+
+	if err := session.Close(); err != nil {
+		wsm.logger.Debug().Err(err).Str("ServiceID", serviceID).Msg("Stale service connection was already closed")
 	}
 }
 
@@ -255,3 +389,24 @@ func (wsm *WebSocketManager) IsServiceHealthy(serviceID string) bool {
 	healthy, exists := wsm.serviceHealth[serviceID]
 	return exists && healthy
 }
+
+// ServiceLastSeen is when one of the service's instances last answered a ping, or when its last instance
+// disconnected. Services that haven't connected since the plan engine started haven't been seen.
+func (wsm *WebSocketManager) ServiceLastSeen(serviceID string) (time.Time, bool) {
+	var lastSeen time.Time
+	for _, s := range wsm.instanceSessions(serviceID) {
+		if lastPong, ok := s.Get("lastPong"); ok {
+			if seen, ok := lastPong.(time.Time); ok && seen.After(lastSeen) {
+				lastSeen = seen
+			}
+		}
+	}
+	if !lastSeen.IsZero() {
+		return lastSeen, true
+	}
+
+	wsm.healthMu.RLock()
+	defer wsm.healthMu.RUnlock()
+	lastSeen, ok := wsm.lastSeen[serviceID]
+	return lastSeen, ok
+}
@@ -0,0 +1,486 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+	"github.com/orra-dev/orra/planengine/proto/orrav1"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStaleConnectionsAreReaped(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.ConfigureHeartbeat(Heartbeat{PingInterval: 20 * time.Millisecond, MaxMissedPings: 2})
+
+	var released atomic.Int32
+	wsm.onStaleConnection = func(serviceID string) {
+		if serviceID == "s_echo" {
+			released.Add(1)
+		}
+	}
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleDisconnect(func(s *melody.Session) {
+		wsm.HandleDisconnection("s_echo", s)
+	})
+	wsm.melody.HandleMessage(func(s *melody.Session, msg []byte) {
+		wsm.HandleMessage(s, msg, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Eventually(t, func() bool { return wsm.IsServiceHealthy("s_echo") }, time.Second, 5*time.Millisecond)
+
+	t.Run("connections answering pings stay open", func(t *testing.T) {
+		deadline := time.Now().Add(150 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			require.NoError(t, conn.SetReadDeadline(deadline))
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			var ping struct {
+				Type string `json:"type"`
+			}
+			require.NoError(t, json.Unmarshal(msg, &ping))
+			if ping.Type != WSPing {
+				continue
+			}
+			pong, _ := json.Marshal(map[string]any{"id": WSPong, "payload": map[string]string{"type": WSPong, "serviceId": "s_echo"}})
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, pong))
+		}
+		assert.True(t, wsm.IsServiceHealthy("s_echo"))
+		assert.Zero(t, released.Load())
+	})
+
+	t.Run("connections missing pings are reaped", func(t *testing.T) {
+		require.Eventually(t, func() bool { return released.Load() == 1 }, time.Second, 5*time.Millisecond)
+		assert.False(t, wsm.IsServiceHealthy("s_echo"))
+
+		assert.Eventually(t, func() bool {
+			wsm.connMu.RLock()
+			defer wsm.connMu.RUnlock()
+			_, connected := wsm.connMap["s_echo"]
+			return !connected
+		}, time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestReleaseServiceExecutions(t *testing.T) {
+	app, project, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	service := &ServiceInfo{ID: "s_echo", Name: "Echo", ProjectID: project.ID, IdempotencyStore: NewIdempotencyStore(0)}
+	app.Engine.services[project.ID] = map[string]*ServiceInfo{service.ID: service}
+
+	_, _, err := service.IdempotencyStore.InitializeOrGetExecution("key-1", "e_1")
+	require.NoError(t, err)
+	_, _, err = service.IdempotencyStore.InitializeOrGetExecution("key-2", "e_2")
+	require.NoError(t, err)
+	service.IdempotencyStore.UpdateExecutionResult("key-2", json.RawMessage(`{"ok":true}`), nil)
+
+	app.Engine.releaseServiceExecutions(service.ID)
+
+	inFlight, _ := service.IdempotencyStore.GetExecutionWithResult("key-1")
+	assert.Equal(t, ExecutionPaused, inFlight.State, "in-flight tasks are delivered again once the service reconnects")
+	completed, _ := service.IdempotencyStore.GetExecutionWithResult("key-2")
+	assert.Equal(t, ExecutionCompleted, completed.State)
+}
+
+func TestTasksAreRedeliveredUntilAcknowledged(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.ConfigureDelivery(TaskDelivery{AckTimeout: 20 * time.Millisecond, MaxRedeliveries: 2})
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleMessage(func(s *melody.Session, msg []byte) {
+		wsm.HandleMessage(s, msg, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	})
+
+	task := &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1", OrchestrationID: "o_1"}
+	require.NoError(t, wsm.SendTask("s_echo", task), "tasks for disconnected services wait for them to connect")
+	require.NotEmpty(t, task.DeliveryID)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool { return wsm.IsServiceHealthy("s_echo") }, time.Second, 5*time.Millisecond)
+
+	readTask := func() Task {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for {
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			var received Task
+			require.NoError(t, json.Unmarshal(msg, &received))
+			if received.Type == "task_request" {
+				return received
+			}
+		}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				wsm.redeliverOverdue(now)
+			}
+		}
+	}()
+
+	first := readTask()
+	second := readTask()
+	assert.Equal(t, task.DeliveryID, first.DeliveryID)
+	assert.Equal(t, first.DeliveryID, second.DeliveryID, "services discard redeliveries by their delivery ID")
+	assert.True(t, second.Redelivered)
+
+	ack, _ := json.Marshal(map[string]any{"id": "m_1", "payload": map[string]string{"type": WSTaskAck, "serviceId": "s_echo", "deliveryId": first.DeliveryID}})
+
+	// Other services can't acknowledge the service's deliveries by claiming to be it
+	other := &callbackSession{wsm: wsm, serviceID: "s_other", outbound: make(chan []byte, 10), done: make(chan struct{}), keys: map[string]any{}}
+	other.Set("serviceID", "s_other")
+	wsm.HandleMessage(other, ack, nil)
+	wsm.deliveryMu.Lock()
+	assert.Len(t, wsm.deliveries, 1)
+	wsm.deliveryMu.Unlock()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, ack))
+	require.Eventually(t, func() bool {
+		wsm.deliveryMu.Lock()
+		defer wsm.deliveryMu.Unlock()
+		return len(wsm.deliveries) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	t.Run("cancelled tasks are no longer redelivered", func(t *testing.T) {
+		cancelled := &Task{Type: "task_request", ID: "task2", ServiceID: "s_echo", ExecutionID: "e_2", IdempotencyKey: "key-2", OrchestrationID: "o_1"}
+		wsm.trackDelivery(cancelled)
+		_ = wsm.SendTaskCancellation("s_echo", &TaskCancellation{Type: "task_cancellation", ID: "task2", OrchestrationID: "o_1"})
+
+		wsm.deliveryMu.Lock()
+		defer wsm.deliveryMu.Unlock()
+		assert.Empty(t, wsm.deliveries)
+	})
+}
+
+func TestServicesResumeConnectionsWithBufferedMessages(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleDisconnect(func(s *melody.Session) {
+		wsm.HandleDisconnection("s_echo", s)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	type message struct {
+		Type     string `json:"type"`
+		ID       string `json:"id"`
+		Token    string `json:"token"`
+		Replayed int    `json:"replayed"`
+	}
+	read := func(conn *websocket.Conn) message {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for {
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			var received message
+			require.NoError(t, json.Unmarshal(msg, &received))
+			if received.Type != WSPing {
+				return received
+			}
+		}
+	}
+	dropConnection := func(conn *websocket.Conn) {
+		t.Helper()
+		require.NoError(t, conn.Close())
+		require.Eventually(t, func() bool { return !wsm.IsServiceHealthy("s_echo") }, time.Second, 5*time.Millisecond)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	issued := read(conn)
+	require.Equal(t, WSResumeToken, issued.Type)
+	require.True(t, strings.HasPrefix(issued.Token, WSResumeTokenPrefix))
+	dropConnection(conn)
+
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task1", IdempotencyKey: "key-1", OrchestrationID: "o_1"}))
+	require.NoError(t, wsm.SendTaskCancellation("s_echo", &TaskCancellation{Type: "task_cancellation", ID: "task0", OrchestrationID: "o_1"}))
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task2", IdempotencyKey: "key-2", OrchestrationID: "o_1"}))
+
+	conn, _, err = websocket.DefaultDialer.Dial(url+"?"+WSResumeQueryParam+"="+issued.Token, nil)
+	require.NoError(t, err)
+
+	resumed := read(conn)
+	assert.Equal(t, WSResumeToken, resumed.Type)
+	assert.Equal(t, 3, resumed.Replayed)
+	assert.NotEqual(t, issued.Token, resumed.Token, "resume tokens are single use")
+	assert.Equal(t, message{Type: "task_request", ID: "task1"}, read(conn))
+	assert.Equal(t, message{Type: "task_cancellation", ID: "task0"}, read(conn))
+	assert.Equal(t, message{Type: "task_request", ID: "task2"}, read(conn))
+
+	t.Run("messages are dropped for services reconnecting with a spent resume token", func(t *testing.T) {
+		dropConnection(conn)
+		require.NoError(t, wsm.SendTaskCancellation("s_echo", &TaskCancellation{Type: "task_cancellation", ID: "task3", OrchestrationID: "o_1"}))
+
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?"+WSResumeQueryParam+"="+issued.Token, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Zero(t, read(conn).Replayed)
+	})
+
+	t.Run("messages are not buffered past the resume window", func(t *testing.T) {
+		wsm.ConfigureReconnection(Reconnection{ResumeWindow: time.Millisecond})
+		wsm.connMu.Lock()
+		session := wsm.connMap["s_echo"].sessions[""]
+		wsm.connMu.Unlock()
+		require.NoError(t, session.Close())
+		require.Eventually(t, func() bool { return !wsm.IsServiceHealthy("s_echo") }, time.Second, 5*time.Millisecond)
+
+		time.Sleep(5 * time.Millisecond)
+		err := wsm.SendTaskCancellation("s_echo", &TaskCancellation{Type: "task_cancellation", ID: "task4", OrchestrationID: "o_1"})
+		assert.ErrorIs(t, err, ErrServiceNotConnected)
+	})
+}
+
+func TestTasksAreDispatchedAcrossServiceInstances(t *testing.T) {
+	// Instances disconnect as the test ends, after which test loggers can't be written to
+	wsm := NewWebSocketManager(zerolog.Nop())
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleDisconnect(func(s *melody.Session) {
+		wsm.HandleDisconnection("s_echo", s)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	dial := func(instanceID string, instances int) *websocket.Conn {
+		t.Helper()
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "?" + WSInstanceQueryParam + "=" + instanceID
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(wsm.instanceSessions("s_echo")) == instances }, time.Second, 5*time.Millisecond)
+		return conn
+	}
+	readTask := func(conn *websocket.Conn) Task {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for {
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			var received Task
+			require.NoError(t, json.Unmarshal(msg, &received))
+			if received.Type == "task_request" {
+				return received
+			}
+		}
+	}
+
+	first := dial("i_1", 1)
+	defer first.Close()
+	second := dial("i_2", 2)
+	defer second.Close()
+
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task1", ExecutionID: "e_1", IdempotencyKey: "key-1"}))
+	require.NoError(t, wsm.SendTask("s_echo", &Task{Type: "task_request", ID: "task2", ExecutionID: "e_2", IdempotencyKey: "key-2"}))
+	assert.Equal(t, "task1", readTask(first).ID)
+	assert.Equal(t, "task2", readTask(second).ID)
+
+	t.Run("other instances take over when an instance disconnects", func(t *testing.T) {
+		require.NoError(t, first.Close())
+		require.Eventually(t, func() bool { return len(wsm.instanceSessions("s_echo")) == 1 }, time.Second, 5*time.Millisecond)
+		assert.True(t, wsm.IsServiceHealthy("s_echo"))
+
+		wsm.redeliverOverdue(time.Now().UTC())
+		redelivered := readTask(second)
+		assert.Equal(t, "task1", redelivered.ID, "unacknowledged tasks are redelivered to the remaining instances")
+		assert.True(t, redelivered.Redelivered)
+	})
+
+	t.Run("the service is disconnected with its last instance", func(t *testing.T) {
+		require.NoError(t, second.Close())
+		require.Eventually(t, func() bool { return !wsm.IsServiceHealthy("s_echo") }, time.Second, 5*time.Millisecond)
+		assert.Empty(t, wsm.instanceSessions("s_echo"))
+	})
+}
+
+func TestStickyTasksStayOnOneServiceInstance(t *testing.T) {
+	// Instances disconnect as the test ends, after which test loggers can't be written to
+	wsm := NewWebSocketManager(zerolog.Nop())
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleDisconnect(func(s *melody.Session) {
+		wsm.HandleDisconnection("s_echo", s)
+	})
+
+	type reroute struct{ taskID, from, to string }
+	rerouted := make(chan reroute, 1)
+	wsm.onReroute = func(task Task, fromInstance, toInstance string) {
+		rerouted <- reroute{task.ID, fromInstance, toInstance}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	dial := func(instanceID string, instances int) *websocket.Conn {
+		t.Helper()
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "?" + WSInstanceQueryParam + "=" + instanceID
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(wsm.instanceSessions("s_echo")) == instances }, time.Second, 5*time.Millisecond)
+		return conn
+	}
+	readTaskID := func(conn *websocket.Conn) string {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for {
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			var received Task
+			require.NoError(t, json.Unmarshal(msg, &received))
+			if received.Type == "task_request" {
+				return received.ID
+			}
+		}
+	}
+	sendTask := func(id, orchestrationID string) {
+		t.Helper()
+		task := &Task{Type: "task_request", ID: id, ExecutionID: "e_" + id, IdempotencyKey: IdempotencyKey("key-" + id), OrchestrationID: orchestrationID, RoutingKey: orchestrationID}
+		require.NoError(t, wsm.SendTask("s_echo", task))
+		wsm.acknowledgeDelivery("s_echo", task.DeliveryID, "")
+	}
+
+	first := dial("i_1", 1)
+	defer first.Close()
+	second := dial("i_2", 2)
+	defer second.Close()
+
+	sendTask("task1", "o_1")
+	sendTask("task2", "o_1")
+	sendTask("task3", "o_2")
+	assert.Equal(t, "task1", readTaskID(first))
+	assert.Equal(t, "task2", readTaskID(first), "an orchestration's tasks go to the same instance")
+	assert.Equal(t, "task3", readTaskID(second))
+
+	t.Run("tasks fall back to another instance when theirs disconnects", func(t *testing.T) {
+		require.NoError(t, first.Close())
+		require.Eventually(t, func() bool { return len(wsm.instanceSessions("s_echo")) == 1 }, time.Second, 5*time.Millisecond)
+
+		sendTask("task4", "o_1")
+		assert.Equal(t, "task4", readTaskID(second))
+		assert.Equal(t, reroute{"task4", "i_1", "i_2"}, <-rerouted)
+
+		sendTask("task5", "o_1")
+		assert.Equal(t, "task5", readTaskID(second))
+		assert.Empty(t, rerouted, "tasks stay on the instance they fell back to")
+	})
+
+	t.Run("affinities are released with their orchestration", func(t *testing.T) {
+		wsm.releaseAffinities("o_1")
+		_, pinned := wsm.pinnedInstance("s_echo", "o_1")
+		assert.False(t, pinned)
+	})
+}
+
+func TestServicesNegotiateProtobufEncoding(t *testing.T) {
+	wsm := NewWebSocketManager(zerolog.New(zerolog.NewTestWriter(t)))
+	wsm.melody.HandleConnect(func(s *melody.Session) {
+		wsm.HandleConnection("s_echo", "Echo", s)
+	})
+	wsm.melody.HandleMessageBinary(func(s *melody.Session, msg []byte) {
+		wsm.HandleBinaryMessage(s, msg, func(string) (*ServiceInfo, error) { return nil, ErrServiceNotFound })
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = wsm.melody.HandleRequest(w, r)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?"+WSEncodingQueryParam+"="+ProtobufEncoding, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := func() *orrav1.EngineMessage {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for {
+			frameType, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			require.Equal(t, websocket.BinaryMessage, frameType)
+			var msg orrav1.EngineMessage
+			require.NoError(t, proto.Unmarshal(data, &msg))
+			if msg.GetPing() == nil {
+				return &msg
+			}
+		}
+	}
+
+	require.NotNil(t, read().GetResumeToken())
+
+	task := &Task{Type: "task_request", ID: "task1", ServiceID: "s_echo", Input: json.RawMessage(`{"embedding":[0.1,0.2]}`), IdempotencyKey: "key-1", OrchestrationID: "o_1"}
+	require.NoError(t, wsm.SendTask("s_echo", task))
+	received := read().GetTask()
+	require.NotNil(t, received)
+	assert.Equal(t, "task1", received.GetId())
+	assert.Equal(t, task.DeliveryID, received.GetDeliveryId())
+	assert.Equal(t, 0.2, received.GetInput().GetStructValue().GetFields()["embedding"].GetListValue().GetValues()[1].GetNumberValue())
+
+	ack, err := proto.Marshal(&orrav1.ServiceMessage{Id: "m_1", Message: &orrav1.ServiceMessage_TaskAck{TaskAck: &orrav1.TaskReport{ServiceId: "s_echo", DeliveryId: task.DeliveryID}}})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, ack))
+	assert.Equal(t, "m_1", read().GetAck().GetId())
+
+	wsm.deliveryMu.Lock()
+	defer wsm.deliveryMu.Unlock()
+	assert.Empty(t, wsm.deliveries)
+
+	assert.Error(t, validateEncoding("msgpack"))
+}
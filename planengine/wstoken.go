@@ -0,0 +1,131 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WSTokenPrefix      = "wst_"
+	WSTokenSubprotocol = "orra.ws-token"
+)
+
+var (
+	ErrWSTokenNotFound = errors.New("websocket token not found")
+	ErrWSTokenExpired  = errors.New("websocket token has expired")
+)
+
+// WSToken is a short-lived, single use credential for opening a service WebSocket connection
+type WSToken struct {
+	Token     string    `json:"token"`
+	ProjectID string    `json:"-"`
+	ServiceID string    `json:"serviceId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WSTokenStore keeps issued WebSocket tokens in memory until they're used or expire
+type WSTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*WSToken
+	ttl    time.Duration
+}
+
+func NewWSTokenStore(ttl time.Duration) *WSTokenStore {
+	return &WSTokenStore{
+		tokens: make(map[string]*WSToken),
+		ttl:    ttl,
+	}
+}
+
+// Issue mints a new token bound to a project's service
+func (s *WSTokenStore) Issue(projectID, serviceID string) (*WSToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate websocket token: %w", err)
+	}
+
+	token := &WSToken{
+		Token:     WSTokenPrefix + hex.EncodeToString(raw),
+		ProjectID: projectID,
+		ServiceID: serviceID,
+		ExpiresAt: time.Now().UTC().Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	s.tokens[token.Token] = token
+	return token, nil
+}
+
+// Consume validates and removes a token so it cannot be replayed
+func (s *WSTokenStore) Consume(value string) (*WSToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[value]
+	if !ok {
+		return nil, ErrWSTokenNotFound
+	}
+	delete(s.tokens, value)
+
+	if time.Now().UTC().After(token.ExpiresAt) {
+		return nil, ErrWSTokenExpired
+	}
+	return token, nil
+}
+
+func (s *WSTokenStore) purgeExpired() {
+	now := time.Now().UTC()
+	for value, token := range s.tokens {
+		if now.After(token.ExpiresAt) {
+			delete(s.tokens, value)
+		}
+	}
+}
+
+// webSocketCredential extracts a credential from the upgrade request, in order of preference:
+// the Authorization header, the Sec-WebSocket-Protocol header and finally the legacy apiKey query param.
+func webSocketCredential(r *http.Request) (credential string, fromQuery bool) {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1], false
+		}
+	}
+
+	// Browsers can't set headers on WebSocket requests, so the token can be passed as
+	// a subprotocol alongside WSTokenSubprotocol, e.g. "orra.ws-token, wst_..."
+	for _, protocol := range websocketSubprotocols(r) {
+		if strings.HasPrefix(protocol, WSTokenPrefix) {
+			return protocol, false
+		}
+	}
+
+	return r.URL.Query().Get("apiKey"), true
+}
+
+func websocketSubprotocols(r *http.Request) []string {
+	var out []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				out = append(out, protocol)
+			}
+		}
+	}
+	return out
+}
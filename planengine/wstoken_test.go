@@ -0,0 +1,84 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ *  License, v. 2.0. If a copy of the MPL was not distributed with this
+ *  file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSTokenStore_IssueAndConsume(t *testing.T) {
+	store := NewWSTokenStore(time.Minute)
+
+	token, err := store.Issue("p_test", "s_echo")
+	require.NoError(t, err)
+	assert.True(t, len(token.Token) > len(WSTokenPrefix))
+
+	consumed, err := store.Consume(token.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "p_test", consumed.ProjectID)
+	assert.Equal(t, "s_echo", consumed.ServiceID)
+
+	_, err = store.Consume(token.Token)
+	assert.ErrorIs(t, err, ErrWSTokenNotFound, "tokens are single use")
+}
+
+func TestWSTokenStore_RejectsExpiredTokens(t *testing.T) {
+	store := NewWSTokenStore(-time.Second)
+
+	token, err := store.Issue("p_test", "s_echo")
+	require.NoError(t, err)
+
+	_, err = store.Consume(token.Token)
+	assert.ErrorIs(t, err, ErrWSTokenExpired)
+}
+
+func TestWebSocketCredential(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		headers       map[string]string
+		wantCred      string
+		wantFromQuery bool
+	}{
+		{
+			name:     "Authorization header",
+			url:      "/ws?serviceId=s_echo",
+			headers:  map[string]string{"Authorization": "Bearer wst_abc"},
+			wantCred: "wst_abc",
+		},
+		{
+			name:     "Subprotocol header",
+			url:      "/ws?serviceId=s_echo",
+			headers:  map[string]string{"Sec-WebSocket-Protocol": "orra.ws-token, wst_abc"},
+			wantCred: "wst_abc",
+		},
+		{
+			name:          "Legacy query param",
+			url:           "/ws?serviceId=s_echo&apiKey=sk-orra-v1-abc",
+			wantCred:      "sk-orra-v1-abc",
+			wantFromQuery: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			cred, fromQuery := webSocketCredential(req)
+			assert.Equal(t, tt.wantCred, cred)
+			assert.Equal(t, tt.wantFromQuery, fromQuery)
+		})
+	}
+}
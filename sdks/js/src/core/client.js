@@ -36,12 +36,21 @@ class OrraSDK {
 	#inProgressTasks = new Map();
 	#maxProcessedTasksAge = 24 * 60 * 60 * 1000; // 24 hours
 	#maxInProgressAge = 30 * 60 * 1000; // 30 minutes
+	#taskHeartbeatInterval = 10 * 1000; // 10 seconds
+	#maxMessageBytes = 1024 * 1024; // 1MB, larger messages are sent to us in chunks
+	#engineMaxMessageBytes = null;
+	#chunkTransfers = new Map();
+	#protocolVersion = 1; // the task and result message schema this SDK speaks
 	#userInitiatedClose = false;
+	#resumeToken = null;
+	#instanceId = null;
 	#cacheCleanupIntervalId = null;
 	
 	constructor({ serviceName, connection, persistence }) {
 		this.#apiUrl = connection.orraUrl;
 		this.#apiKey = connection.orraKey;
+		// Instances of a service running side by side connect with distinct instance IDs to share its tasks
+		this.#instanceId = connection.instanceId || null;
 		this.#ws = null;
 		this.#taskHandler = null;
 		this.name = serviceName
@@ -257,7 +266,11 @@ class OrraSDK {
 		}
 		
 		const wsUrl = this.#apiUrl.replace('http', 'ws');
-		this.#ws = new WebSocket(`${wsUrl}/ws?serviceId=${this.serviceId}&apiKey=${this.#apiKey}`);
+		// Resuming the previous connection replays the messages sent while disconnected
+		const resume = this.#resumeToken ? `&resumeToken=${this.#resumeToken}` : '';
+		const instance = this.#instanceId ? `&instanceId=${encodeURIComponent(this.#instanceId)}` : '';
+		this.#ws = new WebSocket(`${wsUrl}/ws?serviceId=${this.serviceId}&apiKey=${this.#apiKey}&maxMessageBytes=${this.#maxMessageBytes}&protocolVersion=${this.#protocolVersion}${instance}${resume}`);
+		this.#chunkTransfers.clear();
 		
 		this.logger.debug('Initiating WebSocket connection');
 		
@@ -286,13 +299,24 @@ class OrraSDK {
 				return;
 			}
 			
+			if (parsedData.type === 'chunk') {
+				parsedData = this.#reassembleChunk(parsedData);
+				if (!parsedData) return;
+			}
+			
 			switch (parsedData.type) {
 				case 'ping':
 					this.#handlePing(parsedData);
 					break;
+				case 'health_probe':
+					this.#handleHealthProbe(parsedData);
+					break;
 				case 'ACK':
 					this.#handleAcknowledgment(parsedData);
 					break;
+				case 'resume_token':
+					this.#handleResumeToken(parsedData);
+					break;
 				case 'task_request':
 					this.#handleTask(parsedData);
 					break;
@@ -351,9 +375,39 @@ class OrraSDK {
 		this.logger.trace("Sent PONG");
 	}
 	
+	// Health probes check the service is still handling messages, unanswered probes pause its tasks
+	#handleHealthProbe(data) {
+		if (data.serviceId !== this.serviceId) {
+			this.logger.trace(`Received health probe for unknown serviceId: ${data.serviceId}`);
+			return
+		}
+		if (this.#isConnected && this?.#ws?.readyState === WebSocket.OPEN) {
+			this.#ws.send(JSON.stringify({
+				id: `probe_${data.probeId}`,
+				protocolVersion: this.#protocolVersion,
+				payload: { type: 'health_probe_result', serviceId: this.serviceId, probeId: data.probeId }
+			}));
+			this.logger.trace('Answered health probe', { probeId: data.probeId });
+		}
+	}
+	
+	#handleResumeToken(data) {
+		if (data.serviceId !== this.serviceId) {
+			this.logger.trace(`Received resume token for unknown serviceId: ${data.serviceId}`);
+			return
+		}
+		this.#resumeToken = data.token;
+		this.#engineMaxMessageBytes = data.maxMessageBytes || null;
+		this.logger.debug('Received resume token', {
+			replayed: data.replayed,
+			protocolVersion: data.protocolVersion,
+			supportedProtocolVersions: data.supportedProtocolVersions
+		});
+	}
+	
 	#sendPong() {
 		if (this.#isConnected && this?.#ws?.readyState === WebSocket.OPEN) {
-			this?.#ws?.send(JSON.stringify({ id: "pong", payload: { type: 'pong', serviceId: this.serviceId } }));
+			this?.#ws?.send(JSON.stringify({ id: "pong", protocolVersion: this.#protocolVersion, payload: { type: 'pong', serviceId: this.serviceId } }));
 		}
 	}
 	
@@ -363,12 +417,22 @@ class OrraSDK {
 	}
 	
 	#handleTask(task) {
-		const { id: taskId, executionId, idempotencyKey } = task;
+		const { id: taskId, executionId, idempotencyKey, deliveryId } = task;
+		
+		// Acknowledge delivery before anything else, otherwise the plan engine redelivers the task
+		if (deliveryId) {
+			this.#sendTaskAck(taskId, executionId, this.serviceId, idempotencyKey, deliveryId);
+		}
 		
 		task.pushUpdate = (updateData) => {
 			return this.pushUpdate(taskId, executionId, idempotencyKey, updateData);
 		};
 		
+		// Streams a log line to the plan engine, tagged with the task and its orchestration
+		task.log = (level, message, fields = undefined) => {
+			this.#sendTaskLog(task.orchestrationId, taskId, executionId, level, message, fields);
+		};
+		
 		this.logger.trace('Task handling initiated', {
 			taskId,
 			executionId,
@@ -442,9 +506,11 @@ class OrraSDK {
 		});
 		
 		this.#inProgressTasks.set(idempotencyKey, { startTime });
+		const stopHeartbeat = this.#startTaskHeartbeat(taskId, executionId, idempotencyKey, deliveryId);
 		
 		Promise.resolve(this.#taskHandler(task))
 			.then((taskResult) => {
+				stopHeartbeat();
 				const result = {
 					task: taskResult,
 					compensation: this.#revertible ? {
@@ -474,6 +540,7 @@ class OrraSDK {
 				this.#sendTaskResult(taskId, executionId, this.serviceId, idempotencyKey, result);
 			})
 			.catch((error) => {
+				stopHeartbeat();
 				const processingTime = Date.now() - startTime;
 				this.logger.trace('Task processing failed', {
 					taskId,
@@ -629,6 +696,33 @@ class OrraSDK {
 		}, delay);
 	}
 	
+	#sendTaskAck(taskId, executionId, serviceId, idempotencyKey, deliveryId) {
+		const message = {
+			type: 'task_ack',
+			taskId,
+			executionId,
+			serviceId,
+			idempotencyKey,
+			deliveryId,
+		};
+		this.#sendMessage(message);
+	}
+	
+	// Renews the task's lease while it's processed, so the plan engine doesn't hand it to another instance
+	#startTaskHeartbeat(taskId, executionId, idempotencyKey, deliveryId) {
+		const intervalId = setInterval(() => {
+			this.#sendMessage({
+				type: 'task_heartbeat',
+				taskId,
+				executionId,
+				serviceId: this.serviceId,
+				idempotencyKey,
+				deliveryId,
+			});
+		}, this.#taskHeartbeatInterval);
+		return () => clearInterval(intervalId);
+	}
+	
 	#sendTaskStatus(taskId, executionId, serviceId, idempotencyKey, status) {
 		const message = {
 			type: 'task_status',
@@ -653,6 +747,22 @@ class OrraSDK {
 		this.#sendMessage(message);
 	}
 	
+	#sendTaskLog(orchestrationId, taskId, executionId, level, message, fields) {
+		this.#sendMessage({
+			type: 'task_log',
+			serviceId: this.serviceId,
+			orchestrationId,
+			taskId,
+			executionId,
+			logs: [{
+				level,
+				message: String(message),
+				fields,
+				timestamp: new Date().toISOString()
+			}]
+		});
+	}
+	
 	#sendTaskResult(taskId, executionId, serviceId, idempotencyKey, result, error = null) {
 		const message = {
 			type: 'task_result',
@@ -669,7 +779,7 @@ class OrraSDK {
 	#sendMessage(message) {
 		this.#messageId++
 		const id = `message_${this.#messageId}_${message.executionId}`;
-		const wrappedMessage = { id, payload: message };
+		const wrappedMessage = { id, protocolVersion: this.#protocolVersion, payload: message };
 		
 		this.logger.trace('Preparing to send message', {
 			messageId: id,
@@ -678,7 +788,7 @@ class OrraSDK {
 		
 		if (this.#isConnected && this?.#ws?.readyState === WebSocket.OPEN) {
 			try {
-				this.#ws.send(JSON.stringify(wrappedMessage));
+				this.#send(JSON.stringify(wrappedMessage));
 				this.logger.debug('Message sent successfully', {
 					messageId: id,
 					type: message.type
@@ -705,6 +815,52 @@ class OrraSDK {
 		}
 	}
 	
+	// Messages larger than the engine accepts in one piece, e.g. large task results, are sent in chunks
+	#send(data) {
+		const message = Buffer.from(data);
+		if (!this.#engineMaxMessageBytes || message.length <= this.#engineMaxMessageBytes) {
+			this.#ws.send(data);
+			return;
+		}
+		
+		const pieceSize = Math.floor((this.#engineMaxMessageBytes - 128) / 4) * 3;
+		const total = Math.ceil(message.length / pieceSize);
+		const transferId = `t_${Date.now()}_${this.#messageId}`;
+		for (let index = 0; index < total; index++) {
+			const piece = message.subarray(index * pieceSize, (index + 1) * pieceSize);
+			this.#ws.send(JSON.stringify({ type: 'chunk', transferId, index, total, data: piece.toString('base64') }));
+		}
+		this.logger.debug('Sent message in chunks', { transferId, chunks: total, size: message.length });
+	}
+	
+	#reassembleChunk(chunk) {
+		let transfer = this.#chunkTransfers.get(chunk.transferId);
+		if (!transfer) {
+			transfer = { parts: new Array(chunk.total), received: 0 };
+			this.#chunkTransfers.set(chunk.transferId, transfer);
+		}
+		if (!transfer.parts[chunk.index]) {
+			transfer.parts[chunk.index] = Buffer.from(chunk.data || '', 'base64');
+			transfer.received++;
+		}
+		if (transfer.received < chunk.total) {
+			return null;
+		}
+		
+		this.#chunkTransfers.delete(chunk.transferId);
+		try {
+			const parsedData = JSON.parse(Buffer.concat(transfer.parts).toString('utf8'));
+			this.logger.trace('Reassembled chunked message', { messageType: parsedData.type, chunks: chunk.total });
+			return parsedData;
+		} catch (error) {
+			this.logger.error('Failed to parse chunked WebSocket message', {
+				error: error.message,
+				transferId: chunk.transferId
+			});
+			return null;
+		}
+	}
+	
 	#handleMessageTimeout(id) {
 		if (this.#pendingMessages.has(id)) {
 			const message = this.#pendingMessages.get(id);
@@ -716,7 +872,7 @@ class OrraSDK {
 	#sendQueuedMessages() {
 		while (this.#messageQueue.length > 0 && this.#isConnected && this?.#ws?.readyState === WebSocket.OPEN) {
 			const message = this.#messageQueue.shift();
-			this.#ws.send(JSON.stringify(message));
+			this.#send(JSON.stringify(message));
 			this.logger.debug('Sent queued message', {
 				message,
 			});
@@ -903,6 +1059,7 @@ const initOrraEntity = (type) => ({
 	                                  orraUrl,
 	                                  orraKey,
 	                                  persistenceOpts = {},
+	                                  instanceId,
                                   }) => {
 	validateName(name, type);
 	
@@ -918,7 +1075,8 @@ const initOrraEntity = (type) => ({
 		serviceName: name,
 		connection: {
 			orraUrl,
-			orraKey
+			orraKey,
+			instanceId
 		},
 		persistence: {
 			filePath: path.join(process.cwd(), DEFAULT_SERVICE_KEY_DIR, `${name}-${DEFAULT_SERVICE_KEY_FILE}`),
@@ -3,11 +3,13 @@
 #   file, You can obtain one at https://mozilla.org/MPL/2.0/.
 
 import asyncio
+import base64
 import json
 import time
 from datetime import datetime, timezone
 from pathlib import Path
 from typing import Optional, Dict, Any, Callable, Awaitable
+from urllib.parse import quote
 
 import httpx
 import websockets
@@ -22,8 +24,12 @@ from .types import (
 
 MAX_PROCESSED_TASKS_AGE = 24 * 60 * 60  # 24 hours in seconds
 MAX_IN_PROGRESS_AGE = 30 * 60  # 30 minutes in seconds
+TASK_HEARTBEAT_INTERVAL = 10  # seconds
 CLEANUP_INTERVAL = 60 * 60  # Run every hour
 MAX_MESSAGE_SIZE = 10_485_760 + (1024 * 2)  # 10.5 MB
+MAX_CHUNK_SIZE = 1_048_576  # 1 MB, larger messages are sent to us in chunks
+CHUNK_FRAME_OVERHEAD = 128
+PROTOCOL_VERSION = 1  # the task and result message schema this SDK speaks
 
 
 class OrraSDK:
@@ -36,7 +42,8 @@ class OrraSDK:
             persistence_file_path: Optional[Path] = None,
             custom_save: Optional[Callable[[str], Awaitable[None]]] = None,
             custom_load: Optional[Callable[[], Awaitable[Optional[str]]]] = None,
-            log_level: str = "INFO"
+            log_level: str = "INFO",
+            instance_id: Optional[str] = None
     ):
         """Initialize the Orra SDK client
 
@@ -49,6 +56,7 @@ class OrraSDK:
             custom_save: Custom save function (for custom persistence)
             custom_load: Custom load function (for custom persistence)
             log_level: Logging level
+            instance_id: Identifies this instance when several instances of the service run side by side
         """
         if not api_key.startswith("sk-orra-"):
             raise OrraError("Invalid API key format")
@@ -85,6 +93,10 @@ class OrraSDK:
         self._reconnect_interval = 1.0  # 1 second
         self._max_reconnect_interval = 30.0  # 30 seconds
         self._user_initiated_close = False
+        self._resume_token: Optional[str] = None
+        self._engine_max_message_bytes: Optional[int] = None
+        self._chunk_transfers: Dict[str, Dict[str, Any]] = {}
+        self._instance_id = instance_id
         self._is_connected = asyncio.Event()
 
         # Initialize HTTP client for API calls
@@ -229,7 +241,12 @@ class OrraSDK:
             raise ConnectionError("Cannot connect: SDK is shutting down")
 
         ws_url = self._url.replace("http", "ws")
-        uri = f"{ws_url}/ws?serviceId={self.service_id}&apiKey={self._api_key}"
+        uri = f"{ws_url}/ws?serviceId={self.service_id}&apiKey={self._api_key}&maxMessageBytes={MAX_CHUNK_SIZE}&protocolVersion={PROTOCOL_VERSION}"
+        if self._instance_id:
+            uri += f"&instanceId={quote(self._instance_id)}"
+        # Resuming the previous connection replays the messages sent while disconnected
+        if self._resume_token:
+            uri += f"&resumeToken={self._resume_token}"
 
         try:
             self._ws = await websockets.connect(
@@ -237,6 +254,7 @@ class OrraSDK:
                 max_size=MAX_MESSAGE_SIZE
             )
             self._reconnect_attempts = 0
+            self._chunk_transfers.clear()
             self._is_connected.set()
             self.logger.info("WebSocket connection established")
 
@@ -264,12 +282,20 @@ class OrraSDK:
             async for message in self._ws:
                 try:
                     data = json.loads(message)
+                    if data.get("type") == "chunk":
+                        data = self._reassemble_chunk(data)
+                        if data is None:
+                            continue
                     message_type = data.get("type")
 
                     if message_type == "ping":
                         await self._handle_ping(data)
+                    elif message_type == "health_probe":
+                        await self._handle_health_probe(data)
                     elif message_type == "ACK":
                         await self._handle_ack(data)
+                    elif message_type == "resume_token":
+                        await self._handle_resume_token(data)
                     elif message_type == "task_request":
                         await self._handle_task(data)
                     elif message_type == "compensation_request":
@@ -308,6 +334,15 @@ class OrraSDK:
         execution_id = task.get("executionId")
         idempotency_key = task.get("idempotencyKey")
 
+        # Acknowledge delivery before anything else, otherwise the plan engine redelivers the task
+        if delivery_id := task.get("deliveryId"):
+            await self._send_task_ack(
+                task_id=task_id,
+                idempotency_key=idempotency_key,
+                execution_id=execution_id,
+                delivery_id=delivery_id
+            )
+
         self.logger.debug(
             "Task handling initiated",
             taskId=task_id,
@@ -360,6 +395,12 @@ class OrraSDK:
         # Process new task
         start_time = time.time()
         self._in_progress_tasks[idempotency_key] = {"start_time": start_time}
+        heartbeat = asyncio.create_task(self._send_task_heartbeats(
+            task_id=task_id,
+            idempotency_key=idempotency_key,
+            execution_id=execution_id,
+            delivery_id=task.get("deliveryId")
+        ))
 
         try:
             self.logger.debug(
@@ -375,7 +416,8 @@ class OrraSDK:
                 execution_id=execution_id,
                 idempotency_key=idempotency_key,
                 raw_input=raw_input,
-                sdk=self
+                sdk=self,
+                orchestration_id=task.get("orchestrationId")
             )
             self.logger.debug(
                 "Processed task handler",
@@ -423,6 +465,7 @@ class OrraSDK:
             )
 
         finally:
+            heartbeat.cancel()
             del self._in_progress_tasks[idempotency_key]
 
     async def _handle_compensation(self, data: Dict[str, Any]) -> None:
@@ -591,6 +634,43 @@ class OrraSDK:
         }
         await self._send_message(message)
 
+    async def _send_task_ack(
+            self,
+            task_id: str,
+            idempotency_key: str,
+            execution_id: str,
+            delivery_id: str
+    ) -> None:
+        """Acknowledge delivery of a task"""
+        message = {
+            "type": "task_ack",
+            "taskId": task_id,
+            "idempotencyKey": idempotency_key,
+            "executionId": execution_id,
+            "serviceId": self.service_id,
+            "deliveryId": delivery_id
+        }
+        await self._send_message(message)
+
+    async def _send_task_heartbeats(
+            self,
+            task_id: str,
+            idempotency_key: str,
+            execution_id: str,
+            delivery_id: Optional[str]
+    ) -> None:
+        """Renew a task's lease while it's processed, so the plan engine doesn't hand it to another instance"""
+        while True:
+            await asyncio.sleep(TASK_HEARTBEAT_INTERVAL)
+            await self._send_message({
+                "type": "task_heartbeat",
+                "taskId": task_id,
+                "idempotencyKey": idempotency_key,
+                "executionId": execution_id,
+                "serviceId": self.service_id,
+                "deliveryId": delivery_id
+            })
+
     async def _send_task_status(
             self,
             task_id: str,
@@ -610,6 +690,33 @@ class OrraSDK:
         }
         await self._send_message(message)
 
+    async def send_task_log(
+            self,
+            orchestration_id: Optional[str],
+            task_id: str,
+            execution_id: Optional[str],
+            level: str,
+            message: str,
+            fields: Optional[Dict[str, Any]] = None
+    ) -> None:
+        """Stream a log line about a task to the plan engine"""
+        line = {
+            "level": level,
+            "message": str(message),
+            "timestamp": datetime.now(timezone.utc).isoformat()
+        }
+        if fields:
+            line["fields"] = fields
+
+        await self._send_message({
+            "type": "task_log",
+            "serviceId": self.service_id,
+            "orchestrationId": orchestration_id,
+            "taskId": task_id,
+            "executionId": execution_id,
+            "logs": [line]
+        })
+
     async def _send_interim_task_result(
             self,
             task_id: str,
@@ -628,6 +735,24 @@ class OrraSDK:
         }
         await self._send_message(message)
 
+    async def _handle_resume_token(self, data: dict) -> None:
+        """Keep the token to resume the connection with after a disconnect"""
+        if data.get("serviceId") != self.service_id:
+            self.logger.trace(
+                "Received resume token for unknown serviceId",
+                receivedId=data.get("serviceId")
+            )
+            return
+
+        self._resume_token = data.get("token")
+        self._engine_max_message_bytes = data.get("maxMessageBytes")
+        self.logger.debug(
+            "Received resume token",
+            replayed=data.get("replayed"),
+            protocolVersion=data.get("protocolVersion"),
+            supportedProtocolVersions=data.get("supportedProtocolVersions")
+        )
+
     async def _handle_ping(self, data: dict) -> None:
         """Handle ping message"""
         if data.get("serviceId") != self.service_id:
@@ -641,10 +766,29 @@ class OrraSDK:
         await self._send_pong()
         self.logger.trace("Sent PONG")
 
+    async def _handle_health_probe(self, data: dict) -> None:
+        """Answer a health probe, unanswered probes pause the service's tasks"""
+        if data.get("serviceId") != self.service_id:
+            self.logger.trace(
+                "Received health probe for unknown serviceId",
+                receivedId=data.get("serviceId")
+            )
+            return
+
+        if self._ws and self._is_connected.is_set():
+            probe_id = data.get("probeId")
+            message = {
+                "id": f"probe_{probe_id}",
+                "protocolVersion": PROTOCOL_VERSION,
+                "payload": {"type": "health_probe_result", "serviceId": self.service_id, "probeId": probe_id}
+            }
+            await self._ws.send(json.dumps(message))
+            self.logger.trace("Answered health probe", probeId=probe_id)
+
     async def _send_pong(self) -> None:
         """Send pong response"""
         if self._ws and self._is_connected.is_set():
-            message = {"id": "pong", "payload": {"type": 'pong', "serviceId": self.service_id}}
+            message = {"id": "pong", "protocolVersion": PROTOCOL_VERSION, "payload": {"type": 'pong', "serviceId": self.service_id}}
             await self._ws.send(json.dumps(message))
 
     async def _handle_ack(self, data: dict) -> None:
@@ -663,6 +807,7 @@ class OrraSDK:
 
         wrapped_message = {
             "id": message_id,
+            "protocolVersion": PROTOCOL_VERSION,
             "payload": message
         }
 
@@ -682,7 +827,7 @@ class OrraSDK:
             return
 
         try:
-            await self._ws.send(json.dumps(wrapped_message))
+            await self._send(json.dumps(wrapped_message))
             self.logger.debug(
                 "Message sent successfully",
                 messageId=message_id,
@@ -701,6 +846,49 @@ class OrraSDK:
             )
             await self._message_queue.put(message)
 
+    async def _send(self, data: str) -> None:
+        """Send a message, in chunks if it's larger than the engine accepts in one piece"""
+        assert self._ws is not None
+
+        message = data.encode("utf-8")
+        if not self._engine_max_message_bytes or len(message) <= self._engine_max_message_bytes:
+            await self._ws.send(data)
+            return
+
+        piece_size = (self._engine_max_message_bytes - CHUNK_FRAME_OVERHEAD) // 4 * 3
+        total = (len(message) + piece_size - 1) // piece_size
+        transfer_id = f"t_{time.time_ns()}_{self._message_id}"
+        for index in range(total):
+            piece = message[index * piece_size:(index + 1) * piece_size]
+            await self._ws.send(json.dumps({
+                "type": "chunk",
+                "transferId": transfer_id,
+                "index": index,
+                "total": total,
+                "data": base64.b64encode(piece).decode("ascii")
+            }))
+        self.logger.debug("Sent message in chunks", transferId=transfer_id, chunks=total, size=len(message))
+
+    def _reassemble_chunk(self, chunk: dict) -> Optional[dict]:
+        """Store a chunk, returning its message once all the message's chunks have arrived"""
+        transfer_id = chunk.get("transferId")
+        total = chunk.get("total", 0)
+        transfer = self._chunk_transfers.setdefault(transfer_id, {"parts": [None] * total, "received": 0})
+
+        index = chunk.get("index", 0)
+        if transfer["parts"][index] is None:
+            transfer["parts"][index] = base64.b64decode(chunk.get("data") or "")
+            transfer["received"] += 1
+        if transfer["received"] < total:
+            return None
+
+        del self._chunk_transfers[transfer_id]
+        try:
+            return json.loads(b"".join(transfer["parts"]))
+        except json.JSONDecodeError:
+            self.logger.error("Failed to parse chunked WebSocket message", transferId=transfer_id)
+            return None
+
     async def _handle_message_timeout(self, message_id: str) -> None:
         """Handle message acknowledgment timeout"""
         await asyncio.sleep(5.0)  # 5 second timeout
@@ -124,14 +124,17 @@ class Task(Generic[T_Input]):
     Attributes:
         input: The task input data
         push_update: A method to send interim results back to the plan engine
+        log: A method to stream log lines about the task to the plan engine
     """
 
-    def __init__(self, input: T_Input, _sdk=None, _task_id=None, _execution_id=None, _idempotency_key=None):
+    def __init__(self, input: T_Input, _sdk=None, _task_id=None, _execution_id=None, _idempotency_key=None,
+                 _orchestration_id=None):
         self.input = input
         self._sdk = _sdk
         self._task_id = _task_id
         self._execution_id = _execution_id
         self._idempotency_key = _idempotency_key
+        self._orchestration_id = _orchestration_id
 
     async def push_update(self, update_data: dict) -> None:
         """
@@ -148,6 +151,30 @@ class Task(Generic[T_Input]):
 
         await self._sdk.push_update(self._task_id, self._execution_id, self._idempotency_key, update_data)
 
+    async def log(self, level: str, message: str, fields: Optional[Dict[str, Any]] = None) -> None:
+        """
+        Stream a log line to the plan engine, tagged with the task and its orchestration.
+
+        Args:
+            level: One of debug, info, warn or error
+            message: The log line
+            fields: Optional structured data about the line
+
+        Raises:
+            OrraError: If the SDK is not properly initialized
+        """
+        if not self._sdk or not self._task_id:
+            raise OrraError("Task not properly initialized for logging")
+
+        await self._sdk.send_task_log(
+            orchestration_id=self._orchestration_id,
+            task_id=self._task_id,
+            execution_id=self._execution_id,
+            level=level,
+            message=message,
+            fields=fields
+        )
+
 
 @dataclass
 class RevertSource(Generic[T_Input, T_Output]):
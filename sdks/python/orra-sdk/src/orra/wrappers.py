@@ -26,6 +26,7 @@ class OrraBase:
             custom_save: Optional[Callable[[str], Awaitable[None]]] = None,
             custom_load: Optional[Callable[[], Awaitable[Optional[str]]]] = None,
             log_level: str = "INFO",
+            instance_id: Optional[str] = None,
             revertible: bool = False,
             revert_ttl_ms: int = 24 * 60 * 60 * 1000  # 24 hours default
     ):
@@ -47,7 +48,8 @@ class OrraBase:
             persistence_file_path=persistence_file_path or targeted_service_key_path,
             custom_save=custom_save,
             custom_load=custom_load,
-            log_level=log_level
+            log_level=log_level,
+            instance_id=instance_id
         )
 
     @property
@@ -194,7 +196,8 @@ class OrraBase:
             self._handler = func
 
             # Create internal handler with validation
-            async def internal_handler(task_id: str, execution_id: str, idempotency_key: str, raw_input: Dict[str, Any], sdk) -> Dict[str, Any]:
+            async def internal_handler(task_id: str, execution_id: str, idempotency_key: str, raw_input: Dict[str, Any], sdk,
+                                       orchestration_id: Optional[str] = None) -> Dict[str, Any]:
                 try:
 
                     self._sdk.logger.trace(
@@ -212,7 +215,8 @@ class OrraBase:
                         _sdk=sdk,
                         _task_id=task_id,
                         _execution_id=execution_id,
-                        _idempotency_key=idempotency_key
+                        _idempotency_key=idempotency_key,
+                        _orchestration_id=orchestration_id
                     )
 
                     self._sdk.logger.debug("Executing handler", service=self._name)